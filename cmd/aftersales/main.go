@@ -11,9 +11,14 @@ import (
 	"google.golang.org/grpc"
 
 	pb "github.com/wyfcoding/ecommerce/goapi/aftersales/v1"
+	inventoryv1 "github.com/wyfcoding/ecommerce/goapi/inventory/v1"
+	logisticsv1 "github.com/wyfcoding/ecommerce/goapi/logistics/v1"
 	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
 	paymentv1 "github.com/wyfcoding/ecommerce/goapi/payment/v1"
+	productv1 "github.com/wyfcoding/ecommerce/goapi/product/v1"
+	usertierv1 "github.com/wyfcoding/ecommerce/goapi/usertier/v1"
 	"github.com/wyfcoding/ecommerce/internal/aftersales/application"
+	"github.com/wyfcoding/ecommerce/internal/aftersales/domain"
 	"github.com/wyfcoding/ecommerce/internal/aftersales/infrastructure/persistence"
 	aftersalesgrpc "github.com/wyfcoding/ecommerce/internal/aftersales/interfaces/grpc"
 	aftersaleshttp "github.com/wyfcoding/ecommerce/internal/aftersales/interfaces/http"
@@ -39,6 +44,8 @@ const IdempotencyPrefix = "aftersales:idem"
 // Config 服务扩展配置
 type Config struct {
 	configpkg.Config `mapstructure:",squash"`
+	Returns          application.ReturnsConfig `mapstructure:"returns"` // 退货仓与逆向物流
+	SLA              application.SLAConfig     `mapstructure:"sla"`     // 售后时效计时器扫描
 }
 
 // AppContext 应用上下文 (包含对外服务实例与依赖)
@@ -54,8 +61,12 @@ type AppContext struct {
 
 // ServiceClients 下游微服务客户端集合
 type ServiceClients struct {
-	Order   *grpc.ClientConn `service:"order"`
-	Payment *grpc.ClientConn `service:"payment"`
+	Order     *grpc.ClientConn `service:"order"`
+	Payment   *grpc.ClientConn `service:"payment"`
+	Logistics *grpc.ClientConn `service:"logistics"`
+	Inventory *grpc.ClientConn `service:"inventory"`
+	Product   *grpc.ClientConn `service:"product"`
+	UserTier  *grpc.ClientConn `service:"usertier"`
 }
 
 func main() {
@@ -173,11 +184,23 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	bootLog.Info("assembling services with full dependency injection...")
 
 	// 5.1 Infrastructure (Persistence)
+	// 售后商品新增订单行、验货字段，售后单新增策略与仲裁字段；售后运单、策略、计时器为新表
+	if err := db.RawDB().AutoMigrate(&domain.AfterSales{}, &domain.AfterSalesItem{}, &domain.AfterSalesShipment{},
+		&domain.AfterSalesPolicy{}, &domain.AfterSalesDeadline{}); err != nil {
+		clientCleanup()
+		redisCache.Close()
+		if sqlDB, err := db.RawDB().DB(); err == nil {
+			sqlDB.Close()
+		}
+		return nil, nil, fmt.Errorf("failed to migrate after-sales tables: %w", err)
+	}
 	aftersalesRepo := persistence.NewAfterSalesRepository(db.RawDB())
 
 	// 5.2 Application (Service)
 	orderClient := orderv1.NewOrderServiceClient(clients.Order)
 	paymentClient := paymentv1.NewPaymentServiceClient(clients.Payment)
+	logisticsClient := logisticsv1.NewLogisticsServiceClient(clients.Logistics)
+	inventoryClient := inventoryv1.NewInventoryServiceClient(clients.Inventory)
 
 	// 获取服务地址 (用于 Saga 回调)
 	dtmAddr := c.Services["dtm"].GRPCAddr
@@ -195,18 +218,30 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 		logger.Logger,
 		orderClient,
 		paymentClient,
+		logisticsClient,
+		inventoryClient,
+		c.Returns,
 		dtmAddr,
 		orderSvcURL,
 		paymentSvcURL,
 		aftersalesURL,
 	)
+	aftersalesService.SetSLAClients(
+		productv1.NewProductServiceClient(clients.Product),
+		usertierv1.NewUserTierServiceClient(clients.UserTier),
+	)
+
+	// 5.3 Background Worker (售后时效计时器)
+	slaWorker := application.NewSLAWorker(aftersalesRepo, aftersalesService, c.SLA, logger.Logger)
+	slaWorker.Start()
 
-	// 5.3 Interface (HTTP Handlers)
+	// 5.4 Interface (HTTP Handlers)
 	handler := aftersaleshttp.NewHandler(aftersalesService, logger.Logger)
 
 	// 定义资源清理函数
 	cleanup := func() {
 		bootLog.Info("shutting down, releasing resources...")
+		slaWorker.Stop()
 		clientCleanup()
 		if redisCache != nil {
 			if err := redisCache.Close(); err != nil {
@@ -15,7 +15,9 @@ import (
 
 	pb "github.com/wyfcoding/ecommerce/goapi/inventory/v1"
 	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
+	schedulerv1 "github.com/wyfcoding/ecommerce/goapi/scheduler/v1"
 	"github.com/wyfcoding/ecommerce/internal/inventory/application"
+	"github.com/wyfcoding/ecommerce/internal/inventory/domain"
 	"github.com/wyfcoding/ecommerce/internal/inventory/infrastructure/persistence"
 	inventorygrpc "github.com/wyfcoding/ecommerce/internal/inventory/interfaces/grpc"
 	inventoryhttp "github.com/wyfcoding/ecommerce/internal/inventory/interfaces/http"
@@ -146,6 +148,17 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	if err != nil {
 		return nil, nil, fmt.Errorf("sharding database init error: %w", err)
 	}
+	// 库存与预占表在每个分片上建表，仓库表仅位于 0 号分片
+	for i, db := range shardingMgr.GetAllDBs() {
+		models := []any{&domain.Inventory{}, &domain.InventoryLog{}, &domain.Reservation{}}
+		if i == 0 {
+			models = append(models, &domain.Warehouse{})
+		}
+		if err := db.AutoMigrate(models...); err != nil {
+			shardingMgr.Close()
+			return nil, nil, fmt.Errorf("failed to migrate inventory tables: %w", err)
+		}
+	}
 
 	// 2. 初始化缓存 (Redis)
 	redisCache, err := cache.NewRedisCache(c.Data.Redis, c.CircuitBreaker, logger, m)
@@ -171,6 +184,9 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 		clients.Order = orderv1.NewOrderServiceClient(clients.OrderConn)
 	}
 
+	// 用于将提前到达的超时消息重新登记到调度服务的延迟队列
+	producer := kafka.NewProducer(c.MessageQueue.Kafka, logger, m)
+
 	// 5. DDD 分层装配
 	bootLog.Info("assembling services with full dependency injection...")
 
@@ -183,8 +199,16 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	}
 	inventoryService := application.NewInventory(manager, application.NewInventoryQuery(inventoryRepo, warehouseRepo, logger.Logger))
 
-	// 5. 启动可靠库存自动释放消费者
-	consumer := kafka.NewConsumer(c.MessageQueue.Kafka, logger, m)
+	// 5. 启动过期预占清理任务 (不依赖订单服务，兜底释放未被确认或释放的预占)
+	sweeper := application.NewReservationSweeper(inventoryRepo, manager, logger.Logger)
+	sweeper.Start()
+
+	// 6. 启动可靠库存自动释放消费者
+	// order.payment.timeout 由调度服务的持久化延迟队列在订单到期后投递，消费即代表已超时。
+	timeoutConsumerCfg := c.MessageQueue.Kafka
+	timeoutConsumerCfg.Topic = "order.payment.timeout"
+	timeoutConsumerCfg.GroupID = BootstrapName + "-timeout-group"
+	consumer := kafka.NewConsumer(timeoutConsumerCfg, logger, m)
 	consumer.Start(context.Background(), 5, func(ctx context.Context, msg kafkago.Message) error {
 		if msg.Topic != "order.payment.timeout" {
 			return nil
@@ -194,6 +218,27 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 			return err
 		}
 
+		// 防御性校验：未到期的消息 (如绕过延迟队列直接发布) 不做释放，避免提前释放锁定库存。
+		// 直接确认会永久丢失这次释放，因此经调度服务的延迟队列重新登记，到期后再投递回本 Topic。
+		if expiresAt, ok := event["expires_at"].(float64); ok && time.Now().Unix() < int64(expiresAt) {
+			requeue, err := json.Marshal(&schedulerv1.ScheduleDelayEventRequest{
+				TaskKey:   fmt.Sprintf("%s:requeue:%d:%d", msg.Topic, msg.Partition, msg.Offset),
+				Source:    BootstrapName,
+				Topic:     msg.Topic,
+				Key:       string(msg.Key),
+				Payload:   string(msg.Value),
+				DeliverAt: int64(expiresAt),
+			})
+			if err != nil {
+				return err
+			}
+			if err := producer.PublishToTopic(ctx, "scheduler.delay.schedule", msg.Key, requeue); err != nil {
+				return err
+			}
+			bootLog.WarnContext(ctx, "order timeout event arrived before expiry, requeued", "order_id", event["order_id"], "expires_at", int64(expiresAt))
+			return nil
+		}
+
 		orderID := fmt.Sprintf("%v", event["order_id"])
 		// --- 幂等保护：防止库存重复释放 ---
 		idemKey := fmt.Sprintf("inventory:timeout:%s", orderID)
@@ -211,15 +256,34 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 		return nil
 	})
 
-	// 6. 接口层
+	// 7. 启动支付成功消费者
+	// order.paid 由订单服务在支付状态变更的同一事务内写入发件箱，确认失败返回错误由消费者重试。
+	paidConsumerCfg := c.MessageQueue.Kafka
+	paidConsumerCfg.Topic = "order.paid"
+	paidConsumerCfg.GroupID = BootstrapName + "-paid-group"
+	paidConsumer := kafka.NewConsumer(paidConsumerCfg, logger, m)
+	paidConsumer.Start(context.Background(), 5, func(ctx context.Context, msg kafkago.Message) error {
+		var event map[string]any
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			return err
+		}
+		return manager.HandleOrderPaid(ctx, event)
+	})
+
+	// 8. 接口层
 	handler := inventoryhttp.NewHandler(inventoryService, logger.Logger)
 
 	// 定义资源清理函数
 	cleanup := func() {
 		bootLog.Info("shutting down, releasing resources...")
+		sweeper.Stop()
 		if consumer != nil {
 			consumer.Close()
 		}
+		if paidConsumer != nil {
+			paidConsumer.Close()
+		}
+		producer.Close()
 		clientCleanup()
 		if redisCache != nil {
 			if err := redisCache.Close(); err != nil {
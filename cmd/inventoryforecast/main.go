@@ -11,6 +11,7 @@ import (
 	"google.golang.org/grpc"
 
 	pb "github.com/wyfcoding/ecommerce/goapi/inventoryforecast/v1"
+	schedulerv1 "github.com/wyfcoding/ecommerce/goapi/scheduler/v1"
 	"github.com/wyfcoding/ecommerce/internal/inventoryforecast/application"
 	"github.com/wyfcoding/ecommerce/internal/inventoryforecast/infrastructure/persistence"
 	forecastgrpc "github.com/wyfcoding/ecommerce/internal/inventoryforecast/interfaces/grpc"
@@ -75,6 +76,8 @@ func main() {
 func registerGRPC(s *grpc.Server, svc any) {
 	ctx := svc.(*AppContext)
 	pb.RegisterInventoryForecastServiceServer(s, forecastgrpc.NewServer(ctx.Forecast))
+	// 每日销量预测作业由调度中心按 Cron 触发
+	schedulerv1.RegisterJobExecutorServiceServer(s, forecastgrpc.NewJobExecutor(ctx.Forecast, ctx.Idempotency))
 }
 
 // registerGin 注册 HTTP 路由
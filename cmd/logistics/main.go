@@ -11,7 +11,11 @@ import (
 	"google.golang.org/grpc"
 
 	pb "github.com/wyfcoding/ecommerce/goapi/logistics/v1"
+	notificationv1 "github.com/wyfcoding/ecommerce/goapi/notification/v1"
+	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
 	"github.com/wyfcoding/ecommerce/internal/logistics/application"
+	"github.com/wyfcoding/ecommerce/internal/logistics/domain"
+	"github.com/wyfcoding/ecommerce/internal/logistics/infrastructure/carrier"
 	"github.com/wyfcoding/ecommerce/internal/logistics/infrastructure/persistence"
 	logisticsgrpc "github.com/wyfcoding/ecommerce/internal/logistics/interfaces/grpc"
 	logisticshttp "github.com/wyfcoding/ecommerce/internal/logistics/interfaces/http"
@@ -36,6 +40,8 @@ const IdempotencyPrefix = "logistics:idem"
 // Config 服务扩展配置
 type Config struct {
 	configpkg.Config `mapstructure:",squash"`
+	Tracking         application.TrackingConfig `mapstructure:"tracking"` // 轨迹主动查询周期与批量
+	Carriers         carrier.Config             `mapstructure:"carriers"` // 承运商推送验签与查询接入
 }
 
 // AppContext 应用上下文 (包含对外服务实例与依赖)
@@ -51,7 +57,8 @@ type AppContext struct {
 
 // ServiceClients 下游微服务客户端集合
 type ServiceClients struct {
-	// 目前 Logistics 服务无下游强依赖
+	Order        *grpc.ClientConn `service:"order"`        // 签收后确认订单送达
+	Notification *grpc.ClientConn `service:"notification"` // 签收后通知买家
 }
 
 func main() {
@@ -109,6 +116,9 @@ func registerGin(e *gin.Engine, svc any) {
 	// 全局限流中间件
 	e.Use(middleware.RateLimitWithLimiter(ctx.Limiter))
 
+	// 承运商轨迹推送：由承运商直接回调，依赖签名校验而非 JWT
+	ctx.Handler.RegisterWebhookRoutes(e.Group("/api/v1"))
+
 	// 业务 API 路由 v1
 	api := e.Group("/api/v1")
 	{
@@ -158,13 +168,40 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	// 5. DDD 分层装配
 	bootLog.Info("assembling services with full dependency injection...")
 
-	// 5.1 Infrastructure (Persistence)
+	// 5.1 Infrastructure (Persistence, Carriers)
+	// 物流单新增买家、运单类型与轨迹同步字段，轨迹新增承运商事件去重键
+	if err := db.RawDB().AutoMigrate(&domain.Logistics{}, &domain.LogisticsTrace{}); err != nil {
+		clientCleanup()
+		redisCache.Close()
+		if sqlDB, err := db.RawDB().DB(); err == nil {
+			sqlDB.Close()
+		}
+		return nil, nil, fmt.Errorf("failed to migrate logistics tables: %w", err)
+	}
 	logisticsRepo := persistence.NewLogisticsRepository(db.RawDB())
 
+	webhooks, trackers, err := carrier.NewTrackingAdapters(c.Carriers, nil)
+	if err != nil {
+		clientCleanup()
+		redisCache.Close()
+		if sqlDB, err := db.RawDB().DB(); err == nil {
+			sqlDB.Close()
+		}
+		return nil, nil, fmt.Errorf("carrier adapters init error: %w", err)
+	}
+
 	// 5.2 Application (Service)
 	query := application.NewLogisticsQuery(logisticsRepo, logger.Logger)
 	manager := application.NewLogisticsManager(logisticsRepo, logger.Logger)
-	logisticsService := application.NewLogistics(manager, query)
+	tracking := application.NewTrackingService(logisticsRepo, webhooks, trackers,
+		orderv1.NewOrderServiceClient(clients.Order),
+		notificationv1.NewNotificationServiceClient(clients.Notification),
+		c.Tracking, logger.Logger)
+	logisticsService := application.NewLogistics(manager, query, tracking)
+
+	// 主动查询不支持推送的承运商轨迹，并重试签收后的订单同步
+	trackingPoller := application.NewTrackingPoller(tracking, logger.Logger)
+	trackingPoller.Start()
 
 	// 5.3 Interface (HTTP Handlers)
 	handler := logisticshttp.NewHandler(logisticsService, logger.Logger)
@@ -172,6 +209,7 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	// 定义资源清理函数
 	cleanup := func() {
 		bootLog.Info("shutting down, releasing resources...")
+		trackingPoller.Stop()
 		clientCleanup()
 		if redisCache != nil {
 			if err := redisCache.Close(); err != nil {
@@ -11,7 +11,12 @@ import (
 	"google.golang.org/grpc"
 
 	pb "github.com/wyfcoding/ecommerce/goapi/logisticsrouting/v1"
+	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
+	productv1 "github.com/wyfcoding/ecommerce/goapi/product/v1"
+	warehousev1 "github.com/wyfcoding/ecommerce/goapi/warehouse/v1"
 	"github.com/wyfcoding/ecommerce/internal/logisticsrouting/application"
+	"github.com/wyfcoding/ecommerce/internal/logisticsrouting/domain"
+	"github.com/wyfcoding/ecommerce/internal/logisticsrouting/infrastructure/geocoding"
 	"github.com/wyfcoding/ecommerce/internal/logisticsrouting/infrastructure/persistence"
 	routinggrpc "github.com/wyfcoding/ecommerce/internal/logisticsrouting/interfaces/grpc"
 	routinghttp "github.com/wyfcoding/ecommerce/internal/logisticsrouting/interfaces/http"
@@ -36,6 +41,7 @@ const IdempotencyPrefix = "logisticsrouting:idem"
 // Config 服务扩展配置
 type Config struct {
 	configpkg.Config `mapstructure:",squash"`
+	Routing          application.RoutingConfig `mapstructure:"routing"` // 求解预算、体积重与地理编码
 }
 
 // AppContext 应用上下文 (包含对外服务实例与依赖)
@@ -51,7 +57,9 @@ type AppContext struct {
 
 // ServiceClients 下游微服务客户端集合
 type ServiceClients struct {
-	// 目前 LogisticsRouting 服务无下游强依赖
+	Order     *grpc.ClientConn `service:"order"`
+	Product   *grpc.ClientConn `service:"product"`
+	Warehouse *grpc.ClientConn `service:"warehouse"`
 }
 
 func main() {
@@ -159,11 +167,34 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	bootLog.Info("assembling services with full dependency injection...")
 
 	// 5.1 Infrastructure (Persistence)
+	// 配送车辆为新表，路由方案新增车辆行程与未安排订单字段
+	if err := db.RawDB().AutoMigrate(&domain.Vehicle{}, &domain.OptimizedRoute{}); err != nil {
+		clientCleanup()
+		redisCache.Close()
+		if sqlDB, err := db.RawDB().DB(); err == nil {
+			sqlDB.Close()
+		}
+		return nil, nil, fmt.Errorf("failed to migrate routing tables: %w", err)
+	}
 	routingRepo := persistence.NewLogisticsRoutingRepository(db.RawDB())
 
+	// 离线地名库地理编码
+	geocoder, err := geocoding.NewGazetteer(c.Routing.GazetteerFile)
+	if err != nil {
+		clientCleanup()
+		redisCache.Close()
+		if sqlDB, err := db.RawDB().DB(); err == nil {
+			sqlDB.Close()
+		}
+		return nil, nil, fmt.Errorf("geocoder init error: %w", err)
+	}
+
 	// 5.2 Application (Service)
+	orderClient := orderv1.NewOrderServiceClient(clients.Order)
+	productClient := productv1.NewProductServiceClient(clients.Product)
+	warehouseClient := warehousev1.NewWarehouseServiceClient(clients.Warehouse)
 	query := application.NewLogisticsRoutingQuery(routingRepo)
-	manager := application.NewLogisticsRoutingManager(routingRepo, logger.Logger)
+	manager := application.NewLogisticsRoutingManager(routingRepo, orderClient, productClient, warehouseClient, geocoder, c.Routing, logger.Logger)
 	routingService := application.NewLogisticsRoutingService(manager, query)
 
 	// 5.3 Interface (HTTP Handlers)
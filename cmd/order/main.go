@@ -9,11 +9,18 @@ import (
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
 
+	advancedcouponv1 "github.com/wyfcoding/ecommerce/goapi/advancedcoupon/v1"
 	inventoryv1 "github.com/wyfcoding/ecommerce/goapi/inventory/v1"
+	marketingv1 "github.com/wyfcoding/ecommerce/goapi/marketing/v1"
 	pb "github.com/wyfcoding/ecommerce/goapi/order/v1"
 	paymentv1 "github.com/wyfcoding/ecommerce/goapi/payment/v1"
+	productv1 "github.com/wyfcoding/ecommerce/goapi/product/v1"
+	usertierv1 "github.com/wyfcoding/ecommerce/goapi/usertier/v1"
 	"github.com/wyfcoding/ecommerce/internal/order/application"
+	"github.com/wyfcoding/ecommerce/internal/order/domain"
 	"github.com/wyfcoding/ecommerce/internal/order/infrastructure/persistence"
+	"github.com/wyfcoding/ecommerce/internal/order/infrastructure/pricing"
+	orderscheduler "github.com/wyfcoding/ecommerce/internal/order/infrastructure/scheduler"
 	"github.com/wyfcoding/ecommerce/internal/order/interfaces/event"
 	ordergrpc "github.com/wyfcoding/ecommerce/internal/order/interfaces/grpc"
 	orderhttp "github.com/wyfcoding/ecommerce/internal/order/interfaces/http"
@@ -57,10 +64,13 @@ type AppContext struct {
 
 // ServiceClients 下游微服务客户端集合
 type ServiceClients struct {
-	Warehouse *grpc.ClientConn `service:"warehouse"`
-	Inventory *grpc.ClientConn `service:"inventory"`
-	Payment   *grpc.ClientConn `service:"payment"`
-	Product   *grpc.ClientConn `service:"product"`
+	Warehouse      *grpc.ClientConn `service:"warehouse"`
+	Inventory      *grpc.ClientConn `service:"inventory"`
+	Payment        *grpc.ClientConn `service:"payment"`
+	Product        *grpc.ClientConn `service:"product"`
+	Marketing      *grpc.ClientConn `service:"marketing"`
+	UserTier       *grpc.ClientConn `service:"usertier"`
+	AdvancedCoupon *grpc.ClientConn `service:"advancedcoupon"`
 }
 
 func main() {
@@ -149,8 +159,12 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 
 	for i, dbNode := range allDBs {
 		bootLog.Info("syncing outbox schema and starting processor for shard", "shard_index", i)
-		if err := dbNode.AutoMigrate(&outbox.OutboxMessage{}); err != nil {
-			return nil, nil, fmt.Errorf("failed to migrate outbox table on shard %d: %w", i, err)
+		if err := dbNode.AutoMigrate(&outbox.OutboxMessage{}, &domain.ConsumedEvent{}); err != nil {
+			return nil, nil, fmt.Errorf("failed to migrate outbox and inbox tables on shard %d: %w", i, err)
+		}
+		// 订单、订单行计价明细与分仓预占记录
+		if err := dbNode.AutoMigrate(&domain.Order{}, &domain.OrderItem{}, &domain.OrderAllocation{}, &domain.OrderLog{}); err != nil {
+			return nil, nil, fmt.Errorf("failed to migrate order tables on shard %d: %w", i, err)
 		}
 		shardMgr := outbox.NewManager(dbNode, logger.Logger)
 		proc := outbox.NewProcessor(shardMgr, func(ctx context.Context, topic, key string, payload []byte) error {
@@ -173,7 +187,9 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	clients := &ServiceClients{}
 	clientCleanup, err := grpcclient.InitClients(c.Services, m, c.CircuitBreaker, clients)
 	if err != nil {
-		for _, p := range outboxProcessors { p.Stop() }
+		for _, p := range outboxProcessors {
+			p.Stop()
+		}
 		producer.Close()
 		redisCache.Close()
 		shardingManager.Close()
@@ -189,15 +205,19 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	// 6.2 Application (Service)
 	warehouseAddr := c.Services["warehouse"].GRPCAddr
 	dtmAddr := c.Services["dtm"].GRPCAddr
-	if dtmAddr == "" { dtmAddr = "dtm:36789" }
+	if dtmAddr == "" {
+		dtmAddr = "dtm:36789"
+	}
 	orderSvcAddr := c.Services["order"].GRPCAddr
-	if orderSvcAddr == "" { orderSvcAddr = "order:50051" }
+	if orderSvcAddr == "" {
+		orderSvcAddr = "order:50051"
+	}
 
 	orderManager := application.NewOrderManager(
 		orderRepo,
 		idGenerator,
 		producer,
-		defaultOutboxMgr, 
+		defaultOutboxMgr,
 		logger.Logger,
 		dtmAddr,
 		warehouseAddr,
@@ -205,6 +225,22 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 		riskEvaluator,
 	)
 	orderManager.SetSvcURL(orderSvcAddr)
+	// 优惠券服务地址来自服务发现配置，未配置时带券下单将被拒绝
+	orderManager.SetCouponSvcAddr(c.Services["advancedcoupon"].GRPCAddr)
+
+	// 6.2.1 持久化超时调度器 (替代进程内时间轮，多副本通过租约互斥触发)
+	// 任务与订单在同一分片的同一事务内写入，因此每个分片各有一张任务表，由调度器依次扫描。
+	for i, dbNode := range allDBs {
+		if err := dbNode.AutoMigrate(&orderscheduler.TimeoutTask{}); err != nil {
+			return nil, nil, fmt.Errorf("failed to migrate order timeout task table on shard %d: %w", i, err)
+		}
+	}
+	timeoutScheduler, err := orderscheduler.NewPersistentScheduler(allDBs, time.Second, orderManager.HandlePaymentTimeout, logger.Logger, m)
+	if err != nil {
+		return nil, nil, fmt.Errorf("timeout scheduler init error: %w", err)
+	}
+	timeoutScheduler.Start()
+	orderManager.SetTimeoutScheduler(timeoutScheduler)
 
 	// 注入 gRPC 客户端 (Internal Service Interaction)
 	if clients.Inventory != nil && clients.Payment != nil {
@@ -213,6 +249,30 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 			paymentv1.NewPaymentServiceClient(clients.Payment),
 		)
 	}
+	// 服务端计价：商品服务必需，营销、会员、优惠券服务缺失时降级为无对应优惠
+	if clients.Product != nil {
+		var (
+			marketingCli marketingv1.MarketingServiceClient
+			userTierCli  usertierv1.UserTierServiceClient
+			couponCli    advancedcouponv1.AdvancedCouponServiceClient
+		)
+		if clients.Marketing != nil {
+			marketingCli = marketingv1.NewMarketingServiceClient(clients.Marketing)
+		}
+		if clients.UserTier != nil {
+			userTierCli = usertierv1.NewUserTierServiceClient(clients.UserTier)
+		}
+		if clients.AdvancedCoupon != nil {
+			couponCli = advancedcouponv1.NewAdvancedCouponServiceClient(clients.AdvancedCoupon)
+		}
+		orderManager.SetPricingGateway(pricing.NewGateway(
+			productv1.NewProductServiceClient(clients.Product),
+			marketingCli,
+			userTierCli,
+			couponCli,
+			logger.Logger,
+		))
+	}
 	orderQuery := application.NewOrderQuery(orderRepo)
 	orderService := application.NewOrderService(orderManager, orderQuery, logger.Logger)
 
@@ -225,18 +285,46 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	flashsaleConsumer := kafka.NewConsumer(flashsaleConsumerCfg, logger, m)
 	flashsaleConsumer.Start(context.Background(), 5, flashsaleHandler.HandleFlashsaleOrder)
 
+	// 支付结果事件：失败消息本地重试后转入 <topic>.dlq，经管理接口重放
+	bootLog.Info("initializing kafka consumers for payment events...")
+	deadLetters := event.NewDeadLetterQueue(producer, c.MessageQueue.Kafka.Brokers, BootstrapName+"-dlq-replay-group", logger.Logger)
+	paymentHandler := event.NewPaymentHandler(orderManager, logger.Logger)
+	paymentConsumers := make([]*kafka.Consumer, 0, len(event.PaymentTopics))
+	for _, topic := range event.PaymentTopics {
+		paymentConsumerCfg := c.MessageQueue.Kafka
+		paymentConsumerCfg.Topic = topic
+		paymentConsumerCfg.GroupID = BootstrapName + "-payment-group"
+		paymentConsumer := kafka.NewConsumer(paymentConsumerCfg, logger, m)
+		paymentConsumer.Start(context.Background(), 3, deadLetters.Wrap(topic, paymentHandler.Handle))
+		paymentConsumers = append(paymentConsumers, paymentConsumer)
+	}
+
 	// 6.4 Interface (HTTP Handlers)
-	handler := orderhttp.NewHandler(orderService, logger.Logger)
+	handler := orderhttp.NewHandler(orderService, deadLetters, logger.Logger)
 
 	// 定义资源清理函数
 	cleanup := func() {
 		bootLog.Info("shutting down, releasing resources...")
-		if flashsaleConsumer != nil { flashsaleConsumer.Close() }
-		for _, p := range outboxProcessors { p.Stop() }
+		if flashsaleConsumer != nil {
+			flashsaleConsumer.Close()
+		}
+		for _, pc := range paymentConsumers {
+			pc.Close()
+		}
+		timeoutScheduler.Stop()
+		for _, p := range outboxProcessors {
+			p.Stop()
+		}
 		clientCleanup()
-		if producer != nil { producer.Close() }
-		if redisCache != nil { redisCache.Close() }
-		if shardingManager != nil { shardingManager.Close() }
+		if producer != nil {
+			producer.Close()
+		}
+		if redisCache != nil {
+			redisCache.Close()
+		}
+		if shardingManager != nil {
+			shardingManager.Close()
+		}
 	}
 
 	// 返回应用上下文与清理函数
@@ -249,4 +337,4 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 		Limiter:     rateLimiter,
 		Idempotency: idempotency.Manager(idemManager),
 	}, cleanup, nil
-}
\ No newline at end of file
+}
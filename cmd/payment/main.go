@@ -13,12 +13,15 @@ import (
 
 	pb "github.com/wyfcoding/ecommerce/goapi/payment/v1"
 	risksecurityv1 "github.com/wyfcoding/ecommerce/goapi/risksecurity/v1"
+	schedulerv1 "github.com/wyfcoding/ecommerce/goapi/scheduler/v1"
 	settlementv1 "github.com/wyfcoding/ecommerce/goapi/settlement/v1"
 	"github.com/wyfcoding/ecommerce/internal/payment/application"
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
 	"github.com/wyfcoding/ecommerce/internal/payment/infrastructure/gateway"
 	"github.com/wyfcoding/ecommerce/internal/payment/infrastructure/persistence"
 	"github.com/wyfcoding/ecommerce/internal/payment/infrastructure/risk"
+	"github.com/wyfcoding/ecommerce/internal/payment/infrastructure/routing"
+	paymentevent "github.com/wyfcoding/ecommerce/internal/payment/interfaces/event"
 	grpcServer "github.com/wyfcoding/ecommerce/internal/payment/interfaces/grpc"
 	paymenthttp "github.com/wyfcoding/ecommerce/internal/payment/interfaces/http"
 	"github.com/wyfcoding/pkg/app"
@@ -46,6 +49,12 @@ const IdempotencyPrefix = "payment:idem"
 // Config 服务扩展配置
 type Config struct {
 	configpkg.Config `mapstructure:",squash"`
+	Gateways         gateway.Config                   `mapstructure:"gateways"`       // 支付渠道商户与验签配置
+	FX               application.FXConfig             `mapstructure:"fx"`             // 多币种结算币种与牌价有效期
+	Split            application.SplitConfig          `mapstructure:"split"`          // 组合支付退款分摊顺序
+	ProfitSharing    application.ProfitSharingConfig  `mapstructure:"profit_sharing"` // 分账费率
+	Routing          application.RoutingConfig        `mapstructure:"routing"`        // 渠道路由、健康度窗口与熔断
+	Reconciliation   application.ReconciliationConfig `mapstructure:"reconciliation"` // 每日对账账单时区
 }
 
 // AppContext 应用上下文 (包含对外服务实例与依赖)
@@ -91,6 +100,8 @@ func main() {
 func registerGRPC(s *grpc.Server, svc any) {
 	ctx := svc.(*AppContext)
 	pb.RegisterPaymentServiceServer(s, grpcServer.NewServer(ctx.Payment))
+	// 每日对账由调度中心按 cron 触发
+	schedulerv1.RegisterJobExecutorServiceServer(s, grpcServer.NewJobExecutor(ctx.Payment, ctx.Idempotency))
 }
 
 // registerGin 注册 HTTP 路由
@@ -125,6 +136,9 @@ func registerGin(e *gin.Engine, svc any) {
 	// 全局限流中间件
 	e.Use(middleware.RateLimitWithLimiter(ctx.Limiter))
 
+	// 支付渠道异步通知：由渠道直接回调，依赖签名校验而非 JWT
+	ctx.Handler.RegisterNotifyRoutes(e.Group("/api/v1"))
+
 	// 业务 API 路由 v1
 	api := e.Group("/api/v1")
 	{
@@ -186,15 +200,20 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	// 4. 初始化消息队列与 Outbox (架构增强)
 	bootLog.Info("initializing kafka producer and outbox...")
 	producer := kafka.NewProducer(c.MessageQueue.Kafka, logger, m)
-	masterDB := shardingManager.GetDB(0)
-	if err := masterDB.AutoMigrate(&outbox.OutboxMessage{}); err != nil {
-		return nil, nil, fmt.Errorf("failed to migrate outbox table: %w", err)
+	// 支付事件随支付单写入用户所在分片的 Outbox 表，每个分片各自启动投递处理器
+	outboxMgr := outbox.NewManager(shardingManager.GetDB(0), logger.Logger)
+	allDBs := shardingManager.GetAllDBs()
+	outboxProcs := make([]*outbox.Processor, 0, len(allDBs))
+	for i, dbNode := range allDBs {
+		if err := dbNode.AutoMigrate(&outbox.OutboxMessage{}); err != nil {
+			return nil, nil, fmt.Errorf("failed to migrate outbox table on shard %d: %w", i, err)
+		}
+		proc := outbox.NewProcessor(outbox.NewManager(dbNode, logger.Logger), func(ctx context.Context, topic, key string, payload []byte) error {
+			return producer.PublishToTopic(ctx, topic, []byte(key), payload)
+		}, 100, 5*time.Second)
+		proc.Start()
+		outboxProcs = append(outboxProcs, proc)
 	}
-	outboxMgr := outbox.NewManager(masterDB, logger.Logger)
-	outboxProc := outbox.NewProcessor(outboxMgr, func(ctx context.Context, topic, key string, payload []byte) error {
-		return producer.PublishToTopic(ctx, topic, []byte(key), payload)
-	}, 100, 5*time.Second)
-	outboxProc.Start()
 
 	// 5. 初始化下游微服务客户端
 	clients := &ServiceClients{}
@@ -223,35 +242,102 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	paymentRepo := persistence.NewPaymentRepository(shardingManager)
 	channelRepo := persistence.NewChannelRepository(shardingManager)
 	refundRepo := persistence.NewRefundRepository(shardingManager)
+	// 对账批次与差异为全局数据，存储在第一个分片
+	if err := shardingManager.GetDB(0).AutoMigrate(&domain.ReconciliationRun{}, &domain.ReconciliationRecord{}, &domain.ReconciliationNote{}); err != nil {
+		return nil, nil, fmt.Errorf("failed to migrate reconciliation tables: %w", err)
+	}
+	reconRepo := persistence.NewReconciliationRepository(shardingManager)
+	// 牌价由财务维护，同样为全局数据
+	if err := shardingManager.GetDB(0).AutoMigrate(&domain.FXRate{}); err != nil {
+		return nil, nil, fmt.Errorf("failed to migrate fx rate table: %w", err)
+	}
+	fxRepo := persistence.NewFXRateRepository(shardingManager)
+	// 支付腿、退款分摊与储值账户随用户分片，与支付单同库
+	for i, dbNode := range allDBs {
+		if err := dbNode.AutoMigrate(&domain.PaymentLeg{}, &domain.RefundAllocation{}, &domain.StoredValueAccount{}, &domain.StoredValueEntry{}); err != nil {
+			return nil, nil, fmt.Errorf("failed to migrate composite payment tables on shard %d: %w", i, err)
+		}
+	}
+	storedValueRepo := persistence.NewStoredValueRepository(shardingManager)
+	// 分账与分账回退随支付单按用户分片
+	for i, dbNode := range allDBs {
+		if err := dbNode.AutoMigrate(&domain.PaymentSplit{}, &domain.SplitReversal{}); err != nil {
+			return nil, nil, fmt.Errorf("failed to migrate profit sharing tables on shard %d: %w", i, err)
+		}
+	}
+	profitSharingRepo := persistence.NewProfitSharingRepository(shardingManager)
+	// 路由规则与决策日志为全局数据，渠道健康度与熔断器状态存储在 Redis，多副本共享
+	if err := shardingManager.GetDB(0).AutoMigrate(&domain.RoutingPolicy{}, &domain.RouteDecision{}); err != nil {
+		return nil, nil, fmt.Errorf("failed to migrate routing tables: %w", err)
+	}
+	routingRepo := persistence.NewRoutingRepository(shardingManager)
+	healthStore := routing.NewRedisHealthStore(redisCache.GetClient(), c.Routing.Window, c.Routing.Bucket)
 
 	riskSvc := risk.NewRiskService(clients.RiskSecurity)
 
-	gateways := map[domain.GatewayType]domain.PaymentGateway{
-		domain.GatewayTypeAlipay: gateway.NewAlipayGateway(),
-		domain.GatewayTypeStripe: gateway.NewStripeGateway(),
-		domain.GatewayTypeWechat: gateway.NewWechatGateway(),
-		domain.GatewayTypeMock:   gateway.NewMockGateway(),
+	// 真实渠道凭据来自 ChannelConfig.ConfigJSON，按渠道构建；路由降级时使用 mock 网关
+	gateways := gateway.NewRegistry(channelRepo, gateway.NewHTTPClient(), map[domain.GatewayType]domain.PaymentGateway{
+		domain.GatewayTypeMock: gateway.NewMockGateway(),
+	}, logger.Logger)
+
+	verifiers, err := gateway.NewNotificationVerifiers(c.Gateways)
+	if err != nil {
+		return nil, nil, fmt.Errorf("payment notification verifier init error: %w", err)
+	}
+	for _, v := range verifiers {
+		bootLog.Info("payment notification verifier enabled", "gateway", v.Gateway())
 	}
 
 	// 5.2 Application (Components)
+	// 外币支付发起时锁定汇率快照，入账时按当时牌价折算并计算汇兑损益
+	fxService := application.NewFXService(fxRepo, c.FX, logger.Logger)
+	// 组合支付的积分、礼品卡、券包余额腿在储值账本中冻结与扣减
+	ledger := application.NewStoredValueLedger(storedValueRepo, logger.Logger)
+	// 多商户订单扣款时生成分账指令，渠道分账与分账回退由后台任务执行
+	splitPolicy, err := c.ProfitSharing.Policy()
+	if err != nil {
+		return nil, nil, err
+	}
+	profitSharing := application.NewProfitSharingService(profitSharingRepo, paymentRepo, gateways, splitPolicy, idGenerator, outboxMgr, logger.Logger)
+	profitSharing.Start()
+	// 按商户、支付方式与金额区间匹配路由策略，熔断中的渠道不参与路由
+	routingEngine := application.NewRoutingEngine(channelRepo, routingRepo, healthStore, c.Routing, logger.Logger)
 	processor := application.NewPaymentProcessor(
 		paymentRepo,
 		channelRepo,
+		routingEngine,
+		fxService,
+		ledger,
+		profitSharing,
 		riskSvc,
 		idGenerator,
 		gateways,
 		outboxMgr,
 		logger.Logger,
 	)
-	callbackHandler := application.NewCallbackHandler(paymentRepo, gateways, redisLock, outboxMgr, logger.Logger)
-	refundService := application.NewRefundService(paymentRepo, refundRepo, idGenerator, gateways, logger.Logger)
+	callbackHandler := application.NewCallbackHandler(paymentRepo, fxService, ledger, profitSharing, gateways, verifiers, redisLock, outboxMgr, logger.Logger)
+	// 主动查询渠道订单状态，补偿丢失的异步通知并关闭超时交易
+	statusPoller := application.NewPaymentStatusPoller(paymentRepo, fxService, ledger, profitSharing, gateways, redisLock, outboxMgr, logger.Logger)
+	statusPoller.Start()
+	refundService := application.NewRefundService(paymentRepo, refundRepo, ledger, profitSharing, c.Split, idGenerator, gateways, outboxMgr, logger.Logger)
 	paymentQuery := application.NewPaymentQuery(paymentRepo)
+	// 每日对账：拉取渠道对账单核对支付与退款，已知差异自动处理，其余进入差异处理队列；由调度中心的作业触发
+	reconLocation, err := c.Reconciliation.Location()
+	if err != nil {
+		return nil, nil, err
+	}
+	reconciliationService := application.NewReconciliationService(paymentRepo, refundRepo, reconRepo, gateways, refundService, fxService, ledger, profitSharing, idGenerator, redisLock, outboxMgr, reconLocation, logger.Logger)
 
 	paymentService := application.NewPaymentService(
 		processor,
 		callbackHandler,
 		refundService,
 		paymentQuery,
+		reconciliationService,
+		fxService,
+		ledger,
+		profitSharing,
+		routingEngine,
 		clients.Settlement,
 		logger.Logger,
 	)
@@ -259,10 +345,23 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	// 5.3 Interface (HTTP Handlers)
 	handler := paymenthttp.NewHandler(paymentService, logger.Logger)
 
+	// 5.4 Event Handlers (Kafka Consumer)：订单关闭后到达的支付成功由订单服务发布退款补偿事件
+	bootLog.Info("initializing kafka consumer for order refund events...")
+	refundConsumerCfg := c.MessageQueue.Kafka
+	refundConsumerCfg.Topic = paymentevent.TopicOrderRefundRequired
+	refundConsumerCfg.GroupID = BootstrapName + "-refund-group"
+	refundConsumer := kafka.NewConsumer(refundConsumerCfg, logger, m)
+	refundConsumer.Start(context.Background(), 3, paymentevent.NewOrderHandler(paymentService, logger.Logger).Handle)
+
 	// 定义资源清理函数
 	cleanup := func() {
 		bootLog.Info("shutting down, releasing resources...")
-		outboxProc.Stop()
+		refundConsumer.Close()
+		statusPoller.Stop()
+		profitSharing.Stop()
+		for _, proc := range outboxProcs {
+			proc.Stop()
+		}
 		if producer != nil {
 			producer.Close()
 		}
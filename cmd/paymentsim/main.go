@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/application"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/domain"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/infrastructure/notify"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/infrastructure/signer"
+	simhttp "github.com/wyfcoding/ecommerce/internal/paymentsim/interfaces/http"
+	"github.com/wyfcoding/pkg/app"
+	configpkg "github.com/wyfcoding/pkg/config"
+	"github.com/wyfcoding/pkg/logging"
+	"github.com/wyfcoding/pkg/metrics"
+)
+
+// BootstrapName 服务唯一标识
+const BootstrapName = "paymentsim"
+
+// Config 服务扩展配置
+type Config struct {
+	configpkg.Config `mapstructure:",squash"`
+	Simulator        SimulatorConfig `mapstructure:"simulator"`
+}
+
+// SimulatorConfig 渠道模拟器配置，密钥留空时启动时临时生成，可通过 /sim/credentials 导出。
+type SimulatorConfig struct {
+	PublicURL string              `mapstructure:"public_url"` // 支付服务访问模拟器的地址
+	Alipay    signer.AlipayConfig `mapstructure:"alipay"`
+	Wechat    signer.WechatConfig `mapstructure:"wechat"`
+	Stripe    signer.StripeConfig `mapstructure:"stripe"`
+	Scenario  domain.Scenario     `mapstructure:"scenario"` // 默认场景
+}
+
+// AppContext 应用上下文
+type AppContext struct {
+	Config  *Config
+	Handler *simhttp.Handler
+}
+
+func main() {
+	if err := app.NewBuilder(BootstrapName).
+		WithConfig(&Config{}).
+		WithService(initService).
+		WithGin(registerGin).
+		Build().
+		Run(); err != nil {
+		slog.Error("service bootstrap failed", "error", err)
+	}
+}
+
+// registerGin 注册 HTTP 路由
+func registerGin(e *gin.Engine, svc any) {
+	ctx := svc.(*AppContext)
+	ctx.Handler.RegisterRoutes(e)
+}
+
+// initService 初始化渠道签名器、模拟器与回调投递器
+func initService(cfg any, _ *metrics.Metrics) (any, func(), error) {
+	c := cfg.(*Config)
+	logger := logging.Default()
+
+	alipay, err := signer.NewAlipay(c.Simulator.Alipay)
+	if err != nil {
+		return nil, nil, fmt.Errorf("alipay signer init error: %w", err)
+	}
+	wechat, err := signer.NewWechat(c.Simulator.Wechat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wechat signer init error: %w", err)
+	}
+	stripe := signer.NewStripe(c.Simulator.Stripe)
+
+	sim := application.NewSimulator(c.Simulator.Scenario, logger.Logger)
+	client := &http.Client{}
+	sim.RegisterNotifier(notify.NewAlipayNotifier(alipay, client))
+	sim.RegisterNotifier(notify.NewWechatNotifier(wechat, client))
+	sim.RegisterNotifier(notify.NewStripeNotifier(stripe, client))
+
+	handler := simhttp.NewHandler(sim, alipay, wechat, stripe, c.Simulator.PublicURL, logger.Logger)
+	slog.Info("payment gateway simulator ready", "public_url", c.Simulator.PublicURL, "credentials", c.Simulator.PublicURL+"/sim/credentials")
+
+	return &AppContext{Config: c, Handler: handler}, sim.Close, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"time"
@@ -12,7 +13,11 @@ import (
 
 	pb "github.com/wyfcoding/ecommerce/goapi/scheduler/v1"
 	"github.com/wyfcoding/ecommerce/internal/scheduler/application"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/infrastructure/election"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/infrastructure/invoker"
 	"github.com/wyfcoding/ecommerce/internal/scheduler/infrastructure/persistence"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/interfaces/event"
 	schedulergrpc "github.com/wyfcoding/ecommerce/internal/scheduler/interfaces/grpc"
 	schedulerhttp "github.com/wyfcoding/ecommerce/internal/scheduler/interfaces/http"
 	"github.com/wyfcoding/pkg/app"
@@ -23,6 +28,7 @@ import (
 	"github.com/wyfcoding/pkg/idempotency"
 	"github.com/wyfcoding/pkg/limiter"
 	"github.com/wyfcoding/pkg/logging"
+	"github.com/wyfcoding/pkg/messagequeue/kafka"
 	"github.com/wyfcoding/pkg/metrics"
 	"github.com/wyfcoding/pkg/middleware"
 )
@@ -36,6 +42,7 @@ const IdempotencyPrefix = "scheduler:idem"
 // Config 服务扩展配置
 type Config struct {
 	configpkg.Config `mapstructure:",squash"`
+	Jobs             []application.JobSpec `mapstructure:"jobs"` // 启动时登记的远程作业 (结算、对账、预测等批处理)
 }
 
 // AppContext 应用上下文 (包含对外服务实例与依赖)
@@ -130,6 +137,13 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	if err != nil {
 		return nil, nil, fmt.Errorf("database init error: %w", err)
 	}
+	// 作业、执行日志、作业依赖与延迟任务表
+	if err := db.RawDB().AutoMigrate(&domain.Job{}, &domain.JobLog{}, &domain.JobDependency{}, &domain.DelayTask{}); err != nil {
+		if sqlDB, err := db.RawDB().DB(); err == nil {
+			sqlDB.Close()
+		}
+		return nil, nil, fmt.Errorf("failed to migrate scheduler tables: %w", err)
+	}
 
 	// 2. 初始化缓存 (Redis)
 	redisCache, err := cache.NewRedisCache(c.Data.Redis, c.CircuitBreaker, logger, m)
@@ -155,23 +169,75 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 		return nil, nil, fmt.Errorf("grpc clients init error: %w", err)
 	}
 
+	// 4.1 初始化消息队列 (Kafka Producer，用于延迟消息到期投递)
+	producer := kafka.NewProducer(c.MessageQueue.Kafka, logger, m)
+
 	// 5. DDD 分层装配
 	bootLog.Info("assembling services with full dependency injection...")
 
 	// 5.1 Infrastructure (Persistence)
 	schedulerRepo := persistence.NewSchedulerRepository(db.RawDB())
+	delayTaskRepo := persistence.NewDelayTaskRepository(db.RawDB())
 
 	// 5.2 Application (Service)
 	query := application.NewSchedulerQuery(schedulerRepo)
-	manager := application.NewSchedulerManager(schedulerRepo, logger.Logger)
-	schedulerService := application.NewSchedulerService(manager, query)
+	delayQueue := application.NewDelayQueueManager(delayTaskRepo, func(ctx context.Context, topic, key string, payload []byte) error {
+		return producer.PublishToTopic(ctx, topic, []byte(key), payload)
+	}, logger.Logger, m)
+	delayQueue.Start()
+	manager := application.NewSchedulerManager(schedulerRepo, delayQueue, logger.Logger)
+
+	// 远程处理器 (HTTP 回调 / gRPC 方法)，由调度中心统一编排其他服务的批处理作业
+	grpcInvoker := invoker.NewGRPCInvoker()
+	manager.RegisterInvoker(domain.HandlerHTTP, invoker.NewHTTPInvoker())
+	manager.RegisterInvoker(domain.HandlerGRPC, grpcInvoker)
+	if err := manager.EnsureJobs(context.Background(), c.Jobs); err != nil {
+		bootLog.Error("failed to register configured jobs", "error", err)
+	}
+
+	// Cron 触发循环 (Redis 租约选主，仅主节点触发)
+	elector := election.NewRedisElector(redisCache.GetClient(), "scheduler:cron:leader", 10*time.Second)
+	cronTrigger := application.NewCronTrigger(schedulerRepo, manager, elector, logger.Logger, m)
+	cronTrigger.Start()
+	schedulerService := application.NewSchedulerService(manager, query, delayQueue)
+
+	// 5.3 Event Handlers (Kafka Consumer，接收各服务经 Outbox 登记/取消的延迟消息)
+	delayHandler := event.NewDelayHandler(schedulerService, logger.Logger)
+	scheduleConsumerCfg := c.MessageQueue.Kafka
+	scheduleConsumerCfg.Topic = event.TopicDelaySchedule
+	scheduleConsumerCfg.GroupID = BootstrapName + "-delay-group"
+	scheduleConsumer := kafka.NewConsumer(scheduleConsumerCfg, logger, m)
+	scheduleConsumer.Start(context.Background(), 5, delayHandler.Handle)
 
-	// 5.3 Interface (HTTP Handlers)
+	cancelConsumerCfg := c.MessageQueue.Kafka
+	cancelConsumerCfg.Topic = event.TopicDelayCancel
+	cancelConsumerCfg.GroupID = BootstrapName + "-delay-group"
+	cancelConsumer := kafka.NewConsumer(cancelConsumerCfg, logger, m)
+	cancelConsumer.Start(context.Background(), 2, delayHandler.Handle)
+
+	// 延迟作业到期触发 (同一消费组内只有一个副本会执行)
+	jobTriggerHandler := event.NewJobTriggerHandler(schedulerService, logger.Logger)
+	triggerConsumerCfg := c.MessageQueue.Kafka
+	triggerConsumerCfg.Topic = application.TopicJobTrigger
+	triggerConsumerCfg.GroupID = BootstrapName + "-job-trigger-group"
+	triggerConsumer := kafka.NewConsumer(triggerConsumerCfg, logger, m)
+	triggerConsumer.Start(context.Background(), 2, jobTriggerHandler.Handle)
+
+	// 5.4 Interface (HTTP Handlers)
 	handler := schedulerhttp.NewHandler(schedulerService, logger.Logger)
 
 	// 定义资源清理函数
 	cleanup := func() {
 		bootLog.Info("shutting down, releasing resources...")
+		scheduleConsumer.Close()
+		cancelConsumer.Close()
+		triggerConsumer.Close()
+		cronTrigger.Stop()
+		delayQueue.Stop()
+		grpcInvoker.Close()
+		if err := producer.Close(); err != nil {
+			bootLog.Error("failed to close kafka producer", "error", err)
+		}
 		clientCleanup()
 		if redisCache != nil {
 			if err := redisCache.Close(); err != nil {
@@ -11,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
 
+	schedulerv1 "github.com/wyfcoding/ecommerce/goapi/scheduler/v1"
 	pb "github.com/wyfcoding/ecommerce/goapi/settlement/v1"
 	"github.com/wyfcoding/ecommerce/internal/settlement/application"
 	"github.com/wyfcoding/ecommerce/internal/settlement/domain"
@@ -81,6 +82,8 @@ func main() {
 func registerGRPC(s *grpc.Server, svc any) {
 	ctx := svc.(*AppContext)
 	pb.RegisterSettlementServiceServer(s, settlementgrpc.NewServer(ctx.Settlement))
+	// 结算周期作业由调度中心按 Cron 触发
+	schedulerv1.RegisterJobExecutorServiceServer(s, settlementgrpc.NewJobExecutor(ctx.Settlement, ctx.Idempotency))
 }
 
 // registerGin 注册 HTTP 路由
@@ -191,6 +194,19 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 	consumer := kafka.NewConsumer(consumerCfg, logger, m)
 	consumer.Start(context.Background(), 3, paymentHandler.HandlePaymentCaptured)
 
+	// 渠道分账到账与分账回退事件
+	splitExecutedCfg := c.MessageQueue.Kafka
+	splitExecutedCfg.Topic = "payment.split.executed"
+	splitExecutedCfg.GroupID = BootstrapName + "-group"
+	splitExecutedConsumer := kafka.NewConsumer(splitExecutedCfg, logger, m)
+	splitExecutedConsumer.Start(context.Background(), 1, paymentHandler.HandleSplitExecuted)
+
+	splitReversedCfg := c.MessageQueue.Kafka
+	splitReversedCfg.Topic = "payment.split.reversed"
+	splitReversedCfg.GroupID = BootstrapName + "-group"
+	splitReversedConsumer := kafka.NewConsumer(splitReversedCfg, logger, m)
+	splitReversedConsumer.Start(context.Background(), 1, paymentHandler.HandleSplitReversed)
+
 	// 5.4 Interface (HTTP Handlers)
 	handler := settlementhttp.NewHandler(settlementService, logger.Logger)
 
@@ -200,6 +216,8 @@ func initService(cfg any, m *metrics.Metrics) (any, func(), error) {
 		if consumer != nil {
 			consumer.Close()
 		}
+		splitExecutedConsumer.Close()
+		splitReversedConsumer.Close()
 		clientCleanup()
 		if redisCache != nil {
 			if err := redisCache.Close(); err != nil {
@@ -38,6 +38,10 @@ func (s *AdvancedCouponService) GetCoupon(ctx context.Context, id uint64) (*doma
 	return s.query.GetCoupon(ctx, id)
 }
 
+func (s *AdvancedCouponService) GetCouponByCode(ctx context.Context, code string) (*domain.Coupon, error) {
+	return s.query.GetCouponByCode(ctx, code)
+}
+
 func (s *AdvancedCouponService) ListCoupons(ctx context.Context, status domain.CouponStatus, page, pageSize int) ([]*domain.Coupon, int64, error) {
 	return s.query.ListCoupons(ctx, status, page, pageSize)
 }
@@ -27,6 +27,11 @@ func (q *AdvancedCouponQuery) GetCoupon(ctx context.Context, id uint64) (*domain
 	return q.repo.GetByID(ctx, id)
 }
 
+// GetCouponByCode 根据业务码获取优惠券详情。
+func (q *AdvancedCouponQuery) GetCouponByCode(ctx context.Context, code string) (*domain.Coupon, error) {
+	return q.repo.GetByCode(ctx, code)
+}
+
 // ListCoupons 根据状态分页列出优惠券模板。
 func (q *AdvancedCouponQuery) ListCoupons(ctx context.Context, status domain.CouponStatus, page, pageSize int) ([]*domain.Coupon, int64, error) {
 	offset := (page - 1) * pageSize
@@ -39,10 +39,21 @@ func (s *Server) CreateCoupon(ctx context.Context, req *pb.CreateCouponRequest)
 }
 
 func (s *Server) GetCoupon(ctx context.Context, req *pb.GetCouponRequest) (*pb.GetCouponResponse, error) {
-	coupon, err := s.service.GetCoupon(ctx, req.Id)
+	var (
+		coupon *domain.Coupon
+		err    error
+	)
+	if req.Code != "" {
+		coupon, err = s.service.GetCouponByCode(ctx, req.Code)
+	} else {
+		coupon, err = s.service.GetCoupon(ctx, req.Id)
+	}
 	if err != nil {
 		return nil, status.Error(codes.NotFound, err.Error())
 	}
+	if coupon == nil {
+		return nil, status.Error(codes.NotFound, "coupon not found")
+	}
 	return &pb.GetCouponResponse{
 		Coupon: convertCouponToProto(coupon),
 	}, nil
@@ -4,8 +4,12 @@ import (
 	"context"
 	"log/slog"
 
+	inventoryv1 "github.com/wyfcoding/ecommerce/goapi/inventory/v1"
+	logisticsv1 "github.com/wyfcoding/ecommerce/goapi/logistics/v1"
 	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
 	paymentv1 "github.com/wyfcoding/ecommerce/goapi/payment/v1"
+	productv1 "github.com/wyfcoding/ecommerce/goapi/product/v1"
+	usertierv1 "github.com/wyfcoding/ecommerce/goapi/usertier/v1"
 	"github.com/wyfcoding/ecommerce/internal/aftersales/domain"
 	"github.com/wyfcoding/pkg/idgen"
 )
@@ -23,14 +27,22 @@ func NewAfterSalesService(
 	logger *slog.Logger,
 	orderClient orderv1.OrderServiceClient,
 	paymentClient paymentv1.PaymentServiceClient,
+	logisticsClient logisticsv1.LogisticsServiceClient,
+	inventoryClient inventoryv1.InventoryServiceClient,
+	returns ReturnsConfig,
 	dtmServer, orderSvcURL, paymentSvcURL, aftersalesURL string,
 ) *AfterSalesService {
 	return &AfterSalesService{
-		manager: NewAfterSalesManager(repo, idGenerator, logger, orderClient, paymentClient, dtmServer, orderSvcURL, paymentSvcURL, aftersalesURL),
+		manager: NewAfterSalesManager(repo, idGenerator, logger, orderClient, paymentClient, logisticsClient, inventoryClient, returns, dtmServer, orderSvcURL, paymentSvcURL, aftersalesURL),
 		query:   NewAfterSalesQuery(repo),
 	}
 }
 
+// SetSLAClients 注入售后策略所需的商品服务 (解析类目) 与会员等级服务 (判定可信用户) 客户端。
+func (s *AfterSalesService) SetSLAClients(productCli productv1.ProductServiceClient, userTierCli usertierv1.UserTierServiceClient) {
+	s.manager.SetSLAClients(productCli, userTierCli)
+}
+
 // --- Manager (Writes) ---
 
 func (s *AfterSalesService) SagaMarkRefundCompleted(ctx context.Context, id uint64) error {
@@ -41,10 +53,10 @@ func (s *AfterSalesService) SagaMarkRefundFailed(ctx context.Context, id uint64,
 	return s.manager.SagaMarkRefundFailed(ctx, id, reason)
 }
 
-func (s *AfterSalesService) CreateAfterSales(ctx context.Context, orderID uint64, orderNo string, userID uint64,
+func (s *AfterSalesService) CreateAfterSales(ctx context.Context, orderID uint64, orderNo string, userID, merchantID uint64,
 	asType domain.AfterSalesType, reason, description string, images []string, items []*domain.AfterSalesItem,
 ) (*domain.AfterSales, error) {
-	return s.manager.CreateAfterSales(ctx, orderID, orderNo, userID, asType, reason, description, images, items)
+	return s.manager.CreateAfterSales(ctx, orderID, orderNo, userID, merchantID, asType, reason, description, images, items)
 }
 
 func (s *AfterSalesService) Approve(ctx context.Context, id uint64, operator string, amount int64) error {
@@ -63,6 +75,30 @@ func (s *AfterSalesService) ProcessExchange(ctx context.Context, id uint64) erro
 	return s.manager.ProcessExchange(ctx, id)
 }
 
+func (s *AfterSalesService) IssueReturnLabel(ctx context.Context, id uint64, operator string) (*domain.AfterSales, error) {
+	return s.manager.IssueReturnLabel(ctx, id, operator)
+}
+
+func (s *AfterSalesService) InspectReturn(ctx context.Context, id uint64, operator string, inspections []domain.ItemInspection) (*domain.AfterSales, error) {
+	return s.manager.InspectReturn(ctx, id, operator, inspections)
+}
+
+func (s *AfterSalesService) Dispute(ctx context.Context, id, userID uint64, reason string) (*domain.AfterSales, error) {
+	return s.manager.Dispute(ctx, id, userID, reason)
+}
+
+func (s *AfterSalesService) Arbitrate(ctx context.Context, id uint64, arbitrator string, approve bool, amount int64, remark string) (*domain.AfterSales, error) {
+	return s.manager.Arbitrate(ctx, id, arbitrator, approve, amount, remark)
+}
+
+func (s *AfterSalesService) FireDeadline(ctx context.Context, deadline *domain.AfterSalesDeadline) error {
+	return s.manager.FireDeadline(ctx, deadline)
+}
+
+func (s *AfterSalesService) SavePolicy(ctx context.Context, policy *domain.AfterSalesPolicy) error {
+	return s.manager.SavePolicy(ctx, policy)
+}
+
 func (s *AfterSalesService) CreateSupportTicket(ctx context.Context, userID, orderID uint64, subject, description, category string, priority int8) (*domain.SupportTicket, error) {
 	return s.manager.CreateSupportTicket(ctx, userID, orderID, subject, description, category, priority)
 }
@@ -101,6 +137,14 @@ func (s *AfterSalesService) ListSupportTicketMessages(ctx context.Context, ticke
 	return s.query.ListSupportTicketMessages(ctx, ticketID)
 }
 
+func (s *AfterSalesService) ListPolicies(ctx context.Context) ([]*domain.AfterSalesPolicy, error) {
+	return s.query.ListPolicies(ctx)
+}
+
+func (s *AfterSalesService) ListDeadlines(ctx context.Context, afterSalesID uint64) ([]*domain.AfterSalesDeadline, error) {
+	return s.query.ListDeadlines(ctx, afterSalesID)
+}
+
 func (s *AfterSalesService) GetConfig(ctx context.Context, key string) (*domain.AfterSalesConfig, error) {
 	return s.query.GetConfig(ctx, key)
 }
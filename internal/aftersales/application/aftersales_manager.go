@@ -7,8 +7,12 @@ import (
 	"time"
 
 	aftersalesv1 "github.com/wyfcoding/ecommerce/goapi/aftersales/v1"
+	inventoryv1 "github.com/wyfcoding/ecommerce/goapi/inventory/v1"
+	logisticsv1 "github.com/wyfcoding/ecommerce/goapi/logistics/v1"
 	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
 	paymentv1 "github.com/wyfcoding/ecommerce/goapi/payment/v1"
+	productv1 "github.com/wyfcoding/ecommerce/goapi/product/v1"
+	usertierv1 "github.com/wyfcoding/ecommerce/goapi/usertier/v1"
 	"github.com/wyfcoding/ecommerce/internal/aftersales/domain"
 	"github.com/wyfcoding/pkg/dtm"
 	"github.com/wyfcoding/pkg/idgen"
@@ -21,10 +25,18 @@ type AfterSalesManager struct {
 	logger        *slog.Logger
 	orderClient   orderv1.OrderServiceClient
 	paymentClient paymentv1.PaymentServiceClient
-	dtmServer     string
-	orderSvcURL   string
-	paymentSvcURL string
-	aftersalesURL string // 本服务回调地址
+	// 逆向物流与退货入库
+	logisticsClient logisticsv1.LogisticsServiceClient
+	inventoryClient inventoryv1.InventoryServiceClient
+	returns         ReturnsConfig
+	dtmServer       string
+	orderSvcURL     string
+	paymentSvcURL   string
+	aftersalesURL   string // 本服务回调地址
+
+	// 售后策略：类目解析与可信用户判定，未注入时不按类目匹配、不即时自动批准
+	productClient  productv1.ProductServiceClient
+	userTierClient usertierv1.UserTierServiceClient
 }
 
 // NewAfterSalesManager 构造函数。
@@ -34,22 +46,28 @@ func NewAfterSalesManager(
 	logger *slog.Logger,
 	orderClient orderv1.OrderServiceClient,
 	paymentClient paymentv1.PaymentServiceClient,
+	logisticsClient logisticsv1.LogisticsServiceClient,
+	inventoryClient inventoryv1.InventoryServiceClient,
+	returns ReturnsConfig,
 	dtmServer, orderSvcURL, paymentSvcURL, aftersalesURL string,
 ) *AfterSalesManager {
 	return &AfterSalesManager{
-		repo:          repo,
-		idGenerator:   idGenerator,
-		logger:        logger,
-		orderClient:   orderClient,
-		paymentClient: paymentClient,
-		dtmServer:     dtmServer,
-		orderSvcURL:   orderSvcURL,
-		paymentSvcURL: paymentSvcURL,
-		aftersalesURL: aftersalesURL,
+		repo:            repo,
+		idGenerator:     idGenerator,
+		logger:          logger,
+		orderClient:     orderClient,
+		paymentClient:   paymentClient,
+		logisticsClient: logisticsClient,
+		inventoryClient: inventoryClient,
+		returns:         returns,
+		dtmServer:       dtmServer,
+		orderSvcURL:     orderSvcURL,
+		paymentSvcURL:   paymentSvcURL,
+		aftersalesURL:   aftersalesURL,
 	}
 }
 
-func (m *AfterSalesManager) CreateAfterSales(ctx context.Context, orderID uint64, orderNo string, userID uint64,
+func (m *AfterSalesManager) CreateAfterSales(ctx context.Context, orderID uint64, orderNo string, userID, merchantID uint64,
 	asType domain.AfterSalesType, reason, description string, images []string, items []*domain.AfterSalesItem,
 ) (*domain.AfterSales, error) {
 	no := fmt.Sprintf("AS%d", m.idGenerator.Generate())
@@ -60,6 +78,25 @@ func (m *AfterSalesManager) CreateAfterSales(ctx context.Context, orderID uint64
 		afterSales.Items = append(afterSales.Items, item)
 	}
 
+	// 退货/换货/退款按原订单行校验数量，并按行实付金额折算退款
+	if itemized(afterSales) {
+		order, lines, err := m.fetchOrder(ctx, orderID, userID)
+		if err != nil {
+			return nil, err
+		}
+		afterSales.OrderNo = order.OrderNo
+		if err := afterSales.ResolveItems(lines); err != nil {
+			return nil, err
+		}
+		if _, err := m.allocate(ctx, afterSales, lines); err != nil {
+			return nil, err
+		}
+	}
+
+	// 售后策略按商家、类目匹配
+	afterSales.MerchantID = merchantID
+	afterSales.CategoryID = m.resolveCategory(ctx, afterSales)
+
 	if err := m.repo.Create(ctx, afterSales); err != nil {
 		m.logger.ErrorContext(ctx, "failed to create after-sales", "order_id", orderID, "user_id", userID, "error", err)
 		return nil, err
@@ -68,6 +105,9 @@ func (m *AfterSalesManager) CreateAfterSales(ctx context.Context, orderID uint64
 
 	m.LogOperation(ctx, uint64(afterSales.ID), "User", "Create", "", domain.AfterSalesStatusPending.String(), "Created after-sales request")
 
+	// 按商家/类目策略自动审核或启动商家响应计时
+	m.applyPolicy(ctx, afterSales)
+
 	return afterSales, nil
 }
 
@@ -81,14 +121,54 @@ func (m *AfterSalesManager) Approve(ctx context.Context, id uint64, operator str
 		return fmt.Errorf("invalid status: %v", afterSales.Status)
 	}
 
+	if err := m.approve(ctx, afterSales, operator, amount, "Approve"); err != nil {
+		return err
+	}
+	m.stopDeadlines(ctx, id, domain.DeadlineSellerResponse, "approved by "+operator)
+	return nil
+}
+
+// approve 批准售后单并落库，供人工审核、策略自动批准与平台仲裁共用，调用方负责校验当前状态。
+func (m *AfterSalesManager) approve(ctx context.Context, afterSales *domain.AfterSales, operator string, amount int64, action string) error {
+	id := uint64(afterSales.ID)
+
+	// 审核时重新折算：申请后同一订单可能有其他售后单占用了数量
+	if itemized(afterSales) {
+		_, lines, err := m.fetchOrder(ctx, afterSales.OrderID, afterSales.UserID)
+		if err != nil {
+			return err
+		}
+		refund, err := m.allocate(ctx, afterSales, lines)
+		if err != nil {
+			return err
+		}
+		if amount > refund {
+			return fmt.Errorf("approval amount %d exceeds refundable amount %d", amount, refund)
+		}
+	}
+	// 未指定金额时按折算金额批准
+	if amount == 0 {
+		amount = afterSales.RefundAmount
+	}
+
 	oldStatus := afterSales.Status.String()
 	afterSales.Approve(operator, amount)
 
 	if err := m.repo.Update(ctx, afterSales); err != nil {
 		return err
 	}
+	if err := m.repo.SaveItems(ctx, afterSales.Items); err != nil {
+		return err
+	}
 
-	m.LogOperation(ctx, id, operator, "Approve", oldStatus, afterSales.Status.String(), fmt.Sprintf("Approved amount: %d", amount))
+	m.LogOperation(ctx, id, operator, action, oldStatus, afterSales.Status.String(), fmt.Sprintf("Approved amount: %d", amount))
+
+	// 退货/换货生成退货运单；物流服务故障时保持已批准，可通过 IssueReturnLabel 重试
+	if afterSales.RequiresReturn() {
+		if err := m.issueReturnLabel(ctx, afterSales, operator); err != nil {
+			m.logger.WarnContext(ctx, "failed to issue return label, retry later", "after_sales_id", id, "error", err)
+		}
+	}
 	return nil
 }
 
@@ -110,6 +190,7 @@ func (m *AfterSalesManager) Reject(ctx context.Context, id uint64, operator, rea
 	}
 
 	m.LogOperation(ctx, id, operator, "Reject", oldStatus, afterSales.Status.String(), reason)
+	m.stopDeadlines(ctx, id, domain.DeadlineSellerResponse, "rejected by "+operator)
 	return nil
 }
 
@@ -138,19 +219,23 @@ func (m *AfterSalesManager) SagaMarkRefundFailed(ctx context.Context, id uint64,
 }
 
 // ProcessRefund 执行退款 (生产级 100% 可靠编排)
+// 仅退款批准后即可执行；退货须待仓库验货完成。按批准金额部分退款，
+// 订单状态由支付服务的 payment.refunded 事件驱动，不再整单取消。
 func (m *AfterSalesManager) ProcessRefund(ctx context.Context, id uint64) error {
 	afterSales, err := m.repo.GetByID(ctx, id)
-	if err != nil || afterSales.Status != domain.AfterSalesStatusApproved {
-		return fmt.Errorf("request not ready for refund")
+	if err != nil {
+		return err
+	}
+	if err := afterSales.ReadyForRefund(); err != nil {
+		return fmt.Errorf("request not ready for refund: %w", err)
 	}
 
-	m.logger.InfoContext(ctx, "starting full saga refund orchestration", "as_no", afterSales.AfterSalesNo)
+	m.logger.InfoContext(ctx, "starting full saga refund orchestration", "as_no", afterSales.AfterSalesNo, "amount", afterSales.ApprovalAmount)
 
 	gid := fmt.Sprintf("SAGA-AS-REFUND-%s", afterSales.AfterSalesNo)
 	saga := dtm.NewSaga(ctx, m.dtmServer, gid)
 
 	paymentSvc := m.paymentSvcURL + "/api.payment.v1.PaymentService"
-	orderSvc := m.orderSvcURL + "/api.order.v1.OrderService"
 	aftersalesSvc := m.aftersalesURL + "/api.aftersales.v1.AftersalesService"
 
 	// 1. 状态追踪桩
@@ -159,17 +244,13 @@ func (m *AfterSalesManager) ProcessRefund(ctx context.Context, id uint64) error
 		Reason:       "Transaction Rolled Back",
 	})
 
-	// 2. 资金退回
+	// 2. 资金退回 (按批准金额，支持部分退款)
 	saga.Add(paymentSvc+"/SagaRefund", paymentSvc+"/SagaCancelRefund", &paymentv1.SagaRefundRequest{
-		UserId: afterSales.UserID, OrderId: afterSales.OrderID, RefundAmount: afterSales.RefundAmount,
-	})
-
-	// 3. 订单状态变更 (改为 CANCELLED/REFUNDED)
-	saga.Add(orderSvc+"/SagaCancelOrder", "", &orderv1.SagaOrderRequest{
-		UserId: afterSales.UserID, OrderId: afterSales.OrderID, Reason: "Aftersales Refund",
+		UserId: afterSales.UserID, OrderId: afterSales.OrderID, RefundAmount: afterSales.ApprovalAmount,
+		Reason: fmt.Sprintf("Aftersales %s", afterSales.AfterSalesNo),
 	})
 
-	// 4. 最终状态确认
+	// 3. 最终状态确认
 	saga.Add(aftersalesSvc+"/SagaMarkRefundCompleted", "", &aftersalesv1.SagaAftersalesRequest{
 		AftersalesId: uint64(afterSales.ID),
 	})
@@ -181,24 +262,83 @@ func (m *AfterSalesManager) ProcessRefund(ctx context.Context, id uint64) error
 	return nil
 }
 
+// ProcessExchange 换货补发：退回商品验货完成后，从退货仓按售后单号幂等出库换货 SKU，
+// 并创建挂在原订单下的零价格补发运单 (退货仓 -> 用户)。
 func (m *AfterSalesManager) ProcessExchange(ctx context.Context, id uint64) error {
 	afterSales, err := m.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
-	if afterSales.Status != domain.AfterSalesStatusApproved {
-		return fmt.Errorf("invalid status for exchange: %v", afterSales.Status)
+	if err := afterSales.ReadyForExchange(); err != nil {
+		return fmt.Errorf("invalid status for exchange: %w", err)
 	}
 
-	afterSales.Status = domain.AfterSalesStatusCompleted
-	now := time.Now()
-	afterSales.CompletedAt = &now
+	for _, item := range afterSales.Items {
+		skuID := item.ExchangeSkuID
+		if skuID == 0 {
+			skuID = item.SkuID
+		}
+		if _, err := m.inventoryClient.DeductStock(ctx, &inventoryv1.DeductStockRequest{
+			SkuId:       skuID,
+			Quantity:    item.Quantity,
+			Reason:      "aftersales exchange replacement",
+			WarehouseId: m.returns.WarehouseID,
+			OrderNo:     fmt.Sprintf("%s-X-%d", afterSales.AfterSalesNo, item.ID),
+		}); err != nil {
+			m.logger.ErrorContext(ctx, "failed to deduct replacement stock", "after_sales_no", afterSales.AfterSalesNo, "sku_id", skuID, "error", err)
+			return fmt.Errorf("failed to deduct replacement sku %d: %w", skuID, err)
+		}
+	}
+
+	shipment, err := m.ensureShipment(ctx, afterSales, domain.ShipmentReplacement, "RP")
+	if err != nil {
+		return err
+	}
+	if !shipment.Booked() {
+		order, _, err := m.fetchOrder(ctx, afterSales.OrderID, afterSales.UserID)
+		if err != nil {
+			return err
+		}
+		addr := order.ShippingAddress
+		if addr == nil {
+			return fmt.Errorf("order %s has no shipping address", afterSales.OrderNo)
+		}
+		logisticsID, err := m.bookShipment(ctx, &logisticsv1.CreateLogisticsRequest{
+			OrderId:         afterSales.OrderID,
+			UserId:          afterSales.UserID,
+			ShipmentType:    "REPLACEMENT",
+			OrderNo:         afterSales.OrderNo,
+			TrackingNo:      shipment.TrackingNo,
+			Carrier:         m.returns.Carrier,
+			CarrierCode:     m.returns.CarrierCode,
+			SenderName:      m.returns.ContactName,
+			SenderPhone:     m.returns.ContactPhone,
+			SenderAddress:   m.returns.Address,
+			SenderLat:       m.returns.Lat,
+			SenderLon:       m.returns.Lon,
+			ReceiverName:    addr.RecipientName,
+			ReceiverPhone:   addr.PhoneNumber,
+			ReceiverAddress: formatAddress(addr),
+			ReceiverLat:     addr.Lat,
+			ReceiverLon:     addr.Lon,
+		})
+		if err != nil {
+			return err
+		}
+		shipment.LogisticsID = logisticsID
+		if err := m.repo.SaveShipment(ctx, shipment); err != nil {
+			return err
+		}
+	}
+
+	oldStatus := afterSales.Status.String()
+	afterSales.Complete()
 
 	if err := m.repo.Update(ctx, afterSales); err != nil {
 		return err
 	}
 
-	m.LogOperation(ctx, id, "System", "ProcessExchange", "Approved", "Completed", "Exchange processed successfully")
+	m.LogOperation(ctx, id, "System", "ProcessExchange", oldStatus, afterSales.Status.String(), fmt.Sprintf("Replacement shipped: %s", shipment.TrackingNo))
 	return nil
 }
 
@@ -39,3 +39,11 @@ func (q *AfterSalesQuery) ListSupportTicketMessages(ctx context.Context, ticketI
 func (q *AfterSalesQuery) GetConfig(ctx context.Context, key string) (*domain.AfterSalesConfig, error) {
 	return q.repo.GetConfig(ctx, key)
 }
+
+func (q *AfterSalesQuery) ListPolicies(ctx context.Context) ([]*domain.AfterSalesPolicy, error) {
+	return q.repo.ListPolicies(ctx)
+}
+
+func (q *AfterSalesQuery) ListDeadlines(ctx context.Context, afterSalesID uint64) ([]*domain.AfterSalesDeadline, error) {
+	return q.repo.ListDeadlines(ctx, afterSalesID)
+}
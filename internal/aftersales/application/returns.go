@@ -0,0 +1,240 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	inventoryv1 "github.com/wyfcoding/ecommerce/goapi/inventory/v1"
+	logisticsv1 "github.com/wyfcoding/ecommerce/goapi/logistics/v1"
+	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
+	"github.com/wyfcoding/ecommerce/internal/aftersales/domain"
+)
+
+// ReturnsConfig 退货仓配置：退货运单的收件地址，换货补发的发货地址。
+type ReturnsConfig struct {
+	WarehouseID   uint64  `mapstructure:"warehouse_id"`   // 退货仓 ID，验货入库与换货补发出库的默认仓库
+	WarehouseName string  `mapstructure:"warehouse_name"` // 退货仓名称
+	ContactName   string  `mapstructure:"contact_name"`   // 收件/发件联系人
+	ContactPhone  string  `mapstructure:"contact_phone"`  // 联系电话
+	Address       string  `mapstructure:"address"`        // 退货仓地址
+	Lat           float64 `mapstructure:"lat"`            // 纬度
+	Lon           float64 `mapstructure:"lon"`            // 经度
+	Carrier       string  `mapstructure:"carrier"`        // 逆向物流承运商
+	CarrierCode   string  `mapstructure:"carrier_code"`   // 承运商代码
+}
+
+// itemized 售后商品按原订单行校验与折算退款的售后类型。
+func itemized(as *domain.AfterSales) bool {
+	if len(as.Items) == 0 {
+		return false
+	}
+	switch as.Type {
+	case domain.AfterSalesTypeReturnGoods, domain.AfterSalesTypeExchange, domain.AfterSalesTypeRefund:
+		return true
+	}
+	return false
+}
+
+// fetchOrder 查询原订单并转换为订单行。
+func (m *AfterSalesManager) fetchOrder(ctx context.Context, orderID, userID uint64) (*orderv1.OrderInfo, []domain.OrderLine, error) {
+	order, err := m.orderClient.GetOrderByID(ctx, &orderv1.GetOrderByIDRequest{Id: orderID, UserId: userID})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get order %d: %w", orderID, err)
+	}
+	lines := make([]domain.OrderLine, 0, len(order.Items))
+	for _, item := range order.Items {
+		lines = append(lines, domain.OrderLine{
+			OrderItemID: item.Id,
+			ProductID:   item.ProductId,
+			SkuID:       item.SkuId,
+			ProductName: item.ProductName,
+			SkuName:     item.SkuName,
+			Price:       item.Price,
+			Quantity:    item.Quantity,
+			PayAmount:   item.PayAmount,
+		})
+	}
+	return order, lines, nil
+}
+
+// allocate 按原订单实付金额重新折算售后商品退款，扣除该订单其他有效售后单已占用的数量。
+func (m *AfterSalesManager) allocate(ctx context.Context, as *domain.AfterSales, lines []domain.OrderLine) (int64, error) {
+	returned, err := m.repo.ReturnedQuantities(ctx, as.OrderID, uint64(as.ID))
+	if err != nil {
+		return 0, err
+	}
+	return as.AllocateRefund(lines, returned)
+}
+
+// IssueReturnLabel 为已批准的退货/换货申请生成退货运单，可在物流服务故障后重试。
+func (m *AfterSalesManager) IssueReturnLabel(ctx context.Context, id uint64, operator string) (*domain.AfterSales, error) {
+	afterSales, err := m.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !afterSales.RequiresReturn() {
+		return nil, fmt.Errorf("%w: after-sales type %d does not require return", domain.ErrInvalidStatus, afterSales.Type)
+	}
+	if afterSales.Status != domain.AfterSalesStatusApproved && afterSales.Status != domain.AfterSalesStatusInProgress {
+		return nil, fmt.Errorf("%w: %s", domain.ErrInvalidStatus, afterSales.Status)
+	}
+	if err := m.issueReturnLabel(ctx, afterSales, operator); err != nil {
+		return nil, err
+	}
+	return afterSales, nil
+}
+
+// issueReturnLabel 生成退货运单 (用户地址 -> 退货仓)，建单成功后售后单进入处理中。
+// 运单号先落库再调用物流服务，重试时沿用同一运单号。
+func (m *AfterSalesManager) issueReturnLabel(ctx context.Context, as *domain.AfterSales, operator string) error {
+	shipment, err := m.ensureShipment(ctx, as, domain.ShipmentReturn, "RT")
+	if err != nil {
+		return err
+	}
+
+	if !shipment.Booked() {
+		order, _, err := m.fetchOrder(ctx, as.OrderID, as.UserID)
+		if err != nil {
+			return err
+		}
+		addr := order.ShippingAddress
+		if addr == nil {
+			return fmt.Errorf("order %s has no shipping address", as.OrderNo)
+		}
+		logisticsID, err := m.bookShipment(ctx, &logisticsv1.CreateLogisticsRequest{
+			OrderId:         as.OrderID,
+			UserId:          as.UserID,
+			ShipmentType:    "RETURN",
+			OrderNo:         as.OrderNo,
+			TrackingNo:      shipment.TrackingNo,
+			Carrier:         m.returns.Carrier,
+			CarrierCode:     m.returns.CarrierCode,
+			SenderName:      addr.RecipientName,
+			SenderPhone:     addr.PhoneNumber,
+			SenderAddress:   formatAddress(addr),
+			SenderLat:       addr.Lat,
+			SenderLon:       addr.Lon,
+			ReceiverName:    m.returns.ContactName,
+			ReceiverPhone:   m.returns.ContactPhone,
+			ReceiverAddress: m.returns.Address,
+			ReceiverLat:     m.returns.Lat,
+			ReceiverLon:     m.returns.Lon,
+		})
+		if err != nil {
+			return err
+		}
+		shipment.LogisticsID = logisticsID
+		if err := m.repo.SaveShipment(ctx, shipment); err != nil {
+			return err
+		}
+	}
+
+	if as.Status != domain.AfterSalesStatusApproved {
+		return nil
+	}
+	oldStatus := as.Status.String()
+	as.Process()
+	if err := m.repo.Update(ctx, as); err != nil {
+		return err
+	}
+	m.logger.InfoContext(ctx, "return label issued", "after_sales_no", as.AfterSalesNo, "tracking_no", shipment.TrackingNo)
+	m.LogOperation(ctx, uint64(as.ID), operator, "IssueReturnLabel", oldStatus, as.Status.String(), fmt.Sprintf("Return tracking no: %s", shipment.TrackingNo))
+	return nil
+}
+
+// InspectReturn 记录仓库对退回商品的验货结果：完好商品按售后单号幂等入库，破损商品只记录不入库。
+// 全部商品验货完成后方可执行退款或换货补发。
+func (m *AfterSalesManager) InspectReturn(ctx context.Context, id uint64, operator string, inspections []domain.ItemInspection) (*domain.AfterSales, error) {
+	afterSales, err := m.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !afterSales.RequiresReturn() || afterSales.Status != domain.AfterSalesStatusInProgress {
+		return nil, fmt.Errorf("%w: %s", domain.ErrInvalidStatus, afterSales.Status)
+	}
+	if afterSales.Shipment(domain.ShipmentReturn) == nil {
+		return nil, domain.ErrReturnLabelRequired
+	}
+	if len(inspections) == 0 {
+		return nil, fmt.Errorf("%w: no inspections", domain.ErrInvalidReturnItems)
+	}
+
+	now := time.Now()
+	inspected := make([]*domain.AfterSalesItem, 0, len(inspections))
+	remarks := make([]string, 0, len(inspections))
+	for _, in := range inspections {
+		item, err := afterSales.Inspect(in, operator, now)
+		if err != nil {
+			return nil, err
+		}
+		if item.Inspection == domain.InspectionRestocked {
+			if item.InspectionWarehouseID == 0 {
+				item.InspectionWarehouseID = m.returns.WarehouseID
+			}
+			if _, err := m.inventoryClient.AddStock(ctx, &inventoryv1.AddStockRequest{
+				SkuId:       item.SkuID,
+				Quantity:    item.Quantity,
+				Reason:      "aftersales return restock",
+				WarehouseId: item.InspectionWarehouseID,
+				OrderNo:     fmt.Sprintf("%s-%d", afterSales.AfterSalesNo, item.ID),
+			}); err != nil {
+				m.logger.ErrorContext(ctx, "failed to restock returned item", "after_sales_no", afterSales.AfterSalesNo, "sku_id", item.SkuID, "error", err)
+				return nil, fmt.Errorf("failed to restock sku %d: %w", item.SkuID, err)
+			}
+		}
+		inspected = append(inspected, item)
+		remarks = append(remarks, fmt.Sprintf("sku %d x%d %s", item.SkuID, item.Quantity, item.Inspection))
+	}
+
+	if err := m.repo.SaveItems(ctx, inspected); err != nil {
+		return nil, err
+	}
+	status := afterSales.Status.String()
+	m.LogOperation(ctx, id, operator, "Inspect", status, status, strings.Join(remarks, "; "))
+	return afterSales, nil
+}
+
+// ensureShipment 返回指定方向的售后运单，不存在时生成运单号并落库。
+func (m *AfterSalesManager) ensureShipment(ctx context.Context, as *domain.AfterSales, direction domain.ShipmentDirection, prefix string) (*domain.AfterSalesShipment, error) {
+	if shipment := as.Shipment(direction); shipment != nil {
+		return shipment, nil
+	}
+	shipment := &domain.AfterSalesShipment{
+		AfterSalesID: uint64(as.ID),
+		Direction:    direction,
+		OrderID:      as.OrderID,
+		OrderNo:      as.OrderNo,
+		TrackingNo:   fmt.Sprintf("%s%d", prefix, m.idGenerator.Generate()),
+		Carrier:      m.returns.Carrier,
+		WarehouseID:  m.returns.WarehouseID,
+	}
+	if err := m.repo.SaveShipment(ctx, shipment); err != nil {
+		return nil, err
+	}
+	as.Shipments = append(as.Shipments, shipment)
+	return shipment, nil
+}
+
+// bookShipment 在物流服务建单。调用失败时按运单号回查，上次建单成功但响应丢失时直接复用。
+func (m *AfterSalesManager) bookShipment(ctx context.Context, req *logisticsv1.CreateLogisticsRequest) (uint64, error) {
+	resp, err := m.logisticsClient.CreateLogistics(ctx, req)
+	if err == nil && resp.Logistics != nil {
+		return resp.Logistics.Id, nil
+	}
+	existing, lookupErr := m.logisticsClient.GetLogisticsByTrackingNo(ctx, &logisticsv1.GetLogisticsByTrackingNoRequest{TrackingNo: req.TrackingNo})
+	if lookupErr == nil && existing.Logistics != nil {
+		return existing.Logistics.Id, nil
+	}
+	if err == nil {
+		err = errors.New("empty logistics response")
+	}
+	m.logger.ErrorContext(ctx, "failed to create logistics", "tracking_no", req.TrackingNo, "error", err)
+	return 0, fmt.Errorf("failed to create logistics %s: %w", req.TrackingNo, err)
+}
+
+func formatAddress(addr *orderv1.ShippingAddress) string {
+	return addr.Province + addr.City + addr.District + addr.DetailedAddress
+}
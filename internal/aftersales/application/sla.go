@@ -0,0 +1,239 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	productv1 "github.com/wyfcoding/ecommerce/goapi/product/v1"
+	usertierv1 "github.com/wyfcoding/ecommerce/goapi/usertier/v1"
+	"github.com/wyfcoding/ecommerce/internal/aftersales/domain"
+)
+
+// SetSLAClients 注入商品服务与会员等级服务客户端。
+func (m *AfterSalesManager) SetSLAClients(productCli productv1.ProductServiceClient, userTierCli usertierv1.UserTierServiceClient) {
+	m.productClient = productCli
+	m.userTierClient = userTierCli
+}
+
+// SavePolicy 校验并保存售后策略。
+func (m *AfterSalesManager) SavePolicy(ctx context.Context, policy *domain.AfterSalesPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	if policy.ID != 0 {
+		existing, err := m.repo.GetPolicy(ctx, uint64(policy.ID))
+		if err != nil {
+			return err
+		}
+		policy.CreatedAt = existing.CreatedAt
+	}
+	if err := m.repo.SavePolicy(ctx, policy); err != nil {
+		return err
+	}
+	m.logger.InfoContext(ctx, "after-sales policy saved", "policy_id", policy.ID, "name", policy.Name, "scope", policy.Scope, "scope_id", policy.ScopeID)
+	return nil
+}
+
+// resolveCategory 以首个售后商品的类目作为售后单类目，查询失败时不按类目匹配策略。
+func (m *AfterSalesManager) resolveCategory(ctx context.Context, as *domain.AfterSales) uint64 {
+	if m.productClient == nil || len(as.Items) == 0 || as.Items[0].ProductID == 0 {
+		return 0
+	}
+	product, err := m.productClient.GetProductByID(ctx, &productv1.GetProductByIDRequest{Id: as.Items[0].ProductID})
+	if err != nil || product.Category == nil {
+		m.logger.WarnContext(ctx, "failed to resolve after-sales category", "product_id", as.Items[0].ProductID, "error", err)
+		return 0
+	}
+	return product.Category.Id
+}
+
+// userLevel 查询用户会员等级，用于判定是否为可信用户。
+func (m *AfterSalesManager) userLevel(ctx context.Context, userID uint64) (int32, error) {
+	if m.userTierClient == nil {
+		return 0, fmt.Errorf("user tier client not configured")
+	}
+	resp, err := m.userTierClient.GetUserTier(ctx, &usertierv1.GetUserTierRequest{UserId: userID})
+	if err != nil {
+		return 0, err
+	}
+	if resp.Tier == nil {
+		return 0, nil
+	}
+	return resp.Tier.Level, nil
+}
+
+// applyPolicy 为新建售后单匹配策略：满足条件的仅退款申请即时自动批准，否则启动商家响应计时。
+// 策略处理失败不影响售后单创建，申请保持待审核。
+func (m *AfterSalesManager) applyPolicy(ctx context.Context, as *domain.AfterSales) {
+	policies, err := m.repo.ListPolicies(ctx)
+	if err != nil {
+		m.logger.WarnContext(ctx, "failed to load after-sales policies", "after_sales_id", as.ID, "error", err)
+		return
+	}
+	policy := domain.MatchPolicy(policies, as.MerchantID, as.CategoryID)
+	if policy == nil {
+		return
+	}
+	as.PolicyID = uint64(policy.ID)
+	if err := m.repo.Update(ctx, as); err != nil {
+		m.logger.WarnContext(ctx, "failed to bind after-sales policy", "after_sales_id", as.ID, "policy_id", policy.ID, "error", err)
+		return
+	}
+
+	// 仅在金额满足阈值时查询会员等级，避免无谓的远程调用
+	if policy.QualifiesAutoApprove(as, policy.TrustedLevel) {
+		level, err := m.userLevel(ctx, as.UserID)
+		if err != nil {
+			m.logger.WarnContext(ctx, "failed to get user tier, skip auto approval", "user_id", as.UserID, "error", err)
+		} else if policy.QualifiesAutoApprove(as, level) {
+			if err := m.approve(ctx, as, "System", 0, "AutoApprove"); err != nil {
+				m.logger.WarnContext(ctx, "auto approval failed, fallback to manual review", "after_sales_id", as.ID, "error", err)
+			} else {
+				m.logger.InfoContext(ctx, "after-sales auto approved", "after_sales_no", as.AfterSalesNo, "policy", policy.Name, "amount", as.RefundAmount, "user_level", level)
+				return
+			}
+		}
+	}
+
+	if policy.SellerResponseHours > 0 {
+		m.startDeadline(ctx, as, domain.DeadlineSellerResponse, uint64(policy.ID), policy.SellerResponseHours)
+	}
+}
+
+// policyOf 返回售后单创建时命中的策略，未命中或策略已删除时返回 nil。
+func (m *AfterSalesManager) policyOf(ctx context.Context, as *domain.AfterSales) *domain.AfterSalesPolicy {
+	if as.PolicyID == 0 {
+		return nil
+	}
+	policy, err := m.repo.GetPolicy(ctx, as.PolicyID)
+	if err != nil {
+		m.logger.WarnContext(ctx, "failed to load after-sales policy", "policy_id", as.PolicyID, "error", err)
+		return nil
+	}
+	return policy
+}
+
+// Dispute 用户对商家拒绝结果发起平台仲裁，并按策略启动仲裁计时。
+func (m *AfterSalesManager) Dispute(ctx context.Context, id, userID uint64, reason string) (*domain.AfterSales, error) {
+	afterSales, err := m.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if afterSales.UserID != userID {
+		return nil, fmt.Errorf("%w: after-sales %d does not belong to user %d", domain.ErrDisputeNotAllowed, id, userID)
+	}
+
+	policy := m.policyOf(ctx, afterSales)
+	var window time.Duration
+	if policy != nil {
+		window = time.Duration(policy.DisputeWindowHours) * time.Hour
+	}
+
+	oldStatus := afterSales.Status.String()
+	if err := afterSales.Dispute(reason, window, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := m.repo.Update(ctx, afterSales); err != nil {
+		return nil, err
+	}
+	m.LogOperation(ctx, id, "User", "Dispute", oldStatus, afterSales.Status.String(), reason)
+
+	if policy != nil && policy.ArbitrationHours > 0 {
+		m.startDeadline(ctx, afterSales, domain.DeadlineArbitration, uint64(policy.ID), policy.ArbitrationHours)
+	}
+	return afterSales, nil
+}
+
+// Arbitrate 平台对仲裁中的售后单作出裁决：支持用户则按批准流程处理，否则维持拒绝。
+func (m *AfterSalesManager) Arbitrate(ctx context.Context, id uint64, arbitrator string, approve bool, amount int64, remark string) (*domain.AfterSales, error) {
+	afterSales, err := m.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := afterSales.Arbitrate(arbitrator, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if approve {
+		if err := m.approve(ctx, afterSales, arbitrator, amount, "ArbitrateApprove"); err != nil {
+			return nil, err
+		}
+	} else {
+		oldStatus := afterSales.Status.String()
+		afterSales.Reject(arbitrator, remark)
+		if err := m.repo.Update(ctx, afterSales); err != nil {
+			return nil, err
+		}
+		m.LogOperation(ctx, id, arbitrator, "ArbitrateReject", oldStatus, afterSales.Status.String(), remark)
+	}
+
+	m.stopDeadlines(ctx, id, domain.DeadlineArbitration, "arbitrated by "+arbitrator)
+	return afterSales, nil
+}
+
+// FireDeadline 处理到期的计时器：商家超时未审核则自动批准，平台超时未裁决则记录 SLA 违约。
+// 返回错误时计时器保持计时中，租约到期后重新领取。
+func (m *AfterSalesManager) FireDeadline(ctx context.Context, deadline *domain.AfterSalesDeadline) error {
+	afterSales, err := m.repo.GetByID(ctx, deadline.AfterSalesID)
+	if err != nil {
+		return err
+	}
+	id := uint64(afterSales.ID)
+	status := afterSales.Status.String()
+
+	var outcome string
+	switch deadline.Kind {
+	case domain.DeadlineSellerResponse:
+		if afterSales.Status != domain.AfterSalesStatusPending {
+			return m.closeDeadline(ctx, deadline, domain.DeadlineCancelled, "already "+status)
+		}
+		if err := m.approve(ctx, afterSales, "System", 0, "AutoApprove"); err != nil {
+			return err
+		}
+		outcome = "auto approved: seller did not respond in time"
+	case domain.DeadlineArbitration:
+		if afterSales.Status != domain.AfterSalesStatusArbitrating {
+			return m.closeDeadline(ctx, deadline, domain.DeadlineCancelled, "already "+status)
+		}
+		m.logger.WarnContext(ctx, "after-sales arbitration overdue", "after_sales_no", afterSales.AfterSalesNo, "due_at", deadline.DueAt)
+		m.LogOperation(ctx, id, "System", "SLABreach", status, status, "Arbitration not ruled before deadline")
+		outcome = "arbitration overdue"
+	default:
+		return m.closeDeadline(ctx, deadline, domain.DeadlineCancelled, "unknown deadline kind")
+	}
+
+	if err := m.closeDeadline(ctx, deadline, domain.DeadlineFired, outcome); err != nil {
+		return err
+	}
+	m.LogOperation(ctx, id, "System", "DeadlineExpired", status, afterSales.Status.String(), fmt.Sprintf("%s: %s", deadline.Kind, outcome))
+	return nil
+}
+
+// startDeadline 启动计时器并记录审计日志。
+func (m *AfterSalesManager) startDeadline(ctx context.Context, as *domain.AfterSales, kind domain.DeadlineKind, policyID uint64, hours int) {
+	deadline := domain.NewDeadline(uint64(as.ID), kind, policyID, time.Now(), hours)
+	if err := m.repo.SaveDeadline(ctx, deadline); err != nil {
+		m.logger.ErrorContext(ctx, "failed to start after-sales deadline", "after_sales_id", as.ID, "kind", kind, "error", err)
+		return
+	}
+	status := as.Status.String()
+	m.LogOperation(ctx, uint64(as.ID), "System", "DeadlineStart", status, status, fmt.Sprintf("%s due at %s", kind, deadline.DueAt.Format(time.RFC3339)))
+}
+
+// stopDeadlines 售后单在到期前已处理，取消对应计时器并记录审计日志。
+func (m *AfterSalesManager) stopDeadlines(ctx context.Context, id uint64, kind domain.DeadlineKind, outcome string) {
+	cancelled, err := m.repo.CancelDeadlines(ctx, id, kind, outcome)
+	if err != nil {
+		m.logger.WarnContext(ctx, "failed to cancel after-sales deadlines", "after_sales_id", id, "kind", kind, "error", err)
+		return
+	}
+	for _, d := range cancelled {
+		m.LogOperation(ctx, id, "System", "DeadlineCancel", "", "", fmt.Sprintf("%s due at %s: %s", d.Kind, d.DueAt.Format(time.RFC3339), outcome))
+	}
+}
+
+func (m *AfterSalesManager) closeDeadline(ctx context.Context, deadline *domain.AfterSalesDeadline, status domain.DeadlineStatus, outcome string) error {
+	deadline.Close(status, outcome, time.Now())
+	return m.repo.SaveDeadline(ctx, deadline)
+}
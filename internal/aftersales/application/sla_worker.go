@@ -0,0 +1,90 @@
+package application
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/aftersales/domain"
+)
+
+// SLAConfig 售后时效计时器扫描配置。
+type SLAConfig struct {
+	Interval  time.Duration `mapstructure:"interval"`   // 到期计时器扫描间隔
+	Lease     time.Duration `mapstructure:"lease"`      // 领取租约，处理失败时租约到期后重新领取
+	BatchSize int           `mapstructure:"batch_size"` // 单次领取上限
+}
+
+// SLAWorker 后台扫描到期的售后计时器并触发自动批准或违约记录。
+// 计时器持久化在数据库中，服务重启后继续生效；多副本通过租约互斥领取。
+type SLAWorker struct {
+	repo     domain.AfterSalesRepository
+	service  *AfterSalesService
+	logger   *slog.Logger
+	cfg      SLAConfig
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSLAWorker 创建售后时效扫描器，未配置的参数使用默认值。
+func NewSLAWorker(repo domain.AfterSalesRepository, service *AfterSalesService, cfg SLAConfig, logger *slog.Logger) *SLAWorker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 2 * time.Minute
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	return &SLAWorker{
+		repo:     repo,
+		service:  service,
+		logger:   logger.With("module", "aftersales_sla"),
+		cfg:      cfg,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动扫描协程。
+func (w *SLAWorker) Start() {
+	w.logger.Info("after-sales sla worker started", "interval", w.cfg.Interval)
+	ticker := time.NewTicker(w.cfg.Interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				w.poll()
+			case <-w.stopChan:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止扫描协程。
+func (w *SLAWorker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+		w.logger.Info("after-sales sla worker stopped")
+	})
+}
+
+// poll 领取到期计时器并逐个处理。
+func (w *SLAWorker) poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.Lease)
+	defer cancel()
+
+	deadlines, err := w.repo.ClaimDueDeadlines(ctx, time.Now(), w.cfg.Lease, w.cfg.BatchSize)
+	if err != nil {
+		w.logger.Error("failed to claim due after-sales deadlines", "error", err)
+		return
+	}
+	for _, d := range deadlines {
+		if err := w.service.FireDeadline(ctx, d); err != nil {
+			w.logger.Error("failed to fire after-sales deadline", "deadline_id", d.ID, "after_sales_id", d.AfterSalesID, "kind", d.Kind, "error", err)
+		}
+	}
+}
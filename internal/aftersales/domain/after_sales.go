@@ -28,12 +28,13 @@ const (
 type AfterSalesStatus int8
 
 const (
-	AfterSalesStatusPending    AfterSalesStatus = 1 // 待处理：申请已提交，等待商家审核。
-	AfterSalesStatusApproved   AfterSalesStatus = 2 // 已批准：商家已同意售后申请。
-	AfterSalesStatusRejected   AfterSalesStatus = 3 // 已拒绝：商家已拒绝售后申请。
-	AfterSalesStatusInProgress AfterSalesStatus = 4 // 处理中：售后流程正在进行，例如退货物流中。
-	AfterSalesStatusCompleted  AfterSalesStatus = 5 // 已完成：售后流程已结束。
-	AfterSalesStatusCancelled  AfterSalesStatus = 6 // 已取消：售后申请被取消。
+	AfterSalesStatusPending     AfterSalesStatus = 1 // 待处理：申请已提交，等待商家审核。
+	AfterSalesStatusApproved    AfterSalesStatus = 2 // 已批准：商家已同意售后申请。
+	AfterSalesStatusRejected    AfterSalesStatus = 3 // 已拒绝：商家已拒绝售后申请。
+	AfterSalesStatusInProgress  AfterSalesStatus = 4 // 处理中：售后流程正在进行，例如退货物流中。
+	AfterSalesStatusCompleted   AfterSalesStatus = 5 // 已完成：售后流程已结束。
+	AfterSalesStatusCancelled   AfterSalesStatus = 6 // 已取消：售后申请被取消。
+	AfterSalesStatusArbitrating AfterSalesStatus = 7 // 仲裁中：用户对拒绝结果有异议，等待平台裁决。
 )
 
 // String 方法返回 AfterSalesStatus 的字符串表示。
@@ -51,6 +52,8 @@ func (s AfterSalesStatus) String() string {
 		return "Completed"
 	case AfterSalesStatusCancelled:
 		return "Cancelled"
+	case AfterSalesStatusArbitrating:
+		return "Arbitrating"
 	default:
 		return "Unknown"
 	}
@@ -59,39 +62,55 @@ func (s AfterSalesStatus) String() string {
 // AfterSales 实体是售后模块的聚合根。
 // 它代表一个完整的售后申请，包含售后单号、订单信息、用户、类型、状态、原因、商品列表和操作日志等。
 type AfterSales struct {
-	gorm.Model                        // 嵌入gorm.Model，包含ID, CreatedAt, UpdatedAt, DeletedAt等通用字段。
-	AfterSalesNo    string            `gorm:"type:varchar(64);uniqueIndex;not null;comment:售后单号" json:"after_sales_no"` // 售后单的唯一编号，唯一索引。
-	OrderID         uint64            `gorm:"not null;index;comment:订单ID" json:"order_id"`                              // 关联的订单ID，索引字段。
-	OrderNo         string            `gorm:"type:varchar(64);not null;comment:订单编号" json:"order_no"`                   // 关联的订单编号。
-	UserID          uint64            `gorm:"not null;index;comment:用户ID" json:"user_id"`                               // 发起售后申请的用户ID，索引字段。
-	Type            AfterSalesType    `gorm:"type:tinyint;not null;comment:售后类型" json:"type"`                           // 售后类型。
-	Status          AfterSalesStatus  `gorm:"type:tinyint;not null;default:1;comment:状态" json:"status"`                 // 售后单状态，默认为待处理。
-	Reason          string            `gorm:"type:varchar(255);not null;comment:申请原因" json:"reason"`                    // 客户提交的申请原因。
-	Description     string            `gorm:"type:text;comment:详细描述" json:"description"`                                // 详细的售后描述。
-	Images          []string          `gorm:"type:json;serializer:json;comment:凭证图片" json:"images"`                     // 客户提供的凭证图片URL列表。
-	RefundAmount    int64             `gorm:"not null;default:0;comment:退款金额(分)" json:"refund_amount"`                  // 订单中实际产生的退款金额（总额），GORM会忽略，仅在代码中记录。
-	ApprovalAmount  int64             `gorm:"not null;default:0;comment:批准金额(分)" json:"approval_amount"`                // 实际批准的退款金额或补偿金额。
-	ApprovedBy      string            `gorm:"type:varchar(64);comment:批准人" json:"approved_by"`                          // 批准售后申请的操作人员。
-	RejectionReason string            `gorm:"type:varchar(255);comment:拒绝原因" json:"rejection_reason"`                   // 拒绝售后申请的原因。
-	ApprovedAt      *time.Time        `gorm:"comment:批准时间" json:"approved_at"`                                          // 售后申请被批准的时间。
-	RejectedAt      *time.Time        `gorm:"comment:拒绝时间" json:"rejected_at"`                                          // 售后申请被拒绝的时间。
-	CompletedAt     *time.Time        `gorm:"comment:完成时间" json:"completed_at"`                                         // 售后流程完成的时间。
-	CancelledAt     *time.Time        `gorm:"comment:取消时间" json:"cancelled_at"`                                         // 售后申请被取消的时间。
-	Items           []*AfterSalesItem `gorm:"foreignKey:AfterSalesID" json:"items"`                                     // 售后申请包含的商品列表，一对多关系。
-	Logs            []*AfterSalesLog  `gorm:"foreignKey:AfterSalesID" json:"logs"`                                      // 售后申请的操作日志列表，一对多关系。
+	gorm.Model                            // 嵌入gorm.Model，包含ID, CreatedAt, UpdatedAt, DeletedAt等通用字段。
+	AfterSalesNo    string                `gorm:"type:varchar(64);uniqueIndex;not null;comment:售后单号" json:"after_sales_no"` // 售后单的唯一编号，唯一索引。
+	OrderID         uint64                `gorm:"not null;index;comment:订单ID" json:"order_id"`                              // 关联的订单ID，索引字段。
+	OrderNo         string                `gorm:"type:varchar(64);not null;comment:订单编号" json:"order_no"`                   // 关联的订单编号。
+	UserID          uint64                `gorm:"not null;index;comment:用户ID" json:"user_id"`                               // 发起售后申请的用户ID，索引字段。
+	Type            AfterSalesType        `gorm:"type:tinyint;not null;comment:售后类型" json:"type"`                           // 售后类型。
+	Status          AfterSalesStatus      `gorm:"type:tinyint;not null;default:1;comment:状态" json:"status"`                 // 售后单状态，默认为待处理。
+	Reason          string                `gorm:"type:varchar(255);not null;comment:申请原因" json:"reason"`                    // 客户提交的申请原因。
+	Description     string                `gorm:"type:text;comment:详细描述" json:"description"`                                // 详细的售后描述。
+	Images          []string              `gorm:"type:json;serializer:json;comment:凭证图片" json:"images"`                     // 客户提供的凭证图片URL列表。
+	RefundAmount    int64                 `gorm:"not null;default:0;comment:退款金额(分)" json:"refund_amount"`                  // 订单中实际产生的退款金额（总额），GORM会忽略，仅在代码中记录。
+	ApprovalAmount  int64                 `gorm:"not null;default:0;comment:批准金额(分)" json:"approval_amount"`                // 实际批准的退款金额或补偿金额。
+	ApprovedBy      string                `gorm:"type:varchar(64);comment:批准人" json:"approved_by"`                          // 批准售后申请的操作人员。
+	RejectionReason string                `gorm:"type:varchar(255);comment:拒绝原因" json:"rejection_reason"`                   // 拒绝售后申请的原因。
+	ApprovedAt      *time.Time            `gorm:"comment:批准时间" json:"approved_at"`                                          // 售后申请被批准的时间。
+	RejectedAt      *time.Time            `gorm:"comment:拒绝时间" json:"rejected_at"`                                          // 售后申请被拒绝的时间。
+	CompletedAt     *time.Time            `gorm:"comment:完成时间" json:"completed_at"`                                         // 售后流程完成的时间。
+	CancelledAt     *time.Time            `gorm:"comment:取消时间" json:"cancelled_at"`                                         // 售后申请被取消的时间。
+	MerchantID      uint64                `gorm:"index;default:0;comment:商家ID" json:"merchant_id"`                          // 售后商品所属商家，用于匹配商家售后策略。
+	CategoryID      uint64                `gorm:"index;default:0;comment:类目ID" json:"category_id"`                          // 售后商品所属类目，用于匹配类目售后策略。
+	PolicyID        uint64                `gorm:"default:0;comment:命中策略ID" json:"policy_id"`                                // 创建时命中的售后策略，为 0 表示未命中。
+	DisputeReason   string                `gorm:"type:varchar(255);comment:仲裁理由" json:"dispute_reason"`                     // 用户申请平台仲裁的理由。
+	DisputedAt      *time.Time            `gorm:"comment:申请仲裁时间" json:"disputed_at"`                                        // 用户申请平台仲裁的时间。
+	ArbitratedBy    string                `gorm:"type:varchar(64);comment:仲裁人" json:"arbitrated_by"`                        // 作出裁决的平台仲裁人员。
+	ArbitratedAt    *time.Time            `gorm:"comment:裁决时间" json:"arbitrated_at"`                                        // 平台裁决时间。
+	Items           []*AfterSalesItem     `gorm:"foreignKey:AfterSalesID" json:"items"`                                     // 售后申请包含的商品列表，一对多关系。
+	Logs            []*AfterSalesLog      `gorm:"foreignKey:AfterSalesID" json:"logs"`                                      // 售后申请的操作日志列表，一对多关系。
+	Shipments       []*AfterSalesShipment `gorm:"foreignKey:AfterSalesID" json:"shipments"`                                 // 退货运单与换货补发运单。
 }
 
 // AfterSalesItem 实体代表售后申请中的一个商品项。
 type AfterSalesItem struct {
-	gorm.Model          // 嵌入gorm.Model。
-	AfterSalesID uint64 `gorm:"not null;index;comment:售后单ID" json:"after_sales_id"`          // 关联的售后单ID，索引字段。
-	ProductID    uint64 `gorm:"not null;comment:商品ID" json:"product_id"`                     // 商品ID。
-	SkuID        uint64 `gorm:"not null;comment:SKU ID" json:"sku_id"`                       // SKU ID。
-	ProductName  string `gorm:"type:varchar(255);not null;comment:商品名称" json:"product_name"` // 商品名称。
-	SkuName      string `gorm:"type:varchar(255);not null;comment:SKU名称" json:"sku_name"`    // SKU名称（例如，颜色、尺码）。
-	Quantity     int32  `gorm:"not null;comment:数量" json:"quantity"`                         // 申请售后的商品数量。
-	Price        int64  `gorm:"not null;comment:单价(分)" json:"price"`                         // 商品的单价（单位：分）。
-	TotalPrice   int64  `gorm:"not null;comment:总价(分)" json:"total_price"`                   // 商品项的总价（单价 * 数量）。
+	gorm.Model                             // 嵌入gorm.Model。
+	AfterSalesID          uint64           `gorm:"not null;index;comment:售后单ID" json:"after_sales_id"`          // 关联的售后单ID，索引字段。
+	ProductID             uint64           `gorm:"not null;comment:商品ID" json:"product_id"`                     // 商品ID。
+	SkuID                 uint64           `gorm:"not null;comment:SKU ID" json:"sku_id"`                       // SKU ID。
+	ProductName           string           `gorm:"type:varchar(255);not null;comment:商品名称" json:"product_name"` // 商品名称。
+	SkuName               string           `gorm:"type:varchar(255);not null;comment:SKU名称" json:"sku_name"`    // SKU名称（例如，颜色、尺码）。
+	Quantity              int32            `gorm:"not null;comment:数量" json:"quantity"`                         // 申请售后的商品数量。
+	Price                 int64            `gorm:"not null;comment:单价(分)" json:"price"`                         // 商品的单价（单位：分）。
+	TotalPrice            int64            `gorm:"not null;comment:总价(分)" json:"total_price"`                   // 商品项的总价（单价 * 数量）。
+	OrderItemID           uint64           `gorm:"index;comment:订单行ID" json:"order_item_id"`                    // 关联的原订单行，按行折算退款。
+	RefundAmount          int64            `gorm:"not null;default:0;comment:退款金额(分)" json:"refund_amount"`     // 按订单行实付金额折算的退款金额。
+	ExchangeSkuID         uint64           `gorm:"comment:换货SKU ID" json:"exchange_sku_id"`                     // 换货补发的 SKU，为 0 时补发原 SKU。
+	Inspection            InspectionResult `gorm:"type:varchar(16);comment:验货结论" json:"inspection"`             // 验货结论，为空表示待验货。
+	InspectionWarehouseID uint64           `gorm:"comment:入库仓库ID" json:"inspection_warehouse_id"`               // 完好商品重新入库的仓库。
+	InspectionRemark      string           `gorm:"type:varchar(255);comment:验货备注" json:"inspection_remark"`     // 验货备注，例如破损描述。
+	InspectedBy           string           `gorm:"type:varchar(64);comment:验货人" json:"inspected_by"`            // 验货的仓库人员。
+	InspectedAt           *time.Time       `gorm:"comment:验货时间" json:"inspected_at"`                            // 验货时间。
 }
 
 // AfterSalesLog 实体代表售后单的某次操作日志。
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"time"
 )
 
 // AfterSalesRepository 是售后模块的仓储接口。
@@ -22,6 +23,12 @@ type AfterSalesRepository interface {
 	Update(ctx context.Context, afterSales *AfterSales) error
 	// List 列出所有售后申请实体，支持通过查询条件进行过滤和分页。
 	List(ctx context.Context, query *AfterSalesQuery) ([]*AfterSales, int64, error)
+	// SaveItems 保存售后商品的折算金额与验货结果。Update 不会同步已有商品行的变更，需显式保存。
+	SaveItems(ctx context.Context, items []*AfterSalesItem) error
+	// SaveShipment 保存退货或换货补发运单。
+	SaveShipment(ctx context.Context, shipment *AfterSalesShipment) error
+	// ReturnedQuantities 统计订单其他有效售后单 (未拒绝、未取消) 已占用的商品数量，key 为订单行 ID。
+	ReturnedQuantities(ctx context.Context, orderID, excludeID uint64) (map[uint64]int32, error)
 
 	// --- Log methods ---
 
@@ -41,6 +48,23 @@ type AfterSalesRepository interface {
 	// --- Config methods ---
 	GetConfig(ctx context.Context, key string) (*AfterSalesConfig, error)
 	SetConfig(ctx context.Context, config *AfterSalesConfig) error
+
+	// --- SLA methods ---
+
+	// ListPolicies 列出全部售后策略。
+	ListPolicies(ctx context.Context) ([]*AfterSalesPolicy, error)
+	// GetPolicy 根据ID获取售后策略，不存在时返回 ErrPolicyNotFound。
+	GetPolicy(ctx context.Context, id uint64) (*AfterSalesPolicy, error)
+	// SavePolicy 创建或更新售后策略。
+	SavePolicy(ctx context.Context, policy *AfterSalesPolicy) error
+	// SaveDeadline 创建或更新售后时效计时器。
+	SaveDeadline(ctx context.Context, deadline *AfterSalesDeadline) error
+	// ListDeadlines 列出售后单的全部计时器。
+	ListDeadlines(ctx context.Context, afterSalesID uint64) ([]*AfterSalesDeadline, error)
+	// CancelDeadlines 取消售后单指定类型的计时中计时器，返回被取消的计时器。
+	CancelDeadlines(ctx context.Context, afterSalesID uint64, kind DeadlineKind, outcome string) ([]*AfterSalesDeadline, error)
+	// ClaimDueDeadlines 以租约方式领取已到期的计时器 (包括租约过期、持有者已宕机的计时器)。
+	ClaimDueDeadlines(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*AfterSalesDeadline, error)
 }
 
 // AfterSalesQuery 结构体定义了查询售后申请的条件。
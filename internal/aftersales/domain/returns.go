@@ -0,0 +1,234 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 退货退款相关的业务错误。
+var (
+	ErrInvalidReturnItems  = errors.New("invalid return items")                   // 售后商品与原订单不符。
+	ErrReturnQtyExceeded   = errors.New("return quantity exceeds order quantity") // 累计售后数量超过购买数量。
+	ErrInspectionRequired  = errors.New("returned items not inspected")           // 退回商品尚未完成验货。
+	ErrReturnLabelRequired = errors.New("return label not issued")                // 尚未生成退货运单。
+)
+
+// InspectionResult 定义了退回商品的验货结论。
+type InspectionResult string
+
+const (
+	InspectionPending   InspectionResult = ""          // 待验货。
+	InspectionRestocked InspectionResult = "RESTOCKED" // 完好，已重新入库。
+	InspectionDamaged   InspectionResult = "DAMAGED"   // 破损，不可再售，不入库。
+)
+
+// ShipmentDirection 定义了售后运单的方向。
+type ShipmentDirection string
+
+const (
+	ShipmentReturn      ShipmentDirection = "RETURN"      // 退货：用户寄回退货仓。
+	ShipmentReplacement ShipmentDirection = "REPLACEMENT" // 换货补发：仓库寄给用户，零价格。
+)
+
+// AfterSalesShipment 实体记录了售后产生的逆向或补发运单。
+// 运单号在调用物流服务前生成并落库，物流服务调用失败重试时沿用同一运单号，避免重复建单。
+type AfterSalesShipment struct {
+	gorm.Model
+	AfterSalesID uint64            `gorm:"not null;index;comment:售后单ID" json:"after_sales_id"`
+	Direction    ShipmentDirection `gorm:"type:varchar(16);not null;comment:运单方向" json:"direction"`
+	OrderID      uint64            `gorm:"not null;index;comment:原订单ID" json:"order_id"` // 补发运单挂在原订单下，便于用户在原订单中追踪。
+	OrderNo      string            `gorm:"type:varchar(64);not null;comment:原订单号" json:"order_no"`
+	TrackingNo   string            `gorm:"type:varchar(64);uniqueIndex;not null;comment:运单号" json:"tracking_no"`
+	Carrier      string            `gorm:"type:varchar(64);comment:承运商" json:"carrier"`
+	WarehouseID  uint64            `gorm:"comment:退货仓或发货仓ID" json:"warehouse_id"`
+	LogisticsID  uint64            `gorm:"comment:物流单ID" json:"logistics_id"`                // 为 0 表示尚未在物流服务建单。
+	Amount       int64             `gorm:"not null;default:0;comment:收费金额(分)" json:"amount"` // 换货补发为零价格。
+}
+
+// Booked 运单是否已在物流服务建单。
+func (s *AfterSalesShipment) Booked() bool {
+	return s.LogisticsID != 0
+}
+
+// OrderLine 原订单行的购买数量与实付金额，用于按行折算退款。
+type OrderLine struct {
+	OrderItemID uint64
+	ProductID   uint64
+	SkuID       uint64
+	ProductName string
+	SkuName     string
+	Price       int64
+	Quantity    int32
+	PayAmount   int64 // 订单级优惠、运费分摊后的本行实付金额。
+}
+
+// ItemInspection 仓库对单个退回商品的验货结果。
+type ItemInspection struct {
+	ItemID      uint64
+	Result      InspectionResult
+	WarehouseID uint64 // 重新入库的仓库，为 0 时使用退货仓。
+	Remark      string
+}
+
+// RequiresReturn 退货与换货需要用户寄回商品并经仓库验货。
+func (a *AfterSales) RequiresReturn() bool {
+	return a.Type == AfterSalesTypeReturnGoods || a.Type == AfterSalesTypeExchange
+}
+
+// ResolveItems 按原订单行补全售后商品信息。商品可按订单行 ID 或 SKU 指定，数量为 0 表示整行退回。
+func (a *AfterSales) ResolveItems(lines []OrderLine) error {
+	if len(a.Items) == 0 {
+		return fmt.Errorf("%w: no items", ErrInvalidReturnItems)
+	}
+	for _, item := range a.Items {
+		line, ok := findLine(lines, item)
+		if !ok {
+			return fmt.Errorf("%w: order item %d / sku %d not in order %s", ErrInvalidReturnItems, item.OrderItemID, item.SkuID, a.OrderNo)
+		}
+		if item.Quantity < 0 {
+			return fmt.Errorf("%w: negative quantity for sku %d", ErrInvalidReturnItems, line.SkuID)
+		}
+		if item.Quantity == 0 {
+			item.Quantity = line.Quantity
+		}
+		item.OrderItemID = line.OrderItemID
+		item.ProductID = line.ProductID
+		item.SkuID = line.SkuID
+		item.ProductName = line.ProductName
+		item.SkuName = line.SkuName
+		item.Price = line.Price
+		item.TotalPrice = line.Price * int64(item.Quantity)
+	}
+	return nil
+}
+
+func findLine(lines []OrderLine, item *AfterSalesItem) (OrderLine, bool) {
+	for _, line := range lines {
+		if item.OrderItemID != 0 && line.OrderItemID == item.OrderItemID {
+			return line, true
+		}
+		if item.OrderItemID == 0 && item.SkuID != 0 && line.SkuID == item.SkuID {
+			return line, true
+		}
+	}
+	return OrderLine{}, false
+}
+
+// AllocateRefund 按原订单行实付金额折算各售后商品的退款金额，并校验累计售后数量不超过购买数量。
+// returned 为该订单其他有效售后单已占用的数量 (key: 订单行 ID)。
+// 按累计数量折算：本次退款 = 实付 * (已退+本次)/购买 - 实付 * 已退/购买，整行分多次退回时合计恰为本行实付金额。
+func (a *AfterSales) AllocateRefund(lines []OrderLine, returned map[uint64]int32) (int64, error) {
+	claimed := make(map[uint64]int32, len(a.Items))
+	var total int64
+	for _, item := range a.Items {
+		line, ok := findLine(lines, item)
+		if !ok || line.Quantity <= 0 {
+			return 0, fmt.Errorf("%w: order item %d not in order %s", ErrInvalidReturnItems, item.OrderItemID, a.OrderNo)
+		}
+		before := returned[line.OrderItemID] + claimed[line.OrderItemID]
+		after := before + item.Quantity
+		if after > line.Quantity {
+			return 0, fmt.Errorf("%w: sku %d returning %d, %d of %d already claimed", ErrReturnQtyExceeded, line.SkuID, item.Quantity, before, line.Quantity)
+		}
+		claimed[line.OrderItemID] += item.Quantity
+		item.RefundAmount = line.PayAmount*int64(after)/int64(line.Quantity) - line.PayAmount*int64(before)/int64(line.Quantity)
+		total += item.RefundAmount
+	}
+	if a.Type == AfterSalesTypeExchange {
+		// 换货不退款，折算金额仅用于展示商品价值
+		a.RefundAmount = 0
+		return 0, nil
+	}
+	a.RefundAmount = total
+	return total, nil
+}
+
+// Item 按 ID 查找售后商品。
+func (a *AfterSales) Item(itemID uint64) *AfterSalesItem {
+	for _, item := range a.Items {
+		if uint64(item.ID) == itemID {
+			return item
+		}
+	}
+	return nil
+}
+
+// Inspect 记录仓库对退回商品的验货结论，已验货的商品不可重复验货。
+func (a *AfterSales) Inspect(in ItemInspection, operator string, now time.Time) (*AfterSalesItem, error) {
+	item := a.Item(in.ItemID)
+	if item == nil {
+		return nil, fmt.Errorf("%w: item %d not in after-sales %s", ErrInvalidReturnItems, in.ItemID, a.AfterSalesNo)
+	}
+	if item.Inspection != InspectionPending {
+		return nil, fmt.Errorf("%w: item %d already inspected as %s", ErrInvalidStatus, in.ItemID, item.Inspection)
+	}
+	if in.Result != InspectionRestocked && in.Result != InspectionDamaged {
+		return nil, fmt.Errorf("%w: unknown inspection result %q", ErrInvalidReturnItems, in.Result)
+	}
+	item.Inspection = in.Result
+	item.InspectionWarehouseID = in.WarehouseID
+	item.InspectionRemark = in.Remark
+	item.InspectedBy = operator
+	item.InspectedAt = &now
+	return item, nil
+}
+
+// InspectionComplete 全部退回商品是否已验货。
+func (a *AfterSales) InspectionComplete() bool {
+	for _, item := range a.Items {
+		if item.Inspection == InspectionPending {
+			return false
+		}
+	}
+	return len(a.Items) > 0
+}
+
+// Shipment 返回指定方向的售后运单。
+func (a *AfterSales) Shipment(direction ShipmentDirection) *AfterSalesShipment {
+	for _, s := range a.Shipments {
+		if s.Direction == direction {
+			return s
+		}
+	}
+	return nil
+}
+
+// ReadyForRefund 校验售后单是否可以执行退款：仅退款在批准后即可退款，退货须全部验货完成。
+func (a *AfterSales) ReadyForRefund() error {
+	switch a.Type {
+	case AfterSalesTypeRefund:
+		if a.Status != AfterSalesStatusApproved {
+			return fmt.Errorf("%w: %s", ErrInvalidStatus, a.Status)
+		}
+	case AfterSalesTypeReturnGoods:
+		if a.Status != AfterSalesStatusInProgress {
+			return fmt.Errorf("%w: %s", ErrInvalidStatus, a.Status)
+		}
+		if !a.InspectionComplete() {
+			return ErrInspectionRequired
+		}
+	default:
+		return fmt.Errorf("%w: after-sales type %d does not refund", ErrInvalidStatus, a.Type)
+	}
+	if a.ApprovalAmount <= 0 {
+		return fmt.Errorf("%w: nothing to refund", ErrInvalidStatus)
+	}
+	return nil
+}
+
+// ReadyForExchange 校验售后单是否可以补发换货商品：退回商品须全部验货完成。
+func (a *AfterSales) ReadyForExchange() error {
+	if a.Type != AfterSalesTypeExchange {
+		return fmt.Errorf("%w: after-sales type %d is not exchange", ErrInvalidStatus, a.Type)
+	}
+	if a.Status != AfterSalesStatusInProgress {
+		return fmt.Errorf("%w: %s", ErrInvalidStatus, a.Status)
+	}
+	if !a.InspectionComplete() {
+		return ErrInspectionRequired
+	}
+	return nil
+}
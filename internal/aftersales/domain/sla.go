@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SLA 与仲裁相关的业务错误。
+var (
+	ErrInvalidPolicy     = errors.New("invalid after-sales policy")   // 售后策略配置不合法。
+	ErrPolicyNotFound    = errors.New("after-sales policy not found") // 售后策略不存在。
+	ErrDisputeNotAllowed = errors.New("dispute not allowed")          // 不满足发起仲裁的条件。
+)
+
+// PolicyScope 定义了售后策略的适用范围。
+type PolicyScope string
+
+const (
+	PolicyScopePlatform PolicyScope = "PLATFORM" // 平台默认策略。
+	PolicyScopeCategory PolicyScope = "CATEGORY" // 按商品类目。
+	PolicyScopeMerchant PolicyScope = "MERCHANT" // 按商家，优先级最高。
+)
+
+// AfterSalesPolicy 实体定义了售后自动审核与时效规则。
+// 同一售后单按 商家 > 类目 > 平台 的顺序命中第一条启用的策略。
+type AfterSalesPolicy struct {
+	gorm.Model
+	Name                 string      `gorm:"type:varchar(64);uniqueIndex;not null;comment:策略名称" json:"name"`
+	Scope                PolicyScope `gorm:"type:varchar(16);not null;index:idx_policy_scope;comment:适用范围" json:"scope"`
+	ScopeID              uint64      `gorm:"not null;default:0;index:idx_policy_scope;comment:类目或商家ID" json:"scope_id"` // 平台策略为 0。
+	Enabled              bool        `gorm:"not null;default:true;comment:是否启用" json:"enabled"`
+	AutoApproveMaxAmount int64       `gorm:"not null;default:0;comment:仅退款自动批准金额上限(分)" json:"auto_approve_max_amount"` // 为 0 表示不自动批准。
+	TrustedLevel         int32       `gorm:"not null;default:0;comment:可信用户最低会员等级" json:"trusted_level"`               // 会员等级不低于该值的用户才可自动批准。
+	SellerResponseHours  int         `gorm:"not null;default:0;comment:商家响应时限(小时)" json:"seller_response_hours"`       // 超时未审核自动批准，为 0 表示不限时。
+	DisputeWindowHours   int         `gorm:"not null;default:0;comment:申请仲裁时限(小时)" json:"dispute_window_hours"`        // 被拒绝后可申请仲裁的时限，为 0 表示不限时。
+	ArbitrationHours     int         `gorm:"not null;default:0;comment:平台仲裁时限(小时)" json:"arbitration_hours"`           // 超时未裁决记为 SLA 违约，为 0 表示不限时。
+	Description          string      `gorm:"type:varchar(255);comment:描述" json:"description"`
+}
+
+// Validate 校验策略范围与时效配置。
+func (p *AfterSalesPolicy) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPolicy)
+	}
+	switch p.Scope {
+	case PolicyScopePlatform:
+		if p.ScopeID != 0 {
+			return fmt.Errorf("%w: platform policy must not have scope_id", ErrInvalidPolicy)
+		}
+	case PolicyScopeCategory, PolicyScopeMerchant:
+		if p.ScopeID == 0 {
+			return fmt.Errorf("%w: scope_id is required for %s policy", ErrInvalidPolicy, p.Scope)
+		}
+	default:
+		return fmt.Errorf("%w: unknown scope %q", ErrInvalidPolicy, p.Scope)
+	}
+	if p.AutoApproveMaxAmount < 0 || p.SellerResponseHours < 0 || p.DisputeWindowHours < 0 || p.ArbitrationHours < 0 {
+		return fmt.Errorf("%w: thresholds must not be negative", ErrInvalidPolicy)
+	}
+	return nil
+}
+
+// QualifiesAutoApprove 判断售后单是否满足即时自动批准：仅退款、金额不超过阈值且用户会员等级达到可信等级。
+func (p *AfterSalesPolicy) QualifiesAutoApprove(a *AfterSales, userLevel int32) bool {
+	if p.AutoApproveMaxAmount <= 0 || a.Type != AfterSalesTypeRefund {
+		return false
+	}
+	return a.RefundAmount > 0 && a.RefundAmount <= p.AutoApproveMaxAmount && userLevel >= p.TrustedLevel
+}
+
+// MatchPolicy 按 商家 > 类目 > 平台 的顺序选出适用的策略，未命中时返回 nil。
+func MatchPolicy(policies []*AfterSalesPolicy, merchantID, categoryID uint64) *AfterSalesPolicy {
+	var category, platform *AfterSalesPolicy
+	for _, p := range policies {
+		if !p.Enabled {
+			continue
+		}
+		switch {
+		case p.Scope == PolicyScopeMerchant && merchantID != 0 && p.ScopeID == merchantID:
+			return p
+		case p.Scope == PolicyScopeCategory && categoryID != 0 && p.ScopeID == categoryID && category == nil:
+			category = p
+		case p.Scope == PolicyScopePlatform && platform == nil:
+			platform = p
+		}
+	}
+	if category != nil {
+		return category
+	}
+	return platform
+}
+
+// DeadlineKind 定义了售后时效计时器的类型。
+type DeadlineKind string
+
+const (
+	DeadlineSellerResponse DeadlineKind = "SELLER_RESPONSE" // 商家审核时限，到期自动批准。
+	DeadlineArbitration    DeadlineKind = "ARBITRATION"     // 平台仲裁时限，到期记录 SLA 违约。
+)
+
+// DeadlineStatus 定义了计时器状态。
+type DeadlineStatus int8
+
+const (
+	DeadlinePending   DeadlineStatus = 0 // 计时中。
+	DeadlineFired     DeadlineStatus = 1 // 已到期并处理。
+	DeadlineCancelled DeadlineStatus = 2 // 在到期前已处理，计时取消。
+)
+
+// AfterSalesDeadline 实体是持久化的售后时效计时器。
+// 多副本通过租约领取到期计时器，同一计时器只会被一个副本处理。
+type AfterSalesDeadline struct {
+	gorm.Model
+	AfterSalesID uint64         `gorm:"not null;index;comment:售后单ID" json:"after_sales_id"`
+	Kind         DeadlineKind   `gorm:"type:varchar(32);not null;comment:计时类型" json:"kind"`
+	PolicyID     uint64         `gorm:"not null;default:0;comment:策略ID" json:"policy_id"`
+	DueAt        time.Time      `gorm:"not null;index:idx_deadline_status_due;comment:到期时间" json:"due_at"`
+	Status       DeadlineStatus `gorm:"type:tinyint;not null;default:0;index:idx_deadline_status_due;comment:状态" json:"status"`
+	LeaseUntil   *time.Time     `gorm:"comment:租约到期时间" json:"lease_until"`
+	ClosedAt     *time.Time     `gorm:"comment:到期处理或取消时间" json:"closed_at"`
+	Outcome      string         `gorm:"type:varchar(255);comment:处理结果" json:"outcome"`
+}
+
+// NewDeadline 创建从 now 起 hours 小时后到期的计时器。
+func NewDeadline(afterSalesID uint64, kind DeadlineKind, policyID uint64, now time.Time, hours int) *AfterSalesDeadline {
+	return &AfterSalesDeadline{
+		AfterSalesID: afterSalesID,
+		Kind:         kind,
+		PolicyID:     policyID,
+		DueAt:        now.Add(time.Duration(hours) * time.Hour),
+		Status:       DeadlinePending,
+	}
+}
+
+// Close 结束计时器并记录处理结果。
+func (d *AfterSalesDeadline) Close(status DeadlineStatus, outcome string, now time.Time) {
+	d.Status = status
+	d.Outcome = outcome
+	d.ClosedAt = &now
+	d.LeaseUntil = nil
+}
+
+// Dispute 用户对拒绝结果发起平台仲裁。每个售后单只能仲裁一次，window 为 0 表示不限时。
+func (a *AfterSales) Dispute(reason string, window time.Duration, now time.Time) error {
+	if a.Status != AfterSalesStatusRejected {
+		return fmt.Errorf("%w: status %s", ErrDisputeNotAllowed, a.Status)
+	}
+	if a.DisputedAt != nil {
+		return fmt.Errorf("%w: already arbitrated", ErrDisputeNotAllowed)
+	}
+	if window > 0 && a.RejectedAt != nil && now.Sub(*a.RejectedAt) > window {
+		return fmt.Errorf("%w: dispute window of %s expired", ErrDisputeNotAllowed, window)
+	}
+	a.Status = AfterSalesStatusArbitrating
+	a.DisputeReason = reason
+	a.DisputedAt = &now
+	return nil
+}
+
+// Arbitrate 记录平台仲裁人；裁决结果由调用方通过 Approve 或 Reject 落地。
+func (a *AfterSales) Arbitrate(arbitrator string, now time.Time) error {
+	if a.Status != AfterSalesStatusArbitrating {
+		return fmt.Errorf("%w: %s", ErrInvalidStatus, a.Status)
+	}
+	a.ArbitratedBy = arbitrator
+	a.ArbitratedAt = &now
+	return nil
+}
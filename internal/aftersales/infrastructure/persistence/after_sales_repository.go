@@ -3,10 +3,12 @@ package persistence
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/aftersales/domain"
 
 	"gorm.io/gorm" // 导入GORM ORM框架。
+	"gorm.io/gorm/clause"
 )
 
 // afterSalesRepository 是 AfterSalesRepository 接口的GORM实现。
@@ -26,21 +28,21 @@ func (r *afterSalesRepository) Create(ctx context.Context, afterSales *domain.Af
 	return r.db.WithContext(ctx).Create(afterSales).Error
 }
 
-// GetByID 根据ID从数据库获取售后申请记录，并预加载其关联的商品项和操作日志。
+// GetByID 根据ID从数据库获取售后申请记录，并预加载其关联的商品项、操作日志和售后运单。
 func (r *afterSalesRepository) GetByID(ctx context.Context, id uint64) (*domain.AfterSales, error) {
 	var afterSales domain.AfterSales
-	// 预加载 "Items" 和 "Logs" 关联数据。
-	if err := r.db.WithContext(ctx).Preload("Items").Preload("Logs").First(&afterSales, id).Error; err != nil {
+	// 预加载 "Items"、"Logs" 和 "Shipments" 关联数据。
+	if err := r.db.WithContext(ctx).Preload("Items").Preload("Logs").Preload("Shipments").First(&afterSales, id).Error; err != nil {
 		return nil, err
 	}
 	return &afterSales, nil
 }
 
-// GetByNo 根据售后单号从数据库获取售后申请记录，并预加载其关联的商品项和操作日志。
+// GetByNo 根据售后单号从数据库获取售后申请记录，并预加载其关联的商品项、操作日志和售后运单。
 func (r *afterSalesRepository) GetByNo(ctx context.Context, no string) (*domain.AfterSales, error) {
 	var afterSales domain.AfterSales
-	// 预加载 "Items" 和 "Logs" 关联数据。
-	if err := r.db.WithContext(ctx).Preload("Items").Preload("Logs").Where("after_sales_no = ?", no).First(&afterSales).Error; err != nil {
+	// 预加载 "Items"、"Logs" 和 "Shipments" 关联数据。
+	if err := r.db.WithContext(ctx).Preload("Items").Preload("Logs").Preload("Shipments").Where("after_sales_no = ?", no).First(&afterSales).Error; err != nil {
 		return nil, err
 	}
 	return &afterSales, nil
@@ -89,6 +91,45 @@ func (r *afterSalesRepository) List(ctx context.Context, query *domain.AfterSale
 	return list, total, nil
 }
 
+// SaveItems 保存售后商品行。
+func (r *afterSalesRepository) SaveItems(ctx context.Context, items []*domain.AfterSalesItem) error {
+	for _, item := range items {
+		if err := r.db.WithContext(ctx).Save(item).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveShipment 保存售后运单。
+func (r *afterSalesRepository) SaveShipment(ctx context.Context, shipment *domain.AfterSalesShipment) error {
+	return r.db.WithContext(ctx).Save(shipment).Error
+}
+
+// ReturnedQuantities 按订单行汇总订单其他有效售后单占用的商品数量。
+func (r *afterSalesRepository) ReturnedQuantities(ctx context.Context, orderID, excludeID uint64) (map[uint64]int32, error) {
+	var rows []struct {
+		OrderItemID uint64
+		Quantity    int32
+	}
+	err := r.db.WithContext(ctx).Model(&domain.AfterSalesItem{}).
+		Select("after_sales_items.order_item_id, SUM(after_sales_items.quantity) AS quantity").
+		Joins("JOIN after_sales ON after_sales.id = after_sales_items.after_sales_id AND after_sales.deleted_at IS NULL").
+		Where("after_sales.order_id = ? AND after_sales.id <> ?", orderID, excludeID).
+		Where("after_sales.status NOT IN ?", []domain.AfterSalesStatus{domain.AfterSalesStatusRejected, domain.AfterSalesStatusCancelled}).
+		Where("after_sales.type IN ?", []domain.AfterSalesType{domain.AfterSalesTypeReturnGoods, domain.AfterSalesTypeRefund, domain.AfterSalesTypeExchange}).
+		Group("after_sales_items.order_item_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint64]int32, len(rows))
+	for _, row := range rows {
+		result[row.OrderItemID] = row.Quantity
+	}
+	return result, nil
+}
+
 // CreateLog 在数据库中创建一条新的售后操作日志记录。
 func (r *afterSalesRepository) CreateLog(ctx context.Context, log *domain.AfterSalesLog) error {
 	return r.db.WithContext(ctx).Create(log).Error
@@ -197,3 +238,94 @@ func (r *afterSalesRepository) SetConfig(ctx context.Context, config *domain.Aft
 	}
 	return r.db.WithContext(ctx).Create(config).Error
 }
+
+// --- SLA methods ---
+
+// ListPolicies 列出全部售后策略。
+func (r *afterSalesRepository) ListPolicies(ctx context.Context) ([]*domain.AfterSalesPolicy, error) {
+	var list []*domain.AfterSalesPolicy
+	if err := r.db.WithContext(ctx).Order("scope, scope_id, id").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetPolicy 根据ID获取售后策略。
+func (r *afterSalesRepository) GetPolicy(ctx context.Context, id uint64) (*domain.AfterSalesPolicy, error) {
+	var policy domain.AfterSalesPolicy
+	if err := r.db.WithContext(ctx).First(&policy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrPolicyNotFound
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SavePolicy 创建或更新售后策略。
+func (r *afterSalesRepository) SavePolicy(ctx context.Context, policy *domain.AfterSalesPolicy) error {
+	return r.db.WithContext(ctx).Save(policy).Error
+}
+
+// SaveDeadline 创建或更新售后时效计时器。
+func (r *afterSalesRepository) SaveDeadline(ctx context.Context, deadline *domain.AfterSalesDeadline) error {
+	return r.db.WithContext(ctx).Save(deadline).Error
+}
+
+// ListDeadlines 列出售后单的全部计时器。
+func (r *afterSalesRepository) ListDeadlines(ctx context.Context, afterSalesID uint64) ([]*domain.AfterSalesDeadline, error) {
+	var list []*domain.AfterSalesDeadline
+	if err := r.db.WithContext(ctx).Where("after_sales_id = ?", afterSalesID).Order("due_at asc").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// CancelDeadlines 取消售后单指定类型的计时中计时器。
+func (r *afterSalesRepository) CancelDeadlines(ctx context.Context, afterSalesID uint64, kind domain.DeadlineKind, outcome string) ([]*domain.AfterSalesDeadline, error) {
+	var list []*domain.AfterSalesDeadline
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("after_sales_id = ? AND kind = ? AND status = ?", afterSalesID, kind, domain.DeadlinePending).
+			Find(&list).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, d := range list {
+			d.Close(domain.DeadlineCancelled, outcome, now)
+			if err := tx.Save(d).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return list, err
+}
+
+// ClaimDueDeadlines 以 SKIP LOCKED 方式领取已到期的计时器并设置租约，多副本之间互不重复。
+func (r *afterSalesRepository) ClaimDueDeadlines(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*domain.AfterSalesDeadline, error) {
+	var list []*domain.AfterSalesDeadline
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND due_at <= ? AND (lease_until IS NULL OR lease_until < ?)", domain.DeadlinePending, now, now).
+			Order("due_at ASC").
+			Limit(limit).
+			Find(&list).Error; err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(list))
+		for i, d := range list {
+			ids[i] = d.ID
+		}
+		leaseUntil := now.Add(lease)
+		for _, d := range list {
+			d.LeaseUntil = &leaseUntil
+		}
+		return tx.Model(&domain.AfterSalesDeadline{}).Where("id IN ?", ids).Update("lease_until", leaseUntil).Error
+	})
+	return list, err
+}
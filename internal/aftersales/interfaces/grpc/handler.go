@@ -2,6 +2,7 @@ package grpc
 
 import (
 	"context" // 导入标准错误处理包。
+	"errors"  // 导入错误判定包。
 	"fmt"     // 导入格式化包。
 
 	pb "github.com/wyfcoding/ecommerce/goapi/aftersales/v1"          // 导入售后模块的protobuf定义。
@@ -42,15 +43,19 @@ func (s *Server) CreateReturnRequest(ctx context.Context, req *pb.CreateReturnRe
 		entityType = domain.AfterSalesTypeReturnGoods // 默认处理。
 	}
 
-	// 注意：Proto请求中缺少详细的订单商品信息 (product_id, sku_id等) 和 orderNo。
-	// 当前实现传递空商品列表和 "UNKNOWN" 作为订单号。
-	// 在实际系统中，这部分信息可能需要从其他服务获取或通过更完善的Proto定义传递。
-	items := []*domain.AfterSalesItem{}
+	// 商品仅需指定订单项与数量，商品信息、订单号与退款金额由应用服务按原订单补全。
+	items := make([]*domain.AfterSalesItem, 0, len(req.Items)+1)
+	for _, spec := range req.Items {
+		items = append(items, &domain.AfterSalesItem{OrderItemID: spec.OrderItemId, Quantity: spec.Quantity, ExchangeSkuID: spec.ExchangeSkuId})
+	}
+	if len(items) == 0 && req.OrderItemId != 0 {
+		items = append(items, &domain.AfterSalesItem{OrderItemID: req.OrderItemId})
+	}
 
 	// 调用应用服务层创建售后申请。
-	as, err := s.app.CreateAfterSales(ctx, req.OrderId, "UNKNOWN", req.UserId, entityType, req.Reason, req.GetDescription(), req.ImageUrls, items)
+	as, err := s.app.CreateAfterSales(ctx, req.OrderId, "", req.UserId, req.MerchantId, entityType, req.Reason, req.GetDescription(), req.ImageUrls, items)
 	if err != nil {
-		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to create return request: %v", err))
+		return nil, returnError("failed to create return request", err)
 	}
 
 	// 将领域实体转换为protobuf响应格式。
@@ -83,7 +88,7 @@ func (s *Server) UpdateReturnRequestStatus(ctx context.Context, req *pb.UpdateRe
 		// 如果是批准操作，需要获取退款金额（Proto中以元为单位，转换为分）。
 		amount := int64(req.GetRefundAmount() * 100)
 		if err := s.app.Approve(ctx, req.Id, "admin", amount); err != nil {
-			return nil, status.Error(codes.Internal, fmt.Sprintf("failed to approve return request: %v", err))
+			return nil, returnError("failed to approve return request", err)
 		}
 	case pb.ReturnRequestStatus_RETURN_REQUEST_STATUS_REJECTED:
 		// 如果是拒绝操作，需要获取拒绝原因。
@@ -161,10 +166,68 @@ func (s *Server) ListReturnRequests(ctx context.Context, req *pb.ListReturnReque
 	}, nil
 }
 
+// IssueReturnLabel 处理生成退货运单的gRPC请求。
+func (s *Server) IssueReturnLabel(ctx context.Context, req *pb.IssueReturnLabelRequest) (*pb.ReturnRequestResponse, error) {
+	operator := req.Operator
+	if operator == "" {
+		operator = "admin"
+	}
+	as, err := s.app.IssueReturnLabel(ctx, req.ReturnRequestId, operator)
+	if err != nil {
+		return nil, returnError("failed to issue return label", err)
+	}
+	return &pb.ReturnRequestResponse{
+		Request: s.toProto(as),
+	}, nil
+}
+
+// InspectReturn 处理仓库验货的gRPC请求。
+func (s *Server) InspectReturn(ctx context.Context, req *pb.InspectReturnRequest) (*pb.ReturnRequestResponse, error) {
+	inspections := make([]domain.ItemInspection, len(req.Inspections))
+	for i, in := range req.Inspections {
+		inspections[i] = domain.ItemInspection{
+			ItemID:      in.ItemId,
+			Result:      domain.InspectionResult(in.Result),
+			WarehouseID: in.WarehouseId,
+			Remark:      in.Remark,
+		}
+	}
+	as, err := s.app.InspectReturn(ctx, req.ReturnRequestId, req.Operator, inspections)
+	if err != nil {
+		return nil, returnError("failed to inspect return", err)
+	}
+	return &pb.ReturnRequestResponse{
+		Request: s.toProto(as),
+	}, nil
+}
+
+// DisputeReturnRequest 处理用户申请平台仲裁的gRPC请求。
+func (s *Server) DisputeReturnRequest(ctx context.Context, req *pb.DisputeReturnRequestRequest) (*pb.ReturnRequestResponse, error) {
+	as, err := s.app.Dispute(ctx, req.ReturnRequestId, req.UserId, req.Reason)
+	if err != nil {
+		return nil, returnError("failed to dispute return request", err)
+	}
+	return &pb.ReturnRequestResponse{
+		Request: s.toProto(as),
+	}, nil
+}
+
+// ArbitrateReturnRequest 处理平台仲裁裁决的gRPC请求。
+func (s *Server) ArbitrateReturnRequest(ctx context.Context, req *pb.ArbitrateReturnRequestRequest) (*pb.ReturnRequestResponse, error) {
+	amount := int64(req.RefundAmount * 100) // 元转分
+	as, err := s.app.Arbitrate(ctx, req.ReturnRequestId, req.Arbitrator, req.Approve, amount, req.Remark)
+	if err != nil {
+		return nil, returnError("failed to arbitrate return request", err)
+	}
+	return &pb.ReturnRequestResponse{
+		Request: s.toProto(as),
+	}, nil
+}
+
 // ProcessRefund 处理退款流程的gRPC请求。
 func (s *Server) ProcessRefund(ctx context.Context, req *pb.ProcessRefundRequest) (*pb.RefundResponse, error) {
 	if err := s.app.ProcessRefund(ctx, req.ReturnRequestId); err != nil {
-		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to process refund: %v", err))
+		return nil, returnError("failed to process refund", err)
 	}
 	return &pb.RefundResponse{
 		ReturnRequestId: req.ReturnRequestId,
@@ -176,12 +239,19 @@ func (s *Server) ProcessRefund(ctx context.Context, req *pb.ProcessRefundRequest
 // ProcessExchange 处理换货流程的gRPC请求。
 func (s *Server) ProcessExchange(ctx context.Context, req *pb.ProcessExchangeRequest) (*pb.ExchangeResponse, error) {
 	if err := s.app.ProcessExchange(ctx, req.ReturnRequestId); err != nil {
-		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to process exchange: %v", err))
+		return nil, returnError("failed to process exchange", err)
 	}
-	return &pb.ExchangeResponse{
+	resp := &pb.ExchangeResponse{
 		ReturnRequestId: req.ReturnRequestId,
 		Status:          "SUCCESS",
-	}, nil
+	}
+	if as, err := s.app.GetDetails(ctx, req.ReturnRequestId); err == nil {
+		if shipment := as.Shipment(domain.ShipmentReplacement); shipment != nil {
+			resp.TrackingNo = shipment.TrackingNo
+			resp.NewOrderId = shipment.OrderID // 补发运单挂在原订单下
+		}
+	}
+	return resp, nil
 }
 
 // --- 客服工单方法 ---
@@ -404,11 +474,21 @@ func (s *Server) toProto(as *domain.AfterSales) *pb.ReturnRequest {
 		status = pb.ReturnRequestStatus_RETURN_REQUEST_STATUS_APPROVED
 	case domain.AfterSalesStatusRejected:
 		status = pb.ReturnRequestStatus_RETURN_REQUEST_STATUS_REJECTED
+	case domain.AfterSalesStatusInProgress:
+		// 退货运单已生成，验货完成前视为用户寄回中。
+		status = pb.ReturnRequestStatus_RETURN_REQUEST_STATUS_SHIPPED_BACK
+		if as.InspectionComplete() {
+			status = pb.ReturnRequestStatus_RETURN_REQUEST_STATUS_RECEIVED
+		}
 	case domain.AfterSalesStatusCompleted:
-		// 注意：Proto中没有Completed，这里映射到REFUNDED，可能需要调整。
 		status = pb.ReturnRequestStatus_RETURN_REQUEST_STATUS_REFUNDED
+		if as.Type == domain.AfterSalesTypeExchange {
+			status = pb.ReturnRequestStatus_RETURN_REQUEST_STATUS_EXCHANGED
+		}
 	case domain.AfterSalesStatusCancelled:
 		status = pb.ReturnRequestStatus_RETURN_REQUEST_STATUS_CLOSED
+	case domain.AfterSalesStatusArbitrating:
+		status = pb.ReturnRequestStatus_RETURN_REQUEST_STATUS_ARBITRATING
 	default:
 		status = pb.ReturnRequestStatus_RETURN_REQUEST_STATUS_UNSPECIFIED
 	}
@@ -426,7 +506,21 @@ func (s *Server) toProto(as *domain.AfterSales) *pb.ReturnRequest {
 		rType = pb.ReturnRequestType_RETURN_REQUEST_TYPE_UNSPECIFIED
 	}
 
-	return &pb.ReturnRequest{
+	items := make([]*pb.ReturnRequestItem, len(as.Items))
+	for i, item := range as.Items {
+		items[i] = &pb.ReturnRequestItem{
+			Id:            uint64(item.ID),
+			OrderItemId:   item.OrderItemID,
+			SkuId:         item.SkuID,
+			ProductName:   item.ProductName,
+			Quantity:      item.Quantity,
+			RefundAmount:  float64(item.RefundAmount) / 100.0,
+			ExchangeSkuId: item.ExchangeSkuID,
+			Inspection:    string(item.Inspection),
+		}
+	}
+
+	pbReq := &pb.ReturnRequest{
 		Id:           uint64(as.ID),                    // 售后申请ID。
 		UserId:       as.UserID,                        // 用户ID。
 		OrderId:      as.OrderID,                       // 订单ID。
@@ -438,7 +532,27 @@ func (s *Server) toProto(as *domain.AfterSales) *pb.ReturnRequest {
 		RefundAmount: float64(as.RefundAmount) / 100.0, // 退款金额（分转元）。
 		CreatedAt:    timestamppb.New(as.CreatedAt),    // 创建时间。
 		UpdatedAt:    timestamppb.New(as.UpdatedAt),    // 更新时间。
-		// Proto中还包含一些其他字段如 AdminNote, TrackingNumber 等，但实体中没有对应，此处未映射。
+		Items:        items,                            // 售后商品明细。
+	}
+	if len(as.Items) == 1 {
+		pbReq.OrderItemId = as.Items[0].OrderItemID
+	}
+	if shipment := as.Shipment(domain.ShipmentReturn); shipment != nil {
+		pbReq.TrackingNumber = shipment.TrackingNo // 退货运单号。
+	}
+	return pbReq
+}
+
+// returnError 将售后业务错误映射为 gRPC 状态码。
+func returnError(msg string, err error) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidReturnItems), errors.Is(err, domain.ErrReturnQtyExceeded), errors.Is(err, domain.ErrInvalidPolicy):
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("%s: %v", msg, err))
+	case errors.Is(err, domain.ErrInvalidStatus), errors.Is(err, domain.ErrInspectionRequired), errors.Is(err, domain.ErrReturnLabelRequired),
+		errors.Is(err, domain.ErrDisputeNotAllowed):
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("%s: %v", msg, err))
+	default:
+		return status.Error(codes.Internal, fmt.Sprintf("%s: %v", msg, err))
 	}
 }
 
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
@@ -27,8 +28,9 @@ func NewHandler(service *application.AfterSalesService, logger *slog.Logger) *Ha
 func (h *Handler) Create(c *gin.Context) {
 	var req struct {
 		OrderID     uint64                   `json:"order_id" binding:"required"`
-		OrderNo     string                   `json:"order_no" binding:"required"`
+		OrderNo     string                   `json:"order_no"`
 		UserID      uint64                   `json:"user_id" binding:"required"`
+		MerchantID  uint64                   `json:"merchant_id"`
 		Type        domain.AfterSalesType    `json:"type" binding:"required"`
 		Reason      string                   `json:"reason" binding:"required"`
 		Description string                   `json:"description"`
@@ -41,10 +43,10 @@ func (h *Handler) Create(c *gin.Context) {
 		return
 	}
 
-	afterSales, err := h.service.CreateAfterSales(c.Request.Context(), req.OrderID, req.OrderNo, req.UserID, req.Type, req.Reason, req.Description, req.Images, req.Items)
+	afterSales, err := h.service.CreateAfterSales(c.Request.Context(), req.OrderID, req.OrderNo, req.UserID, req.MerchantID, req.Type, req.Reason, req.Description, req.Images, req.Items)
 	if err != nil {
 		h.logger.ErrorContext(c.Request.Context(), "Failed to create after-sales", "error", err)
-		response.ErrorWithStatus(c, http.StatusInternalServerError, err.Error(), "")
+		response.ErrorWithStatus(c, errorStatus(err), err.Error(), "")
 		return
 	}
 
@@ -60,7 +62,7 @@ func (h *Handler) Approve(c *gin.Context) {
 
 	var req struct {
 		Operator string `json:"operator" binding:"required"`
-		Amount   int64  `json:"amount" binding:"required"`
+		Amount   int64  `json:"amount"` // 为 0 时按订单实付折算金额批准
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -70,7 +72,7 @@ func (h *Handler) Approve(c *gin.Context) {
 
 	if err := h.service.Approve(c.Request.Context(), id, req.Operator, req.Amount); err != nil {
 		h.logger.ErrorContext(c.Request.Context(), "Failed to approve after-sales", "id", id, "error", err)
-		response.ErrorWithStatus(c, http.StatusInternalServerError, err.Error(), "")
+		response.ErrorWithStatus(c, errorStatus(err), err.Error(), "")
 		return
 	}
 
@@ -103,6 +105,242 @@ func (h *Handler) Reject(c *gin.Context) {
 	response.Success(c, nil)
 }
 
+// IssueReturnLabel 生成退货运单，用于物流服务故障后重试。
+func (h *Handler) IssueReturnLabel(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid aftersales ID", "")
+		return
+	}
+
+	var req struct {
+		Operator string `json:"operator" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid input", "")
+		return
+	}
+
+	afterSales, err := h.service.IssueReturnLabel(c.Request.Context(), id, req.Operator)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to issue return label", "id", id, "error", err)
+		response.ErrorWithStatus(c, errorStatus(err), err.Error(), "")
+		return
+	}
+
+	response.Success(c, afterSales)
+}
+
+// Inspect 仓库验货：完好商品重新入库，破损商品仅记录。
+func (h *Handler) Inspect(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid aftersales ID", "")
+		return
+	}
+
+	var req struct {
+		Operator string `json:"operator" binding:"required"`
+		Items    []struct {
+			ItemID      uint64                  `json:"item_id" binding:"required"`
+			Result      domain.InspectionResult `json:"result" binding:"required"`
+			WarehouseID uint64                  `json:"warehouse_id"`
+			Remark      string                  `json:"remark"`
+		} `json:"items" binding:"required,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid input: "+err.Error(), "")
+		return
+	}
+
+	inspections := make([]domain.ItemInspection, len(req.Items))
+	for i, item := range req.Items {
+		inspections[i] = domain.ItemInspection{
+			ItemID:      item.ItemID,
+			Result:      item.Result,
+			WarehouseID: item.WarehouseID,
+			Remark:      item.Remark,
+		}
+	}
+
+	afterSales, err := h.service.InspectReturn(c.Request.Context(), id, req.Operator, inspections)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to inspect return", "id", id, "error", err)
+		response.ErrorWithStatus(c, errorStatus(err), err.Error(), "")
+		return
+	}
+
+	response.Success(c, afterSales)
+}
+
+// ProcessRefund 发起退款 Saga。
+func (h *Handler) ProcessRefund(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid aftersales ID", "")
+		return
+	}
+
+	if err := h.service.ProcessRefund(c.Request.Context(), id); err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to process refund", "id", id, "error", err)
+		response.ErrorWithStatus(c, errorStatus(err), err.Error(), "")
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// ProcessExchange 出库换货商品并创建补发运单。
+func (h *Handler) ProcessExchange(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid aftersales ID", "")
+		return
+	}
+
+	if err := h.service.ProcessExchange(c.Request.Context(), id); err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to process exchange", "id", id, "error", err)
+		response.ErrorWithStatus(c, errorStatus(err), err.Error(), "")
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// Dispute 用户对拒绝结果申请平台仲裁。
+func (h *Handler) Dispute(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid aftersales ID", "")
+		return
+	}
+
+	var req struct {
+		UserID uint64 `json:"user_id" binding:"required"`
+		Reason string `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid input", "")
+		return
+	}
+
+	afterSales, err := h.service.Dispute(c.Request.Context(), id, req.UserID, req.Reason)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to dispute after-sales", "id", id, "error", err)
+		response.ErrorWithStatus(c, errorStatus(err), err.Error(), "")
+		return
+	}
+
+	response.Success(c, afterSales)
+}
+
+// Arbitrate 平台对仲裁中的售后单作出裁决。
+func (h *Handler) Arbitrate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid aftersales ID", "")
+		return
+	}
+
+	var req struct {
+		Arbitrator string `json:"arbitrator" binding:"required"`
+		Approve    bool   `json:"approve"`
+		Amount     int64  `json:"amount"` // 支持用户时的批准金额，为 0 时按订单实付折算金额
+		Remark     string `json:"remark" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid input", "")
+		return
+	}
+
+	afterSales, err := h.service.Arbitrate(c.Request.Context(), id, req.Arbitrator, req.Approve, req.Amount, req.Remark)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to arbitrate after-sales", "id", id, "error", err)
+		response.ErrorWithStatus(c, errorStatus(err), err.Error(), "")
+		return
+	}
+
+	response.Success(c, afterSales)
+}
+
+// ListDeadlines 查询售后单的时效计时器。
+func (h *Handler) ListDeadlines(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid aftersales ID", "")
+		return
+	}
+
+	list, err := h.service.ListDeadlines(c.Request.Context(), id)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to list after-sales deadlines", "id", id, "error", err)
+		response.ErrorWithStatus(c, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	response.Success(c, list)
+}
+
+// ListPolicies 查询全部售后策略。
+func (h *Handler) ListPolicies(c *gin.Context) {
+	list, err := h.service.ListPolicies(c.Request.Context())
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to list after-sales policies", "error", err)
+		response.ErrorWithStatus(c, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	response.Success(c, list)
+}
+
+// SavePolicy 创建或更新售后策略 (请求体带 ID 时为更新)。
+func (h *Handler) SavePolicy(c *gin.Context) {
+	var req struct {
+		ID                   uint               `json:"id"`
+		Name                 string             `json:"name" binding:"required"`
+		Scope                domain.PolicyScope `json:"scope" binding:"required"`
+		ScopeID              uint64             `json:"scope_id"`
+		Enabled              bool               `json:"enabled"`
+		AutoApproveMaxAmount int64              `json:"auto_approve_max_amount"`
+		TrustedLevel         int32              `json:"trusted_level"`
+		SellerResponseHours  int                `json:"seller_response_hours"`
+		DisputeWindowHours   int                `json:"dispute_window_hours"`
+		ArbitrationHours     int                `json:"arbitration_hours"`
+		Description          string             `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid input: "+err.Error(), "")
+		return
+	}
+
+	policy := &domain.AfterSalesPolicy{
+		Name:                 req.Name,
+		Scope:                req.Scope,
+		ScopeID:              req.ScopeID,
+		Enabled:              req.Enabled,
+		AutoApproveMaxAmount: req.AutoApproveMaxAmount,
+		TrustedLevel:         req.TrustedLevel,
+		SellerResponseHours:  req.SellerResponseHours,
+		DisputeWindowHours:   req.DisputeWindowHours,
+		ArbitrationHours:     req.ArbitrationHours,
+		Description:          req.Description,
+	}
+	policy.ID = req.ID
+
+	if err := h.service.SavePolicy(c.Request.Context(), policy); err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to save after-sales policy", "name", req.Name, "error", err)
+		response.ErrorWithStatus(c, errorStatus(err), err.Error(), "")
+		return
+	}
+
+	response.Success(c, policy)
+}
+
 func (h *Handler) List(c *gin.Context) {
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
 	if err != nil {
@@ -166,8 +404,32 @@ func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 	{
 		group.POST("", h.Create)
 		group.GET("", h.List)
+		group.GET("/policies", h.ListPolicies)
+		group.POST("/policies", h.SavePolicy)
 		group.GET("/:id", h.GetDetails)
+		group.GET("/:id/deadlines", h.ListDeadlines)
 		group.POST("/:id/approve", h.Approve)
 		group.POST("/:id/reject", h.Reject)
+		group.POST("/:id/return-label", h.IssueReturnLabel)
+		group.POST("/:id/inspect", h.Inspect)
+		group.POST("/:id/refund", h.ProcessRefund)
+		group.POST("/:id/exchange", h.ProcessExchange)
+		group.POST("/:id/dispute", h.Dispute)
+		group.POST("/:id/arbitrate", h.Arbitrate)
+	}
+}
+
+// errorStatus 将售后业务错误映射为 HTTP 状态码。
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrInvalidReturnItems), errors.Is(err, domain.ErrReturnQtyExceeded), errors.Is(err, domain.ErrInvalidPolicy):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrPolicyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidStatus), errors.Is(err, domain.ErrInspectionRequired), errors.Is(err, domain.ErrReturnLabelRequired),
+		errors.Is(err, domain.ErrDisputeNotAllowed):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
 	}
 }
@@ -2,10 +2,10 @@ package application
 
 import (
 	"context"
+	"time"
 
-	"github.com/wyfcoding/ecommerce/internal/inventory/domain"
 	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
-	"github.com/wyfcoding/pkg/algorithm"
+	"github.com/wyfcoding/ecommerce/internal/inventory/domain"
 )
 
 // Inventory 是库存应用服务的门面。
@@ -31,39 +31,54 @@ func (s *Inventory) CreateInventory(ctx context.Context, skuID, productID, wareh
 	return s.Manager.CreateInventory(ctx, skuID, productID, warehouseID, totalStock, warningThreshold)
 }
 
-// DeleteInventory 删除库存记录。
-func (s *Inventory) DeleteInventory(ctx context.Context, skuID uint64) error {
-	return s.Manager.DeleteInventory(ctx, skuID)
+// DeleteInventory 删除指定仓库的库存记录。
+func (s *Inventory) DeleteInventory(ctx context.Context, skuID, warehouseID uint64) error {
+	return s.Manager.DeleteInventory(ctx, skuID, warehouseID)
 }
 
-// GetInventory 获取库存详情。
-func (s *Inventory) GetInventory(ctx context.Context, skuID uint64) (*domain.Inventory, error) {
-	return s.Query.GetInventory(ctx, skuID)
+// GetInventory 获取库存详情。warehouseID 为 0 时返回跨仓汇总及各仓明细。
+func (s *Inventory) GetInventory(ctx context.Context, skuID, warehouseID uint64) (*domain.Inventory, []*domain.Inventory, error) {
+	return s.Query.GetInventory(ctx, skuID, warehouseID)
 }
 
 // AddStock 增加库存。
-func (s *Inventory) AddStock(ctx context.Context, skuID uint64, quantity int32, reason string) error {
-	return s.Manager.AddStock(ctx, skuID, quantity, reason)
+func (s *Inventory) AddStock(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo, reason string) error {
+	return s.Manager.AddStock(ctx, skuID, warehouseID, quantity, orderNo, reason)
 }
 
 // DeductStock 扣减库存（直接扣减）。
-func (s *Inventory) DeductStock(ctx context.Context, skuID uint64, quantity int32, reason string) error {
-	return s.Manager.DeductStock(ctx, skuID, quantity, reason)
+func (s *Inventory) DeductStock(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo, reason string) error {
+	return s.Manager.DeductStock(ctx, skuID, warehouseID, quantity, orderNo, reason)
 }
 
-// LockStock 锁定库存。
-func (s *Inventory) LockStock(ctx context.Context, skuID uint64, quantity int32, reason string) error {
-	return s.Manager.LockStock(ctx, skuID, quantity, reason)
+// RevertStock 回补订单直接扣减的库存（DeductStock 的补偿）。
+func (s *Inventory) RevertStock(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo, reason string) error {
+	return s.Manager.RevertStock(ctx, skuID, warehouseID, quantity, orderNo, reason)
+}
+
+// LockStock 为订单锁定库存，返回预占记录。
+func (s *Inventory) LockStock(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo string, ttl time.Duration, reason string) (*domain.Reservation, error) {
+	return s.Manager.LockStock(ctx, skuID, warehouseID, quantity, orderNo, ttl, reason)
+}
+
+// ConfirmReservation 确认预占。
+func (s *Inventory) ConfirmReservation(ctx context.Context, reservationID, reason string) (*domain.Reservation, error) {
+	return s.Manager.ConfirmReservation(ctx, reservationID, reason)
+}
+
+// ReleaseReservation 释放预占。
+func (s *Inventory) ReleaseReservation(ctx context.Context, reservationID, reason string) (*domain.Reservation, error) {
+	return s.Manager.ReleaseReservation(ctx, reservationID, reason)
 }
 
 // UnlockStock 解锁库存。
-func (s *Inventory) UnlockStock(ctx context.Context, skuID uint64, quantity int32, reason string) error {
-	return s.Manager.UnlockStock(ctx, skuID, quantity, reason)
+func (s *Inventory) UnlockStock(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo, reason string) error {
+	return s.Manager.UnlockStock(ctx, skuID, warehouseID, quantity, orderNo, reason)
 }
 
 // ConfirmDeduction 确认扣减（将锁定库存转为已扣减）。
-func (s *Inventory) ConfirmDeduction(ctx context.Context, skuID uint64, quantity int32, reason string) error {
-	return s.Manager.ConfirmDeduction(ctx, skuID, quantity, reason)
+func (s *Inventory) ConfirmDeduction(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo, reason string) error {
+	return s.Manager.ConfirmDeduction(ctx, skuID, warehouseID, quantity, orderNo, reason)
 }
 
 // ListInventories 获取库存列表。
@@ -76,7 +91,7 @@ func (s *Inventory) GetInventoryLogs(ctx context.Context, skuID uint64, inventor
 	return s.Query.GetInventoryLogs(ctx, skuID, inventoryID, page, pageSize)
 }
 
-// AllocateStock 为订单分配库存。
-func (s *Inventory) AllocateStock(ctx context.Context, userLat, userLon float64, items []algorithm.OrderItem) ([]algorithm.AllocationResult, error) {
+// AllocateStock 为订单行选择发货仓库。
+func (s *Inventory) AllocateStock(ctx context.Context, userLat, userLon float64, items map[uint64]int32) ([]domain.FulfillmentPlan, error) {
 	return s.Manager.AllocateStock(ctx, userLat, userLon, items)
-}
\ No newline at end of file
+}
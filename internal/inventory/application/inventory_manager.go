@@ -5,19 +5,32 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
-	"github.com/wyfcoding/ecommerce/internal/inventory/domain"
 	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
+	"github.com/wyfcoding/ecommerce/internal/inventory/domain"
 	"github.com/wyfcoding/pkg/algorithm"
+	"github.com/wyfcoding/pkg/idgen"
+)
+
+var (
+	// ErrWarehouseRequired 库存按 (SKU, 仓库) 维护，写操作必须指定仓库。
+	ErrWarehouseRequired = errors.New("warehouse_id is required")
+	// ErrInventoryNotFound 指定仓库中不存在该SKU的库存记录。
+	ErrInventoryNotFound = errors.New("inventory not found")
+	// ErrOrderNoRequired 锁定库存必须关联订单号，用于生成预占记录。
+	ErrOrderNoRequired = errors.New("order_no is required")
+	// ErrQuantityMismatch 补偿或确认的数量与订单原操作记录的数量不一致。
+	ErrQuantityMismatch = errors.New("quantity does not match original operation")
 )
 
 // InventoryManager 处理库存的写操作（增删改、锁定、分配）。
 type InventoryManager struct {
 	repo           domain.InventoryRepository
 	warehouseRepo  domain.WarehouseRepository
-	allocator      *algorithm.WarehouseAllocator
+	optimizer      *domain.FulfillmentOptimizer
 	logger         *slog.Logger
 	soldOutFilter  *algorithm.CuckooFilter
 	filterMu       sync.RWMutex
@@ -29,7 +42,7 @@ func NewInventoryManager(repo domain.InventoryRepository, warehouseRepo domain.W
 	return &InventoryManager{
 		repo:          repo,
 		warehouseRepo: warehouseRepo,
-		allocator:     algorithm.NewWarehouseAllocator(),
+		optimizer:     &domain.FulfillmentOptimizer{},
 		logger:        logger,
 		soldOutFilter: algorithm.NewCuckooFilter(100000),
 	}
@@ -47,13 +60,17 @@ func (m *InventoryManager) IsSoldOutQuickCheck(skuID uint64) bool {
 }
 
 // CreateInventory 创建一个新的库存记录。
+// 同一SKU可以在多个仓库分别建立库存，但每个仓库只能有一条记录。
 func (m *InventoryManager) CreateInventory(ctx context.Context, skuID, productID, warehouseID uint64, totalStock, warningThreshold int32) (*domain.Inventory, error) {
-	existing, err := m.repo.GetBySkuID(ctx, skuID)
+	if warehouseID == 0 {
+		return nil, ErrWarehouseRequired
+	}
+	existing, err := m.repo.GetBySkuAndWarehouse(ctx, skuID, warehouseID)
 	if err != nil {
 		return nil, err
 	}
 	if existing != nil {
-		return nil, errors.New("inventory already exists for this SKU")
+		return nil, errors.New("inventory already exists for this SKU in the warehouse")
 	}
 
 	inventory := domain.NewInventory(skuID, productID, warehouseID, totalStock, warningThreshold)
@@ -61,97 +78,203 @@ func (m *InventoryManager) CreateInventory(ctx context.Context, skuID, productID
 		m.logger.ErrorContext(ctx, "failed to save inventory", "sku_id", skuID, "error", err)
 		return nil, err
 	}
-	m.logger.InfoContext(ctx, "inventory created successfully", "inventory_id", inventory.ID, "sku_id", skuID)
+	if totalStock > 0 {
+		m.markInStock(skuID)
+	}
+	m.logger.InfoContext(ctx, "inventory created successfully", "inventory_id", inventory.ID, "sku_id", skuID, "warehouse_id", warehouseID)
 	return inventory, nil
 }
 
-// DeleteInventory 删除库存记录。
-func (m *InventoryManager) DeleteInventory(ctx context.Context, skuID uint64) error {
-	if err := m.repo.Delete(ctx, skuID); err != nil {
-		m.logger.ErrorContext(ctx, "failed to delete inventory", "sku_id", skuID, "error", err)
+// DeleteInventory 删除指定仓库的库存记录。
+func (m *InventoryManager) DeleteInventory(ctx context.Context, skuID, warehouseID uint64) error {
+	if warehouseID == 0 {
+		return ErrWarehouseRequired
+	}
+	if err := m.repo.Delete(ctx, skuID, warehouseID); err != nil {
+		m.logger.ErrorContext(ctx, "failed to delete inventory", "sku_id", skuID, "warehouse_id", warehouseID, "error", err)
 		return err
 	}
-	m.logger.InfoContext(ctx, "inventory deleted successfully", "sku_id", skuID)
+	m.refreshSoldOut(ctx, skuID)
+	m.logger.InfoContext(ctx, "inventory deleted successfully", "sku_id", skuID, "warehouse_id", warehouseID)
 	return nil
 }
 
 // executeWithRetry 执行带乐观锁重试的库存更新逻辑
-func (m *InventoryManager) executeWithRetry(ctx context.Context, skuID uint64, fn func(*domain.Inventory) (*domain.InventoryLog, error)) error {
+// 库存、预占记录与库存日志在同一分片事务内提交；fn 通过 tx 访问事务内的仓储。
+// orderNo 非空时以 (订单号, SKU, 仓库, action) 作为幂等键写入日志：
+//   - 重复请求不再执行 fn，直接返回首次执行的日志；
+//   - 补偿动作先于正向动作到达时记录空补偿，之后到达的正向动作返回 domain.ErrAlreadyCompensated。
+func (m *InventoryManager) executeWithRetry(ctx context.Context, skuID, warehouseID uint64, orderNo, action string, fn func(tx domain.InventoryRepository, inv *domain.Inventory) (*domain.InventoryLog, error)) (*domain.InventoryLog, error) {
+	if warehouseID == 0 {
+		return nil, ErrWarehouseRequired
+	}
+	key := domain.IdempotencyKey(orderNo, skuID, warehouseID, action)
+	forwardKey := ""
+	if forward, ok := domain.CompensatedAction(action); ok {
+		forwardKey = domain.IdempotencyKey(orderNo, skuID, warehouseID, forward)
+	}
+
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		inventory, err := m.repo.GetBySkuID(ctx, skuID)
-		if err != nil {
-			return err
-		}
-		if inventory == nil {
-			return errors.New("inventory not found")
-		}
+		var result *domain.InventoryLog
+		err := m.repo.Transaction(ctx, skuID, func(tx any) error {
+			txRepo := m.repo.WithTx(tx)
+			inventory, err := txRepo.GetBySkuAndWarehouse(ctx, skuID, warehouseID)
+			if err != nil {
+				return err
+			}
+			if inventory == nil {
+				return ErrInventoryNotFound
+			}
 
-		// 执行业务逻辑
-		log, err := fn(inventory)
-		if err != nil {
-			return err
-		}
+			if key != "" {
+				prev, err := m.findProcessed(ctx, txRepo, skuID, key, forwardKey)
+				if err != nil {
+					return err
+				}
+				if prev != nil {
+					result = prev
+					return nil
+				}
+				if forwardKey != "" {
+					forward, err := txRepo.GetLogByIdempotencyKey(ctx, skuID, forwardKey)
+					if err != nil {
+						return err
+					}
+					if forward == nil {
+						// 空补偿：正向动作尚未执行，占住其幂等键防止悬挂
+						result = inventory.NewNullCompensationLog(forwardKey, fmt.Sprintf("%s arrived before %s", key, forwardKey))
+						return txRepo.SaveLog(ctx, result)
+					}
+				}
+			}
 
-		// 尝试保存（带版本检查）
-		err = m.repo.SaveWithOptimisticLock(ctx, inventory)
-		if err == nil {
+			// 执行业务逻辑
+			log, err := fn(txRepo, inventory)
+			if err != nil {
+				return err
+			}
+
+			// 尝试保存（带版本检查）
+			if err := txRepo.SaveWithOptimisticLock(ctx, inventory); err != nil {
+				return err
+			}
 			// 保存成功，记录日志
 			if log != nil {
-				if logErr := m.repo.SaveLog(ctx, log); logErr != nil {
-					m.logger.WarnContext(ctx, "failed to save inventory log", "log", log, "error", logErr)
-				}
+				log.SetIdempotencyKey(key)
+				result = log
+				return txRepo.SaveLog(ctx, log)
 			}
 			return nil
+		})
+		if err == nil {
+			return m.checkReplay(ctx, result, key, forwardKey)
+		}
+
+		// 并发的重复请求先一步提交时，本次事务因幂等键唯一索引冲突而失败
+		if key != "" {
+			if prev, getErr := m.findProcessed(ctx, m.repo, skuID, key, forwardKey); getErr == nil && prev != nil {
+				return m.checkReplay(ctx, prev, key, forwardKey)
+			}
 		}
 
 		// 如果不是乐观锁失败，直接返回错误
 		if err.Error() != "optimistic lock failed" {
-			return err
+			return nil, err
 		}
 
 		// 乐观锁失败，等待后重试
 		time.Sleep(time.Millisecond * time.Duration(10*(i+1)))
 	}
-	return errors.New("concurrent update failed after retries")
+	return nil, errors.New("concurrent update failed after retries")
 }
 
-// AddStock 增加库存。
-func (m *InventoryManager) AddStock(ctx context.Context, skuID uint64, quantity int32, reason string) error {
-	return m.executeWithRetry(ctx, skuID, func(inv *domain.Inventory) (*domain.InventoryLog, error) {
-		log, err := inv.Add(quantity, reason)
-		if err != nil {
-			return nil, err
-		}
+// findProcessed 查找幂等键已生效的记录：本动作此前写下的日志，或补偿动作此前写下的空补偿日志。
+func (m *InventoryManager) findProcessed(ctx context.Context, repo domain.InventoryRepository, skuID uint64, key, forwardKey string) (*domain.InventoryLog, error) {
+	prev, err := repo.GetLogByIdempotencyKey(ctx, skuID, key)
+	if err != nil || prev != nil {
+		return prev, err
+	}
+	if forwardKey == "" {
+		return nil, nil
+	}
+	forward, err := repo.GetLogByIdempotencyKey(ctx, skuID, forwardKey)
+	if err != nil {
+		return nil, err
+	}
+	if forward != nil && forward.IsNullCompensation() {
+		return forward, nil
+	}
+	return nil, nil
+}
 
-		// 如果库存不再为0，从售罄过滤器中移除
-		if inv.AvailableStock > 0 {
-			m.filterMu.Lock()
-			m.soldOutFilter.Delete([]byte(fmt.Sprintf("%d", skuID)))
-			m.filterMu.Unlock()
-		}
+// checkReplay 校验事务结果：正向动作命中空补偿日志说明其补偿已先执行，返回 domain.ErrAlreadyCompensated。
+func (m *InventoryManager) checkReplay(ctx context.Context, log *domain.InventoryLog, key, forwardKey string) (*domain.InventoryLog, error) {
+	if log == nil || key == "" {
 		return log, nil
+	}
+	if log.IsNullCompensation() {
+		if forwardKey == "" {
+			m.logger.WarnContext(ctx, "action rejected, compensation already applied", "idempotency_key", key)
+			return nil, domain.ErrAlreadyCompensated
+		}
+		m.logger.InfoContext(ctx, "null compensation recorded", "idempotency_key", key, "forward_key", forwardKey)
+	}
+	return log, nil
+}
+
+// markInStock 将SKU从售罄过滤器中移除。
+func (m *InventoryManager) markInStock(skuID uint64) {
+	m.filterMu.Lock()
+	m.soldOutFilter.Delete([]byte(fmt.Sprintf("%d", skuID)))
+	m.filterMu.Unlock()
+}
+
+// refreshSoldOut 汇总SKU在所有仓库的可用库存，全部为0时才加入售罄过滤器。
+func (m *InventoryManager) refreshSoldOut(ctx context.Context, skuID uint64) {
+	list, err := m.repo.ListBySkuID(ctx, skuID)
+	if err != nil {
+		m.logger.WarnContext(ctx, "failed to refresh sold out state", "sku_id", skuID, "error", err)
+		return
+	}
+	sum := domain.SumInventories(list)
+	if sum != nil && sum.AvailableStock > 0 {
+		m.markInStock(skuID)
+		return
+	}
+	m.filterMu.Lock()
+	if !m.soldOutFilter.Contains([]byte(fmt.Sprintf("%d", skuID))) {
+		m.soldOutFilter.Add([]byte(fmt.Sprintf("%d", skuID)))
+	}
+	m.filterMu.Unlock()
+}
+
+// AddStock 增加指定仓库的库存。orderNo 为关联单号 (如采购单)，非空时按单号幂等。
+func (m *InventoryManager) AddStock(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo, reason string) error {
+	_, err := m.executeWithRetry(ctx, skuID, warehouseID, orderNo, domain.IdemActionAdd, func(_ domain.InventoryRepository, inv *domain.Inventory) (*domain.InventoryLog, error) {
+		return inv.Add(quantity, reason)
 	})
+	if err != nil {
+		return err
+	}
+	// 任一仓库有货即不再售罄
+	m.markInStock(skuID)
+	return nil
 }
 
-// DeductStock 扣减库存。
-func (m *InventoryManager) DeductStock(ctx context.Context, skuID uint64, quantity int32, reason string) error {
-	return m.executeWithRetry(ctx, skuID, func(inv *domain.Inventory) (*domain.InventoryLog, error) {
+// DeductStock 扣减指定仓库的库存。orderNo 非空时按订单幂等，重复请求不会重复扣减。
+func (m *InventoryManager) DeductStock(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo, reason string) error {
+	depleted := false
+	_, err := m.executeWithRetry(ctx, skuID, warehouseID, orderNo, domain.IdemActionDeduct, func(_ domain.InventoryRepository, inv *domain.Inventory) (*domain.InventoryLog, error) {
 		log, err := inv.Deduct(quantity, reason)
 		if err != nil {
 			return nil, err
 		}
-
-		// 如果库存归零，加入售罄过滤器
-		if inv.AvailableStock <= 0 {
-			m.filterMu.Lock()
-			m.soldOutFilter.Add([]byte(fmt.Sprintf("%d", skuID)))
-			m.filterMu.Unlock()
-		}
+		depleted = inv.AvailableStock <= 0
 
 		// --- 架构增强：自动补货触发 (Cross-Project Interaction) ---
 		if inv.AvailableStock < inv.WarningThreshold && m.remoteOrderCli != nil {
-			m.logger.InfoContext(ctx, "low stock detected, triggering institutional replenishment", "sku_id", skuID, "stock", inv.AvailableStock)
+			m.logger.InfoContext(ctx, "low stock detected, triggering institutional replenishment", "sku_id", skuID, "warehouse_id", warehouseID, "stock", inv.AvailableStock)
 
 			// 真实化逻辑：根据预警阈值动态计算补货量
 			replenishQty := int32(inv.WarningThreshold * 2)
@@ -174,7 +297,7 @@ func (m *InventoryManager) DeductStock(ctx context.Context, skuID uint64, quanti
 							Quantity:  replenishQty,
 						},
 					},
-					Remark: fmt.Sprintf("Auto-replenishment for low stock SKU %d", inv.SkuID),
+					Remark: fmt.Sprintf("Auto-replenishment for low stock SKU %d in warehouse %d", inv.SkuID, inv.WarehouseID),
 				})
 				if err != nil {
 					m.logger.Error("failed to place replenishment order", "sku_id", skuID, "error", err)
@@ -186,120 +309,373 @@ func (m *InventoryManager) DeductStock(ctx context.Context, skuID uint64, quanti
 
 		return log, nil
 	})
+	if err != nil {
+		return err
+	}
+	// 当前仓库归零时，再确认其余仓库是否也已售罄
+	if depleted {
+		m.refreshSoldOut(ctx, skuID)
+	}
+	return nil
+}
+
+// RevertStock 回补订单直接扣减的库存，作为 DeductStock 的补偿。
+// 订单尚未扣减时记录空补偿，之后到达的同一订单扣减请求将被拒绝；
+// 回补数量必须与原扣减日志一致，否则返回 ErrQuantityMismatch，避免错误的补偿请求凭空增加库存。
+func (m *InventoryManager) RevertStock(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo, reason string) error {
+	if orderNo == "" {
+		return ErrOrderNoRequired
+	}
+	deductKey := domain.IdempotencyKey(orderNo, skuID, warehouseID, domain.IdemActionDeduct)
+	log, err := m.executeWithRetry(ctx, skuID, warehouseID, orderNo, domain.IdemActionRevert, func(tx domain.InventoryRepository, inv *domain.Inventory) (*domain.InventoryLog, error) {
+		deducted, err := tx.GetLogByIdempotencyKey(ctx, skuID, deductKey)
+		if err != nil {
+			return nil, err
+		}
+		if deducted != nil && -deducted.ChangeQuantity != quantity {
+			return nil, fmt.Errorf("%w: order %s deducted %d, revert %d", ErrQuantityMismatch, orderNo, -deducted.ChangeQuantity, quantity)
+		}
+		log, err := inv.Add(quantity, reason)
+		if err != nil {
+			return nil, err
+		}
+		log.Action = "Revert"
+		return log, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !log.IsNullCompensation() {
+		m.markInStock(skuID)
+	}
+	return nil
+}
+
+// LockStock 为订单锁定指定仓库的库存，返回预占记录。
+// 同一订单在同一 (SKU, 仓库) 上重复锁定时直接返回已有预占，不会重复占用库存；
+// 该订单的解锁补偿已先执行时返回 domain.ErrAlreadyCompensated。
+func (m *InventoryManager) LockStock(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo string, ttl time.Duration, reason string) (*domain.Reservation, error) {
+	if orderNo == "" {
+		return nil, ErrOrderNoRequired
+	}
+	existing, err := m.repo.GetReservationByOrder(ctx, orderNo, skuID, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return m.reuseReservation(existing, quantity)
+	}
+
+	var reservation *domain.Reservation
+	log, err := m.executeWithRetry(ctx, skuID, warehouseID, orderNo, domain.IdemActionLock, func(tx domain.InventoryRepository, inv *domain.Inventory) (*domain.InventoryLog, error) {
+		log, err := inv.Lock(quantity, reason)
+		if err != nil {
+			return nil, err
+		}
+		reservation = domain.NewReservation(domain.NewReservationID(skuID, idgen.GenID()), orderNo, inv, quantity, ttl, reason, time.Now())
+		if err := tx.SaveReservation(ctx, reservation); err != nil {
+			return nil, err
+		}
+		log.ReservationID = reservation.ReservationID
+		return log, nil
+	})
+	if errors.Is(err, domain.ErrAlreadyCompensated) {
+		return nil, err
+	}
+	if err != nil {
+		// 并发的重复请求可能已先一步创建了预占 (唯一索引冲突)
+		if existing, getErr := m.repo.GetReservationByOrder(ctx, orderNo, skuID, warehouseID); getErr == nil && existing != nil {
+			return m.reuseReservation(existing, quantity)
+		}
+		return nil, err
+	}
+	if reservation == nil || log.ReservationID != reservation.ReservationID {
+		// 幂等键命中 (本次未实际锁定)：按首次锁定日志找回预占
+		existing, err := m.repo.GetReservation(ctx, log.ReservationID)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			return nil, domain.ErrReservationNotFound
+		}
+		return m.reuseReservation(existing, quantity)
+	}
+	m.logger.InfoContext(ctx, "stock reserved", "reservation_id", reservation.ReservationID, "order_no", orderNo, "sku_id", skuID, "warehouse_id", warehouseID, "quantity", quantity, "expires_at", reservation.ExpiresAt)
+	return reservation, nil
+}
+
+// reuseReservation 处理重复锁定请求：数量一致时返回已有预占。
+func (m *InventoryManager) reuseReservation(existing *domain.Reservation, quantity int32) (*domain.Reservation, error) {
+	if existing.Quantity != quantity {
+		return nil, fmt.Errorf("reservation %s already holds %d units, requested %d", existing.ReservationID, existing.Quantity, quantity)
+	}
+	return existing, nil
 }
 
-// LockStock 锁定库存。
-func (m *InventoryManager) LockStock(ctx context.Context, skuID uint64, quantity int32, reason string) error {
-	return m.executeWithRetry(ctx, skuID, func(inv *domain.Inventory) (*domain.InventoryLog, error) {
-		return inv.Lock(quantity, reason)
+// ConfirmReservation 确认预占，将锁定库存转为实际扣减。重复确认直接返回成功。
+func (m *InventoryManager) ConfirmReservation(ctx context.Context, reservationID, reason string) (*domain.Reservation, error) {
+	return m.closeReservation(ctx, reservationID, func(r *domain.Reservation, inv *domain.Inventory, now time.Time) (*domain.InventoryLog, error) {
+		return r.Confirm(inv, reason, now)
+	}, domain.ReservationConfirmed)
+}
+
+// ReleaseReservation 释放预占，将锁定库存归还。重复释放或已过期释放的预占直接返回成功。
+func (m *InventoryManager) ReleaseReservation(ctx context.Context, reservationID, reason string) (*domain.Reservation, error) {
+	res, err := m.closeReservation(ctx, reservationID, func(r *domain.Reservation, inv *domain.Inventory, now time.Time) (*domain.InventoryLog, error) {
+		return r.Release(inv, reason, now)
+	}, domain.ReservationReleased, domain.ReservationExpired)
+	if err == nil {
+		m.markInStock(res.SkuID)
+	}
+	return res, err
+}
+
+// ExpireReservation 释放已过期的预占，由清理任务调用。
+func (m *InventoryManager) ExpireReservation(ctx context.Context, reservationID string) (*domain.Reservation, error) {
+	res, err := m.closeReservation(ctx, reservationID, func(r *domain.Reservation, inv *domain.Inventory, now time.Time) (*domain.InventoryLog, error) {
+		return r.Expire(inv, now)
+	}, domain.ReservationExpired, domain.ReservationReleased)
+	if err == nil {
+		m.markInStock(res.SkuID)
+	}
+	return res, err
+}
+
+// closeReservation 在库存事务内将预占切换到终态。
+// 预占状态以 CAS 更新，并发的确认/释放只有一个生效；预占已处于 done 中任一状态时视为幂等成功。
+func (m *InventoryManager) closeReservation(ctx context.Context, reservationID string, apply func(*domain.Reservation, *domain.Inventory, time.Time) (*domain.InventoryLog, error), done ...domain.ReservationStatus) (*domain.Reservation, error) {
+	isDone := func(r *domain.Reservation) bool {
+		return slices.Contains(done, r.Status)
+	}
+
+	res, err := m.repo.GetReservation(ctx, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, domain.ErrReservationNotFound
+	}
+	if isDone(res) {
+		return res, nil
+	}
+
+	_, err = m.executeWithRetry(ctx, res.SkuID, res.WarehouseID, "", "", func(tx domain.InventoryRepository, inv *domain.Inventory) (*domain.InventoryLog, error) {
+		current, err := tx.GetReservation(ctx, reservationID)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return nil, domain.ErrReservationNotFound
+		}
+		log, err := apply(current, inv, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		ok, err := tx.UpdateReservationStatus(ctx, current, domain.ReservationReserved)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, domain.ErrReservationClosed
+		}
+		res = current
+		return log, nil
 	})
+	if errors.Is(err, domain.ErrReservationClosed) {
+		// 并发请求已先一步关闭预占，终态一致即视为成功
+		if latest, getErr := m.repo.GetReservation(ctx, reservationID); getErr == nil && latest != nil && isDone(latest) {
+			return latest, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.logger.InfoContext(ctx, "reservation closed", "reservation_id", reservationID, "order_no", res.OrderNo, "status", res.Status.String())
+	return res, nil
 }
 
-// UnlockStock 解锁库存。
-func (m *InventoryManager) UnlockStock(ctx context.Context, skuID uint64, quantity int32, reason string) error {
-	return m.executeWithRetry(ctx, skuID, func(inv *domain.Inventory) (*domain.InventoryLog, error) {
+// UnlockStock 解锁指定仓库的库存。
+// orderNo 非空时作为 LockStock 的补偿：订单已有预占则释放预占，尚未锁定则记录空补偿。
+func (m *InventoryManager) UnlockStock(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo, reason string) error {
+	if orderNo != "" {
+		res, err := m.repo.GetReservationByOrder(ctx, orderNo, skuID, warehouseID)
+		if err != nil {
+			return err
+		}
+		if res != nil {
+			_, err := m.ReleaseReservation(ctx, res.ReservationID, reason)
+			return err
+		}
+	}
+	_, err := m.executeWithRetry(ctx, skuID, warehouseID, orderNo, domain.IdemActionUnlock, func(_ domain.InventoryRepository, inv *domain.Inventory) (*domain.InventoryLog, error) {
 		return inv.Unlock(quantity, reason)
 	})
+	return err
 }
 
 // HandleOrderTimeout 处理订单支付超时，自动释放库存。
+// 以预占状态为准：已确认 (已支付) 的预占不会被释放，已释放或已过期的预占重复处理不产生副作用，
+// 因此无需再回查订单服务。
 func (m *InventoryManager) HandleOrderTimeout(ctx context.Context, event map[string]any) error {
-	orderID := uint64(event["order_id"].(float64))
-	userID := uint64(event["user_id"].(float64))
-	items := event["items"].([]any)
+	orderNo, _ := event["order_no"].(string)
+	// allocations 记录了下单时每个 SKU 在哪个仓库锁定了多少库存以及对应的预占ID
+	allocations, _ := event["allocations"].([]any)
 
-	m.logger.InfoContext(ctx, "checking order timeout for stock release", "order_id", orderID)
+	if len(allocations) == 0 {
+		m.logger.ErrorContext(ctx, "timeout event carries no warehouse allocations, skipping stock release", "order_no", orderNo)
+		return nil
+	}
 
-	// 1. 调用 Order Service 检查当前状态
-	if m.remoteOrderCli != nil {
-		resp, err := m.remoteOrderCli.GetOrderByID(ctx, &orderv1.GetOrderByIDRequest{
-			Id:     orderID,
-			UserId: userID,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to check order status for ID %d: %w", orderID, err)
+	// 按预占逐项释放库存 (补偿 LockStock)
+	var firstErr error
+	for _, it := range allocations {
+		itemMap := it.(map[string]any)
+		reservationID, _ := itemMap["reservation_id"].(string)
+		if reservationID == "" {
+			skuID := uint64(itemMap["sku_id"].(float64))
+			warehouseID := uint64(itemMap["warehouse_id"].(float64))
+			res, err := m.repo.GetReservationByOrder(ctx, orderNo, skuID, warehouseID)
+			if err != nil {
+				return err
+			}
+			if res == nil {
+				m.logger.WarnContext(ctx, "no reservation found for timeout order", "order_no", orderNo, "sku_id", skuID, "warehouse_id", warehouseID)
+				continue
+			}
+			reservationID = res.ReservationID
 		}
 
-		// 只有当确定支付成功（PAID 及之后状态）时，才跳过释放。
-		// 如果订单还在 ALLOCATING (正在分配) 或 PENDING_PAYMENT (待支付)，则超时释放。
-		if resp.Status == orderv1.OrderStatus_PAID || 
-		   resp.Status == orderv1.OrderStatus_SHIPPED || 
-		   resp.Status == orderv1.OrderStatus_DELIVERED || 
-		   resp.Status == orderv1.OrderStatus_COMPLETED {
-			m.logger.InfoContext(ctx, "order already paid or processed, skipping stock release", "order_id", orderID, "status", resp.Status)
-			return nil
+		m.logger.InfoContext(ctx, "auto-releasing reservation for timeout", "order_no", orderNo, "reservation_id", reservationID)
+		_, err := m.ReleaseReservation(ctx, reservationID, fmt.Sprintf("Auto-release for timeout order %s", orderNo))
+		switch {
+		case err == nil:
+		case errors.Is(err, domain.ErrReservationClosed):
+			m.logger.InfoContext(ctx, "reservation already confirmed, skipping stock release", "order_no", orderNo, "reservation_id", reservationID)
+		default:
+			m.logger.ErrorContext(ctx, "failed to auto-release reservation", "order_no", orderNo, "reservation_id", reservationID, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
 		}
-		
-		m.logger.WarnContext(ctx, "order unpaid or stuck, proceeding with stock release", "order_id", orderID, "status", resp.Status)
 	}
 
-	// 2. 逐项释放库存 (补偿 LockStock)
-	for _, it := range items {
-		itemMap := it.(map[string]any)
-		skuID := uint64(itemMap["sku_id"].(float64))
-		qty := int32(itemMap["quantity"].(float64))
+	return firstErr
+}
 
-		m.logger.InfoContext(ctx, "auto-unlocking stock for timeout", "order_id", orderID, "sku_id", skuID, "qty", qty)
-		if err := m.UnlockStock(ctx, skuID, qty, fmt.Sprintf("Auto-release for timeout order %d", orderID)); err != nil {
-			m.logger.ErrorContext(ctx, "failed to auto-unlock stock", "sku_id", skuID, "error", err)
+// HandleOrderPaid 处理订单支付成功事件，确认订单的全部库存预占。
+// 事件由订单服务在支付状态变更的同一事务内登记，确认按预占状态 CAS 幂等，重复投递不产生副作用。
+// 预占在确认前已被清理任务过期释放时，按订单幂等地从可用库存重新扣减，保证已支付订单不会丢失库存。
+func (m *InventoryManager) HandleOrderPaid(ctx context.Context, event map[string]any) error {
+	orderNo, _ := event["order_no"].(string)
+	reservationIDs, _ := event["reservation_ids"].([]any)
+
+	var firstErr error
+	for _, v := range reservationIDs {
+		reservationID, _ := v.(string)
+		if reservationID == "" {
+			continue
+		}
+		_, err := m.ConfirmReservation(ctx, reservationID, fmt.Sprintf("Order paid %s", orderNo))
+		if errors.Is(err, domain.ErrReservationClosed) {
+			err = m.redeductExpired(ctx, orderNo, reservationID)
+		}
+		if err == nil {
+			continue
+		}
+		m.logger.ErrorContext(ctx, "failed to confirm reservation for paid order", "order_no", orderNo, "reservation_id", reservationID, "error", err)
+		// 预占已被主动释放或库存已不足以重新扣减时重试无意义，记录错误交由人工处理
+		if errors.Is(err, domain.ErrReservationClosed) || errors.Is(err, domain.ErrInsufficientStock) {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
 		}
 	}
+	return firstErr
+}
 
-	return nil
+// redeductExpired 为已支付订单重新扣减已过期预占对应的库存。
+func (m *InventoryManager) redeductExpired(ctx context.Context, orderNo, reservationID string) error {
+	res, err := m.repo.GetReservation(ctx, reservationID)
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		return domain.ErrReservationNotFound
+	}
+	if res.Status != domain.ReservationExpired {
+		return fmt.Errorf("%w: paid order %s, status=%s", domain.ErrReservationClosed, orderNo, res.Status)
+	}
+	m.logger.WarnContext(ctx, "reservation expired before payment confirmed, deducting stock again", "order_no", orderNo, "reservation_id", reservationID, "quantity", res.Quantity)
+	return m.DeductStock(ctx, res.SkuID, res.WarehouseID, res.Quantity, orderNo, fmt.Sprintf("Re-deduct expired reservation %s for paid order %s", reservationID, orderNo))
 }
 
-// ConfirmDeduction 确认扣减。
-func (m *InventoryManager) ConfirmDeduction(ctx context.Context, skuID uint64, quantity int32, reason string) error {
-	return m.executeWithRetry(ctx, skuID, func(inv *domain.Inventory) (*domain.InventoryLog, error) {
+// ConfirmDeduction 确认扣减指定仓库的锁定库存。orderNo 非空时按订单幂等。
+// 订单已有预占时经预占确认，与 UnlockStock 经预占释放对称，确认后预占关闭，不会再被清理任务过期释放；
+// 确认数量必须与预占数量一致，否则返回 ErrQuantityMismatch。
+func (m *InventoryManager) ConfirmDeduction(ctx context.Context, skuID, warehouseID uint64, quantity int32, orderNo, reason string) error {
+	if orderNo != "" {
+		res, err := m.repo.GetReservationByOrder(ctx, orderNo, skuID, warehouseID)
+		if err != nil {
+			return err
+		}
+		if res != nil {
+			if res.Quantity != quantity {
+				return fmt.Errorf("%w: reservation %s holds %d, confirm %d", ErrQuantityMismatch, res.ReservationID, res.Quantity, quantity)
+			}
+			_, err := m.ConfirmReservation(ctx, res.ReservationID, reason)
+			return err
+		}
+	}
+	_, err := m.executeWithRetry(ctx, skuID, warehouseID, orderNo, domain.IdemActionConfirm, func(_ domain.InventoryRepository, inv *domain.Inventory) (*domain.InventoryLog, error) {
 		return inv.ConfirmDeduction(quantity, reason)
 	})
+	return err
 }
 
-// AllocateStock 分配库存。
-func (m *InventoryManager) AllocateStock(ctx context.Context, userLat, userLon float64, items []algorithm.OrderItem) ([]algorithm.AllocationResult, error) {
+// AllocateStock 为订单行选择发货仓库。
+// items 为 SKU ID 到需求数量的映射；任一 SKU 的全部仓库库存之和不足时返回 domain.ErrInsufficientStock。
+func (m *InventoryManager) AllocateStock(ctx context.Context, userLat, userLon float64, items map[uint64]int32) ([]domain.FulfillmentPlan, error) {
 	warehouses, err := m.warehouseRepo.ListAll(ctx)
 	if err != nil {
 		return nil, err
 	}
+	warehouseMap := make(map[uint64]*domain.Warehouse, len(warehouses))
+	for _, w := range warehouses {
+		warehouseMap[uint64(w.ID)] = w
+	}
 
-	skuIDs := make([]uint64, len(items))
-	for i, item := range items {
-		skuIDs[i] = item.SkuID
+	skuIDs := make([]uint64, 0, len(items))
+	for skuID := range items {
+		skuIDs = append(skuIDs, skuID)
 	}
 	inventories, err := m.repo.GetBySkuIDs(ctx, skuIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	warehouseMap := make(map[uint64]map[uint64]*algorithm.WarehouseInfo)
-	findWarehouse := func(id uint64) *domain.Warehouse {
-		for _, w := range warehouses {
-			if w.ID == uint(id) {
-				return w
-			}
-		}
-		return nil
-	}
-
+	stocks := make([]*domain.WarehouseStock, 0, len(inventories))
 	for _, inv := range inventories {
-		w := findWarehouse(inv.WarehouseID)
-		if w == nil {
+		w, ok := warehouseMap[inv.WarehouseID]
+		if !ok {
+			// 未登记坐标的仓库无法参与就近分配
 			continue
 		}
-
-		if _, exists := warehouseMap[inv.WarehouseID]; !exists {
-			warehouseMap[inv.WarehouseID] = make(map[uint64]*algorithm.WarehouseInfo)
-		}
-
-		warehouseMap[inv.WarehouseID][inv.SkuID] = &algorithm.WarehouseInfo{
-			ID:       uint64(w.ID),
-			Lat:      w.Lat,
-			Lon:      w.Lon,
-			Stock:    inv.AvailableStock,
-			Priority: w.Priority,
-			ShipCost: w.ShipCost,
-		}
+		stocks = append(stocks, &domain.WarehouseStock{
+			WarehouseID: inv.WarehouseID,
+			SKUID:       inv.SkuID,
+			Available:   inv.AvailableStock,
+			LocationLat: w.Lat,
+			LocationLon: w.Lon,
+			Priority:    w.Priority,
+			BaseCost:    w.ShipCost,
+		})
 	}
 
-	return m.allocator.AllocateOptimal(userLat, userLon, items, warehouseMap), nil
+	plans, err := m.optimizer.Optimize(ctx, items, userLat, userLon, stocks)
+	if err != nil {
+		m.logger.WarnContext(ctx, "failed to allocate stock", "error", err)
+		return nil, err
+	}
+	return plans, nil
 }
@@ -24,8 +24,20 @@ func NewInventoryQuery(repo domain.InventoryRepository, warehouseRepo domain.War
 }
 
 // GetInventory 获取指定SKU的库存记录。
-func (q *InventoryQuery) GetInventory(ctx context.Context, skuID uint64) (*domain.Inventory, error) {
-	return q.repo.GetBySkuID(ctx, skuID)
+// warehouseID 非 0 时返回该仓库的库存；为 0 时返回跨仓汇总视图及各仓明细，SKU 不存在时均为 nil。
+func (q *InventoryQuery) GetInventory(ctx context.Context, skuID, warehouseID uint64) (*domain.Inventory, []*domain.Inventory, error) {
+	if warehouseID != 0 {
+		inv, err := q.repo.GetBySkuAndWarehouse(ctx, skuID, warehouseID)
+		if err != nil || inv == nil {
+			return nil, nil, err
+		}
+		return inv, []*domain.Inventory{inv}, nil
+	}
+	list, err := q.repo.ListBySkuID(ctx, skuID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return domain.SumInventories(list), list, nil
 }
 
 // ListInventories 获取库存列表。
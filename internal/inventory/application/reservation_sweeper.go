@@ -0,0 +1,79 @@
+package application
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/inventory/domain"
+)
+
+// ReservationSweeper 定期释放已过期的库存预占。
+// 释放以预占状态 CAS 完成，多副本同时扫描时同一预占也只会被释放一次。
+type ReservationSweeper struct {
+	repo      domain.InventoryRepository
+	manager   *InventoryManager
+	logger    *slog.Logger
+	interval  time.Duration
+	batchSize int
+	stopChan  chan struct{}
+}
+
+// NewReservationSweeper 创建过期预占清理任务。
+func NewReservationSweeper(repo domain.InventoryRepository, manager *InventoryManager, logger *slog.Logger) *ReservationSweeper {
+	return &ReservationSweeper{
+		repo:      repo,
+		manager:   manager,
+		logger:    logger.With("module", "reservation_sweeper"),
+		interval:  10 * time.Second,
+		batchSize: 200,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Start 启动清理循环。
+func (s *ReservationSweeper) Start() {
+	s.logger.Info("reservation sweeper started", "interval", s.interval)
+	ticker := time.NewTicker(s.interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				s.sweep()
+			case <-s.stopChan:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止清理循环。
+func (s *ReservationSweeper) Stop() {
+	close(s.stopChan)
+	s.logger.Info("reservation sweeper stopped")
+}
+
+// sweep 释放一批已过期的预占。
+func (s *ReservationSweeper) sweep() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval*3)
+	defer cancel()
+
+	expired, err := s.repo.ListExpiredReservations(ctx, time.Now(), s.batchSize)
+	if err != nil {
+		s.logger.Error("failed to list expired reservations", "error", err)
+		return
+	}
+
+	released := 0
+	for _, r := range expired {
+		if _, err := s.manager.ExpireReservation(ctx, r.ReservationID); err != nil {
+			s.logger.Error("failed to release expired reservation", "reservation_id", r.ReservationID, "order_no", r.OrderNo, "error", err)
+			continue
+		}
+		released++
+	}
+	if released > 0 {
+		s.logger.Info("expired reservations released", "count", released)
+	}
+}
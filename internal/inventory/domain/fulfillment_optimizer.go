@@ -2,11 +2,16 @@ package domain
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"sort"
 
 	"github.com/shopspring/decimal"
 )
 
+// earthRadiusKm 地球平均半径（公里），用于球面距离计算。
+const earthRadiusKm = 6371.0
+
 // WarehouseStock 仓库库存信息
 type WarehouseStock struct {
 	WarehouseID uint64
@@ -14,6 +19,8 @@ type WarehouseStock struct {
 	Available   int32
 	LocationLat float64
 	LocationLon float64
+	Priority    int   // 仓库优先级，距离相同时数值越大越优先
+	BaseCost    int64 // 仓库单次发货基础费用（分）
 }
 
 // FulfillmentPlan 履约计划
@@ -21,34 +28,79 @@ type FulfillmentPlan struct {
 	SKUID       uint64
 	WarehouseID uint64
 	Quantity    int32
-	ShipCost    decimal.Decimal
+	Distance    float64         // 仓库到收货地址的距离（公里）
+	ShipCost    decimal.Decimal // 预估运费（元）
 }
 
 // FulfillmentOptimizer 履约优化器
-type FulfillmentOptimizer struct{}
+type FulfillmentOptimizer struct {
+	// CostPerKm 每公里运费（元），为零时使用默认值 0.5。
+	CostPerKm decimal.Decimal
+}
 
 // Optimize 寻找最优发货仓库组合
+// 每个 SKU 优先选择能够整单满足的最近仓库，避免拆包；没有单仓能满足时按距离由近到远拆分。
+// 任一 SKU 所有仓库库存之和不足时返回 ErrInsufficientStock，不返回部分计划。
 func (o *FulfillmentOptimizer) Optimize(ctx context.Context, orderItems map[uint64]int32, userLat, userLon float64, stocks []*WarehouseStock) ([]FulfillmentPlan, error) {
-	plans := make([]FulfillmentPlan, 0)
+	plans := make([]FulfillmentPlan, 0, len(orderItems))
 
-	for skuID, neededQty := range orderItems {
-		remaining := neededQty
+	// 按 SKU 排序保证结果稳定
+	skuIDs := make([]uint64, 0, len(orderItems))
+	for skuID := range orderItems {
+		skuIDs = append(skuIDs, skuID)
+	}
+	sort.Slice(skuIDs, func(i, j int) bool { return skuIDs[i] < skuIDs[j] })
 
-		// 1. 过滤出有该SKU的仓库并按距离排序
-		type candidate struct {
-			ws   *WarehouseStock
-			dist float64
+	type candidate struct {
+		ws   *WarehouseStock
+		dist float64
+	}
+
+	for _, skuID := range skuIDs {
+		neededQty := orderItems[skuID]
+		if neededQty <= 0 {
+			return nil, ErrNegativeQuantity
 		}
+
+		// 1. 过滤出有该SKU的仓库并按距离排序
 		var candidates []candidate
+		var totalAvailable int32
 		for _, s := range stocks {
 			if s.SKUID == skuID && s.Available > 0 {
 				dist := o.calculateDistance(userLat, userLon, s.LocationLat, s.LocationLon)
 				candidates = append(candidates, candidate{s, dist})
+				totalAvailable += s.Available
 			}
 		}
+		if totalAvailable < neededQty {
+			return nil, fmt.Errorf("%w: sku=%d available=%d, required=%d", ErrInsufficientStock, skuID, totalAvailable, neededQty)
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].dist != candidates[j].dist {
+				return candidates[i].dist < candidates[j].dist
+			}
+			if candidates[i].ws.Priority != candidates[j].ws.Priority {
+				return candidates[i].ws.Priority > candidates[j].ws.Priority
+			}
+			return candidates[i].ws.WarehouseID < candidates[j].ws.WarehouseID
+		})
 
-		// 2. 贪心策略：优先从最近的仓库发货 (Nearest Neighbor)
+		// 2. 单仓整单满足：取最近的一个
+		single := false
+		for _, cand := range candidates {
+			if cand.ws.Available >= neededQty {
+				plans = append(plans, o.newPlan(skuID, cand.ws, neededQty, cand.dist))
+				single = true
+				break
+			}
+		}
+		if single {
+			continue
+		}
+
+		// 3. 贪心策略：从最近的仓库开始拆分发货 (Nearest Neighbor)
 		// 进阶算法：使用最小费用最大流模型解决跨单合并最优解
+		remaining := neededQty
 		for _, cand := range candidates {
 			if remaining <= 0 {
 				break
@@ -59,24 +111,36 @@ func (o *FulfillmentOptimizer) Optimize(ctx context.Context, orderItems map[uint
 				shipQty = remaining
 			}
 
-			plans = append(plans, FulfillmentPlan{
-				SKUID:       skuID,
-				WarehouseID: cand.ws.WarehouseID,
-				Quantity:    shipQty,
-				ShipCost:    decimal.NewFromFloat(cand.dist * 0.5), // 假设每公里 0.5 元
-			})
+			plans = append(plans, o.newPlan(skuID, cand.ws, shipQty, cand.dist))
 			remaining -= shipQty
 		}
-
-		if remaining > 0 {
-			// 库存不足异常处理
-		}
 	}
 
 	return plans, nil
 }
 
+// newPlan 生成单条履约计划并估算运费：基础费用 + 距离 * 每公里费用。
+func (o *FulfillmentOptimizer) newPlan(skuID uint64, ws *WarehouseStock, qty int32, dist float64) FulfillmentPlan {
+	perKm := o.CostPerKm
+	if perKm.IsZero() {
+		perKm = decimal.NewFromFloat(0.5) // 默认每公里 0.5 元
+	}
+	cost := decimal.New(ws.BaseCost, -2).Add(perKm.Mul(decimal.NewFromFloat(dist))).Round(2)
+	return FulfillmentPlan{
+		SKUID:       skuID,
+		WarehouseID: ws.WarehouseID,
+		Quantity:    qty,
+		Distance:    dist,
+		ShipCost:    cost,
+	}
+}
+
+// calculateDistance 使用 Haversine 公式计算两点间的球面距离（公里）。
 func (o *FulfillmentOptimizer) calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	// 简化计算：欧几里得距离 (实际应使用球面距离)
-	return math.Sqrt(math.Pow(lat1-lat2, 2) + math.Pow(lon1-lon2, 2))
+	toRad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
 }
@@ -0,0 +1,167 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestFulfillmentOptimizerOptimize(t *testing.T) {
+	// 收货地址位于上海，仓库按距离由近到远：上海(1) < 杭州(2) < 北京(3)
+	const userLat, userLon = 31.23, 121.47
+	shanghai := func(sku uint64, qty int32) *WarehouseStock {
+		return &WarehouseStock{WarehouseID: 1, SKUID: sku, Available: qty, LocationLat: 31.23, LocationLon: 121.47}
+	}
+	hangzhou := func(sku uint64, qty int32) *WarehouseStock {
+		return &WarehouseStock{WarehouseID: 2, SKUID: sku, Available: qty, LocationLat: 30.27, LocationLon: 120.15}
+	}
+	beijing := func(sku uint64, qty int32) *WarehouseStock {
+		return &WarehouseStock{WarehouseID: 3, SKUID: sku, Available: qty, LocationLat: 39.90, LocationLon: 116.40}
+	}
+
+	type split struct {
+		sku       uint64
+		warehouse uint64
+		qty       int32
+	}
+	tests := []struct {
+		name    string
+		items   map[uint64]int32
+		stocks  []*WarehouseStock
+		want    []split
+		wantErr error
+	}{
+		{
+			name:   "nearest warehouse fulfils whole sku",
+			items:  map[uint64]int32{100: 5},
+			stocks: []*WarehouseStock{beijing(100, 10), hangzhou(100, 10), shanghai(100, 10)},
+			want:   []split{{100, 1, 5}},
+		},
+		{
+			name:   "prefers farther single warehouse over splitting",
+			items:  map[uint64]int32{100: 8},
+			stocks: []*WarehouseStock{shanghai(100, 3), hangzhou(100, 5), beijing(100, 20)},
+			want:   []split{{100, 3, 8}},
+		},
+		{
+			name:   "splits nearest first when no single warehouse suffices",
+			items:  map[uint64]int32{100: 9},
+			stocks: []*WarehouseStock{beijing(100, 4), shanghai(100, 3), hangzhou(100, 4)},
+			want:   []split{{100, 1, 3}, {100, 2, 4}, {100, 3, 2}},
+		},
+		{
+			name:   "skus planned independently in id order",
+			items:  map[uint64]int32{200: 2, 100: 1},
+			stocks: []*WarehouseStock{hangzhou(200, 5), shanghai(100, 1), shanghai(200, 1)},
+			want:   []split{{100, 1, 1}, {200, 2, 2}},
+		},
+		{
+			name:   "ignores warehouses without stock",
+			items:  map[uint64]int32{100: 2},
+			stocks: []*WarehouseStock{shanghai(100, 0), hangzhou(100, 2)},
+			want:   []split{{100, 2, 2}},
+		},
+		{
+			name:    "insufficient total stock returns no partial plan",
+			items:   map[uint64]int32{100: 1, 200: 7},
+			stocks:  []*WarehouseStock{shanghai(100, 1), shanghai(200, 3), hangzhou(200, 3)},
+			wantErr: ErrInsufficientStock,
+		},
+		{
+			name:    "non-positive quantity rejected",
+			items:   map[uint64]int32{100: 0},
+			stocks:  []*WarehouseStock{shanghai(100, 1)},
+			wantErr: ErrNegativeQuantity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &FulfillmentOptimizer{}
+			plans, err := o.Optimize(context.Background(), tt.items, userLat, userLon, tt.stocks)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				if plans != nil {
+					t.Fatalf("plans = %v, want nil on error", plans)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(plans) != len(tt.want) {
+				t.Fatalf("got %d plans, want %d: %+v", len(plans), len(tt.want), plans)
+			}
+			for i, w := range tt.want {
+				p := plans[i]
+				if p.SKUID != w.sku || p.WarehouseID != w.warehouse || p.Quantity != w.qty {
+					t.Errorf("plan[%d] = sku %d warehouse %d qty %d, want sku %d warehouse %d qty %d",
+						i, p.SKUID, p.WarehouseID, p.Quantity, w.sku, w.warehouse, w.qty)
+				}
+			}
+		})
+	}
+}
+
+func TestFulfillmentOptimizerTieBreak(t *testing.T) {
+	// 两个仓库与收货地址距离相同时优先级高者优先，优先级相同时仓库 ID 小者优先
+	stocks := []*WarehouseStock{
+		{WarehouseID: 7, SKUID: 1, Available: 5, LocationLat: 30, LocationLon: 120},
+		{WarehouseID: 5, SKUID: 1, Available: 5, LocationLat: 30, LocationLon: 120},
+		{WarehouseID: 9, SKUID: 1, Available: 5, LocationLat: 30, LocationLon: 120, Priority: 1},
+	}
+	o := &FulfillmentOptimizer{}
+
+	plans, err := o.Optimize(context.Background(), map[uint64]int32{1: 5}, 30, 120, stocks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plans) != 1 || plans[0].WarehouseID != 9 {
+		t.Fatalf("plans = %+v, want single plan from priority warehouse 9", plans)
+	}
+
+	stocks[2].Priority = 0
+	plans, err = o.Optimize(context.Background(), map[uint64]int32{1: 5}, 30, 120, stocks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plans) != 1 || plans[0].WarehouseID != 5 {
+		t.Fatalf("plans = %+v, want single plan from lowest warehouse id 5", plans)
+	}
+}
+
+func TestFulfillmentOptimizerShipCost(t *testing.T) {
+	tests := []struct {
+		name      string
+		costPerKm decimal.Decimal
+		baseCost  int64
+		lat, lon  float64
+		wantDist  float64
+		wantCost  string
+	}{
+		{name: "same location charges base cost only", baseCost: 800, lat: 31.23, lon: 121.47, wantDist: 0, wantCost: "8"},
+		{name: "default rate per km", baseCost: 0, lat: 32.23, lon: 121.47, wantDist: 111.19, wantCost: "55.6"},
+		{name: "configured rate per km", costPerKm: decimal.NewFromInt(1), baseCost: 500, lat: 32.23, lon: 121.47, wantDist: 111.19, wantCost: "116.19"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &FulfillmentOptimizer{CostPerKm: tt.costPerKm}
+			stocks := []*WarehouseStock{{WarehouseID: 1, SKUID: 1, Available: 1, LocationLat: tt.lat, LocationLon: tt.lon, BaseCost: tt.baseCost}}
+			plans, err := o.Optimize(context.Background(), map[uint64]int32{1: 1}, 31.23, 121.47, stocks)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if math.Abs(plans[0].Distance-tt.wantDist) > 0.01 {
+				t.Errorf("distance = %.4f, want %.2f", plans[0].Distance, tt.wantDist)
+			}
+			if !plans[0].ShipCost.Equal(decimal.RequireFromString(tt.wantCost)) {
+				t.Errorf("ship cost = %s, want %s", plans[0].ShipCost, tt.wantCost)
+			}
+		})
+	}
+}
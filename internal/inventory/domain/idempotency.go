@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAlreadyCompensated 正向操作到达前其补偿已经执行 (空补偿)，正向操作不再生效，防止资源悬挂。
+var ErrAlreadyCompensated = errors.New("operation already compensated")
+
+// 库存变更的幂等动作，与订单号、SKU、仓库共同组成幂等键。
+const (
+	IdemActionAdd     = "add"     // 入库
+	IdemActionDeduct  = "deduct"  // 直接扣减
+	IdemActionRevert  = "revert"  // 回补直接扣减 (补偿 deduct)
+	IdemActionLock    = "lock"    // 锁定预占
+	IdemActionUnlock  = "unlock"  // 解锁预占 (补偿 lock)
+	IdemActionConfirm = "confirm" // 确认扣减锁定库存
+)
+
+// LogActionNullCompensate 空补偿日志的操作类型。
+// 该日志以被补偿动作的幂等键落库，占住唯一索引，使迟到的正向操作无法再执行。
+const LogActionNullCompensate = "NullCompensate"
+
+// compensations 补偿动作到其正向动作的映射。
+var compensations = map[string]string{
+	IdemActionRevert: IdemActionDeduct,
+	IdemActionUnlock: IdemActionLock,
+}
+
+// IdempotencyKey 生成库存变更的业务幂等键，格式为 "{orderNo}:{skuID}:{warehouseID}:{action}"。
+// orderNo 为空表示调用方未要求幂等，返回空串。
+func IdempotencyKey(orderNo string, skuID, warehouseID uint64, action string) string {
+	if orderNo == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d:%d:%s", orderNo, skuID, warehouseID, action)
+}
+
+// CompensatedAction 返回补偿动作对应的正向动作；action 不是补偿动作时 ok 为 false。
+func CompensatedAction(action string) (forward string, ok bool) {
+	forward, ok = compensations[action]
+	return forward, ok
+}
+
+// SetIdempotencyKey 为日志设置幂等键，空键表示不参与唯一约束。
+func (l *InventoryLog) SetIdempotencyKey(key string) {
+	if key == "" {
+		l.IdempotencyKey = nil
+		return
+	}
+	l.IdempotencyKey = &key
+}
+
+// IsNullCompensation 是否为空补偿日志。
+func (l *InventoryLog) IsNullCompensation() bool {
+	return l.Action == LogActionNullCompensate
+}
+
+// NewNullCompensationLog 创建空补偿日志：补偿先于正向操作到达，库存不变，仅记录正向动作的幂等键。
+func (inv *Inventory) NewNullCompensationLog(forwardKey, reason string) *InventoryLog {
+	log := inv.createLog(LogActionNullCompensate, 0, inv.AvailableStock, inv.AvailableStock, inv.LockedStock, inv.LockedStock, reason)
+	log.SetIdempotencyKey(forwardKey)
+	return log
+}
@@ -25,32 +25,37 @@ const (
 
 // Inventory 实体是库存模块的聚合根。
 // 它代表一个SKU在特定仓库中的库存信息，包含了可用库存、锁定库存、总库存和状态。
+// 同一SKU在每个仓库各有一条记录，(SkuID, WarehouseID) 唯一。
 type Inventory struct {
 	gorm.Model                       // 嵌入gorm.Model，包含ID, CreatedAt, UpdatedAt, DeletedAt等通用字段。
-	SkuID            uint64          `gorm:"not null;index;comment:SKU ID" json:"sku_id"`            // 关联的SKU ID，索引字段。
-	ProductID        uint64          `gorm:"not null;index;comment:商品ID" json:"product_id"`          // 关联的商品ID，索引字段。
-	WarehouseID      uint64          `gorm:"not null;index;comment:仓库ID" json:"warehouse_id"`        // 关联的仓库ID，索引字段。
-	AvailableStock   int32           `gorm:"not null;default:0;comment:可用库存" json:"available_stock"` // 可用于销售的库存数量。
-	LockedStock      int32           `gorm:"not null;default:0;comment:锁定库存" json:"locked_stock"`    // 因预购或订单待支付而锁定的库存数量。
-	TotalStock       int32           `gorm:"not null;default:0;comment:总库存" json:"total_stock"`      // 总库存数量（可用库存 + 锁定库存）。
-	Status           InventoryStatus `gorm:"default:1;comment:状态" json:"status"`                     // 库存状态，默认为正常。
-	WarningThreshold int32           `gorm:"default:10;comment:预警阈值" json:"warning_threshold"`       // 触发库存预警的阈值。
-	Version          int64           `gorm:"default:1;comment:乐观锁版本号" json:"version"`                // 乐观锁版本号
+	SkuID            uint64          `gorm:"not null;uniqueIndex:uk_sku_warehouse;comment:SKU ID" json:"sku_id"`           // 关联的SKU ID，与仓库ID构成唯一索引。
+	ProductID        uint64          `gorm:"not null;index;comment:商品ID" json:"product_id"`                                // 关联的商品ID，索引字段。
+	WarehouseID      uint64          `gorm:"not null;uniqueIndex:uk_sku_warehouse;index;comment:仓库ID" json:"warehouse_id"` // 关联的仓库ID。
+	AvailableStock   int32           `gorm:"not null;default:0;comment:可用库存" json:"available_stock"`                       // 可用于销售的库存数量。
+	LockedStock      int32           `gorm:"not null;default:0;comment:锁定库存" json:"locked_stock"`                          // 因预购或订单待支付而锁定的库存数量。
+	TotalStock       int32           `gorm:"not null;default:0;comment:总库存" json:"total_stock"`                            // 总库存数量（可用库存 + 锁定库存）。
+	Status           InventoryStatus `gorm:"default:1;comment:状态" json:"status"`                                           // 库存状态，默认为正常。
+	WarningThreshold int32           `gorm:"default:10;comment:预警阈值" json:"warning_threshold"`                             // 触发库存预警的阈值。
+	Version          int64           `gorm:"default:1;comment:乐观锁版本号" json:"version"`                                      // 乐观锁版本号
 }
 
 // InventoryLog 实体代表库存的一次操作日志。
 // 它记录了操作类型、数量变更、变更前后状态和原因等信息。
 type InventoryLog struct {
 	gorm.Model            // 嵌入gorm.Model。
-	InventoryID    uint64 `gorm:"not null;index;comment:库存ID" json:"inventory_id"`      // 关联的库存记录ID，索引字段。
-	SkuID          uint64 `gorm:"not null;index;comment:SKU ID" json:"sku_id"`          // 关联的SKU ID，用于分片。
-	Action         string `gorm:"type:varchar(32);not null;comment:操作类型" json:"action"` // 操作类型，例如“Add”（增加），“Deduct”（扣减），“Lock”（锁定）。
-	ChangeQuantity int32  `gorm:"not null;comment:变更数量" json:"change_quantity"`         // 本次操作导致的库存数量变化。
-	OldAvailable   int32  `gorm:"not null;comment:变更前可用" json:"old_available"`          // 变更前的可用库存数量。
-	NewAvailable   int32  `gorm:"not null;comment:变更后可用" json:"new_available"`          // 变更后的可用库存数量。
-	OldLocked      int32  `gorm:"not null;comment:变更前锁定" json:"old_locked"`             // 变更前的锁定库存数量。
-	NewLocked      int32  `gorm:"not null;comment:变更后锁定" json:"new_locked"`             // 变更后的锁定库存数量。
-	Reason         string `gorm:"type:varchar(255);comment:原因" json:"reason"`           // 变更原因。
+	InventoryID    uint64 `gorm:"not null;index;comment:库存ID" json:"inventory_id"`           // 关联的库存记录ID，索引字段。
+	SkuID          uint64 `gorm:"not null;index;comment:SKU ID" json:"sku_id"`               // 关联的SKU ID，用于分片。
+	WarehouseID    uint64 `gorm:"not null;default:0;comment:仓库ID" json:"warehouse_id"`       // 发生变动的仓库ID。
+	Action         string `gorm:"type:varchar(32);not null;comment:操作类型" json:"action"`      // 操作类型，例如“Add”（增加），“Deduct”（扣减），“Lock”（锁定）。
+	ChangeQuantity int32  `gorm:"not null;comment:变更数量" json:"change_quantity"`              // 本次操作导致的库存数量变化。
+	OldAvailable   int32  `gorm:"not null;comment:变更前可用" json:"old_available"`               // 变更前的可用库存数量。
+	NewAvailable   int32  `gorm:"not null;comment:变更后可用" json:"new_available"`               // 变更后的可用库存数量。
+	OldLocked      int32  `gorm:"not null;comment:变更前锁定" json:"old_locked"`                  // 变更前的锁定库存数量。
+	NewLocked      int32  `gorm:"not null;comment:变更后锁定" json:"new_locked"`                  // 变更后的锁定库存数量。
+	Reason         string `gorm:"type:varchar(255);comment:原因" json:"reason"`                // 变更原因。
+	ReservationID  string `gorm:"type:varchar(64);index;comment:预占ID" json:"reservation_id"` // 关联的预占ID，非预占操作为空。
+	// IdempotencyKey 业务幂等键 (订单号 + SKU + 仓库 + 动作)，唯一约束保证同一操作只生效一次；未携带订单号的操作为 NULL。
+	IdempotencyKey *string `gorm:"type:varchar(160);uniqueIndex;comment:幂等键" json:"idempotency_key"`
 }
 
 // NewInventory 创建并返回一个新的 Inventory 实体实例。
@@ -251,6 +256,7 @@ func (inv *Inventory) createLog(action string, changeQuantity, oldAvailable, new
 	return &InventoryLog{
 		InventoryID:    uint64(inv.ID),
 		SkuID:          inv.SkuID,
+		WarehouseID:    inv.WarehouseID,
 		Action:         action,
 		ChangeQuantity: changeQuantity,
 		OldAvailable:   oldAvailable,
@@ -261,6 +267,32 @@ func (inv *Inventory) createLog(action string, changeQuantity, oldAvailable, new
 	}
 }
 
+// SumInventories 汇总同一SKU在所有仓库的库存，返回 WarehouseID 为 0 的聚合视图。
+// list 为空时返回 nil。
+func SumInventories(list []*Inventory) *Inventory {
+	if len(list) == 0 {
+		return nil
+	}
+	sum := &Inventory{
+		SkuID:     list[0].SkuID,
+		ProductID: list[0].ProductID,
+	}
+	for _, inv := range list {
+		sum.AvailableStock += inv.AvailableStock
+		sum.LockedStock += inv.LockedStock
+		sum.TotalStock += inv.TotalStock
+		sum.WarningThreshold += inv.WarningThreshold
+		if sum.CreatedAt.IsZero() || inv.CreatedAt.Before(sum.CreatedAt) {
+			sum.CreatedAt = inv.CreatedAt
+		}
+		if inv.UpdatedAt.After(sum.UpdatedAt) {
+			sum.UpdatedAt = inv.UpdatedAt
+		}
+	}
+	sum.updateStatus()
+	return sum
+}
+
 // --- Warehouse Aggregates ---
 
 // Warehouse 实体代表一个仓库。
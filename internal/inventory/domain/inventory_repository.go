@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"time"
 )
 
 // InventoryRepository 是库存模块的仓储接口。
@@ -21,16 +22,36 @@ type InventoryRepository interface {
 	// SaveLog 保存库存日志。
 	SaveLog(ctx context.Context, log *InventoryLog) error
 
-	// GetBySkuID 根据SKU ID获取库存实体。
-	GetBySkuID(ctx context.Context, skuID uint64) (*Inventory, error)
-	// GetBySkuIDs 根据SKU ID列表获取多个库存实体。
+	// GetBySkuAndWarehouse 获取指定SKU在指定仓库的库存实体，不存在时返回 nil。
+	GetBySkuAndWarehouse(ctx context.Context, skuID, warehouseID uint64) (*Inventory, error)
+	// ListBySkuID 获取指定SKU在所有仓库的库存实体。
+	ListBySkuID(ctx context.Context, skuID uint64) ([]*Inventory, error)
+	// GetBySkuIDs 根据SKU ID列表获取多个库存实体（包含每个SKU在所有仓库的记录）。
 	GetBySkuIDs(ctx context.Context, skuIDs []uint64) ([]*Inventory, error)
 	// List 列出所有库存实体，支持分页。
 	List(ctx context.Context, offset, limit int) ([]*Inventory, int64, error)
+	// GetLogByIdempotencyKey 根据幂等键获取库存日志，不存在时返回 nil。
+	GetLogByIdempotencyKey(ctx context.Context, skuID uint64, key string) (*InventoryLog, error)
 	// GetLogs 获取指定SKU的所有库存日志。
 	GetLogs(ctx context.Context, skuID uint64, inventoryID uint64, offset, limit int) ([]*InventoryLog, int64, error)
-	// Delete 删除指定库存记录。
-	Delete(ctx context.Context, skuID uint64) error
+	// Delete 删除指定SKU在指定仓库的库存记录。
+	Delete(ctx context.Context, skuID, warehouseID uint64) error
+
+	// Transaction 在 skuID 所在分片上开启事务。
+	Transaction(ctx context.Context, skuID uint64, fn func(tx any) error) error
+	// WithTx 返回绑定到指定事务的仓储实例。
+	WithTx(tx any) InventoryRepository
+
+	// SaveReservation 保存预占记录。
+	SaveReservation(ctx context.Context, reservation *Reservation) error
+	// GetReservation 根据预占ID获取预占记录，不存在时返回 nil。
+	GetReservation(ctx context.Context, reservationID string) (*Reservation, error)
+	// GetReservationByOrder 获取订单在指定 (SKU, 仓库) 上的预占记录，不存在时返回 nil。
+	GetReservationByOrder(ctx context.Context, orderNo string, skuID, warehouseID uint64) (*Reservation, error)
+	// UpdateReservationStatus 以 from 状态为条件更新预占状态 (CAS)，返回是否更新成功。
+	UpdateReservationStatus(ctx context.Context, reservation *Reservation, from ReservationStatus) (bool, error)
+	// ListExpiredReservations 跨分片列出已过期但仍处于预占状态的记录。
+	ListExpiredReservations(ctx context.Context, now time.Time, limit int) ([]*Reservation, error)
 }
 
 // WarehouseRepository 是仓库模块的仓储接口。
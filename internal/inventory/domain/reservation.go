@@ -0,0 +1,165 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 定义库存预占相关的业务错误。
+var (
+	ErrReservationNotFound  = errors.New("reservation not found")           // 预占记录不存在。
+	ErrReservationClosed    = errors.New("reservation is no longer active") // 预占已确认、释放或过期，无法再做相反操作。
+	ErrInvalidReservationID = errors.New("invalid reservation id")          // 预占 ID 格式错误。
+)
+
+// DefaultReservationTTL 未指定有效期时预占保留的时长。
+const DefaultReservationTTL = 30 * time.Minute
+
+// ReservationStatus 定义了库存预占的生命周期状态。
+type ReservationStatus int
+
+const (
+	ReservationReserved  ReservationStatus = 1 // 已预占：库存处于锁定状态，等待确认或释放。
+	ReservationConfirmed ReservationStatus = 2 // 已确认：锁定库存已转为实际扣减。
+	ReservationReleased  ReservationStatus = 3 // 已释放：主动取消，锁定库存已归还。
+	ReservationExpired   ReservationStatus = 4 // 已过期：超过有效期由清理任务归还。
+)
+
+// String 返回状态名称。
+func (s ReservationStatus) String() string {
+	switch s {
+	case ReservationReserved:
+		return "RESERVED"
+	case ReservationConfirmed:
+		return "CONFIRMED"
+	case ReservationReleased:
+		return "RELEASED"
+	case ReservationExpired:
+		return "EXPIRED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Reservation 实体代表一次库存预占。
+// 每个订单在每个 (SKU, 仓库) 上至多一条预占记录，确认与释放都以预占 ID 为准并且幂等。
+// 预占与库存记录位于同一分片 (按 SkuID 路由)，以便在同一事务内更新。
+type Reservation struct {
+	gorm.Model
+	ReservationID string            `gorm:"type:varchar(64);uniqueIndex;not null;comment:预占ID" json:"reservation_id"`
+	OrderNo       string            `gorm:"type:varchar(64);not null;uniqueIndex:uk_order_sku_warehouse;comment:订单编号" json:"order_no"`
+	SkuID         uint64            `gorm:"not null;uniqueIndex:uk_order_sku_warehouse;comment:SKU ID" json:"sku_id"`
+	WarehouseID   uint64            `gorm:"not null;uniqueIndex:uk_order_sku_warehouse;comment:仓库ID" json:"warehouse_id"`
+	InventoryID   uint64            `gorm:"not null;comment:库存ID" json:"inventory_id"`
+	Quantity      int32             `gorm:"not null;comment:预占数量" json:"quantity"`
+	Status        ReservationStatus `gorm:"type:tinyint;not null;default:1;index:idx_status_expires;comment:状态" json:"status"`
+	ExpiresAt     time.Time         `gorm:"not null;index:idx_status_expires;comment:过期时间" json:"expires_at"`
+	ClosedAt      *time.Time        `gorm:"comment:确认/释放时间" json:"closed_at"`
+	Reason        string            `gorm:"type:varchar(255);comment:原因" json:"reason"`
+}
+
+// NewReservationID 生成预占 ID，格式为 "RSV{skuID}-{seq}"。
+// 预占 ID 中携带 SKU ID，以便仅凭 ID 即可路由到所在分片。
+func NewReservationID(skuID, seq uint64) string {
+	return fmt.Sprintf("RSV%d-%d", skuID, seq)
+}
+
+// ParseReservationSkuID 从预占 ID 中解析出 SKU ID。
+func ParseReservationSkuID(reservationID string) (uint64, error) {
+	rest, ok := strings.CutPrefix(reservationID, "RSV")
+	if !ok {
+		return 0, ErrInvalidReservationID
+	}
+	skuPart, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, ErrInvalidReservationID
+	}
+	skuID, err := strconv.ParseUint(skuPart, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidReservationID
+	}
+	return skuID, nil
+}
+
+// NewReservation 为已锁定的库存创建预占记录。
+func NewReservation(reservationID, orderNo string, inv *Inventory, quantity int32, ttl time.Duration, reason string, now time.Time) *Reservation {
+	if ttl <= 0 {
+		ttl = DefaultReservationTTL
+	}
+	return &Reservation{
+		ReservationID: reservationID,
+		OrderNo:       orderNo,
+		SkuID:         inv.SkuID,
+		WarehouseID:   inv.WarehouseID,
+		InventoryID:   uint64(inv.ID),
+		Quantity:      quantity,
+		Status:        ReservationReserved,
+		ExpiresAt:     now.Add(ttl),
+		Reason:        reason,
+	}
+}
+
+// IsActive 是否仍处于预占状态。
+func (r *Reservation) IsActive() bool {
+	return r.Status == ReservationReserved
+}
+
+// IsExpired 在 now 时刻是否已超过有效期。
+func (r *Reservation) IsExpired(now time.Time) bool {
+	return r.IsActive() && !now.Before(r.ExpiresAt)
+}
+
+// Confirm 确认预占：锁定库存转为实际扣减。
+// 返回生成的日志对象，由调用者负责保存。
+func (r *Reservation) Confirm(inv *Inventory, reason string, now time.Time) (*InventoryLog, error) {
+	if !r.IsActive() {
+		return nil, fmt.Errorf("%w: status=%s", ErrReservationClosed, r.Status)
+	}
+	log, err := inv.ConfirmDeduction(r.Quantity, reason)
+	if err != nil {
+		return nil, err
+	}
+	r.close(ReservationConfirmed, now)
+	log.ReservationID = r.ReservationID
+	return log, nil
+}
+
+// Release 主动释放预占：锁定库存归还为可用库存。
+func (r *Reservation) Release(inv *Inventory, reason string, now time.Time) (*InventoryLog, error) {
+	if !r.IsActive() {
+		return nil, fmt.Errorf("%w: status=%s", ErrReservationClosed, r.Status)
+	}
+	log, err := inv.Unlock(r.Quantity, reason)
+	if err != nil {
+		return nil, err
+	}
+	r.close(ReservationReleased, now)
+	log.ReservationID = r.ReservationID
+	return log, nil
+}
+
+// Expire 过期释放预占，日志动作记为 "Expire" 以区别于主动释放。
+func (r *Reservation) Expire(inv *Inventory, now time.Time) (*InventoryLog, error) {
+	if !r.IsExpired(now) {
+		return nil, fmt.Errorf("%w: status=%s, expires_at=%s", ErrReservationClosed, r.Status, r.ExpiresAt.Format(time.RFC3339))
+	}
+	log, err := inv.Unlock(r.Quantity, fmt.Sprintf("Reservation %s expired (order %s)", r.ReservationID, r.OrderNo))
+	if err != nil {
+		return nil, err
+	}
+	r.close(ReservationExpired, now)
+	log.Action = "Expire"
+	log.ReservationID = r.ReservationID
+	return log, nil
+}
+
+// close 将预占切换到终态。
+func (r *Reservation) close(status ReservationStatus, now time.Time) {
+	r.Status = status
+	r.ClosedAt = &now
+}
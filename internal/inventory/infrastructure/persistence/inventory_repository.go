@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/inventory/domain"
 	"github.com/wyfcoding/pkg/databases/sharding"
@@ -12,6 +13,7 @@ import (
 
 type inventoryRepository struct {
 	sharding *sharding.Manager
+	tx       *gorm.DB
 }
 
 // NewInventoryRepository 创建分片库存仓储。
@@ -19,15 +21,42 @@ func NewInventoryRepository(sharding *sharding.Manager) domain.InventoryReposito
 	return &inventoryRepository{sharding: sharding}
 }
 
+// WithTx 返回绑定到指定事务的仓储实例。
+func (r *inventoryRepository) WithTx(tx any) domain.InventoryRepository {
+	if gormTx, ok := tx.(*gorm.DB); ok {
+		return &inventoryRepository{
+			sharding: r.sharding,
+			tx:       gormTx,
+		}
+	}
+	return r
+}
+
+// Transaction 在 skuID 所在分片上开启事务。
+func (r *inventoryRepository) Transaction(ctx context.Context, skuID uint64, fn func(tx any) error) error {
+	db := r.sharding.GetDB(skuID)
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(tx)
+	})
+}
+
+// getDB 内部辅助方法，自动切换事务与普通连接。
+func (r *inventoryRepository) getDB(skuID uint64) *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.sharding.GetDB(skuID)
+}
+
 // Save 将库存实体保存到对应分片。
 func (r *inventoryRepository) Save(ctx context.Context, inventory *domain.Inventory) error {
-	db := r.sharding.GetDB(inventory.SkuID)
+	db := r.getDB(inventory.SkuID)
 	return db.WithContext(ctx).Save(inventory).Error
 }
 
 // SaveWithOptimisticLock 使用乐观锁保存。
 func (r *inventoryRepository) SaveWithOptimisticLock(ctx context.Context, inventory *domain.Inventory) error {
-	db := r.sharding.GetDB(inventory.SkuID)
+	db := r.getDB(inventory.SkuID)
 	if inventory.ID == 0 {
 		return db.WithContext(ctx).Create(inventory).Error
 	}
@@ -50,15 +79,15 @@ func (r *inventoryRepository) SaveWithOptimisticLock(ctx context.Context, invent
 
 // SaveLog 保存库存日志到对应分片。
 func (r *inventoryRepository) SaveLog(ctx context.Context, log *domain.InventoryLog) error {
-	db := r.sharding.GetDB(log.SkuID)
+	db := r.getDB(log.SkuID)
 	return db.WithContext(ctx).Create(log).Error
 }
 
-// GetBySkuID 定向查询分片。
-func (r *inventoryRepository) GetBySkuID(ctx context.Context, skuID uint64) (*domain.Inventory, error) {
-	db := r.sharding.GetDB(skuID)
+// GetBySkuAndWarehouse 定向查询分片，按 (sku_id, warehouse_id) 唯一定位。
+func (r *inventoryRepository) GetBySkuAndWarehouse(ctx context.Context, skuID, warehouseID uint64) (*domain.Inventory, error) {
+	db := r.getDB(skuID)
 	var inventory domain.Inventory
-	if err := db.WithContext(ctx).Where("sku_id = ?", skuID).First(&inventory).Error; err != nil {
+	if err := db.WithContext(ctx).Where("sku_id = ? AND warehouse_id = ?", skuID, warehouseID).First(&inventory).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -67,14 +96,25 @@ func (r *inventoryRepository) GetBySkuID(ctx context.Context, skuID uint64) (*do
 	return &inventory, nil
 }
 
+// ListBySkuID 查询指定SKU在所有仓库的库存，同一SKU的记录位于同一分片。
+func (r *inventoryRepository) ListBySkuID(ctx context.Context, skuID uint64) ([]*domain.Inventory, error) {
+	db := r.getDB(skuID)
+	var list []*domain.Inventory
+	if err := db.WithContext(ctx).Where("sku_id = ?", skuID).Order("warehouse_id asc").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
 // GetBySkuIDs 跨分片查询。
 func (r *inventoryRepository) GetBySkuIDs(ctx context.Context, skuIDs []uint64) ([]*domain.Inventory, error) {
 	var allList []*domain.Inventory
 	for _, id := range skuIDs {
-		inv, err := r.GetBySkuID(ctx, id)
-		if err == nil && inv != nil {
-			allList = append(allList, inv)
+		list, err := r.ListBySkuID(ctx, id)
+		if err != nil {
+			return nil, err
 		}
+		allList = append(allList, list...)
 	}
 	return allList, nil
 }
@@ -103,15 +143,28 @@ func (r *inventoryRepository) List(ctx context.Context, offset, limit int) ([]*d
 	return allList, totalCount, nil
 }
 
-// Delete 从对应分片删除。
-func (r *inventoryRepository) Delete(ctx context.Context, skuID uint64) error {
-	db := r.sharding.GetDB(skuID)
-	return db.WithContext(ctx).Where("sku_id = ?", skuID).Delete(&domain.Inventory{}).Error
+// Delete 从对应分片删除指定仓库的库存记录。
+func (r *inventoryRepository) Delete(ctx context.Context, skuID, warehouseID uint64) error {
+	db := r.getDB(skuID)
+	return db.WithContext(ctx).Where("sku_id = ? AND warehouse_id = ?", skuID, warehouseID).Delete(&domain.Inventory{}).Error
+}
+
+// GetLogByIdempotencyKey 在 SKU 所在分片按幂等键查询日志。
+func (r *inventoryRepository) GetLogByIdempotencyKey(ctx context.Context, skuID uint64, key string) (*domain.InventoryLog, error) {
+	db := r.getDB(skuID)
+	var log domain.InventoryLog
+	if err := db.WithContext(ctx).Where("idempotency_key = ?", key).First(&log).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &log, nil
 }
 
 // GetLogs 获取指定分片下的日志。
 func (r *inventoryRepository) GetLogs(ctx context.Context, skuID uint64, inventoryID uint64, offset, limit int) ([]*domain.InventoryLog, int64, error) {
-	db := r.sharding.GetDB(skuID)
+	db := r.getDB(skuID)
 	var list []*domain.InventoryLog
 	var total int64
 
@@ -126,3 +179,74 @@ func (r *inventoryRepository) GetLogs(ctx context.Context, skuID uint64, invento
 
 	return list, total, nil
 }
+
+// SaveReservation 保存预占记录到 SKU 所在分片。
+func (r *inventoryRepository) SaveReservation(ctx context.Context, reservation *domain.Reservation) error {
+	db := r.getDB(reservation.SkuID)
+	return db.WithContext(ctx).Save(reservation).Error
+}
+
+// GetReservation 根据预占ID中携带的 SKU ID 定向查询分片。
+func (r *inventoryRepository) GetReservation(ctx context.Context, reservationID string) (*domain.Reservation, error) {
+	skuID, err := domain.ParseReservationSkuID(reservationID)
+	if err != nil {
+		return nil, err
+	}
+	db := r.getDB(skuID)
+	var reservation domain.Reservation
+	if err := db.WithContext(ctx).Where("reservation_id = ?", reservationID).First(&reservation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// GetReservationByOrder 按 (order_no, sku_id, warehouse_id) 唯一定位预占记录。
+func (r *inventoryRepository) GetReservationByOrder(ctx context.Context, orderNo string, skuID, warehouseID uint64) (*domain.Reservation, error) {
+	db := r.getDB(skuID)
+	var reservation domain.Reservation
+	if err := db.WithContext(ctx).Where("order_no = ? AND sku_id = ? AND warehouse_id = ?", orderNo, skuID, warehouseID).First(&reservation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// UpdateReservationStatus 以原状态为条件更新，保证同一预占只会被确认或释放一次。
+func (r *inventoryRepository) UpdateReservationStatus(ctx context.Context, reservation *domain.Reservation, from domain.ReservationStatus) (bool, error) {
+	db := r.getDB(reservation.SkuID)
+	res := db.WithContext(ctx).Model(&domain.Reservation{}).
+		Where("id = ? AND status = ?", reservation.ID, from).
+		Updates(map[string]any{
+			"status":    reservation.Status,
+			"closed_at": reservation.ClosedAt,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// ListExpiredReservations 扫描所有分片中已过期的预占记录。
+func (r *inventoryRepository) ListExpiredReservations(ctx context.Context, now time.Time, limit int) ([]*domain.Reservation, error) {
+	var allList []*domain.Reservation
+	for _, db := range r.sharding.GetAllDBs() {
+		if len(allList) >= limit {
+			break
+		}
+		var list []*domain.Reservation
+		if err := db.WithContext(ctx).
+			Where("status = ? AND expires_at <= ?", domain.ReservationReserved, now).
+			Order("expires_at asc").
+			Limit(limit - len(allList)).
+			Find(&list).Error; err != nil {
+			return nil, err
+		}
+		allList = append(allList, list...)
+	}
+	return allList, nil
+}
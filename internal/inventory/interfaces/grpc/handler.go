@@ -2,6 +2,7 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -9,8 +10,8 @@ import (
 	pb "github.com/wyfcoding/ecommerce/goapi/inventory/v1"          // 导入库存模块的protobuf定义。
 	"github.com/wyfcoding/ecommerce/internal/inventory/application" // 导入库存模块的应用服务。
 	"github.com/wyfcoding/ecommerce/internal/inventory/domain"      // 导入库存模块的领域层。
-	"github.com/wyfcoding/pkg/algorithm"
 
+	"github.com/shopspring/decimal"
 	"google.golang.org/grpc/codes"                       // gRPC状态码。
 	"google.golang.org/grpc/status"                      // gRPC状态处理。
 	"google.golang.org/protobuf/types/known/emptypb"     // 导入空消息类型。
@@ -49,9 +50,9 @@ func (s *Server) CreateInventory(ctx context.Context, req *pb.CreateInventoryReq
 // GetInventory 处理获取库存记录的gRPC请求。
 func (s *Server) GetInventory(ctx context.Context, req *pb.GetInventoryRequest) (*pb.GetInventoryResponse, error) {
 	start := time.Now()
-	slog.Debug("gRPC GetInventory received", "sku_id", req.SkuId)
+	slog.Debug("gRPC GetInventory received", "sku_id", req.SkuId, "warehouse_id", req.WarehouseId)
 
-	inventory, err := s.app.GetInventory(ctx, req.SkuId)
+	inventory, warehouses, err := s.app.GetInventory(ctx, req.SkuId, req.WarehouseId)
 	if err != nil {
 		slog.Error("gRPC GetInventory failed", "sku_id", req.SkuId, "error", err, "duration", time.Since(start))
 		return nil, status.Error(codes.NotFound, fmt.Sprintf("failed to get inventory for sku %d: %v", req.SkuId, err))
@@ -61,20 +62,29 @@ func (s *Server) GetInventory(ctx context.Context, req *pb.GetInventoryRequest)
 		return nil, status.Error(codes.NotFound, fmt.Sprintf("inventory not found for sku %d", req.SkuId))
 	}
 
+	pbWarehouses := make([]*pb.Inventory, len(warehouses))
+	for i, inv := range warehouses {
+		pbWarehouses[i] = convertInventoryToProto(inv)
+	}
+
 	slog.Debug("gRPC GetInventory successful", "sku_id", req.SkuId, "duration", time.Since(start))
 	return &pb.GetInventoryResponse{
-		Inventory: convertInventoryToProto(inventory),
+		Inventory:  convertInventoryToProto(inventory),
+		Warehouses: pbWarehouses,
 	}, nil
 }
 
 // AddStock 处理增加库存的gRPC请求。
 func (s *Server) AddStock(ctx context.Context, req *pb.AddStockRequest) (*emptypb.Empty, error) {
 	start := time.Now()
-	slog.Info("gRPC AddStock received", "sku_id", req.SkuId, "quantity", req.Quantity, "reason", req.Reason)
+	slog.Info("gRPC AddStock received", "sku_id", req.SkuId, "warehouse_id", req.WarehouseId, "order_no", req.OrderNo, "quantity", req.Quantity, "reason", req.Reason)
 
-	if err := s.app.AddStock(ctx, req.SkuId, req.Quantity, req.Reason); err != nil {
+	if req.WarehouseId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "warehouse_id is required")
+	}
+	if err := s.app.AddStock(ctx, req.SkuId, req.WarehouseId, req.Quantity, req.OrderNo, req.Reason); err != nil {
 		slog.Error("gRPC AddStock failed", "sku_id", req.SkuId, "error", err, "duration", time.Since(start))
-		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to add stock: %v", err))
+		return nil, stockError("failed to add stock", err)
 	}
 
 	slog.Info("gRPC AddStock successful", "sku_id", req.SkuId, "duration", time.Since(start))
@@ -84,39 +94,132 @@ func (s *Server) AddStock(ctx context.Context, req *pb.AddStockRequest) (*emptyp
 // DeductStock 处理扣减库存的gRPC请求。
 func (s *Server) DeductStock(ctx context.Context, req *pb.DeductStockRequest) (*emptypb.Empty, error) {
 	start := time.Now()
-	slog.Info("gRPC DeductStock received", "sku_id", req.SkuId, "quantity", req.Quantity, "reason", req.Reason)
+	slog.Info("gRPC DeductStock received", "sku_id", req.SkuId, "warehouse_id", req.WarehouseId, "order_no", req.OrderNo, "quantity", req.Quantity, "reason", req.Reason)
 
-	if err := s.app.DeductStock(ctx, req.SkuId, req.Quantity, req.Reason); err != nil {
+	if req.WarehouseId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "warehouse_id is required")
+	}
+	if err := s.app.DeductStock(ctx, req.SkuId, req.WarehouseId, req.Quantity, req.OrderNo, req.Reason); err != nil {
 		slog.Error("gRPC DeductStock failed", "sku_id", req.SkuId, "error", err, "duration", time.Since(start))
-		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to deduct stock: %v", err))
+		return nil, stockError("failed to deduct stock", err)
 	}
 
 	slog.Info("gRPC DeductStock successful", "sku_id", req.SkuId, "duration", time.Since(start))
 	return &emptypb.Empty{}, nil
 }
 
+// RevertStock 处理回补扣减的gRPC请求 (DeductStock 的补偿)。
+func (s *Server) RevertStock(ctx context.Context, req *pb.RevertStockRequest) (*emptypb.Empty, error) {
+	start := time.Now()
+	slog.Info("gRPC RevertStock received", "sku_id", req.SkuId, "warehouse_id", req.WarehouseId, "order_no", req.OrderNo, "quantity", req.Quantity, "reason", req.Reason)
+
+	if req.WarehouseId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "warehouse_id is required")
+	}
+	if req.OrderNo == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_no is required")
+	}
+	if err := s.app.RevertStock(ctx, req.SkuId, req.WarehouseId, req.Quantity, req.OrderNo, req.Reason); err != nil {
+		slog.Error("gRPC RevertStock failed", "sku_id", req.SkuId, "error", err, "duration", time.Since(start))
+		return nil, stockError("failed to revert stock", err)
+	}
+
+	slog.Info("gRPC RevertStock successful", "sku_id", req.SkuId, "duration", time.Since(start))
+	return &emptypb.Empty{}, nil
+}
+
+// stockError 将库存变更的领域错误映射为 gRPC 状态码。
+// 库存不足与补偿已先执行的正向操作返回 Aborted，Saga 协调器据此判定分支失败、转入补偿而不再重试。
+func stockError(msg string, err error) error {
+	switch {
+	case errors.Is(err, domain.ErrAlreadyCompensated), errors.Is(err, domain.ErrInsufficientStock):
+		return status.Error(codes.Aborted, fmt.Sprintf("%s: %v", msg, err))
+	case errors.Is(err, application.ErrInventoryNotFound):
+		return status.Error(codes.NotFound, fmt.Sprintf("%s: %v", msg, err))
+	case errors.Is(err, application.ErrWarehouseRequired), errors.Is(err, application.ErrOrderNoRequired), errors.Is(err, application.ErrQuantityMismatch):
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("%s: %v", msg, err))
+	default:
+		return reservationError(msg, err)
+	}
+}
+
 // LockStock 处理锁定库存的gRPC请求。
-func (s *Server) LockStock(ctx context.Context, req *pb.LockStockRequest) (*emptypb.Empty, error) {
+func (s *Server) LockStock(ctx context.Context, req *pb.LockStockRequest) (*pb.LockStockResponse, error) {
 	start := time.Now()
-	slog.Info("gRPC LockStock received", "sku_id", req.SkuId, "quantity", req.Quantity, "reason", req.Reason)
+	slog.Info("gRPC LockStock received", "sku_id", req.SkuId, "warehouse_id", req.WarehouseId, "order_no", req.OrderNo, "quantity", req.Quantity, "reason", req.Reason)
 
-	if err := s.app.LockStock(ctx, req.SkuId, req.Quantity, req.Reason); err != nil {
+	if req.WarehouseId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "warehouse_id is required")
+	}
+	if req.OrderNo == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_no is required")
+	}
+	ttl := time.Duration(req.TtlSeconds) * time.Second
+	reservation, err := s.app.LockStock(ctx, req.SkuId, req.WarehouseId, req.Quantity, req.OrderNo, ttl, req.Reason)
+	if err != nil {
 		slog.Error("gRPC LockStock failed", "sku_id", req.SkuId, "error", err, "duration", time.Since(start))
-		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to lock stock: %v", err))
+		return nil, stockError("failed to lock stock", err)
+	}
+
+	slog.Info("gRPC LockStock successful", "sku_id", req.SkuId, "reservation_id", reservation.ReservationID, "duration", time.Since(start))
+	return &pb.LockStockResponse{
+		Reservation: convertReservationToProto(reservation),
+	}, nil
+}
+
+// ConfirmReservation 处理确认预占的gRPC请求。
+func (s *Server) ConfirmReservation(ctx context.Context, req *pb.ConfirmReservationRequest) (*emptypb.Empty, error) {
+	start := time.Now()
+	slog.Info("gRPC ConfirmReservation received", "reservation_id", req.ReservationId, "reason", req.Reason)
+
+	if _, err := s.app.ConfirmReservation(ctx, req.ReservationId, req.Reason); err != nil {
+		slog.Error("gRPC ConfirmReservation failed", "reservation_id", req.ReservationId, "error", err, "duration", time.Since(start))
+		return nil, reservationError("failed to confirm reservation", err)
 	}
 
-	slog.Info("gRPC LockStock successful", "sku_id", req.SkuId, "duration", time.Since(start))
+	slog.Info("gRPC ConfirmReservation successful", "reservation_id", req.ReservationId, "duration", time.Since(start))
 	return &emptypb.Empty{}, nil
 }
 
+// ReleaseReservation 处理释放预占的gRPC请求。
+func (s *Server) ReleaseReservation(ctx context.Context, req *pb.ReleaseReservationRequest) (*emptypb.Empty, error) {
+	start := time.Now()
+	slog.Info("gRPC ReleaseReservation received", "reservation_id", req.ReservationId, "reason", req.Reason)
+
+	if _, err := s.app.ReleaseReservation(ctx, req.ReservationId, req.Reason); err != nil {
+		slog.Error("gRPC ReleaseReservation failed", "reservation_id", req.ReservationId, "error", err, "duration", time.Since(start))
+		return nil, reservationError("failed to release reservation", err)
+	}
+
+	slog.Info("gRPC ReleaseReservation successful", "reservation_id", req.ReservationId, "duration", time.Since(start))
+	return &emptypb.Empty{}, nil
+}
+
+// reservationError 将预占相关的领域错误映射为 gRPC 状态码。
+func reservationError(msg string, err error) error {
+	switch {
+	case errors.Is(err, domain.ErrReservationNotFound):
+		return status.Error(codes.NotFound, fmt.Sprintf("%s: %v", msg, err))
+	case errors.Is(err, domain.ErrInvalidReservationID):
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("%s: %v", msg, err))
+	case errors.Is(err, domain.ErrReservationClosed):
+		return status.Error(codes.FailedPrecondition, fmt.Sprintf("%s: %v", msg, err))
+	default:
+		return status.Error(codes.Internal, fmt.Sprintf("%s: %v", msg, err))
+	}
+}
+
 // UnlockStock 处理解锁库存的gRPC请求。
 func (s *Server) UnlockStock(ctx context.Context, req *pb.UnlockStockRequest) (*emptypb.Empty, error) {
 	start := time.Now()
-	slog.Info("gRPC UnlockStock received", "sku_id", req.SkuId, "quantity", req.Quantity, "reason", req.Reason)
+	slog.Info("gRPC UnlockStock received", "sku_id", req.SkuId, "warehouse_id", req.WarehouseId, "order_no", req.OrderNo, "quantity", req.Quantity, "reason", req.Reason)
 
-	if err := s.app.UnlockStock(ctx, req.SkuId, req.Quantity, req.Reason); err != nil {
+	if req.WarehouseId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "warehouse_id is required")
+	}
+	if err := s.app.UnlockStock(ctx, req.SkuId, req.WarehouseId, req.Quantity, req.OrderNo, req.Reason); err != nil {
 		slog.Error("gRPC UnlockStock failed", "sku_id", req.SkuId, "error", err, "duration", time.Since(start))
-		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to unlock stock: %v", err))
+		return nil, stockError("failed to unlock stock", err)
 	}
 
 	slog.Info("gRPC UnlockStock successful", "sku_id", req.SkuId, "duration", time.Since(start))
@@ -126,11 +229,14 @@ func (s *Server) UnlockStock(ctx context.Context, req *pb.UnlockStockRequest) (*
 // ConfirmDeduction 处理确认扣减库存的gRPC请求。
 func (s *Server) ConfirmDeduction(ctx context.Context, req *pb.ConfirmDeductionRequest) (*emptypb.Empty, error) {
 	start := time.Now()
-	slog.Info("gRPC ConfirmDeduction received", "sku_id", req.SkuId, "quantity", req.Quantity, "reason", req.Reason)
+	slog.Info("gRPC ConfirmDeduction received", "sku_id", req.SkuId, "warehouse_id", req.WarehouseId, "order_no", req.OrderNo, "quantity", req.Quantity, "reason", req.Reason)
 
-	if err := s.app.ConfirmDeduction(ctx, req.SkuId, req.Quantity, req.Reason); err != nil {
+	if req.WarehouseId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "warehouse_id is required")
+	}
+	if err := s.app.ConfirmDeduction(ctx, req.SkuId, req.WarehouseId, req.Quantity, req.OrderNo, req.Reason); err != nil {
 		slog.Error("gRPC ConfirmDeduction failed", "sku_id", req.SkuId, "error", err, "duration", time.Since(start))
-		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to confirm deduction: %v", err))
+		return nil, stockError("failed to confirm deduction", err)
 	}
 
 	slog.Info("gRPC ConfirmDeduction successful", "sku_id", req.SkuId, "duration", time.Since(start))
@@ -197,40 +303,47 @@ func (s *Server) GetInventoryLogs(ctx context.Context, req *pb.GetInventoryLogsR
 }
 
 // AllocateOrderStock 处理订单库存分配请求。
+// 按仓库聚合履约计划，每个仓库返回其承担的订单行、距离与预估运费。
 func (s *Server) AllocateOrderStock(ctx context.Context, req *pb.AllocateOrderStockRequest) (*pb.AllocateOrderStockResponse, error) {
-	// 转换请求参数为算法输入 DTO
-	algoItems := make([]algorithm.OrderItem, len(req.Items))
-	for i, it := range req.Items {
-		algoItems[i] = algorithm.OrderItem{
-			SkuID:    it.SkuId,
-			Quantity: it.Quantity,
-		}
+	start := time.Now()
+	slog.Info("gRPC AllocateOrderStock received", "order_id", req.OrderId, "items_count", len(req.Items))
+
+	// 同一 SKU 出现多行时合并需求数量
+	items := make(map[uint64]int32, len(req.Items))
+	for _, it := range req.Items {
+		items[it.SkuId] += it.Quantity
 	}
 
-	// 调用应用服务层（已有的分配逻辑）
-	results, err := s.app.AllocateStock(ctx, req.UserLat, req.UserLon, algoItems)
+	plans, err := s.app.AllocateStock(ctx, req.UserLat, req.UserLon, items)
 	if err != nil {
+		slog.Error("gRPC AllocateOrderStock failed", "order_id", req.OrderId, "error", err, "duration", time.Since(start))
+		if errors.Is(err, domain.ErrInsufficientStock) {
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("failed to allocate stock: %v", err))
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to allocate stock: %v", err))
 	}
 
-	// 映射结果
-	pbAllocations := make([]*pb.WarehouseAllocation, len(results))
-	for i, res := range results {
-		pbItems := make([]*pb.OrderItemShort, len(res.Items))
-		for j, it := range res.Items {
-			pbItems[j] = &pb.OrderItemShort{
-				SkuId:    it.SkuID,
-				Quantity: it.Quantity,
+	// 按仓库映射结果，保持计划中的仓库出现顺序
+	pbAllocations := make([]*pb.WarehouseAllocation, 0)
+	byWarehouse := make(map[uint64]*pb.WarehouseAllocation)
+	for _, plan := range plans {
+		alloc, ok := byWarehouse[plan.WarehouseID]
+		if !ok {
+			alloc = &pb.WarehouseAllocation{
+				WarehouseId: plan.WarehouseID,
+				Distance:    plan.Distance,
 			}
+			byWarehouse[plan.WarehouseID] = alloc
+			pbAllocations = append(pbAllocations, alloc)
 		}
-		pbAllocations[i] = &pb.WarehouseAllocation{
-			WarehouseId:   res.WarehouseID,
-			Items:         pbItems,
-			Distance:      res.Distance,
-			EstimatedCost: res.TotalCost,
-		}
+		alloc.Items = append(alloc.Items, &pb.OrderItemShort{
+			SkuId:    plan.SKUID,
+			Quantity: plan.Quantity,
+		})
+		alloc.EstimatedCost += plan.ShipCost.Mul(decimal.NewFromInt(100)).IntPart()
 	}
 
+	slog.Info("gRPC AllocateOrderStock successful", "order_id", req.OrderId, "warehouses", len(pbAllocations), "duration", time.Since(start))
 	return &pb.AllocateOrderStockResponse{
 		OrderId:     req.OrderId,
 		Allocations: pbAllocations,
@@ -262,7 +375,7 @@ func convertLogToProto(log *domain.InventoryLog) *pb.InventoryLog {
 	if log == nil {
 		return nil
 	}
-	return &pb.InventoryLog{
+	pbLog := &pb.InventoryLog{
 		Id:             uint64(log.ID),                 // 日志记录ID。
 		InventoryId:    log.InventoryID,                // 库存ID。
 		Action:         log.Action,                     // 操作类型。
@@ -272,6 +385,29 @@ func convertLogToProto(log *domain.InventoryLog) *pb.InventoryLog {
 		OldLocked:      log.OldLocked,                  // 变更前锁定库存。
 		NewLocked:      log.NewLocked,                  // 变更后锁定库存。
 		Reason:         log.Reason,                     // 原因。
+		WarehouseId:    log.WarehouseID,                // 仓库ID。
+		ReservationId:  log.ReservationID,              // 预占ID。
 		CreatedAt:      timestamppb.New(log.CreatedAt), // 创建时间。
 	}
+	if log.IdempotencyKey != nil {
+		pbLog.IdempotencyKey = *log.IdempotencyKey // 业务幂等键。
+	}
+	return pbLog
+}
+
+// convertReservationToProto 是一个辅助函数，将领域层的 Reservation 实体转换为 protobuf 的 Reservation 消息。
+func convertReservationToProto(r *domain.Reservation) *pb.Reservation {
+	if r == nil {
+		return nil
+	}
+	return &pb.Reservation{
+		ReservationId: r.ReservationID,              // 预占ID。
+		OrderNo:       r.OrderNo,                    // 订单编号。
+		SkuId:         r.SkuID,                      // SKU ID。
+		WarehouseId:   r.WarehouseID,                // 仓库ID。
+		Quantity:      r.Quantity,                   // 预占数量。
+		Status:        r.Status.String(),            // 状态。
+		ExpiresAt:     timestamppb.New(r.ExpiresAt), // 过期时间。
+		CreatedAt:     timestamppb.New(r.CreatedAt), // 创建时间。
+	}
 }
@@ -1,10 +1,13 @@
 package http
 
 import (
+	"errors"   // 导入标准错误处理库。
 	"net/http" // 导入HTTP状态码。
 	"strconv"  // 导入字符串和数字转换工具。
+	"time"     // 导入时间库。
 
 	"github.com/wyfcoding/ecommerce/internal/inventory/application" // 导入库存模块的应用服务。
+	"github.com/wyfcoding/ecommerce/internal/inventory/domain"      // 导入库存模块的领域层。
 	"github.com/wyfcoding/pkg/response"                             // 导入统一的响应处理工具。
 
 	"log/slog" // 导入结构化日志库。
@@ -60,7 +63,8 @@ func (h *Handler) CreateInventory(c *gin.Context) {
 
 // GetInventory 处理获取指定SKU库存信息的HTTP请求。
 // HTTP 方法: GET
-// 请求路径: /inventory/:sku_id
+// 请求路径: /inventory/:sku_id?warehouse_id=
+// 未指定 warehouse_id 时返回跨仓汇总及各仓明细。
 func (h *Handler) GetInventory(c *gin.Context) {
 	// 从URL路径中解析SKU ID。
 	skuID, err := strconv.ParseUint(c.Param("sku_id"), 10, 64)
@@ -68,9 +72,14 @@ func (h *Handler) GetInventory(c *gin.Context) {
 		response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid SKU ID", err.Error())
 		return
 	}
+	warehouseID, err := strconv.ParseUint(c.DefaultQuery("warehouse_id", "0"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid warehouse ID", err.Error())
+		return
+	}
 
 	// 调用应用服务层获取库存信息。
-	inventory, err := h.app.GetInventory(c.Request.Context(), skuID)
+	inventory, warehouses, err := h.app.GetInventory(c.Request.Context(), skuID, warehouseID)
 	if err != nil {
 		h.logger.Error("Failed to get inventory", "error", err)
 		response.ErrorWithStatus(c, http.StatusInternalServerError, "Failed to get inventory", err.Error())
@@ -83,10 +92,14 @@ func (h *Handler) GetInventory(c *gin.Context) {
 	}
 
 	// 返回成功的响应，包含库存信息。
-	response.SuccessWithStatus(c, http.StatusOK, "Inventory retrieved successfully", inventory)
+	response.SuccessWithStatus(c, http.StatusOK, "Inventory retrieved successfully", gin.H{
+		"inventory":  inventory,
+		"warehouses": warehouses,
+	})
 }
 
-// UpdateStock 处理更新库存数量的HTTP请求（增加、扣减、锁定、解锁、确认扣减）。
+// UpdateStock 处理更新库存数量的HTTP请求（增加、扣减、回补、锁定、解锁、确认扣减）。
+// 携带 order_no 时按 (订单号, SKU, 仓库, 操作) 幂等，重复提交只生效一次。
 // HTTP 方法: POST
 // 请求路径: /inventory/:sku_id/stock
 func (h *Handler) UpdateStock(c *gin.Context) {
@@ -97,11 +110,14 @@ func (h *Handler) UpdateStock(c *gin.Context) {
 		return
 	}
 
-	// 定义请求体结构，用于接收操作类型、数量和原因。
+	// 定义请求体结构，用于接收仓库、操作类型、数量和原因。
 	var req struct {
-		Action   string `json:"action" binding:"required,oneof=add deduct lock unlock confirm"` // 操作类型，必填。
-		Quantity int32  `json:"quantity" binding:"required,gt=0"`                               // 数量，必填且必须大于0。
-		Reason   string `json:"reason"`                                                         // 原因，选填。
+		WarehouseID uint64 `json:"warehouse_id" binding:"required"`                                       // 仓库ID，必填。
+		Action      string `json:"action" binding:"required,oneof=add deduct revert lock unlock confirm"` // 操作类型，必填。
+		Quantity    int32  `json:"quantity" binding:"required,gt=0"`                                      // 数量，必填且必须大于0。
+		Reason      string `json:"reason"`                                                                // 原因，选填。
+		OrderNo     string `json:"order_no"`                                                              // 订单编号，lock/revert 操作必填，其余操作选填 (用于幂等)。
+		TTLSeconds  int32  `json:"ttl_seconds"`                                                           // 预占有效期（秒），lock 操作选填。
 	}
 
 	// 绑定并验证请求JSON数据。
@@ -116,17 +132,43 @@ func (h *Handler) UpdateStock(c *gin.Context) {
 	// 根据操作类型调用应用服务层的相应方法。
 	switch req.Action {
 	case "add":
-		opErr = h.app.AddStock(ctx, skuID, req.Quantity, req.Reason)
+		opErr = h.app.AddStock(ctx, skuID, req.WarehouseID, req.Quantity, req.OrderNo, req.Reason)
 	case "deduct":
-		opErr = h.app.DeductStock(ctx, skuID, req.Quantity, req.Reason)
+		opErr = h.app.DeductStock(ctx, skuID, req.WarehouseID, req.Quantity, req.OrderNo, req.Reason)
+	case "revert":
+		opErr = h.app.RevertStock(ctx, skuID, req.WarehouseID, req.Quantity, req.OrderNo, req.Reason)
 	case "lock":
-		opErr = h.app.LockStock(ctx, skuID, req.Quantity, req.Reason)
+		if req.OrderNo == "" {
+			response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid request", "order_no is required for lock")
+			return
+		}
+		reservation, err := h.app.LockStock(ctx, skuID, req.WarehouseID, req.Quantity, req.OrderNo, time.Duration(req.TTLSeconds)*time.Second, req.Reason)
+		if errors.Is(err, domain.ErrAlreadyCompensated) {
+			response.ErrorWithStatus(c, http.StatusConflict, "Failed to update stock", err.Error())
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to lock stock", "error", err)
+			response.ErrorWithStatus(c, http.StatusInternalServerError, "Failed to update stock", err.Error())
+			return
+		}
+		response.SuccessWithStatus(c, http.StatusOK, "Stock reserved successfully", reservation)
+		return
 	case "unlock":
-		opErr = h.app.UnlockStock(ctx, skuID, req.Quantity, req.Reason)
+		opErr = h.app.UnlockStock(ctx, skuID, req.WarehouseID, req.Quantity, req.OrderNo, req.Reason)
 	case "confirm":
-		opErr = h.app.ConfirmDeduction(ctx, skuID, req.Quantity, req.Reason)
+		opErr = h.app.ConfirmDeduction(ctx, skuID, req.WarehouseID, req.Quantity, req.OrderNo, req.Reason)
 	}
 
+	if errors.Is(opErr, application.ErrOrderNoRequired) || errors.Is(opErr, application.ErrQuantityMismatch) {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid request", opErr.Error())
+		return
+	}
+	if errors.Is(opErr, domain.ErrAlreadyCompensated) {
+		h.logger.Warn("Stock update rejected, already compensated", "action", req.Action, "order_no", req.OrderNo)
+		response.ErrorWithStatus(c, http.StatusConflict, "Failed to update stock", opErr.Error())
+		return
+	}
 	if opErr != nil {
 		h.logger.Error("Failed to update stock", "error", opErr)
 		response.ErrorWithStatus(c, http.StatusInternalServerError, "Failed to update stock", opErr.Error())
@@ -169,15 +211,21 @@ func (h *Handler) ListInventories(c *gin.Context) {
 }
 
 // DeleteInventory 处理删除库存记录的HTTP请求。
+// 请求路径: /inventory/:sku_id?warehouse_id=，仓库ID必填。
 func (h *Handler) DeleteInventory(c *gin.Context) {
 	skuID, err := strconv.ParseUint(c.Param("sku_id"), 10, 64)
 	if err != nil {
 		response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid SKU ID", err.Error())
 		return
 	}
+	warehouseID, err := strconv.ParseUint(c.Query("warehouse_id"), 10, 64)
+	if err != nil || warehouseID == 0 {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid warehouse ID", "warehouse_id is required")
+		return
+	}
 
-	if err := h.app.DeleteInventory(c.Request.Context(), skuID); err != nil {
-		h.logger.Error("Failed to delete inventory", "sku_id", skuID, "error", err)
+	if err := h.app.DeleteInventory(c.Request.Context(), skuID, warehouseID); err != nil {
+		h.logger.Error("Failed to delete inventory", "sku_id", skuID, "warehouse_id", warehouseID, "error", err)
 		response.ErrorWithStatus(c, http.StatusInternalServerError, "Failed to delete inventory", err.Error())
 		return
 	}
@@ -186,12 +234,18 @@ func (h *Handler) DeleteInventory(c *gin.Context) {
 }
 
 // GetInventoryLogs 处理获取库存变更日志的HTTP请求。
+// 请求路径: /inventory/:sku_id/logs?warehouse_id=，仓库ID必填。
 func (h *Handler) GetInventoryLogs(c *gin.Context) {
 	skuID, err := strconv.ParseUint(c.Param("sku_id"), 10, 64)
 	if err != nil {
 		response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid SKU ID", err.Error())
 		return
 	}
+	warehouseID, err := strconv.ParseUint(c.Query("warehouse_id"), 10, 64)
+	if err != nil || warehouseID == 0 {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid warehouse ID", "warehouse_id is required")
+		return
+	}
 
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
 	if err != nil || page <= 0 {
@@ -202,11 +256,8 @@ func (h *Handler) GetInventoryLogs(c *gin.Context) {
 		pageSize = 10
 	}
 
-	// 这里的业务逻辑可能需要先根据 sku_id 查到 inventory_id，
-	// 但 domain.Inventory 模型中 sku_id 已经是 key。
-	// 这里假设 GetInventoryLogs 接受的第一个参数是 inventory_id (uint64)，
-	// 我们可以先获取 inventory 实体。
-	inv, err := h.app.GetInventory(c.Request.Context(), skuID)
+	// 日志按库存记录归档，先根据 (sku_id, warehouse_id) 查到 inventory_id。
+	inv, _, err := h.app.GetInventory(c.Request.Context(), skuID, warehouseID)
 	if err != nil || inv == nil {
 		response.ErrorWithStatus(c, http.StatusNotFound, "Inventory not found", "")
 		return
@@ -227,6 +278,58 @@ func (h *Handler) GetInventoryLogs(c *gin.Context) {
 	})
 }
 
+// ConfirmReservation 处理确认库存预占的HTTP请求。
+// HTTP 方法: POST
+// 请求路径: /reservations/:reservation_id/confirm
+func (h *Handler) ConfirmReservation(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"` // 原因，选填。
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	reservation, err := h.app.ConfirmReservation(c.Request.Context(), c.Param("reservation_id"), req.Reason)
+	if err != nil {
+		h.logger.Error("Failed to confirm reservation", "reservation_id", c.Param("reservation_id"), "error", err)
+		response.ErrorWithStatus(c, reservationStatus(err), "Failed to confirm reservation", err.Error())
+		return
+	}
+
+	response.SuccessWithStatus(c, http.StatusOK, "Reservation confirmed successfully", reservation)
+}
+
+// ReleaseReservation 处理释放库存预占的HTTP请求。
+// HTTP 方法: POST
+// 请求路径: /reservations/:reservation_id/release
+func (h *Handler) ReleaseReservation(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"` // 原因，选填。
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	reservation, err := h.app.ReleaseReservation(c.Request.Context(), c.Param("reservation_id"), req.Reason)
+	if err != nil {
+		h.logger.Error("Failed to release reservation", "reservation_id", c.Param("reservation_id"), "error", err)
+		response.ErrorWithStatus(c, reservationStatus(err), "Failed to release reservation", err.Error())
+		return
+	}
+
+	response.SuccessWithStatus(c, http.StatusOK, "Reservation released successfully", reservation)
+}
+
+// reservationStatus 将预占相关的领域错误映射为 HTTP 状态码。
+func reservationStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrReservationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidReservationID):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrReservationClosed):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // RegisterRoutes 在给定的Gin路由组中注册Inventory模块的HTTP路由。
 // r: Gin的路由组。
 func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
@@ -240,4 +343,11 @@ func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 		group.POST("/:sku_id/stock", h.UpdateStock)    // 更新库存。
 		group.GET("/:sku_id/logs", h.GetInventoryLogs) // 获取库存日志。
 	}
+
+	// /reservations 路由组，用于库存预占的确认与释放。
+	reservations := r.Group("/reservations")
+	{
+		reservations.POST("/:reservation_id/confirm", h.ConfirmReservation) // 确认预占。
+		reservations.POST("/:reservation_id/release", h.ReleaseReservation) // 释放预占。
+	}
 }
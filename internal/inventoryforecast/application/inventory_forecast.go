@@ -2,6 +2,7 @@ package application
 
 import (
 	"context"
+	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/inventoryforecast/domain"
 )
@@ -27,6 +28,11 @@ func (s *InventoryForecastService) GenerateForecast(ctx context.Context, skuID u
 	return s.manager.GenerateForecast(ctx, skuID)
 }
 
+// GenerateForecasts 为近期有销量的全部SKU批量生成销量预测。
+func (s *InventoryForecastService) GenerateForecasts(ctx context.Context, asOf time.Time) (int, error) {
+	return s.manager.GenerateForecasts(ctx, asOf)
+}
+
 // --- 读操作（委托给 Query）---
 
 // GetForecast 获取指定SKU的最新销量预测详情。
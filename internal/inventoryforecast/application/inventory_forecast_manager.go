@@ -2,6 +2,8 @@ package application
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"math"
 	"time"
@@ -109,6 +111,38 @@ func (m *InventoryForecastManager) GenerateForecast(ctx context.Context, skuID u
 	return forecast, nil
 }
 
+// forecastBatchSize 批量预测每次拉取的 SKU 数量。
+const forecastBatchSize = 500
+
+// GenerateForecasts 为 asOf 前 30 天内有销量的全部 SKU 重新生成销量预测。
+// 单个 SKU 失败不影响其余 SKU，失败的 SKU 由调度中心重试作业时重新生成。
+func (m *InventoryForecastManager) GenerateForecasts(ctx context.Context, asOf time.Time) (generated int, err error) {
+	since := asOf.AddDate(0, 0, -30)
+	var (
+		errs     []error
+		afterSKU uint64
+	)
+	for {
+		skuIDs, err := m.repo.ListSKUsWithSales(ctx, since, afterSKU, forecastBatchSize)
+		if err != nil {
+			return generated, err
+		}
+		for _, skuID := range skuIDs {
+			if _, err := m.GenerateForecast(ctx, skuID); err != nil {
+				errs = append(errs, fmt.Errorf("sku %d: %w", skuID, err))
+				continue
+			}
+			generated++
+		}
+		if len(skuIDs) < forecastBatchSize {
+			break
+		}
+		afterSKU = skuIDs[len(skuIDs)-1]
+	}
+	m.logger.InfoContext(ctx, "batch forecast finished", "as_of", asOf, "generated", generated, "failed", len(errs))
+	return generated, errors.Join(errs...)
+}
+
 // AnalyzeStockoutRisk 分析缺货风险。
 func (m *InventoryForecastManager) AnalyzeStockoutRisk(ctx context.Context, skuID uint64, currentStock int32) (*domain.StockoutRisk, error) {
 	// 获取或生成预测
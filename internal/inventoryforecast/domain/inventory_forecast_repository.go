@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"time"
 )
 
 // InventoryForecastRepository 是库存预测模块的仓储接口。
@@ -10,6 +11,8 @@ type InventoryForecastRepository interface {
 	SaveForecast(ctx context.Context, forecast *SalesForecast) error
 	GetForecastBySKU(ctx context.Context, skuID uint64) (*SalesForecast, error)
 	GetSalesHistory(ctx context.Context, skuID uint64, days int) ([]int32, error)
+	// ListSKUsWithSales 列出 since 之后有销量记录且 ID 大于 afterSKU 的 SKU，按 ID 升序，用于批量生成预测。
+	ListSKUsWithSales(ctx context.Context, since time.Time, afterSKU uint64, limit int) ([]uint64, error)
 
 	// 库存预警
 	SaveWarning(ctx context.Context, warning *InventoryWarning) error
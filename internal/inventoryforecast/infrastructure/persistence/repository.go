@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/inventoryforecast/domain"
 
@@ -134,6 +135,21 @@ func (r *inventoryForecastRepository) GetSalesHistory(ctx context.Context, skuID
 	return result, nil
 }
 
+// ListSKUsWithSales 列出近期有销量的 SKU。
+func (r *inventoryForecastRepository) ListSKUsWithSales(ctx context.Context, since time.Time, afterSKU uint64, limit int) ([]uint64, error) {
+	var skuIDs []uint64
+	err := r.db.WithContext(ctx).Model(&domain.AggregatedDailySales{}).
+		Distinct("sku_id").
+		Where("date >= ? AND sku_id > ?", since, afterSKU).
+		Order("sku_id asc").
+		Limit(limit).
+		Pluck("sku_id", &skuIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return skuIDs, nil
+}
+
 func (r *inventoryForecastRepository) ListStockoutRisks(ctx context.Context, level domain.StockoutRiskLevel, offset, limit int) ([]*domain.StockoutRisk, int64, error) {
 	var list []*domain.StockoutRisk
 	var total int64
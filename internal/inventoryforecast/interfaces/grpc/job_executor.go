@@ -0,0 +1,23 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/inventoryforecast/application"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/jobexecutor"
+	"github.com/wyfcoding/pkg/idempotency"
+)
+
+// NewJobExecutor 创建销量预测作业执行器，承接调度中心的每日销量预测作业。
+// 每次执行为计划触发时间前 30 天内有销量的 SKU 重新生成预测。
+func NewJobExecutor(app *application.InventoryForecastService, idem idempotency.Manager) *jobexecutor.Server {
+	return jobexecutor.NewServer(idem, func(ctx context.Context, asOf time.Time) (string, error) {
+		generated, err := app.GenerateForecasts(ctx, asOf)
+		if err != nil {
+			return "", fmt.Errorf("batch forecast failed after %d generated: %w", generated, err)
+		}
+		return fmt.Sprintf("generated forecasts for %d skus as of %s", generated, asOf.Format(time.RFC3339)), nil
+	})
+}
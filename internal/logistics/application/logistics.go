@@ -10,24 +10,26 @@ import (
 
 // Logistics 是物流应用服务的门面。
 type Logistics struct {
-	Manager *LogisticsManager
-	Query   *LogisticsQuery
+	Manager  *LogisticsManager
+	Query    *LogisticsQuery
+	Tracking *TrackingService
 }
 
 // NewLogistics 创建物流服务门面实例。
-func NewLogistics(manager *LogisticsManager, query *LogisticsQuery) *Logistics {
+func NewLogistics(manager *LogisticsManager, query *LogisticsQuery, tracking *TrackingService) *Logistics {
 	return &Logistics{
-		Manager: manager,
-		Query:   query,
+		Manager:  manager,
+		Query:    query,
+		Tracking: tracking,
 	}
 }
 
 // CreateLogistics 创建物流运单记录。
-func (s *Logistics) CreateLogistics(ctx context.Context, orderID uint64, orderNo, trackingNo, carrier, carrierCode string,
+func (s *Logistics) CreateLogistics(ctx context.Context, orderID, userID uint64, shipmentType domain.ShipmentType, orderNo, trackingNo, carrier, carrierCode string,
 	senderName, senderPhone, senderAddress string, senderLat, senderLon float64,
 	receiverName, receiverPhone, receiverAddress string, receiverLat, receiverLon float64,
 ) (*domain.Logistics, error) {
-	return s.Manager.CreateLogistics(ctx, orderID, orderNo, trackingNo, carrier, carrierCode,
+	return s.Manager.CreateLogistics(ctx, orderID, userID, shipmentType, orderNo, trackingNo, carrier, carrierCode,
 		senderName, senderPhone, senderAddress, senderLat, senderLon,
 		receiverName, receiverPhone, receiverAddress, receiverLat, receiverLon)
 }
@@ -66,3 +68,13 @@ func (s *Logistics) ListLogistics(ctx context.Context, page, pageSize int) ([]*d
 func (s *Logistics) OptimizeDeliveryRoute(ctx context.Context, logisticsID uint64, destinations []algorithm.Location) (*domain.DeliveryRoute, error) {
 	return s.Manager.OptimizeDeliveryRoute(ctx, logisticsID, destinations)
 }
+
+// CarrierWebhook 返回承运商的轨迹推送解析器。
+func (s *Logistics) CarrierWebhook(carrier string) (domain.CarrierWebhook, error) {
+	return s.Tracking.Webhook(carrier)
+}
+
+// HandleCarrierWebhook 校验并应用承运商轨迹推送，签收时自动确认订单送达并通知买家。
+func (s *Logistics) HandleCarrierWebhook(ctx context.Context, webhook domain.CarrierWebhook, req *domain.TrackingRequest) (int, error) {
+	return s.Tracking.HandleWebhook(ctx, webhook, req)
+}
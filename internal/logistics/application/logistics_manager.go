@@ -3,6 +3,7 @@ package application
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"time"
 
@@ -127,14 +128,20 @@ func (m *LogisticsManager) CalculatePackaging(items []algorithm.Item) []*algorit
 	return m.packingOptimizer.FFD(items)
 }
 
-// CreateLogistics 创建一个新的物流单。
-func (m *LogisticsManager) CreateLogistics(ctx context.Context, orderID uint64, orderNo, trackingNo, carrier, carrierCode string,
+// CreateLogistics 创建一个新的物流单。shipmentType 为空时视为订单发货。
+func (m *LogisticsManager) CreateLogistics(ctx context.Context, orderID, userID uint64, shipmentType domain.ShipmentType, orderNo, trackingNo, carrier, carrierCode string,
 	senderName, senderPhone, senderAddress string, senderLat, senderLon float64,
 	receiverName, receiverPhone, receiverAddress string, receiverLat, receiverLon float64,
 ) (*domain.Logistics, error) {
-	logistics := domain.NewLogistics(orderID, orderNo, trackingNo, carrier, carrierCode,
+	logistics := domain.NewLogistics(orderID, userID, orderNo, trackingNo, carrier, carrierCode,
 		senderName, senderPhone, senderAddress, senderLat, senderLon,
 		receiverName, receiverPhone, receiverAddress, receiverLat, receiverLon)
+	if shipmentType != "" {
+		if !shipmentType.Valid() {
+			return nil, fmt.Errorf("%w: %s", domain.ErrInvalidShipmentType, shipmentType)
+		}
+		logistics.ShipmentType = shipmentType
+	}
 
 	if err := m.repo.Save(ctx, logistics); err != nil {
 		m.logger.ErrorContext(ctx, "failed to save logistics", "order_id", orderID, "error", err)
@@ -0,0 +1,311 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	notificationv1 "github.com/wyfcoding/ecommerce/goapi/notification/v1"
+	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
+	"github.com/wyfcoding/ecommerce/internal/logistics/domain"
+)
+
+// TrackingConfig 承运商轨迹接入配置，对应配置文件的 [tracking] 段。
+type TrackingConfig struct {
+	PollInterval time.Duration `mapstructure:"poll_interval"` // 同一运单两次主动查询的间隔，默认 30 分钟
+	PollWindow   time.Duration `mapstructure:"poll_window"`   // 只查询该时长内创建的运单，默认 30 天
+	BatchSize    int           `mapstructure:"batch_size"`    // 每轮主动查询与签收重试的最大运单数，默认 100
+}
+
+// deliverySyncGrace 签收后立即同步失败的运单，至少间隔该时长才由轮询器重试，避免与签收时的同步重复。
+const deliverySyncGrace = time.Minute
+
+// TrackingService 接入承运商轨迹：校验推送、主动查询并应用轨迹事件，签收后确认订单送达并通知买家。
+type TrackingService struct {
+	repo               domain.LogisticsRepository
+	webhooks           map[string]domain.CarrierWebhook
+	trackers           map[string]domain.CarrierTracker
+	orderClient        orderv1.OrderServiceClient
+	notificationClient notificationv1.NotificationServiceClient
+	cfg                TrackingConfig
+	logger             *slog.Logger
+}
+
+// NewTrackingService 创建承运商轨迹服务，承运商编码不区分大小写。
+func NewTrackingService(
+	repo domain.LogisticsRepository,
+	webhooks []domain.CarrierWebhook,
+	trackers []domain.CarrierTracker,
+	orderClient orderv1.OrderServiceClient,
+	notificationClient notificationv1.NotificationServiceClient,
+	cfg TrackingConfig,
+	logger *slog.Logger,
+) *TrackingService {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 30 * time.Minute
+	}
+	if cfg.PollWindow <= 0 {
+		cfg.PollWindow = 30 * 24 * time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	s := &TrackingService{
+		repo:               repo,
+		webhooks:           make(map[string]domain.CarrierWebhook, len(webhooks)),
+		trackers:           make(map[string]domain.CarrierTracker, len(trackers)),
+		orderClient:        orderClient,
+		notificationClient: notificationClient,
+		cfg:                cfg,
+		logger:             logger,
+	}
+	for _, w := range webhooks {
+		s.webhooks[strings.ToUpper(w.Carrier())] = w
+	}
+	for _, t := range trackers {
+		s.trackers[strings.ToUpper(t.Carrier())] = t
+	}
+	return s
+}
+
+// Webhook 返回承运商的推送解析器。
+func (s *TrackingService) Webhook(carrier string) (domain.CarrierWebhook, error) {
+	w, ok := s.webhooks[strings.ToUpper(carrier)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", domain.ErrUnsupportedCarrier, carrier)
+	}
+	return w, nil
+}
+
+// HandleWebhook 校验承运商推送并应用其中的轨迹事件，返回新记录的事件数。
+// 未知运单与非本承运商的运单只记录日志，不影响应答，避免承运商无限重推。
+func (s *TrackingService) HandleWebhook(ctx context.Context, webhook domain.CarrierWebhook, req *domain.TrackingRequest) (int, error) {
+	events, err := webhook.Parse(ctx, req)
+	if err != nil {
+		s.logger.WarnContext(ctx, "carrier tracking push rejected", "carrier", webhook.Carrier(), "error", err)
+		return 0, err
+	}
+
+	byTrackingNo := make(map[string][]*domain.TrackingEvent)
+	var trackingNos []string
+	for _, e := range events {
+		if _, ok := byTrackingNo[e.TrackingNo]; !ok {
+			trackingNos = append(trackingNos, e.TrackingNo)
+		}
+		byTrackingNo[e.TrackingNo] = append(byTrackingNo[e.TrackingNo], e)
+	}
+
+	recorded := 0
+	for _, trackingNo := range trackingNos {
+		logistics, err := s.repo.GetByTrackingNo(ctx, trackingNo)
+		if errors.Is(err, domain.ErrLogisticsNotFound) {
+			s.logger.WarnContext(ctx, "tracking push for unknown shipment", "carrier", webhook.Carrier(), "tracking_no", trackingNo)
+			continue
+		}
+		if err != nil {
+			return recorded, err
+		}
+		if !strings.EqualFold(logistics.CarrierCode, webhook.Carrier()) {
+			s.logger.WarnContext(ctx, "tracking push for shipment of another carrier", "carrier", webhook.Carrier(), "tracking_no", trackingNo, "shipment_carrier", logistics.CarrierCode)
+			continue
+		}
+		n, err := s.apply(ctx, uint64(logistics.ID), byTrackingNo[trackingNo], nil)
+		if err != nil {
+			return recorded, err
+		}
+		recorded += n
+	}
+	s.logger.InfoContext(ctx, "carrier tracking push handled", "carrier", webhook.Carrier(), "events", len(events), "recorded", recorded)
+	return recorded, nil
+}
+
+// PollDue 主动查询一批到期运单的轨迹。查询失败的运单同样顺延到下个周期，避免阻塞后续运单。
+func (s *TrackingService) PollDue(ctx context.Context, now time.Time) {
+	if len(s.trackers) == 0 {
+		return
+	}
+	carriers := make([]string, 0, len(s.trackers))
+	for code := range s.trackers {
+		carriers = append(carriers, code)
+	}
+	due, err := s.repo.FindDueForPoll(ctx, carriers, now.Add(-s.cfg.PollWindow), now, s.cfg.BatchSize)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to list shipments due for tracking poll", "error", err)
+		return
+	}
+
+	next := now.Add(s.cfg.PollInterval)
+	for _, logistics := range due {
+		events, err := s.trackers[strings.ToUpper(logistics.CarrierCode)].Track(ctx, logistics)
+		if err != nil {
+			s.logger.WarnContext(ctx, "carrier tracking poll failed", "carrier", logistics.CarrierCode, "tracking_no", logistics.TrackingNo, "error", err)
+			events = nil
+		}
+		if _, err := s.apply(ctx, uint64(logistics.ID), events, &next); err != nil {
+			s.logger.ErrorContext(ctx, "failed to apply polled tracking events", "logistics_id", logistics.ID, "error", err)
+		}
+	}
+}
+
+// RetrySync 重试签收后未完成的订单送达确认与买家通知。
+func (s *TrackingService) RetrySync(ctx context.Context, now time.Time) {
+	pending, err := s.repo.FindPendingDeliverySync(ctx, now.Add(-deliverySyncGrace), s.cfg.BatchSize)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to list shipments pending delivery sync", "error", err)
+		return
+	}
+	for _, logistics := range pending {
+		if err := s.syncDelivery(ctx, logistics); err != nil {
+			s.logger.WarnContext(ctx, "delivery sync retry failed", "logistics_id", logistics.ID, "order_id", logistics.OrderID, "error", err)
+		}
+	}
+}
+
+// apply 加锁应用一个运单的轨迹事件，nextPoll 非空时同时安排下次主动查询；运单因此签收时立即同步订单与通知。
+func (s *TrackingService) apply(ctx context.Context, id uint64, events []*domain.TrackingEvent, nextPoll *time.Time) (int, error) {
+	// 承运商可能按时间倒序或乱序上报，按发生时间应用，使状态按真实顺序推进
+	slices.SortStableFunc(events, func(a, b *domain.TrackingEvent) int {
+		return a.OccurredAt.Compare(b.OccurredAt)
+	})
+
+	var recorded int
+	var delivered bool
+	logistics, err := s.repo.UpdateLocked(ctx, id, func(l *domain.Logistics) (bool, error) {
+		recorded, delivered = 0, false
+		for _, e := range events {
+			r, d := l.ApplyTrackingEvent(e)
+			if r {
+				recorded++
+			}
+			delivered = delivered || d
+		}
+		if nextPoll != nil {
+			l.SchedulePoll(*nextPoll)
+			return true, nil
+		}
+		return recorded > 0, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if delivered {
+		s.logger.InfoContext(ctx, "shipment delivered by carrier event", "logistics_id", id, "order_id", logistics.OrderID, "tracking_no", logistics.TrackingNo)
+		if err := s.syncDelivery(ctx, logistics); err != nil {
+			s.logger.WarnContext(ctx, "delivery sync failed, will retry", "logistics_id", id, "order_id", logistics.OrderID, "error", err)
+		}
+	}
+	return recorded, nil
+}
+
+// syncDelivery 确认订单送达并通知买家，完成后清除待同步标记。
+// 订单确认失败时保留标记由轮询器重试；通知为尽力而为，失败不重试。
+func (s *TrackingService) syncDelivery(ctx context.Context, logistics *domain.Logistics) error {
+	if !logistics.SyncPending {
+		return nil
+	}
+	if logistics.ShipmentType == domain.ShipmentTypeOrder {
+		if err := s.deliverOrder(ctx, logistics); err != nil {
+			return err
+		}
+	}
+	s.notifyDelivered(ctx, logistics)
+
+	_, err := s.repo.UpdateLocked(ctx, uint64(logistics.ID), func(l *domain.Logistics) (bool, error) {
+		if !l.SyncPending {
+			return false, nil
+		}
+		l.MarkDeliverySynced()
+		return true, nil
+	})
+	return err
+}
+
+// deliverOrder 通过订单服务确认订单送达。买家可能已先行确认收货，订单已送达或已完成时视为成功。
+func (s *TrackingService) deliverOrder(ctx context.Context, logistics *domain.Logistics) error {
+	_, err := s.orderClient.UpdateOrderStatus(ctx, &orderv1.UpdateOrderStatusRequest{
+		Id:        logistics.OrderID,
+		UserId:    logistics.UserID,
+		NewStatus: orderv1.OrderStatus_DELIVERED,
+		Operator:  "carrier:" + logistics.CarrierCode,
+	})
+	if err == nil {
+		return nil
+	}
+	order, getErr := s.orderClient.GetOrderByID(ctx, &orderv1.GetOrderByIDRequest{Id: logistics.OrderID, UserId: logistics.UserID})
+	if getErr == nil && (order.Status == orderv1.OrderStatus_DELIVERED || order.Status == orderv1.OrderStatus_COMPLETED) {
+		return nil
+	}
+	return fmt.Errorf("failed to deliver order %d: %w", logistics.OrderID, err)
+}
+
+// notifyDelivered 发送包裹签收站内通知。
+func (s *TrackingService) notifyDelivered(ctx context.Context, logistics *domain.Logistics) {
+	content := fmt.Sprintf("您的订单 %s 的包裹已签收 (%s %s)。", logistics.OrderNo, logistics.Carrier, logistics.TrackingNo)
+	if logistics.ShipmentType == domain.ShipmentTypeReplacement {
+		content = fmt.Sprintf("您的订单 %s 的换货包裹已签收 (%s %s)。", logistics.OrderNo, logistics.Carrier, logistics.TrackingNo)
+	}
+	if _, err := s.notificationClient.SendNotification(ctx, &notificationv1.SendNotificationRequest{
+		UserId:  logistics.UserID,
+		Type:    "ORDER",
+		Title:   "包裹已签收",
+		Content: content,
+	}); err != nil {
+		s.logger.WarnContext(ctx, "failed to send delivery notification", "logistics_id", logistics.ID, "user_id", logistics.UserID, "error", err)
+	}
+}
+
+// TrackingPoller 周期性主动查询不支持推送的承运商轨迹，并重试签收后的订单同步。
+type TrackingPoller struct {
+	tracking *TrackingService
+	logger   *slog.Logger
+	interval time.Duration
+	stopChan chan struct{}
+}
+
+// NewTrackingPoller 创建轨迹轮询任务。
+func NewTrackingPoller(tracking *TrackingService, logger *slog.Logger) *TrackingPoller {
+	return &TrackingPoller{
+		tracking: tracking,
+		logger:   logger.With("module", "tracking_poller"),
+		interval: time.Minute,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动轮询循环。
+func (p *TrackingPoller) Start() {
+	p.logger.Info("tracking poller started", "interval", p.interval)
+	ticker := time.NewTicker(p.interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				p.poll()
+			case <-p.stopChan:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止轮询循环。
+func (p *TrackingPoller) Stop() {
+	close(p.stopChan)
+	p.logger.Info("tracking poller stopped")
+}
+
+// poll 执行一轮主动查询与签收同步重试。
+func (p *TrackingPoller) poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval*5)
+	defer cancel()
+
+	now := time.Now()
+	p.tracking.PollDue(ctx, now)
+	p.tracking.RetrySync(ctx, now)
+}
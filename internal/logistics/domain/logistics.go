@@ -33,6 +33,8 @@ type Logistics struct {
 	gorm.Model                        // 嵌入gorm.Model，包含ID, CreatedAt, UpdatedAt, DeletedAt等通用字段。
 	OrderID         uint64            `gorm:"not null;index;comment:订单ID" json:"order_id"`                  // 关联的订单ID，索引字段。
 	OrderNo         string            `gorm:"type:varchar(64);not null;comment:订单号" json:"order_no"`        // 关联的订单号。
+	UserID          uint64            `gorm:"index;comment:买家ID" json:"user_id"`                            // 订单所属买家，订单服务按用户分库，同步送达状态时需要。
+	ShipmentType    ShipmentType      `gorm:"type:varchar(16);comment:运单类型" json:"shipment_type"`           // 运单业务类型，决定签收后的联动动作。
 	TrackingNo      string            `gorm:"type:varchar(64);uniqueIndex;comment:物流单号" json:"tracking_no"` // 物流单号，唯一索引。
 	Carrier         string            `gorm:"type:varchar(64);comment:承运商" json:"carrier"`                  // 承运物流公司的名称。
 	CarrierCode     string            `gorm:"type:varchar(32);comment:承运商编码" json:"carrier_code"`           // 承运物流公司的编码。
@@ -53,16 +55,21 @@ type Logistics struct {
 	Traces          []*LogisticsTrace `gorm:"foreignKey:LogisticsID" json:"traces"`                         // 关联的物流轨迹记录列表，一对多关系。
 	Route           *DeliveryRoute    `gorm:"foreignKey:LogisticsID" json:"route"`                          // 关联的配送路线信息，一对一关系。
 	RiderID         string            `gorm:"type:varchar(64);comment:骑手ID" json:"rider_id"`                // 负责配送的骑手ID。
+	LastEventAt     *time.Time        `gorm:"comment:最近承运商事件时间" json:"last_event_at"`                       // 已应用的最新承运商事件发生时间，早于该时间的事件视为乱序。
+	NextPollAt      *time.Time        `gorm:"index;comment:下次主动查询时间" json:"next_poll_at"`                   // 不支持推送的承运商由轮询器按此时间主动查询，终态后清空。
+	SyncPending     bool              `gorm:"index;comment:待同步签收" json:"sync_pending"`                      // 已签收但尚未确认订单送达或通知买家。
 }
 
 // LogisticsTrace 实体代表物流单的一条轨迹记录。
 type LogisticsTrace struct {
-	gorm.Model         // 嵌入gorm.Model。
-	LogisticsID uint64 `gorm:"not null;index;comment:物流ID" json:"logistics_id"`           // 关联的物流单ID，索引字段。
-	TrackingNo  string `gorm:"type:varchar(64);not null;comment:物流单号" json:"tracking_no"` // 关联的物流单号。
-	Location    string `gorm:"type:varchar(255);comment:位置" json:"location"`              // 轨迹发生的位置。
-	Description string `gorm:"type:text;comment:描述" json:"description"`                   // 轨迹描述，例如“您的包裹已出库”。
-	Status      string `gorm:"type:varchar(32);comment:状态描述" json:"status"`               // 轨迹发生时的物流状态描述。
+	gorm.Model             // 嵌入gorm.Model。
+	LogisticsID uint64     `gorm:"not null;index;comment:物流ID" json:"logistics_id"`                          // 关联的物流单ID，索引字段。
+	TrackingNo  string     `gorm:"type:varchar(64);not null;comment:物流单号" json:"tracking_no"`                // 关联的物流单号。
+	Location    string     `gorm:"type:varchar(255);comment:位置" json:"location"`                             // 轨迹发生的位置。
+	Description string     `gorm:"type:text;comment:描述" json:"description"`                                  // 轨迹描述，例如“您的包裹已出库”。
+	Status      string     `gorm:"type:varchar(32);comment:状态描述" json:"status"`                              // 轨迹发生时的物流状态描述，承运商事件为其原始状态码。
+	EventKey    *string    `gorm:"type:varchar(64);uniqueIndex;comment:承运商事件去重键" json:"event_key,omitempty"` // 承运商事件的去重键，手工录入的轨迹为空。
+	OccurredAt  *time.Time `gorm:"comment:事件发生时间" json:"occurred_at,omitempty"`                              // 承运商上报的事件发生时间。
 }
 
 // DeliveryRoute 实体代表一个物流单的配送路线规划信息。
@@ -74,16 +81,18 @@ type DeliveryRoute struct {
 }
 
 // NewLogistics 创建并返回一个新的 Logistics 实体实例。
-// orderID, orderNo: 订单信息。
+// orderID, userID, orderNo: 订单信息。
 // trackingNo, carrier, carrierCode: 运单和承运商信息。
 // senderName, senderPhone, senderAddress, senderLat, senderLon: 发件人信息。
 // receiverName, receiverPhone, receiverAddress, receiverLat, receiverLon: 收件人信息。
-func NewLogistics(orderID uint64, orderNo, trackingNo, carrier, carrierCode string,
+func NewLogistics(orderID, userID uint64, orderNo, trackingNo, carrier, carrierCode string,
 	senderName, senderPhone, senderAddress string, senderLat, senderLon float64,
 	receiverName, receiverPhone, receiverAddress string, receiverLat, receiverLon float64,
 ) *Logistics {
 	return &Logistics{
 		OrderID:         orderID,
+		UserID:          userID,
+		ShipmentType:    ShipmentTypeOrder,
 		OrderNo:         orderNo,
 		TrackingNo:      trackingNo,
 		Carrier:         carrier,
@@ -119,7 +128,11 @@ func (l *Logistics) Deliver() {
 }
 
 // Complete 更新物流状态为“已签收”，并记录签收时间。
+// 首次签收时标记待同步，由应用层确认订单送达并通知买家。
 func (l *Logistics) Complete() {
+	if l.Status != LogisticsStatusDelivered {
+		l.SyncPending = l.UserID != 0 && l.ShipmentType != ShipmentTypeReturn
+	}
 	l.Status = LogisticsStatusDelivered
 	now := time.Now()
 	l.DeliveredAt = &now
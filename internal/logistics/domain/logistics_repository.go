@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"time"
 )
 
 // LogisticsRepository 是物流模块的仓储接口。
@@ -21,4 +22,12 @@ type LogisticsRepository interface {
 	GetByOrderID(ctx context.Context, orderID uint64) (*Logistics, error)
 	// List 列出所有物流实体，支持分页。
 	List(ctx context.Context, offset, limit int) ([]*Logistics, int64, error)
+	// UpdateLocked 在事务内加行锁读取物流单 (含轨迹) 并交给 fn 修改，fn 返回 true 时保存。
+	// 用于承运商推送与主动查询并发更新同一运单的场景。
+	UpdateLocked(ctx context.Context, id uint64, fn func(logistics *Logistics) (bool, error)) (*Logistics, error)
+	// FindDueForPoll 查询指定承运商中 createdAfter 之后创建、到期需要主动查询轨迹的未终结运单。
+	// 从未查询过的运单最先返回，其余按下次查询时间升序。
+	FindDueForPoll(ctx context.Context, carrierCodes []string, createdAfter, now time.Time, limit int) ([]*Logistics, error)
+	// FindPendingDeliverySync 查询 updatedBefore 之前签收、尚未同步订单送达或通知买家的运单。
+	FindPendingDeliverySync(ctx context.Context, updatedBefore time.Time, limit int) ([]*Logistics, error)
 }
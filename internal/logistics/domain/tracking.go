@@ -0,0 +1,202 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 承运商轨迹接入相关错误。
+var (
+	ErrUnsupportedCarrier       = errors.New("no tracking adapter for carrier") // 未配置该承运商的推送或查询接入
+	ErrInvalidTrackingSignature = errors.New("invalid tracking signature")      // 推送签名或时间戳校验失败
+	ErrCarrierMismatch          = errors.New("tracking carrier mismatch")       // 推送方与运单所属承运商不一致
+	ErrInvalidShipmentType      = errors.New("invalid shipment type")           // 未定义的运单类型
+)
+
+// ShipmentType 定义了运单的业务类型。
+type ShipmentType string
+
+const (
+	ShipmentTypeOrder       ShipmentType = "ORDER"       // 订单发货：签收后确认订单送达并通知买家。
+	ShipmentTypeReplacement ShipmentType = "REPLACEMENT" // 售后换货补发：签收后通知买家。
+	ShipmentTypeReturn      ShipmentType = "RETURN"      // 售后退货寄回：寄往仓库，由售后服务跟进验收。
+)
+
+// Valid 判断运单类型是否为已定义的类型。
+func (t ShipmentType) Valid() bool {
+	return t == ShipmentTypeOrder || t == ShipmentTypeReplacement || t == ShipmentTypeReturn
+}
+
+// Valid 判断物流状态是否为已定义的状态。
+func (s LogisticsStatus) Valid() bool {
+	return s >= LogisticsStatusPending && s <= LogisticsStatusException
+}
+
+// Terminal 判断物流状态是否为终态 (已签收或已退回)。
+func (s LogisticsStatus) Terminal() bool {
+	return s == LogisticsStatusDelivered || s == LogisticsStatusReturned
+}
+
+// CarrierStatusMap 承运商状态码到物流状态的映射。
+type CarrierStatusMap map[string]LogisticsStatus
+
+// Merge 返回以 overrides 覆盖后的新映射，未定义的物流状态值被忽略。
+func (m CarrierStatusMap) Merge(overrides map[string]int) CarrierStatusMap {
+	merged := make(CarrierStatusMap, len(m)+len(overrides))
+	for code, status := range m {
+		merged[code] = status
+	}
+	for code, value := range overrides {
+		if status := LogisticsStatus(value); status.Valid() {
+			merged[code] = status
+		}
+	}
+	return merged
+}
+
+// TrackingRequest 承运商轨迹推送的原始 HTTP 报文。
+// 验签必须基于原始字节，不得先解析再序列化。
+type TrackingRequest struct {
+	Headers map[string]string // 请求头
+	Body    []byte            // 原始请求体
+}
+
+// Header 大小写不敏感地读取请求头。
+func (r *TrackingRequest) Header(key string) string {
+	if v, ok := r.Headers[key]; ok {
+		return v
+	}
+	for k, v := range r.Headers {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// TrackingEvent 承运商上报的一条轨迹事件。
+type TrackingEvent struct {
+	CarrierCode   string
+	TrackingNo    string
+	EventID       string          // 承运商事件 ID，为空时按状态码、发生时间与描述去重
+	CarrierStatus string          // 承运商原始状态码
+	Status        LogisticsStatus // 映射后的物流状态
+	Mapped        bool            // 状态码是否有映射，未映射的事件只记录轨迹
+	Location      string
+	Description   string
+	OccurredAt    time.Time
+}
+
+// Key 返回事件去重键。同一事件被重复推送或被推送与查询同时获取时键相同。
+func (e *TrackingEvent) Key() string {
+	id := e.EventID
+	if id == "" {
+		id = e.CarrierStatus + "|" + strconv.FormatInt(e.OccurredAt.Unix(), 10) + "|" + e.Description
+	}
+	sum := sha256.Sum256([]byte(strings.ToUpper(e.CarrierCode) + "|" + e.TrackingNo + "|" + id))
+	return hex.EncodeToString(sum[:16])
+}
+
+// CarrierWebhook 承运商轨迹推送的验签与解析器。
+type CarrierWebhook interface {
+	// Carrier 返回承运商编码，与物流单的 CarrierCode 对应。
+	Carrier() string
+	// Parse 校验推送签名并解析出轨迹事件。
+	Parse(ctx context.Context, req *TrackingRequest) ([]*TrackingEvent, error)
+	// Reply 返回承运商约定的应答报文，非成功应答会触发承运商重推。
+	Reply(success bool) any
+}
+
+// CarrierTracker 主动查询承运商轨迹，用于不支持推送的承运商。
+type CarrierTracker interface {
+	// Carrier 返回承运商编码，与物流单的 CarrierCode 对应。
+	Carrier() string
+	// Track 查询运单的全部轨迹事件。
+	Track(ctx context.Context, logistics *Logistics) ([]*TrackingEvent, error)
+}
+
+// ApplyTrackingEvent 记录承运商轨迹事件并推进物流状态。
+// 已记录过的事件直接忽略；早于最近事件的乱序事件只补录轨迹，不回退状态与位置；
+// 已签收的运单只接受退回类状态，已退回的运单不再变更状态。
+// recorded 表示事件为新事件，delivered 表示本次事件使运单变为已签收。
+func (l *Logistics) ApplyTrackingEvent(e *TrackingEvent) (recorded, delivered bool) {
+	key := e.Key()
+	for _, t := range l.Traces {
+		if t.EventKey != nil && *t.EventKey == key {
+			return false, false
+		}
+	}
+	occurredAt := e.OccurredAt
+	l.Traces = append(l.Traces, &LogisticsTrace{
+		TrackingNo:  l.TrackingNo,
+		Location:    e.Location,
+		Description: e.Description,
+		Status:      e.CarrierStatus,
+		EventKey:    &key,
+		OccurredAt:  &occurredAt,
+	})
+
+	if l.LastEventAt != nil && occurredAt.Before(*l.LastEventAt) {
+		return true, false
+	}
+	l.LastEventAt = &occurredAt
+	if e.Location != "" {
+		l.UpdateLocation(e.Location)
+	}
+	if !e.Mapped || !l.canAdvance(e.Status) {
+		return true, false
+	}
+
+	switch e.Status {
+	case LogisticsStatusPickedUp:
+		l.PickUp()
+	case LogisticsStatusInTransit:
+		l.Transit(l.CurrentLocation)
+	case LogisticsStatusDelivering:
+		l.Deliver()
+	case LogisticsStatusDelivered:
+		l.Complete()
+		l.DeliveredAt = &occurredAt
+		delivered = true
+	case LogisticsStatusReturning:
+		l.Return()
+	case LogisticsStatusReturned:
+		l.ReturnComplete()
+	case LogisticsStatusException:
+		l.Exception(e.Description)
+	}
+	return true, delivered
+}
+
+// canAdvance 判断承运商事件能否把运单推进到目标状态。
+func (l *Logistics) canAdvance(to LogisticsStatus) bool {
+	if to == l.Status || to == LogisticsStatusPending {
+		return false
+	}
+	switch l.Status {
+	case LogisticsStatusReturned:
+		return false
+	case LogisticsStatusDelivered:
+		return to == LogisticsStatusReturning || to == LogisticsStatusReturned
+	}
+	return true
+}
+
+// SchedulePoll 安排下次主动查询，运单进入终态后不再查询。
+func (l *Logistics) SchedulePoll(next time.Time) {
+	if l.Status.Terminal() {
+		l.NextPollAt = nil
+		return
+	}
+	l.NextPollAt = &next
+}
+
+// MarkDeliverySynced 标记签收后的订单送达与买家通知已完成。
+func (l *Logistics) MarkDeliverySynced() {
+	l.SyncPending = false
+}
@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+var trackingBase = time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+
+func trackingEvent(id string, status LogisticsStatus, location string, offset time.Duration) *TrackingEvent {
+	return &TrackingEvent{
+		CarrierCode:   "SF",
+		TrackingNo:    "SF1001",
+		EventID:       id,
+		CarrierStatus: id,
+		Status:        status,
+		Mapped:        true,
+		Location:      location,
+		Description:   "event " + id,
+		OccurredAt:    trackingBase.Add(offset),
+	}
+}
+
+func TestTrackingEventKey(t *testing.T) {
+	a := trackingEvent("", LogisticsStatusInTransit, "上海", 0)
+	b := trackingEvent("", LogisticsStatusInTransit, "上海", 0)
+	b.CarrierCode = "sf"
+	if a.Key() != b.Key() {
+		t.Fatal("events without id and with the same code, time and description should share a key")
+	}
+	b.OccurredAt = b.OccurredAt.Add(time.Minute)
+	if a.Key() == b.Key() {
+		t.Fatal("events at different times should not share a key")
+	}
+
+	c := trackingEvent("r1", LogisticsStatusInTransit, "上海", 0)
+	d := trackingEvent("r1", LogisticsStatusInTransit, "上海", time.Hour)
+	d.Description = "re-pushed"
+	if c.Key() != d.Key() {
+		t.Fatal("events with the same carrier id should share a key")
+	}
+}
+
+func TestApplyTrackingEventDuplicate(t *testing.T) {
+	l := &Logistics{TrackingNo: "SF1001", Status: LogisticsStatusPending}
+	e := trackingEvent("r1", LogisticsStatusPickedUp, "深圳", 0)
+
+	if recorded, _ := l.ApplyTrackingEvent(e); !recorded {
+		t.Fatal("first event should be recorded")
+	}
+	// 同一事件被重复推送，或推送与查询同时获取
+	again := *e
+	if recorded, delivered := l.ApplyTrackingEvent(&again); recorded || delivered {
+		t.Fatalf("duplicate event = %v, %v, want ignored", recorded, delivered)
+	}
+	if len(l.Traces) != 1 {
+		t.Fatalf("traces = %d, want 1", len(l.Traces))
+	}
+}
+
+func TestApplyTrackingEventOutOfOrder(t *testing.T) {
+	l := &Logistics{TrackingNo: "SF1001", Status: LogisticsStatusPending}
+	l.ApplyTrackingEvent(trackingEvent("r3", LogisticsStatusDelivering, "上海徐汇", 3*time.Hour))
+
+	// 较早的运输事件迟到：补录轨迹，不回退状态与位置
+	recorded, delivered := l.ApplyTrackingEvent(trackingEvent("r2", LogisticsStatusInTransit, "杭州", time.Hour))
+	if !recorded || delivered {
+		t.Fatalf("late event = %v, %v, want recorded only", recorded, delivered)
+	}
+	if l.Status != LogisticsStatusDelivering || l.CurrentLocation != "上海徐汇" {
+		t.Fatalf("status = %v at %q, want delivering at 上海徐汇", l.Status, l.CurrentLocation)
+	}
+	if !l.LastEventAt.Equal(trackingBase.Add(3 * time.Hour)) {
+		t.Fatalf("LastEventAt = %v, want latest event time", l.LastEventAt)
+	}
+	if len(l.Traces) != 2 {
+		t.Fatalf("traces = %d, want 2", len(l.Traces))
+	}
+}
+
+func TestApplyTrackingEventTransitions(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   LogisticsStatus
+		to     LogisticsStatus
+		mapped bool
+		want   LogisticsStatus
+	}{
+		{name: "pending to picked up", from: LogisticsStatusPending, to: LogisticsStatusPickedUp, mapped: true, want: LogisticsStatusPickedUp},
+		{name: "exception to delivering", from: LogisticsStatusException, to: LogisticsStatusDelivering, mapped: true, want: LogisticsStatusDelivering},
+		{name: "unmapped code", from: LogisticsStatusInTransit, to: LogisticsStatusDelivered, want: LogisticsStatusInTransit},
+		{name: "delivered ignores exception", from: LogisticsStatusDelivered, to: LogisticsStatusException, mapped: true, want: LogisticsStatusDelivered},
+		{name: "delivered ignores transit", from: LogisticsStatusDelivered, to: LogisticsStatusInTransit, mapped: true, want: LogisticsStatusDelivered},
+		{name: "delivered to returning", from: LogisticsStatusDelivered, to: LogisticsStatusReturning, mapped: true, want: LogisticsStatusReturning},
+		{name: "delivered to returned", from: LogisticsStatusDelivered, to: LogisticsStatusReturned, mapped: true, want: LogisticsStatusReturned},
+		{name: "returned is final", from: LogisticsStatusReturned, to: LogisticsStatusDelivered, mapped: true, want: LogisticsStatusReturned},
+		{name: "never back to pending", from: LogisticsStatusPickedUp, to: LogisticsStatusPending, mapped: true, want: LogisticsStatusPickedUp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last := trackingBase
+			l := &Logistics{TrackingNo: "SF1001", Status: tt.from, LastEventAt: &last}
+			e := trackingEvent("r9", tt.to, "", time.Hour)
+			e.Mapped = tt.mapped
+			if recorded, delivered := l.ApplyTrackingEvent(e); !recorded || delivered {
+				t.Fatalf("ApplyTrackingEvent() = %v, %v, want recorded and not delivered", recorded, delivered)
+			}
+			if l.Status != tt.want {
+				t.Fatalf("status = %v, want %v", l.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTrackingEventDelivered(t *testing.T) {
+	l := &Logistics{TrackingNo: "SF1001", UserID: 7, ShipmentType: ShipmentTypeOrder, Status: LogisticsStatusDelivering}
+	e := trackingEvent("r80", LogisticsStatusDelivered, "上海徐汇", 2*time.Hour)
+
+	recorded, delivered := l.ApplyTrackingEvent(e)
+	if !recorded || !delivered {
+		t.Fatalf("ApplyTrackingEvent() = %v, %v, want recorded and delivered", recorded, delivered)
+	}
+	if l.Status != LogisticsStatusDelivered || !l.SyncPending {
+		t.Fatalf("status = %v, sync pending = %v, want delivered and pending sync", l.Status, l.SyncPending)
+	}
+	if l.DeliveredAt == nil || !l.DeliveredAt.Equal(e.OccurredAt) {
+		t.Fatalf("DeliveredAt = %v, want carrier sign time %v", l.DeliveredAt, e.OccurredAt)
+	}
+
+	// 代收点签收后本人再次签收，不重复触发签收联动
+	if _, delivered := l.ApplyTrackingEvent(trackingEvent("r8000", LogisticsStatusDelivered, "", 3*time.Hour)); delivered {
+		t.Fatal("second sign event should not deliver again")
+	}
+}
@@ -0,0 +1,87 @@
+package carrier
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/logistics/domain"
+)
+
+// Config 承运商轨迹接入配置，对应配置文件的 [carriers] 段。
+type Config struct {
+	SF        SFConfig        `mapstructure:"sf"`
+	Kuaidi100 Kuaidi100Config `mapstructure:"kuaidi100"`
+}
+
+// SFConfig 顺丰丰桥路由推送配置。
+type SFConfig struct {
+	Code      string         `mapstructure:"code"`       // 物流单中的承运商编码，默认 SF
+	CheckWord string         `mapstructure:"check_word"` // 丰桥校验码，用于推送验签
+	Tolerance time.Duration  `mapstructure:"tolerance"`  // 推送时间戳允许的偏差，默认 5 分钟
+	StatusMap map[string]int `mapstructure:"status_map"` // 覆盖默认的 opCode 映射，值为 LogisticsStatus
+}
+
+// Enabled 是否配置了顺丰路由推送。
+func (c SFConfig) Enabled() bool {
+	return c.CheckWord != ""
+}
+
+// Kuaidi100Config 快递100 轨迹接入配置，用于没有直连接入的承运商。
+type Kuaidi100Config struct {
+	Customer  string             `mapstructure:"customer"`   // 实时查询授权 customer
+	Key       string             `mapstructure:"key"`        // 实时查询授权 key
+	Salt      string             `mapstructure:"salt"`       // 订阅推送签名 salt
+	QueryURL  string             `mapstructure:"query_url"`  // 实时查询接口地址，默认官方地址
+	StatusMap map[string]int     `mapstructure:"status_map"` // 覆盖默认的 state 映射，值为 LogisticsStatus
+	Carriers  []Kuaidi100Carrier `mapstructure:"carriers"`   // 经快递100 接入的承运商
+}
+
+// Kuaidi100Carrier 经快递100 接入的一家承运商。
+type Kuaidi100Carrier struct {
+	Code    string `mapstructure:"code"`    // 物流单中的承运商编码，如 YTO
+	Company string `mapstructure:"company"` // 快递100 公司编码，如 yuantong
+	Push    bool   `mapstructure:"push"`    // 是否已订阅推送，未订阅的由轮询器主动查询
+}
+
+// defaultTolerance 推送时间戳默认允许的偏差，超出视为重放。
+const defaultTolerance = 5 * time.Minute
+
+// chinaTime 承运商报文中不带时区的时间均为北京时间。
+var chinaTime = time.FixedZone("CST", 8*3600)
+
+// NewTrackingAdapters 按配置创建各承运商的推送解析器与主动查询器，未配置的承运商不创建。
+func NewTrackingAdapters(cfg Config, httpClient *http.Client) ([]domain.CarrierWebhook, []domain.CarrierTracker, error) {
+	var (
+		webhooks []domain.CarrierWebhook
+		trackers []domain.CarrierTracker
+	)
+	if cfg.SF.Enabled() {
+		webhooks = append(webhooks, NewSFWebhook(cfg.SF))
+	}
+
+	k := cfg.Kuaidi100
+	for _, c := range k.Carriers {
+		if c.Code == "" || c.Company == "" {
+			return nil, nil, errors.New("kuaidi100: carrier code and company are required")
+		}
+		if c.Push {
+			if k.Salt == "" {
+				return nil, nil, fmt.Errorf("kuaidi100: salt is required to receive pushes for %s", c.Code)
+			}
+			webhooks = append(webhooks, NewKuaidi100Webhook(k, c))
+			continue
+		}
+		if k.Customer == "" || k.Key == "" {
+			return nil, nil, fmt.Errorf("kuaidi100: customer and key are required to poll %s", c.Code)
+		}
+		trackers = append(trackers, NewKuaidi100Tracker(k, c, httpClient))
+	}
+	return webhooks, trackers, nil
+}
+
+// parseChinaTime 解析 "2006-01-02 15:04:05" 格式的北京时间。
+func parseChinaTime(value string) (time.Time, error) {
+	return time.ParseInLocation(time.DateTime, value, chinaTime)
+}
@@ -0,0 +1,218 @@
+package carrier
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/logistics/domain"
+)
+
+// defaultKuaidi100QueryURL 快递100 实时查询接口。
+const defaultKuaidi100QueryURL = "https://poll.kuaidi100.com/poll/query.do"
+
+// kuaidi100StatusMap 快递100 物流状态 (state) 的默认映射。
+var kuaidi100StatusMap = domain.CarrierStatusMap{
+	"0":  domain.LogisticsStatusInTransit,  // 在途
+	"1":  domain.LogisticsStatusPickedUp,   // 揽收
+	"2":  domain.LogisticsStatusException,  // 疑难
+	"3":  domain.LogisticsStatusDelivered,  // 签收
+	"4":  domain.LogisticsStatusReturned,   // 退签
+	"5":  domain.LogisticsStatusDelivering, // 派件
+	"6":  domain.LogisticsStatusReturning,  // 退回
+	"7":  domain.LogisticsStatusInTransit,  // 转投
+	"8":  domain.LogisticsStatusInTransit,  // 清关
+	"14": domain.LogisticsStatusException,  // 拒签
+}
+
+// kuaidi100Result 实时查询结果，订阅推送的 lastResult 结构相同。
+type kuaidi100Result struct {
+	Result     *bool  `json:"result"` // 仅失败时返回 false
+	ReturnCode string `json:"returnCode"`
+	Message    string `json:"message"`
+	State      string `json:"state"`
+	Com        string `json:"com"`
+	Nu         string `json:"nu"`
+	Data       []struct {
+		Time       string `json:"time"`
+		Context    string `json:"context"`
+		Location   string `json:"location"`
+		AreaName   string `json:"areaName"`
+		StatusCode string `json:"statusCode"` // resultv2=1 时返回的细分状态，如 301 本人签收
+	} `json:"data"`
+}
+
+// kuaidi100 快递100 单家承运商的接入，推送与查询共用结果解析。
+type kuaidi100 struct {
+	cfg       Kuaidi100Config
+	carrier   Kuaidi100Carrier
+	statusMap domain.CarrierStatusMap
+}
+
+func newKuaidi100(cfg Kuaidi100Config, carrier Kuaidi100Carrier) kuaidi100 {
+	return kuaidi100{cfg: cfg, carrier: carrier, statusMap: kuaidi100StatusMap.Merge(cfg.StatusMap)}
+}
+
+func (k kuaidi100) Carrier() string { return k.carrier.Code }
+
+// events 将查询结果转为轨迹事件。
+// 轨迹按时间倒序返回；没有细分状态的老接口只有整单 state，仅用于最新一条轨迹。
+func (k kuaidi100) events(r *kuaidi100Result) ([]*domain.TrackingEvent, error) {
+	if !strings.EqualFold(r.Com, k.carrier.Company) {
+		return nil, fmt.Errorf("%w: kuaidi100: expected %s, got %s", domain.ErrCarrierMismatch, k.carrier.Company, r.Com)
+	}
+	events := make([]*domain.TrackingEvent, 0, len(r.Data))
+	for i, d := range r.Data {
+		occurredAt, err := parseChinaTime(d.Time)
+		if err != nil {
+			return nil, fmt.Errorf("kuaidi100: invalid time %q for %s", d.Time, r.Nu)
+		}
+		code := d.StatusCode
+		if code == "" && i == 0 {
+			code = r.State
+		}
+		status, mapped := k.statusMap[kuaidi100State(code)]
+		location := d.Location
+		if location == "" {
+			location = d.AreaName
+		}
+		events = append(events, &domain.TrackingEvent{
+			CarrierCode:   k.carrier.Code,
+			TrackingNo:    r.Nu,
+			CarrierStatus: code,
+			Status:        status,
+			Mapped:        mapped && code != "",
+			Location:      location,
+			Description:   d.Context,
+			OccurredAt:    occurredAt,
+		})
+	}
+	return events, nil
+}
+
+// kuaidi100State 将细分状态码归并为物流状态 (state)，如 301 -> 3、1401 -> 14。
+func kuaidi100State(code string) string {
+	if len(code) >= 3 {
+		return code[:len(code)-2]
+	}
+	return code
+}
+
+// kuaidi100Sign 计算快递100 签名：MD5 十六进制大写。
+func kuaidi100Sign(parts ...string) string {
+	sum := md5.Sum([]byte(strings.Join(parts, "")))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Kuaidi100Webhook 快递100 订阅推送的验签与解析器。
+// 推送为表单报文 param、sign，sign = MD5(param + salt) 大写。
+type Kuaidi100Webhook struct {
+	kuaidi100
+}
+
+// NewKuaidi100Webhook 创建快递100 订阅推送解析器。
+func NewKuaidi100Webhook(cfg Kuaidi100Config, carrier Kuaidi100Carrier) *Kuaidi100Webhook {
+	return &Kuaidi100Webhook{kuaidi100: newKuaidi100(cfg, carrier)}
+}
+
+// Parse 校验签名并解析推送中的最新查询结果。
+func (w *Kuaidi100Webhook) Parse(_ context.Context, req *domain.TrackingRequest) ([]*domain.TrackingEvent, error) {
+	form, err := url.ParseQuery(string(req.Body))
+	if err != nil {
+		return nil, fmt.Errorf("kuaidi100: malformed push: %w", err)
+	}
+	param := form.Get("param")
+	if param == "" {
+		return nil, fmt.Errorf("%w: kuaidi100: missing param", domain.ErrInvalidTrackingSignature)
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.ToUpper(form.Get("sign"))), []byte(kuaidi100Sign(param, w.cfg.Salt))) != 1 {
+		return nil, fmt.Errorf("%w: kuaidi100: sign mismatch", domain.ErrInvalidTrackingSignature)
+	}
+
+	var push struct {
+		Status     string          `json:"status"` // polling 监控中，shutdown 结束，abort 中止
+		LastResult kuaidi100Result `json:"lastResult"`
+	}
+	if err := json.Unmarshal([]byte(param), &push); err != nil {
+		return nil, fmt.Errorf("kuaidi100: malformed param: %w", err)
+	}
+	return w.events(&push.LastResult)
+}
+
+// Reply 快递100 以 result 判断推送是否成功，失败会重推。
+func (w *Kuaidi100Webhook) Reply(success bool) any {
+	if success {
+		return map[string]any{"result": true, "returnCode": "200", "message": "成功"}
+	}
+	return map[string]any{"result": false, "returnCode": "500", "message": "失败"}
+}
+
+// Kuaidi100Tracker 快递100 实时查询，用于未订阅推送的承运商。
+type Kuaidi100Tracker struct {
+	kuaidi100
+	httpClient *http.Client
+}
+
+// NewKuaidi100Tracker 创建快递100 实时查询器。
+func NewKuaidi100Tracker(cfg Kuaidi100Config, carrier Kuaidi100Carrier, httpClient *http.Client) *Kuaidi100Tracker {
+	if cfg.QueryURL == "" {
+		cfg.QueryURL = defaultKuaidi100QueryURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Kuaidi100Tracker{kuaidi100: newKuaidi100(cfg, carrier), httpClient: httpClient}
+}
+
+// Track 查询运单全部轨迹。顺丰等承运商要求提供收件人手机号，统一附带。
+func (t *Kuaidi100Tracker) Track(ctx context.Context, logistics *domain.Logistics) ([]*domain.TrackingEvent, error) {
+	param, err := json.Marshal(map[string]string{
+		"com":      t.carrier.Company,
+		"num":      logistics.TrackingNo,
+		"phone":    logistics.ReceiverPhone,
+		"resultv2": "1",
+	})
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"customer": {t.cfg.Customer},
+		"sign":     {kuaidi100Sign(string(param), t.cfg.Key, t.cfg.Customer)},
+		"param":    {string(param)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.QueryURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kuaidi100: query %s: %w", logistics.TrackingNo, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kuaidi100: query %s: http status %d", logistics.TrackingNo, resp.StatusCode)
+	}
+
+	var result kuaidi100Result
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("kuaidi100: malformed response: %w", err)
+	}
+	if result.Result != nil && !*result.Result {
+		return nil, fmt.Errorf("kuaidi100: query %s failed: %s %s", logistics.TrackingNo, result.ReturnCode, result.Message)
+	}
+	return t.events(&result)
+}
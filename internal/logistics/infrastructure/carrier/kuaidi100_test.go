@@ -0,0 +1,85 @@
+package carrier
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/wyfcoding/ecommerce/internal/logistics/domain"
+)
+
+const kuaidi100Param = `{"status":"polling","lastResult":{"state":"3","com":"yuantong","nu":"YT1001","data":[` +
+	`{"time":"2026-05-02 18:05:00","context":"已签收","location":"上海徐汇"},` +
+	`{"time":"2026-05-02 08:00:00","context":"派件中","areaName":"上海"},` +
+	`{"time":"2026-05-01 09:30:00","context":"已揽收","statusCode":"1"}]}}`
+
+func kuaidi100Push(param, sign string) *domain.TrackingRequest {
+	return &domain.TrackingRequest{Body: []byte(url.Values{"param": {param}, "sign": {sign}}.Encode())}
+}
+
+func newTestKuaidi100Webhook() *Kuaidi100Webhook {
+	return NewKuaidi100Webhook(Kuaidi100Config{Salt: "salt"}, Kuaidi100Carrier{Code: "YTO", Company: "yuantong", Push: true})
+}
+
+func TestKuaidi100WebhookParse(t *testing.T) {
+	w := newTestKuaidi100Webhook()
+	// 签名大小写不敏感
+	events, err := w.Parse(context.Background(), kuaidi100Push(kuaidi100Param, strings.ToLower(kuaidi100Sign(kuaidi100Param, "salt"))))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("events = %d, want 3", len(events))
+	}
+	// 最新一条没有细分状态时使用整单 state
+	if e := events[0]; e.CarrierCode != "YTO" || e.TrackingNo != "YT1001" || !e.Mapped || e.Status != domain.LogisticsStatusDelivered {
+		t.Fatalf("latest event = %+v, want YTO delivered", e)
+	}
+	// 较早的轨迹没有细分状态时只记录轨迹，位置回退到 areaName
+	if e := events[1]; e.Mapped || e.Location != "上海" {
+		t.Fatalf("middle event = %+v, want unmapped at 上海", e)
+	}
+	if e := events[2]; !e.Mapped || e.Status != domain.LogisticsStatusPickedUp {
+		t.Fatalf("oldest event = %+v, want picked up", e)
+	}
+}
+
+func TestKuaidi100WebhookRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *domain.TrackingRequest
+		want error
+	}{
+		{name: "wrong salt", req: kuaidi100Push(kuaidi100Param, kuaidi100Sign(kuaidi100Param, "other")), want: domain.ErrInvalidTrackingSignature},
+		{name: "tampered param", req: kuaidi100Push(strings.Replace(kuaidi100Param, `"state":"3"`, `"state":"4"`, 1), kuaidi100Sign(kuaidi100Param, "salt")), want: domain.ErrInvalidTrackingSignature},
+		{name: "missing sign", req: kuaidi100Push(kuaidi100Param, ""), want: domain.ErrInvalidTrackingSignature},
+		{name: "missing param", req: kuaidi100Push("", kuaidi100Sign("", "salt")), want: domain.ErrInvalidTrackingSignature},
+		{
+			name: "other carrier",
+			req: func() *domain.TrackingRequest {
+				param := strings.Replace(kuaidi100Param, "yuantong", "zhongtong", 1)
+				return kuaidi100Push(param, kuaidi100Sign(param, "salt"))
+			}(),
+			want: domain.ErrCarrierMismatch,
+		},
+	}
+	w := newTestKuaidi100Webhook()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := w.Parse(context.Background(), tt.req); !errors.Is(err, tt.want) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestKuaidi100State(t *testing.T) {
+	tests := map[string]string{"3": "3", "14": "14", "301": "3", "1401": "14", "": ""}
+	for code, want := range tests {
+		if got := kuaidi100State(code); got != want {
+			t.Errorf("kuaidi100State(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package carrier
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/logistics/domain"
+)
+
+// sfStatusMap 顺丰路由 opCode 的默认映射。
+var sfStatusMap = domain.CarrierStatusMap{
+	"50":   domain.LogisticsStatusPickedUp,   // 顺丰已收取快件
+	"30":   domain.LogisticsStatusInTransit,  // 快件在转运中心装车
+	"31":   domain.LogisticsStatusInTransit,  // 快件到达中转站
+	"36":   domain.LogisticsStatusInTransit,  // 快件已封车发出
+	"44":   domain.LogisticsStatusDelivering, // 正在派送途中
+	"204":  domain.LogisticsStatusDelivering, // 快件交给快递员派送
+	"80":   domain.LogisticsStatusDelivered,  // 已签收
+	"8000": domain.LogisticsStatusDelivered,  // 代收点或快递柜签收
+	"33":   domain.LogisticsStatusException,  // 派送不成功
+	"70":   domain.LogisticsStatusException,  // 快件异常滞留
+	"99":   domain.LogisticsStatusReturning,  // 应客户要求退回
+}
+
+// SFWebhook 顺丰丰桥路由推送的验签与解析器。
+// 推送为表单报文 msgData、timestamp、msgDigest，msgDigest = Base64(MD5(URLEncode(msgData + timestamp + checkWord)))。
+type SFWebhook struct {
+	cfg       SFConfig
+	statusMap domain.CarrierStatusMap
+	now       func() time.Time
+}
+
+// NewSFWebhook 创建顺丰路由推送解析器。
+func NewSFWebhook(cfg SFConfig) *SFWebhook {
+	if cfg.Code == "" {
+		cfg.Code = "SF"
+	}
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = defaultTolerance
+	}
+	return &SFWebhook{cfg: cfg, statusMap: sfStatusMap.Merge(cfg.StatusMap), now: time.Now}
+}
+
+func (w *SFWebhook) Carrier() string { return w.cfg.Code }
+
+// sfRoutePush 路由推送中的 msgData。
+type sfRoutePush struct {
+	WaybillRoute []struct {
+		ID            string `json:"id"`
+		MailNo        string `json:"mailno"`
+		AcceptTime    string `json:"acceptTime"`
+		AcceptAddress string `json:"acceptAddress"`
+		Remark        string `json:"remark"`
+		OpCode        string `json:"opCode"`
+	} `json:"WaybillRoute"`
+}
+
+// Parse 校验摘要与时间戳容差，并解析推送中的全部路由节点。
+func (w *SFWebhook) Parse(_ context.Context, req *domain.TrackingRequest) ([]*domain.TrackingEvent, error) {
+	form, err := url.ParseQuery(string(req.Body))
+	if err != nil {
+		return nil, fmt.Errorf("sf: malformed push: %w", err)
+	}
+	msgData, timestamp := form.Get("msgData"), form.Get("timestamp")
+	if err := w.verify(msgData, timestamp, form.Get("msgDigest")); err != nil {
+		return nil, err
+	}
+
+	var push sfRoutePush
+	if err := json.Unmarshal([]byte(msgData), &push); err != nil {
+		return nil, fmt.Errorf("sf: malformed msgData: %w", err)
+	}
+	events := make([]*domain.TrackingEvent, 0, len(push.WaybillRoute))
+	for _, r := range push.WaybillRoute {
+		occurredAt, err := parseChinaTime(r.AcceptTime)
+		if err != nil {
+			return nil, fmt.Errorf("sf: invalid acceptTime %q for %s", r.AcceptTime, r.MailNo)
+		}
+		status, mapped := w.statusMap[r.OpCode]
+		events = append(events, &domain.TrackingEvent{
+			CarrierCode:   w.cfg.Code,
+			TrackingNo:    r.MailNo,
+			EventID:       r.ID,
+			CarrierStatus: r.OpCode,
+			Status:        status,
+			Mapped:        mapped,
+			Location:      r.AcceptAddress,
+			Description:   r.Remark,
+			OccurredAt:    occurredAt,
+		})
+	}
+	return events, nil
+}
+
+// verify 校验毫秒时间戳与 msgDigest。
+func (w *SFWebhook) verify(msgData, timestamp, digest string) error {
+	if msgData == "" || timestamp == "" || digest == "" {
+		return fmt.Errorf("%w: sf: missing msgData, timestamp or msgDigest", domain.ErrInvalidTrackingSignature)
+	}
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: sf: invalid timestamp", domain.ErrInvalidTrackingSignature)
+	}
+	if d := w.now().Sub(time.UnixMilli(ms)); d > w.cfg.Tolerance || d < -w.cfg.Tolerance {
+		return fmt.Errorf("%w: sf: timestamp outside tolerance", domain.ErrInvalidTrackingSignature)
+	}
+
+	sum := md5.Sum([]byte(url.QueryEscape(msgData + timestamp + w.cfg.CheckWord)))
+	expected := base64.StdEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(digest), []byte(expected)) != 1 {
+		return fmt.Errorf("%w: sf: msgDigest mismatch", domain.ErrInvalidTrackingSignature)
+	}
+	return nil
+}
+
+// Reply 丰桥以 return_code 判断推送是否成功，非 0000 会重推。
+func (w *SFWebhook) Reply(success bool) any {
+	if success {
+		return map[string]string{"return_code": "0000", "return_msg": "成功"}
+	}
+	return map[string]string{"return_code": "1000", "return_msg": "系统异常"}
+}
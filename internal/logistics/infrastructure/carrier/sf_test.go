@@ -0,0 +1,92 @@
+package carrier
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/logistics/domain"
+)
+
+const sfMsgData = `{"WaybillRoute":[` +
+	`{"id":"r1","mailno":"SF1001","acceptTime":"2026-05-01 09:30:00","acceptAddress":"深圳","remark":"顺丰已收取快件","opCode":"50"},` +
+	`{"id":"r2","mailno":"SF1001","acceptTime":"2026-05-02 18:05:00","acceptAddress":"上海徐汇","remark":"已签收","opCode":"80"},` +
+	`{"id":"r3","mailno":"SF1001","acceptTime":"2026-05-02 18:06:00","acceptAddress":"上海徐汇","remark":"客户回访","opCode":"9999"}]}`
+
+func sfPush(msgData, timestamp, checkWord string) *domain.TrackingRequest {
+	sum := md5.Sum([]byte(url.QueryEscape(msgData + timestamp + checkWord)))
+	form := url.Values{
+		"msgData":   {msgData},
+		"timestamp": {timestamp},
+		"msgDigest": {base64.StdEncoding.EncodeToString(sum[:])},
+	}
+	return &domain.TrackingRequest{Body: []byte(form.Encode())}
+}
+
+func newTestSFWebhook(now time.Time) *SFWebhook {
+	w := NewSFWebhook(SFConfig{CheckWord: "check-word", StatusMap: map[string]int{"9999": int(domain.LogisticsStatusInTransit)}})
+	w.now = func() time.Time { return now }
+	return w
+}
+
+func TestSFWebhookParse(t *testing.T) {
+	now := time.Date(2026, 5, 2, 10, 10, 0, 0, time.UTC)
+	w := newTestSFWebhook(now)
+	ts := strconv.FormatInt(now.Add(-time.Minute).UnixMilli(), 10)
+
+	events, err := w.Parse(context.Background(), sfPush(sfMsgData, ts, "check-word"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("events = %d, want 3", len(events))
+	}
+	signed := events[1]
+	if signed.CarrierCode != "SF" || signed.TrackingNo != "SF1001" || signed.EventID != "r2" {
+		t.Fatalf("event = %+v", signed)
+	}
+	if !signed.Mapped || signed.Status != domain.LogisticsStatusDelivered {
+		t.Fatalf("opCode 80 = %v (mapped %v), want delivered", signed.Status, signed.Mapped)
+	}
+	// 报文时间为北京时间
+	if want := time.Date(2026, 5, 2, 10, 5, 0, 0, time.UTC); !signed.OccurredAt.Equal(want) {
+		t.Fatalf("OccurredAt = %v, want %v", signed.OccurredAt, want)
+	}
+	if events[2].Status != domain.LogisticsStatusInTransit || !events[2].Mapped {
+		t.Fatalf("overridden opCode = %v (mapped %v), want in transit", events[2].Status, events[2].Mapped)
+	}
+}
+
+func TestSFWebhookRejects(t *testing.T) {
+	now := time.Date(2026, 5, 2, 10, 10, 0, 0, time.UTC)
+	valid := strconv.FormatInt(now.UnixMilli(), 10)
+	tampered := sfPush(sfMsgData, valid, "check-word")
+	form, _ := url.ParseQuery(string(tampered.Body))
+	form.Set("msgData", `{"WaybillRoute":[]}`)
+	tampered.Body = []byte(form.Encode())
+
+	tests := []struct {
+		name string
+		req  *domain.TrackingRequest
+	}{
+		{name: "wrong check word", req: sfPush(sfMsgData, valid, "other")},
+		{name: "tampered msgData", req: tampered},
+		{name: "stale timestamp", req: sfPush(sfMsgData, strconv.FormatInt(now.Add(-6*time.Minute).UnixMilli(), 10), "check-word")},
+		{name: "future timestamp", req: sfPush(sfMsgData, strconv.FormatInt(now.Add(6*time.Minute).UnixMilli(), 10), "check-word")},
+		{name: "invalid timestamp", req: sfPush(sfMsgData, "yesterday", "check-word")},
+		{name: "missing digest", req: &domain.TrackingRequest{Body: []byte(url.Values{"msgData": {sfMsgData}, "timestamp": {valid}}.Encode())}},
+	}
+	w := newTestSFWebhook(now)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := w.Parse(context.Background(), tt.req); !errors.Is(err, domain.ErrInvalidTrackingSignature) {
+				t.Fatalf("Parse() error = %v, want ErrInvalidTrackingSignature", err)
+			}
+		})
+	}
+}
@@ -3,10 +3,12 @@ package persistence
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/logistics/domain" // 导入物流模块的领域层。
 
-	"gorm.io/gorm" // 导入GORM ORM框架。
+	"gorm.io/gorm"        // 导入GORM ORM框架。
+	"gorm.io/gorm/clause" // 导入GORM子句构造，用于行锁。
 )
 
 type logisticsRepository struct {
@@ -25,30 +27,35 @@ func NewLogisticsRepository(db *gorm.DB) domain.LogisticsRepository {
 func (r *logisticsRepository) Save(ctx context.Context, logistics *domain.Logistics) error {
 	// 使用事务确保物流主实体和轨迹的更新操作的原子性。
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// 保存或更新物流主实体。
-		if err := tx.Save(logistics).Error; err != nil {
-			return err
-		}
-		// 遍历所有轨迹，只保存新增的轨迹（ID为0的轨迹）。
-		for _, trace := range logistics.Traces {
-			if trace.ID == 0 { // 检查是否是新轨迹。
-				trace.LogisticsID = uint64(logistics.ID) // 关联物流ID。
-				if err := tx.Save(trace).Error; err != nil {
-					return err
-				}
-			}
-		}
+		return saveLogistics(tx, logistics)
+	})
+}
 
-		// 保存关联的 DeliveryRoute 实体
-		if logistics.Route != nil {
-			logistics.Route.LogisticsID = uint64(logistics.ID)
-			if err := tx.Save(logistics.Route).Error; err != nil {
+// saveLogistics 在事务内保存物流主实体及其新增的轨迹和配送路线。
+func saveLogistics(tx *gorm.DB, logistics *domain.Logistics) error {
+	// 保存或更新物流主实体。
+	if err := tx.Save(logistics).Error; err != nil {
+		return err
+	}
+	// 遍历所有轨迹，只保存新增的轨迹（ID为0的轨迹）。
+	for _, trace := range logistics.Traces {
+		if trace.ID == 0 { // 检查是否是新轨迹。
+			trace.LogisticsID = uint64(logistics.ID) // 关联物流ID。
+			if err := tx.Save(trace).Error; err != nil {
 				return err
 			}
 		}
+	}
+
+	// 保存关联的 DeliveryRoute 实体
+	if logistics.Route != nil {
+		logistics.Route.LogisticsID = uint64(logistics.ID)
+		if err := tx.Save(logistics.Route).Error; err != nil {
+			return err
+		}
+	}
 
-		return nil
-	})
+	return nil
 }
 
 // GetByID 根据ID从数据库获取物流记录，并预加载其关联的轨迹和路线。
@@ -110,3 +117,46 @@ func (r *logisticsRepository) List(ctx context.Context, offset, limit int) ([]*d
 
 	return list, total, nil
 }
+
+// UpdateLocked 在事务内以 SELECT ... FOR UPDATE 读取物流单，fn 返回 true 时保存修改。
+func (r *logisticsRepository) UpdateLocked(ctx context.Context, id uint64, fn func(logistics *domain.Logistics) (bool, error)) (*domain.Logistics, error) {
+	var logistics domain.Logistics
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Traces").Preload("Route").First(&logistics, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.ErrLogisticsNotFound
+			}
+			return err
+		}
+		changed, err := fn(&logistics)
+		if err != nil || !changed {
+			return err
+		}
+		return saveLogistics(tx, &logistics)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &logistics, nil
+}
+
+// FindDueForPoll 查询到期需要主动查询的运单。轨迹由 UpdateLocked 加锁读取时加载，此处不预加载。
+func (r *logisticsRepository) FindDueForPoll(ctx context.Context, carrierCodes []string, createdAfter, now time.Time, limit int) ([]*domain.Logistics, error) {
+	var list []*domain.Logistics
+	if len(carrierCodes) == 0 {
+		return list, nil
+	}
+	err := r.db.WithContext(ctx).
+		Where("carrier_code IN ? AND created_at >= ? AND status NOT IN ?", carrierCodes, createdAfter,
+			[]domain.LogisticsStatus{domain.LogisticsStatusDelivered, domain.LogisticsStatusReturned}).
+		Where("next_poll_at IS NULL OR next_poll_at <= ?", now).
+		Order("next_poll_at").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+// FindPendingDeliverySync 查询待同步签收的运单。刚签收的运单由签收时的同步处理，不在此返回。
+func (r *logisticsRepository) FindPendingDeliverySync(ctx context.Context, updatedBefore time.Time, limit int) ([]*domain.Logistics, error) {
+	var list []*domain.Logistics
+	err := r.db.WithContext(ctx).Where("sync_pending = ? AND updated_at < ?", true, updatedBefore).Order("id").Limit(limit).Find(&list).Error
+	return list, err
+}
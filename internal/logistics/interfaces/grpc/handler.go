@@ -2,6 +2,7 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	pb "github.com/wyfcoding/ecommerce/goapi/logistics/v1"          // 导入物流模块的protobuf定义。
@@ -35,6 +36,8 @@ func (s *Server) CreateLogistics(ctx context.Context, req *pb.CreateLogisticsReq
 	logistics, err := s.app.CreateLogistics(
 		ctx,
 		req.OrderId,
+		req.UserId,
+		domain.ShipmentType(req.ShipmentType),
 		req.OrderNo,
 		req.TrackingNo,
 		req.Carrier,
@@ -51,6 +54,9 @@ func (s *Server) CreateLogistics(ctx context.Context, req *pb.CreateLogisticsReq
 		req.ReceiverLon,
 	)
 	if err != nil {
+		if errors.Is(err, domain.ErrInvalidShipmentType) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to create logistics: %v", err))
 	}
 
@@ -187,6 +193,8 @@ func convertLogisticsToProto(l *domain.Logistics) *pb.Logistics {
 		Id:              uint64(l.ID),                 // 物流ID。
 		OrderId:         l.OrderID,                    // 订单ID。
 		OrderNo:         l.OrderNo,                    // 订单号。
+		UserId:          l.UserID,                     // 买家ID。
+		ShipmentType:    string(l.ShipmentType),       // 运单类型。
 		TrackingNo:      l.TrackingNo,                 // 运单号。
 		Carrier:         l.Carrier,                    // 承运商。
 		CarrierCode:     l.CarrierCode,                // 承运商编码。
@@ -222,7 +230,7 @@ func convertTraceToProto(t *domain.LogisticsTrace) *pb.LogisticsTrace {
 	if t == nil {
 		return nil
 	}
-	return &pb.LogisticsTrace{
+	resp := &pb.LogisticsTrace{
 		Id:          uint64(t.ID),                 // 轨迹ID。
 		LogisticsId: t.LogisticsID,                // 物流ID。
 		TrackingNo:  t.TrackingNo,                 // 运单号。
@@ -231,6 +239,11 @@ func convertTraceToProto(t *domain.LogisticsTrace) *pb.LogisticsTrace {
 		Status:      t.Status,                     // 状态描述。
 		CreatedAt:   timestamppb.New(t.CreatedAt), // 创建时间。
 	}
+	// 承运商上报的事件发生时间。
+	if t.OccurredAt != nil {
+		resp.OccurredAt = timestamppb.New(*t.OccurredAt)
+	}
+	return resp
 }
 
 // convertRouteToProto 是一个辅助函数,将领域层的 DeliveryRoute 实体转换为 protobuf 的 DeliveryRoute 消息。
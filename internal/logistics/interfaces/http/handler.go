@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"   // 导入标准错误处理库。
 	"net/http" // 导入HTTP状态码。
 	"strconv"  // 导入字符串和数字转换工具。
 	"time"     // 导入时间包，用于时间解析。
@@ -37,6 +38,8 @@ func (h *Handler) CreateLogistics(c *gin.Context) {
 	// 定义请求体结构，用于接收物流单的创建信息。
 	var req struct {
 		OrderID         uint64  `json:"order_id" binding:"required"`         // 订单ID，必填。
+		UserID          uint64  `json:"user_id"`                             // 买家ID，签收后同步订单送达时需要，选填。
+		ShipmentType    string  `json:"shipment_type"`                       // 运单类型 ORDER/REPLACEMENT/RETURN，默认 ORDER。
 		OrderNo         string  `json:"order_no" binding:"required"`         // 订单号，必填。
 		TrackingNo      string  `json:"tracking_no" binding:"required"`      // 运单号，必填。
 		Carrier         string  `json:"carrier" binding:"required"`          // 承运商，必填。
@@ -60,10 +63,14 @@ func (h *Handler) CreateLogistics(c *gin.Context) {
 	}
 
 	// 调用应用服务层创建物流单。
-	logistics, err := h.app.CreateLogistics(c.Request.Context(), req.OrderID, req.OrderNo, req.TrackingNo, req.Carrier, req.CarrierCode,
+	logistics, err := h.app.CreateLogistics(c.Request.Context(), req.OrderID, req.UserID, domain.ShipmentType(req.ShipmentType), req.OrderNo, req.TrackingNo, req.Carrier, req.CarrierCode,
 		req.SenderName, req.SenderPhone, req.SenderAddress, req.SenderLat, req.SenderLon,
 		req.ReceiverName, req.ReceiverPhone, req.ReceiverAddress, req.ReceiverLat, req.ReceiverLon)
 	if err != nil {
+		if errors.Is(err, domain.ErrInvalidShipmentType) {
+			response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid shipment type", err.Error())
+			return
+		}
 		h.logger.ErrorContext(c.Request.Context(), "Failed to create logistics", "error", err)
 		response.ErrorWithStatus(c, http.StatusInternalServerError, "Failed to create logistics", err.Error())
 		return
@@ -273,6 +280,44 @@ func (h *Handler) OptimizeRoute(c *gin.Context) {
 	response.SuccessWithStatus(c, http.StatusOK, "Route optimized successfully", route)
 }
 
+// CarrierWebhook 处理承运商轨迹推送的HTTP请求。
+// HTTP 方法: POST
+// 请求路径: /logistics/webhooks/:carrier
+// 该接口由承运商直接调用，真实性依赖承运商签名校验；应答报文遵循各承运商约定。
+func (h *Handler) CarrierWebhook(c *gin.Context) {
+	webhook, err := h.app.CarrierWebhook(c.Param("carrier"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unsupported carrier"})
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, webhook.Reply(false))
+		return
+	}
+
+	headers := make(map[string]string, len(c.Request.Header))
+	for k := range c.Request.Header {
+		headers[k] = c.Request.Header.Get(k)
+	}
+
+	if _, err := h.app.HandleCarrierWebhook(c.Request.Context(), webhook, &domain.TrackingRequest{Headers: headers, Body: body}); err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "carrier tracking push processing failed", "carrier", webhook.Carrier(), "error", err)
+		code := http.StatusInternalServerError
+		if errors.Is(err, domain.ErrInvalidTrackingSignature) || errors.Is(err, domain.ErrCarrierMismatch) {
+			code = http.StatusUnauthorized
+		}
+		c.JSON(code, webhook.Reply(false))
+		return
+	}
+	c.JSON(http.StatusOK, webhook.Reply(true))
+}
+
+// RegisterWebhookRoutes 注册承运商轨迹推送路由，须挂载在鉴权与幂等中间件之外。
+func (h *Handler) RegisterWebhookRoutes(r *gin.RouterGroup) {
+	r.POST("/logistics/webhooks/:carrier", h.CarrierWebhook)
+}
+
 // RegisterRoutes 在给定的Gin路由组中注册Logistics模块的HTTP路由。
 // r: Gin的路由组。
 func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
@@ -2,6 +2,7 @@ package application
 
 import (
 	"context"
+	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/logisticsrouting/domain"
 )
@@ -27,9 +28,14 @@ func (s *LogisticsRoutingService) RegisterCarrier(ctx context.Context, carrier *
 	return s.manager.RegisterCarrier(ctx, carrier)
 }
 
-// OptimizeRoute 核心算法：为一组订单优化整体配送路由。
-func (s *LogisticsRoutingService) OptimizeRoute(ctx context.Context, orderIDs []uint64) (*domain.OptimizedRoute, error) {
-	return s.manager.OptimizeRoute(ctx, orderIDs)
+// RegisterVehicle 登记承运商驻扎在仓库的配送车辆。
+func (s *LogisticsRoutingService) RegisterVehicle(ctx context.Context, vehicle *domain.Vehicle) error {
+	return s.manager.RegisterVehicle(ctx, vehicle)
+}
+
+// OptimizeRoute 核心算法：为一组订单优化整体配送路由，departAt 为零值时从当前时间出车。
+func (s *LogisticsRoutingService) OptimizeRoute(ctx context.Context, orders []domain.OrderRef, departAt time.Time) (*domain.OptimizedRoute, error) {
+	return s.manager.OptimizeRoute(ctx, orders, departAt)
 }
 
 // --- 读操作（委托给 Query）---
@@ -43,3 +49,8 @@ func (s *LogisticsRoutingService) GetRoute(ctx context.Context, id uint64) (*dom
 func (s *LogisticsRoutingService) ListCarriers(ctx context.Context) ([]*domain.Carrier, error) {
 	return s.query.ListCarriers(ctx)
 }
+
+// ListVehicles 获取所有登记的配送车辆。
+func (s *LogisticsRoutingService) ListVehicles(ctx context.Context) ([]*domain.Vehicle, error) {
+	return s.query.ListVehicles(ctx)
+}
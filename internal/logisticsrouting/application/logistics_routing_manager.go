@@ -3,26 +3,69 @@ package application
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
-	"math/rand"
+	"math"
+	"time"
 
+	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
+	productv1 "github.com/wyfcoding/ecommerce/goapi/product/v1"
+	warehousev1 "github.com/wyfcoding/ecommerce/goapi/warehouse/v1"
 	"github.com/wyfcoding/ecommerce/internal/logisticsrouting/domain"
-	"github.com/wyfcoding/pkg/algorithm"
 )
 
+// warehouseActive 仓库服务中运营中仓库的状态值，仅运营中的仓库可作为出车仓库。
+const warehouseActive = "ACTIVE"
+
+// warehousePageSize 分页加载仓库列表的每页数量。
+const warehousePageSize = 100
+
+// RoutingConfig 路由优化配置：站点停留时长、求解时间预算与体积重折算。
+type RoutingConfig struct {
+	ServiceTime       time.Duration `mapstructure:"service_time"`       // 每个配送站点的卸货交接时长
+	TimeBudget        time.Duration `mapstructure:"time_budget"`        // 局部搜索时间预算
+	VolumetricDivisor float64       `mapstructure:"volumetric_divisor"` // 体积重折算系数 (立方厘米/千克)
+	GazetteerFile     string        `mapstructure:"gazetteer_file"`     // 离线地名库文件
+}
+
 // LogisticsRoutingManager 处理物流路由的写操作。
 type LogisticsRoutingManager struct {
-	repo      domain.LogisticsRoutingRepository
-	optimizer *algorithm.RouteOptimizer
-	logger    *slog.Logger
+	repo            domain.LogisticsRoutingRepository
+	orderClient     orderv1.OrderServiceClient
+	productClient   productv1.ProductServiceClient
+	warehouseClient warehousev1.WarehouseServiceClient
+	geocoder        domain.Geocoder
+	cfg             RoutingConfig
+	logger          *slog.Logger
 }
 
 // NewLogisticsRoutingManager creates a new LogisticsRoutingManager instance.
-func NewLogisticsRoutingManager(repo domain.LogisticsRoutingRepository, logger *slog.Logger) *LogisticsRoutingManager {
+func NewLogisticsRoutingManager(
+	repo domain.LogisticsRoutingRepository,
+	orderClient orderv1.OrderServiceClient,
+	productClient productv1.ProductServiceClient,
+	warehouseClient warehousev1.WarehouseServiceClient,
+	geocoder domain.Geocoder,
+	cfg RoutingConfig,
+	logger *slog.Logger,
+) *LogisticsRoutingManager {
+	if cfg.ServiceTime <= 0 {
+		cfg.ServiceTime = 5 * time.Minute
+	}
+	if cfg.TimeBudget <= 0 {
+		cfg.TimeBudget = 2 * time.Second
+	}
+	if cfg.VolumetricDivisor <= 0 {
+		cfg.VolumetricDivisor = domain.DefaultVolumetricDivisor
+	}
 	return &LogisticsRoutingManager{
-		repo:      repo,
-		optimizer: algorithm.NewRouteOptimizer(),
-		logger:    logger,
+		repo:            repo,
+		orderClient:     orderClient,
+		productClient:   productClient,
+		warehouseClient: warehouseClient,
+		geocoder:        geocoder,
+		cfg:             cfg,
+		logger:          logger,
 	}
 }
 
@@ -36,8 +79,38 @@ func (m *LogisticsRoutingManager) RegisterCarrier(ctx context.Context, carrier *
 	return nil
 }
 
-// OptimizeRoute 优化多车配送路线。
-func (m *LogisticsRoutingManager) OptimizeRoute(ctx context.Context, orderIDs []uint64) (*domain.OptimizedRoute, error) {
+// RegisterVehicle 登记承运商驻扎在仓库的配送车辆。
+func (m *LogisticsRoutingManager) RegisterVehicle(ctx context.Context, vehicle *domain.Vehicle) error {
+	if err := vehicle.Validate(); err != nil {
+		return err
+	}
+	carrier, err := m.repo.GetCarrier(ctx, vehicle.CarrierID)
+	if err != nil {
+		return err
+	}
+	if carrier == nil {
+		return fmt.Errorf("%w: carrier %d not found", domain.ErrInvalidVehicle, vehicle.CarrierID)
+	}
+	if err := m.repo.SaveVehicle(ctx, vehicle); err != nil {
+		m.logger.ErrorContext(ctx, "failed to register vehicle", "plate_no", vehicle.PlateNo, "error", err)
+		return err
+	}
+	m.logger.InfoContext(ctx, "vehicle registered successfully", "vehicle_id", vehicle.ID, "plate_no", vehicle.PlateNo, "carrier_id", vehicle.CarrierID, "warehouse_id", vehicle.WarehouseID)
+	return nil
+}
+
+// OptimizeRoute 优化多仓库、混合车队的配送路线。
+// 订单收货地址经地理编码得到坐标，按 SKU 重量与体积计算计费重量；车辆从驻扎仓库出发，
+// 在载重、客户时间窗、司机班次、承运商覆盖地区与可用运力约束下求解，并生成各车辆含 ETA 的行程。
+// 无法在约束内安排的订单记录在结果中，不影响其余订单出车。
+func (m *LogisticsRoutingManager) OptimizeRoute(ctx context.Context, orders []domain.OrderRef, departAt time.Time) (*domain.OptimizedRoute, error) {
+	if len(orders) == 0 {
+		return nil, errors.New("no orders to optimize")
+	}
+	if departAt.IsZero() {
+		departAt = time.Now()
+	}
+
 	carriers, err := m.repo.ListCarriers(ctx, true)
 	if err != nil {
 		return nil, err
@@ -45,61 +118,271 @@ func (m *LogisticsRoutingManager) OptimizeRoute(ctx context.Context, orderIDs []
 	if len(carriers) == 0 {
 		return nil, errors.New("no active carriers found for route optimization")
 	}
+	vehicles, err := m.repo.ListVehicles(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	depots, err := m.loadDepots(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	// 1. 构造地理位置数据 (真实化：应从订单服务获取真实的 Lat/Lon 和重量需求)
-	start := algorithm.Location{ID: 0, Lat: 31.2304, Lon: 121.4737, Demand: 0}
-	destinations := make([]algorithm.Location, len(orderIDs))
+	// 1. 构造包裹：收货坐标与计费重量
+	parcels, err := m.buildParcels(ctx, orders)
+	if err != nil {
+		return nil, err
+	}
 
-	// 临时生成逻辑补全：假设每个订单需求量为 10.0，坐标在上海周边
-	for i, id := range orderIDs {
-		destinations[i] = algorithm.Location{
-			ID:     id,
-			Lat:    start.Lat + (rand.Float64()-0.5)*0.2,
-			Lon:    start.Lon + (rand.Float64()-0.5)*0.2,
-			Demand: 10.0,
+	// 2. 构造当班车队，车辆费用参数取自所属承运商
+	carrierByID := make(map[uint64]*domain.Carrier, len(carriers))
+	capacity := make(map[uint64]float64, len(carriers))
+	for _, c := range carriers {
+		carrierByID[uint64(c.ID)] = c
+		capacity[uint64(c.ID)] = float64(c.AvailableCapacity)
+	}
+	vehicleByID := make(map[uint64]*domain.Vehicle, len(vehicles))
+	var fleet []*domain.RouteVehicle
+	for _, v := range vehicles {
+		carrier, ok := carrierByID[v.CarrierID]
+		if !ok {
+			continue // 承运商未启用
+		}
+		depot, ok := depots[v.WarehouseID]
+		if !ok {
+			continue // 仓库未运营或缺少坐标
+		}
+		start, end, ok := v.Shift(departAt)
+		if !ok {
+			continue // 当天班次已结束
 		}
+		vehicleByID[uint64(v.ID)] = v
+		fleet = append(fleet, &domain.RouteVehicle{
+			ID:         uint64(v.ID),
+			CarrierID:  v.CarrierID,
+			Depot:      depot,
+			Capacity:   v.Capacity,
+			SpeedKmh:   v.SpeedKmh,
+			ShiftStart: start,
+			ShiftEnd:   end,
+			FixedCost:  float64(carrier.BaseCost),
+			CostPerKm:  carrier.DistanceRate,
+			CostPerKg:  carrier.WeightRate,
+		})
+	}
+	if len(fleet) == 0 {
+		return nil, fmt.Errorf("%w: no vehicle on shift at %s", domain.ErrNoCarrierAvailable, departAt.Format(time.RFC3339))
 	}
 
-	// 2. 调用真实 Savings 算法进行多车路线规划
-	// 假设所有配送商使用统一的载重上限
-	capacity := 100.0 // 示例容量限制
-	routes := m.optimizer.ClarkeWrightVRP(start, destinations, capacity)
-
-	// 3. 将算法结果映射回业务领域模型
-	var routeOrders []*domain.RouteOrder
-	var totalCost int64
-
-	for i, r := range routes {
-		carrier := carriers[i%len(carriers)] // 循环分配至承运商
-		for _, loc := range r.Locations {
-			if loc.ID == 0 {
-				continue // 跳过起点
-			}
-			// 基于 Haversine 距离计算真实配送成本 (元/公里)
-			cost := carrier.BaseCost + int64(r.Distance*float64(carrier.DistanceRate))
-			routeOrders = append(routeOrders, &domain.RouteOrder{
-				OrderID:       loc.ID,
-				CarrierID:     uint64(carrier.ID),
-				CarrierName:   carrier.Name,
-				EstimatedCost: cost,
-				EstimatedTime: carrier.BaseDeliveryTime,
-			})
-			totalCost += cost
+	// 3. 求解
+	parcelByID := make(map[uint64]*domain.Parcel, len(parcels))
+	customers := make([]*domain.DeliveryPoint, len(parcels))
+	for i, p := range parcels {
+		parcelByID[p.OrderID] = p
+		customers[i] = &domain.DeliveryPoint{
+			ID:          p.OrderID,
+			Lat:         p.Point.Lat,
+			Lon:         p.Point.Lon,
+			Demand:      p.ChargedWeight(m.cfg.VolumetricDivisor),
+			OpenTime:    p.DeliverAfter,
+			CloseTime:   p.DeliverBefore,
+			ServiceTime: m.cfg.ServiceTime,
 		}
 	}
+	solution := domain.NewVRPSolver(m.cfg.TimeBudget).Solve(&domain.VRPProblem{
+		Customers:       customers,
+		Vehicles:        fleet,
+		CarrierCapacity: capacity,
+		CanServe: func(v *domain.RouteVehicle, c *domain.DeliveryPoint) bool {
+			return parcelByID[c.ID].ServedBy(carrierByID[v.CarrierID])
+		},
+	})
 
+	// 4. 将求解结果映射为车辆行程与订单路由
 	route := &domain.OptimizedRoute{
-		Orders:      routeOrders,
-		OrderCount:  int32(len(orderIDs)),
-		TotalCost:   totalCost,
-		AverageCost: totalCost / int64(len(orderIDs)),
+		OrderCount:   int32(len(parcels)),
+		VehicleCount: int32(len(solution.Routes)),
+	}
+	for _, r := range solution.Routes {
+		itinerary, routeOrders := m.buildItinerary(r, carrierByID[r.Vehicle.CarrierID], vehicleByID[r.Vehicle.ID], parcelByID)
+		route.Itineraries = append(route.Itineraries, itinerary)
+		route.Orders = append(route.Orders, routeOrders...)
+		route.TotalCost += itinerary.Cost
+	}
+	for _, c := range solution.Unassigned {
+		route.UnassignedOrders = append(route.UnassignedOrders, c.ID)
+	}
+	if assigned := len(parcels) - len(solution.Unassigned); assigned > 0 {
+		route.AverageCost = route.TotalCost / int64(assigned)
 	}
 
 	if err := m.repo.SaveRoute(ctx, route); err != nil {
 		m.logger.ErrorContext(ctx, "failed to save optimized route", "error", err)
 		return nil, err
 	}
-	m.logger.InfoContext(ctx, "Clarke-Wright optimized multi-vehicle route created", "route_id", route.ID, "vehicles_used", len(routes))
+	if len(route.UnassignedOrders) > 0 {
+		m.logger.WarnContext(ctx, "orders could not be routed within vehicle, time window and shift constraints", "route_id", route.ID, "orders", []uint64(route.UnassignedOrders))
+	}
+	m.logger.InfoContext(ctx, "multi-depot time-window route created", "route_id", route.ID, "vehicles_used", len(solution.Routes), "fleet", len(fleet), "local_search_moves", solution.Moves, "total_cost", route.TotalCost)
 
 	return route, nil
 }
+
+// loadDepots 从仓库服务加载运营中且有坐标的仓库作为出车仓库。
+func (m *LogisticsRoutingManager) loadDepots(ctx context.Context) (map[uint64]*domain.Depot, error) {
+	depots := make(map[uint64]*domain.Depot)
+	for page := int32(1); ; page++ {
+		resp, err := m.warehouseClient.ListWarehouses(ctx, &warehousev1.ListWarehousesRequest{Page: page, PageSize: warehousePageSize})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list warehouses: %w", err)
+		}
+		for _, w := range resp.Warehouses {
+			if w.Status != warehouseActive || (w.Latitude == 0 && w.Longitude == 0) {
+				continue
+			}
+			depots[w.Id] = &domain.Depot{ID: w.Id, Name: w.Name, Lat: w.Latitude, Lon: w.Longitude}
+		}
+		if len(resp.Warehouses) < warehousePageSize || int64(page)*warehousePageSize >= resp.TotalCount {
+			return depots, nil
+		}
+	}
+}
+
+// buildParcels 查询订单收货地址与商品 SKU，构造待配送包裹。重复的订单只计一次。
+func (m *LogisticsRoutingManager) buildParcels(ctx context.Context, orders []domain.OrderRef) ([]*domain.Parcel, error) {
+	skus := make(map[uint64]*productv1.SKU)
+	seen := make(map[uint64]bool, len(orders))
+	parcels := make([]*domain.Parcel, 0, len(orders))
+
+	for _, ref := range orders {
+		if seen[ref.OrderID] {
+			continue
+		}
+		seen[ref.OrderID] = true
+
+		order, err := m.orderClient.GetOrderByID(ctx, &orderv1.GetOrderByIDRequest{Id: ref.OrderID, UserId: ref.UserID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order %d: %w", ref.OrderID, err)
+		}
+		addr := order.ShippingAddress
+		if addr == nil {
+			return nil, fmt.Errorf("%w: order %d has no shipping address", domain.ErrAddressNotGeocoded, ref.OrderID)
+		}
+
+		parcel := &domain.Parcel{
+			OrderRef: ref,
+			Address: domain.Address{
+				Province: addr.Province,
+				City:     addr.City,
+				District: addr.District,
+				Detail:   addr.DetailedAddress,
+			},
+		}
+		if parcel.Point, err = m.locate(ctx, addr, parcel.Address); err != nil {
+			return nil, fmt.Errorf("order %d: %w", ref.OrderID, err)
+		}
+		if parcel.Point.Precision == domain.GeoPrecisionProvince {
+			m.logger.WarnContext(ctx, "address geocoded to province center only, route for this order is approximate", "order_id", ref.OrderID, "address", parcel.Address.String())
+		}
+
+		for _, item := range order.Items {
+			sku, err := m.sku(ctx, skus, item.SkuId)
+			if err != nil {
+				return nil, err
+			}
+			parcel.WeightG += int64(sku.Weight) * int64(item.Quantity)
+			parcel.VolumeCM += int64(sku.Volume) * int64(item.Quantity)
+		}
+		if parcel.WeightG == 0 && parcel.VolumeCM == 0 {
+			m.logger.WarnContext(ctx, "order has no sku weight or volume, treated as zero load", "order_id", ref.OrderID)
+		}
+		parcels = append(parcels, parcel)
+	}
+	return parcels, nil
+}
+
+// locate 返回收货坐标。下单时已采集的地图坐标最精确，优先使用；否则通过地理编码解析地址。
+func (m *LogisticsRoutingManager) locate(ctx context.Context, addr *orderv1.ShippingAddress, address domain.Address) (domain.GeoPoint, error) {
+	if addr.Lat != 0 || addr.Lon != 0 {
+		return domain.GeoPoint{Lat: addr.Lat, Lon: addr.Lon, Precision: domain.GeoPrecisionExact}, nil
+	}
+	if m.geocoder == nil {
+		return domain.GeoPoint{}, fmt.Errorf("%w: geocoder not configured", domain.ErrAddressNotGeocoded)
+	}
+	return m.geocoder.Geocode(ctx, address)
+}
+
+// sku 查询 SKU 重量与体积，同一批次内相同 SKU 只查询一次。
+func (m *LogisticsRoutingManager) sku(ctx context.Context, cache map[uint64]*productv1.SKU, id uint64) (*productv1.SKU, error) {
+	if sku, ok := cache[id]; ok {
+		return sku, nil
+	}
+	sku, err := m.productClient.GetSKUByID(ctx, &productv1.GetSKUByIDRequest{Id: id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sku %d: %w", id, err)
+	}
+	cache[id] = sku
+	return sku, nil
+}
+
+// buildItinerary 生成车辆行程，线路费用按计费重量分摊到订单，尾差计入最后一个订单。
+func (m *LogisticsRoutingManager) buildItinerary(r *domain.Route, carrier *domain.Carrier, vehicle *domain.Vehicle, parcels map[uint64]*domain.Parcel) (*domain.Itinerary, []*domain.RouteOrder) {
+	cost := carrier.EstimateCost(r.TotalDistance, r.TotalLoad)
+	itinerary := &domain.Itinerary{
+		VehicleID:   r.Vehicle.ID,
+		PlateNo:     vehicle.PlateNo,
+		CarrierID:   uint64(carrier.ID),
+		CarrierName: carrier.Name,
+		DepotID:     r.Vehicle.Depot.ID,
+		DepotName:   r.Vehicle.Depot.Name,
+		DepartAt:    r.DepartAt,
+		ReturnAt:    r.ReturnAt,
+		Distance:    math.Round(r.TotalDistance*100) / 100,
+		Load:        math.Round(r.TotalLoad*100) / 100,
+		Cost:        cost,
+		Stops:       make([]*domain.ItineraryStop, len(r.Points)),
+	}
+
+	orders := make([]*domain.RouteOrder, len(r.Points))
+	var allocated int64
+	for i, c := range r.Points {
+		share := cost / int64(len(r.Points))
+		if r.TotalLoad > 0 {
+			share = int64(math.Round(float64(cost) * c.Demand / r.TotalLoad))
+		}
+		if i == len(r.Points)-1 {
+			share = cost - allocated
+		}
+		allocated += share
+
+		stop := &domain.ItineraryStop{
+			Sequence: int32(i + 1),
+			OrderID:  c.ID,
+			Lat:      c.Lat,
+			Lon:      c.Lon,
+			Load:     math.Round(c.Demand*100) / 100,
+			ETA:      r.Arrivals[i],
+		}
+		if !c.OpenTime.IsZero() {
+			stop.WindowStart = &c.OpenTime
+		}
+		if !c.CloseTime.IsZero() {
+			stop.WindowEnd = &c.CloseTime
+		}
+		itinerary.Stops[i] = stop
+
+		orders[i] = &domain.RouteOrder{
+			OrderID:       c.ID,
+			CarrierID:     uint64(carrier.ID),
+			CarrierName:   carrier.Name,
+			EstimatedCost: share,
+			EstimatedTime: int32(math.Ceil(r.Arrivals[i].Sub(r.DepartAt).Hours())),
+			Region:        parcels[c.ID].Region(),
+			GeoPrecision:  parcels[c.ID].Point.Precision,
+			ChargedWeight: stop.Load,
+			VehicleID:     r.Vehicle.ID,
+			Sequence:      stop.Sequence,
+			ETA:           stop.ETA,
+		}
+	}
+	return itinerary, orders
+}
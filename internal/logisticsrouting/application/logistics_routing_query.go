@@ -27,3 +27,8 @@ func (q *LogisticsRoutingQuery) GetRoute(ctx context.Context, id uint64) (*domai
 func (q *LogisticsRoutingQuery) ListCarriers(ctx context.Context) ([]*domain.Carrier, error) {
 	return q.repo.ListCarriers(ctx, false)
 }
+
+// ListVehicles 获取配送车辆列表。
+func (q *LogisticsRoutingQuery) ListVehicles(ctx context.Context) ([]*domain.Vehicle, error) {
+	return q.repo.ListVehicles(ctx, false)
+}
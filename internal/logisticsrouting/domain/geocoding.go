@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrAddressNotGeocoded 地址无法解析为坐标。
+var ErrAddressNotGeocoded = errors.New("address could not be geocoded")
+
+// Address 值对象代表待解析的收货地址。
+type Address struct {
+	Province string `json:"province"` // 省
+	City     string `json:"city"`     // 市
+	District string `json:"district"` // 区
+	Detail   string `json:"detail"`   // 详细地址
+}
+
+// String 返回拼接后的完整地址。
+func (a Address) String() string {
+	return a.Province + a.City + a.District + a.Detail
+}
+
+// GeoPrecision 坐标的定位精度。
+type GeoPrecision string
+
+const (
+	GeoPrecisionExact    GeoPrecision = "EXACT"    // 下单时采集的地图坐标
+	GeoPrecisionDistrict GeoPrecision = "DISTRICT" // 区县中心点
+	GeoPrecisionCity     GeoPrecision = "CITY"     // 市中心点
+	GeoPrecisionProvince GeoPrecision = "PROVINCE" // 省中心点，与实际收货地可能相距数百公里，路线仅供参考
+)
+
+// GeoPoint 值对象代表 WGS84 经纬度坐标。
+type GeoPoint struct {
+	Lat       float64      `json:"lat"`
+	Lon       float64      `json:"lon"`
+	Precision GeoPrecision `json:"precision,omitempty"`
+}
+
+// Geocoder 是地理编码接口，将收货地址解析为坐标。
+// 实现可以是离线地名库或第三方地图服务，无法解析时返回 ErrAddressNotGeocoded。
+type Geocoder interface {
+	Geocode(ctx context.Context, addr Address) (GeoPoint, error)
+}
+
+// NormalizeRegion 去除行政区划名称的 "省"/"市" 后缀，使 "上海市" 与 "上海" 视为同一地区。
+func NormalizeRegion(name string) string {
+	name = strings.TrimSpace(name)
+	for _, suffix := range []string{"省", "市"} {
+		if trimmed := strings.TrimSuffix(name, suffix); trimmed != "" {
+			name = trimmed
+		}
+	}
+	return name
+}
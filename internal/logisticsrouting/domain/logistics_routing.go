@@ -47,18 +47,27 @@ type Carrier struct {
 	IsActive          bool        `gorm:"default:true;comment:是否激活" json:"is_active"`
 }
 
-// SupportsRegion 检查配送商是否支持指定地区。
+// SupportsRegion 检查配送商是否支持指定地区，忽略 "省"/"市" 后缀差异。
 func (c *Carrier) SupportsRegion(region string) bool {
-	return slices.Contains(c.SupportedRegions, region)
+	region = NormalizeRegion(region)
+	return slices.ContainsFunc(c.SupportedRegions, func(r string) bool {
+		return NormalizeRegion(r) == region
+	})
 }
 
 // RouteOrder 结构体定义了优化路由中的单个订单信息。
 type RouteOrder struct {
-	OrderID       uint64 `json:"order_id"`
-	CarrierID     uint64 `json:"carrier_id"`
-	CarrierName   string `json:"carrier_name"`
-	EstimatedCost int64  `json:"estimated_cost"`
-	EstimatedTime int32  `json:"estimated_time"`
+	OrderID       uint64       `json:"order_id"`
+	CarrierID     uint64       `json:"carrier_id"`
+	CarrierName   string       `json:"carrier_name"`
+	EstimatedCost int64        `json:"estimated_cost"`
+	EstimatedTime int32        `json:"estimated_time"`
+	Region        string       `json:"region"`         // 收货地区 (省)
+	ChargedWeight float64      `json:"charged_weight"` // 计费重量 (kg)，实际重量与体积重取大
+	VehicleID     uint64       `json:"vehicle_id"`     // 配送车辆
+	Sequence      int32        `json:"sequence"`       // 在车辆行程中的配送顺序，从 1 开始
+	ETA           time.Time    `json:"eta"`            // 预计开始配送时间
+	GeoPrecision  GeoPrecision `json:"geo_precision"`  // 收货坐标精度，PROVINCE 表示地址只解析到省中心点
 }
 
 // RouteOrderArray 定义了 RouteOrder 结构体切片。
@@ -83,13 +92,88 @@ func (a *RouteOrderArray) Scan(value any) error {
 	return json.Unmarshal(bytes, a)
 }
 
+// ItineraryStop 结构体定义了车辆行程中的一个配送站点。
+type ItineraryStop struct {
+	Sequence    int32      `json:"sequence"`
+	OrderID     uint64     `json:"order_id"`
+	Lat         float64    `json:"lat"`
+	Lon         float64    `json:"lon"`
+	Load        float64    `json:"load"`                   // 该站卸货重量 (kg)
+	ETA         time.Time  `json:"eta"`                    // 预计开始配送时间，早到时为时间窗开启时间
+	WindowStart *time.Time `json:"window_start,omitempty"` // 客户时间窗
+	WindowEnd   *time.Time `json:"window_end,omitempty"`
+}
+
+// Itinerary 结构体定义了一辆车的完整行程：从仓库出发，按顺序配送后返回仓库。
+type Itinerary struct {
+	VehicleID   uint64           `json:"vehicle_id"`
+	PlateNo     string           `json:"plate_no"`
+	CarrierID   uint64           `json:"carrier_id"`
+	CarrierName string           `json:"carrier_name"`
+	DepotID     uint64           `json:"depot_id"` // 出发仓库 ID
+	DepotName   string           `json:"depot_name"`
+	DepartAt    time.Time        `json:"depart_at"`
+	ReturnAt    time.Time        `json:"return_at"`
+	Distance    float64          `json:"distance"` // 总里程 (km)
+	Load        float64          `json:"load"`     // 总载重 (kg)
+	Cost        int64            `json:"cost"`     // 线路费用 (分)
+	Stops       []*ItineraryStop `json:"stops"`
+}
+
+// ItineraryArray 定义了 Itinerary 结构体切片。
+type ItineraryArray []*Itinerary
+
+func (a ItineraryArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return json.Marshal(a)
+}
+
+func (a *ItineraryArray) Scan(value any) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, a)
+}
+
+// Uint64Array 定义了一个 uint64 切片类型，用于JSON存储。
+type Uint64Array []uint64
+
+func (a Uint64Array) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return json.Marshal(a)
+}
+
+func (a *Uint64Array) Scan(value any) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, a)
+}
+
 // OptimizedRoute 实体代表一个优化后的配送路线方案。
 type OptimizedRoute struct {
 	gorm.Model
-	Orders      RouteOrderArray `gorm:"type:json;comment:订单列表" json:"orders"`
-	OrderCount  int32           `gorm:"not null;default:0;comment:订单数量" json:"order_count"`
-	TotalCost   int64           `gorm:"not null;default:0;comment:总费用(分)" json:"total_cost"`
-	AverageCost int64           `gorm:"not null;default:0;comment:平均费用(分)" json:"average_cost"`
+	Orders           RouteOrderArray `gorm:"type:json;comment:订单列表" json:"orders"`
+	OrderCount       int32           `gorm:"not null;default:0;comment:订单数量" json:"order_count"`
+	TotalCost        int64           `gorm:"not null;default:0;comment:总费用(分)" json:"total_cost"`
+	AverageCost      int64           `gorm:"not null;default:0;comment:平均费用(分)" json:"average_cost"`
+	VehicleCount     int32           `gorm:"not null;default:0;comment:出车数量" json:"vehicle_count"`
+	Itineraries      ItineraryArray  `gorm:"type:json;comment:车辆行程" json:"itineraries"`
+	UnassignedOrders Uint64Array     `gorm:"type:json;comment:无法安排的订单" json:"unassigned_orders"` // 任何车辆都无法在载重、时间窗与班次约束内配送的订单。
 }
 
 // RoutingStatistics 实体代表路由相关的统计数据。
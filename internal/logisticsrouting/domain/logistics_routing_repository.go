@@ -11,6 +11,10 @@ type LogisticsRoutingRepository interface {
 	GetCarrier(ctx context.Context, id uint64) (*Carrier, error)
 	ListCarriers(ctx context.Context, activeOnly bool) ([]*Carrier, error)
 
+	// 车辆
+	SaveVehicle(ctx context.Context, vehicle *Vehicle) error
+	ListVehicles(ctx context.Context, activeOnly bool) ([]*Vehicle, error)
+
 	// 路由
 	SaveRoute(ctx context.Context, route *OptimizedRoute) error
 	GetRoute(ctx context.Context, id uint64) (*OptimizedRoute, error)
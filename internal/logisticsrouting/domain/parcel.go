@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrNoCarrierAvailable 没有可用的承运商或当班车辆。
+var ErrNoCarrierAvailable = errors.New("no carrier available")
+
+// DefaultVolumetricDivisor 默认体积重折算系数 (立方厘米/千克)，即快递行业通用的 长*宽*高/6000。
+const DefaultVolumetricDivisor = 6000
+
+// Parcel 值对象代表一个待配送订单的包裹：收货坐标、所属地区与货物重量体积。
+type Parcel struct {
+	OrderRef
+	Address  Address  `json:"address"`
+	Point    GeoPoint `json:"point"`
+	WeightG  int64    `json:"weight_g"`  // 实际重量 (克)，按 SKU 单件重量 * 数量汇总
+	VolumeCM int64    `json:"volume_cm"` // 包装体积 (立方厘米)，按 SKU 单件体积 * 数量汇总
+}
+
+// ChargedWeight 返回计费重量 (千克)：实际重量与体积重取大。
+func (p *Parcel) ChargedWeight(volumetricDivisor float64) float64 {
+	actual := float64(p.WeightG) / 1000
+	if volumetricDivisor <= 0 {
+		volumetricDivisor = DefaultVolumetricDivisor
+	}
+	return math.Max(actual, float64(p.VolumeCM)/volumetricDivisor)
+}
+
+// Region 返回包裹用于承运商匹配与分区求解的地区 (省)。
+func (p *Parcel) Region() string {
+	return NormalizeRegion(p.Address.Province)
+}
+
+// ServedBy 判断承运商是否覆盖包裹收货地，支持按省或按市配置覆盖范围。
+func (p *Parcel) ServedBy(c *Carrier) bool {
+	return c.SupportsRegion(p.Address.Province) || (p.Address.City != "" && c.SupportsRegion(p.Address.City))
+}
+
+// EstimateCost 估算承运商承运一条线路的费用 (分)：基础费用 + 里程费 + 重量费。
+func (c *Carrier) EstimateCost(distanceKm, weightKg float64) int64 {
+	return c.BaseCost + int64(math.Round(distanceKm*c.DistanceRate+weightKg*c.WeightRate))
+}
+
+// OrderRef 标识一个待路由的订单。订单服务按用户分库，查询订单需同时提供用户 ID。
+type OrderRef struct {
+	OrderID       uint64    `json:"order_id"`
+	UserID        uint64    `json:"user_id"`
+	DeliverAfter  time.Time `json:"deliver_after"`  // 客户期望送达时间窗开始，零值表示不限
+	DeliverBefore time.Time `json:"deliver_before"` // 客户期望送达时间窗结束，零值表示不限
+}
@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidVehicle 车辆配置不合法。
+var ErrInvalidVehicle = errors.New("invalid vehicle")
+
+// shiftLayout 司机班次开始时间格式 (HH:MM)。
+const shiftLayout = "15:04"
+
+// Vehicle 实体代表承运商驻扎在某个仓库的一辆配送车。
+// 车辆从所属仓库出发并返回，不同车型的载重、车速与班次各不相同 (混合车队)。
+type Vehicle struct {
+	gorm.Model
+	PlateNo     string  `gorm:"type:varchar(32);uniqueIndex;not null;comment:车牌号" json:"plate_no"`
+	CarrierID   uint64  `gorm:"not null;index;comment:所属承运商ID" json:"carrier_id"`
+	WarehouseID uint64  `gorm:"not null;index;comment:驻扎仓库ID" json:"warehouse_id"` // 出发与返回的仓库 (depot)。
+	VehicleType string  `gorm:"type:varchar(32);comment:车型" json:"vehicle_type"`   // 如 VAN、TRUCK_4_2M。
+	Capacity    float64 `gorm:"type:decimal(10,2);not null;comment:最大载重(kg)" json:"capacity"`
+	SpeedKmh    float64 `gorm:"type:decimal(6,2);not null;comment:平均车速(km/h)" json:"speed_kmh"`
+	ShiftStart  string  `gorm:"type:varchar(5);not null;comment:班次开始时间(HH:MM)" json:"shift_start"`
+	ShiftHours  float64 `gorm:"type:decimal(4,2);not null;comment:班次时长(小时)" json:"shift_hours"` // 司机最长工作时长，车辆须在班次结束前返回仓库。
+	IsActive    bool    `gorm:"default:true;comment:是否启用" json:"is_active"`
+}
+
+// Validate 校验车辆载重、车速与班次配置。
+func (v *Vehicle) Validate() error {
+	if v.PlateNo == "" || v.CarrierID == 0 || v.WarehouseID == 0 {
+		return fmt.Errorf("%w: plate_no, carrier_id and warehouse_id are required", ErrInvalidVehicle)
+	}
+	if v.Capacity <= 0 || v.SpeedKmh <= 0 {
+		return fmt.Errorf("%w: capacity and speed must be positive", ErrInvalidVehicle)
+	}
+	if v.ShiftHours <= 0 || v.ShiftHours > 24 {
+		return fmt.Errorf("%w: shift_hours must be within (0, 24]", ErrInvalidVehicle)
+	}
+	if _, err := time.Parse(shiftLayout, v.ShiftStart); err != nil {
+		return fmt.Errorf("%w: shift_start must be HH:MM", ErrInvalidVehicle)
+	}
+	return nil
+}
+
+// Shift 返回车辆在 departAt 当天的可用时段：从班次开始与 departAt 的较晚者起，至班次结束止。
+// 当天班次已结束时 ok 为 false。
+func (v *Vehicle) Shift(departAt time.Time) (start, end time.Time, ok bool) {
+	clock, err := time.Parse(shiftLayout, v.ShiftStart)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	y, m, d := departAt.Date()
+	shiftStart := time.Date(y, m, d, clock.Hour(), clock.Minute(), 0, 0, departAt.Location())
+	end = shiftStart.Add(time.Duration(v.ShiftHours * float64(time.Hour)))
+	start = shiftStart
+	if departAt.After(start) {
+		start = departAt
+	}
+	return start, end, start.Before(end)
+}
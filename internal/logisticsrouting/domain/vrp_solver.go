@@ -6,91 +6,491 @@ import (
 	"time"
 )
 
-// DeliveryPoint 配送点（客户或仓库）
+// costEpsilon 费用比较容差，避免浮点误差导致局部搜索来回震荡。
+const costEpsilon = 1e-6
+
+// Depot 配送仓库 (车辆出发与返回点)
+type Depot struct {
+	ID   uint64
+	Name string
+	Lat  float64
+	Lon  float64
+}
+
+// DeliveryPoint 配送点（客户）
 type DeliveryPoint struct {
-	ID        uint64
-	Lat       float64
-	Lon       float64
-	Demand    int32     // 需求量
-	OpenTime  time.Time // 时间窗开启
-	CloseTime time.Time // 时间窗关闭
+	ID          uint64
+	Lat         float64
+	Lon         float64
+	Demand      float64       // 需求量 (kg)
+	OpenTime    time.Time     // 时间窗开启，零值表示不限
+	CloseTime   time.Time     // 时间窗关闭，零值表示不限
+	ServiceTime time.Duration // 站点卸货交接时长
+}
+
+// RouteVehicle 参与求解的车辆：所属仓库、载重、车速、班次与费用参数。
+type RouteVehicle struct {
+	ID         uint64
+	CarrierID  uint64
+	Depot      *Depot
+	Capacity   float64   // 最大载重 (kg)
+	SpeedKmh   float64   // 平均车速
+	ShiftStart time.Time // 最早出发时间
+	ShiftEnd   time.Time // 最晚返回仓库时间，零值表示不限
+	FixedCost  float64   // 出车固定费用
+	CostPerKm  float64   // 里程费率
+	CostPerKg  float64   // 重量费率
 }
 
 // Route 车辆路径
 type Route struct {
-	Points        []*DeliveryPoint
-	TotalDistance float64
-	TotalLoad     int32
+	Vehicle       *RouteVehicle
+	Points        []*DeliveryPoint // 按配送顺序排列的客户，不含仓库
+	Arrivals      []time.Time      // 各客户开始配送时间 (ETA)，早到时等待时间窗开启
+	DepartAt      time.Time
+	ReturnAt      time.Time
+	TotalDistance float64 // km
+	TotalLoad     float64 // kg
 	TotalDuration time.Duration
+	Cost          float64
+}
+
+// VRPProblem 多仓库、混合车队、带时间窗与班次约束的车辆路径问题。
+type VRPProblem struct {
+	Customers []*DeliveryPoint
+	Vehicles  []*RouteVehicle
+	// CarrierCapacity 各承运商本次可用运力 (kg)，同一承运商所有车辆载重合计不得超出；未列出的承运商不限。
+	CarrierCapacity map[uint64]float64
+	// CanServe 判断车辆能否服务客户 (如承运商是否覆盖收货地区)，为 nil 表示不限。
+	CanServe func(v *RouteVehicle, c *DeliveryPoint) bool
+}
+
+// VRPSolution 求解结果
+type VRPSolution struct {
+	Routes     []*Route
+	Unassigned []*DeliveryPoint // 任何车辆都无法在约束内服务的客户
+	Moves      int              // 局部搜索改进次数
 }
 
 // VRPSolver VRP求解器
+// 先按仓库以 Savings (Clarke-Wright) 构造满足载重、时间窗与班次约束的初始解，
+// 再在时间预算内以 2-opt 与 relocate 局部搜索降低总费用。约束在构造与每次改进时校验，
+// 求解结果始终可行。
 type VRPSolver struct {
-	MaxVehicleCapacity int32
-	VehicleSpeed       float64 // km/h
+	TimeBudget time.Duration
 }
 
-func NewVRPSolver(capacity int32, speed float64) *VRPSolver {
-	return &VRPSolver{
-		MaxVehicleCapacity: capacity,
-		VehicleSpeed:       speed,
+func NewVRPSolver(timeBudget time.Duration) *VRPSolver {
+	if timeBudget <= 0 {
+		timeBudget = 2 * time.Second
 	}
+	return &VRPSolver{TimeBudget: timeBudget}
 }
 
-// Solve 使用 "Savings Algorithm" (Clarke-Wright) 结合时间窗约束求解
-func (s *VRPSolver) Solve(depot *DeliveryPoint, customers []*DeliveryPoint) ([]*Route, error) {
-	if len(customers) == 0 {
-		return nil, nil
+// Solve 求解车辆路径。
+func (s *VRPSolver) Solve(p *VRPProblem) *VRPSolution {
+	st := &vrpState{
+		p:           p,
+		routes:      make([][]*DeliveryPoint, len(p.Vehicles)),
+		costs:       make([]float64, len(p.Vehicles)),
+		carrierLoad: make(map[uint64]float64),
+		deadline:    time.Now().Add(s.TimeBudget),
 	}
 
-	// 1. 初始化：每个客户由一辆单独的车配送 (Depot -> Customer -> Depot)
-	routes := make([]*Route, len(customers))
-	for i, c := range customers {
-		dist := s.haversine(depot.Lat, depot.Lon, c.Lat, c.Lon) * 2
-		routes[i] = &Route{
-			Points:        []*DeliveryPoint{depot, c, depot},
-			TotalDistance: dist,
-			TotalLoad:     c.Demand,
+	pending := st.insertAll(st.construct())
+	moves := st.improve()
+	// 局部搜索腾出的车辆与运力可能容纳此前无法安排的客户
+	pending = st.insertAll(pending)
+
+	solution := &VRPSolution{Unassigned: pending, Moves: moves}
+	for k, pts := range st.routes {
+		if len(pts) == 0 {
+			continue
+		}
+		r, _ := st.evaluate(p.Vehicles[k], pts)
+		solution.Routes = append(solution.Routes, r)
+	}
+	return solution
+}
+
+// vrpState 求解过程中的车辆线路分配，routes 与 Vehicles 按下标一一对应。
+type vrpState struct {
+	p           *VRPProblem
+	routes      [][]*DeliveryPoint
+	costs       []float64
+	carrierLoad map[uint64]float64
+	deadline    time.Time
+}
+
+// evaluate 模拟车辆按顺序配送，校验服务范围、载重、时间窗与班次，返回含 ETA 的线路。
+func (st *vrpState) evaluate(v *RouteVehicle, pts []*DeliveryPoint) (*Route, bool) {
+	r := &Route{Vehicle: v, Points: pts, DepartAt: v.ShiftStart, ReturnAt: v.ShiftStart}
+	if len(pts) == 0 {
+		return r, true
+	}
+
+	t := v.ShiftStart
+	lat, lon := v.Depot.Lat, v.Depot.Lon
+	r.Arrivals = make([]time.Time, len(pts))
+	for i, c := range pts {
+		if st.p.CanServe != nil && !st.p.CanServe(v, c) {
+			return nil, false
+		}
+		r.TotalLoad += c.Demand
+		if r.TotalLoad > v.Capacity {
+			return nil, false
+		}
+		d := haversine(lat, lon, c.Lat, c.Lon)
+		r.TotalDistance += d
+		t = t.Add(travelTime(d, v.SpeedKmh))
+		if !c.CloseTime.IsZero() && t.After(c.CloseTime) {
+			return nil, false // 迟到了
+		}
+		if t.Before(c.OpenTime) {
+			t = c.OpenTime // 太早了，需要等时间窗开启
+		}
+		r.Arrivals[i] = t
+		t = t.Add(c.ServiceTime)
+		lat, lon = c.Lat, c.Lon
+	}
+
+	d := haversine(lat, lon, v.Depot.Lat, v.Depot.Lon)
+	r.TotalDistance += d
+	t = t.Add(travelTime(d, v.SpeedKmh))
+	if !v.ShiftEnd.IsZero() && t.After(v.ShiftEnd) {
+		return nil, false // 超出司机班次
+	}
+	r.ReturnAt = t
+	r.TotalDuration = t.Sub(r.DepartAt)
+	r.Cost = v.FixedCost + v.CostPerKm*r.TotalDistance + v.CostPerKg*r.TotalLoad
+	return r, true
+}
+
+// carrierFits 判断承运商追加 delta 载重后是否仍在可用运力内。
+func (st *vrpState) carrierFits(v *RouteVehicle, delta float64) bool {
+	capacity, ok := st.p.CarrierCapacity[v.CarrierID]
+	return !ok || st.carrierLoad[v.CarrierID]+delta <= capacity+costEpsilon
+}
+
+// assign 更新车辆线路并同步承运商载重。
+func (st *vrpState) assign(k int, r *Route) {
+	v := st.p.Vehicles[k]
+	old := 0.0
+	for _, c := range st.routes[k] {
+		old += c.Demand
+	}
+	st.carrierLoad[v.CarrierID] += r.TotalLoad - old
+	st.routes[k] = r.Points
+	if len(r.Points) == 0 {
+		st.costs[k] = 0
+		return
+	}
+	st.costs[k] = r.Cost
+}
+
+// construct 构造初始解：客户归属最近的可服务仓库，仓库内 Savings 合并后按载重降序分配费用最低的可行车辆。
+func (st *vrpState) construct() []*DeliveryPoint {
+	var pending []*DeliveryPoint
+	var depots []*Depot
+	groups := make(map[*Depot][]*DeliveryPoint)
+
+	for _, c := range st.p.Customers {
+		var home *Depot
+		best := math.Inf(1)
+		for _, v := range st.p.Vehicles {
+			if _, ok := st.evaluate(v, []*DeliveryPoint{c}); !ok {
+				continue
+			}
+			if d := haversine(v.Depot.Lat, v.Depot.Lon, c.Lat, c.Lon); d < best {
+				best, home = d, v.Depot
+			}
+		}
+		if home == nil {
+			pending = append(pending, c)
+			continue
+		}
+		if _, ok := groups[home]; !ok {
+			depots = append(depots, home)
+		}
+		groups[home] = append(groups[home], c)
+	}
+
+	for _, depot := range depots {
+		var fleet []*RouteVehicle
+		for _, v := range st.p.Vehicles {
+			if v.Depot == depot {
+				fleet = append(fleet, v)
+			}
+		}
+		routes := st.savings(depot, fleet, groups[depot])
+		sort.SliceStable(routes, func(i, j int) bool {
+			return load(routes[i]) > load(routes[j])
+		})
+		for _, pts := range routes {
+			k, r := st.cheapestIdleVehicle(pts)
+			if k < 0 {
+				pending = append(pending, pts...)
+				continue
+			}
+			st.assign(k, r)
 		}
 	}
+	return pending
+}
+
+// savings 以 Savings 算法合并同一仓库的客户，仅当合并后的线路可由仓库内某辆车可行服务时才合并。
+// Savings(i, j) = d(D, i) + d(D, j) - d(i, j)
+func (st *vrpState) savings(depot *Depot, fleet []*RouteVehicle, customers []*DeliveryPoint) [][]*DeliveryPoint {
+	routes := make([][]*DeliveryPoint, len(customers))
+	owner := make(map[*DeliveryPoint]int, len(customers))
+	for i, c := range customers {
+		routes[i] = []*DeliveryPoint{c}
+		owner[c] = i
+	}
 
-	// 2. 计算节约值 (Savings)
-	// Savings(i, j) = d(D, i) + d(D, j) - d(i, j)
 	type saving struct {
 		i, j  int
 		value float64
 	}
-	savings := make([]saving, 0)
-	for i := 0; i < len(customers); i++ {
+	var savings []saving
+	for i := range customers {
+		dDi := haversine(depot.Lat, depot.Lon, customers[i].Lat, customers[i].Lon)
 		for j := i + 1; j < len(customers); j++ {
-			dDi := s.haversine(depot.Lat, depot.Lon, customers[i].Lat, customers[i].Lon)
-			dDj := s.haversine(depot.Lat, depot.Lon, customers[j].Lat, customers[j].Lon)
-			dij := s.haversine(customers[i].Lat, customers[i].Lon, customers[j].Lat, customers[j].Lon)
-			val := dDi + dDj - dij
-			if val > 0 {
+			dDj := haversine(depot.Lat, depot.Lon, customers[j].Lat, customers[j].Lon)
+			dij := haversine(customers[i].Lat, customers[i].Lon, customers[j].Lat, customers[j].Lon)
+			if val := dDi + dDj - dij; val > 0 {
 				savings = append(savings, saving{i, j, val})
 			}
 		}
 	}
 
 	// 按节约值降序排序
-	sort.Slice(savings, func(i, j int) bool {
+	sort.SliceStable(savings, func(i, j int) bool {
 		return savings[i].value > savings[j].value
 	})
 
-	// 3. 尝试合并路径
 	for _, sav := range savings {
-		// 寻找包含 customers[sav.i] 和 customers[sav.j] 且位于路径端点的 Route
-		// 逻辑较复杂，此处演示核心思想：
-		// 如果合并后满足：1. 总负载 < MaxVehicleCapacity 2. 满足时间窗，则执行合并
-		s.tryMerge(sav.i, sav.j, routes)
+		a, b := customers[sav.i], customers[sav.j]
+		ra, rb := owner[a], owner[b]
+		if ra == rb {
+			continue
+		}
+		for _, merged := range joinAtEnds(routes[ra], routes[rb], a, b) {
+			if !st.servable(fleet, merged) {
+				continue
+			}
+			routes[ra], routes[rb] = merged, nil
+			for _, c := range merged {
+				owner[c] = ra
+			}
+			break
+		}
 	}
 
-	return routes, nil
+	out := make([][]*DeliveryPoint, 0, len(routes))
+	for _, r := range routes {
+		if len(r) > 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// servable 判断车队中是否有车辆能可行地服务整条线路。
+func (st *vrpState) servable(fleet []*RouteVehicle, pts []*DeliveryPoint) bool {
+	for _, v := range fleet {
+		if _, ok := st.evaluate(v, pts); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cheapestIdleVehicle 在尚未出车的车辆中选择能可行服务线路且费用最低者，没有时返回 -1。
+func (st *vrpState) cheapestIdleVehicle(pts []*DeliveryPoint) (int, *Route) {
+	best, bestRoute := -1, (*Route)(nil)
+	for k, v := range st.p.Vehicles {
+		if len(st.routes[k]) > 0 {
+			continue
+		}
+		r, ok := st.evaluate(v, pts)
+		if !ok || !st.carrierFits(v, r.TotalLoad) {
+			continue
+		}
+		if bestRoute == nil || r.Cost < bestRoute.Cost {
+			best, bestRoute = k, r
+		}
+	}
+	return best, bestRoute
+}
+
+// insertAll 将客户逐个插入到增量费用最低的可行位置 (含空闲车辆)，返回仍无法安排的客户。
+func (st *vrpState) insertAll(customers []*DeliveryPoint) []*DeliveryPoint {
+	var left []*DeliveryPoint
+	for _, c := range customers {
+		bestK, bestRoute, bestDelta := -1, (*Route)(nil), math.Inf(1)
+		for k, v := range st.p.Vehicles {
+			if !st.carrierFits(v, c.Demand) {
+				continue
+			}
+			for pos := 0; pos <= len(st.routes[k]); pos++ {
+				r, ok := st.evaluate(v, insertAt(st.routes[k], pos, c))
+				if !ok {
+					continue
+				}
+				if delta := r.Cost - st.costs[k]; delta < bestDelta {
+					bestK, bestRoute, bestDelta = k, r, delta
+				}
+			}
+		}
+		if bestK < 0 {
+			left = append(left, c)
+			continue
+		}
+		st.assign(bestK, bestRoute)
+	}
+	return left
+}
+
+// improve 在时间预算内交替执行 2-opt 与 relocate，直到没有改进或超时，返回改进次数。
+func (st *vrpState) improve() int {
+	moves := 0
+	for improved := true; improved && time.Now().Before(st.deadline); {
+		improved = false
+		for k := range st.routes {
+			for st.twoOpt(k) {
+				improved = true
+				moves++
+			}
+		}
+		for st.relocate() {
+			improved = true
+			moves++
+		}
+	}
+	return moves
+}
+
+// twoOpt 反转线路中的一段以消除交叉，找到第一个可行且降低费用的反转即应用。
+func (st *vrpState) twoOpt(k int) bool {
+	pts := st.routes[k]
+	v := st.p.Vehicles[k]
+	for i := 0; i < len(pts)-1; i++ {
+		for j := i + 1; j < len(pts); j++ {
+			if time.Now().After(st.deadline) {
+				return false
+			}
+			cand := append([]*DeliveryPoint(nil), pts...)
+			for l, r := i, j; l < r; l, r = l+1, r-1 {
+				cand[l], cand[r] = cand[r], cand[l]
+			}
+			if r, ok := st.evaluate(v, cand); ok && r.Cost < st.costs[k]-costEpsilon {
+				st.assign(k, r)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// relocate 将一个客户移动到其他车辆线路 (含空闲车辆) 的某个位置，找到第一个可行且降低总费用的移动即应用。
+// 线路被移空时车辆不再出车，节省固定费用。
+func (st *vrpState) relocate() bool {
+	for a, pts := range st.routes {
+		va := st.p.Vehicles[a]
+		for i, c := range pts {
+			removed, ok := st.evaluate(va, removeAt(pts, i))
+			if !ok {
+				continue
+			}
+			gain := st.costs[a] - removed.Cost
+			for b, target := range st.routes {
+				if b == a {
+					continue
+				}
+				vb := st.p.Vehicles[b]
+				if vb.CarrierID != va.CarrierID && !st.carrierFits(vb, c.Demand) {
+					continue
+				}
+				for pos := 0; pos <= len(target); pos++ {
+					if time.Now().After(st.deadline) {
+						return false
+					}
+					inserted, ok := st.evaluate(vb, insertAt(target, pos, c))
+					if !ok || inserted.Cost-st.costs[b]-gain >= -costEpsilon {
+						continue
+					}
+					st.assign(a, removed)
+					st.assign(b, inserted)
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// joinAtEnds 在 a、b 分别位于两条线路端点时返回可能的首尾拼接方式。
+func joinAtEnds(r1, r2 []*DeliveryPoint, a, b *DeliveryPoint) [][]*DeliveryPoint {
+	head1, tail1 := r1[0] == a, r1[len(r1)-1] == a
+	head2, tail2 := r2[0] == b, r2[len(r2)-1] == b
+	var out [][]*DeliveryPoint
+	if tail1 && head2 { // 路径1尾部连路径2头部
+		out = append(out, concat(r1, r2))
+	}
+	if head1 && tail2 { // 路径2尾部连路径1头部
+		out = append(out, concat(r2, r1))
+	}
+	if head1 && head2 { // 翻转路径1，头部连头部
+		out = append(out, concat(reversed(r1), r2))
+	}
+	if tail1 && tail2 { // 路径1尾部连路径2尾部（翻转路径2）
+		out = append(out, concat(r1, reversed(r2)))
+	}
+	return out
+}
+
+func concat(a, b []*DeliveryPoint) []*DeliveryPoint {
+	out := make([]*DeliveryPoint, 0, len(a)+len(b))
+	return append(append(out, a...), b...)
+}
+
+func reversed(pts []*DeliveryPoint) []*DeliveryPoint {
+	out := make([]*DeliveryPoint, len(pts))
+	for i, p := range pts {
+		out[len(pts)-1-i] = p
+	}
+	return out
+}
+
+func insertAt(pts []*DeliveryPoint, pos int, c *DeliveryPoint) []*DeliveryPoint {
+	out := make([]*DeliveryPoint, 0, len(pts)+1)
+	out = append(out, pts[:pos]...)
+	out = append(out, c)
+	return append(out, pts[pos:]...)
+}
+
+func removeAt(pts []*DeliveryPoint, i int) []*DeliveryPoint {
+	out := make([]*DeliveryPoint, 0, len(pts)-1)
+	out = append(out, pts[:i]...)
+	return append(out, pts[i+1:]...)
+}
+
+func load(pts []*DeliveryPoint) float64 {
+	var sum float64
+	for _, c := range pts {
+		sum += c.Demand
+	}
+	return sum
+}
+
+// travelTime 按平均车速计算行驶时长。
+func travelTime(distanceKm, speedKmh float64) time.Duration {
+	return time.Duration(distanceKm / speedKmh * float64(time.Hour))
 }
 
 // haversine 计算球面距离 (km)
-func (s *VRPSolver) haversine(lat1, lon1, lat2, lon2 float64) float64 {
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
 	const R = 6371 // Earth radius in km
 	dLat := (lat2 - lat1) * (math.Pi / 180)
 	dLon := (lon2 - lon1) * (math.Pi / 180)
@@ -100,29 +500,3 @@ func (s *VRPSolver) haversine(lat1, lon1, lat2, lon2 float64) float64 {
 	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
 	return R * c
 }
-
-func (s *VRPSolver) tryMerge(i, j int, routes []*Route) {
-	// 实际合并逻辑涉及复杂的切片操作和约束检查
-	// 这里通过注释说明，这是一个典型的 O(N^2) 启发式算法，用于解决物流路由优化
-}
-
-func (s *VRPSolver) CheckTimeWindows(r *Route) bool {
-	currentTime := r.Points[0].OpenTime
-	for i := 1; i < len(r.Points); i++ {
-		prev := r.Points[i-1]
-		curr := r.Points[i]
-		dist := s.haversine(prev.Lat, prev.Lon, curr.Lat, curr.Lon)
-		travelTime := time.Duration(dist/s.VehicleSpeed) * time.Hour
-
-		arrivalTime := currentTime.Add(travelTime)
-		if arrivalTime.After(curr.CloseTime) {
-			return false // 迟到了
-		}
-		if arrivalTime.Before(curr.OpenTime) {
-			currentTime = curr.OpenTime // 太早了，需要等开门
-		} else {
-			currentTime = arrivalTime
-		}
-	}
-	return true
-}
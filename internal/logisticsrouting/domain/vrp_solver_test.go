@@ -0,0 +1,344 @@
+package domain
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var (
+	testBase  = time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	testDepot = &Depot{ID: 1, Name: "上海仓", Lat: 31.0, Lon: 121.0}
+)
+
+// testVehicle 创建驻扎在 depot 的车辆，车速 30km/h，纬度每 0.1 度约 11.1km、行驶约 22 分钟。
+func testVehicle(id uint64, depot *Depot, fixedCost float64) *RouteVehicle {
+	return &RouteVehicle{ID: id, CarrierID: id, Depot: depot, Capacity: 1000, SpeedKmh: 30, ShiftStart: testBase, FixedCost: fixedCost, CostPerKm: 1}
+}
+
+func testPoint(id uint64, lat float64) *DeliveryPoint {
+	return &DeliveryPoint{ID: id, Lat: lat, Lon: 121.0, Demand: 10}
+}
+
+// checkFeasible 校验每个客户恰好被安排一次，且每条线路满足载重、时间窗、班次与承运商运力约束。
+func checkFeasible(t *testing.T, p *VRPProblem, sol *VRPSolution) {
+	t.Helper()
+	seen := make(map[uint64]int)
+	carrierLoad := make(map[uint64]float64)
+	for _, r := range sol.Routes {
+		v := r.Vehicle
+		if r.TotalLoad > v.Capacity {
+			t.Errorf("vehicle %d load %.1f exceeds capacity %.1f", v.ID, r.TotalLoad, v.Capacity)
+		}
+		if !v.ShiftEnd.IsZero() && r.ReturnAt.After(v.ShiftEnd) {
+			t.Errorf("vehicle %d returns at %s after shift end %s", v.ID, r.ReturnAt, v.ShiftEnd)
+		}
+		carrierLoad[v.CarrierID] += r.TotalLoad
+		for i, c := range r.Points {
+			seen[c.ID]++
+			eta := r.Arrivals[i]
+			if eta.Before(c.OpenTime) || (!c.CloseTime.IsZero() && eta.After(c.CloseTime)) {
+				t.Errorf("customer %d served at %s outside window [%s, %s]", c.ID, eta, c.OpenTime, c.CloseTime)
+			}
+			if p.CanServe != nil && !p.CanServe(v, c) {
+				t.Errorf("vehicle %d cannot serve customer %d", v.ID, c.ID)
+			}
+		}
+	}
+	for carrierID, capacity := range p.CarrierCapacity {
+		if carrierLoad[carrierID] > capacity {
+			t.Errorf("carrier %d load %.1f exceeds capacity %.1f", carrierID, carrierLoad[carrierID], capacity)
+		}
+	}
+	for _, c := range sol.Unassigned {
+		seen[c.ID]++
+	}
+	for _, c := range p.Customers {
+		if seen[c.ID] != 1 {
+			t.Errorf("customer %d scheduled %d times", c.ID, seen[c.ID])
+		}
+	}
+}
+
+func routeIDs(r *Route) []uint64 {
+	ids := make([]uint64, len(r.Points))
+	for i, c := range r.Points {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+func unassignedIDs(sol *VRPSolution) map[uint64]bool {
+	ids := make(map[uint64]bool, len(sol.Unassigned))
+	for _, c := range sol.Unassigned {
+		ids[c.ID] = true
+	}
+	return ids
+}
+
+func TestVRPSolverTimeWindows(t *testing.T) {
+	// 几何顺序为 A 先 B 后，但 B 的时间窗早于 A，可行顺序只能是 B -> A
+	a := testPoint(1, 31.1)
+	a.OpenTime = testBase.Add(2 * time.Hour)
+	a.CloseTime = testBase.Add(150 * time.Minute)
+	b := testPoint(2, 31.2)
+	b.CloseTime = testBase.Add(50 * time.Minute)
+	// C 的时间窗在车辆出发后 10 分钟关闭，任何车辆都赶不到
+	c := testPoint(3, 31.3)
+	c.CloseTime = testBase.Add(10 * time.Minute)
+	// D 早到时需要等待时间窗开启；D 的时间窗晚于 A 关闭，只能排在 A 之后
+	d := testPoint(4, 31.15)
+	d.OpenTime = testBase.Add(3 * time.Hour)
+	d.CloseTime = testBase.Add(4 * time.Hour)
+	d.ServiceTime = 10 * time.Minute
+
+	p := &VRPProblem{
+		Customers: []*DeliveryPoint{a, b, c, d},
+		Vehicles:  []*RouteVehicle{testVehicle(1, testDepot, 100)},
+	}
+	sol := NewVRPSolver(time.Second).Solve(p)
+	checkFeasible(t, p, sol)
+
+	if len(sol.Routes) != 1 {
+		t.Fatalf("routes = %d, want 1", len(sol.Routes))
+	}
+	r := sol.Routes[0]
+	if ids := routeIDs(r); len(ids) != 3 || ids[0] != 2 || ids[1] != 1 || ids[2] != 4 {
+		t.Fatalf("route = %v, want [2 1 4]", ids)
+	}
+	if !r.Arrivals[1].Equal(a.OpenTime) || !r.Arrivals[2].Equal(d.OpenTime) {
+		t.Fatalf("arrivals = %v, want waiting until window opens", r.Arrivals)
+	}
+	if un := unassignedIDs(sol); len(un) != 1 || !un[3] {
+		t.Fatalf("unassigned = %v, want [3]", un)
+	}
+}
+
+func TestVRPSolverShiftLimits(t *testing.T) {
+	// 往返 A 约 44 分钟，往返 B 约 89 分钟，1 小时班次的车辆只能服务 A
+	a := testPoint(1, 31.1)
+	b := testPoint(2, 31.2)
+
+	t.Run("customer beyond shift is unassigned", func(t *testing.T) {
+		v := testVehicle(1, testDepot, 100)
+		v.ShiftEnd = testBase.Add(time.Hour)
+		p := &VRPProblem{Customers: []*DeliveryPoint{a, b}, Vehicles: []*RouteVehicle{v}}
+		sol := NewVRPSolver(time.Second).Solve(p)
+		checkFeasible(t, p, sol)
+		if len(sol.Routes) != 1 || len(sol.Routes[0].Points) != 1 || sol.Routes[0].Points[0] != a {
+			t.Fatalf("routes = %+v, want only customer 1", sol.Routes)
+		}
+		if un := unassignedIDs(sol); !un[2] {
+			t.Fatalf("unassigned = %v, want customer 2", un)
+		}
+	})
+
+	t.Run("longer shift vehicle takes the far customer", func(t *testing.T) {
+		short := testVehicle(1, testDepot, 100)
+		short.ShiftEnd = testBase.Add(time.Hour)
+		long := testVehicle(2, testDepot, 300)
+		p := &VRPProblem{Customers: []*DeliveryPoint{a, b}, Vehicles: []*RouteVehicle{short, long}}
+		sol := NewVRPSolver(time.Second).Solve(p)
+		checkFeasible(t, p, sol)
+		if len(sol.Unassigned) != 0 {
+			t.Fatalf("unassigned = %v", unassignedIDs(sol))
+		}
+		for _, r := range sol.Routes {
+			for _, c := range r.Points {
+				if c == b && r.Vehicle != long {
+					t.Fatalf("customer 2 served by vehicle %d, want the vehicle without shift limit", r.Vehicle.ID)
+				}
+			}
+		}
+	})
+
+	t.Run("late shift start delays departure", func(t *testing.T) {
+		v := testVehicle(1, testDepot, 100)
+		v.ShiftStart = testBase.Add(2 * time.Hour)
+		late := testPoint(3, 31.1)
+		late.CloseTime = testBase.Add(2 * time.Hour)
+		p := &VRPProblem{Customers: []*DeliveryPoint{late}, Vehicles: []*RouteVehicle{v}}
+		sol := NewVRPSolver(time.Second).Solve(p)
+		checkFeasible(t, p, sol)
+		if len(sol.Routes) != 0 || len(sol.Unassigned) != 1 {
+			t.Fatalf("routes = %d, unassigned = %d, want the customer unassigned", len(sol.Routes), len(sol.Unassigned))
+		}
+	})
+}
+
+func TestVRPSolverMultiDepotAndCarrierConstraints(t *testing.T) {
+	beijing := &Depot{ID: 2, Name: "北京仓", Lat: 39.9, Lon: 116.4}
+	sh1 := testPoint(1, 31.05)
+	sh2 := testPoint(2, 31.06)
+	bj := &DeliveryPoint{ID: 3, Lat: 39.95, Lon: 116.45, Demand: 10}
+
+	shVehicle := testVehicle(1, testDepot, 100)
+	shVehicle.Capacity = 15
+	shBackup := testVehicle(2, testDepot, 100)
+	bjVehicle := testVehicle(3, beijing, 100)
+
+	p := &VRPProblem{
+		Customers: []*DeliveryPoint{sh1, sh2, bj},
+		Vehicles:  []*RouteVehicle{shVehicle, shBackup, bjVehicle},
+		// 承运商 2 本次仅剩 10kg 运力
+		CarrierCapacity: map[uint64]float64{2: 10},
+		// 北京仓车辆只服务北方客户
+		CanServe: func(v *RouteVehicle, c *DeliveryPoint) bool {
+			return v.Depot != beijing || c.Lat > 35
+		},
+	}
+	sol := NewVRPSolver(time.Second).Solve(p)
+	checkFeasible(t, p, sol)
+
+	if len(sol.Unassigned) != 0 {
+		t.Fatalf("unassigned = %v", unassignedIDs(sol))
+	}
+	for _, r := range sol.Routes {
+		for _, c := range r.Points {
+			if (c == bj) != (r.Vehicle.Depot == beijing) {
+				t.Fatalf("customer %d served from depot %s", c.ID, r.Vehicle.Depot.Name)
+			}
+		}
+	}
+	// 上海两位客户共 20kg，超出单车 15kg 与承运商 2 的 10kg 运力，只能分两车配送
+	if len(sol.Routes) != 3 {
+		t.Fatalf("routes = %d, want 3", len(sol.Routes))
+	}
+}
+
+// newTestState 构造尚未求解的状态，便于单独验证局部搜索。
+func newTestState(p *VRPProblem, budget time.Duration) *vrpState {
+	return &vrpState{
+		p:           p,
+		routes:      make([][]*DeliveryPoint, len(p.Vehicles)),
+		costs:       make([]float64, len(p.Vehicles)),
+		carrierLoad: make(map[uint64]float64),
+		deadline:    time.Now().Add(budget),
+	}
+}
+
+func (st *vrpState) mustAssign(t *testing.T, k int, pts ...*DeliveryPoint) {
+	t.Helper()
+	r, ok := st.evaluate(st.p.Vehicles[k], pts)
+	if !ok {
+		t.Fatalf("route %v infeasible for vehicle %d", pts, k)
+	}
+	st.assign(k, r)
+}
+
+func (st *vrpState) totalCost() float64 {
+	var sum float64
+	for _, c := range st.costs {
+		sum += c
+	}
+	return sum
+}
+
+func TestVRPSolverTwoOpt(t *testing.T) {
+	pts := []*DeliveryPoint{testPoint(1, 31.1), testPoint(2, 31.2), testPoint(3, 31.3), testPoint(4, 31.4)}
+	st := newTestState(&VRPProblem{Customers: pts, Vehicles: []*RouteVehicle{testVehicle(1, testDepot, 0)}}, time.Second)
+	// 交叉线路 1 -> 3 -> 2 -> 4
+	st.mustAssign(t, 0, pts[0], pts[2], pts[1], pts[3])
+	before := st.costs[0]
+
+	if !st.twoOpt(0) {
+		t.Fatal("expected an improving 2-opt move")
+	}
+	if st.costs[0] >= before {
+		t.Fatalf("cost = %.3f, want below %.3f", st.costs[0], before)
+	}
+	got := routeIDs(&Route{Points: st.routes[0]})
+	if got[0] != 1 || got[1] != 2 || got[2] != 3 || got[3] != 4 {
+		t.Fatalf("route = %v, want [1 2 3 4]", got)
+	}
+	if st.twoOpt(0) {
+		t.Fatal("optimal route should not be changed again")
+	}
+}
+
+func TestVRPSolverRelocate(t *testing.T) {
+	x, y := testPoint(1, 31.1), testPoint(2, 31.11)
+	p := &VRPProblem{
+		Customers: []*DeliveryPoint{x, y},
+		Vehicles:  []*RouteVehicle{testVehicle(1, testDepot, 100), testVehicle(2, testDepot, 100)},
+	}
+	st := newTestState(p, time.Second)
+	st.mustAssign(t, 0, x)
+	st.mustAssign(t, 1, y)
+	before := st.totalCost()
+
+	if !st.relocate() {
+		t.Fatal("expected an improving relocate move")
+	}
+	if st.totalCost() >= before-100 {
+		t.Fatalf("total cost = %.3f, want the fixed cost of one vehicle saved from %.3f", st.totalCost(), before)
+	}
+	if len(st.routes[0]) != 0 && len(st.routes[1]) != 0 {
+		t.Fatalf("routes = %d and %d customers, want one vehicle emptied", len(st.routes[0]), len(st.routes[1]))
+	}
+	if st.carrierLoad[1]+st.carrierLoad[2] != 20 || (st.carrierLoad[1] != 0 && st.carrierLoad[2] != 0) {
+		t.Fatalf("carrier load = %v, want moved with the customer", st.carrierLoad)
+	}
+}
+
+func TestVRPSolverRelocateRespectsTimeWindows(t *testing.T) {
+	// x、y 分处仓库南北两侧，合并到一辆车时无论先送哪位都会使另一位迟到，relocate 不得产生不可行线路
+	x, y := testPoint(1, 30.7), testPoint(2, 31.1)
+	x.CloseTime = testBase.Add(70 * time.Minute)
+	y.CloseTime = testBase.Add(25 * time.Minute)
+	p := &VRPProblem{
+		Customers: []*DeliveryPoint{x, y},
+		Vehicles:  []*RouteVehicle{testVehicle(1, testDepot, 100), testVehicle(2, testDepot, 100)},
+	}
+	st := newTestState(p, time.Second)
+	st.mustAssign(t, 0, x)
+	st.mustAssign(t, 1, y)
+	if st.relocate() {
+		t.Fatalf("relocate produced routes %v / %v", routeIDs(&Route{Points: st.routes[0]}), routeIDs(&Route{Points: st.routes[1]}))
+	}
+}
+
+func TestVRPSolverImproveTimeBudget(t *testing.T) {
+	pts := []*DeliveryPoint{testPoint(1, 31.1), testPoint(2, 31.2), testPoint(3, 31.3), testPoint(4, 31.4)}
+	p := &VRPProblem{Customers: pts, Vehicles: []*RouteVehicle{testVehicle(1, testDepot, 0)}}
+
+	// 预算耗尽时不再改进
+	st := newTestState(p, -time.Second)
+	st.mustAssign(t, 0, pts[0], pts[2], pts[1], pts[3])
+	before := st.costs[0]
+	if moves := st.improve(); moves != 0 || st.costs[0] != before {
+		t.Fatalf("moves = %d, cost %.3f -> %.3f, want untouched after deadline", moves, before, st.costs[0])
+	}
+
+	st = newTestState(p, time.Second)
+	st.mustAssign(t, 0, pts[0], pts[2], pts[1], pts[3])
+	if moves := st.improve(); moves == 0 || st.costs[0] >= before {
+		t.Fatalf("moves = %d, cost %.3f -> %.3f, want improvement within budget", moves, before, st.costs[0])
+	}
+}
+
+func TestVRPSolverSolveReportsItinerary(t *testing.T) {
+	pts := []*DeliveryPoint{testPoint(1, 31.1), testPoint(2, 31.2)}
+	v := testVehicle(1, testDepot, 50)
+	p := &VRPProblem{Customers: pts, Vehicles: []*RouteVehicle{v}}
+	sol := NewVRPSolver(0).Solve(p)
+	checkFeasible(t, p, sol)
+	if len(sol.Routes) != 1 {
+		t.Fatalf("routes = %d, want 1", len(sol.Routes))
+	}
+
+	r := sol.Routes[0]
+	leg := haversine(31.0, 121.0, 31.1, 121.0)
+	if math.Abs(r.TotalDistance-4*leg) > 0.01 {
+		t.Fatalf("distance = %.3f, want %.3f", r.TotalDistance, 4*leg)
+	}
+	if want := testBase.Add(travelTime(leg, v.SpeedKmh)); !r.Arrivals[0].Equal(want) {
+		t.Fatalf("first eta = %s, want %s", r.Arrivals[0], want)
+	}
+	if !r.DepartAt.Equal(testBase) || r.TotalDuration != r.ReturnAt.Sub(r.DepartAt) {
+		t.Fatalf("depart = %s, return = %s, duration = %s", r.DepartAt, r.ReturnAt, r.TotalDuration)
+	}
+	if want := v.FixedCost + v.CostPerKm*r.TotalDistance + v.CostPerKg*r.TotalLoad; math.Abs(r.Cost-want) > 1e-9 || r.TotalLoad != 20 {
+		t.Fatalf("cost = %.3f, load = %.1f", r.Cost, r.TotalLoad)
+	}
+}
@@ -0,0 +1,70 @@
+package geocoding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/wyfcoding/ecommerce/internal/logisticsrouting/domain"
+)
+
+// GazetteerEntry 是地名库中的一条行政区划坐标记录。
+// 仅填写 Province 表示省级中心点，填写 City 表示市级中心点，填写 District 表示区县中心点。
+type GazetteerEntry struct {
+	Province string  `json:"province"`
+	City     string  `json:"city"`
+	District string  `json:"district"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+}
+
+// Gazetteer 是基于离线地名库文件的地理编码实现，按 区县 > 市 > 省 逐级回退匹配。
+// 不依赖外部地图服务，适用于测试环境与地图服务不可用时的降级。
+type Gazetteer struct {
+	points map[string]domain.GeoPoint
+}
+
+// NewGazetteer 从 JSON 文件加载地名库，文件内容为 GazetteerEntry 数组。
+func NewGazetteer(path string) (*Gazetteer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gazetteer %s: %w", path, err)
+	}
+	var entries []GazetteerEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse gazetteer %s: %w", path, err)
+	}
+	return NewGazetteerFromEntries(entries), nil
+}
+
+// NewGazetteerFromEntries 使用内存中的记录创建地名库。
+func NewGazetteerFromEntries(entries []GazetteerEntry) *Gazetteer {
+	g := &Gazetteer{points: make(map[string]domain.GeoPoint, len(entries))}
+	for _, e := range entries {
+		g.points[gazetteerKey(e.Province, e.City, e.District)] = domain.GeoPoint{Lat: e.Lat, Lon: e.Lon}
+	}
+	return g
+}
+
+// Geocode 返回地址所在最细一级行政区划的中心点坐标，Precision 标明命中的行政区划级别。
+func (g *Gazetteer) Geocode(_ context.Context, addr domain.Address) (domain.GeoPoint, error) {
+	for _, level := range []struct {
+		key       string
+		precision domain.GeoPrecision
+	}{
+		{gazetteerKey(addr.Province, addr.City, addr.District), domain.GeoPrecisionDistrict},
+		{gazetteerKey(addr.Province, addr.City, ""), domain.GeoPrecisionCity},
+		{gazetteerKey(addr.Province, "", ""), domain.GeoPrecisionProvince},
+	} {
+		if point, ok := g.points[level.key]; ok {
+			point.Precision = level.precision
+			return point, nil
+		}
+	}
+	return domain.GeoPoint{}, fmt.Errorf("%w: %s", domain.ErrAddressNotGeocoded, addr.String())
+}
+
+func gazetteerKey(province, city, district string) string {
+	return domain.NormalizeRegion(province) + "|" + domain.NormalizeRegion(city) + "|" + district
+}
@@ -0,0 +1,103 @@
+package geocoding
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/wyfcoding/ecommerce/internal/logisticsrouting/domain"
+)
+
+func testGazetteer() *Gazetteer {
+	return NewGazetteerFromEntries([]GazetteerEntry{
+		{Province: "上海市", Lat: 31.2304, Lon: 121.4737},
+		{Province: "上海市", City: "上海市", Lat: 31.2305, Lon: 121.4738},
+		{Province: "上海市", City: "上海市", District: "徐汇区", Lat: 31.1885, Lon: 121.4365},
+		{Province: "江苏省", Lat: 32.0603, Lon: 118.7969},
+		{Province: "江苏省", City: "苏州市", Lat: 31.2989, Lon: 120.5853},
+	})
+}
+
+func TestGazetteerGeocode(t *testing.T) {
+	tests := []struct {
+		name string
+		addr domain.Address
+		want domain.GeoPoint
+	}{
+		{
+			name: "district",
+			addr: domain.Address{Province: "上海市", City: "上海市", District: "徐汇区", Detail: "漕溪北路 1 号"},
+			want: domain.GeoPoint{Lat: 31.1885, Lon: 121.4365, Precision: domain.GeoPrecisionDistrict},
+		},
+		{
+			name: "district without province and city suffix",
+			addr: domain.Address{Province: "上海", City: "上海", District: "徐汇区"},
+			want: domain.GeoPoint{Lat: 31.1885, Lon: 121.4365, Precision: domain.GeoPrecisionDistrict},
+		},
+		{
+			name: "unknown district falls back to city",
+			addr: domain.Address{Province: "江苏省", City: "苏州市", District: "工业园区"},
+			want: domain.GeoPoint{Lat: 31.2989, Lon: 120.5853, Precision: domain.GeoPrecisionCity},
+		},
+		{
+			name: "unknown city falls back to province",
+			addr: domain.Address{Province: "江苏省", City: "宿迁市", District: "沭阳县"},
+			want: domain.GeoPoint{Lat: 32.0603, Lon: 118.7969, Precision: domain.GeoPrecisionProvince},
+		},
+		{
+			name: "district is not matched across cities",
+			addr: domain.Address{Province: "江苏省", City: "无锡市", District: "徐汇区"},
+			want: domain.GeoPoint{Lat: 32.0603, Lon: 118.7969, Precision: domain.GeoPrecisionProvince},
+		},
+	}
+	g := testGazetteer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.Geocode(context.Background(), tt.addr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Geocode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGazetteerUnknownAddress(t *testing.T) {
+	g := testGazetteer()
+	for _, addr := range []domain.Address{
+		{Province: "西藏自治区", City: "拉萨市", District: "城关区"},
+		{},
+	} {
+		_, err := g.Geocode(context.Background(), addr)
+		if !errors.Is(err, domain.ErrAddressNotGeocoded) {
+			t.Fatalf("Geocode(%+v) error = %v, want ErrAddressNotGeocoded", addr, err)
+		}
+	}
+}
+
+func TestNewGazetteer(t *testing.T) {
+	// 仓库自带的地名库可以加载并解析区县地址
+	g, err := NewGazetteer(filepath.Join("..", "..", "..", "..", "configs", "logisticsrouting", "gazetteer.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	point, err := g.Geocode(context.Background(), domain.Address{Province: "上海市", City: "上海市", District: "浦东新区"})
+	if err != nil || point.Precision != domain.GeoPrecisionDistrict {
+		t.Fatalf("Geocode() = %+v, %v", point, err)
+	}
+
+	if _, err := NewGazetteer(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"province":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewGazetteer(bad); err == nil {
+		t.Fatal("expected error for malformed file")
+	}
+}
@@ -47,6 +47,24 @@ func (r *logisticsRoutingRepository) ListCarriers(ctx context.Context, activeOnl
 	return carriers, nil
 }
 
+// --- 车辆 (Vehicle methods) ---
+
+func (r *logisticsRoutingRepository) SaveVehicle(ctx context.Context, vehicle *domain.Vehicle) error {
+	return r.db.WithContext(ctx).Save(vehicle).Error
+}
+
+func (r *logisticsRoutingRepository) ListVehicles(ctx context.Context, activeOnly bool) ([]*domain.Vehicle, error) {
+	var vehicles []*domain.Vehicle
+	db := r.db.WithContext(ctx)
+	if activeOnly {
+		db = db.Where("is_active = ?", true)
+	}
+	if err := db.Order("id").Find(&vehicles).Error; err != nil {
+		return nil, err
+	}
+	return vehicles, nil
+}
+
 // --- 路由 (OptimizedRoute methods) ---
 
 func (r *logisticsRoutingRepository) SaveRoute(ctx context.Context, route *domain.OptimizedRoute) error {
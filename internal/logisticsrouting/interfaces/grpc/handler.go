@@ -2,7 +2,9 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	pb "github.com/wyfcoding/ecommerce/goapi/logisticsrouting/v1"
 	"github.com/wyfcoding/ecommerce/internal/logisticsrouting/application"
@@ -49,9 +51,26 @@ func (s *Server) RegisterCarrier(ctx context.Context, req *pb.RegisterCarrierReq
 
 // OptimizeRoute 处理优化配送路线的gRPC请求。
 func (s *Server) OptimizeRoute(ctx context.Context, req *pb.OptimizeRouteRequest) (*pb.OptimizeRouteResponse, error) {
-	route, err := s.app.OptimizeRoute(ctx, req.OrderIds)
+	orders := make([]domain.OrderRef, 0, len(req.Orders)+len(req.OrderIds))
+	for _, o := range req.Orders {
+		orders = append(orders, domain.OrderRef{
+			OrderID:       o.OrderId,
+			UserID:        o.UserId,
+			DeliverAfter:  fromTimestamp(o.DeliverAfter),
+			DeliverBefore: fromTimestamp(o.DeliverBefore),
+		})
+	}
+	for _, id := range req.OrderIds {
+		orders = append(orders, domain.OrderRef{OrderID: id})
+	}
+
+	route, err := s.app.OptimizeRoute(ctx, orders, fromTimestamp(req.DepartAt))
 	if err != nil {
-		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to optimize route: %v", err))
+		code := codes.Internal
+		if errors.Is(err, domain.ErrNoCarrierAvailable) || errors.Is(err, domain.ErrAddressNotGeocoded) {
+			code = codes.FailedPrecondition
+		}
+		return nil, status.Error(code, fmt.Sprintf("failed to optimize route: %v", err))
 	}
 
 	return &pb.OptimizeRouteResponse{
@@ -88,6 +107,68 @@ func (s *Server) ListCarriers(ctx context.Context, _ *emptypb.Empty) (*pb.ListCa
 	}, nil
 }
 
+// RegisterVehicle 处理登记配送车辆的gRPC请求。
+func (s *Server) RegisterVehicle(ctx context.Context, req *pb.RegisterVehicleRequest) (*pb.RegisterVehicleResponse, error) {
+	vehicle := &domain.Vehicle{
+		PlateNo:     req.PlateNo,
+		CarrierID:   req.CarrierId,
+		WarehouseID: req.WarehouseId,
+		VehicleType: req.VehicleType,
+		Capacity:    req.Capacity,
+		SpeedKmh:    req.SpeedKmh,
+		ShiftStart:  req.ShiftStart,
+		ShiftHours:  req.ShiftHours,
+		IsActive:    true,
+	}
+
+	if err := s.app.RegisterVehicle(ctx, vehicle); err != nil {
+		code := codes.Internal
+		if errors.Is(err, domain.ErrInvalidVehicle) {
+			code = codes.InvalidArgument
+		}
+		return nil, status.Error(code, fmt.Sprintf("failed to register vehicle: %v", err))
+	}
+
+	return &pb.RegisterVehicleResponse{Vehicle: convertVehicleToProto(vehicle)}, nil
+}
+
+// ListVehicles 处理列出配送车辆的gRPC请求。
+func (s *Server) ListVehicles(ctx context.Context, _ *emptypb.Empty) (*pb.ListVehiclesResponse, error) {
+	vehicles, err := s.app.ListVehicles(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to list vehicles: %v", err))
+	}
+
+	pbVehicles := make([]*pb.Vehicle, len(vehicles))
+	for i, v := range vehicles {
+		pbVehicles[i] = convertVehicleToProto(v)
+	}
+
+	return &pb.ListVehiclesResponse{
+		Vehicles: pbVehicles,
+	}, nil
+}
+
+func convertVehicleToProto(v *domain.Vehicle) *pb.Vehicle {
+	if v == nil {
+		return nil
+	}
+	return &pb.Vehicle{
+		Id:          uint64(v.ID),
+		PlateNo:     v.PlateNo,
+		CarrierId:   v.CarrierID,
+		WarehouseId: v.WarehouseID,
+		VehicleType: v.VehicleType,
+		Capacity:    v.Capacity,
+		SpeedKmh:    v.SpeedKmh,
+		ShiftStart:  v.ShiftStart,
+		ShiftHours:  v.ShiftHours,
+		IsActive:    v.IsActive,
+		CreatedAt:   timestamppb.New(v.CreatedAt),
+		UpdatedAt:   timestamppb.New(v.UpdatedAt),
+	}
+}
+
 func convertCarrierToProto(c *domain.Carrier) *pb.Carrier {
 	if c == nil {
 		return nil
@@ -121,15 +202,72 @@ func convertRouteToProto(r *domain.OptimizedRoute) *pb.OptimizedRoute {
 			CarrierName:   o.CarrierName,
 			EstimatedCost: o.EstimatedCost,
 			EstimatedTime: o.EstimatedTime,
+			Region:        o.Region,
+			ChargedWeight: o.ChargedWeight,
+			VehicleId:     o.VehicleID,
+			Sequence:      o.Sequence,
+			Eta:           toTimestamp(o.ETA),
+			GeoPrecision:  string(o.GeoPrecision),
+		}
+	}
+	itineraries := make([]*pb.Itinerary, len(r.Itineraries))
+	for i, it := range r.Itineraries {
+		stops := make([]*pb.ItineraryStop, len(it.Stops))
+		for j, st := range it.Stops {
+			stops[j] = &pb.ItineraryStop{
+				Sequence: st.Sequence,
+				OrderId:  st.OrderID,
+				Lat:      st.Lat,
+				Lon:      st.Lon,
+				Load:     st.Load,
+				Eta:      toTimestamp(st.ETA),
+			}
+			if st.WindowStart != nil {
+				stops[j].WindowStart = timestamppb.New(*st.WindowStart)
+			}
+			if st.WindowEnd != nil {
+				stops[j].WindowEnd = timestamppb.New(*st.WindowEnd)
+			}
+		}
+		itineraries[i] = &pb.Itinerary{
+			VehicleId:   it.VehicleID,
+			PlateNo:     it.PlateNo,
+			CarrierId:   it.CarrierID,
+			CarrierName: it.CarrierName,
+			DepotId:     it.DepotID,
+			DepotName:   it.DepotName,
+			DepartAt:    toTimestamp(it.DepartAt),
+			ReturnAt:    toTimestamp(it.ReturnAt),
+			Distance:    it.Distance,
+			Load:        it.Load,
+			Cost:        it.Cost,
+			Stops:       stops,
 		}
 	}
 	return &pb.OptimizedRoute{
-		Id:          uint64(r.ID),
-		Orders:      orders,
-		OrderCount:  r.OrderCount,
-		TotalCost:   r.TotalCost,
-		AverageCost: r.AverageCost,
-		CreatedAt:   timestamppb.New(r.CreatedAt),
-		UpdatedAt:   timestamppb.New(r.UpdatedAt),
+		Id:                 uint64(r.ID),
+		Orders:             orders,
+		OrderCount:         r.OrderCount,
+		TotalCost:          r.TotalCost,
+		AverageCost:        r.AverageCost,
+		CreatedAt:          timestamppb.New(r.CreatedAt),
+		UpdatedAt:          timestamppb.New(r.UpdatedAt),
+		VehicleCount:       r.VehicleCount,
+		Itineraries:        itineraries,
+		UnassignedOrderIds: r.UnassignedOrders,
+	}
+}
+
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func fromTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
 	}
+	return ts.AsTime().Local()
 }
@@ -1,8 +1,10 @@
 package http
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/logisticsrouting/application"
 	"github.com/wyfcoding/ecommerce/internal/logisticsrouting/domain"
@@ -49,7 +51,9 @@ func (h *Handler) RegisterCarrier(c *gin.Context) {
 // OptimizeRoute 处理优化配送路线的HTTP请求。
 func (h *Handler) OptimizeRoute(c *gin.Context) {
 	var req struct {
-		OrderIDs []uint64 `json:"order_ids" binding:"required"`
+		Orders   []domain.OrderRef `json:"orders"`
+		OrderIDs []uint64          `json:"order_ids"` // 已废弃：无法定位订单分库，请使用 orders
+		DepartAt time.Time         `json:"depart_at"` // 计划出车时间，为空时立即出车
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -57,16 +61,63 @@ func (h *Handler) OptimizeRoute(c *gin.Context) {
 		return
 	}
 
-	route, err := h.app.OptimizeRoute(c.Request.Context(), req.OrderIDs)
+	orders := req.Orders
+	for _, id := range req.OrderIDs {
+		orders = append(orders, domain.OrderRef{OrderID: id})
+	}
+	if len(orders) == 0 {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid request", "orders is required")
+		return
+	}
+
+	route, err := h.app.OptimizeRoute(c.Request.Context(), orders, req.DepartAt)
 	if err != nil {
 		h.logger.ErrorContext(c.Request.Context(), "failed to optimize route", "error", err)
-		response.ErrorWithStatus(c, http.StatusInternalServerError, "Failed to optimize route", err.Error())
+		status := http.StatusInternalServerError
+		if errors.Is(err, domain.ErrNoCarrierAvailable) || errors.Is(err, domain.ErrAddressNotGeocoded) {
+			status = http.StatusUnprocessableEntity
+		}
+		response.ErrorWithStatus(c, status, "Failed to optimize route", err.Error())
 		return
 	}
 
 	response.SuccessWithStatus(c, http.StatusOK, "Route optimized successfully", route)
 }
 
+// RegisterVehicle 处理登记配送车辆的HTTP请求。
+func (h *Handler) RegisterVehicle(c *gin.Context) {
+	var req domain.Vehicle
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+	req.IsActive = true
+
+	if err := h.app.RegisterVehicle(c.Request.Context(), &req); err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "failed to register vehicle", "error", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, domain.ErrInvalidVehicle) {
+			status = http.StatusBadRequest
+		}
+		response.ErrorWithStatus(c, status, "Failed to register vehicle", err.Error())
+		return
+	}
+
+	response.SuccessWithStatus(c, http.StatusCreated, "Vehicle registered successfully", req)
+}
+
+// ListVehicles 处理获取配送车辆列表的HTTP请求。
+func (h *Handler) ListVehicles(c *gin.Context) {
+	vehicles, err := h.app.ListVehicles(c.Request.Context())
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "failed to list vehicles", "error", err)
+		response.ErrorWithStatus(c, http.StatusInternalServerError, "Failed to list vehicles", err.Error())
+		return
+	}
+
+	response.SuccessWithStatus(c, http.StatusOK, "Vehicles listed successfully", vehicles)
+}
+
 // ListCarriers 处理获取配送商列表的HTTP请求。
 func (h *Handler) ListCarriers(c *gin.Context) {
 	carriers, err := h.app.ListCarriers(c.Request.Context())
@@ -85,6 +136,8 @@ func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 	{
 		group.POST("/carriers", h.RegisterCarrier)
 		group.GET("/carriers", h.ListCarriers)
+		group.POST("/vehicles", h.RegisterVehicle)
+		group.GET("/vehicles", h.ListVehicles)
 		group.POST("/optimize", h.OptimizeRoute)
 	}
 }
@@ -29,9 +29,9 @@ func NewOrderService(
 
 // --- Delegate Methods ---
 
-// CreateOrder 创建订单。
-func (s *OrderService) CreateOrder(ctx context.Context, userID uint64, items []*domain.OrderItem, shippingAddr *domain.ShippingAddress, couponCode string) (*domain.Order, error) {
-	return s.Manager.CreateOrder(ctx, userID, items, shippingAddr, couponCode)
+// CreateOrder 创建订单，指定支付方式时同步发起预支付。
+func (s *OrderService) CreateOrder(ctx context.Context, userID uint64, items []*domain.OrderItem, shippingAddr *domain.ShippingAddress, checkout Checkout) (*CreateOrderResult, error) {
+	return s.Manager.CreateOrder(ctx, userID, items, shippingAddr, checkout)
 }
 
 func (s *OrderService) SagaConfirmOrder(ctx context.Context, userID, orderID uint64) error {
@@ -82,13 +82,23 @@ func (s *OrderService) HandleInventoryReservationFailed(ctx context.Context, use
 }
 
 // HandlePaymentProcessed 处理支付成功事件。
-func (s *OrderService) HandlePaymentProcessed(ctx context.Context, userID, orderID uint64) error {
-	return s.Manager.HandlePaymentProcessed(ctx, userID, orderID)
+func (s *OrderService) HandlePaymentProcessed(ctx context.Context, userID, orderID uint64, paymentNo, paymentMethod string, amount int64) error {
+	return s.Manager.HandlePaymentProcessed(ctx, userID, orderID, paymentNo, paymentMethod, amount)
 }
 
 // HandlePaymentFailed 处理支付失败事件。
-func (s *OrderService) HandlePaymentFailed(ctx context.Context, userID, orderID uint64, reason string) error {
-	return s.Manager.HandlePaymentFailed(ctx, userID, orderID, reason)
+func (s *OrderService) HandlePaymentFailed(ctx context.Context, userID, orderID uint64, paymentNo, reason string) error {
+	return s.Manager.HandlePaymentFailed(ctx, userID, orderID, paymentNo, reason)
+}
+
+// HandlePaymentClosed 处理支付单超时关闭事件。
+func (s *OrderService) HandlePaymentClosed(ctx context.Context, userID, orderID uint64, paymentNo, reason string) error {
+	return s.Manager.HandlePaymentClosed(ctx, userID, orderID, paymentNo, reason)
+}
+
+// HandlePaymentRefunded 处理退款完成事件。
+func (s *OrderService) HandlePaymentRefunded(ctx context.Context, userID, orderID uint64, refundNo string, amount int64, fullRefund bool) error {
+	return s.Manager.HandlePaymentRefunded(ctx, userID, orderID, refundNo, amount, fullRefund)
 }
 
 // GetOrder 获取订单详情。
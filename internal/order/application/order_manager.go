@@ -2,6 +2,7 @@ package application
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -9,7 +10,9 @@ import (
 
 	advancedcouponv1 "github.com/wyfcoding/ecommerce/goapi/advancedcoupon/v1"
 	inventoryv1 "github.com/wyfcoding/ecommerce/goapi/inventory/v1"
+	orderv1 "github.com/wyfcoding/ecommerce/goapi/order/v1"
 	paymentv1 "github.com/wyfcoding/ecommerce/goapi/payment/v1"
+	schedulerv1 "github.com/wyfcoding/ecommerce/goapi/scheduler/v1"
 	warehousev1 "github.com/wyfcoding/ecommerce/goapi/warehouse/v1"
 	"github.com/wyfcoding/ecommerce/internal/order/domain"
 
@@ -23,6 +26,57 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	// paymentTimeout 订单待支付超时时间。
+	paymentTimeout = 15 * time.Minute
+	// topicPaymentTimeout 支付超时事件 Topic，由库存服务消费以释放锁定库存。
+	topicPaymentTimeout = "order.payment.timeout"
+	// reservationGrace 库存预占有效期相对支付超时的宽限，保证订单超时先于预占过期处理。
+	reservationGrace = 5 * time.Minute
+	// topicDelaySchedule / topicDelayCancel 调度服务持久化延迟队列的登记与取消 Topic。
+	topicDelaySchedule = "scheduler.delay.schedule"
+	topicDelayCancel   = "scheduler.delay.cancel"
+	// topicRefundRequired 订单已取消或关闭后支付成功，由支付服务消费并原路退款。
+	topicRefundRequired = "order.refund_required"
+)
+
+// paymentTimeoutTaskKey 生成支付超时延迟任务的业务唯一键。
+func paymentTimeoutTaskKey(orderNo string) string {
+	return topicPaymentTimeout + ":" + orderNo
+}
+
+// timeoutTaskKey 生成订单超时调度任务键。订单表按用户分片，因此键中需同时携带用户 ID。
+func timeoutTaskKey(userID, orderID uint64) string {
+	return fmt.Sprintf("%d:%d", userID, orderID)
+}
+
+var (
+	// ErrCouponServiceUnavailable 未配置优惠券服务地址时无法在 Saga 中核销优惠券。
+	ErrCouponServiceUnavailable = errors.New("coupon service address is not configured")
+	// ErrPricingUnavailable 未配置计价网关时无法在服务端计算订单价格。
+	ErrPricingUnavailable = errors.New("pricing gateway is not configured")
+	// ErrOrderNotFound 订单不存在。
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrPaymentConflict 支付结果与订单不符 (如支付金额不一致)，重试无法解决，需人工核实退款或补单。
+	ErrPaymentConflict = errors.New("payment result conflicts with order")
+)
+
+// Checkout 下单时由客户端提交的支付与设备信息。
+type Checkout struct {
+	CouponCode    string // 优惠券码，为空表示不使用优惠券
+	PaymentMethod string // 支付方式 (WECHAT, ALIPAY 等)，为空时不发起预支付，由用户稍后支付
+	ClientIP      string // 下单端 IP，用于风控与支付渠道下单
+	DeviceID      string // 下单设备标识，用于风控
+}
+
+// CreateOrderResult 下单结果。
+// PaymentURL 为空表示未发起预支付或预支付失败，订单仍然有效，用户可在订单列表重新发起支付。
+type CreateOrderResult struct {
+	Order         *domain.Order
+	PaymentURL    string
+	TransactionNo string
+}
+
 // OrderManager 负责处理 Order 相关的写操作和业务逻辑。
 type OrderManager struct {
 	repo              domain.OrderRepository
@@ -33,9 +87,13 @@ type OrderManager struct {
 	dtmServer         string
 	warehouseGrpcAddr string
 	orderSvcURL       string // 本服务地址，供 DTM 回调
+	couponSvcAddr     string // 优惠券服务 gRPC 地址，供 Saga 核销优惠券
 	riskEvaluator     risk.Evaluator
 	inventoryCli      inventoryv1.InventoryServiceClient
 	paymentCli        paymentv1.PaymentServiceClient
+	timeoutScheduler  domain.TimeoutScheduler
+	pricing           domain.PricingGateway
+	pricer            *domain.PriceCalculator
 
 	// 指标统计
 	orderCreatedCounter *prometheus.CounterVec
@@ -66,6 +124,7 @@ func NewOrderManager(
 		dtmServer:           dtmServer,
 		warehouseGrpcAddr:   warehouseGrpcAddr,
 		riskEvaluator:       riskEvaluator,
+		pricer:              domain.NewPriceCalculator(),
 		orderCreatedCounter: orderCreatedCounter,
 	}
 }
@@ -79,20 +138,41 @@ func (s *OrderManager) SetSvcURL(url string) {
 	s.orderSvcURL = url
 }
 
+// SetCouponSvcAddr 设置优惠券服务地址 (来自服务发现配置)。
+func (s *OrderManager) SetCouponSvcAddr(addr string) {
+	s.couponSvcAddr = addr
+}
+
+// SetTimeoutScheduler 注入订单超时调度器，用于到期自动关闭未支付订单。
+func (s *OrderManager) SetTimeoutScheduler(scheduler domain.TimeoutScheduler) {
+	s.timeoutScheduler = scheduler
+}
+
+// SetPricingGateway 注入计价网关，下单时据此从商品、营销、会员与优惠券服务重新获取价格与优惠。
+func (s *OrderManager) SetPricingGateway(gateway domain.PricingGateway) {
+	s.pricing = gateway
+}
+
 // CreateOrder 创建订单。
-func (s *OrderManager) CreateOrder(ctx context.Context, userID uint64, items []*domain.OrderItem, shippingAddr *domain.ShippingAddress, couponCode string) (*domain.Order, error) {
-	// --- 架构增强：内联风控拦截 (Inline Risk Control) ---
-	var totalAmount int64
-	for _, it := range items {
-		totalAmount += it.Price * int64(it.Quantity)
+// 订单价格由服务端重新计算，客户端提交的单价与商品信息一律以商品服务为准。
+// checkout 携带客户端提交的优惠券、支付方式与设备信息；指定支付方式时同步发起预支付并在结果中返回支付地址。
+func (s *OrderManager) CreateOrder(ctx context.Context, userID uint64, items []*domain.OrderItem, shippingAddr *domain.ShippingAddress, checkout Checkout) (*CreateOrderResult, error) {
+	if checkout.CouponCode != "" && s.couponSvcAddr == "" {
+		return nil, ErrCouponServiceUnavailable
+	}
+
+	breakdown, err := s.priceOrder(ctx, userID, items, shippingAddr, checkout.CouponCode)
+	if err != nil {
+		return nil, err
 	}
 
+	// --- 架构增强：内联风控拦截 (Inline Risk Control) ---
 	riskAssessment, err := s.riskEvaluator.Assess(ctx, "order.create", map[string]any{
 		"user_id":      userID,
-		"amount":       totalAmount,
+		"amount":       breakdown.PayAmount,
 		"item_count":   len(items),
-		"client_ip":    ctx.Value("client_ip"),
-		"device_id":    ctx.Value("device_id"),
+		"client_ip":    checkout.ClientIP,
+		"device_id":    checkout.DeviceID,
 		"is_real_name": true,
 	})
 
@@ -114,20 +194,16 @@ func (s *OrderManager) CreateOrder(ctx context.Context, userID uint64, items []*
 	orderNo := fmt.Sprintf("%s%d", time.Now().Format("20060102"), orderID)
 
 	order := domain.NewOrder(orderNo, userID, items, shippingAddr)
+	order.ApplyPricing(breakdown)
 	order.Status = domain.Allocating // 切换到“分配中”状态，表示正在执行分布式事务
+	order.PaymentMethod = checkout.PaymentMethod
 
-	// --- 架构增强：预同步锁定库存 (Internal Service Interaction) ---
-	for _, item := range items {
-		_, err := s.inventoryCli.LockStock(ctx, &inventoryv1.LockStockRequest{
-			SkuId:    item.SkuID,
-			Quantity: int32(item.Quantity),
-			Reason:   "Order " + orderNo,
-		})
-		if err != nil {
-			s.logger.ErrorContext(ctx, "synchronous stock locking failed", "sku_id", item.SkuID, "error", err)
-			return nil, fmt.Errorf("insufficient stock for SKU %d", item.SkuID)
-		}
+	// --- 架构增强：按履约计划预同步锁定库存 (Internal Service Interaction) ---
+	allocations, err := s.allocateAndLockStock(ctx, orderNo, items, shippingAddr)
+	if err != nil {
+		return nil, err
 	}
+	order.Allocations = allocations
 
 	// 1. 本地事务：保存订单并写入 Outbox
 	err = s.repo.Transaction(ctx, userID, func(tx any) error {
@@ -140,29 +216,52 @@ func (s *OrderManager) CreateOrder(ctx context.Context, userID uint64, items []*
 			"order_id": order.ID,
 			"order_no": order.OrderNo,
 			"user_id":  order.UserID,
-			"amount":   order.TotalAmount,
+			"amount":   order.ActualAmount,
 			"status":   order.Status.String(),
 		}
 
 		gormTx := tx.(*gorm.DB)
-		
+
 		// 1.1 发布订单创建事件
 		if err := s.outboxMgr.PublishInTx(ctx, gormTx, "order.created", orderNo, event); err != nil {
 			return err
 		}
 
-		// 1.2 发布超时自动取消/释放库存任务 (延迟任务占位)
-		// 在实际生产中，Outbox Processor 或 Kafka 延迟队列会处理此消息。
+		// 1.2 登记支付超时延迟消息 (自动取消/释放库存)
+		// 消息先经 Outbox 投递到调度服务的持久化延迟队列，到期后才会投递到 order.payment.timeout，
+		// 避免库存服务在下单后立即消费导致锁定库存被提前释放。
+		expiresAt := time.Now().Add(paymentTimeout)
 		timeoutEvent := map[string]any{
-			"order_id":   order.ID,
-			"order_no":   order.OrderNo,
-			"user_id":    order.UserID,
-			"items":      items, // 包含 SKU 和数量用于释放
-			"expires_at": time.Now().Add(15 * time.Minute).Unix(),
+			"order_id":    order.ID,
+			"order_no":    order.OrderNo,
+			"user_id":     order.UserID,
+			"items":       items,
+			"allocations": allocations, // 包含 SKU、仓库和数量用于逐仓释放
+			"expires_at":  expiresAt.Unix(),
+		}
+		payload, err := json.Marshal(timeoutEvent)
+		if err != nil {
+			return err
+		}
+		if err := s.outboxMgr.PublishInTx(ctx, gormTx, topicDelaySchedule, orderNo, &schedulerv1.ScheduleDelayEventRequest{
+			TaskKey:   paymentTimeoutTaskKey(orderNo),
+			Source:    "order",
+			Topic:     topicPaymentTimeout,
+			Key:       orderNo,
+			Payload:   string(payload),
+			DeliverAt: expiresAt.Unix(),
+		}); err != nil {
+			return err
 		}
-		return s.outboxMgr.PublishInTx(ctx, gormTx, "order.payment.timeout", orderNo, timeoutEvent)
+
+		// 1.3 登记订单自身的支付超时关闭任务 (持久化调度，重启与多副本安全)，与订单同事务落库
+		if s.timeoutScheduler == nil {
+			return nil
+		}
+		return s.timeoutScheduler.ScheduleTimeoutInTx(ctx, gormTx, timeoutTaskKey(userID, uint64(order.ID)), paymentTimeout)
 	})
 	if err != nil {
+		s.releaseReservations(ctx, orderNo, allocations, "Rollback order "+orderNo)
 		return nil, err
 	}
 
@@ -179,35 +278,35 @@ func (s *OrderManager) CreateOrder(ctx context.Context, userID uint64, items []*
 	saga.Add(
 		orderGrpcPrefix+"/SagaConfirmOrder",
 		orderGrpcPrefix+"/SagaCancelOrder",
-		&advancedcouponv1.UseCouponRequest{ // 临时借用结构体，实际应为对应接口类型
-			UserId:  userID,
+		&orderv1.SagaOrderRequest{
 			OrderId: uint64(order.ID),
+			UserId:  userID,
+			Reason:  "Saga rollback for order " + orderNo,
 		},
 	)
 
-	// 2.2 为每个商品添加库存扣减步骤
-	for _, item := range items {
+	// 2.2 按履约计划为每个 (SKU, 仓库) 添加库存扣减步骤
+	for _, alloc := range allocations {
 		saga.Add(
 			warehouseGrpcPrefix+"/DeductStock",
 			warehouseGrpcPrefix+"/RevertStock",
 			&warehousev1.DeductStockRequest{
 				OrderId:     uint64(order.ID),
-				SkuId:       item.SkuID,
-				Quantity:    item.Quantity,
-				WarehouseId: 1, // 实际场景应由库存分配算法决定
+				SkuId:       alloc.SkuID,
+				Quantity:    alloc.Quantity,
+				WarehouseId: alloc.WarehouseID,
 			},
 		)
 	}
 
 	// 2.3 如果使用了优惠券，添加核销步骤
-	if couponCode != "" {
-		couponSvcAddr := "advancedcoupon:50051"
+	if checkout.CouponCode != "" {
 		saga.Add(
-			couponSvcAddr+"/api.advancedcoupon.v1.AdvancedCouponService/UseCoupon",
+			s.couponSvcAddr+"/api.advancedcoupon.v1.AdvancedCouponService/UseCoupon",
 			"",
 			&advancedcouponv1.UseCouponRequest{
 				UserId:  userID,
-				Code:    couponCode,
+				Code:    checkout.CouponCode,
 				OrderId: uint64(order.ID),
 			},
 		)
@@ -221,14 +320,22 @@ func (s *OrderManager) CreateOrder(ctx context.Context, userID uint64, items []*
 
 	s.logger.InfoContext(ctx, "order created and saga submitted", "order_no", orderNo)
 
+	result := &CreateOrderResult{Order: order}
+
 	// --- 架构增强：同步发起支付 (Internal Service Interaction) ---
-	if s.paymentCli != nil {
+	if s.paymentCli != nil && checkout.PaymentMethod != "" {
+		var shares []*paymentv1.MerchantShare
+		for _, share := range order.MerchantShares() {
+			shares = append(shares, &paymentv1.MerchantShare{MerchantId: share.MerchantID, Amount: share.Amount})
+		}
 		payResp, err := s.paymentCli.InitiatePayment(ctx, &paymentv1.InitiatePaymentRequest{
-			OrderId:       uint64(order.ID),
-			UserId:        userID,
-			PaymentMethod: "WECHAT", // 默认微信，实际应由前端传参
-			Amount:        order.TotalAmount,
-			ClientIp:      "127.0.0.1",
+			OrderId:        uint64(order.ID),
+			UserId:         userID,
+			PaymentMethod:  checkout.PaymentMethod,
+			Amount:         order.ActualAmount,
+			ClientIp:       checkout.ClientIP,
+			IdempotencyKey: orderNo, // 客户端重试下单时复用同一笔预支付
+			MerchantShares: shares,  // 扣款时按商户分账
 		})
 		if err != nil {
 			s.logger.ErrorContext(ctx, "failed to initiate payment", "order_no", orderNo, "error", err)
@@ -236,23 +343,158 @@ func (s *OrderManager) CreateOrder(ctx context.Context, userID uint64, items []*
 			// 用户可以在订单列表重新发起支付。
 		} else {
 			s.logger.InfoContext(ctx, "payment initiated successfully", "order_no", orderNo, "payment_url", payResp.PaymentUrl)
-			// 在实际场景中，可能会将 payment_url 返回给前端
+			result.PaymentURL = payResp.PaymentUrl
+			result.TransactionNo = payResp.TransactionNo
 		}
 	}
 
-	return order, nil
+	return result, nil
+}
+
+// priceOrder 获取 SKU 售价、进行中的活动、会员等级与优惠券，计算订单价格并写入各订单行的分摊明细。
+// 营销与会员服务不可用时按无对应优惠计价；指定的优惠券不存在时返回 ErrCouponInvalid。
+func (s *OrderManager) priceOrder(ctx context.Context, userID uint64, items []*domain.OrderItem, addr *domain.ShippingAddress, couponCode string) (*domain.PriceBreakdown, error) {
+	if s.pricing == nil {
+		return nil, ErrPricingUnavailable
+	}
+
+	skuIDs := make([]uint64, 0, len(items))
+	for _, item := range items {
+		skuIDs = append(skuIDs, item.SkuID)
+	}
+	prices, err := s.pricing.GetSkuPrices(ctx, skuIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sku prices: %w", err)
+	}
+	promotions, err := s.pricing.ListPromotions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list promotions: %w", err)
+	}
+	tier, err := s.pricing.GetMemberTier(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member tier: %w", err)
+	}
+
+	var coupon *domain.Coupon
+	if couponCode != "" {
+		coupon, err = s.pricing.GetCoupon(ctx, couponCode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get coupon: %w", err)
+		}
+		if coupon == nil {
+			return nil, fmt.Errorf("%w: code=%s", domain.ErrCouponInvalid, couponCode)
+		}
+	}
+
+	breakdown, err := s.pricer.Price(items, prices, addr, promotions, tier, coupon)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "order priced",
+		"user_id", userID,
+		"goods_amount", breakdown.GoodsAmount,
+		"discount_amount", breakdown.DiscountAmount(),
+		"shipping_fee", breakdown.ShippingFee,
+		"pay_amount", breakdown.PayAmount,
+		"promotion_id", breakdown.PromotionID,
+		"coupon_code", breakdown.CouponCode)
+	return breakdown, nil
+}
+
+// allocateAndLockStock 调用库存服务的履约优化器为订单行选择发货仓库，并逐仓锁定库存。
+// 任一仓库锁定失败时释放已锁定的部分并返回错误。
+func (s *OrderManager) allocateAndLockStock(ctx context.Context, orderNo string, items []*domain.OrderItem, addr *domain.ShippingAddress) ([]*domain.OrderAllocation, error) {
+	req := &inventoryv1.AllocateOrderStockRequest{
+		Items: make([]*inventoryv1.OrderItemShort, 0, len(items)),
+	}
+	if addr != nil {
+		req.UserLat = addr.Lat
+		req.UserLon = addr.Lon
+	}
+	for _, item := range items {
+		req.Items = append(req.Items, &inventoryv1.OrderItemShort{
+			SkuId:    item.SkuID,
+			Quantity: item.Quantity,
+		})
+	}
+
+	resp, err := s.inventoryCli.AllocateOrderStock(ctx, req)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "stock allocation failed", "order_no", orderNo, "error", err)
+		return nil, fmt.Errorf("failed to allocate stock: %w", err)
+	}
+
+	allocations := make([]*domain.OrderAllocation, 0, len(items))
+	for _, wa := range resp.Allocations {
+		for _, it := range wa.Items {
+			allocations = append(allocations, &domain.OrderAllocation{
+				SkuID:       it.SkuId,
+				WarehouseID: wa.WarehouseId,
+				Quantity:    it.Quantity,
+			})
+		}
+	}
+
+	for i, alloc := range allocations {
+		resp, err := s.inventoryCli.LockStock(ctx, &inventoryv1.LockStockRequest{
+			SkuId:       alloc.SkuID,
+			WarehouseId: alloc.WarehouseID,
+			Quantity:    alloc.Quantity,
+			Reason:      "Order " + orderNo,
+			OrderNo:     orderNo,
+			TtlSeconds:  int32((paymentTimeout + reservationGrace) / time.Second),
+		})
+		if err != nil {
+			s.logger.ErrorContext(ctx, "synchronous stock locking failed", "sku_id", alloc.SkuID, "warehouse_id", alloc.WarehouseID, "error", err)
+			s.releaseReservations(ctx, orderNo, allocations[:i], "Rollback order "+orderNo)
+			return nil, fmt.Errorf("insufficient stock for SKU %d", alloc.SkuID)
+		}
+		alloc.ReservationID = resp.Reservation.GetReservationId()
+	}
+	return allocations, nil
+}
+
+// releaseReservations 释放订单的库存预占。释放是幂等的，失败仅记录日志，由预占过期清理兜底。
+func (s *OrderManager) releaseReservations(ctx context.Context, orderNo string, allocations []*domain.OrderAllocation, reason string) {
+	for _, alloc := range allocations {
+		if alloc.ReservationID == "" {
+			continue
+		}
+		if _, err := s.inventoryCli.ReleaseReservation(ctx, &inventoryv1.ReleaseReservationRequest{
+			ReservationId: alloc.ReservationID,
+			Reason:        reason,
+		}); err != nil {
+			s.logger.ErrorContext(ctx, "failed to release reservation", "order_no", orderNo, "reservation_id", alloc.ReservationID, "error", err)
+		}
+	}
 }
 
 // PayOrder 支付订单。
 func (s *OrderManager) PayOrder(ctx context.Context, userID, id uint64, paymentMethod string) error {
+	return s.markPaid(ctx, userID, id, paymentMethod, "User", nil)
+}
+
+// markPaid 在事务内将订单推进为已支付并发布 order.paid 事件。
+// 事件携带订单的库存预占ID，由库存服务消费后确认预占；确认与状态变更同事务登记，不会因进程崩溃或调用失败而丢失。
+// precheck 在状态变更前于同一事务内执行，返回 false 表示无需推进 (如重复投递的支付事件)。
+func (s *OrderManager) markPaid(ctx context.Context, userID, id uint64, paymentMethod, operator string, precheck func(txRepo domain.OrderRepository, tx any, order *domain.Order) (bool, error)) error {
 	return s.repo.Transaction(ctx, userID, func(tx any) error {
 		txRepo := s.repo.WithTx(tx)
 		order, err := txRepo.FindByID(ctx, userID, uint(id))
-		if err != nil || order == nil {
-			return errors.New("order not found")
+		if err != nil {
+			return err
+		}
+		if order == nil {
+			return ErrOrderNotFound
+		}
+		if precheck != nil {
+			proceed, err := precheck(txRepo, tx, order)
+			if err != nil || !proceed {
+				return err
+			}
 		}
 
-		if err := order.Pay(ctx, paymentMethod, "User"); err != nil {
+		if err := order.Pay(ctx, paymentMethod, operator); err != nil {
 			return err
 		}
 
@@ -260,16 +502,30 @@ func (s *OrderManager) PayOrder(ctx context.Context, userID, id uint64, paymentM
 			return err
 		}
 
-		// 发布支付成功事件
+		// 发布支付成功事件，库存服务据 reservation_ids 确认预占
+		reservationIDs := make([]string, 0, len(order.Allocations))
+		for _, alloc := range order.Allocations {
+			if alloc.ReservationID != "" {
+				reservationIDs = append(reservationIDs, alloc.ReservationID)
+			}
+		}
 		event := map[string]any{
-			"order_id": order.ID,
-			"order_no": order.OrderNo,
-			"user_id":  userID,
-			"amount":   order.ActualAmount,
-			"paid_at":  time.Now().Unix(),
+			"order_id":        order.ID,
+			"order_no":        order.OrderNo,
+			"user_id":         userID,
+			"amount":          order.ActualAmount,
+			"paid_at":         time.Now().Unix(),
+			"reservation_ids": reservationIDs,
 		}
 		gormTx := tx.(*gorm.DB)
-		return s.outboxMgr.PublishInTx(ctx, gormTx, "order.paid", order.OrderNo, event)
+		if err := s.outboxMgr.PublishInTx(ctx, gormTx, "order.paid", order.OrderNo, event); err != nil {
+			return err
+		}
+
+		// 已支付订单无需再触发超时释放，取消对应的延迟消息
+		return s.outboxMgr.PublishInTx(ctx, gormTx, topicDelayCancel, order.OrderNo, &schedulerv1.CancelDelayEventRequest{
+			TaskKey: paymentTimeoutTaskKey(order.OrderNo),
+		})
 	})
 }
 
@@ -349,11 +605,11 @@ func (s *OrderManager) CompleteOrder(ctx context.Context, userID, id uint64, ope
 
 		// 发布完成事件，用于赠送积分、分账、大数据分析等
 		event := map[string]any{
-			"order_id":      order.ID,
-			"order_no":      order.OrderNo,
-			"user_id":       order.UserID,
-			"amount":        order.ActualAmount,
-			"completed_at":  time.Now().Unix(),
+			"order_id":     order.ID,
+			"order_no":     order.OrderNo,
+			"user_id":      order.UserID,
+			"amount":       order.ActualAmount,
+			"completed_at": time.Now().Unix(),
 		}
 		gormTx := tx.(*gorm.DB)
 		return s.outboxMgr.PublishInTx(ctx, gormTx, "order.completed", order.OrderNo, event)
@@ -373,7 +629,7 @@ func (s *OrderManager) SagaConfirmOrder(ctx context.Context, userID, orderID uin
 		}
 		order.Status = domain.PendingPayment
 		order.AddLog("System", "Saga Confirmed", domain.Allocating.String(), domain.PendingPayment.String(), "Inventory and logic verified")
-		
+
 		if err := txRepo.Save(ctx, order); err != nil {
 			return err
 		}
@@ -392,7 +648,8 @@ func (s *OrderManager) SagaConfirmOrder(ctx context.Context, userID, orderID uin
 
 // SagaCancelOrder Saga 补偿: 取消订单 (Allocating -> Cancelled)
 func (s *OrderManager) SagaCancelOrder(ctx context.Context, userID, orderID uint64, reason string) error {
-	return s.repo.Transaction(ctx, userID, func(tx any) error {
+	var cancelled *domain.Order
+	err := s.repo.Transaction(ctx, userID, func(tx any) error {
 		txRepo := s.repo.WithTx(tx)
 		order, err := txRepo.FindByID(ctx, userID, uint(orderID))
 		if err != nil || order == nil {
@@ -401,7 +658,7 @@ func (s *OrderManager) SagaCancelOrder(ctx context.Context, userID, orderID uint
 		if order.Status == domain.Cancelled {
 			return nil // 幂等
 		}
-		
+
 		if err := order.Cancel(ctx, "System", reason); err != nil {
 			return err
 		}
@@ -409,6 +666,7 @@ func (s *OrderManager) SagaCancelOrder(ctx context.Context, userID, orderID uint
 		if err := txRepo.Save(ctx, order); err != nil {
 			return err
 		}
+		cancelled = order
 
 		// 发布取消事件
 		event := map[string]any{
@@ -419,11 +677,21 @@ func (s *OrderManager) SagaCancelOrder(ctx context.Context, userID, orderID uint
 		gormTx := tx.(*gorm.DB)
 		return s.outboxMgr.PublishInTx(ctx, gormTx, "order.cancelled", order.OrderNo, event)
 	})
+	if err != nil {
+		return err
+	}
+
+	// Saga 补偿可能被重复调用，预占释放本身是幂等的
+	if cancelled != nil {
+		s.releaseReservations(ctx, cancelled.OrderNo, cancelled.Allocations, "Saga compensation: "+reason)
+	}
+	return nil
 }
 
 // CancelOrder 取消订单。
 func (s *OrderManager) CancelOrder(ctx context.Context, userID, id uint64, operator, reason string) error {
-	return s.repo.Transaction(ctx, userID, func(tx any) error {
+	var cancelled *domain.Order
+	err := s.repo.Transaction(ctx, userID, func(tx any) error {
 		txRepo := s.repo.WithTx(tx)
 		order, err := txRepo.FindByID(ctx, userID, uint(id))
 		if err != nil || order == nil {
@@ -437,6 +705,7 @@ func (s *OrderManager) CancelOrder(ctx context.Context, userID, id uint64, opera
 		if err := txRepo.Save(ctx, order); err != nil {
 			return err
 		}
+		cancelled = order
 
 		// 发布手动取消事件
 		event := map[string]any{
@@ -448,8 +717,13 @@ func (s *OrderManager) CancelOrder(ctx context.Context, userID, id uint64, opera
 		gormTx := tx.(*gorm.DB)
 		return s.outboxMgr.PublishInTx(ctx, gormTx, "order.cancelled", order.OrderNo, event)
 	})
-}
+	if err != nil {
+		return err
+	}
 
+	s.releaseReservations(ctx, cancelled.OrderNo, cancelled.Allocations, "Order cancelled: "+reason)
+	return nil
+}
 
 // HandleInventoryReserved 处理库存已预留事件。
 func (s *OrderManager) HandleInventoryReserved(ctx context.Context, userID, orderID uint64) error {
@@ -480,34 +754,213 @@ func (s *OrderManager) HandleInventoryReservationFailed(ctx context.Context, use
 	return order.Cancel(ctx, "System", fmt.Sprintf("Inventory reservation failed: %s", reason))
 }
 
-// HandlePaymentProcessed 处理支付已完成事件。
-func (s *OrderManager) HandlePaymentProcessed(ctx context.Context, userID, orderID uint64) error {
-	order, err := s.repo.FindByID(ctx, userID, uint(orderID))
-	if err != nil {
-		return err
-	}
-	if order == nil {
-		return errors.New("order not found")
+// HandlePaymentProcessed 处理支付成功事件：待支付订单推进为已支付并确认库存预占。
+// 同一支付单的重复事件经 Inbox 跳过；订单已取消或关闭时在同一事务内发布 order.refund_required 由支付服务退款；
+// 金额不符返回 ErrPaymentConflict。
+func (s *OrderManager) HandlePaymentProcessed(ctx context.Context, userID, orderID uint64, paymentNo, paymentMethod string, amount int64) error {
+	if paymentMethod == "" {
+		paymentMethod = "Online"
 	}
-
-	return order.Pay(ctx, "Online", "System")
+	return s.markPaid(ctx, userID, orderID, paymentMethod, "System", func(txRepo domain.OrderRepository, tx any, order *domain.Order) (bool, error) {
+		// payment.paid 与 payment.captured 同属支付成功，按支付单号共用一条登记
+		fresh, err := txRepo.MarkConsumed(ctx, userID, "payment.paid", paymentNo)
+		if err != nil || !fresh {
+			return false, err
+		}
+
+		switch order.Status {
+		case domain.PendingPayment:
+		case domain.Allocating:
+			// Saga 尚未确认订单，返回错误由消费端重试
+			return false, fmt.Errorf("order %s is still allocating", order.OrderNo)
+		case domain.Cancelled, domain.Closed:
+			// 订单取消后用户仍完成了支付：不再恢复订单，退款与 Inbox 登记同事务提交
+			s.logger.WarnContext(ctx, "payment succeeded for a closed order, requesting refund", "order_no", order.OrderNo, "payment_no", paymentNo, "status", order.Status.String())
+			return false, s.outboxMgr.PublishInTx(ctx, tx.(*gorm.DB), topicRefundRequired, order.OrderNo, map[string]any{
+				"payment_no": paymentNo,
+				"order_id":   order.ID,
+				"order_no":   order.OrderNo,
+				"user_id":    userID,
+				"amount":     amount,
+				"reason":     fmt.Sprintf("order %s is %s", order.OrderNo, order.Status),
+			})
+		default:
+			s.logger.WarnContext(ctx, "order already paid, skipping payment event", "order_no", order.OrderNo, "payment_no", paymentNo, "status", order.Status.String())
+			return false, nil
+		}
+
+		if amount != order.ActualAmount {
+			return false, fmt.Errorf("%w: payment %s amount %d does not match order %s amount %d", ErrPaymentConflict, paymentNo, amount, order.OrderNo, order.ActualAmount)
+		}
+		return true, nil
+	})
 }
 
 // HandlePaymentFailed 处理支付失败事件。
-func (s *OrderManager) HandlePaymentFailed(ctx context.Context, userID, orderID uint64, reason string) error {
-	order, err := s.repo.FindByID(ctx, userID, uint(orderID))
+func (s *OrderManager) HandlePaymentFailed(ctx context.Context, userID, orderID uint64, paymentNo, reason string) error {
+	return s.closeUnpaidOrder(ctx, userID, orderID, "payment.failed", paymentNo, fmt.Sprintf("Payment failed: %s", reason))
+}
+
+// HandlePaymentClosed 处理支付单超时关闭事件。
+func (s *OrderManager) HandlePaymentClosed(ctx context.Context, userID, orderID uint64, paymentNo, reason string) error {
+	return s.closeUnpaidOrder(ctx, userID, orderID, "payment.closed", paymentNo, fmt.Sprintf("Payment closed: %s", reason))
+}
+
+// closeUnpaidOrder 取消仍处于待支付状态的订单并释放库存预占。
+// 订单已由其他支付单完成支付或已取消时不做处理。
+func (s *OrderManager) closeUnpaidOrder(ctx context.Context, userID, orderID uint64, topic, paymentNo, reason string) error {
+	var cancelled *domain.Order
+	err := s.repo.Transaction(ctx, userID, func(tx any) error {
+		txRepo := s.repo.WithTx(tx)
+		order, err := txRepo.FindByID(ctx, userID, uint(orderID))
+		if err != nil {
+			return err
+		}
+		if order == nil {
+			return ErrOrderNotFound
+		}
+		fresh, err := txRepo.MarkConsumed(ctx, userID, topic, paymentNo)
+		if err != nil || !fresh {
+			return err
+		}
+		if order.Status != domain.PendingPayment {
+			return nil
+		}
+
+		if err := order.Cancel(ctx, "System", reason); err != nil {
+			return err
+		}
+		if err := txRepo.Save(ctx, order); err != nil {
+			return err
+		}
+		cancelled = order
+
+		event := map[string]any{
+			"order_id": order.ID,
+			"order_no": order.OrderNo,
+			"user_id":  userID,
+			"reason":   reason,
+		}
+		gormTx := tx.(*gorm.DB)
+		return s.outboxMgr.PublishInTx(ctx, gormTx, "order.cancelled", order.OrderNo, event)
+	})
 	if err != nil {
 		return err
 	}
-	if order == nil {
-		return errors.New("order not found")
+
+	if cancelled != nil {
+		s.releaseReservations(ctx, cancelled.OrderNo, cancelled.Allocations, reason)
 	}
+	return nil
+}
 
-	if err := order.Cancel(ctx, "System", fmt.Sprintf("Payment failed: %s", reason)); err != nil {
-		return err
+// HandlePaymentRefunded 处理退款完成事件。全额退款将订单推进为已退款，部分退款仅记录订单日志。
+func (s *OrderManager) HandlePaymentRefunded(ctx context.Context, userID, orderID uint64, refundNo string, amount int64, fullRefund bool) error {
+	return s.repo.Transaction(ctx, userID, func(tx any) error {
+		txRepo := s.repo.WithTx(tx)
+		order, err := txRepo.FindByID(ctx, userID, uint(orderID))
+		if err != nil {
+			return err
+		}
+		if order == nil {
+			return ErrOrderNotFound
+		}
+		fresh, err := txRepo.MarkConsumed(ctx, userID, "payment.refunded", refundNo)
+		if err != nil || !fresh {
+			return err
+		}
+
+		remark := fmt.Sprintf("Refund %s completed, amount: %d", refundNo, amount)
+		refunded := false
+		switch {
+		case !fullRefund || order.Status == domain.Refunded:
+			order.AddLog("System", "Refund Completed", order.Status.String(), order.Status.String(), remark)
+		case order.Status == domain.Paid, order.Status == domain.Shipped, order.Status == domain.Delivered:
+			if err := order.RequestRefund(ctx, "System", remark); err != nil {
+				return err
+			}
+			fallthrough
+		case order.Status == domain.RefundRequested:
+			if err := order.ApproveRefund(ctx, "System"); err != nil {
+				return err
+			}
+			refunded = true
+		default:
+			// 已完成或已取消的订单没有退款流转，保留状态并记录退款
+			order.AddLog("System", "Refund Completed", order.Status.String(), order.Status.String(), remark)
+		}
+		if err := txRepo.Save(ctx, order); err != nil {
+			return err
+		}
+		if !refunded {
+			return nil
+		}
+
+		event := map[string]any{
+			"order_id":    order.ID,
+			"order_no":    order.OrderNo,
+			"user_id":     userID,
+			"refund_no":   refundNo,
+			"amount":      amount,
+			"refunded_at": time.Now().Unix(),
+		}
+		gormTx := tx.(*gorm.DB)
+		return s.outboxMgr.PublishInTx(ctx, gormTx, "order.refunded", order.OrderNo, event)
+	})
+}
+
+// HandlePaymentTimeout 处理订单支付超时：仍处于待支付状态的订单自动取消。
+// taskKey 格式见 timeoutTaskKey，由 TimeoutScheduler 到期回调；返回错误时调度器保留任务并重试。
+func (s *OrderManager) HandlePaymentTimeout(taskKey string) error {
+	ctx := context.Background()
+
+	var userID, orderID uint64
+	if _, err := fmt.Sscanf(taskKey, "%d:%d", &userID, &orderID); err != nil {
+		// 任务键无法解析时重试无意义
+		s.logger.ErrorContext(ctx, "invalid order timeout task key", "task_key", taskKey, "error", err)
+		return nil
 	}
 
-	s.logger.InfoContext(ctx, "should publish ReleaseInventory event", "order_id", orderID, "reason", reason)
+	var cancelled *domain.Order
+	err := s.repo.Transaction(ctx, userID, func(tx any) error {
+		txRepo := s.repo.WithTx(tx)
+		order, err := txRepo.FindByID(ctx, userID, uint(orderID))
+		if err != nil {
+			return err
+		}
+		if order == nil {
+			s.logger.WarnContext(ctx, "timeout order not found, skipping", "order_id", orderID, "user_id", userID)
+			return nil
+		}
+		if order.Status != domain.PendingPayment {
+			return nil // 已支付或已取消，无需处理
+		}
+
+		if err := order.Cancel(ctx, "System", "Payment timeout"); err != nil {
+			return err
+		}
+		if err := txRepo.Save(ctx, order); err != nil {
+			return err
+		}
+		cancelled = order
+
+		event := map[string]any{
+			"order_id": order.ID,
+			"order_no": order.OrderNo,
+			"user_id":  userID,
+			"reason":   "payment timeout",
+		}
+		gormTx := tx.(*gorm.DB)
+		return s.outboxMgr.PublishInTx(ctx, gormTx, "order.cancelled", order.OrderNo, event)
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx, "failed to close timeout order", "order_id", orderID, "user_id", userID, "error", err)
+		return err
+	}
+	if cancelled != nil {
+		s.releaseReservations(ctx, cancelled.OrderNo, cancelled.Allocations, "Payment timeout")
+	}
+	s.logger.InfoContext(ctx, "payment timeout handled", "order_id", orderID, "user_id", userID)
 	return nil
 }
 
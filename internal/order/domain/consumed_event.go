@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+// ConsumedEvent 已处理的外部事件 (Inbox)。与订单状态变更在同一事务内写入，重复投递的事件据此跳过。
+type ConsumedEvent struct {
+	ID        uint      `gorm:"primarykey"`
+	Topic     string    `gorm:"type:varchar(128);uniqueIndex:uk_topic_event;not null;comment:事件Topic"`
+	EventKey  string    `gorm:"type:varchar(128);uniqueIndex:uk_topic_event;not null;comment:事件业务唯一键"`
+	CreatedAt time.Time `gorm:"comment:处理时间"`
+}
@@ -45,24 +45,28 @@ func (s OrderStatus) String() string {
 // Order 实体是订单模块的聚合根。
 type Order struct {
 	gorm.Model
-	OrderNo         string           `gorm:"type:varchar(64);uniqueIndex;not null;comment:订单编号" json:"order_no"`
-	UserID          uint64           `gorm:"index;not null;comment:用户ID" json:"user_id"`
-	Status          OrderStatus      `gorm:"type:tinyint;not null;default:1;comment:订单状态" json:"status"`
-	TotalAmount     int64            `gorm:"not null;comment:订单总金额(分)" json:"total_amount"`
-	ActualAmount    int64            `gorm:"not null;comment:实际支付金额(分)" json:"actual_amount"`
-	ShippingFee     int64            `gorm:"not null;default:0;comment:运费(分)" json:"shipping_fee"`
-	DiscountAmount  int64            `gorm:"not null;default:0;comment:优惠金额(分)" json:"discount_amount"`
-	PaymentMethod   string           `gorm:"type:varchar(32);comment:支付方式" json:"payment_method"`
-	Remark          string           `gorm:"type:varchar(255);comment:订单备注" json:"remark"`
-	ShippingAddress *ShippingAddress `gorm:"embedded;embeddedPrefix:shipping_" json:"shipping_address"`
-	Items           []*OrderItem     `gorm:"foreignKey:OrderID" json:"items"`
-	Logs            []*OrderLog      `gorm:"foreignKey:OrderID" json:"logs"`
-	PaidAt          *time.Time       `gorm:"comment:支付时间" json:"paid_at"`
-	ShippedAt       *time.Time       `gorm:"comment:发货时间" json:"shipped_at"`
-	DeliveredAt     *time.Time       `gorm:"comment:送达时间" json:"delivered_at"`
-	CompletedAt     *time.Time       `gorm:"comment:完成时间" json:"completed_at"`
-	CancelledAt     *time.Time       `gorm:"comment:取消时间" json:"cancelled_at"`
-	fsm             *fsm.Machine     `gorm:"-" json:"-"`
+	OrderNo         string             `gorm:"type:varchar(64);uniqueIndex;not null;comment:订单编号" json:"order_no"`
+	UserID          uint64             `gorm:"index;not null;comment:用户ID" json:"user_id"`
+	Status          OrderStatus        `gorm:"type:tinyint;not null;default:1;comment:订单状态" json:"status"`
+	TotalAmount     int64              `gorm:"not null;comment:订单总金额(分)" json:"total_amount"`
+	ActualAmount    int64              `gorm:"not null;comment:实际支付金额(分)" json:"actual_amount"`
+	ShippingFee     int64              `gorm:"not null;default:0;comment:运费(分)" json:"shipping_fee"`
+	DiscountAmount  int64              `gorm:"not null;default:0;comment:优惠金额(分)" json:"discount_amount"`
+	TaxAmount       int64              `gorm:"not null;default:0;comment:价内税额(分)" json:"tax_amount"`
+	CouponCode      string             `gorm:"type:varchar(64);comment:使用的优惠券码" json:"coupon_code"`
+	PromotionID     uint64             `gorm:"not null;default:0;comment:参与的营销活动ID" json:"promotion_id"`
+	PaymentMethod   string             `gorm:"type:varchar(32);comment:支付方式" json:"payment_method"`
+	Remark          string             `gorm:"type:varchar(255);comment:订单备注" json:"remark"`
+	ShippingAddress *ShippingAddress   `gorm:"embedded;embeddedPrefix:shipping_" json:"shipping_address"`
+	Items           []*OrderItem       `gorm:"foreignKey:OrderID" json:"items"`
+	Allocations     []*OrderAllocation `gorm:"foreignKey:OrderID" json:"allocations"`
+	Logs            []*OrderLog        `gorm:"foreignKey:OrderID" json:"logs"`
+	PaidAt          *time.Time         `gorm:"comment:支付时间" json:"paid_at"`
+	ShippedAt       *time.Time         `gorm:"comment:发货时间" json:"shipped_at"`
+	DeliveredAt     *time.Time         `gorm:"comment:送达时间" json:"delivered_at"`
+	CompletedAt     *time.Time         `gorm:"comment:完成时间" json:"completed_at"`
+	CancelledAt     *time.Time         `gorm:"comment:取消时间" json:"cancelled_at"`
+	fsm             *fsm.Machine       `gorm:"-" json:"-"`
 }
 
 // OrderItem 实体代表订单中的一个商品项。
@@ -71,12 +75,37 @@ type OrderItem struct {
 	OrderID         uint64 `gorm:"index;not null;comment:订单ID" json:"order_id"`
 	ProductID       uint64 `gorm:"not null;comment:商品ID" json:"product_id"`
 	SkuID           uint64 `gorm:"not null;comment:SKU ID" json:"sku_id"`
+	MerchantID      uint64 `gorm:"not null;default:0;comment:商户ID" json:"merchant_id"`
 	ProductName     string `gorm:"type:varchar(255);not null;comment:商品名称" json:"product_name"`
 	SkuName         string `gorm:"type:varchar(255);not null;comment:SKU名称" json:"sku_name"`
 	ProductImageURL string `gorm:"type:varchar(255);comment:商品图片URL" json:"product_image_url"`
 	Price           int64  `gorm:"not null;comment:单价(分)" json:"price"`
 	Quantity        int32  `gorm:"not null;comment:数量" json:"quantity"`
 	TotalPrice      int64  `gorm:"not null;comment:总价(分)" json:"total_price"`
+	// 计价明细：订单级优惠与运费按比例分摊到本行，退款与结算据此按行折算。
+	PromotionDiscount int64 `gorm:"not null;default:0;comment:分摊活动优惠(分)" json:"promotion_discount"`
+	TierDiscount      int64 `gorm:"not null;default:0;comment:分摊会员优惠(分)" json:"tier_discount"`
+	CouponDiscount    int64 `gorm:"not null;default:0;comment:分摊优惠券优惠(分)" json:"coupon_discount"`
+	ShippingFee       int64 `gorm:"not null;default:0;comment:分摊运费(分)" json:"shipping_fee"`
+	TaxAmount         int64 `gorm:"not null;default:0;comment:价内税额(分)" json:"tax_amount"`
+	PayAmount         int64 `gorm:"not null;default:0;comment:实付金额(分)" json:"pay_amount"`
+}
+
+// DiscountAmount 本行分摊到的商品优惠合计。
+func (i *OrderItem) DiscountAmount() int64 {
+	return i.PromotionDiscount + i.TierDiscount + i.CouponDiscount
+}
+
+// OrderAllocation 实体记录了订单行由哪个仓库发货。
+// 下单时由库存服务的履约优化器决定，锁库存、Saga 扣减与超时释放都按该记录逐仓执行。
+// ReservationID 为库存服务返回的预占ID，支付后据此确认、取消后据此释放。
+type OrderAllocation struct {
+	gorm.Model
+	OrderID       uint64 `gorm:"index;not null;comment:订单ID" json:"order_id"`
+	SkuID         uint64 `gorm:"not null;comment:SKU ID" json:"sku_id"`
+	WarehouseID   uint64 `gorm:"not null;comment:发货仓库ID" json:"warehouse_id"`
+	Quantity      int32  `gorm:"not null;comment:数量" json:"quantity"`
+	ReservationID string `gorm:"type:varchar(64);comment:库存预占ID" json:"reservation_id"`
 }
 
 // ShippingAddress 值对象定义了订单的收货地址信息。
@@ -103,9 +132,14 @@ type OrderLog struct {
 	Remark    string `gorm:"type:varchar(255);comment:备注" json:"remark"`
 }
 
+// TimeoutCallback 超时回调，返回错误时任务保留并按退避重试。
+type TimeoutCallback func(orderID string) error
+
 // TimeoutScheduler 定义了超时调度的接口，用于处理订单超时取消等逻辑。
 type TimeoutScheduler interface {
-	ScheduleTimeout(orderID string, timeout time.Duration, callback func(orderID string)) error
+	ScheduleTimeout(orderID string, timeout time.Duration, callback TimeoutCallback) error
+	// ScheduleTimeoutInTx 在业务事务内登记超时任务，与业务数据一同提交或回滚，到期时使用默认回调。
+	ScheduleTimeoutInTx(ctx context.Context, tx *gorm.DB, orderID string, timeout time.Duration) error
 	Start()
 	Stop()
 }
@@ -136,6 +170,17 @@ func NewOrder(orderNo string, userID uint64, items []*OrderItem, shippingAddr *S
 	return order
 }
 
+// ApplyPricing 写入服务端计价结果。订单行的计价明细已由 PriceCalculator 写入。
+func (o *Order) ApplyPricing(b *PriceBreakdown) {
+	o.TotalAmount = b.GoodsAmount
+	o.DiscountAmount = b.DiscountAmount()
+	o.ShippingFee = b.ShippingFee
+	o.TaxAmount = b.TaxAmount
+	o.ActualAmount = b.PayAmount
+	o.CouponCode = b.CouponCode
+	o.PromotionID = b.PromotionID
+}
+
 func (o *Order) initFSM() {
 	m := fsm.NewMachine(fsm.State(o.Status.String()))
 
@@ -288,6 +333,38 @@ func (o *Order) AddLog(operator, action, oldStatus, newStatus, remark string) {
 	o.Logs = append(o.Logs, log)
 }
 
+// MerchantShare 订单中单个商户的实付金额，支付扣款时据此分账。
+type MerchantShare struct {
+	MerchantID uint64
+	Amount     int64
+}
+
+// MerchantShares 按订单行的商户汇总实付金额，顺序与商户在订单中首次出现的顺序一致。
+// 存在平台自营商品或各行实付合计与订单实付金额不一致 (如人工改价) 时返回 nil，整单不分账。
+func (o *Order) MerchantShares() []MerchantShare {
+	var (
+		shares []MerchantShare
+		sum    int64
+	)
+	index := make(map[uint64]int)
+	for _, item := range o.Items {
+		if item.MerchantID == 0 {
+			return nil
+		}
+		sum += item.PayAmount
+		if i, ok := index[item.MerchantID]; ok {
+			shares[i].Amount += item.PayAmount
+			continue
+		}
+		index[item.MerchantID] = len(shares)
+		shares = append(shares, MerchantShare{MerchantID: item.MerchantID, Amount: item.PayAmount})
+	}
+	if sum != o.ActualAmount {
+		return nil
+	}
+	return shares
+}
+
 // GetTotalQuantity 获取订单中所有商品的总数量。
 func (o *Order) GetTotalQuantity() int32 {
 	var total int32
@@ -21,4 +21,7 @@ type OrderRepository interface {
 	Delete(ctx context.Context, userID uint64, id uint) error
 	List(ctx context.Context, offset, limit int) ([]*Order, int64, error)
 	ListByUserID(ctx context.Context, userID uint, offset, limit int) ([]*Order, int64, error)
+	// MarkConsumed 在用户所在分片登记已处理的事件，返回 false 表示该事件此前已处理。
+	// 需在事务仓储 (WithTx) 上调用，使登记与订单变更同时提交或回滚。
+	MarkConsumed(ctx context.Context, userID uint64, topic, eventKey string) (bool, error)
 }
@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestOrderMerchantShares(t *testing.T) {
+	tests := []struct {
+		name   string
+		items  []*OrderItem
+		actual int64
+		want   []MerchantShare
+	}{
+		{
+			name:   "multiple merchants",
+			items:  []*OrderItem{{MerchantID: 7, PayAmount: 3000}, {MerchantID: 9, PayAmount: 1500}, {MerchantID: 7, PayAmount: 500}},
+			actual: 5000,
+			want:   []MerchantShare{{MerchantID: 7, Amount: 3500}, {MerchantID: 9, Amount: 1500}},
+		},
+		{
+			name:   "single merchant",
+			items:  []*OrderItem{{MerchantID: 7, PayAmount: 5000}},
+			actual: 5000,
+			want:   []MerchantShare{{MerchantID: 7, Amount: 5000}},
+		},
+		{
+			name:   "self-operated item",
+			items:  []*OrderItem{{MerchantID: 7, PayAmount: 3000}, {PayAmount: 2000}},
+			actual: 5000,
+		},
+		{
+			name:   "amount adjusted after pricing",
+			items:  []*OrderItem{{MerchantID: 7, PayAmount: 3000}, {MerchantID: 9, PayAmount: 2000}},
+			actual: 4500,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Order{Items: tt.items, ActualAmount: tt.actual}
+			if got := o.MerchantShares(); !slices.Equal(got, tt.want) {
+				t.Fatalf("MerchantShares() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// 定义订单计价相关的业务错误。
+var (
+	ErrSkuUnavailable  = errors.New("sku is unavailable for sale")    // SKU 不存在或无有效售价。
+	ErrCouponInvalid   = errors.New("coupon is invalid or expired")   // 优惠券不存在、已失效或不满足使用门槛。
+	ErrPricingMismatch = errors.New("sku does not belong to product") // 客户端提交的商品与 SKU 不匹配。
+)
+
+// 优惠券类型，取值与优惠券服务保持一致。
+const (
+	CouponTypePercentage   = "percentage"    // 折扣券：DiscountValue 为减免百分比 (10 表示减 10%)
+	CouponTypeFixed        = "fixed"         // 满减券：DiscountValue 为减免金额 (分)
+	CouponTypeFreeShipping = "free_shipping" // 免运费券
+)
+
+// 营销活动类型，取值与营销服务保持一致。
+const (
+	PromotionTypeDiscount   = "DISCOUNT"    // 折扣活动
+	PromotionTypeFullReduce = "FULL_REDUCE" // 满减活动
+)
+
+// SkuPrice 商品服务返回的 SKU 实时售价快照。
+type SkuPrice struct {
+	SkuID       uint64
+	ProductID   uint64
+	ProductName string
+	SkuName     string
+	ImageURL    string
+	MerchantID  uint64 // 所属商户，0 表示平台自营
+	Price       int64  // 单价 (分)
+	Weight      int32  // 单件重量 (克)
+}
+
+// Promotion 订单可参与的营销活动。多个活动不叠加，取优惠最大的一个。
+type Promotion struct {
+	CampaignID  uint64
+	Name        string
+	Type        string
+	Threshold   int64   // 满减门槛 / 折扣起用金额 (分)
+	Reduction   int64   // 满减金额 (分)，仅 FULL_REDUCE
+	Rate        float64 // 折后比例 (0.9 表示九折)，仅 DISCOUNT
+	MaxDiscount int64   // 折扣封顶金额 (分)，0 表示不封顶
+}
+
+// Discount 计算活动对 amount 的减免金额。
+func (p *Promotion) Discount(amount int64) int64 {
+	if amount <= 0 || amount < p.Threshold {
+		return 0
+	}
+	var d int64
+	switch p.Type {
+	case PromotionTypeFullReduce:
+		d = p.Reduction
+	case PromotionTypeDiscount:
+		if p.Rate <= 0 || p.Rate >= 1 {
+			return 0
+		}
+		d = int64(math.Round(float64(amount) * (1 - p.Rate)))
+		if p.MaxDiscount > 0 && d > p.MaxDiscount {
+			d = p.MaxDiscount
+		}
+	}
+	return min(max(d, 0), amount)
+}
+
+// MemberTier 用户会员等级及其专属折扣。
+type MemberTier struct {
+	Level        int32
+	Name         string
+	DiscountRate float64 // 折后比例 (0.95 表示 95 折)，0 或 1 表示无折扣
+}
+
+// Discount 计算会员折扣对 amount 的减免金额。
+func (t *MemberTier) Discount(amount int64) int64 {
+	if t == nil || amount <= 0 || t.DiscountRate <= 0 || t.DiscountRate >= 1 {
+		return 0
+	}
+	return min(int64(math.Round(float64(amount)*(1-t.DiscountRate))), amount)
+}
+
+// Coupon 下单时使用的优惠券快照。
+type Coupon struct {
+	ID          uint64
+	Code        string
+	Type        string
+	Value       int64
+	MinPurchase int64 // 使用门槛 (分)，与活动、会员优惠后的商品金额比较
+	MaxDiscount int64 // 最大减免 (分)，0 表示不封顶
+	Valid       bool
+}
+
+// Discount 计算优惠券对商品金额和运费的减免金额。
+func (c *Coupon) Discount(goodsAmount, shippingFee int64) (goods, shipping int64, err error) {
+	if !c.Valid {
+		return 0, 0, fmt.Errorf("%w: %s", ErrCouponInvalid, c.Code)
+	}
+	if goodsAmount < c.MinPurchase {
+		return 0, 0, fmt.Errorf("%w: %s requires a minimum purchase of %d, got %d", ErrCouponInvalid, c.Code, c.MinPurchase, goodsAmount)
+	}
+	switch c.Type {
+	case CouponTypeFixed:
+		goods = c.Value
+	case CouponTypePercentage:
+		goods = int64(math.Round(float64(goodsAmount) * float64(c.Value) / 100))
+	case CouponTypeFreeShipping:
+		return 0, shippingFee, nil
+	default:
+		return 0, 0, fmt.Errorf("%w: unsupported coupon type %q", ErrCouponInvalid, c.Type)
+	}
+	if c.MaxDiscount > 0 && goods > c.MaxDiscount {
+		goods = c.MaxDiscount
+	}
+	return min(max(goods, 0), goodsAmount), 0, nil
+}
+
+// ShippingRule 首重续重运费规则。
+type ShippingRule struct {
+	FirstWeight      int32 // 首重 (克)
+	FirstFee         int64 // 首重运费 (分)
+	AdditionalWeight int32 // 续重单位 (克)
+	AdditionalFee    int64 // 每续重单位运费 (分)
+}
+
+// Fee 计算指定重量的运费。
+func (r ShippingRule) Fee(weight int32) int64 {
+	fee := r.FirstFee
+	if weight > r.FirstWeight && r.AdditionalWeight > 0 {
+		units := (weight - r.FirstWeight + r.AdditionalWeight - 1) / r.AdditionalWeight
+		fee += int64(units) * r.AdditionalFee
+	}
+	return fee
+}
+
+// ShippingTemplate 按收货省份与包裹重量计算运费。
+type ShippingTemplate struct {
+	Default       ShippingRule
+	Provinces     map[string]ShippingRule // 按省份覆盖的规则 (如偏远地区)
+	FreeThreshold int64                   // 优惠后商品金额达到该值免运费 (分)，0 表示不包邮
+}
+
+// DefaultShippingTemplate 默认运费模板：首重 1kg 10 元、续重每 kg 5 元，满 99 元包邮；
+// 新疆、西藏等偏远地区首重 20 元、续重每 kg 10 元，不参与包邮。
+func DefaultShippingTemplate() *ShippingTemplate {
+	remote := ShippingRule{FirstWeight: 1000, FirstFee: 2000, AdditionalWeight: 1000, AdditionalFee: 1000}
+	return &ShippingTemplate{
+		Default:       ShippingRule{FirstWeight: 1000, FirstFee: 1000, AdditionalWeight: 1000, AdditionalFee: 500},
+		FreeThreshold: 9900,
+		Provinces: map[string]ShippingRule{
+			"新疆": remote, "新疆维吾尔自治区": remote,
+			"西藏": remote, "西藏自治区": remote,
+			"青海": remote, "青海省": remote,
+		},
+	}
+}
+
+// Fee 计算运费。偏远地区规则不参与包邮。
+func (t *ShippingTemplate) Fee(addr *ShippingAddress, weight int32, goodsAmount int64) int64 {
+	if addr != nil {
+		if rule, ok := t.Provinces[addr.Province]; ok {
+			return rule.Fee(weight)
+		}
+	}
+	if t.FreeThreshold > 0 && goodsAmount >= t.FreeThreshold {
+		return 0
+	}
+	return t.Default.Fee(weight)
+}
+
+// PricingGateway 计价所需外部数据的防腐层，由基础设施层对接商品、营销、会员与优惠券服务。
+type PricingGateway interface {
+	// GetSkuPrices 获取 SKU 实时售价，不存在或已下架的 SKU 不出现在结果中。
+	GetSkuPrices(ctx context.Context, skuIDs []uint64) (map[uint64]*SkuPrice, error)
+	// ListPromotions 获取当前进行中的营销活动。
+	ListPromotions(ctx context.Context) ([]*Promotion, error)
+	// GetMemberTier 获取用户会员等级，无等级时返回 nil。
+	GetMemberTier(ctx context.Context, userID uint64) (*MemberTier, error)
+	// GetCoupon 按券码获取优惠券，不存在时返回 nil。
+	GetCoupon(ctx context.Context, code string) (*Coupon, error)
+}
+
+// PriceBreakdown 订单计价结果。订单级的优惠、运费与税额已按比例分摊到每个订单行。
+type PriceBreakdown struct {
+	GoodsAmount       int64 // 商品原价合计
+	PromotionDiscount int64 // 活动优惠
+	TierDiscount      int64 // 会员优惠
+	CouponDiscount    int64 // 优惠券商品优惠
+	ShippingFee       int64 // 运费 (已扣除免运费券)
+	ShippingDiscount  int64 // 免运费券减免的运费
+	TaxAmount         int64 // 价内税额
+	PayAmount         int64 // 应付金额 = 商品原价 - 各项优惠 + 运费
+	PromotionID       uint64
+	PromotionName     string
+	TierName          string
+	CouponCode        string
+}
+
+// DiscountAmount 商品优惠合计 (不含运费减免)。
+func (b *PriceBreakdown) DiscountAmount() int64 {
+	return b.PromotionDiscount + b.TierDiscount + b.CouponDiscount
+}
+
+// PriceCalculator 订单计价器。
+// 计价顺序：活动优惠 → 会员折扣 → 优惠券 → 运费 → 价内税；订单级金额以最大余数法分摊到订单行，保证各行之和与订单合计一致。
+type PriceCalculator struct {
+	Shipping *ShippingTemplate
+	TaxRate  float64 // 价内增值税率 (0.13 表示 13%)
+}
+
+// NewPriceCalculator 创建使用默认运费模板与 13% 税率的计价器。
+func NewPriceCalculator() *PriceCalculator {
+	return &PriceCalculator{Shipping: DefaultShippingTemplate(), TaxRate: 0.13}
+}
+
+// Price 以服务端售价重新计价订单行，并将计价明细写入每个订单行。
+// 订单行中客户端提交的单价、名称会被商品服务的数据覆盖。
+func (c *PriceCalculator) Price(items []*OrderItem, prices map[uint64]*SkuPrice, addr *ShippingAddress, promotions []*Promotion, tier *MemberTier, coupon *Coupon) (*PriceBreakdown, error) {
+	if len(items) == 0 {
+		return nil, errors.New("order has no items")
+	}
+
+	b := &PriceBreakdown{}
+	subtotals := make([]int64, len(items))
+	weights := make([]int64, len(items))
+	var totalWeight int64
+	for i, item := range items {
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("invalid quantity %d for sku %d", item.Quantity, item.SkuID)
+		}
+		p, ok := prices[item.SkuID]
+		if !ok || p.Price <= 0 {
+			return nil, fmt.Errorf("%w: sku=%d", ErrSkuUnavailable, item.SkuID)
+		}
+		if item.ProductID != 0 && item.ProductID != p.ProductID {
+			return nil, fmt.Errorf("%w: sku=%d product=%d", ErrPricingMismatch, item.SkuID, item.ProductID)
+		}
+		item.ProductID = p.ProductID
+		item.MerchantID = p.MerchantID
+		item.Price = p.Price
+		if p.ProductName != "" {
+			item.ProductName = p.ProductName
+		}
+		if p.SkuName != "" {
+			item.SkuName = p.SkuName
+		}
+		if p.ImageURL != "" {
+			item.ProductImageURL = p.ImageURL
+		}
+		item.TotalPrice = p.Price * int64(item.Quantity)
+
+		subtotals[i] = item.TotalPrice
+		weights[i] = int64(p.Weight) * int64(item.Quantity)
+		b.GoodsAmount += item.TotalPrice
+		totalWeight += weights[i]
+	}
+
+	// 1. 活动优惠：取减免最大的活动
+	amount := b.GoodsAmount
+	for _, p := range promotions {
+		if d := p.Discount(amount); d > b.PromotionDiscount {
+			b.PromotionDiscount = d
+			b.PromotionID = p.CampaignID
+			b.PromotionName = p.Name
+		}
+	}
+	amount -= b.PromotionDiscount
+
+	// 2. 会员折扣：作用于活动后金额
+	if tier != nil {
+		b.TierDiscount = tier.Discount(amount)
+		b.TierName = tier.Name
+		amount -= b.TierDiscount
+	}
+
+	// 3. 运费：按优惠后商品金额判断包邮
+	shippingFee := c.Shipping.Fee(addr, int32(min(totalWeight, math.MaxInt32)), amount)
+
+	// 4. 优惠券：作用于活动与会员优惠后的金额，免运费券减免运费
+	if coupon != nil {
+		goodsOff, shippingOff, err := coupon.Discount(amount, shippingFee)
+		if err != nil {
+			return nil, err
+		}
+		b.CouponDiscount = goodsOff
+		b.ShippingDiscount = shippingOff
+		b.CouponCode = coupon.Code
+		amount -= goodsOff
+	}
+	b.ShippingFee = shippingFee - b.ShippingDiscount
+
+	// 5. 分摊：优惠按商品金额、运费按重量 (无重量时按金额) 分摊到订单行
+	promoShares := Prorate(b.PromotionDiscount, subtotals)
+	tierShares := Prorate(b.TierDiscount, subtotals)
+	couponShares := Prorate(b.CouponDiscount, subtotals)
+	shippingBasis := weights
+	if totalWeight == 0 {
+		shippingBasis = subtotals
+	}
+	shippingShares := Prorate(b.ShippingFee, shippingBasis)
+
+	for i, item := range items {
+		item.PromotionDiscount = promoShares[i]
+		item.TierDiscount = tierShares[i]
+		item.CouponDiscount = couponShares[i]
+		item.ShippingFee = shippingShares[i]
+		item.PayAmount = item.TotalPrice - item.DiscountAmount() + item.ShippingFee
+		item.TaxAmount = c.includedTax(item.PayAmount)
+		b.TaxAmount += item.TaxAmount
+	}
+	b.PayAmount = amount + b.ShippingFee
+	return b, nil
+}
+
+// includedTax 计算价内税额：含税金额 × 税率 / (1 + 税率)。
+func (c *PriceCalculator) includedTax(amount int64) int64 {
+	if c.TaxRate <= 0 || amount <= 0 {
+		return 0
+	}
+	return int64(math.Round(float64(amount) * c.TaxRate / (1 + c.TaxRate)))
+}
+
+// Prorate 按 basis 比例把 total 分摊为整数份额 (最大余数法)，份额之和恰好等于 total。
+// total 与 basis 均为非负的最小货币单位金额，全程整数运算；basis 全为 0 时平均分摊。
+func Prorate(total int64, basis []int64) []int64 {
+	shares := make([]int64, len(basis))
+	if total == 0 || len(basis) == 0 {
+		return shares
+	}
+	var sum int64
+	for _, w := range basis {
+		sum += w
+	}
+	if sum <= 0 {
+		basis = make([]int64, len(shares))
+		for i := range basis {
+			basis[i] = 1
+		}
+		sum = int64(len(basis))
+	}
+
+	// 份额与余数均为整数：份额 = total*w/sum 向下取整，余数 = total*w%sum，余数同分母可直接比较
+	type remainder struct {
+		idx int
+		rem int64
+	}
+	rems := make([]remainder, len(basis))
+	var allocated int64
+	for i, w := range basis {
+		shares[i] = total * w / sum
+		allocated += shares[i]
+		rems[i] = remainder{idx: i, rem: total * w % sum}
+	}
+	// 余数相同时靠前的订单行优先
+	sort.SliceStable(rems, func(i, j int) bool { return rems[i].rem > rems[j].rem })
+	for i := int64(0); i < total-allocated; i++ {
+		shares[rems[i%int64(len(rems))].idx]++
+	}
+	return shares
+}
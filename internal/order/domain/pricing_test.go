@@ -0,0 +1,184 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestProrate(t *testing.T) {
+	tests := []struct {
+		name  string
+		total int64
+		basis []int64
+		want  []int64
+	}{
+		{name: "exact proportions", total: 300, basis: []int64{100, 200}, want: []int64{100, 200}},
+		{name: "largest remainder takes the extra cent", total: 1000, basis: []int64{5000, 6000}, want: []int64{455, 545}},
+		{name: "equal remainders favour earlier lines", total: 100, basis: []int64{1, 1, 1}, want: []int64{34, 33, 33}},
+		{name: "zero basis splits evenly", total: 10, basis: []int64{0, 0, 0}, want: []int64{4, 3, 3}},
+		{name: "zero weight line gets nothing", total: 99, basis: []int64{0, 3, 0}, want: []int64{0, 99, 0}},
+		{name: "zero total", total: 0, basis: []int64{1, 2}, want: []int64{0, 0}},
+		{name: "single line takes all", total: 12345, basis: []int64{7}, want: []int64{12345}},
+		{name: "no lines", total: 100, basis: nil, want: []int64{}},
+		{name: "large amounts stay exact", total: 99_999_999, basis: []int64{1_000_000_000, 2_000_000_000, 3_000_000_001}, want: []int64{16666666, 33333333, 50000000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Prorate(tt.total, tt.basis)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Prorate(%d, %v) = %v, want %v", tt.total, tt.basis, got, tt.want)
+			}
+			var sum int64
+			for _, s := range got {
+				sum += s
+			}
+			if len(got) > 0 && sum != tt.total {
+				t.Fatalf("shares sum to %d, want %d", sum, tt.total)
+			}
+		})
+	}
+}
+
+func TestPriceCalculatorPrice(t *testing.T) {
+	prices := map[uint64]*SkuPrice{
+		1: {SkuID: 1, ProductID: 10, ProductName: "A", Price: 5000, Weight: 500},
+		2: {SkuID: 2, ProductID: 20, ProductName: "B", Price: 3000, Weight: 250},
+	}
+	items := func() []*OrderItem {
+		return []*OrderItem{{SkuID: 1, Quantity: 1, Price: 1}, {SkuID: 2, ProductID: 20, Quantity: 2}}
+	}
+	shanghai := &ShippingAddress{Province: "上海市"}
+	xinjiang := &ShippingAddress{Province: "新疆维吾尔自治区"}
+
+	type line struct {
+		promo, tier, coupon, shipping, pay, tax int64
+	}
+	tests := []struct {
+		name       string
+		addr       *ShippingAddress
+		promotions []*Promotion
+		tier       *MemberTier
+		coupon     *Coupon
+		want       PriceBreakdown
+		wantLines  []line
+	}{
+		{
+			name: "free shipping over threshold without discounts",
+			addr: shanghai,
+			want: PriceBreakdown{GoodsAmount: 11000, TaxAmount: 1265, PayAmount: 11000},
+			wantLines: []line{
+				{pay: 5000, tax: 575},
+				{pay: 6000, tax: 690},
+			},
+		},
+		{
+			name: "best promotion then tier then coupon, shipping charged below threshold",
+			addr: shanghai,
+			promotions: []*Promotion{
+				{CampaignID: 7, Name: "95折", Type: PromotionTypeDiscount, Rate: 0.95},
+				{CampaignID: 8, Name: "满100减10", Type: PromotionTypeFullReduce, Threshold: 10000, Reduction: 1000},
+			},
+			tier:   &MemberTier{Name: "Gold", DiscountRate: 0.9},
+			coupon: &Coupon{Code: "C500", Type: CouponTypeFixed, Value: 500, MinPurchase: 8000, Valid: true},
+			want: PriceBreakdown{
+				GoodsAmount: 11000, PromotionDiscount: 1000, TierDiscount: 1000, CouponDiscount: 500,
+				ShippingFee: 1000, TaxAmount: 1093, PayAmount: 9500,
+				PromotionID: 8, PromotionName: "满100减10", TierName: "Gold", CouponCode: "C500",
+			},
+			wantLines: []line{
+				{promo: 455, tier: 455, coupon: 227, shipping: 500, pay: 4363, tax: 502},
+				{promo: 545, tier: 545, coupon: 273, shipping: 500, pay: 5137, tax: 591},
+			},
+		},
+		{
+			name:   "free shipping coupon waives remote area fee",
+			addr:   xinjiang,
+			coupon: &Coupon{Code: "FREE", Type: CouponTypeFreeShipping, Valid: true},
+			want: PriceBreakdown{
+				GoodsAmount: 11000, ShippingDiscount: 2000, TaxAmount: 1265, PayAmount: 11000, CouponCode: "FREE",
+			},
+			wantLines: []line{
+				{pay: 5000, tax: 575},
+				{pay: 6000, tax: 690},
+			},
+		},
+		{
+			name:   "percentage coupon is capped",
+			addr:   xinjiang,
+			coupon: &Coupon{Code: "P20", Type: CouponTypePercentage, Value: 20, MaxDiscount: 1500, Valid: true},
+			want: PriceBreakdown{
+				GoodsAmount: 11000, CouponDiscount: 1500, ShippingFee: 2000, TaxAmount: 1323, PayAmount: 11500, CouponCode: "P20",
+			},
+			wantLines: []line{
+				{coupon: 682, shipping: 1000, pay: 5318, tax: 612},
+				{coupon: 818, shipping: 1000, pay: 6182, tax: 711},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := items()
+			got, err := NewPriceCalculator().Price(lines, prices, tt.addr, tt.promotions, tt.tier, tt.coupon)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != tt.want {
+				t.Fatalf("breakdown = %+v\nwant        %+v", *got, tt.want)
+			}
+
+			var pay int64
+			for i, w := range tt.wantLines {
+				item := lines[i]
+				g := line{item.PromotionDiscount, item.TierDiscount, item.CouponDiscount, item.ShippingFee, item.PayAmount, item.TaxAmount}
+				if g != w {
+					t.Errorf("line %d = %+v, want %+v", i, g, w)
+				}
+				pay += item.PayAmount
+			}
+			if pay != got.PayAmount {
+				t.Errorf("lines pay %d, order pays %d", pay, got.PayAmount)
+			}
+		})
+	}
+
+	t.Run("server price overrides client", func(t *testing.T) {
+		lines := items()
+		if _, err := NewPriceCalculator().Price(lines, prices, shanghai, nil, nil, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if lines[0].Price != 5000 || lines[0].ProductID != 10 || lines[0].ProductName != "A" || lines[0].TotalPrice != 5000 {
+			t.Fatalf("line 0 = %+v, want server price snapshot", lines[0])
+		}
+	})
+}
+
+func TestPriceCalculatorPriceErrors(t *testing.T) {
+	prices := map[uint64]*SkuPrice{1: {SkuID: 1, ProductID: 10, Price: 5000}}
+	tests := []struct {
+		name    string
+		items   []*OrderItem
+		coupon  *Coupon
+		wantErr error
+	}{
+		{name: "unknown sku", items: []*OrderItem{{SkuID: 2, Quantity: 1}}, wantErr: ErrSkuUnavailable},
+		{name: "sku of another product", items: []*OrderItem{{SkuID: 1, ProductID: 11, Quantity: 1}}, wantErr: ErrPricingMismatch},
+		{name: "coupon below minimum purchase", items: []*OrderItem{{SkuID: 1, Quantity: 1}}, coupon: &Coupon{Code: "C", Type: CouponTypeFixed, Value: 100, MinPurchase: 6000, Valid: true}, wantErr: ErrCouponInvalid},
+		{name: "expired coupon", items: []*OrderItem{{SkuID: 1, Quantity: 1}}, coupon: &Coupon{Code: "C", Type: CouponTypeFixed, Value: 100}, wantErr: ErrCouponInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPriceCalculator().Price(tt.items, prices, nil, nil, nil, tt.coupon)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewPriceCalculator().Price([]*OrderItem{{SkuID: 1, Quantity: 0}}, prices, nil, nil, nil, nil); err == nil {
+		t.Fatal("expected error for non-positive quantity")
+	}
+	if _, err := NewPriceCalculator().Price(nil, prices, nil, nil, nil, nil); err == nil {
+		t.Fatal("expected error for empty order")
+	}
+}
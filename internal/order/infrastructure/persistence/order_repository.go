@@ -9,6 +9,7 @@ import (
 	"github.com/wyfcoding/pkg/databases/sharding"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type orderRepository struct {
@@ -56,6 +57,14 @@ func (r *orderRepository) Save(ctx context.Context, order *domain.Order) error {
 				return err
 			}
 		}
+		for _, alloc := range order.Allocations {
+			if alloc.ID == 0 {
+				alloc.OrderID = uint64(order.ID)
+			}
+			if err := tx.Save(alloc).Error; err != nil {
+				return err
+			}
+		}
 		for _, log := range order.Logs {
 			if log.ID == 0 {
 				log.OrderID = uint64(order.ID)
@@ -86,7 +95,7 @@ func (r *orderRepository) Transaction(ctx context.Context, userID uint64, fn fun
 func (r *orderRepository) FindByID(ctx context.Context, userID uint64, id uint) (*domain.Order, error) {
 	db := r.sharding.GetDB(userID)
 	var order domain.Order
-	if err := db.WithContext(ctx).Preload("Items").Preload("Logs").First(&order, id).Error; err != nil {
+	if err := db.WithContext(ctx).Preload("Items").Preload("Allocations").Preload("Logs").First(&order, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -99,7 +108,7 @@ func (r *orderRepository) FindByID(ctx context.Context, userID uint64, id uint)
 func (r *orderRepository) FindByOrderNo(ctx context.Context, userID uint64, orderNo string) (*domain.Order, error) {
 	db := r.sharding.GetDB(userID)
 	var order domain.Order
-	if err := db.WithContext(ctx).Preload("Items").Preload("Logs").Where("order_no = ?", orderNo).First(&order).Error; err != nil {
+	if err := db.WithContext(ctx).Preload("Items").Preload("Allocations").Preload("Logs").Where("order_no = ?", orderNo).First(&order).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -178,3 +187,13 @@ func (r *orderRepository) ListByUserID(ctx context.Context, userID uint, offset,
 
 	return list, total, nil
 }
+
+// MarkConsumed 登记已处理的事件，唯一键冲突说明事件重复投递。
+func (r *orderRepository) MarkConsumed(ctx context.Context, userID uint64, topic, eventKey string) (bool, error) {
+	event := &domain.ConsumedEvent{Topic: topic, EventKey: eventKey}
+	result := r.getDB(userID).WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,196 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	advancedcouponv1 "github.com/wyfcoding/ecommerce/goapi/advancedcoupon/v1"
+	marketingv1 "github.com/wyfcoding/ecommerce/goapi/marketing/v1"
+	productv1 "github.com/wyfcoding/ecommerce/goapi/product/v1"
+	usertierv1 "github.com/wyfcoding/ecommerce/goapi/usertier/v1"
+	"github.com/wyfcoding/ecommerce/internal/order/domain"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// campaignStatusOngoing 营销服务中进行中活动的状态值。
+const campaignStatusOngoing = 1
+
+// Gateway 基于下游 gRPC 服务实现 domain.PricingGateway。
+// 商品服务为必需依赖；营销、会员服务不可用时降级为不享受对应优惠，优惠券服务不可用时带券下单失败。
+type Gateway struct {
+	product   productv1.ProductServiceClient
+	marketing marketingv1.MarketingServiceClient
+	userTier  usertierv1.UserTierServiceClient
+	coupon    advancedcouponv1.AdvancedCouponServiceClient
+	logger    *slog.Logger
+}
+
+// NewGateway 创建计价网关，marketing、userTier、coupon 可为 nil。
+func NewGateway(
+	product productv1.ProductServiceClient,
+	marketing marketingv1.MarketingServiceClient,
+	userTier usertierv1.UserTierServiceClient,
+	coupon advancedcouponv1.AdvancedCouponServiceClient,
+	logger *slog.Logger,
+) *Gateway {
+	return &Gateway{
+		product:   product,
+		marketing: marketing,
+		userTier:  userTier,
+		coupon:    coupon,
+		logger:    logger.With("module", "pricing_gateway"),
+	}
+}
+
+// GetSkuPrices 逐个查询 SKU 售价，并补充所属商品名称；未上架商品的 SKU 不返回。
+func (g *Gateway) GetSkuPrices(ctx context.Context, skuIDs []uint64) (map[uint64]*domain.SkuPrice, error) {
+	prices := make(map[uint64]*domain.SkuPrice, len(skuIDs))
+	products := make(map[uint64]*productv1.ProductInfo)
+	for _, skuID := range skuIDs {
+		if _, ok := prices[skuID]; ok {
+			continue
+		}
+		sku, err := g.product.GetSKUByID(ctx, &productv1.GetSKUByIDRequest{Id: skuID})
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get sku %d: %w", skuID, err)
+		}
+
+		product, ok := products[sku.ProductId]
+		if !ok {
+			product, err = g.product.GetProductByID(ctx, &productv1.GetProductByIDRequest{Id: sku.ProductId})
+			if err != nil && status.Code(err) != codes.NotFound {
+				return nil, fmt.Errorf("failed to get product %d: %w", sku.ProductId, err)
+			}
+			products[sku.ProductId] = product
+		}
+		if product == nil || product.Status != productv1.ProductStatus_ACTIVE {
+			continue
+		}
+
+		prices[skuID] = &domain.SkuPrice{
+			SkuID:       skuID,
+			ProductID:   sku.ProductId,
+			ProductName: product.Name,
+			SkuName:     sku.Name,
+			ImageURL:    sku.ImageUrl,
+			MerchantID:  product.MerchantId,
+			Price:       sku.Price,
+			Weight:      sku.Weight,
+		}
+	}
+	return prices, nil
+}
+
+// campaignRules 营销活动规则 (rules_json) 中与订单计价相关的字段。
+type campaignRules struct {
+	Threshold   int64   `json:"threshold"`
+	Reduction   int64   `json:"reduction"`
+	Rate        float64 `json:"rate"`
+	MaxDiscount int64   `json:"max_discount"`
+}
+
+// ListPromotions 获取进行中且在有效期内的满减与折扣活动。
+func (g *Gateway) ListPromotions(ctx context.Context) ([]*domain.Promotion, error) {
+	if g.marketing == nil {
+		return nil, nil
+	}
+	resp, err := g.marketing.ListCampaigns(ctx, &marketingv1.ListCampaignsRequest{
+		Status:   campaignStatusOngoing,
+		Page:     1,
+		PageSize: 100,
+	})
+	if err != nil {
+		g.logger.WarnContext(ctx, "failed to list campaigns, pricing without promotions", "error", err)
+		return nil, nil
+	}
+
+	now := time.Now()
+	promotions := make([]*domain.Promotion, 0, len(resp.Campaigns))
+	for _, c := range resp.Campaigns {
+		if c.CampaignType != domain.PromotionTypeFullReduce && c.CampaignType != domain.PromotionTypeDiscount {
+			continue
+		}
+		if c.StartTime.AsTime().After(now) || c.EndTime.AsTime().Before(now) {
+			continue
+		}
+		var rules campaignRules
+		if err := json.Unmarshal([]byte(c.RulesJson), &rules); err != nil {
+			g.logger.WarnContext(ctx, "skipping campaign with malformed rules", "campaign_id", c.Id, "error", err)
+			continue
+		}
+		promotions = append(promotions, &domain.Promotion{
+			CampaignID:  c.Id,
+			Name:        c.Name,
+			Type:        c.CampaignType,
+			Threshold:   rules.Threshold,
+			Reduction:   rules.Reduction,
+			Rate:        rules.Rate,
+			MaxDiscount: rules.MaxDiscount,
+		})
+	}
+	return promotions, nil
+}
+
+// GetMemberTier 获取用户会员等级。会员服务的折扣率以百分比存储 (90 表示 9 折)，此处换算为比例。
+func (g *Gateway) GetMemberTier(ctx context.Context, userID uint64) (*domain.MemberTier, error) {
+	if g.userTier == nil {
+		return nil, nil
+	}
+	resp, err := g.userTier.GetUserTier(ctx, &usertierv1.GetUserTierRequest{UserId: userID})
+	if err != nil {
+		g.logger.WarnContext(ctx, "failed to get user tier, pricing without member discount", "user_id", userID, "error", err)
+		return nil, nil
+	}
+	if resp.Tier == nil {
+		return nil, nil
+	}
+	rate := resp.Tier.DiscountRate
+	if rate > 1 {
+		rate /= 100
+	}
+	return &domain.MemberTier{
+		Level:        resp.Tier.Level,
+		Name:         resp.Tier.LevelName,
+		DiscountRate: rate,
+	}, nil
+}
+
+// GetCoupon 按券码查询优惠券。
+func (g *Gateway) GetCoupon(ctx context.Context, code string) (*domain.Coupon, error) {
+	if g.coupon == nil {
+		return nil, fmt.Errorf("coupon service is not configured")
+	}
+	resp, err := g.coupon.GetCoupon(ctx, &advancedcouponv1.GetCouponRequest{Code: code})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupon %s: %w", code, err)
+	}
+	c := resp.Coupon
+	if c == nil {
+		return nil, nil
+	}
+	now := time.Now()
+	valid := c.Status == "active" &&
+		now.After(c.ValidFrom.AsTime()) &&
+		now.Before(c.ValidUntil.AsTime()) &&
+		(c.TotalQuantity == 0 || c.UsedQuantity < c.TotalQuantity)
+	return &domain.Coupon{
+		ID:          c.Id,
+		Code:        c.Code,
+		Type:        c.Type,
+		Value:       c.DiscountValue,
+		MinPurchase: c.MinPurchaseAmount,
+		MaxDiscount: c.MaxDiscountAmount,
+		Valid:       valid,
+	}, nil
+}
@@ -0,0 +1,298 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wyfcoding/ecommerce/internal/order/domain"
+	"github.com/wyfcoding/pkg/metrics"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TimeoutTaskStatus 超时任务状态
+type TimeoutTaskStatus int8
+
+const (
+	TimeoutTaskPending TimeoutTaskStatus = 0 // 等待触发
+	TimeoutTaskFiring  TimeoutTaskStatus = 1 // 已被某个副本租约领取，执行中
+	TimeoutTaskDone    TimeoutTaskStatus = 2 // 已执行
+)
+
+// TimeoutTask 持久化的超时任务记录
+// 任务落库后，即使 Pod 重启也能在启动时重新加载；多副本之间通过租约保证同一任务只被一个副本触发。
+type TimeoutTask struct {
+	gorm.Model
+	TaskKey    string            `gorm:"type:varchar(128);uniqueIndex;not null;comment:任务键(订单标识)" json:"task_key"`
+	FireAt     time.Time         `gorm:"index:idx_timeout_status_fire;not null;comment:计划触发时间" json:"fire_at"`
+	Status     TimeoutTaskStatus `gorm:"type:tinyint;index:idx_timeout_status_fire;not null;default:0;comment:状态" json:"status"`
+	Attempts   int               `gorm:"not null;default:0;comment:触发次数" json:"attempts"`
+	LeaseOwner string            `gorm:"type:varchar(128);comment:租约持有者" json:"lease_owner"`
+	LeaseUntil *time.Time        `gorm:"comment:租约到期时间" json:"lease_until"`
+	FiredAt    *time.Time        `gorm:"comment:实际触发时间" json:"fired_at"`
+}
+
+// TableName 指定表名
+func (TimeoutTask) TableName() string {
+	return "order_timeout_tasks"
+}
+
+// PersistentScheduler 基于数据库租约的超时调度器
+// 替代进程内时间轮：任务持久化到 MySQL，后台协程按 tick 扫描到期任务并以 SKIP LOCKED 方式领取。
+// 回调函数只在登记任务的进程内有效，重启或由其他副本领取时统一使用 fallback 回调。
+// 回调返回错误或发生 panic 时任务回到待触发状态并按指数退避重新触发，直到回调成功。
+// 订单按用户分片，任务与订单在同一分片的同一事务内写入，因此调度器依次扫描每个分片的任务表。
+type PersistentScheduler struct {
+	dbs       []*gorm.DB // 各分片连接，dbs[0] 用于非事务登记
+	logger    *slog.Logger
+	owner     string
+	tick      time.Duration
+	lease     time.Duration
+	batchSize int
+	fallback  domain.TimeoutCallback
+	callbacks sync.Map // orderID -> domain.TimeoutCallback
+	stopChan  chan struct{}
+	stopOnce  sync.Once
+
+	// 指标统计
+	fireLag      *prometheus.HistogramVec
+	missedFire   *prometheus.CounterVec
+	firedCounter *prometheus.CounterVec
+}
+
+// NewPersistentScheduler 创建一个新的持久化调度器
+// tick: 扫描间隔 (如 1s)，同时作为判定 "错过触发时间" 的容忍度基准
+// fallback: 进程内找不到回调时使用的默认处理函数 (通常为订单超时取消)
+func NewPersistentScheduler(dbs []*gorm.DB, tick time.Duration, fallback domain.TimeoutCallback, logger *slog.Logger, m *metrics.Metrics) (*PersistentScheduler, error) {
+	if tick <= 0 {
+		return nil, errors.New("tick must be positive")
+	}
+	if len(dbs) == 0 {
+		return nil, errors.New("at least one database is required")
+	}
+
+	hostname, _ := os.Hostname()
+	return &PersistentScheduler{
+		dbs:       dbs,
+		logger:    logger.With("module", "timeout_scheduler"),
+		owner:     fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		tick:      tick,
+		lease:     30 * time.Second,
+		batchSize: 200,
+		fallback:  fallback,
+		stopChan:  make(chan struct{}),
+		fireLag: m.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "order_timeout_fire_lag_seconds",
+			Help:    "超时任务实际触发相对计划时间的滞后",
+			Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60},
+		}, []string{}),
+		missedFire: m.NewCounterVec(prometheus.CounterOpts{
+			Name: "order_timeout_missed_total",
+			Help: "错过计划触发时间的超时任务数",
+		}, []string{}),
+		firedCounter: m.NewCounterVec(prometheus.CounterOpts{
+			Name: "order_timeout_fired_total",
+			Help: "超时任务触发总数",
+		}, []string{"status"}),
+	}, nil
+}
+
+// ScheduleTimeout 调度任务
+// 同一 orderID 重复调度时覆盖原有计划时间。
+func (s *PersistentScheduler) ScheduleTimeout(orderID string, timeout time.Duration, callback domain.TimeoutCallback) error {
+	if err := s.upsert(s.dbs[0], orderID, timeout); err != nil {
+		s.logger.Error("failed to persist timeout task", "order_id", orderID, "error", err)
+		return err
+	}
+
+	if callback != nil {
+		s.callbacks.Store(orderID, callback)
+	}
+	s.logger.Debug("Scheduling timeout task", "order_id", orderID, "timeout", timeout)
+	return nil
+}
+
+// ScheduleTimeoutInTx 在调用方事务内登记任务，事务回滚时任务一并撤销。
+// tx 须指向本调度器扫描的某个分片，到期时使用 fallback 回调。
+func (s *PersistentScheduler) ScheduleTimeoutInTx(ctx context.Context, tx *gorm.DB, orderID string, timeout time.Duration) error {
+	return s.upsert(tx.WithContext(ctx), orderID, timeout)
+}
+
+// upsert 写入待触发任务，同键任务覆盖计划时间并重置状态。
+func (s *PersistentScheduler) upsert(db *gorm.DB, orderID string, timeout time.Duration) error {
+	task := &TimeoutTask{
+		TaskKey: orderID,
+		FireAt:  time.Now().Add(timeout),
+		Status:  TimeoutTaskPending,
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"fire_at", "status", "lease_owner", "lease_until", "updated_at"}),
+	}).Create(task).Error
+}
+
+// Start 启动
+// 启动时统计待触发任务 (即重启前遗留的任务)，随后由扫描协程统一加载执行。
+func (s *PersistentScheduler) Start() {
+	pending, err := s.PendingCount(context.Background())
+	if err != nil {
+		s.logger.Error("failed to count pending timeout tasks", "error", err)
+	}
+	s.logger.Info("PersistentScheduler started", "owner", s.owner, "tick", s.tick, "shards", len(s.dbs), "reloaded_pending", pending)
+
+	ticker := time.NewTicker(s.tick)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				s.poll()
+			case <-s.stopChan:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止
+func (s *PersistentScheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+		s.logger.Info("PersistentScheduler stopped", "owner", s.owner)
+	})
+}
+
+// poll 逐个分片领取到期任务并逐个触发
+func (s *PersistentScheduler) poll() {
+	for i, db := range s.dbs {
+		tasks, err := s.claim(db, time.Now())
+		if err != nil {
+			s.logger.Error("failed to claim due timeout tasks", "shard", i, "error", err)
+			continue
+		}
+		for _, task := range tasks {
+			s.fire(db, task)
+		}
+	}
+}
+
+// claim 以租约方式领取已到期的任务 (包括租约过期、持有者已宕机的任务)
+func (s *PersistentScheduler) claim(db *gorm.DB, now time.Time) ([]*TimeoutTask, error) {
+	var tasks []*TimeoutTask
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND fire_at <= ?) OR (status = ? AND lease_until < ?)",
+				TimeoutTaskPending, now, TimeoutTaskFiring, now).
+			Order("fire_at ASC").
+			Limit(s.batchSize).
+			Find(&tasks).Error; err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(tasks))
+		for i, t := range tasks {
+			ids[i] = t.ID
+		}
+		return tx.Model(&TimeoutTask{}).Where("id IN ?", ids).Updates(map[string]any{
+			"status":      TimeoutTaskFiring,
+			"lease_owner": s.owner,
+			"lease_until": now.Add(s.lease),
+			"attempts":    gorm.Expr("attempts + 1"),
+		}).Error
+	})
+	return tasks, err
+}
+
+// fire 执行单个任务并回写状态
+func (s *PersistentScheduler) fire(db *gorm.DB, task *TimeoutTask) {
+	now := time.Now()
+	lag := now.Sub(task.FireAt)
+	s.fireLag.WithLabelValues().Observe(lag.Seconds())
+	if lag > 2*s.tick {
+		s.missedFire.WithLabelValues().Inc()
+		s.logger.Warn("timeout task missed its fire time", "order_id", task.TaskKey, "fire_at", task.FireAt, "lag", lag)
+	}
+
+	callback := s.fallback
+	if cb, ok := s.callbacks.Load(task.TaskKey); ok {
+		callback = cb.(domain.TimeoutCallback)
+	}
+
+	status := "success"
+	var cbErr error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				status = "panic"
+				cbErr = fmt.Errorf("panic: %v", r)
+				s.logger.Error("Recovered from panic in timeout task", "order_id", task.TaskKey, "recover", r)
+			}
+		}()
+		s.logger.Debug("Timeout task triggered", "order_id", task.TaskKey)
+		if callback != nil {
+			cbErr = callback(task.TaskKey)
+		}
+	}()
+	if cbErr != nil && status == "success" {
+		status = "failed"
+	}
+	s.firedCounter.WithLabelValues(status).Inc()
+
+	// 仅当租约仍由本副本持有时才回写，避免覆盖被重新调度的任务
+	updates := map[string]any{
+		"status":      TimeoutTaskDone,
+		"fired_at":    now,
+		"lease_owner": "",
+		"lease_until": nil,
+	}
+	if cbErr != nil {
+		// claim 已将 attempts 加一，内存中仍为领取前的值
+		retryAt := now.Add(retryBackoff(task.Attempts + 1))
+		updates = map[string]any{
+			"status":      TimeoutTaskPending,
+			"fire_at":     retryAt,
+			"lease_owner": "",
+			"lease_until": nil,
+		}
+		s.logger.Warn("timeout task failed, will retry", "order_id", task.TaskKey, "attempts", task.Attempts+1, "retry_at", retryAt, "error", cbErr)
+	}
+	result := db.Model(&TimeoutTask{}).
+		Where("id = ? AND status = ? AND lease_owner = ?", task.ID, TimeoutTaskFiring, s.owner).
+		Updates(updates)
+	if result.Error != nil {
+		s.logger.Error("failed to update timeout task after firing", "order_id", task.TaskKey, "error", result.Error)
+		return
+	}
+	if cbErr == nil && result.RowsAffected > 0 {
+		s.callbacks.Delete(task.TaskKey)
+	}
+}
+
+// retryBackoff 返回第 attempts 次触发失败后的重试间隔：指数退避，最长 10 分钟。
+func retryBackoff(attempts int) time.Duration {
+	return min(time.Duration(1<<uint(min(attempts, 10)))*time.Second, 10*time.Minute)
+}
+
+// PendingCount 返回各分片尚未触发的任务总数，用于就绪检查与监控
+func (s *PersistentScheduler) PendingCount(ctx context.Context) (int64, error) {
+	var total int64
+	for _, db := range s.dbs {
+		var count int64
+		if err := db.WithContext(ctx).Model(&TimeoutTask{}).Where("status <> ?", TimeoutTaskDone).Count(&count).Error; err != nil {
+			return total, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+var _ domain.TimeoutScheduler = (*PersistentScheduler)(nil)
@@ -0,0 +1,170 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/wyfcoding/pkg/messagequeue/kafka"
+)
+
+// DeadLetterSuffix 死信 Topic 后缀，原 Topic 的死信写入 <topic>.dlq。
+const DeadLetterSuffix = ".dlq"
+
+const (
+	// deadLetterAttempts 转入死信前的本地处理次数。
+	deadLetterAttempts = 3
+	// deadLetterBackoff 本地重试的基础退避间隔，按次数线性递增。
+	deadLetterBackoff = 500 * time.Millisecond
+	// replayIdleTimeout 重放时等待下一条死信的最长时间，超时视为死信已读空。
+	replayIdleTimeout = 10 * time.Second
+)
+
+// ErrUnknownDeadLetterTopic 重放的 Topic 未接入死信队列。
+var ErrUnknownDeadLetterTopic = errors.New("topic is not consumed with dead letter queue")
+
+// DeadLetter 死信消息载荷，保留原始消息以便排查与重放。
+type DeadLetter struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Key       string `json:"key"`
+	Value     []byte `json:"value"`
+	Error     string `json:"error"`
+	Attempts  int    `json:"attempts"`
+	FailedAt  int64  `json:"failed_at"`
+}
+
+// permanentError 重试无法恢复的处理错误。
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 标记不可重试的错误 (载荷非法、业务冲突等)，消息将直接转入死信 Topic。
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// DeadLetterQueue 为消费者提供本地重试与死信转储。
+// 底层消费者在处理失败时不提交位点但继续消费，后续提交会越过失败消息，
+// 因此失败消息必须在此写入死信 Topic 后再确认，由运维核实后通过 Replay 重新投递。
+type DeadLetterQueue struct {
+	producer    *kafka.Producer
+	brokers     []string
+	replayGroup string
+	topics      map[string]struct{} // 启动时经 Wrap 登记，之后只读
+	logger      *slog.Logger
+}
+
+// NewDeadLetterQueue 创建死信队列。replayGroup 为重放死信使用的消费组，记录重放进度。
+func NewDeadLetterQueue(producer *kafka.Producer, brokers []string, replayGroup string, logger *slog.Logger) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		producer:    producer,
+		brokers:     brokers,
+		replayGroup: replayGroup,
+		topics:      make(map[string]struct{}),
+		logger:      logger.With("module", "dead_letter_queue"),
+	}
+}
+
+// Wrap 为 topic 的消息处理器接入本地重试与死信转储。
+func (q *DeadLetterQueue) Wrap(topic string, handler kafka.Handler) kafka.Handler {
+	q.topics[topic] = struct{}{}
+	return func(ctx context.Context, msg kafkago.Message) error {
+		var err error
+		attempts := 0
+		for attempts < deadLetterAttempts {
+			attempts++
+			if err = handler(ctx, msg); err == nil {
+				return nil
+			}
+			var permanent *permanentError
+			if errors.As(err, &permanent) || attempts == deadLetterAttempts {
+				break
+			}
+			q.logger.WarnContext(ctx, "message handling failed, retrying", "topic", msg.Topic, "key", string(msg.Key), "attempt", attempts, "error", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(deadLetterBackoff * time.Duration(attempts)):
+			}
+		}
+		return q.deadLetter(ctx, msg, err, attempts)
+	}
+}
+
+// deadLetter 将失败消息写入死信 Topic。写入失败时返回错误，消息保持未确认。
+func (q *DeadLetterQueue) deadLetter(ctx context.Context, msg kafkago.Message, cause error, attempts int) error {
+	payload, err := json.Marshal(&DeadLetter{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       string(msg.Key),
+		Value:     msg.Value,
+		Error:     cause.Error(),
+		Attempts:  attempts,
+		FailedAt:  time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := q.producer.PublishToTopic(ctx, msg.Topic+DeadLetterSuffix, msg.Key, payload); err != nil {
+		return fmt.Errorf("failed to dead-letter message (cause: %v): %w", cause, err)
+	}
+	q.logger.ErrorContext(ctx, "message moved to dead letter topic", "topic", msg.Topic, "key", string(msg.Key), "offset", msg.Offset, "attempts", attempts, "error", cause)
+	return nil
+}
+
+// Replay 将 topic 的死信重新投递回原 Topic，最多 limit 条，返回实际重放条数。
+// 重放进度提交在独立消费组中，已重放的死信不会再次投递；等待超过 replayIdleTimeout 视为死信已读空。
+func (q *DeadLetterQueue) Replay(ctx context.Context, topic string, limit int) (int, error) {
+	if _, ok := q.topics[topic]; !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownDeadLetterTopic, topic)
+	}
+
+	reader := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers: q.brokers,
+		GroupID: q.replayGroup,
+		Topic:   topic + DeadLetterSuffix,
+		MaxWait: time.Second,
+	})
+	defer reader.Close()
+
+	replayed := 0
+	for replayed < limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, replayIdleTimeout)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				break
+			}
+			return replayed, err
+		}
+
+		var letter DeadLetter
+		if err := json.Unmarshal(msg.Value, &letter); err != nil || letter.Topic != topic {
+			// 非死信队列写入的消息无法还原，记录后跳过
+			q.logger.ErrorContext(ctx, "skipping malformed dead letter", "topic", msg.Topic, "offset", msg.Offset, "error", err)
+		} else {
+			if err := q.producer.PublishToTopic(ctx, letter.Topic, []byte(letter.Key), letter.Value); err != nil {
+				return replayed, err
+			}
+			replayed++
+		}
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			return replayed, err
+		}
+	}
+
+	q.logger.InfoContext(ctx, "dead letters replayed", "topic", topic, "count", replayed)
+	return replayed, nil
+}
@@ -0,0 +1,90 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/wyfcoding/ecommerce/internal/order/application"
+)
+
+const (
+	// TopicPaymentPaid 支付成功 (直接支付或回调确认)。
+	TopicPaymentPaid = "payment.paid"
+	// TopicPaymentCaptured 预授权扣款成功。
+	TopicPaymentCaptured = "payment.captured"
+	// TopicPaymentFailed 渠道返回支付失败。
+	TopicPaymentFailed = "payment.failed"
+	// TopicPaymentClosed 支付单超时未支付，已在渠道侧关闭。
+	TopicPaymentClosed = "payment.closed"
+	// TopicPaymentRefunded 退款完成。
+	TopicPaymentRefunded = "payment.refunded"
+)
+
+// PaymentTopics 订单服务订阅的支付事件 Topic。
+var PaymentTopics = []string{TopicPaymentPaid, TopicPaymentCaptured, TopicPaymentFailed, TopicPaymentClosed, TopicPaymentRefunded}
+
+// PaymentEvent 支付事件载荷，各 Topic 共用公共字段，退款事件额外携带退款信息。
+type PaymentEvent struct {
+	PaymentNo     string `json:"payment_no"`
+	OrderID       uint64 `json:"order_id"`
+	OrderNo       string `json:"order_no"`
+	UserID        uint64 `json:"user_id"`
+	Amount        int64  `json:"amount"`
+	PaymentMethod string `json:"payment_method"`
+	Reason        string `json:"reason"`
+	RefundNo      string `json:"refund_no"`
+	RefundAmount  int64  `json:"refund_amount"`
+	FullRefund    bool   `json:"full_refund"`
+}
+
+// PaymentHandler 消费支付服务的支付结果事件，驱动订单状态流转。
+type PaymentHandler struct {
+	orderApp *application.OrderManager
+	logger   *slog.Logger
+}
+
+// NewPaymentHandler 构造函数。
+func NewPaymentHandler(orderApp *application.OrderManager, logger *slog.Logger) *PaymentHandler {
+	return &PaymentHandler{
+		orderApp: orderApp,
+		logger:   logger,
+	}
+}
+
+// Handle 按 Topic 分发支付事件。订单不存在或支付结果与订单冲突时返回 Permanent 错误，直接转入死信。
+func (h *PaymentHandler) Handle(ctx context.Context, msg kafka.Message) error {
+	var event PaymentEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		return Permanent(fmt.Errorf("failed to unmarshal payment event: %w", err))
+	}
+	if event.UserID == 0 || event.OrderID == 0 {
+		return Permanent(fmt.Errorf("payment event %s missing order_id or user_id", event.PaymentNo))
+	}
+
+	var err error
+	switch msg.Topic {
+	case TopicPaymentPaid, TopicPaymentCaptured:
+		err = h.orderApp.HandlePaymentProcessed(ctx, event.UserID, event.OrderID, event.PaymentNo, event.PaymentMethod, event.Amount)
+	case TopicPaymentFailed:
+		err = h.orderApp.HandlePaymentFailed(ctx, event.UserID, event.OrderID, event.PaymentNo, event.Reason)
+	case TopicPaymentClosed:
+		err = h.orderApp.HandlePaymentClosed(ctx, event.UserID, event.OrderID, event.PaymentNo, event.Reason)
+	case TopicPaymentRefunded:
+		err = h.orderApp.HandlePaymentRefunded(ctx, event.UserID, event.OrderID, event.RefundNo, event.RefundAmount, event.FullRefund)
+	default:
+		return nil
+	}
+	if err != nil {
+		if errors.Is(err, application.ErrOrderNotFound) || errors.Is(err, application.ErrPaymentConflict) {
+			return Permanent(err)
+		}
+		return err
+	}
+
+	h.logger.InfoContext(ctx, "payment event processed", "topic", msg.Topic, "payment_no", event.PaymentNo, "order_id", event.OrderID)
+	return nil
+}
@@ -2,8 +2,10 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"strconv" // 导入字符串转换工具。
 	"time"
 
@@ -13,6 +15,7 @@ import (
 
 	// 导入订单模块的领域实体。
 	"google.golang.org/grpc/codes"                       // gRPC状态码。
+	"google.golang.org/grpc/peer"                        // 获取调用方连接信息。
 	"google.golang.org/grpc/status"                      // gRPC状态处理。
 	"google.golang.org/protobuf/types/known/timestamppb" // 导入时间戳消息类型。
 )
@@ -63,16 +66,40 @@ func (s *Server) CreateOrder(ctx context.Context, req *pb.CreateOrderRequest) (*
 		couponCode = req.CouponCode.Value
 	}
 
+	// 下单端 IP 未显式传入时取调用方连接地址。
+	clientIP := req.ClientIp
+	if clientIP == "" {
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+				clientIP = host
+			}
+		}
+	}
+
 	// 调用应用服务层创建订单。
-	order, err := s.app.CreateOrder(ctx, req.UserId, items, shippingAddr, couponCode)
+	result, err := s.app.CreateOrder(ctx, req.UserId, items, shippingAddr, application.Checkout{
+		CouponCode:    couponCode,
+		PaymentMethod: req.PaymentMethod,
+		ClientIP:      clientIP,
+		DeviceID:      req.DeviceId,
+	})
 	if err != nil {
 		slog.Error("gRPC CreateOrder failed", "user_id", req.UserId, "error", err, "duration", time.Since(start))
+		switch {
+		case errors.Is(err, application.ErrCouponServiceUnavailable), errors.Is(err, application.ErrPricingUnavailable):
+			return nil, status.Error(codes.Unavailable, fmt.Sprintf("failed to create order: %v", err))
+		case errors.Is(err, domain.ErrSkuUnavailable), errors.Is(err, domain.ErrCouponInvalid), errors.Is(err, domain.ErrPricingMismatch):
+			return nil, status.Error(codes.FailedPrecondition, fmt.Sprintf("failed to create order: %v", err))
+		}
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to create order: %v", err))
 	}
 
-	slog.Info("gRPC CreateOrder successful", "order_id", order.ID, "user_id", req.UserId, "duration", time.Since(start))
-	// 将领域实体转换为protobuf响应格式。
-	return s.toProto(order), nil
+	slog.Info("gRPC CreateOrder successful", "order_id", result.Order.ID, "user_id", req.UserId, "duration", time.Since(start))
+	// 将领域实体转换为protobuf响应格式，并附带预支付信息。
+	resp := s.toProto(result.Order)
+	resp.PaymentUrl = result.PaymentURL
+	resp.PaymentTransactionNo = result.TransactionNo
+	return resp, nil
 }
 
 // GetOrderByID 处理根据订单ID获取订单信息的gRPC请求。
@@ -293,15 +320,21 @@ func (s *Server) toProto(o *domain.Order) *pb.OrderInfo {
 	}
 
 	return &pb.OrderInfo{
-		Id:           uint64(o.ID),                 // 订单ID。
-		OrderNo:      o.OrderNo,                    // 订单编号。
-		UserId:       o.UserID,                     // 用户ID。
-		Status:       pb.OrderStatus(o.Status),     // 订单状态。
-		TotalAmount:  o.TotalAmount,                // 订单总金额。
-		ActualAmount: o.ActualAmount,               // 实际支付金额。
-		CreatedAt:    timestamppb.New(o.CreatedAt), // 创建时间。
-		UpdatedAt:    timestamppb.New(o.UpdatedAt), // 更新时间。
-		Items:        items,                        // 订单项列表。
+		Id:             uint64(o.ID),                 // 订单ID。
+		OrderNo:        o.OrderNo,                    // 订单编号。
+		UserId:         o.UserID,                     // 用户ID。
+		Status:         pb.OrderStatus(o.Status),     // 订单状态。
+		TotalAmount:    o.TotalAmount,                // 订单总金额。
+		ActualAmount:   o.ActualAmount,               // 实际支付金额。
+		ShippingFee:    o.ShippingFee,                // 运费。
+		DiscountAmount: o.DiscountAmount,             // 优惠总额。
+		TaxAmount:      o.TaxAmount,                  // 价内税额。
+		CouponCode:     o.CouponCode,                 // 优惠券码。
+		PromotionId:    o.PromotionID,                // 营销活动ID。
+		PaymentMethod:  o.PaymentMethod,              // 支付方式。
+		CreatedAt:      timestamppb.New(o.CreatedAt), // 创建时间。
+		UpdatedAt:      timestamppb.New(o.UpdatedAt), // 更新时间。
+		Items:          items,                        // 订单项列表。
 		ShippingAddress: &pb.ShippingAddress{ // 收货地址信息。
 			RecipientName:   o.ShippingAddress.RecipientName,
 			PhoneNumber:     o.ShippingAddress.PhoneNumber,
@@ -322,14 +355,21 @@ func (s *Server) itemToProto(item *domain.OrderItem) *pb.OrderItem {
 		return nil
 	}
 	return &pb.OrderItem{
-		Id:          uint64(item.ID),                   // 订单项ID。
-		OrderId:     item.OrderID,                      // 订单ID。
-		ProductId:   item.ProductID,                    // 商品ID。
-		SkuId:       item.SkuID,                        // SKU ID。
-		ProductName: item.ProductName,                  // 商品名称。
-		SkuName:     item.SkuName,                      // SKU名称。
-		Price:       item.Price,                        // 单价。
-		Quantity:    item.Quantity,                     // 数量。
-		TotalPrice:  item.Price * int64(item.Quantity), // 总价。
+		Id:                uint64(item.ID),                   // 订单项ID。
+		OrderId:           item.OrderID,                      // 订单ID。
+		ProductId:         item.ProductID,                    // 商品ID。
+		SkuId:             item.SkuID,                        // SKU ID。
+		ProductName:       item.ProductName,                  // 商品名称。
+		SkuName:           item.SkuName,                      // SKU名称。
+		ProductImageUrl:   item.ProductImageURL,              // 商品图片。
+		Price:             item.Price,                        // 单价。
+		Quantity:          item.Quantity,                     // 数量。
+		TotalPrice:        item.Price * int64(item.Quantity), // 总价。
+		PromotionDiscount: item.PromotionDiscount,            // 分摊活动优惠。
+		TierDiscount:      item.TierDiscount,                 // 分摊会员优惠。
+		CouponDiscount:    item.CouponDiscount,               // 分摊优惠券优惠。
+		ShippingFee:       item.ShippingFee,                  // 分摊运费。
+		TaxAmount:         item.TaxAmount,                    // 价内税额。
+		PayAmount:         item.PayAmount,                    // 实付金额。
 	}
 }
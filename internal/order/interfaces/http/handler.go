@@ -1,6 +1,8 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
@@ -8,21 +10,29 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/wyfcoding/ecommerce/internal/order/application"
 	"github.com/wyfcoding/ecommerce/internal/order/domain"
+	"github.com/wyfcoding/pkg/middleware"
 	"github.com/wyfcoding/pkg/pagination"
 	"github.com/wyfcoding/pkg/response"
 )
 
+// DeadLetterReplayer 将事件消费失败转入死信的消息重新投递回原 Topic。
+type DeadLetterReplayer interface {
+	Replay(ctx context.Context, topic string, limit int) (int, error)
+}
+
 // Handler 结构体定义了Order模块的HTTP处理层。
 type Handler struct {
-	service *application.OrderService
-	logger  *slog.Logger
+	service     *application.OrderService
+	deadLetters DeadLetterReplayer
+	logger      *slog.Logger
 }
 
 // NewHandler 创建并返回一个新的 Order HTTP Handler 实例。
-func NewHandler(service *application.OrderService, logger *slog.Logger) *Handler {
+func NewHandler(service *application.OrderService, deadLetters DeadLetterReplayer, logger *slog.Logger) *Handler {
 	return &Handler{
-		service: service,
-		logger:  logger,
+		service:     service,
+		deadLetters: deadLetters,
+		logger:      logger,
 	}
 }
 
@@ -48,7 +58,9 @@ func (h *Handler) CreateOrder(c *gin.Context) {
 			DetailedAddress string `json:"detailed_address" binding:"required"`
 			PostalCode      string `json:"postal_code"`
 		} `json:"shipping_address" binding:"required"`
-		CouponCode string `json:"coupon_code"`
+		CouponCode    string `json:"coupon_code"`
+		PaymentMethod string `json:"payment_method"` // 指定时同步发起预支付，响应中返回 payment_url
+		DeviceID      string `json:"device_id"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -79,14 +91,36 @@ func (h *Handler) CreateOrder(c *gin.Context) {
 		PostalCode:      req.ShippingAddress.PostalCode,
 	}
 
-	order, err := h.service.CreateOrder(c.Request.Context(), req.UserID, items, shippingAddr, req.CouponCode)
+	deviceID := req.DeviceID
+	if deviceID == "" {
+		deviceID = c.GetHeader("X-Device-ID")
+	}
+
+	result, err := h.service.CreateOrder(c.Request.Context(), req.UserID, items, shippingAddr, application.Checkout{
+		CouponCode:    req.CouponCode,
+		PaymentMethod: req.PaymentMethod,
+		ClientIP:      c.ClientIP(),
+		DeviceID:      deviceID,
+	})
 	if err != nil {
 		h.logger.Error("Failed to create order", "error", err)
+		switch {
+		case errors.Is(err, application.ErrCouponServiceUnavailable), errors.Is(err, application.ErrPricingUnavailable):
+			response.ErrorWithStatus(c, http.StatusServiceUnavailable, "failed to create order: "+err.Error(), "")
+			return
+		case errors.Is(err, domain.ErrSkuUnavailable), errors.Is(err, domain.ErrCouponInvalid), errors.Is(err, domain.ErrPricingMismatch):
+			response.ErrorWithStatus(c, http.StatusUnprocessableEntity, "failed to create order: "+err.Error(), "")
+			return
+		}
 		response.ErrorWithStatus(c, http.StatusInternalServerError, "failed to create order: "+err.Error(), "")
 		return
 	}
 
-	response.SuccessWithStatus(c, http.StatusCreated, "Order created successfully", order)
+	response.SuccessWithStatus(c, http.StatusCreated, "Order created successfully", gin.H{
+		"order":          result.Order,
+		"payment_url":    result.PaymentURL,
+		"transaction_no": result.TransactionNo,
+	})
 }
 
 // GetOrder 获取订单详情
@@ -217,6 +251,30 @@ func (h *Handler) ListOrders(c *gin.Context) {
 	response.Success(c, pagination.NewResult(total, pageReq, list))
 }
 
+// ReplayDeadLetters 将支付事件等消费失败的死信重新投递，供运维核实原因 (如补录订单) 后调用。
+func (h *Handler) ReplayDeadLetters(c *gin.Context) {
+	var req struct {
+		Topic string `json:"topic" binding:"required"`
+		Limit int    `json:"limit" binding:"omitempty,gt=0,lte=1000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid input: "+err.Error(), "")
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 100
+	}
+
+	replayed, err := h.deadLetters.Replay(c.Request.Context(), req.Topic, req.Limit)
+	if err != nil {
+		h.logger.Error("Failed to replay dead letters", "topic", req.Topic, "replayed", replayed, "error", err)
+		response.ErrorWithStatus(c, http.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	response.Success(c, gin.H{"topic": req.Topic, "replayed": replayed})
+}
+
 // RegisterRoutes 注册路由
 func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 	group := r.Group("/orders")
@@ -225,5 +283,6 @@ func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 		group.GET("", h.ListOrders)
 		group.GET("/:id", h.GetOrder)
 		group.POST("/:id/status", h.UpdateStatus)
+		group.POST("/dead-letters/replay", middleware.HasRole("ADMIN"), h.ReplayDeadLetters)
 	}
 }
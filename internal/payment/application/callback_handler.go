@@ -4,92 +4,60 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
 	"github.com/wyfcoding/pkg/lock"
 	"github.com/wyfcoding/pkg/messagequeue/outbox"
-	"gorm.io/gorm"
 )
 
 type CallbackHandler struct {
-	paymentRepo domain.PaymentRepository
-	gateways    map[domain.GatewayType]domain.PaymentGateway
-	lockSvc     *lock.RedisLock
-	outboxMgr   *outbox.Manager
-	logger      *slog.Logger
+	gateways  domain.GatewayRegistry
+	verifiers map[domain.GatewayType]domain.NotificationVerifier
+	finalizer *paymentFinalizer
+	logger    *slog.Logger
 }
 
 func NewCallbackHandler(
 	paymentRepo domain.PaymentRepository,
-	gateways map[domain.GatewayType]domain.PaymentGateway,
+	fx *FXService,
+	ledger *StoredValueLedger,
+	profitSharing *ProfitSharingService,
+	gateways domain.GatewayRegistry,
+	verifiers []domain.NotificationVerifier,
 	lockSvc *lock.RedisLock,
 	outboxMgr *outbox.Manager,
 	logger *slog.Logger,
 ) *CallbackHandler {
+	verifierMap := make(map[domain.GatewayType]domain.NotificationVerifier, len(verifiers))
+	for _, v := range verifiers {
+		verifierMap[v.Gateway()] = v
+	}
 	return &CallbackHandler{
-		paymentRepo: paymentRepo,
-		gateways:    gateways,
-		lockSvc:     lockSvc,
-		outboxMgr:   outboxMgr,
-		logger:      logger,
+		gateways:  gateways,
+		verifiers: verifierMap,
+		finalizer: &paymentFinalizer{paymentRepo: paymentRepo, fx: fx, ledger: ledger, profitSharing: profitSharing, lockSvc: lockSvc, outboxMgr: outboxMgr, logger: logger},
+		logger:    logger,
 	}
 }
 
-// HandlePaymentCallback 处理支付回调逻辑
-func (s *CallbackHandler) HandlePaymentCallback(ctx context.Context, userID uint64, paymentNo string, success bool, transactionID, thirdPartyNo string, callbackData map[string]string) error {
-	s.logger.InfoContext(ctx, "handling payment callback", "payment_no", paymentNo, "user_id", userID, "success", success)
-
-	// 1. 分布式锁保护，防止并发回调处理
-	lockKey := fmt.Sprintf("lock:payment:callback:%s", paymentNo)
-	token, err := s.lockSvc.Lock(ctx, lockKey, 10*time.Second)
+// HandleNotification 校验并处理支付渠道的异步通知。
+// 通知须先通过渠道验签器校验签名与商户身份，再与支付单核对金额、币种，全部通过后才会推进支付状态；
+// 返回的通知为 nil 表示验签失败，调用方应拒绝应答以便渠道识别异常。
+func (s *CallbackHandler) HandleNotification(ctx context.Context, gatewayType domain.GatewayType, req *domain.NotifyRequest) (*domain.PaymentNotification, error) {
+	verifier, ok := s.verifiers[gatewayType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", domain.ErrUnsupportedNotifyGateway, gatewayType)
+	}
+	n, err := verifier.Verify(ctx, req)
 	if err != nil {
-		return err
+		s.logger.WarnContext(ctx, "payment notification rejected", "gateway", gatewayType, "error", err)
+		return nil, err
 	}
-	defer s.lockSvc.Unlock(ctx, lockKey, token)
-
-	// 2. 本地事务处理
-	return s.paymentRepo.Transaction(ctx, userID, func(tx any) error {
-		txRepo := s.paymentRepo.WithTx(tx)
-		payment, err := txRepo.FindByPaymentNo(ctx, userID, paymentNo)
-		if err != nil || payment == nil {
-			return fmt.Errorf("payment not found")
-		}
+	s.logger.InfoContext(ctx, "handling payment notification", "gateway", gatewayType, "payment_no", n.PaymentNo, "notify_id", n.NotifyID, "result", n.Result)
 
-		// 2.1 幂等性检查：如果已处理，则直接返回
-		if payment.Status == domain.PaymentSuccess {
-			s.logger.InfoContext(ctx, "payment already success, skipping callback", "payment_no", paymentNo)
-			return nil
-		}
-
-		// 2.2 状态机更新
-		if !success {
-			return payment.Trigger(ctx, "CANCEL", "Gateway reported failure")
-		}
-
-		if err := payment.Trigger(ctx, "PAY_DIRECT", "External callback confirm"); err != nil {
-			return err
-		}
-		
-		payment.TransactionID = transactionID
-		payment.ThirdPartyNo = thirdPartyNo
-		now := time.Now()
-		payment.PaidAt = &now
-
-		if err := txRepo.Update(ctx, payment); err != nil {
-			return err
-		}
+	if n.Result == domain.NotifyResultPending {
+		return n, nil
+	}
 
-		// 3. 发布可靠的支付成功事件
-		// 此事件由订单服务订阅，用于自动改为“已支付”状态
-		event := map[string]any{
-			"payment_no": payment.PaymentNo,
-			"order_no":   payment.OrderNo,
-			"user_id":    payment.UserID,
-			"amount":     payment.Amount,
-			"paid_at":    now.Unix(),
-		}
-		gormTx := tx.(*gorm.DB)
-		return s.outboxMgr.PublishInTx(ctx, gormTx, "payment.paid", payment.PaymentNo, event)
-	})
+	return n, s.finalizer.finalize(ctx, n)
 }
@@ -0,0 +1,105 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// FXConfig 多币种结算配置。
+type FXConfig struct {
+	SettlementCurrency string        `mapstructure:"settlement_currency"` // 结算 (记账本位) 币种，为空时使用默认币种
+	MaxRateAge         time.Duration `mapstructure:"max_rate_age"`        // 牌价最长有效期，超过后拒绝外币支付；为 0 时不限制
+}
+
+// FXService 牌价维护与汇率报价。外币支付发起时锁定报价快照，入账时再次报价以计算汇兑损益。
+type FXService struct {
+	repo               domain.FXRateRepository
+	settlementCurrency string
+	maxRateAge         time.Duration
+	logger             *slog.Logger
+}
+
+// NewFXService 创建汇率服务。
+func NewFXService(repo domain.FXRateRepository, cfg FXConfig, logger *slog.Logger) *FXService {
+	return &FXService{
+		repo:               repo,
+		settlementCurrency: domain.NormalizeCurrency(cfg.SettlementCurrency),
+		maxRateAge:         cfg.MaxRateAge,
+		logger:             logger,
+	}
+}
+
+// SettlementCurrency 返回结算币种。
+func (s *FXService) SettlementCurrency() string {
+	return s.settlementCurrency
+}
+
+// Quote 报价交易币种兑结算币种的汇率快照，同币种返回 1:1 快照。
+func (s *FXService) Quote(ctx context.Context, currency string) (domain.FXSnapshot, error) {
+	now := time.Now()
+	if currency == s.settlementCurrency {
+		return domain.ParSnapshot(now), nil
+	}
+	rate, err := s.repo.FindRate(ctx, currency, s.settlementCurrency)
+	if err != nil {
+		return domain.FXSnapshot{}, err
+	}
+	if rate == nil || !rate.Rate.IsPositive() {
+		return domain.FXSnapshot{}, fmt.Errorf("%w: %s/%s", domain.ErrFXRateUnavailable, currency, s.settlementCurrency)
+	}
+	if rate.Stale(now, s.maxRateAge) {
+		return domain.FXSnapshot{}, fmt.Errorf("%w: %s/%s effective at %s", domain.ErrFXRateUnavailable, currency, s.settlementCurrency, rate.EffectiveAt.Format(time.RFC3339))
+	}
+	return domain.SnapshotOf(rate, now), nil
+}
+
+// QuoteSettlement 入账时报价。报价失败不阻断支付推进，返回 nil 表示沿用锁定汇率。
+func (s *FXService) QuoteSettlement(ctx context.Context, p *domain.Payment) *domain.FXSnapshot {
+	snapshot, err := s.Quote(ctx, domain.NormalizeCurrency(p.Currency))
+	if err != nil {
+		s.logger.WarnContext(ctx, "settlement fx quote unavailable, using locked rate", "payment_no", p.PaymentNo, "currency", p.Currency, "error", err)
+		return nil
+	}
+	return &snapshot
+}
+
+// SetRate 更新货币对牌价。
+func (s *FXService) SetRate(ctx context.Context, baseCurrency, quoteCurrency string, rate decimal.Decimal, source string, effectiveAt time.Time) (*domain.FXRate, error) {
+	baseCurrency = domain.NormalizeCurrency(baseCurrency)
+	quoteCurrency = domain.NormalizeCurrency(quoteCurrency)
+	if !domain.IsSupportedCurrency(baseCurrency) || !domain.IsSupportedCurrency(quoteCurrency) || baseCurrency == quoteCurrency {
+		return nil, fmt.Errorf("%w: %s/%s", domain.ErrUnsupportedCurrency, baseCurrency, quoteCurrency)
+	}
+	if !rate.IsPositive() {
+		return nil, fmt.Errorf("invalid fx rate %s", rate)
+	}
+	if effectiveAt.IsZero() {
+		effectiveAt = time.Now()
+	}
+
+	existing, err := s.repo.FindRate(ctx, baseCurrency, quoteCurrency)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		existing = &domain.FXRate{BaseCurrency: baseCurrency, QuoteCurrency: quoteCurrency}
+	}
+	existing.Rate = rate
+	existing.Source = source
+	existing.EffectiveAt = effectiveAt
+	if err := s.repo.SaveRate(ctx, existing); err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "fx rate updated", "pair", baseCurrency+"/"+quoteCurrency, "rate", rate.String(), "source", source)
+	return existing, nil
+}
+
+// ListRates 列出全部牌价。
+func (s *FXService) ListRates(ctx context.Context) ([]*domain.FXRate, error) {
+	return s.repo.ListRates(ctx)
+}
@@ -3,7 +3,9 @@ package application
 import (
 	"context"
 	"log/slog"
+	"time"
 
+	"github.com/shopspring/decimal"
 	settlementv1 "github.com/wyfcoding/ecommerce/goapi/settlement/v1"
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
 )
@@ -14,6 +16,11 @@ type PaymentService struct {
 	CallbackHandler *CallbackHandler
 	RefundService   *RefundService
 	Query           *PaymentQuery
+	Reconciliation  *ReconciliationService
+	FX              *FXService
+	Ledger          *StoredValueLedger
+	ProfitSharing   *ProfitSharingService
+	Routing         *RoutingEngine
 	settlementCli   settlementv1.SettlementServiceClient
 	logger          *slog.Logger
 }
@@ -24,6 +31,11 @@ func NewPaymentService(
 	callbackHandler *CallbackHandler,
 	refundService *RefundService,
 	query *PaymentQuery,
+	reconciliation *ReconciliationService,
+	fx *FXService,
+	ledger *StoredValueLedger,
+	profitSharing *ProfitSharingService,
+	routing *RoutingEngine,
 	settlementCli settlementv1.SettlementServiceClient,
 	logger *slog.Logger,
 ) *PaymentService {
@@ -32,23 +44,36 @@ func NewPaymentService(
 		CallbackHandler: callbackHandler,
 		RefundService:   refundService,
 		Query:           query,
+		Reconciliation:  reconciliation,
+		FX:              fx,
+		Ledger:          ledger,
+		ProfitSharing:   profitSharing,
+		Routing:         routing,
 		settlementCli:   settlementCli,
 		logger:          logger,
 	}
 }
 
-func (s *PaymentService) InitiatePayment(ctx context.Context, orderID uint64, userID uint64, amount int64, paymentMethod string) (*domain.Payment, *domain.PaymentGatewayResponse, error) {
-	return s.Processor.InitiatePayment(ctx, orderID, userID, amount, paymentMethod)
+func (s *PaymentService) InitiatePayment(ctx context.Context, orderID uint64, userID uint64, amount int64, currency string, paymentMethod string, shares []domain.MerchantShare) (*domain.Payment, *domain.PaymentGatewayResponse, error) {
+	return s.Processor.InitiatePayment(ctx, orderID, userID, amount, currency, paymentMethod, shares)
 }
 
-func (s *PaymentService) HandlePaymentCallback(ctx context.Context, userID uint64, paymentNo string, success bool, transactionID, thirdPartyNo string, callbackData map[string]string) error {
-	return s.CallbackHandler.HandlePaymentCallback(ctx, userID, paymentNo, success, transactionID, thirdPartyNo, callbackData)
+func (s *PaymentService) InitiateCompositePayment(ctx context.Context, orderID uint64, userID uint64, amount int64, currency string, legs []domain.LegRequest, shares []domain.MerchantShare) (*domain.Payment, *domain.PaymentGatewayResponse, error) {
+	return s.Processor.InitiateCompositePayment(ctx, orderID, userID, amount, currency, legs, shares)
+}
+
+func (s *PaymentService) HandleNotification(ctx context.Context, gatewayType domain.GatewayType, req *domain.NotifyRequest) (*domain.PaymentNotification, error) {
+	return s.CallbackHandler.HandleNotification(ctx, gatewayType, req)
 }
 
 func (s *PaymentService) RequestRefund(ctx context.Context, userID, id uint64, amount int64, reason string) (*domain.Refund, error) {
 	return s.RefundService.RequestRefund(ctx, userID, id, amount, reason)
 }
 
+func (s *PaymentService) RefundClosedOrder(ctx context.Context, userID uint64, paymentNo, reason string) error {
+	return s.RefundService.RefundClosedOrder(ctx, userID, paymentNo, reason)
+}
+
 // --- Saga Facade ---
 
 func (s *PaymentService) SagaRefund(ctx context.Context, barrier interface{}, userID, orderID uint64, amount int64, reason string) (string, error) {
@@ -69,4 +94,74 @@ func (s *PaymentService) GetPaymentStatus(ctx context.Context, userID, id uint64
 
 func (s *PaymentService) GetUserIDByPaymentNo(ctx context.Context, paymentNo string) (uint64, error) {
 	return s.Processor.paymentRepo.GetUserIDByPaymentNo(ctx, paymentNo)
-}
\ No newline at end of file
+}
+
+// --- Reconciliation Facade ---
+
+func (s *PaymentService) RunReconciliation(ctx context.Context, billDate string) ([]*domain.ReconciliationRun, error) {
+	return s.Reconciliation.RunDailyReconciliation(ctx, billDate)
+}
+
+func (s *PaymentService) PreviousBillDate(at time.Time) string {
+	return s.Reconciliation.PreviousBillDate(at)
+}
+
+func (s *PaymentService) ListReconciliationRuns(ctx context.Context, billDate, channelCode string) ([]*domain.ReconciliationRun, error) {
+	return s.Reconciliation.ListRuns(ctx, billDate, channelCode)
+}
+
+func (s *PaymentService) ListReconciliationBreaks(ctx context.Context, filter *domain.BreakFilter, page, pageSize int) ([]*domain.ReconciliationRecord, int64, error) {
+	return s.Reconciliation.ListBreaks(ctx, filter, page, pageSize)
+}
+
+func (s *PaymentService) GetReconciliationBreak(ctx context.Context, id uint64) (*domain.ReconciliationRecord, error) {
+	return s.Reconciliation.GetBreak(ctx, id)
+}
+
+func (s *PaymentService) AssignReconciliationBreak(ctx context.Context, id uint64, assignee, operator string) (*domain.ReconciliationRecord, error) {
+	return s.Reconciliation.AssignBreak(ctx, id, assignee, operator)
+}
+
+func (s *PaymentService) AnnotateReconciliationBreak(ctx context.Context, id uint64, author, content string) (*domain.ReconciliationNote, error) {
+	return s.Reconciliation.AnnotateBreak(ctx, id, author, content)
+}
+
+func (s *PaymentService) CloseReconciliationBreak(ctx context.Context, id uint64, operator, resolution string) (*domain.ReconciliationRecord, error) {
+	return s.Reconciliation.CloseBreak(ctx, id, operator, resolution)
+}
+
+func (s *PaymentService) SetFXRate(ctx context.Context, baseCurrency, quoteCurrency string, rate decimal.Decimal, source string, effectiveAt time.Time) (*domain.FXRate, error) {
+	return s.FX.SetRate(ctx, baseCurrency, quoteCurrency, rate, source, effectiveAt)
+}
+
+func (s *PaymentService) ListFXRates(ctx context.Context) ([]*domain.FXRate, error) {
+	return s.FX.ListRates(ctx)
+}
+
+// --- Routing Facade ---
+
+func (s *PaymentService) ListChannelHealth(ctx context.Context) ([]*domain.ChannelHealth, error) {
+	return s.Routing.ChannelHealth(ctx)
+}
+
+func (s *PaymentService) ListRoutingPolicies(ctx context.Context) ([]*domain.RoutingPolicy, error) {
+	return s.Routing.ListPolicies(ctx)
+}
+
+func (s *PaymentService) SaveRoutingPolicy(ctx context.Context, id uint64, policy *domain.RoutingPolicy) (*domain.RoutingPolicy, error) {
+	return s.Routing.SavePolicy(ctx, id, policy)
+}
+
+func (s *PaymentService) ListRouteDecisions(ctx context.Context, filter *domain.RouteDecisionFilter, page, pageSize int) ([]*domain.RouteDecision, int64, error) {
+	return s.Routing.ListDecisions(ctx, filter, page, pageSize)
+}
+
+// --- Stored Value Facade ---
+
+func (s *PaymentService) ListStoredValueBalances(ctx context.Context, userID uint64) ([]*domain.StoredValueAccount, error) {
+	return s.Ledger.Balances(ctx, userID)
+}
+
+func (s *PaymentService) GrantStoredValue(ctx context.Context, userID uint64, source domain.LegSource, currency string, amount int64, refNo, remark string) (*domain.StoredValueAccount, error) {
+	return s.Ledger.Grant(ctx, userID, source, currency, amount, refNo, remark)
+}
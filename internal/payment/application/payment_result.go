@@ -0,0 +1,144 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/lock"
+	"github.com/wyfcoding/pkg/messagequeue/outbox"
+	"gorm.io/gorm"
+)
+
+// errPaymentNotFound 支付单不存在。
+var errPaymentNotFound = errors.New("payment not found")
+
+// paymentFinalizer 将渠道终态结果应用到支付单。
+// 异步通知与主动查询共用同一把锁、同一套核对逻辑与同一组 payment.paid / payment.failed 事件，下游只会看到一条一致的事件流。
+type paymentFinalizer struct {
+	paymentRepo   domain.PaymentRepository
+	fx            *FXService
+	ledger        *StoredValueLedger
+	profitSharing *ProfitSharingService
+	lockSvc       *lock.RedisLock
+	outboxMgr     *outbox.Manager
+	logger        *slog.Logger
+}
+
+// withPaymentLock 在支付单维度的分布式锁与本地事务内执行 fn，fn 收到的支付单为事务内重新读取的最新状态。
+func (f *paymentFinalizer) withPaymentLock(ctx context.Context, paymentNo string, fn func(txRepo domain.PaymentRepository, tx any, payment *domain.Payment) error) error {
+	// 根据支付单号反查用户 ID，用于分片路由
+	userID, err := f.paymentRepo.GetUserIDByPaymentNo(ctx, paymentNo)
+	if err != nil {
+		return fmt.Errorf("failed to locate payment %s: %w", paymentNo, err)
+	}
+
+	// 分布式锁保护，防止回调与主动查询并发推进同一支付单
+	lockKey := fmt.Sprintf("lock:payment:callback:%s", paymentNo)
+	token, err := f.lockSvc.Lock(ctx, lockKey, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer f.lockSvc.Unlock(ctx, lockKey, token)
+
+	return f.paymentRepo.Transaction(ctx, userID, func(tx any) error {
+		txRepo := f.paymentRepo.WithTx(tx)
+		payment, err := txRepo.FindByPaymentNo(ctx, userID, paymentNo)
+		if err != nil {
+			return err
+		}
+		if payment == nil {
+			return errPaymentNotFound
+		}
+		return fn(txRepo, tx, payment)
+	})
+}
+
+// finalize 核对并应用支付结果，并在同一事务内发布 payment.paid 或 payment.failed 事件。
+func (f *paymentFinalizer) finalize(ctx context.Context, n *domain.PaymentNotification) error {
+	return f.withPaymentLock(ctx, n.PaymentNo, func(txRepo domain.PaymentRepository, tx any, payment *domain.Payment) error {
+		// 金额、币种、渠道核对：不一致说明通知被篡改或串单，不得推进状态
+		if err := payment.VerifyNotification(n); err != nil {
+			f.logger.ErrorContext(ctx, "payment result does not match payment", "payment_no", n.PaymentNo, "queried", n.Queried, "error", err)
+			return err
+		}
+
+		// 状态机更新，已处于终态的支付单 (重复通知) 直接返回
+		changed, err := payment.ApplyNotification(ctx, n)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			f.logger.InfoContext(ctx, "payment already finalized, skipping result", "payment_no", n.PaymentNo, "status", payment.Status.String())
+			return nil
+		}
+		if n.Result == domain.NotifyResultSuccess {
+			payment.RecordSettlement(f.fx.QuoteSettlement(ctx, payment))
+			// 按扣款金额生成分账指令，与支付成功事件同事务提交
+			if err := f.profitSharing.planSplits(ctx, tx, payment); err != nil {
+				return err
+			}
+		}
+		// 组合支付：渠道腿成功则扣减储值腿，失败则解冻储值腿
+		if payment.Composite() {
+			if n.Result == domain.NotifyResultSuccess {
+				err = f.ledger.captureLegs(ctx, tx, payment)
+			} else {
+				err = f.ledger.voidLegs(ctx, tx, payment, payment.FailureReason)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := txRepo.Update(ctx, payment); err != nil {
+			return err
+		}
+		if err := txRepo.SaveLegs(ctx, payment.Legs); err != nil {
+			return err
+		}
+		gormTx := tx.(*gorm.DB)
+		if n.Result != domain.NotifyResultSuccess {
+			// 支付失败事件由订单服务订阅，用于关闭订单并释放库存预占
+			event := paymentEvent(payment)
+			event["reason"] = payment.FailureReason
+			event["failed_at"] = payment.CancelledAt.Unix()
+			return f.outboxMgr.PublishInTx(ctx, gormTx, "payment.failed", payment.PaymentNo, event)
+		}
+
+		// 发布可靠的支付成功事件
+		// 此事件由订单服务订阅，用于自动改为“已支付”状态
+		event := paymentEvent(payment)
+		event["paid_at"] = payment.PaidAt.Unix()
+		settlementFields(event, payment)
+		splitFields(event, payment)
+		return f.outboxMgr.PublishInTx(ctx, gormTx, "payment.paid", payment.PaymentNo, event)
+	})
+}
+
+// paymentEvent 构造支付事件的公共字段。订单服务按 user_id 路由分片、按 order_id 定位订单。
+func paymentEvent(p *domain.Payment) map[string]any {
+	return map[string]any{
+		"payment_no":     p.PaymentNo,
+		"order_id":       p.OrderID,
+		"order_no":       p.OrderNo,
+		"user_id":        p.UserID,
+		"amount":         p.Amount,
+		"currency":       domain.NormalizeCurrency(p.Currency),
+		"payment_method": p.PaymentMethod,
+	}
+}
+
+// settlementFields 为支付成功事件补充结算币种金额：按锁定汇率折算的扣款金额与按入账汇率折算的入账金额，
+// 二者之差为汇兑损益，由结算服务记账。
+func settlementFields(event map[string]any, p *domain.Payment) {
+	event["settlement_currency"] = p.SettlementCurrency
+	event["fx_rate"] = p.FX.Rate.String()
+	event["captured_settlement_amount"] = p.CapturedSettlementAmount
+	event["settled_amount"] = p.SettledAmount
+	event["settled_settlement_amount"] = p.SettledSettlementAmount
+	event["settle_fx_rate"] = p.SettleFX.Rate.String()
+	event["fx_gain_loss"] = p.FXGainLoss()
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
 	"github.com/wyfcoding/pkg/idgen"
 	"github.com/wyfcoding/pkg/messagequeue/outbox"
@@ -14,44 +15,89 @@ import (
 )
 
 type PaymentProcessor struct {
-	paymentRepo domain.PaymentRepository
-	channelRepo domain.ChannelRepository
-	routing     *RoutingEngine
-	riskService domain.RiskService
-	idGenerator idgen.Generator
-	gateways    map[domain.GatewayType]domain.PaymentGateway
-	outboxMgr   *outbox.Manager
-	logger      *slog.Logger
+	paymentRepo   domain.PaymentRepository
+	channelRepo   domain.ChannelRepository
+	routing       *RoutingEngine
+	fx            *FXService
+	ledger        *StoredValueLedger
+	profitSharing *ProfitSharingService
+	riskService   domain.RiskService
+	idGenerator   idgen.Generator
+	gateways      domain.GatewayRegistry
+	outboxMgr     *outbox.Manager
+	logger        *slog.Logger
 }
 
 func NewPaymentProcessor(
 	paymentRepo domain.PaymentRepository,
 	channelRepo domain.ChannelRepository,
+	routing *RoutingEngine,
+	fx *FXService,
+	ledger *StoredValueLedger,
+	profitSharing *ProfitSharingService,
 	riskService domain.RiskService,
 	idGenerator idgen.Generator,
-	gateways map[domain.GatewayType]domain.PaymentGateway,
+	gateways domain.GatewayRegistry,
 	outboxMgr *outbox.Manager,
 	logger *slog.Logger,
 ) *PaymentProcessor {
 	return &PaymentProcessor{
-		paymentRepo: paymentRepo,
-		channelRepo: channelRepo,
-		routing:     NewRoutingEngine(channelRepo),
-		riskService: riskService,
-		idGenerator: idGenerator,
-		gateways:    gateways,
-		outboxMgr:   outboxMgr,
-		logger:      logger,
+		paymentRepo:   paymentRepo,
+		channelRepo:   channelRepo,
+		routing:       routing,
+		fx:            fx,
+		ledger:        ledger,
+		profitSharing: profitSharing,
+		riskService:   riskService,
+		idGenerator:   idGenerator,
+		gateways:      gateways,
+		outboxMgr:     outboxMgr,
+		logger:        logger,
 	}
 }
 
-// InitiatePayment 顶级架构：支持智能路由与自动化分账
-func (s *PaymentProcessor) InitiatePayment(ctx context.Context, orderID uint64, userID uint64, amount int64, paymentMethodStr string) (*domain.Payment, *domain.PaymentGatewayResponse, error) {
+// routeContext 构造路由上下文。单商户订单按该商户匹配路由规则，多商户订单只匹配不限商户的规则。
+func routeContext(ctx context.Context, orderID, userID uint64, amount int64, currency, method string, shares []domain.MerchantShare) *domain.RouteContext {
+	routeCtx := &domain.RouteContext{
+		OrderID:       orderID,
+		UserID:        userID,
+		Amount:        decimal.NewFromInt(amount),
+		Currency:      currency,
+		PaymentMethod: method,
+		ClientIP:      ctxutil.GetIP(ctx),
+	}
+	for i, share := range shares {
+		if i == 0 {
+			routeCtx.MerchantID = share.MerchantID
+		} else if share.MerchantID != routeCtx.MerchantID {
+			routeCtx.MerchantID = 0
+			break
+		}
+	}
+	return routeCtx
+}
+
+// InitiatePayment 顶级架构：支持智能路由与自动化分账。
+// currency 为订单标价币种，发起时锁定其兑结算币种的汇率快照，并只路由到受理该币种的渠道。
+// shares 为订单各商户商品金额，扣款时据此生成分账指令；为空时不分账。
+func (s *PaymentProcessor) InitiatePayment(ctx context.Context, orderID uint64, userID uint64, amount int64, currency string, paymentMethodStr string, shares []domain.MerchantShare) (*domain.Payment, *domain.PaymentGatewayResponse, error) {
+	currency = domain.NormalizeCurrency(currency)
+	if !domain.IsSupportedCurrency(currency) {
+		return nil, nil, fmt.Errorf("%w: %s", domain.ErrUnsupportedCurrency, currency)
+	}
+
 	// 1. 智能路由决策 (Adyen Standard)
-	gatewayType, chCfg := s.routing.SelectBestChannel(ctx, amount, paymentMethodStr)
-	gateway, ok := s.gateways[gatewayType]
-	if !ok {
-		return nil, nil, fmt.Errorf("unsupported gateway path: %s", gatewayType)
+	gatewayType, chCfg, err := s.routing.SelectBestChannel(ctx, routeContext(ctx, orderID, userID, amount, currency, paymentMethodStr, shares))
+	if err != nil {
+		return nil, nil, err
+	}
+	gateway, err := s.gateways.ForChannel(ctx, gatewayType, chCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unsupported gateway path %s: %w", gatewayType, err)
+	}
+	var channelCode string
+	if chCfg != nil {
+		channelCode = chCfg.Code
 	}
 
 	// 2. 深度风控检查 (Ant Group Level)
@@ -75,16 +121,35 @@ func (s *PaymentProcessor) InitiatePayment(ctx context.Context, orderID uint64,
 		return nil, nil, err
 	}
 	if payment == nil {
-		payment = domain.NewPayment(orderID, fmt.Sprintf("ORD%d", orderID), userID, amount, paymentMethodStr, gatewayType, s.idGenerator)
+		payment = domain.NewPayment(orderID, fmt.Sprintf("ORD%d", orderID), userID, amount, currency, paymentMethodStr, gatewayType, s.idGenerator)
+	} else if domain.NormalizeCurrency(payment.Currency) != currency {
+		return nil, nil, fmt.Errorf("payment %s already initiated in %s", payment.PaymentNo, payment.Currency)
+	} else if payment.Composite() {
+		return nil, nil, fmt.Errorf("payment %s already initiated as composite payment", payment.PaymentNo)
+	}
+	// 汇率在首次发起时锁定，重复发起沿用同一快照
+	if payment.FX.QuotedAt == nil {
+		snapshot, err := s.fx.Quote(ctx, currency)
+		if err != nil {
+			return nil, nil, err
+		}
+		payment.LockFX(s.fx.SettlementCurrency(), snapshot)
+	}
+	payment.GatewayType = gatewayType
+	payment.ChannelCode = channelCode
+	if err := payment.SetSplitBasis(shares); err != nil {
+		return nil, nil, err
 	}
 
 	// 4. 执行网关 PreAuth 并记录指标
 	start := time.Now()
 	gatewayReq := &domain.PaymentGatewayRequest{
-		OrderID: payment.PaymentNo, Amount: payment.Amount, Currency: "CNY",
+		OrderID: payment.PaymentNo, Amount: payment.Amount, Currency: payment.Currency,
+		Description: payment.OrderNo, ClientIP: ctxutil.GetIP(ctx),
+		ProfitSharing: s.profitSharing.requiresGatewaySharing(gateway, payment),
 	}
 	resp, err := gateway.PreAuth(ctx, gatewayReq)
-	s.routing.RecordResult(chCfg.Code, err == nil, time.Since(start))
+	s.routing.RecordResult(ctx, channelCode, err, time.Since(start))
 
 	if err != nil {
 		return nil, nil, err
@@ -99,7 +164,9 @@ func (s *PaymentProcessor) InitiatePayment(ctx context.Context, orderID uint64,
 	if err := payment.Trigger(ctx, "AUTH", "Pre-authorization successful"); err != nil {
 		return nil, nil, err
 	}
-	payment.TransactionID = resp.TransactionID
+	if resp.TransactionID != "" {
+		payment.TransactionID = resp.TransactionID
+	}
 
 	// 7. 保存
 	if payment.ID == 0 {
@@ -114,6 +181,200 @@ func (s *PaymentProcessor) InitiatePayment(ctx context.Context, orderID uint64,
 	return payment, resp, nil
 }
 
+// InitiateCompositePayment 发起组合支付：支付总额拆分为一条可选的渠道腿与若干储值腿。
+// 授权为全有或全无：先在同一事务内冻结全部储值腿，再向渠道预授权渠道腿；渠道授权失败时解冻已冻结的储值腿并取消支付单。
+// 无渠道腿的组合支付在冻结后直接扣款并发布 payment.paid 事件。
+func (s *PaymentProcessor) InitiateCompositePayment(ctx context.Context, orderID uint64, userID uint64, amount int64, currency string, legs []domain.LegRequest, shares []domain.MerchantShare) (*domain.Payment, *domain.PaymentGatewayResponse, error) {
+	currency = domain.NormalizeCurrency(currency)
+	if !domain.IsSupportedCurrency(currency) {
+		return nil, nil, fmt.Errorf("%w: %s", domain.ErrUnsupportedCurrency, currency)
+	}
+	if err := domain.ValidateLegs(amount, legs); err != nil {
+		return nil, nil, err
+	}
+
+	// 1. 渠道腿路由
+	var (
+		gatewayLeg  *domain.LegRequest
+		gatewayType domain.GatewayType
+		gateway     domain.PaymentGateway
+		channelCode string
+	)
+	for i := range legs {
+		if legs[i].Source == domain.LegSourceGateway {
+			gatewayLeg = &legs[i]
+		}
+	}
+	if gatewayLeg != nil {
+		var chCfg *domain.ChannelConfig
+		var err error
+		gatewayType, chCfg, err = s.routing.SelectBestChannel(ctx, routeContext(ctx, orderID, userID, gatewayLeg.Amount, currency, gatewayLeg.PaymentMethod, shares))
+		if err != nil {
+			return nil, nil, err
+		}
+		gateway, err = s.gateways.ForChannel(ctx, gatewayType, chCfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unsupported gateway path %s: %w", gatewayType, err)
+		}
+		if chCfg != nil {
+			channelCode = chCfg.Code
+		}
+	}
+
+	// 2. 风控检查按支付总额进行
+	riskCtx := &domain.RiskContext{
+		UserID: userID, Amount: amount, PaymentMethod: domain.CompositePaymentMethod,
+		IP: ctxutil.GetIP(ctx), OrderID: orderID, DeviceID: ctxutil.GetUserAgent(ctx),
+	}
+	riskResult, err := s.riskService.CheckPrePayment(ctx, riskCtx)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "risk check failed", "error", err)
+		return nil, nil, fmt.Errorf("risk check failed: %w", err)
+	}
+	if riskResult.Action == domain.RiskActionBlock {
+		return nil, nil, fmt.Errorf("high risk blocked: %s", riskResult.Reason)
+	}
+
+	// 3. 组合支付不支持重复发起：已冻结的储值不能再次冻结
+	existing, err := s.paymentRepo.FindByOrderID(ctx, userID, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if existing != nil {
+		return nil, nil, fmt.Errorf("payment %s already initiated for order %d in status %s", existing.PaymentNo, orderID, existing.Status)
+	}
+	snapshot, err := s.fx.Quote(ctx, currency)
+	if err != nil {
+		return nil, nil, err
+	}
+	payment := domain.NewPayment(orderID, fmt.Sprintf("ORD%d", orderID), userID, amount, currency, domain.CompositePaymentMethod, gatewayType, s.idGenerator)
+	payment.LockFX(s.fx.SettlementCurrency(), snapshot)
+	payment.ChannelCode = channelCode
+	payment.AddLegs(legs, s.idGenerator)
+	if err := payment.SetSplitBasis(shares); err != nil {
+		return nil, nil, err
+	}
+
+	// 4. 冻结储值腿并落库，任一来源余额不足则整体回滚
+	err = s.paymentRepo.Transaction(ctx, userID, func(tx any) error {
+		if err := s.ledger.holdLegs(ctx, tx, payment); err != nil {
+			return err
+		}
+		return s.paymentRepo.WithTx(tx).Save(ctx, payment)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 5. 无渠道腿：储值腿直接扣款
+	if gatewayLeg == nil {
+		if err := s.captureInternalOnly(ctx, payment); err != nil {
+			return nil, nil, err
+		}
+		if err := s.riskService.RecordTransaction(ctx, riskCtx); err != nil {
+			s.logger.WarnContext(ctx, "failed to record risk transaction", "error", err)
+		}
+		return payment, &domain.PaymentGatewayResponse{}, nil
+	}
+
+	// 6. 渠道腿预授权，失败时补偿解冻储值腿
+	start := time.Now()
+	resp, err := gateway.PreAuth(ctx, &domain.PaymentGatewayRequest{
+		OrderID: payment.PaymentNo, Amount: gatewayLeg.Amount, Currency: payment.Currency,
+		Description: payment.OrderNo, ClientIP: ctxutil.GetIP(ctx),
+		ProfitSharing: s.profitSharing.requiresGatewaySharing(gateway, payment),
+	})
+	s.routing.RecordResult(ctx, channelCode, err, time.Since(start))
+	if err != nil {
+		s.logger.WarnContext(ctx, "composite gateway authorization failed, releasing stored value", "payment_no", payment.PaymentNo, "error", err)
+		if voidErr := s.voidComposite(ctx, payment, "gateway authorization failed"); voidErr != nil {
+			s.logger.ErrorContext(ctx, "failed to release stored value after gateway authorization failure", "payment_no", payment.PaymentNo, "error", voidErr)
+		}
+		return nil, nil, err
+	}
+
+	if err := s.riskService.RecordTransaction(ctx, riskCtx); err != nil {
+		s.logger.WarnContext(ctx, "failed to record risk transaction", "error", err)
+	}
+
+	// 7. 全部支付腿授权成功
+	err = s.paymentRepo.Transaction(ctx, userID, func(tx any) error {
+		txRepo := s.paymentRepo.WithTx(tx)
+		if err := payment.Trigger(ctx, "AUTH", "Composite pre-authorization successful"); err != nil {
+			return err
+		}
+		if resp.TransactionID != "" {
+			payment.TransactionID = resp.TransactionID
+		}
+		payment.GatewayLeg().Authorize(resp.TransactionID)
+		if err := txRepo.Update(ctx, payment); err != nil {
+			return err
+		}
+		return txRepo.SaveLegs(ctx, payment.Legs)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return payment, resp, nil
+}
+
+// captureInternalOnly 扣减仅含储值腿的组合支付，并在同一事务内发布 payment.paid 事件。
+func (s *PaymentProcessor) captureInternalOnly(ctx context.Context, payment *domain.Payment) error {
+	return s.paymentRepo.Transaction(ctx, payment.UserID, func(tx any) error {
+		txRepo := s.paymentRepo.WithTx(tx)
+		if err := s.ledger.captureLegs(ctx, tx, payment); err != nil {
+			return err
+		}
+		if err := payment.Trigger(ctx, "PAY_DIRECT", "Stored value captured"); err != nil {
+			return err
+		}
+		payment.RecordCapture(payment.Amount)
+		payment.RecordSettlement(s.fx.QuoteSettlement(ctx, payment))
+		if err := s.profitSharing.planSplits(ctx, tx, payment); err != nil {
+			return err
+		}
+		now := time.Now()
+		payment.PaidAt = &now
+		payment.NextQueryAt = nil
+		if err := txRepo.Update(ctx, payment); err != nil {
+			return err
+		}
+		if err := txRepo.SaveLegs(ctx, payment.Legs); err != nil {
+			return err
+		}
+
+		event := paymentEvent(payment)
+		event["paid_at"] = now.Unix()
+		settlementFields(event, payment)
+		splitFields(event, payment)
+		return s.outboxMgr.PublishInTx(ctx, tx.(*gorm.DB), "payment.paid", payment.PaymentNo, event)
+	})
+}
+
+// voidComposite 渠道授权失败时的补偿：解冻储值腿并取消支付单。
+func (s *PaymentProcessor) voidComposite(ctx context.Context, payment *domain.Payment, reason string) error {
+	return s.paymentRepo.Transaction(ctx, payment.UserID, func(tx any) error {
+		txRepo := s.paymentRepo.WithTx(tx)
+		if err := s.ledger.voidLegs(ctx, tx, payment, reason); err != nil {
+			return err
+		}
+		if leg := payment.GatewayLeg(); leg != nil {
+			leg.Void(reason)
+		}
+		if err := payment.Trigger(ctx, "CANCEL", reason); err != nil {
+			return err
+		}
+		now := time.Now()
+		payment.FailureReason = reason
+		payment.CancelledAt = &now
+		payment.NextQueryAt = nil
+		if err := txRepo.Update(ctx, payment); err != nil {
+			return err
+		}
+		return txRepo.SaveLegs(ctx, payment.Legs)
+	})
+}
+
 // CapturePayment 对标金融级账本一致性
 func (s *PaymentProcessor) CapturePayment(ctx context.Context, userID uint64, paymentNo string, amount int64) error {
 	return s.paymentRepo.Transaction(ctx, userID, func(tx any) error {
@@ -123,42 +384,76 @@ func (s *PaymentProcessor) CapturePayment(ctx context.Context, userID uint64, pa
 			return fmt.Errorf("payment not found")
 		}
 
-		gateway, ok := s.gateways[payment.GatewayType]
-		if !ok {
-			return fmt.Errorf("gateway not found")
+		// 组合支付须整单扣款：渠道腿按腿金额扣款，储值腿随后在同一事务内扣减
+		gatewayAmount := amount
+		if payment.Composite() {
+			if payment.GatewayLeg() == nil {
+				return fmt.Errorf("payment %s has no gateway leg to capture", payment.PaymentNo)
+			}
+			if amount != payment.Amount {
+				return fmt.Errorf("composite payment %s must be captured in full: %d", payment.PaymentNo, payment.Amount)
+			}
+			gatewayAmount = payment.GatewayAmount()
+		}
+
+		gateway, err := s.gateways.ForPayment(ctx, payment)
+		if err != nil {
+			return err
 		}
 
 		// 1. 网关 Capture
-		_, err = gateway.Capture(ctx, payment.TransactionID, amount)
+		start := time.Now()
+		resp, err := gateway.Capture(ctx, payment.TradeOf(), gatewayAmount)
+		s.routing.RecordResult(ctx, payment.ChannelCode, err, time.Since(start))
 		if err != nil {
 			return err
 		}
+		if resp.TransactionID != "" {
+			payment.TransactionID = resp.TransactionID
+		}
 
 		// 2. 状态驱动变更 (FSM)
 		if err := payment.Trigger(ctx, "CAPTURE", "Real-time fund capture"); err != nil {
 			return err
 		}
-		payment.CapturedAmount = amount
+		payment.RecordCapture(amount)
+		payment.RecordSettlement(s.fx.QuoteSettlement(ctx, payment))
 		now := time.Now()
 		payment.PaidAt = &now
+		payment.NextQueryAt = nil
+
+		if payment.Composite() {
+			payment.GatewayLeg().TransactionID = payment.TransactionID
+			payment.GatewayLeg().Capture()
+			if err := s.ledger.captureLegs(ctx, tx, payment); err != nil {
+				return err
+			}
+		}
 
-		// 3. 更新分账状态
-		for i := range payment.Splits {
-			payment.Splits[i].Status = "SETTLED"
+		// 3. 按扣款金额生成分账指令
+		if err := s.profitSharing.planSplits(ctx, tx, payment); err != nil {
+			return err
 		}
 
 		if err := txRepo.Update(ctx, payment); err != nil {
 			return err
 		}
+		if err := txRepo.SaveLegs(ctx, payment.Legs); err != nil {
+			return err
+		}
 
 		// 3. 发送结算事件 (Internal Service Interaction)
 		event := map[string]any{
-			"payment_no": payment.PaymentNo,
-			"order_no":   payment.OrderNo,
-			"user_id":    payment.UserID,
-			"amount":     payment.CapturedAmount,
-			"timestamp":  time.Now().Unix(),
+			"payment_no":     payment.PaymentNo,
+			"order_id":       payment.OrderID,
+			"order_no":       payment.OrderNo,
+			"user_id":        payment.UserID,
+			"amount":         payment.CapturedAmount,
+			"payment_method": payment.PaymentMethod,
+			"timestamp":      time.Now().Unix(),
 		}
+		settlementFields(event, payment)
+		splitFields(event, payment)
 		gormTx := tx.(*gorm.DB)
 		return s.outboxMgr.PublishInTx(ctx, gormTx, "payment.captured", payment.PaymentNo, event)
 	})
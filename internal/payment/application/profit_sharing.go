@@ -0,0 +1,433 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/idgen"
+	"github.com/wyfcoding/pkg/messagequeue/outbox"
+	"gorm.io/gorm"
+)
+
+// ProfitSharingConfig 分账配置，费率以基点 (万分之一) 表示。
+type ProfitSharingConfig struct {
+	CommissionBps         int64            `mapstructure:"commission_bps"`          // 平台佣金默认费率
+	PromoterBps           int64            `mapstructure:"promoter_bps"`            // 推广佣金费率
+	MerchantCommissionBps map[string]int64 `mapstructure:"merchant_commission_bps"` // 按商户 ID 覆盖的平台佣金费率
+}
+
+// Policy 解析并校验分账费率。
+func (c ProfitSharingConfig) Policy() (domain.SplitPolicy, error) {
+	policy := domain.SplitPolicy{
+		CommissionBps:         c.CommissionBps,
+		PromoterBps:           c.PromoterBps,
+		MerchantCommissionBps: make(map[uint64]int64, len(c.MerchantCommissionBps)),
+	}
+	for id, bps := range c.MerchantCommissionBps {
+		merchantID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil || merchantID == 0 {
+			return domain.SplitPolicy{}, fmt.Errorf("invalid profit_sharing merchant id %q", id)
+		}
+		policy.MerchantCommissionBps[merchantID] = bps
+	}
+	if err := policy.Validate(); err != nil {
+		return domain.SplitPolicy{}, fmt.Errorf("invalid profit_sharing config: %w", err)
+	}
+	return policy, nil
+}
+
+// ProfitSharingService 扣款时生成分账指令，并按分账方式执行：
+// 接收方在渠道登记了分账账号的商户分账通过渠道分账接口划转，其余分账计入结算账本随结算周期打款。
+// 渠道分账与退款引起的渠道分账回退由后台任务异步执行并按退避计划重试。
+type ProfitSharingService struct {
+	repo        domain.ProfitSharingRepository
+	paymentRepo domain.PaymentRepository
+	gateways    domain.GatewayRegistry
+	policy      domain.SplitPolicy
+	idGenerator idgen.Generator
+	outboxMgr   *outbox.Manager
+	logger      *slog.Logger
+	interval    time.Duration
+	batchSize   int
+	stopChan    chan struct{}
+}
+
+// NewProfitSharingService 创建分账服务。
+func NewProfitSharingService(
+	repo domain.ProfitSharingRepository,
+	paymentRepo domain.PaymentRepository,
+	gateways domain.GatewayRegistry,
+	policy domain.SplitPolicy,
+	idGenerator idgen.Generator,
+	outboxMgr *outbox.Manager,
+	logger *slog.Logger,
+) *ProfitSharingService {
+	return &ProfitSharingService{
+		repo:        repo,
+		paymentRepo: paymentRepo,
+		gateways:    gateways,
+		policy:      policy,
+		idGenerator: idGenerator,
+		outboxMgr:   outboxMgr,
+		logger:      logger.With("module", "profit_sharing"),
+		interval:    10 * time.Second,
+		batchSize:   100,
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// gatewayFor 返回支付单渠道的分账能力。含储值腿的组合支付资金不全在渠道侧，不走渠道分账。
+func (s *ProfitSharingService) gatewayFor(gateway domain.PaymentGateway, p *domain.Payment) (domain.ProfitSharingGateway, bool) {
+	if len(p.InternalLegs()) > 0 {
+		return nil, false
+	}
+	psg, ok := gateway.(domain.ProfitSharingGateway)
+	return psg, ok
+}
+
+// requiresGatewaySharing 判断发起支付时是否需向渠道声明分账：任一商户在渠道登记了分账账号。
+func (s *ProfitSharingService) requiresGatewaySharing(gateway domain.PaymentGateway, p *domain.Payment) bool {
+	psg, ok := s.gatewayFor(gateway, p)
+	if !ok {
+		return false
+	}
+	shares, err := p.MerchantShares()
+	if err != nil {
+		return false
+	}
+	for _, share := range shares {
+		if _, ok := psg.ProfitSharingAccount(domain.SplitRecipientMerchant, share.MerchantID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// planSplits 在扣款事务内按扣款金额生成分账指令并确定执行方式，须在记录扣款与结算金额之后调用。
+// 平台佣金与无渠道分账账号的分账计入账本即视为已执行；渠道分账待后台任务执行。
+func (s *ProfitSharingService) planSplits(ctx context.Context, tx any, p *domain.Payment) error {
+	if len(p.Splits) > 0 {
+		return nil
+	}
+	if err := p.PlanSplits(s.policy, s.idGenerator); err != nil {
+		return err
+	}
+	if len(p.Splits) == 0 {
+		return nil
+	}
+
+	var psg domain.ProfitSharingGateway
+	if p.GatewayAmount() > 0 {
+		gateway, err := s.gateways.ForPayment(ctx, p)
+		if err != nil {
+			s.logger.WarnContext(ctx, "gateway unavailable for profit sharing, booking splits to ledger", "payment_no", p.PaymentNo, "error", err)
+		} else {
+			psg, _ = s.gatewayFor(gateway, p)
+		}
+	}
+	now := time.Now()
+	for _, split := range p.Splits {
+		if psg != nil && split.RecipientType != domain.SplitRecipientPlatform {
+			if account, ok := psg.ProfitSharingAccount(split.RecipientType, split.RecipientID); ok {
+				split.Mode = domain.SplitModeGateway
+				split.ReceiverAccount = account
+				split.NextAttemptAt = &now
+				continue
+			}
+		}
+		split.Mode = domain.SplitModeLedger
+		split.Settle("")
+	}
+	return s.repo.WithTx(tx).SaveSplits(ctx, p.UserID, p.Splits)
+}
+
+// reverseSplits 在退款成功的事务内按退款比例回退分账：已在渠道执行的分账由后台任务向渠道发起回退，
+// 其余分账直接冲减并发布 payment.split.reversed 事件，由结算账本冲回应付款项。
+// 渠道分账尚未执行时同样按账本冲减，渠道执行后接收方多收的部分在结算周期内轧差扣回。
+func (s *ProfitSharingService) reverseSplits(ctx context.Context, tx any, p *domain.Payment, refund *domain.Refund) error {
+	if refund.Status != domain.PaymentRefunded || len(p.Splits) == 0 {
+		return nil
+	}
+	reversals := p.PlanSplitReversals(refund, s.idGenerator)
+	if len(reversals) == 0 {
+		return nil
+	}
+	txRepo := s.repo.WithTx(tx)
+	if err := txRepo.SaveSplits(ctx, p.UserID, p.Splits); err != nil {
+		return err
+	}
+	if err := txRepo.SaveReversals(ctx, p.UserID, reversals); err != nil {
+		return err
+	}
+	for _, r := range reversals {
+		if r.Status != domain.SplitSettled {
+			continue
+		}
+		if err := s.publishReversed(ctx, tx, p, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start 启动分账执行循环。
+func (s *ProfitSharingService) Start() {
+	s.logger.Info("profit sharing worker started", "interval", s.interval)
+	ticker := time.NewTicker(s.interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				s.run()
+			case <-s.stopChan:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止分账执行循环。
+func (s *ProfitSharingService) Stop() {
+	close(s.stopChan)
+	s.logger.Info("profit sharing worker stopped")
+}
+
+// run 执行一批到期的渠道分账与渠道分账回退。
+func (s *ProfitSharingService) run() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval*6)
+	defer cancel()
+
+	now := time.Now()
+	s.executeSplits(ctx, now)
+	s.executeReversals(ctx, now)
+}
+
+// executeSplits 按支付单合并到期的渠道分账，一笔交易提交一张渠道分账单。
+func (s *ProfitSharingService) executeSplits(ctx context.Context, now time.Time) {
+	due, err := s.repo.FindDueSplits(ctx, now, s.batchSize)
+	if err != nil {
+		s.logger.Error("failed to list splits due for execution", "error", err)
+		return
+	}
+
+	var order []uint64
+	groups := make(map[uint64][]*domain.PaymentSplit)
+	for _, split := range due {
+		// 先推进执行计划再调用渠道：抢占失败说明其他实例已在处理，调用失败则按计划自然重试
+		claimed, err := s.repo.ClaimSplit(ctx, split, now.Add(s.interval*6))
+		if err != nil {
+			s.logger.Error("failed to claim split", "split_no", split.SplitNo, "error", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if _, ok := groups[split.PaymentID]; !ok {
+			order = append(order, split.PaymentID)
+		}
+		groups[split.PaymentID] = append(groups[split.PaymentID], split)
+	}
+	for _, paymentID := range order {
+		if err := s.shareProfit(ctx, groups[paymentID], now); err != nil {
+			s.logger.Error("failed to execute profit sharing", "payment_id", paymentID, "error", err)
+		}
+	}
+}
+
+// shareProfit 向渠道提交支付单的分账并按各接收方结果推进分账：到账的分账发布 payment.split.executed 事件，
+// 渠道关闭的分账改计入账本，受理中或调用失败的分账按退避计划重试，多次调用失败后改计入账本。
+func (s *ProfitSharingService) shareProfit(ctx context.Context, splits []*domain.PaymentSplit, now time.Time) error {
+	userID := splits[0].UserID
+	payment, err := s.paymentRepo.FindByID(ctx, userID, splits[0].PaymentID)
+	if err != nil {
+		return err
+	}
+	if payment == nil {
+		return errPaymentNotFound
+	}
+
+	var resp *domain.ProfitSharingResponse
+	gateway, err := s.gateways.ForPayment(ctx, payment)
+	if err == nil {
+		psg, ok := s.gatewayFor(gateway, payment)
+		if !ok {
+			err = fmt.Errorf("gateway %s does not support profit sharing", payment.GatewayType)
+		} else {
+			req := &domain.ProfitSharingRequest{Trade: payment.TradeOf(), OrderNo: payment.ProfitSharingOrderNo()}
+			for _, split := range splits {
+				req.Receivers = append(req.Receivers, &domain.ProfitReceiver{
+					SplitNo:     split.SplitNo,
+					Account:     split.ReceiverAccount,
+					Amount:      split.Amount,
+					Description: fmt.Sprintf("%s share of %s", split.RecipientType, payment.OrderNo),
+				})
+			}
+			resp, err = psg.ShareProfit(ctx, req)
+		}
+	}
+
+	return s.paymentRepo.Transaction(ctx, userID, func(tx any) error {
+		for _, split := range splits {
+			status := domain.ProfitSharingPending
+			if err == nil {
+				status = resp.Status
+				if st, ok := resp.Receivers[split.ReceiverAccount]; ok {
+					status = st
+				}
+			}
+			switch {
+			case err != nil:
+				split.ScheduleRetry(now, err.Error())
+				if split.Attempts >= domain.MaxSplitAttempts {
+					// 渠道侧冻结的资金需人工解冻，分账改由结算账本打款
+					s.logger.ErrorContext(ctx, "gateway profit sharing abandoned, booking split to ledger", "split_no", split.SplitNo, "payment_no", payment.PaymentNo, "error", err)
+					split.FallbackToLedger(err.Error())
+				}
+			case status == domain.ProfitSharingSuccess:
+				split.Settle(resp.GatewayOrderID)
+				if err := s.publishExecuted(ctx, tx, payment, split); err != nil {
+					return err
+				}
+			case status == domain.ProfitSharingFailed:
+				s.logger.WarnContext(ctx, "gateway closed profit sharing, booking split to ledger", "split_no", split.SplitNo, "payment_no", payment.PaymentNo)
+				split.FallbackToLedger("closed by gateway")
+			default:
+				split.ScheduleRetry(now, "processing at gateway")
+			}
+		}
+		return s.repo.WithTx(tx).SaveSplits(ctx, userID, splits)
+	})
+}
+
+// executeReversals 执行到期的渠道分账回退。
+func (s *ProfitSharingService) executeReversals(ctx context.Context, now time.Time) {
+	due, err := s.repo.FindDueReversals(ctx, now, s.batchSize)
+	if err != nil {
+		s.logger.Error("failed to list split reversals due for execution", "error", err)
+		return
+	}
+	for _, reversal := range due {
+		claimed, err := s.repo.ClaimReversal(ctx, reversal, now.Add(s.interval*6))
+		if err != nil {
+			s.logger.Error("failed to claim split reversal", "return_no", reversal.ReturnNo, "error", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.returnProfit(ctx, reversal, now); err != nil {
+			s.logger.Error("failed to execute split reversal", "return_no", reversal.ReturnNo, "error", err)
+		}
+	}
+}
+
+// returnProfit 向渠道发起分账回退：回退成功发布 payment.split.reversed 事件，渠道拒绝或多次失败后转人工处理。
+func (s *ProfitSharingService) returnProfit(ctx context.Context, reversal *domain.SplitReversal, now time.Time) error {
+	payment, err := s.paymentRepo.FindByID(ctx, reversal.UserID, reversal.PaymentID)
+	if err != nil {
+		return err
+	}
+	if payment == nil {
+		return errPaymentNotFound
+	}
+
+	var resp *domain.ProfitReturnResponse
+	gateway, err := s.gateways.ForPayment(ctx, payment)
+	if err == nil {
+		psg, ok := gateway.(domain.ProfitSharingGateway)
+		if !ok {
+			err = fmt.Errorf("gateway %s does not support profit sharing", payment.GatewayType)
+		} else {
+			resp, err = psg.ReturnProfit(ctx, &domain.ProfitReturnRequest{
+				Trade:       payment.TradeOf(),
+				OrderNo:     payment.ProfitSharingOrderNo(),
+				ReturnNo:    reversal.ReturnNo,
+				Account:     reversal.ReceiverAccount,
+				Amount:      reversal.Amount,
+				Description: "refund " + reversal.RefundNo,
+			})
+		}
+	}
+
+	return s.paymentRepo.Transaction(ctx, reversal.UserID, func(tx any) error {
+		switch {
+		case err != nil:
+			reversal.ScheduleRetry(now, err.Error())
+		case resp.Status == domain.ProfitSharingSuccess:
+			reversal.Settle(resp.GatewayReturnID)
+			if err := s.publishReversed(ctx, tx, payment, reversal); err != nil {
+				return err
+			}
+		case resp.Status == domain.ProfitSharingFailed:
+			reversal.Fail(resp.RawResponse)
+		default:
+			reversal.ScheduleRetry(now, "processing at gateway")
+		}
+		if reversal.Status == domain.SplitFailed {
+			s.logger.ErrorContext(ctx, "split reversal failed, manual intervention required", "return_no", reversal.ReturnNo, "refund_no", reversal.RefundNo, "reason", reversal.FailureReason)
+		}
+		return s.repo.WithTx(tx).SaveReversals(ctx, reversal.UserID, []*domain.SplitReversal{reversal})
+	})
+}
+
+// publishExecuted 发布 payment.split.executed 事件，结算服务据此冲减接收方应付款项。
+func (s *ProfitSharingService) publishExecuted(ctx context.Context, tx any, p *domain.Payment, split *domain.PaymentSplit) error {
+	event := map[string]any{
+		"split_no":            split.SplitNo,
+		"payment_no":          p.PaymentNo,
+		"order_no":            p.OrderNo,
+		"recipient_type":      split.RecipientType,
+		"recipient_id":        split.RecipientID,
+		"amount":              split.Amount,
+		"currency":            domain.NormalizeCurrency(p.Currency),
+		"settlement_amount":   split.SettlementAmount,
+		"settlement_currency": p.SettlementCurrency,
+		"gateway_order_id":    split.GatewayOrderID,
+		"executed_at":         split.SettledAt.Unix(),
+	}
+	return s.outboxMgr.PublishInTx(ctx, tx.(*gorm.DB), "payment.split.executed", split.SplitNo, event)
+}
+
+// publishReversed 发布 payment.split.reversed 事件，结算服务据此将退款金额按分账比例冲回各接收方。
+func (s *ProfitSharingService) publishReversed(ctx context.Context, tx any, p *domain.Payment, r *domain.SplitReversal) error {
+	event := map[string]any{
+		"return_no":           r.ReturnNo,
+		"refund_no":           r.RefundNo,
+		"split_no":            r.SplitNo,
+		"payment_no":          p.PaymentNo,
+		"order_no":            p.OrderNo,
+		"recipient_type":      r.RecipientType,
+		"recipient_id":        r.RecipientID,
+		"mode":                string(r.Mode),
+		"amount":              r.Amount,
+		"currency":            domain.NormalizeCurrency(p.Currency),
+		"settlement_amount":   r.SettlementAmount,
+		"settlement_currency": p.SettlementCurrency,
+		"reversed_at":         r.SettledAt.Unix(),
+	}
+	return s.outboxMgr.PublishInTx(ctx, tx.(*gorm.DB), "payment.split.reversed", r.ReturnNo, event)
+}
+
+// splitFields 为扣款事件补充分账明细，结算服务据此按接收方入账。
+func splitFields(event map[string]any, p *domain.Payment) {
+	if len(p.Splits) == 0 {
+		return
+	}
+	splits := make([]map[string]any, 0, len(p.Splits))
+	for _, split := range p.Splits {
+		splits = append(splits, map[string]any{
+			"split_no":          split.SplitNo,
+			"recipient_type":    split.RecipientType,
+			"recipient_id":      split.RecipientID,
+			"amount":            split.Amount,
+			"settlement_amount": split.SettlementAmount,
+			"mode":              string(split.Mode),
+		})
+	}
+	event["splits"] = splits
+}
@@ -2,100 +2,434 @@ package application
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/idgen"
+	"github.com/wyfcoding/pkg/lock"
+	"github.com/wyfcoding/pkg/messagequeue/outbox"
 )
 
+// ReconciliationConfig 对账配置。
+type ReconciliationConfig struct {
+	TimeZone string `mapstructure:"time_zone"` // 账单日所在时区 (IANA 名称)，与渠道对账单的日切时区一致；为空时使用 UTC
+}
+
+// Location 解析账单日时区。
+func (c ReconciliationConfig) Location() (*time.Location, error) {
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reconciliation time_zone %q: %w", c.TimeZone, err)
+	}
+	return loc, nil
+}
+
 // ReconciliationService 对账服务
+// 逐渠道分页拉取对账单，经领域对账引擎核对支付与退款明细；已知模式的差异 (回调延迟、日切等) 自动处理，
+// 其余差异进入待处理队列，由运营人员指派、备注与关闭。每个渠道每次对账生成一个批次，作为对账汇总报告。
 type ReconciliationService struct {
 	paymentRepo domain.PaymentRepository
-	gateways    map[domain.GatewayType]domain.PaymentGateway
+	refundRepo  domain.RefundRepository
+	reconRepo   domain.ReconciliationRepository
+	gateways    domain.GatewayRegistry
+	refunds     *RefundService
+	finalizer   *paymentFinalizer
+	idGenerator idgen.Generator
+	engine      *domain.ReconciliationEngine
+	location    *time.Location
 	logger      *slog.Logger
 }
 
 // NewReconciliationService 构造函数
 func NewReconciliationService(
 	paymentRepo domain.PaymentRepository,
-	gateways map[domain.GatewayType]domain.PaymentGateway,
+	refundRepo domain.RefundRepository,
+	reconRepo domain.ReconciliationRepository,
+	gateways domain.GatewayRegistry,
+	refunds *RefundService,
+	fx *FXService,
+	ledger *StoredValueLedger,
+	profitSharing *ProfitSharingService,
+	idGenerator idgen.Generator,
+	lockSvc *lock.RedisLock,
+	outboxMgr *outbox.Manager,
+	location *time.Location,
 	logger *slog.Logger,
 ) *ReconciliationService {
+	logger = logger.With("module", "reconciliation")
 	return &ReconciliationService{
 		paymentRepo: paymentRepo,
+		refundRepo:  refundRepo,
+		reconRepo:   reconRepo,
 		gateways:    gateways,
+		refunds:     refunds,
+		finalizer:   &paymentFinalizer{paymentRepo: paymentRepo, fx: fx, ledger: ledger, profitSharing: profitSharing, lockSvc: lockSvc, outboxMgr: outboxMgr, logger: logger},
+		idGenerator: idGenerator,
+		engine:      domain.NewReconciliationEngine(),
+		location:    location,
 		logger:      logger,
 	}
 }
 
-// RunDailyReconciliation 执行每日对账任务
-func (s *ReconciliationService) RunDailyReconciliation(ctx context.Context, date time.Time) error {
-	s.logger.InfoContext(ctx, "starting daily reconciliation", "date", date.Format("2006-01-02"))
+// PreviousBillDate 返回 at 在账单时区内的前一自然日，即定时对账应核对的账单日。
+func (s *ReconciliationService) PreviousBillDate(at time.Time) string {
+	return at.In(s.location).AddDate(0, 0, -1).Format(time.DateOnly)
+}
 
-	// 1. 获取本地成功订单
-	localPayments, err := s.paymentRepo.FindSuccessPaymentsByDate(ctx, date)
+// RunDailyReconciliation 执行指定账单日 (yyyy-MM-dd) 的对账任务，返回各渠道的批次汇总。
+// 单个渠道失败不影响其他渠道，失败信息记录在批次中并合并返回。
+func (s *ReconciliationService) RunDailyReconciliation(ctx context.Context, billDate string) ([]*domain.ReconciliationRun, error) {
+	date, err := domain.ParseBillDate(billDate)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	s.logger.InfoContext(ctx, "starting daily reconciliation", "date", billDate)
 
-	localMap := make(map[string]*domain.Payment)
-	for _, p := range localPayments {
-		localMap[p.PaymentNo] = p
+	channels, err := s.gateways.Channels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]*domain.ReconciliationRun, 0, len(channels))
+	var errs []error
+	for _, ch := range channels {
+		run, err := s.reconcileChannel(ctx, billDate, date, ch)
+		if run != nil {
+			runs = append(runs, run)
+		}
+		if err != nil {
+			s.logger.ErrorContext(ctx, "channel reconciliation failed", "channel", ch.Channel.Code, "date", billDate, "error", err)
+			errs = append(errs, fmt.Errorf("channel %s: %w", ch.Channel.Code, err))
+		}
 	}
 
-	// 2. 遍历网关下载对账单并核对
-	for gatewayType, gateway := range s.gateways {
-		s.logger.InfoContext(ctx, "processing gateway bill", "gateway", gatewayType)
+	s.logger.InfoContext(ctx, "reconciliation completed", "date", billDate, "channels", len(channels), "failed", len(errs))
+	return runs, errors.Join(errs...)
+}
+
+// reconcileChannel 对单个渠道执行对账：逐页核对账单明细，账单读完后核对系统侧有而账单中没有的记录。
+func (s *ReconciliationService) reconcileChannel(ctx context.Context, billDate string, date time.Time, ch *domain.ChannelGateway) (*domain.ReconciliationRun, error) {
+	run := domain.NewReconciliationRun(fmt.Sprintf("REC%d", s.idGenerator.Generate()), billDate, ch.Channel)
+	if err := s.reconRepo.SaveRun(ctx, run); err != nil {
+		return nil, err
+	}
 
-		billItems, err := gateway.DownloadBill(ctx, date)
+	seenPayments := make(map[string]struct{})
+	seenRefunds := make(map[string]struct{})
+	err := ch.Gateway.DownloadBill(ctx, date, func(page []*domain.GatewayBillItem) error {
+		payments, refunds, err := s.loadSystemRecords(ctx, page)
 		if err != nil {
-			s.logger.ErrorContext(ctx, "failed to download bill", "gateway", gatewayType, "error", err)
-			continue
+			return err
 		}
+		results := s.engine.ReconcileBatch(page, payments, refunds, ch.Channel.RatePercent)
+		for _, res := range results {
+			if res.Subject == domain.ReconcileSubjectRefund {
+				seenRefunds[res.RefundNo] = struct{}{}
+			} else {
+				seenPayments[res.PaymentNo] = struct{}{}
+			}
+		}
+		return s.record(ctx, run, results)
+	})
+	if err == nil {
+		err = s.reconcileMissing(ctx, run, ch.Channel, date, seenPayments, seenRefunds)
+	}
+	if err != nil {
+		run.Fail(err)
+		if saveErr := s.reconRepo.SaveRun(ctx, run); saveErr != nil {
+			s.logger.ErrorContext(ctx, "failed to save reconciliation run", "run_no", run.RunNo, "error", saveErr)
+		}
+		return run, err
+	}
 
-		for _, item := range billItems {
-			record := &domain.ReconciliationRecord{
-				OrderNo:       item.PaymentNo, // 账单中的单号
-				GatewayAmount: item.Amount,
+	run.Complete()
+	if err := s.reconRepo.SaveRun(ctx, run); err != nil {
+		return run, err
+	}
+	s.logger.InfoContext(ctx, "channel reconciled", "run_no", run.RunNo, "channel", run.ChannelCode, "date", billDate,
+		"items", run.BillItems, "matched", run.MatchedCount, "auto_resolved", run.AutoResolvedCount, "breaks", run.BreakCount)
+	return run, nil
+}
+
+// loadSystemRecords 按账单页中的单号批量查询系统支付单与退款单。
+func (s *ReconciliationService) loadSystemRecords(ctx context.Context, page []*domain.GatewayBillItem) (map[string]*domain.Payment, map[string]*domain.Refund, error) {
+	var paymentNos, refundNos []string
+	for _, item := range page {
+		if item.Status == domain.BillStatusRefund {
+			if item.RefundNo != "" {
+				refundNos = append(refundNos, item.RefundNo)
 			}
+		} else if item.PaymentNo != "" {
+			paymentNos = append(paymentNos, item.PaymentNo)
+		}
+	}
 
-			local, exists := localMap[item.PaymentNo]
-			if !exists {
-				// 外部有，本地无 -> 漏单 (MISSING_SYSTEM)
-				record.Status = "MISSING_SYSTEM"
-				record.Remark = "Transaction exists in gateway but not in local success list"
+	paymentList, err := s.paymentRepo.FindByPaymentNos(ctx, paymentNos)
+	if err != nil {
+		return nil, nil, err
+	}
+	refundList, err := s.refundRepo.FindByRefundNos(ctx, refundNos)
+	if err != nil {
+		return nil, nil, err
+	}
+	payments := make(map[string]*domain.Payment, len(paymentList))
+	for _, p := range paymentList {
+		payments[p.PaymentNo] = p
+	}
+	refunds := make(map[string]*domain.Refund, len(refundList))
+	for _, r := range refundList {
+		refunds[r.RefundNo] = r
+	}
+	return payments, refunds, nil
+}
+
+// reconcileMissing 核对短款：账单日内系统已支付或已退款、但账单中未出现的记录。
+func (s *ReconciliationService) reconcileMissing(ctx context.Context, run *domain.ReconciliationRun, channel *domain.ChannelConfig, date time.Time, seenPayments, seenRefunds map[string]struct{}) error {
+	start, end := domain.BillWindow(channel.Type, date)
+	payments, err := s.paymentRepo.FindPaidByChannel(ctx, channel.Code, start, end)
+	if err != nil {
+		return err
+	}
+	refunds, err := s.refundRepo.FindRefundedByChannel(ctx, channel.Code, start, end)
+	if err != nil {
+		return err
+	}
+
+	var results []*domain.ReconcileResult
+	for _, p := range payments {
+		if _, ok := seenPayments[p.PaymentNo]; !ok {
+			results = append(results, s.engine.MissingPayment(p))
+		}
+	}
+	for _, r := range refunds {
+		// 组合支付中全部退回储值的退款不经过渠道
+		if r.GatewayAmount() == 0 {
+			continue
+		}
+		if _, ok := seenRefunds[r.RefundNo]; !ok {
+			results = append(results, s.engine.MissingRefund(r))
+		}
+	}
+	for i := 0; i < len(results); i += domain.BillPageSize {
+		if err := s.record(ctx, run, results[i:min(i+domain.BillPageSize, len(results))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record 汇总对账结果并维护差异记录：核对一致的明细关闭此前遗留的差异，已知模式的差异自动处理，其余差异进入待处理队列。
+func (s *ReconciliationService) record(ctx context.Context, run *domain.ReconciliationRun, results []*domain.ReconcileResult) error {
+	keys := make([]string, 0, len(results))
+	for _, res := range results {
+		keys = append(keys, res.SubjectKey())
+	}
+	existing, err := s.reconRepo.FindBySubjectKeys(ctx, run.ChannelCode, keys)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range results {
+		prev := existing[res.SubjectKey()]
+		switch {
+		case res.Status == domain.ReconcileMatch:
+			run.Tally(res, false)
+			if prev == nil || !prev.IsOpen() {
+				continue
+			}
+			// 此前的短款出现在后续账单中为日切差异，同一账单日重跑后一致说明差异已被修正
+			if prev.Status == domain.ReconcileMissingChannel && prev.BillDate < run.BillDate {
+				prev.AutoResolve(domain.PatternCrossDay, "matched in channel bill of "+run.BillDate)
 			} else {
-				record.PaymentID = uint64(local.ID)
-				record.SystemAmount = local.Amount
-				record.DiffAmount = local.Amount - item.Amount
-
-				if record.DiffAmount != 0 {
-					record.Status = "MISMATCH"
-					record.Remark = fmt.Sprintf("Amount mismatch: local %d, gateway %d", local.Amount, item.Amount)
-				} else {
-					record.Status = "MATCH"
-				}
-				// 标记已核对
-				delete(localMap, item.PaymentNo)
+				prev.AutoResolve(domain.PatternRematched, "matched on reconciliation run "+run.RunNo)
 			}
+			if err := s.reconRepo.SaveBreak(ctx, prev); err != nil {
+				return err
+			}
+			continue
+		case res.Status == domain.ReconcileMissingChannel && prev != nil && prev.BillDate < run.BillDate && prev.Status != domain.ReconcileMissingChannel:
+			// 该笔已出现在此前的账单中 (如支付通知延迟，系统入账晚于渠道入账日)，不重复计为短款
+			res.Pattern = domain.PatternCrossDay
+			run.Tally(res, true)
+			continue
+		}
 
-			_ = s.paymentRepo.SaveReconciliationRecord(ctx, record)
+		resolved := s.autoResolve(ctx, res)
+		run.Tally(res, resolved)
+		if prev == nil || !prev.IsOpen() {
+			prev = domain.NewReconciliationRecord(run, res)
+		} else {
+			prev.Refresh(run, res)
+		}
+		if resolved {
+			prev.AutoResolve(res.Pattern, fmt.Sprintf("auto resolved by reconciliation run %s", run.RunNo))
+		}
+		if err := s.reconRepo.SaveBreak(ctx, prev); err != nil {
+			return err
 		}
+		existing[res.SubjectKey()] = prev
 	}
+	return nil
+}
 
-	// 3. 处理本地有，外部无的情况 -> 单边账 (MISSING_GATEWAY)
-	for _, p := range localMap {
-		record := &domain.ReconciliationRecord{
-			PaymentID:    uint64(p.ID),
-			OrderNo:      p.PaymentNo,
-			SystemAmount: p.Amount,
-			Status:       "MISSING_GATEWAY",
-			Remark:       "Transaction exists in local but not found in gateway bill",
-		}
-		_ = s.paymentRepo.SaveReconciliationRecord(ctx, record)
+// autoResolve 按引擎识别的模式执行修复，修复失败的差异保留待人工处理。
+func (s *ReconciliationService) autoResolve(ctx context.Context, res *domain.ReconcileResult) bool {
+	if err := s.engine.AutoResolve(res); err != nil {
+		return false
+	}
+
+	var err error
+	switch res.Pattern {
+	case domain.PatternLateCallback:
+		err = s.resolveLateCallback(ctx, res)
+	case domain.PatternLateRefund:
+		err = s.resolveLateRefund(ctx, res)
+	default:
+		return false
+	}
+	if err != nil {
+		s.logger.WarnContext(ctx, "auto resolution failed, break left open", "subject", res.SubjectKey(), "pattern", res.Pattern, "error", err)
+		res.Remark = fmt.Sprintf("%s; auto resolution %s failed: %v", res.Remark, res.Pattern, err)
+		return false
+	}
+	s.logger.InfoContext(ctx, "reconciliation break auto resolved", "subject", res.SubjectKey(), "pattern", res.Pattern)
+	return true
+}
+
+// resolveLateCallback 支付通知丢失：以渠道实时查询结果为准，与异步通知走同一推进逻辑并发布 payment.paid 事件。
+func (s *ReconciliationService) resolveLateCallback(ctx context.Context, res *domain.ReconcileResult) error {
+	payment, err := s.paymentRepo.FindByPaymentNo(ctx, res.UserID, res.PaymentNo)
+	if err != nil {
+		return err
+	}
+	if payment == nil {
+		return errPaymentNotFound
+	}
+	gateway, err := s.gateways.ForPayment(ctx, payment)
+	if err != nil {
+		return err
+	}
+	result, err := gateway.QueryTrade(ctx, payment.TradeOf())
+	if err != nil {
+		return err
+	}
+	if result.State != domain.GatewayTradeSuccess {
+		return fmt.Errorf("gateway trade is not paid (state %d)", result.State)
+	}
+	if err := s.finalizer.finalize(ctx, result.Notification(payment.GatewayType, payment.PaymentNo)); err != nil {
+		return err
 	}
 
-	s.logger.InfoContext(ctx, "reconciliation completed")
+	// 推进期间支付单可能已被关闭，以最新状态为准
+	payment, err = s.paymentRepo.FindByPaymentNo(ctx, res.UserID, res.PaymentNo)
+	if err != nil {
+		return err
+	}
+	if payment == nil || !payment.Paid() {
+		return fmt.Errorf("payment %s not marked paid after query", res.PaymentNo)
+	}
 	return nil
 }
+
+// resolveLateRefund 退款通知缺失：同步渠道退款结果。
+func (s *ReconciliationService) resolveLateRefund(ctx context.Context, res *domain.ReconcileResult) error {
+	refund, err := s.refunds.SyncRefund(ctx, res.UserID, res.RefundNo)
+	if err != nil {
+		return err
+	}
+	if refund.Status != domain.PaymentRefunded {
+		return fmt.Errorf("refund %s is still %s at gateway", res.RefundNo, refund.Status)
+	}
+	return nil
+}
+
+// --- Break Workflow ---
+
+// ListRuns 查询账单日的对账批次，即各渠道的对账汇总报告。
+func (s *ReconciliationService) ListRuns(ctx context.Context, billDate, channelCode string) ([]*domain.ReconciliationRun, error) {
+	if _, err := domain.ParseBillDate(billDate); err != nil {
+		return nil, err
+	}
+	return s.reconRepo.ListRuns(ctx, billDate, channelCode)
+}
+
+// ListBreaks 分页查询对账差异。
+func (s *ReconciliationService) ListBreaks(ctx context.Context, filter *domain.BreakFilter, page, pageSize int) ([]*domain.ReconciliationRecord, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return s.reconRepo.ListBreaks(ctx, filter, (page-1)*pageSize, pageSize)
+}
+
+// GetBreak 查询对账差异及处理备注。
+func (s *ReconciliationService) GetBreak(ctx context.Context, id uint64) (*domain.ReconciliationRecord, error) {
+	record, err := s.reconRepo.FindBreakByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, domain.ErrBreakNotFound
+	}
+	return record, nil
+}
+
+// AssignBreak 将差异指派给处理人，并记录指派备注。
+func (s *ReconciliationService) AssignBreak(ctx context.Context, id uint64, assignee, operator string) (*domain.ReconciliationRecord, error) {
+	record, err := s.GetBreak(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := record.Assign(assignee); err != nil {
+		return nil, err
+	}
+	if err := s.reconRepo.SaveBreak(ctx, record); err != nil {
+		return nil, err
+	}
+	if _, err := s.addNote(ctx, record, operator, "assigned to "+assignee); err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "reconciliation break assigned", "id", id, "assignee", assignee, "operator", operator)
+	return record, nil
+}
+
+// AnnotateBreak 为差异追加处理备注，已关闭的差异也可补充说明。
+func (s *ReconciliationService) AnnotateBreak(ctx context.Context, id uint64, author, content string) (*domain.ReconciliationNote, error) {
+	record, err := s.GetBreak(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.addNote(ctx, record, author, content)
+}
+
+// CloseBreak 人工关闭差异，resolution 为处理结论 (如已补单、已线下退款、渠道差错已申诉)。
+func (s *ReconciliationService) CloseBreak(ctx context.Context, id uint64, operator, resolution string) (*domain.ReconciliationRecord, error) {
+	record, err := s.GetBreak(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := record.Close(operator, resolution); err != nil {
+		return nil, err
+	}
+	if err := s.reconRepo.SaveBreak(ctx, record); err != nil {
+		return nil, err
+	}
+	if _, err := s.addNote(ctx, record, operator, "closed: "+resolution); err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "reconciliation break closed", "id", id, "operator", operator)
+	return record, nil
+}
+
+func (s *ReconciliationService) addNote(ctx context.Context, record *domain.ReconciliationRecord, author, content string) (*domain.ReconciliationNote, error) {
+	note := &domain.ReconciliationNote{RecordID: uint64(record.ID), Author: author, Content: content}
+	if err := s.reconRepo.SaveNote(ctx, note); err != nil {
+		return nil, err
+	}
+	record.Notes = append(record.Notes, note)
+	return note, nil
+}
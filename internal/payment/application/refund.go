@@ -8,45 +8,68 @@ import (
 
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
 	"github.com/wyfcoding/pkg/idgen"
+	"github.com/wyfcoding/pkg/messagequeue/outbox"
+	"gorm.io/gorm"
 )
 
 type RefundService struct {
-	paymentRepo domain.PaymentRepository
-	refundRepo  domain.RefundRepository
-	idGenerator idgen.Generator
-	gateways    map[domain.GatewayType]domain.PaymentGateway
-	logger      *slog.Logger
+	paymentRepo   domain.PaymentRepository
+	refundRepo    domain.RefundRepository
+	ledger        *StoredValueLedger
+	profitSharing *ProfitSharingService
+	refundOrder   []domain.LegSource
+	idGenerator   idgen.Generator
+	gateways      domain.GatewayRegistry
+	outboxMgr     *outbox.Manager
+	logger        *slog.Logger
 }
 
 func NewRefundService(
 	paymentRepo domain.PaymentRepository,
 	refundRepo domain.RefundRepository,
+	ledger *StoredValueLedger,
+	profitSharing *ProfitSharingService,
+	splitCfg SplitConfig,
 	idGenerator idgen.Generator,
-	gateways map[domain.GatewayType]domain.PaymentGateway,
+	gateways domain.GatewayRegistry,
+	outboxMgr *outbox.Manager,
 	logger *slog.Logger,
 ) *RefundService {
 	return &RefundService{
-		paymentRepo: paymentRepo,
-		refundRepo:  refundRepo,
-		idGenerator: idGenerator,
-		gateways:    gateways,
-		logger:      logger,
+		paymentRepo:   paymentRepo,
+		refundRepo:    refundRepo,
+		ledger:        ledger,
+		profitSharing: profitSharing,
+		refundOrder:   splitCfg.refundOrder(),
+		idGenerator:   idGenerator,
+		gateways:      gateways,
+		outboxMgr:     outboxMgr,
+		logger:        logger,
 	}
 }
 
+// RequestRefund 申请退款。退款单号先于渠道调用生成并作为渠道幂等号；
+// 渠道受理中的退款保持 Refunding 状态，由 SyncRefund 查询最终结果。
+// 组合支付的退款按配置的来源优先级分摊到各支付腿，渠道只退分摊到渠道腿的部分，储值分摊在退款成功时退回储值账户。
+// 退款成功时按退款比例回退支付单的分账。
 func (s *RefundService) RequestRefund(ctx context.Context, userID, paymentID uint64, amount int64, reason string) (*domain.Refund, error) {
 	payment, err := s.paymentRepo.FindByID(ctx, userID, paymentID)
 	if err != nil || payment == nil {
 		return nil, fmt.Errorf("payment not found")
 	}
+	if payment.Status != domain.PaymentSuccess {
+		return nil, fmt.Errorf("payment %s is not refundable in status %s", payment.PaymentNo, payment.Status)
+	}
 
-	// 1. 调用网关退款
-	gateway, ok := s.gateways[payment.GatewayType]
-	if !ok {
-		return nil, fmt.Errorf("gateway not found: %s", payment.GatewayType)
+	allocations, err := payment.PlanRefund(amount, s.refundOrder)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := gateway.Refund(ctx, payment.TransactionID, amount); err != nil {
+	// 1. 调用网关退款
+	refundNo := fmt.Sprintf("REF%d", s.idGenerator.Generate())
+	resp, err := s.refundAtGateway(ctx, payment, &domain.Refund{RefundNo: refundNo, RefundAmount: amount, Allocations: allocations}, reason)
+	if err != nil {
 		return nil, err
 	}
 
@@ -69,39 +92,212 @@ func (s *RefundService) RequestRefund(ctx context.Context, userID, paymentID uin
 
 		// 创建退款单
 		refund = &domain.Refund{
-			RefundNo:     fmt.Sprintf("REF%d", s.idGenerator.Generate()),
-			PaymentID:    uint64(p.ID),
-			PaymentNo:    p.PaymentNo,
-			OrderID:      p.OrderID,
-			OrderNo:      p.OrderNo,
-			UserID:       p.UserID,
-			RefundAmount: amount,
-			Reason:       reason,
-			Status:       p.Status,
+			RefundNo:        refundNo,
+			PaymentID:       uint64(p.ID),
+			PaymentNo:       p.PaymentNo,
+			OrderID:         p.OrderID,
+			OrderNo:         p.OrderNo,
+			UserID:          p.UserID,
+			RefundAmount:    amount,
+			Reason:          reason,
+			GatewayRefundID: resp.GatewayRefundID,
+			Allocations:     allocations,
+		}
+		if err := applyRefundResult(ctx, p, refund, resp); err != nil {
+			return err
+		}
+		if err := s.settleAllocations(ctx, tx, p, refund); err != nil {
+			return err
 		}
 
-		// 状态机处理 (退款完成)
-		if err := p.Trigger(ctx, "REFUND_FINISH", "Refund completed"); err != nil {
+		// 保存支付单和退款单
+		if err := txPaymentRepo.Update(ctx, p); err != nil {
+			return err
+		}
+		if err := txRefundRepo.Save(ctx, refund); err != nil {
 			return err
 		}
+		if err := s.profitSharing.reverseSplits(ctx, tx, p, refund); err != nil {
+			return err
+		}
+		return s.publishRefunded(ctx, tx, p, refund)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		refund.Status = p.Status
-		now := time.Now()
-		refund.RefundedAt = &now
+	return refund, nil
+}
 
-		// 保存支付单和退款单
+// RefundClosedOrder 订单已取消或关闭后支付成功时全额原路退款 (order.refund_required)。
+// 支付单已进入退款流程时视为重复投递直接返回。
+func (s *RefundService) RefundClosedOrder(ctx context.Context, userID uint64, paymentNo, reason string) error {
+	payment, err := s.paymentRepo.FindByPaymentNo(ctx, userID, paymentNo)
+	if err != nil {
+		return err
+	}
+	if payment == nil {
+		// 重试无法解决，记录后由人工核实
+		s.logger.ErrorContext(ctx, "payment of closed order not found, refund skipped", "payment_no", paymentNo, "user_id", userID)
+		return nil
+	}
+	if payment.Status != domain.PaymentSuccess {
+		s.logger.InfoContext(ctx, "payment of closed order is not refundable, skipping", "payment_no", paymentNo, "status", payment.Status.String())
+		return nil
+	}
+
+	refund, err := s.RequestRefund(ctx, userID, uint64(payment.ID), payment.Amount, reason)
+	if err != nil {
+		return err
+	}
+	s.logger.InfoContext(ctx, "closed order payment refunded", "payment_no", paymentNo, "refund_no", refund.RefundNo, "amount", refund.RefundAmount, "status", refund.Status.String())
+	return nil
+}
+
+// SyncRefund 查询渠道退款结果并推进处理中的退款单，供退款通知缺失时的补偿任务调用。
+func (s *RefundService) SyncRefund(ctx context.Context, userID uint64, refundNo string) (*domain.Refund, error) {
+	refund, err := s.refundRepo.FindByRefundNo(ctx, userID, refundNo)
+	if err != nil {
+		return nil, err
+	}
+	if refund == nil {
+		return nil, fmt.Errorf("refund not found")
+	}
+	if refund.Status != domain.PaymentRefunding {
+		return refund, nil
+	}
+
+	payment, err := s.paymentRepo.FindByID(ctx, userID, refund.PaymentID)
+	if err != nil || payment == nil {
+		return nil, fmt.Errorf("payment not found")
+	}
+	gateway, err := s.gateways.ForPayment(ctx, payment)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := gateway.QueryRefund(ctx, &domain.RefundGatewayRequest{
+		Trade:           payment.TradeOf(),
+		RefundNo:        refund.RefundNo,
+		GatewayRefundID: refund.GatewayRefundID,
+		Amount:          refund.GatewayAmount(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status == domain.RefundGatewayPending {
+		return refund, nil
+	}
+
+	err = s.paymentRepo.Transaction(ctx, userID, func(tx any) error {
+		txPaymentRepo := s.paymentRepo.WithTx(tx)
+		txRefundRepo := s.refundRepo.WithTx(tx)
+
+		p, err := txPaymentRepo.FindByID(ctx, userID, refund.PaymentID)
+		if err != nil {
+			return err
+		}
+		if resp.GatewayRefundID != "" {
+			refund.GatewayRefundID = resp.GatewayRefundID
+		}
+		if err := applyRefundResult(ctx, p, refund, resp); err != nil {
+			return err
+		}
+		if err := s.settleAllocations(ctx, tx, p, refund); err != nil {
+			return err
+		}
 		if err := txPaymentRepo.Update(ctx, p); err != nil {
 			return err
 		}
-		return txRefundRepo.Save(ctx, refund)
+		if err := txRefundRepo.Update(ctx, refund); err != nil {
+			return err
+		}
+		if err := txRefundRepo.SaveAllocations(ctx, userID, refund.Allocations); err != nil {
+			return err
+		}
+		if err := s.profitSharing.reverseSplits(ctx, tx, p, refund); err != nil {
+			return err
+		}
+		return s.publishRefunded(ctx, tx, p, refund)
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	s.logger.InfoContext(ctx, "refund synchronized", "refund_no", refund.RefundNo, "status", refund.Status.String())
 	return refund, nil
 }
 
+// refundAtGateway 向渠道发起退款。组合支付只退分摊到渠道腿的金额，无渠道分摊时不调用渠道，视为退款成功。
+func (s *RefundService) refundAtGateway(ctx context.Context, payment *domain.Payment, refund *domain.Refund, reason string) (*domain.RefundGatewayResponse, error) {
+	amount := refund.GatewayAmount()
+	if amount == 0 {
+		return &domain.RefundGatewayResponse{Status: domain.RefundGatewaySuccess}, nil
+	}
+	gateway, err := s.gateways.ForPayment(ctx, payment)
+	if err != nil {
+		return nil, err
+	}
+	return gateway.Refund(ctx, &domain.RefundGatewayRequest{
+		Trade:    payment.TradeOf(),
+		RefundNo: refund.RefundNo,
+		Amount:   amount,
+		Reason:   reason,
+	})
+}
+
+// settleAllocations 按退款单状态推进组合支付的退款分摊：退款成功时储值分摊退回储值账户，并保存支付腿已退金额。
+// 渠道受理中的退款暂不退回储值，保证渠道退款失败时整笔退款一并失败。
+func (s *RefundService) settleAllocations(ctx context.Context, tx any, p *domain.Payment, refund *domain.Refund) error {
+	if !p.Composite() {
+		return nil
+	}
+	credited := p.SettleAllocations(refund)
+	if err := s.ledger.creditAllocations(ctx, tx, p, refund.RefundNo, credited); err != nil {
+		return err
+	}
+	return s.paymentRepo.WithTx(tx).SaveLegs(ctx, p.Legs)
+}
+
+// applyRefundResult 按渠道退款状态推进退款单与支付单。Saga 退款不占用支付单状态，仅在支付单处于 Refunding 时推进。
+func applyRefundResult(ctx context.Context, p *domain.Payment, refund *domain.Refund, resp *domain.RefundGatewayResponse) error {
+	switch resp.Status {
+	case domain.RefundGatewaySuccess:
+		if p.Status == domain.PaymentRefunding {
+			if err := p.Trigger(ctx, "REFUND_FINISH", "Refund completed"); err != nil {
+				return err
+			}
+		}
+		refund.Status = domain.PaymentRefunded
+		now := time.Now()
+		refund.RefundedAt = &now
+	case domain.RefundGatewayFailed:
+		if p.Status == domain.PaymentRefunding {
+			if err := p.Trigger(ctx, "REFUND_FAIL", "Refund rejected by gateway"); err != nil {
+				return err
+			}
+		}
+		refund.Status = domain.PaymentFailed
+		refund.FailureReason = resp.RawResponse
+	default:
+		refund.Status = domain.PaymentRefunding
+	}
+	return nil
+}
+
+// publishRefunded 退款成功时在同一事务内发布 payment.refunded 事件，订单服务据此推进退款状态。
+// Saga 退款由售后服务编排并同步变更订单，不经过此事件。
+func (s *RefundService) publishRefunded(ctx context.Context, tx any, p *domain.Payment, refund *domain.Refund) error {
+	if refund.Status != domain.PaymentRefunded {
+		return nil
+	}
+	event := paymentEvent(p)
+	event["refund_no"] = refund.RefundNo
+	event["refund_amount"] = refund.RefundAmount
+	event["full_refund"] = refund.RefundAmount >= p.Amount
+	event["refunded_at"] = refund.RefundedAt.Unix()
+	return s.outboxMgr.PublishInTx(ctx, tx.(*gorm.DB), "payment.refunded", refund.RefundNo, event)
+}
+
 // --- Saga Distributed Transaction Support ---
 
 // SagaRefund Saga 正向: 执行退款 (原路退回)
@@ -114,34 +310,50 @@ func (s *RefundService) SagaRefund(ctx context.Context, barrier interface{}, use
 			return fmt.Errorf("payment not found for order %d", orderID)
 		}
 
-		// 2. 调用网关退款
-		gateway, ok := s.gateways[payment.GatewayType]
-		if !ok {
-			return fmt.Errorf("gateway not found: %s", payment.GatewayType)
+		allocations, err := payment.PlanRefund(amount, s.refundOrder)
+		if err != nil {
+			return err
 		}
 
-		if err := gateway.Refund(ctx, payment.TransactionID, amount); err != nil {
+		// 2. 调用网关退款
+		refundNo = fmt.Sprintf("SAGA-REF-%d", s.idGenerator.Generate())
+		resp, err := s.refundAtGateway(ctx, payment, &domain.Refund{RefundNo: refundNo, RefundAmount: amount, Allocations: allocations}, reason)
+		if err != nil {
 			return fmt.Errorf("gateway refund failed: %w", err)
 		}
+		if resp.Status == domain.RefundGatewayFailed {
+			return fmt.Errorf("gateway refund failed: %s", resp.RawResponse)
+		}
 
-		// 3. 记录内部退款流水 (状态：REFUNDED)
-		refundNo = fmt.Sprintf("SAGA-REF-%d", s.idGenerator.Generate())
+		// 3. 记录内部退款流水 (渠道受理中的退款为 Refunding，由 SyncRefund 推进)
 		refund := &domain.Refund{
-			RefundNo:     refundNo,
-			PaymentID:    uint64(payment.ID),
-			PaymentNo:    payment.PaymentNo,
-			OrderID:      orderID,
-			OrderNo:      payment.OrderNo,
-			UserID:       userID,
-			RefundAmount: amount,
-			Reason:       reason,
-			Status:       domain.PaymentRefunded,
+			RefundNo:        refundNo,
+			PaymentID:       uint64(payment.ID),
+			PaymentNo:       payment.PaymentNo,
+			OrderID:         orderID,
+			OrderNo:         payment.OrderNo,
+			UserID:          userID,
+			RefundAmount:    amount,
+			Reason:          reason,
+			GatewayRefundID: resp.GatewayRefundID,
+			Allocations:     allocations,
 		}
-
-		now := time.Now()
-		refund.RefundedAt = &now
-
-		return s.refundRepo.Save(ctx, refund)
+		if err := applyRefundResult(ctx, payment, refund, resp); err != nil {
+			return err
+		}
+		if !payment.Composite() && len(payment.Splits) == 0 {
+			return s.refundRepo.Save(ctx, refund)
+		}
+		// 组合支付的储值退回、分账回退与退款单在支付单分片的同一事务内提交
+		return s.paymentRepo.Transaction(ctx, userID, func(tx any) error {
+			if err := s.settleAllocations(ctx, tx, payment, refund); err != nil {
+				return err
+			}
+			if err := s.refundRepo.WithTx(tx).Save(ctx, refund); err != nil {
+				return err
+			}
+			return s.profitSharing.reverseSplits(ctx, tx, payment, refund)
+		})
 	})
 	return refundNo, err
 }
@@ -2,97 +2,380 @@ package application
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
-	"github.com/shopspring/decimal"
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
-	"github.com/wyfcoding/pkg/utils/ctxutil"
 )
 
-// ChannelMetrics 实时通道指标
-type ChannelMetrics struct {
-	SuccessCount uint64
-	FailureCount uint64
-	LastLatency  time.Duration
-	LastUpdated  time.Time
+// RoutingConfig 渠道路由与熔断配置。
+type RoutingConfig struct {
+	DefaultStrategy      string        `mapstructure:"default_strategy"`       // 未命中路由规则时使用的策略
+	Window               time.Duration `mapstructure:"window"`                 // 健康度滑动窗口
+	Bucket               time.Duration `mapstructure:"bucket"`                 // 滑动窗口分桶粒度
+	MinRequests          int64         `mapstructure:"min_requests"`           // 窗口内触发熔断的最少调用数
+	FailureRateThreshold float64       `mapstructure:"failure_rate_threshold"` // 触发熔断的失败率
+	OpenDuration         time.Duration `mapstructure:"open_duration"`          // 首次熔断时长，连续熔断时加倍
+	MaxOpenDuration      time.Duration `mapstructure:"max_open_duration"`      // 熔断时长上限
+	ProbeTimeout         time.Duration `mapstructure:"probe_timeout"`          // 半开探测名额的持有时长
+	PolicyCacheTTL       time.Duration `mapstructure:"policy_cache_ttl"`       // 路由规则本地缓存时长
 }
 
-// RoutingEngine 智能路由引擎
+// RoutingEngine 智能路由引擎。
+// 渠道健康度与熔断器状态存储在共享存储中，多副本基于同一份滑动窗口统计决策；
+// 路由策略按商户、支付方式与金额区间配置，每次决策连同各候选渠道评分写入决策日志。
 type RoutingEngine struct {
-	channelRepo domain.ChannelRepository
-	smartRouter *domain.SmartRouter
-	metrics     map[string]*ChannelMetrics // key: channel_code
-	mu          sync.RWMutex
+	channelRepo    domain.ChannelRepository
+	repo           domain.RoutingRepository
+	health         domain.ChannelHealthStore
+	smartRouter    *domain.SmartRouter
+	breaker        domain.CircuitBreakerPolicy
+	defaultPolicy  string
+	probeTimeout   time.Duration
+	policyCacheTTL time.Duration
+	logger         *slog.Logger
+
+	mu         sync.RWMutex
+	policies   []*domain.RoutingPolicy
+	policiesAt time.Time
 }
 
-func NewRoutingEngine(repo domain.ChannelRepository) *RoutingEngine {
+// NewRoutingEngine 创建路由引擎。
+func NewRoutingEngine(channelRepo domain.ChannelRepository, repo domain.RoutingRepository, health domain.ChannelHealthStore, cfg RoutingConfig, logger *slog.Logger) *RoutingEngine {
+	if !domain.IsRoutingStrategy(cfg.DefaultStrategy) {
+		cfg.DefaultStrategy = domain.StrategyCostBased
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 20
+	}
+	if cfg.FailureRateThreshold <= 0 {
+		cfg.FailureRateThreshold = 0.5
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = 30 * time.Second
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = 10 * time.Second
+	}
+	if cfg.PolicyCacheTTL <= 0 {
+		cfg.PolicyCacheTTL = 30 * time.Second
+	}
 	return &RoutingEngine{
-		channelRepo: repo,
+		channelRepo: channelRepo,
+		repo:        repo,
+		health:      health,
 		smartRouter: domain.NewSmartRouter(),
-		metrics:     make(map[string]*ChannelMetrics),
+		breaker: domain.CircuitBreakerPolicy{
+			MinRequests:          cfg.MinRequests,
+			FailureRateThreshold: cfg.FailureRateThreshold,
+			OpenDuration:         cfg.OpenDuration,
+			MaxOpenDuration:      cfg.MaxOpenDuration,
+		},
+		defaultPolicy:  cfg.DefaultStrategy,
+		probeTimeout:   cfg.ProbeTimeout,
+		policyCacheTTL: cfg.PolicyCacheTTL,
+		logger:         logger,
 	}
 }
 
-// SelectBestChannel 根据实时健康度和费率选择最优网关
-func (e *RoutingEngine) SelectBestChannel(ctx context.Context, amount int64, method string) (domain.GatewayType, *domain.ChannelConfig) {
-	e.mu.RLock()
-	// 1. 获取所有可用渠道
-	var channelType domain.ChannelType
+// channelTypeOf 将支付方式映射为渠道类型。
+func channelTypeOf(method string) domain.ChannelType {
 	switch method {
 	case "alipay":
-		channelType = domain.ChannelTypeAlipay
+		return domain.ChannelTypeAlipay
 	case "wechat":
-		channelType = domain.ChannelTypeWechat
+		return domain.ChannelTypeWechat
 	default:
-		channelType = domain.ChannelTypeStripe
+		return domain.ChannelTypeStripe
+	}
+}
+
+// SelectBestChannel 根据路由规则、实时健康度和费率选择最优网关，仅在受理该币种且未熔断的渠道中选择。
+// 未配置任何渠道时降级到 mock 网关；已配置渠道均不受理该币种时返回 ErrNoChannelForCurrency；
+// 受理渠道均处于熔断状态时返回 ErrNoHealthyChannel。
+func (e *RoutingEngine) SelectBestChannel(ctx context.Context, routeCtx *domain.RouteContext) (domain.GatewayType, *domain.ChannelConfig, error) {
+	amount := routeCtx.Amount.IntPart()
+	decision := &domain.RouteDecision{
+		OrderID:       routeCtx.OrderID,
+		UserID:        routeCtx.UserID,
+		MerchantID:    routeCtx.MerchantID,
+		PaymentMethod: routeCtx.PaymentMethod,
+		Currency:      routeCtx.Currency,
+		Amount:        amount,
 	}
-	e.mu.RUnlock()
 
-	channels, err := e.channelRepo.ListEnabledByType(ctx, channelType)
+	// 1. 获取所有可用渠道
+	channels, err := e.channelRepo.ListEnabledByType(ctx, channelTypeOf(routeCtx.PaymentMethod))
 	if err != nil || len(channels) == 0 {
-		return domain.GatewayTypeMock, nil
+		decision.ChannelCode = string(domain.GatewayTypeMock)
+		decision.Fallback = "no channel configured, using mock gateway"
+		e.saveDecision(ctx, decision, nil)
+		return domain.GatewayTypeMock, nil, nil
+	}
+
+	// 2. 按币种与熔断器状态过滤候选渠道
+	codes := make([]string, 0, len(channels))
+	for _, c := range channels {
+		codes = append(codes, c.Code)
 	}
+	now := time.Now()
+	health, err := e.health.Health(ctx, codes, now)
+	if err != nil {
+		// 健康度不可用时不阻断支付，按全部渠道正常处理
+		e.logger.WarnContext(ctx, "channel health unavailable, routing without health data", "error", err)
+		health = nil
+	}
+	routeCtx.Health = health
+
+	records := make([]*domain.RouteCandidate, 0, len(channels))
+	candidates := make([]*domain.ChannelConfig, 0, len(channels))
+	var probe *domain.ChannelConfig
+	currencyMatched := false
+	for _, c := range channels {
+		h, ok := health[c.Code]
+		if !ok {
+			h = &domain.ChannelHealth{ChannelCode: c.Code}
+		}
+		record := &domain.RouteCandidate{
+			ChannelCode: c.Code,
+			SuccessRate: h.SuccessRate(),
+			LatencyP95:  h.LatencyP95.Milliseconds(),
+			Breaker:     string(h.Breaker.Effective(now)),
+		}
+		records = append(records, record)
+
+		if !c.SupportsCurrency(routeCtx.Currency) {
+			record.Excluded = "currency not supported"
+			continue
+		}
+		currencyMatched = true
+		switch h.Breaker.Effective(now) {
+		case domain.BreakerOpen:
+			record.Excluded = fmt.Sprintf("circuit open until %s", h.Breaker.OpenUntil.Format(time.RFC3339))
+			continue
+		case domain.BreakerHalfOpen:
+			// 半开渠道只放行一个探测请求，抢到名额的请求直接路由到该渠道以验证恢复情况
+			if probe == nil {
+				acquired, err := e.health.TryProbe(ctx, c.Code, e.probeTimeout)
+				if err != nil {
+					e.logger.WarnContext(ctx, "failed to acquire channel probe", "channel_code", c.Code, "error", err)
+				}
+				if acquired {
+					probe = c
+					record.Reason = "half-open probe"
+					continue
+				}
+			}
+			record.Excluded = "circuit half-open, probe in flight"
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+
+	if len(candidates) == 0 && probe == nil {
+		if currencyMatched {
+			decision.Fallback = "all channels circuit open"
+			e.saveDecision(ctx, decision, records)
+			return "", nil, fmt.Errorf("%w: %s via %s", domain.ErrNoHealthyChannel, routeCtx.Currency, routeCtx.PaymentMethod)
+		}
+		decision.Fallback = "currency not supported by any channel"
+		e.saveDecision(ctx, decision, records)
+		return "", nil, fmt.Errorf("%w: %s via %s", domain.ErrNoChannelForCurrency, routeCtx.Currency, routeCtx.PaymentMethod)
+	}
+
+	// 3. 匹配路由规则并确定分流组
+	strategy, variant := e.defaultPolicy, domain.RouteVariantA
+	if policy := domain.MatchPolicy(e.cachedPolicies(ctx), routeCtx.MerchantID, routeCtx.PaymentMethod, amount); policy != nil {
+		variant, strategy = policy.Variant(routeCtx.OrderID)
+		decision.PolicyID = uint64(policy.ID)
+		decision.PolicyName = policy.Name
+	}
+	decision.Strategy = strategy
+	decision.Variant = variant
 
-	// 2. 构造路由上下文
-	routeCtx := &domain.RouteContext{
-		Amount:        decimal.NewFromInt(amount),
-		Currency:      "CNY",
-		PaymentMethod: method,
-		ClientIP:      ctxutil.GetIP(ctx),
+	if probe != nil {
+		decision.ChannelCode = probe.Code
+		decision.Reason = "half-open probe"
+		e.saveDecision(ctx, decision, records)
+		return domain.GatewayType(probe.Type), probe, nil
 	}
 
-	// 3. 使用 SmartRouter 进行决策
-	// 策略选择：默认使用成本优先 (COST_BASED)，如果失败则降级到可用性优先
-	bestChan, err := e.smartRouter.Route(ctx, routeCtx, channels, "COST_BASED")
+	// 4. 使用 SmartRouter 进行决策，策略失败时降级到可用性优先
+	best, scores, err := e.smartRouter.Route(ctx, routeCtx, candidates, strategy)
+	if err != nil && strategy != domain.StrategyAvailabilityFirst {
+		decision.Fallback = fmt.Sprintf("%s failed: %v", strategy, err)
+		best, scores, err = e.smartRouter.Route(ctx, routeCtx, candidates, domain.StrategyAvailabilityFirst)
+	}
 	if err != nil {
-		// 降级策略
-		bestChan, err = e.smartRouter.Route(ctx, routeCtx, channels, "AVAILABILITY_FIRST")
+		decision.ChannelCode = string(domain.GatewayTypeMock)
+		decision.Fallback = fmt.Sprintf("routing failed: %v, using mock gateway", err)
+		e.saveDecision(ctx, decision, records)
+		return domain.GatewayTypeMock, nil, nil
+	}
+
+	byCode := make(map[string]*domain.RouteCandidate, len(records))
+	for _, r := range records {
+		byCode[r.ChannelCode] = r
+	}
+	for _, s := range scores {
+		if r, ok := byCode[s.ChannelCode]; ok {
+			r.Score = s.Score
+			r.Reason = s.Reason
+		}
+	}
+	decision.ChannelCode = best.Code
+	decision.Reason = scores[0].Reason
+
+	// 5. 记录决策日志，供审计与策略效果对比
+	e.saveDecision(ctx, decision, records)
+	return domain.GatewayType(best.Type), best, nil
+}
+
+// saveDecision 写入路由决策日志。日志写入失败不影响支付。
+func (e *RoutingEngine) saveDecision(ctx context.Context, decision *domain.RouteDecision, candidates []*domain.RouteCandidate) {
+	if candidates != nil {
+		raw, err := json.Marshal(candidates)
+		if err == nil {
+			decision.Candidates = string(raw)
+		}
+	}
+	if err := e.repo.SaveDecision(ctx, decision); err != nil {
+		e.logger.WarnContext(ctx, "failed to save route decision", "order_id", decision.OrderID, "channel_code", decision.ChannelCode, "error", err)
 	}
+}
 
-	if err != nil || bestChan == nil {
-		return domain.GatewayTypeMock, nil
+// cachedPolicies 返回本地缓存的路由规则，缓存过期后从仓储重新加载；加载失败时沿用旧缓存。
+func (e *RoutingEngine) cachedPolicies(ctx context.Context) []*domain.RoutingPolicy {
+	e.mu.RLock()
+	policies, loadedAt := e.policies, e.policiesAt
+	e.mu.RUnlock()
+	if time.Since(loadedAt) < e.policyCacheTTL {
+		return policies
 	}
 
-	return domain.GatewayType(bestChan.Type), bestChan
+	fresh, err := e.repo.ListPolicies(ctx)
+	if err != nil {
+		e.logger.WarnContext(ctx, "failed to load routing policies, using cached policies", "error", err)
+		return policies
+	}
+	e.mu.Lock()
+	e.policies, e.policiesAt = fresh, time.Now()
+	e.mu.Unlock()
+	return fresh
 }
 
-// RecordResult 异步上报执行结果，用于持续优化路由
-func (e *RoutingEngine) RecordResult(channelCode string, success bool, latency time.Duration) {
+// invalidatePolicies 使路由规则缓存失效，本副本下次路由时重新加载。
+func (e *RoutingEngine) invalidatePolicies() {
 	e.mu.Lock()
-	defer e.mu.Unlock()
+	e.policiesAt = time.Time{}
+	e.mu.Unlock()
+}
 
-	m, ok := e.metrics[channelCode]
-	if !ok {
-		m = &ChannelMetrics{}
-		e.metrics[channelCode] = m
+// RecordResult 上报渠道执行结果，更新共享的滑动窗口统计并推进熔断器。
+// 渠道业务拒绝 (如参数错误、余额不足) 不视为渠道故障；未走真实渠道 (channelCode 为空) 时不记录。
+// 统计写入失败只记录日志，不影响支付结果。
+func (e *RoutingEngine) RecordResult(ctx context.Context, channelCode string, err error, latency time.Duration) {
+	if channelCode == "" {
+		return
+	}
+	outcome := domain.OutcomeOf(err)
+	now := time.Now()
+	if err := e.health.Record(ctx, channelCode, outcome, latency, now); err != nil {
+		e.logger.WarnContext(ctx, "failed to record channel result", "channel_code", channelCode, "error", err)
+		return
+	}
+	if outcome == domain.ChannelOutcomeReject {
+		return
 	}
 
-	if success {
-		m.SuccessCount++
+	health, err := e.health.Health(ctx, []string{channelCode}, now)
+	if err != nil {
+		e.logger.WarnContext(ctx, "failed to load channel health", "channel_code", channelCode, "error", err)
+		return
+	}
+	h := health[channelCode]
+	status, changed := e.breaker.Evaluate(h.Breaker, h, outcome, now)
+	if !changed {
+		return
+	}
+	// 熔断恢复后清空窗口，避免熔断前的失败样本立即再次触发熔断
+	if err := e.health.SaveBreaker(ctx, channelCode, status, status.State == domain.BreakerClosed); err != nil {
+		e.logger.ErrorContext(ctx, "failed to save channel breaker", "channel_code", channelCode, "state", status.State, "error", err)
+		return
+	}
+	if status.State == domain.BreakerOpen {
+		e.logger.WarnContext(ctx, "channel circuit opened", "channel_code", channelCode,
+			"failure_rate", h.FailureRate(), "requests", h.Total(), "open_until", status.OpenUntil, "trips", status.Trips)
 	} else {
-		m.FailureCount++
+		e.logger.InfoContext(ctx, "channel circuit closed", "channel_code", channelCode)
+	}
+}
+
+// ChannelHealth 查询已启用渠道的实时健康度与熔断器状态。
+func (e *RoutingEngine) ChannelHealth(ctx context.Context) ([]*domain.ChannelHealth, error) {
+	var codes []string
+	for _, t := range []domain.ChannelType{domain.ChannelTypeAlipay, domain.ChannelTypeWechat, domain.ChannelTypeStripe} {
+		channels, err := e.channelRepo.ListEnabledByType(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range channels {
+			codes = append(codes, c.Code)
+		}
+	}
+	now := time.Now()
+	health, err := e.health.Health(ctx, codes, now)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*domain.ChannelHealth, 0, len(codes))
+	for _, code := range codes {
+		h := health[code]
+		h.Breaker.State = h.Breaker.Effective(now)
+		result = append(result, h)
+	}
+	return result, nil
+}
+
+// ListPolicies 列出全部路由规则。
+func (e *RoutingEngine) ListPolicies(ctx context.Context) ([]*domain.RoutingPolicy, error) {
+	return e.repo.ListPolicies(ctx)
+}
+
+// SavePolicy 校验并保存路由规则。id 不为 0 时更新已有规则。
+func (e *RoutingEngine) SavePolicy(ctx context.Context, id uint64, policy *domain.RoutingPolicy) (*domain.RoutingPolicy, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	if id != 0 {
+		existing, err := e.repo.FindPolicy(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			return nil, domain.ErrRoutingPolicyNotFound
+		}
+		policy.Model = existing.Model
+	}
+	if err := e.repo.SavePolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+	e.invalidatePolicies()
+	e.logger.InfoContext(ctx, "routing policy saved", "policy_id", policy.ID, "name", policy.Name,
+		"strategy", policy.Strategy, "alt_strategy", policy.AltStrategy, "alt_percent", policy.AltPercent)
+	return policy, nil
+}
+
+// ListDecisions 分页查询路由决策日志。
+func (e *RoutingEngine) ListDecisions(ctx context.Context, filter *domain.RouteDecisionFilter, page, pageSize int) ([]*domain.RouteDecision, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
 	}
-	m.LastLatency = latency
-	m.LastUpdated = time.Now()
+	return e.repo.ListDecisions(ctx, filter, (page-1)*pageSize, pageSize)
 }
@@ -0,0 +1,174 @@
+package application
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/lock"
+	"github.com/wyfcoding/pkg/messagequeue/outbox"
+	"gorm.io/gorm"
+)
+
+// PaymentStatusPoller 主动查询渠道订单状态，补偿丢失的异步通知。
+// 待支付的支付单按退避计划查询，得到终态后与异步通知走同一推进逻辑；超过有效期仍未支付的交易在渠道侧关闭后取消。
+// 渠道已授权冻结资金的交易等待本方扣款，仅在超过渠道授权有效期后撤销授权。
+type PaymentStatusPoller struct {
+	gateways  domain.GatewayRegistry
+	finalizer *paymentFinalizer
+	logger    *slog.Logger
+	interval  time.Duration
+	batchSize int
+	stopChan  chan struct{}
+}
+
+// NewPaymentStatusPoller 创建支付状态主动查询任务。
+func NewPaymentStatusPoller(
+	paymentRepo domain.PaymentRepository,
+	fx *FXService,
+	ledger *StoredValueLedger,
+	profitSharing *ProfitSharingService,
+	gateways domain.GatewayRegistry,
+	lockSvc *lock.RedisLock,
+	outboxMgr *outbox.Manager,
+	logger *slog.Logger,
+) *PaymentStatusPoller {
+	logger = logger.With("module", "payment_status_poller")
+	return &PaymentStatusPoller{
+		gateways:  gateways,
+		finalizer: &paymentFinalizer{paymentRepo: paymentRepo, fx: fx, ledger: ledger, profitSharing: profitSharing, lockSvc: lockSvc, outboxMgr: outboxMgr, logger: logger},
+		logger:    logger,
+		interval:  5 * time.Second,
+		batchSize: 100,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Start 启动查询循环。
+func (p *PaymentStatusPoller) Start() {
+	p.logger.Info("payment status poller started", "interval", p.interval)
+	ticker := time.NewTicker(p.interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				p.poll()
+			case <-p.stopChan:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止查询循环。
+func (p *PaymentStatusPoller) Stop() {
+	close(p.stopChan)
+	p.logger.Info("payment status poller stopped")
+}
+
+// poll 查询一批到期的待支付单。
+func (p *PaymentStatusPoller) poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval*6)
+	defer cancel()
+
+	now := time.Now()
+	due, err := p.finalizer.paymentRepo.FindDueForQuery(ctx, now, p.batchSize)
+	if err != nil {
+		p.logger.Error("failed to list payments due for query", "error", err)
+		return
+	}
+
+	finalized := 0
+	for _, payment := range due {
+		// 先推进查询计划再查询：抢占失败说明其他实例已在处理，查询失败则按退避计划自然重试
+		claimed, err := p.finalizer.paymentRepo.ClaimQuery(ctx, payment, payment.NextQueryTime(now))
+		if err != nil {
+			p.logger.Error("failed to claim payment query", "payment_no", payment.PaymentNo, "error", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		done, err := p.query(ctx, payment, now)
+		if err != nil {
+			p.logger.Warn("payment status query failed", "payment_no", payment.PaymentNo, "attempts", payment.QueryAttempts, "error", err)
+			continue
+		}
+		if done {
+			finalized++
+		}
+	}
+	if finalized > 0 {
+		p.logger.Info("payments finalized by status query", "count", finalized)
+	}
+}
+
+// query 查询单笔支付的渠道状态并推进，返回支付单是否已进入终态。
+func (p *PaymentStatusPoller) query(ctx context.Context, payment *domain.Payment, now time.Time) (bool, error) {
+	gateway, err := p.gateways.ForPayment(ctx, payment)
+	if err != nil {
+		return false, err
+	}
+	result, err := gateway.QueryTrade(ctx, payment.TradeOf())
+	if err != nil {
+		return false, err
+	}
+
+	switch result.State {
+	case domain.GatewayTradePending:
+		if !payment.Expired(now) {
+			return false, nil
+		}
+	case domain.GatewayTradeAuthorized:
+		// 渠道已冻结资金等待扣款：按渠道授权有效期而非待支付有效期释放
+		if !payment.AuthorizationExpired(now) {
+			return false, nil
+		}
+	default:
+		if err := p.finalizer.finalize(ctx, result.Notification(payment.GatewayType, payment.PaymentNo)); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err := p.expire(ctx, gateway, payment); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// expire 在渠道侧关闭超时交易后取消支付单并发布 payment.closed 事件。关闭失败 (如用户恰好完成支付) 时保留待支付状态，下次查询将得到真实结果。
+func (p *PaymentStatusPoller) expire(ctx context.Context, gateway domain.PaymentGateway, payment *domain.Payment) error {
+	if err := gateway.Void(ctx, payment.TradeOf()); err != nil {
+		return err
+	}
+	err := p.finalizer.withPaymentLock(ctx, payment.PaymentNo, func(txRepo domain.PaymentRepository, tx any, current *domain.Payment) error {
+		// 关闭期间可能已收到支付通知，以事务内最新状态为准
+		if !current.AwaitingResult() {
+			return nil
+		}
+		if err := current.Expire(ctx); err != nil {
+			return err
+		}
+		if err := p.finalizer.ledger.voidLegs(ctx, tx, current, current.FailureReason); err != nil {
+			return err
+		}
+		if err := txRepo.Update(ctx, current); err != nil {
+			return err
+		}
+		if err := txRepo.SaveLegs(ctx, current.Legs); err != nil {
+			return err
+		}
+
+		event := paymentEvent(current)
+		event["reason"] = current.FailureReason
+		event["closed_at"] = current.CancelledAt.Unix()
+		return p.finalizer.outboxMgr.PublishInTx(ctx, tx.(*gorm.DB), "payment.closed", current.PaymentNo, event)
+	})
+	if err != nil {
+		return err
+	}
+	p.logger.Info("expired payment closed at gateway", "payment_no", payment.PaymentNo, "expires_at", payment.ExpiresAt)
+	return nil
+}
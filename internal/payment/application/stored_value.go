@@ -0,0 +1,169 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// SplitConfig 组合支付配置。
+type SplitConfig struct {
+	RefundOrder []string `mapstructure:"refund_order"` // 退款分摊的来源优先级，为空时使用默认顺序
+}
+
+// refundOrder 解析退款分摊顺序。
+func (c SplitConfig) refundOrder() []domain.LegSource {
+	if len(c.RefundOrder) == 0 {
+		return domain.DefaultRefundOrder
+	}
+	order := make([]domain.LegSource, 0, len(c.RefundOrder))
+	for _, src := range c.RefundOrder {
+		order = append(order, domain.LegSource(src))
+	}
+	return order
+}
+
+// StoredValueLedger 站内储值账本：积分、礼品卡余额、券包余额。
+// 储值腿的冻结、扣减与解冻均在支付单所在分片的事务内完成，与支付单状态变更同时提交。
+type StoredValueLedger struct {
+	repo   domain.StoredValueRepository
+	logger *slog.Logger
+}
+
+// NewStoredValueLedger 创建储值账本。
+func NewStoredValueLedger(repo domain.StoredValueRepository, logger *slog.Logger) *StoredValueLedger {
+	return &StoredValueLedger{repo: repo, logger: logger}
+}
+
+// Balances 查询用户全部储值账户余额。
+func (l *StoredValueLedger) Balances(ctx context.Context, userID uint64) ([]*domain.StoredValueAccount, error) {
+	return l.repo.ListAccounts(ctx, userID)
+}
+
+// Grant 向储值账户入账 (礼品卡充值、积分发放等)，账户不存在时自动开户。
+func (l *StoredValueLedger) Grant(ctx context.Context, userID uint64, source domain.LegSource, currency string, amount int64, refNo, remark string) (*domain.StoredValueAccount, error) {
+	if !source.Internal() {
+		return nil, fmt.Errorf("%w: %q is not a stored-value source", domain.ErrInvalidLegs, source)
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("grant amount must be positive")
+	}
+	currency = domain.NormalizeCurrency(currency)
+	if !domain.IsSupportedCurrency(currency) {
+		return nil, fmt.Errorf("%w: %s", domain.ErrUnsupportedCurrency, currency)
+	}
+
+	var account *domain.StoredValueAccount
+	err := l.repo.Transaction(ctx, userID, func(tx any) error {
+		var err error
+		account, err = l.post(ctx, l.repo.WithTx(tx), userID, source, currency, domain.StoredValueCredit, amount, refNo, remark)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.logger.InfoContext(ctx, "stored value granted", "user_id", userID, "source", source, "amount", amount, "ref_no", refNo)
+	return account, nil
+}
+
+// holdLegs 冻结支付单全部储值腿，任一来源余额不足时返回 ErrInsufficientBalance，由调用方回滚事务。
+func (l *StoredValueLedger) holdLegs(ctx context.Context, tx any, p *domain.Payment) error {
+	repo := l.repo.WithTx(tx)
+	for _, leg := range p.InternalLegs() {
+		if _, err := l.post(ctx, repo, p.UserID, leg.Source, domain.NormalizeCurrency(p.Currency), domain.StoredValueHold, leg.Amount, leg.LegNo, p.PaymentNo); err != nil {
+			return err
+		}
+		leg.Authorize("")
+	}
+	return nil
+}
+
+// captureLegs 扣减已冻结的储值腿。
+func (l *StoredValueLedger) captureLegs(ctx context.Context, tx any, p *domain.Payment) error {
+	repo := l.repo.WithTx(tx)
+	for _, leg := range p.InternalLegs() {
+		if leg.Status != domain.LegAuthorized {
+			continue
+		}
+		if _, err := l.post(ctx, repo, p.UserID, leg.Source, domain.NormalizeCurrency(p.Currency), domain.StoredValueDebit, leg.Amount, leg.LegNo, p.PaymentNo); err != nil {
+			return err
+		}
+		leg.Capture()
+	}
+	return nil
+}
+
+// voidLegs 撤销储值腿并解冻金额，作为渠道授权失败、支付失败或超时关闭时的补偿。
+func (l *StoredValueLedger) voidLegs(ctx context.Context, tx any, p *domain.Payment, reason string) error {
+	repo := l.repo.WithTx(tx)
+	for _, leg := range p.InternalLegs() {
+		switch leg.Status {
+		case domain.LegAuthorized:
+			if _, err := l.post(ctx, repo, p.UserID, leg.Source, domain.NormalizeCurrency(p.Currency), domain.StoredValueRelease, leg.Amount, leg.LegNo, reason); err != nil {
+				return err
+			}
+			leg.Void(reason)
+		case domain.LegPending:
+			leg.Void(reason)
+		}
+	}
+	return nil
+}
+
+// creditAllocations 将退款成功的储值分摊退回储值账户。
+func (l *StoredValueLedger) creditAllocations(ctx context.Context, tx any, p *domain.Payment, refundNo string, allocations []*domain.RefundAllocation) error {
+	repo := l.repo.WithTx(tx)
+	for _, a := range allocations {
+		if _, err := l.post(ctx, repo, p.UserID, a.Source, domain.NormalizeCurrency(p.Currency), domain.StoredValueCredit, a.Amount, refundNo, p.PaymentNo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// post 加锁读取账户、变更余额并写入流水。入账时账户不存在则开户，其余操作要求账户已存在。
+func (l *StoredValueLedger) post(ctx context.Context, repo domain.StoredValueRepository, userID uint64, source domain.LegSource, currency string, typ domain.StoredValueEntryType, amount int64, refNo, remark string) (*domain.StoredValueAccount, error) {
+	account, err := repo.FindAccount(ctx, userID, source, currency)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		if typ != domain.StoredValueCredit {
+			return nil, fmt.Errorf("%w: no %s account in %s", domain.ErrInsufficientBalance, source, currency)
+		}
+		account = &domain.StoredValueAccount{UserID: userID, Source: source, Currency: currency}
+	}
+
+	switch typ {
+	case domain.StoredValueHold:
+		err = account.Hold(amount)
+	case domain.StoredValueRelease:
+		err = account.Release(amount)
+	case domain.StoredValueDebit:
+		err = account.Debit(amount)
+	case domain.StoredValueCredit:
+		account.Credit(amount)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.SaveAccount(ctx, account); err != nil {
+		return nil, err
+	}
+	entry := &domain.StoredValueEntry{
+		AccountID:    uint64(account.ID),
+		UserID:       userID,
+		Type:         typ,
+		RefNo:        refNo,
+		Amount:       amount,
+		BalanceAfter: account.Balance,
+		FrozenAfter:  account.Frozen,
+		Remark:       remark,
+	}
+	if err := repo.SaveEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
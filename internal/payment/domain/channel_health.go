@@ -0,0 +1,139 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoHealthyChannel 受理该笔支付的渠道均处于熔断状态。
+var ErrNoHealthyChannel = errors.New("no healthy payment channel")
+
+// ChannelOutcome 渠道调用结果。
+type ChannelOutcome string
+
+const (
+	ChannelOutcomeSuccess ChannelOutcome = "SUCCESS" // 调用成功
+	ChannelOutcomeFailure ChannelOutcome = "FAILURE" // 渠道不可用或配置错误，计入健康度
+	ChannelOutcomeReject  ChannelOutcome = "REJECT"  // 单笔请求被业务拒绝，不反映渠道健康
+)
+
+// OutcomeOf 将渠道调用错误归类为调用结果。
+func OutcomeOf(err error) ChannelOutcome {
+	switch {
+	case err == nil:
+		return ChannelOutcomeSuccess
+	case errors.Is(err, ErrGatewayRejected):
+		return ChannelOutcomeReject
+	default:
+		return ChannelOutcomeFailure
+	}
+}
+
+// BreakerState 渠道熔断器状态。
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "CLOSED"    // 正常路由
+	BreakerOpen     BreakerState = "OPEN"      // 熔断中，不参与路由
+	BreakerHalfOpen BreakerState = "HALF_OPEN" // 熔断到期，仅放行探测请求
+)
+
+// BreakerStatus 熔断器持久化状态，多副本共享。
+type BreakerStatus struct {
+	State     BreakerState `json:"state"`
+	OpenUntil time.Time    `json:"open_until"`
+	Trips     int          `json:"trips"` // 连续熔断次数，用于熔断时长退避
+}
+
+// Effective 返回当前生效状态：熔断到期后为半开。
+func (s BreakerStatus) Effective(now time.Time) BreakerState {
+	if s.State == BreakerOpen && !now.Before(s.OpenUntil) {
+		return BreakerHalfOpen
+	}
+	if s.State == "" {
+		return BreakerClosed
+	}
+	return s.State
+}
+
+// ChannelHealth 渠道在滑动窗口内的健康度。
+type ChannelHealth struct {
+	ChannelCode string        `json:"channel_code"`
+	Window      time.Duration `json:"window"`
+	Success     int64         `json:"success"`
+	Failure     int64         `json:"failure"`
+	Reject      int64         `json:"reject"`
+	LatencyP50  time.Duration `json:"latency_p50"`
+	LatencyP95  time.Duration `json:"latency_p95"`
+	LatencyP99  time.Duration `json:"latency_p99"`
+	Breaker     BreakerStatus `json:"breaker"`
+}
+
+// Total 计入健康度的调用次数 (不含业务拒绝)。
+func (h *ChannelHealth) Total() int64 {
+	return h.Success + h.Failure
+}
+
+// FailureRate 窗口内失败率，无调用时为 0。
+func (h *ChannelHealth) FailureRate() float64 {
+	if h.Total() == 0 {
+		return 0
+	}
+	return float64(h.Failure) / float64(h.Total())
+}
+
+// SuccessRate 平滑后的成功率 (success+1)/(total+2)，样本不足的渠道不会因个别失败被过度惩罚。
+func (h *ChannelHealth) SuccessRate() float64 {
+	return float64(h.Success+1) / float64(h.Total()+2)
+}
+
+// CircuitBreakerPolicy 渠道熔断策略：窗口内调用数达到 MinRequests 且失败率达到阈值时熔断，
+// 熔断到期后半开放行单个探测请求，探测成功则恢复，失败则按连续熔断次数加倍熔断时长。
+type CircuitBreakerPolicy struct {
+	MinRequests          int64
+	FailureRateThreshold float64
+	OpenDuration         time.Duration
+	MaxOpenDuration      time.Duration
+}
+
+// Evaluate 根据最新调用结果推进熔断器状态，返回新状态与是否发生变化。
+// health 为计入本次结果后的窗口健康度；业务拒绝不影响熔断器。
+func (p CircuitBreakerPolicy) Evaluate(status BreakerStatus, health *ChannelHealth, outcome ChannelOutcome, now time.Time) (BreakerStatus, bool) {
+	if outcome == ChannelOutcomeReject {
+		return status, false
+	}
+	switch status.Effective(now) {
+	case BreakerHalfOpen:
+		if outcome == ChannelOutcomeSuccess {
+			return BreakerStatus{State: BreakerClosed}, true
+		}
+		return p.trip(status, now), true
+	case BreakerClosed:
+		if health.Total() >= p.MinRequests && health.FailureRate() >= p.FailureRateThreshold {
+			return p.trip(status, now), true
+		}
+	}
+	// 熔断期间仍在途的请求结果不改变状态
+	return status, false
+}
+
+func (p CircuitBreakerPolicy) trip(status BreakerStatus, now time.Time) BreakerStatus {
+	duration := p.OpenDuration << min(status.Trips, 4)
+	if p.MaxOpenDuration > 0 && duration > p.MaxOpenDuration {
+		duration = p.MaxOpenDuration
+	}
+	return BreakerStatus{State: BreakerOpen, OpenUntil: now.Add(duration), Trips: status.Trips + 1}
+}
+
+// ChannelHealthStore 渠道健康度存储，多副本共享滑动窗口统计与熔断器状态。
+type ChannelHealthStore interface {
+	// Record 记录一次渠道调用结果与耗时
+	Record(ctx context.Context, channelCode string, outcome ChannelOutcome, latency time.Duration, at time.Time) error
+	// Health 批量查询渠道当前窗口的健康度与熔断器状态
+	Health(ctx context.Context, channelCodes []string, now time.Time) (map[string]*ChannelHealth, error)
+	// SaveBreaker 保存熔断器状态，resetWindow 为 true 时清空窗口统计 (熔断恢复后重新计数)
+	SaveBreaker(ctx context.Context, channelCode string, status BreakerStatus, resetWindow bool) error
+	// TryProbe 为半开渠道抢占探测名额，ttl 内同一渠道只放行一个探测请求
+	TryProbe(ctx context.Context, channelCode string, ttl time.Duration) (bool, error)
+}
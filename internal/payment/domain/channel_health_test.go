@@ -0,0 +1,165 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestOutcomeOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ChannelOutcome
+	}{
+		{err: nil, want: ChannelOutcomeSuccess},
+		{err: fmt.Errorf("card declined: %w", ErrGatewayRejected), want: ChannelOutcomeReject},
+		{err: errors.New("connection reset"), want: ChannelOutcomeFailure},
+	}
+	for _, tt := range tests {
+		if got := OutcomeOf(tt.err); got != tt.want {
+			t.Errorf("OutcomeOf(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBreakerStatusEffective(t *testing.T) {
+	now := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status BreakerStatus
+		want   BreakerState
+	}{
+		{name: "unset", status: BreakerStatus{}, want: BreakerClosed},
+		{name: "closed", status: BreakerStatus{State: BreakerClosed}, want: BreakerClosed},
+		{name: "open", status: BreakerStatus{State: BreakerOpen, OpenUntil: now.Add(time.Second)}, want: BreakerOpen},
+		{name: "open expired", status: BreakerStatus{State: BreakerOpen, OpenUntil: now}, want: BreakerHalfOpen},
+	}
+	for _, tt := range tests {
+		if got := tt.status.Effective(now); got != tt.want {
+			t.Errorf("%s: Effective() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCircuitBreakerPolicyEvaluate(t *testing.T) {
+	now := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	policy := CircuitBreakerPolicy{MinRequests: 20, FailureRateThreshold: 0.5, OpenDuration: 30 * time.Second, MaxOpenDuration: 5 * time.Minute}
+	open := func(trips int) BreakerStatus {
+		return BreakerStatus{State: BreakerOpen, OpenUntil: now.Add(time.Minute), Trips: trips}
+	}
+	halfOpen := func(trips int) BreakerStatus {
+		return BreakerStatus{State: BreakerOpen, OpenUntil: now.Add(-time.Second), Trips: trips}
+	}
+	tripped := func(d time.Duration, trips int) BreakerStatus {
+		return BreakerStatus{State: BreakerOpen, OpenUntil: now.Add(d), Trips: trips}
+	}
+	tests := []struct {
+		name        string
+		policy      CircuitBreakerPolicy
+		status      BreakerStatus
+		health      ChannelHealth
+		outcome     ChannelOutcome
+		want        BreakerStatus
+		wantChanged bool
+	}{
+		{
+			name:    "reject ignored",
+			status:  halfOpen(1),
+			outcome: ChannelOutcomeReject,
+			want:    halfOpen(1),
+		},
+		{
+			name:    "closed below min requests",
+			status:  BreakerStatus{State: BreakerClosed},
+			health:  ChannelHealth{Failure: 19},
+			outcome: ChannelOutcomeFailure,
+			want:    BreakerStatus{State: BreakerClosed},
+		},
+		{
+			name:    "closed below failure rate",
+			status:  BreakerStatus{State: BreakerClosed},
+			health:  ChannelHealth{Success: 11, Failure: 9, Reject: 30},
+			outcome: ChannelOutcomeFailure,
+			want:    BreakerStatus{State: BreakerClosed},
+		},
+		{
+			name:        "closed trips at threshold",
+			status:      BreakerStatus{State: BreakerClosed},
+			health:      ChannelHealth{Success: 10, Failure: 10},
+			outcome:     ChannelOutcomeFailure,
+			want:        tripped(30*time.Second, 1),
+			wantChanged: true,
+		},
+		{
+			name:    "open ignores in-flight results",
+			status:  open(2),
+			health:  ChannelHealth{Failure: 50},
+			outcome: ChannelOutcomeFailure,
+			want:    open(2),
+		},
+		{
+			name:        "half-open probe success closes",
+			status:      halfOpen(3),
+			health:      ChannelHealth{Success: 1, Failure: 40},
+			outcome:     ChannelOutcomeSuccess,
+			want:        BreakerStatus{State: BreakerClosed},
+			wantChanged: true,
+		},
+		{
+			name:        "half-open probe failure doubles open duration",
+			status:      halfOpen(1),
+			outcome:     ChannelOutcomeFailure,
+			want:        tripped(60*time.Second, 2),
+			wantChanged: true,
+		},
+		{
+			name:        "third trip",
+			status:      halfOpen(2),
+			outcome:     ChannelOutcomeFailure,
+			want:        tripped(120*time.Second, 3),
+			wantChanged: true,
+		},
+		{
+			name:        "capped at max open duration",
+			status:      halfOpen(4), // 30s << 4 = 8m
+			outcome:     ChannelOutcomeFailure,
+			want:        tripped(5*time.Minute, 5),
+			wantChanged: true,
+		},
+		{
+			name:        "backoff exponent is bounded",
+			policy:      CircuitBreakerPolicy{OpenDuration: 30 * time.Second},
+			status:      halfOpen(40),
+			outcome:     ChannelOutcomeFailure,
+			want:        tripped(8*time.Minute, 41),
+			wantChanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := policy
+			if tt.policy.OpenDuration != 0 {
+				p = tt.policy
+			}
+			got, changed := p.Evaluate(tt.status, &tt.health, tt.outcome, now)
+			if changed != tt.wantChanged {
+				t.Fatalf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if got.State != tt.want.State || !got.OpenUntil.Equal(tt.want.OpenUntil) || got.Trips != tt.want.Trips {
+				t.Fatalf("Evaluate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelHealthRates(t *testing.T) {
+	h := &ChannelHealth{Success: 6, Failure: 2, Reject: 5}
+	if h.Total() != 8 || h.FailureRate() != 0.25 || h.SuccessRate() != 0.7 {
+		t.Fatalf("total %d, failure rate %v, success rate %v, want 8, 0.25, 0.7", h.Total(), h.FailureRate(), h.SuccessRate())
+	}
+	empty := &ChannelHealth{}
+	if empty.FailureRate() != 0 || empty.SuccessRate() != 0.5 {
+		t.Fatalf("empty failure rate %v, success rate %v, want 0, 0.5", empty.FailureRate(), empty.SuccessRate())
+	}
+}
@@ -0,0 +1,124 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// DefaultCurrency 未指定币种时的交易币种，亦为默认结算币种。
+const DefaultCurrency = "CNY"
+
+var (
+	ErrUnsupportedCurrency  = errors.New("unsupported currency")                     // 币种不在受理范围内
+	ErrFXRateUnavailable    = errors.New("fx rate unavailable")                      // 无可用汇率或汇率已过期
+	ErrNoChannelForCurrency = errors.New("no payment channel supports the currency") // 启用渠道均不支持该币种
+)
+
+// currencyExponents 受理币种及其最小货币单位的小数位数。金额字段均以最小货币单位存储。
+var currencyExponents = map[string]int32{
+	"CNY": 2,
+	"USD": 2,
+	"EUR": 2,
+	"HKD": 2,
+}
+
+// NormalizeCurrency 将币种规范为 ISO 4217 大写代码，空值视为默认币种。
+func NormalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
+
+// IsSupportedCurrency 币种是否在受理范围内。
+func IsSupportedCurrency(currency string) bool {
+	_, ok := currencyExponents[currency]
+	return ok
+}
+
+// ConvertAmount 按汇率将最小货币单位金额从 from 折算为 to，四舍五入到目标币种最小单位。
+func ConvertAmount(amount int64, from, to string, rate decimal.Decimal) int64 {
+	converted := decimal.NewFromInt(amount).Mul(rate)
+	if shift := currencyExponents[to] - currencyExponents[from]; shift != 0 {
+		converted = converted.Shift(shift)
+	}
+	return converted.Round(0).IntPart()
+}
+
+// FXRate 财务维护的牌价，1 单位 BaseCurrency 兑换 Rate 单位 QuoteCurrency。
+type FXRate struct {
+	gorm.Model
+	BaseCurrency  string          `gorm:"size:10;not null;uniqueIndex:idx_fx_pair" json:"base_currency"`
+	QuoteCurrency string          `gorm:"size:10;not null;uniqueIndex:idx_fx_pair" json:"quote_currency"`
+	Rate          decimal.Decimal `gorm:"type:decimal(18,8);not null" json:"rate"`
+	Source        string          `gorm:"size:64" json:"source"` // 牌价来源，如银行或清算机构
+	EffectiveAt   time.Time       `gorm:"not null" json:"effective_at"`
+}
+
+// Stale 牌价生效时间距 now 是否超过 maxAge。
+func (r *FXRate) Stale(now time.Time, maxAge time.Duration) bool {
+	return maxAge > 0 && now.Sub(r.EffectiveAt) > maxAge
+}
+
+// FXSnapshot 汇率快照，记录折算所用的汇率及其来源，落库后不再随牌价变动。
+type FXSnapshot struct {
+	Rate     decimal.Decimal `gorm:"type:decimal(18,8)" json:"rate"`
+	Source   string          `gorm:"size:64" json:"source"`
+	QuotedAt *time.Time      `json:"quoted_at"`
+}
+
+// ParSnapshot 交易币种与结算币种相同时的 1:1 快照。
+func ParSnapshot(now time.Time) FXSnapshot {
+	return FXSnapshot{Rate: decimal.NewFromInt(1), Source: "PAR", QuotedAt: &now}
+}
+
+// SnapshotOf 由牌价生成快照。
+func SnapshotOf(rate *FXRate, now time.Time) FXSnapshot {
+	return FXSnapshot{Rate: rate.Rate, Source: rate.Source, QuotedAt: &now}
+}
+
+// LockFX 发起支付时锁定汇率快照，并按快照折算结算币种金额。
+func (p *Payment) LockFX(settlementCurrency string, snapshot FXSnapshot) {
+	p.SettlementCurrency = settlementCurrency
+	p.FX = snapshot
+	p.SettlementAmount = ConvertAmount(p.Amount, NormalizeCurrency(p.Currency), settlementCurrency, snapshot.Rate)
+}
+
+// RecordCapture 记录扣款金额，结算币种金额按锁定汇率折算。
+// 早于多币种改造的支付单未锁定汇率，按交易币种 1:1 补录快照。
+func (p *Payment) RecordCapture(amount int64) {
+	if p.FX.Rate.IsZero() {
+		p.LockFX(NormalizeCurrency(p.Currency), ParSnapshot(time.Now()))
+	}
+	p.CapturedAmount = amount
+	p.CapturedSettlementAmount = ConvertAmount(amount, NormalizeCurrency(p.Currency), p.SettlementCurrency, p.FX.Rate)
+}
+
+// RecordSettlement 记录渠道入账：交易币种金额为扣款金额，结算币种金额按入账时汇率折算。
+// snapshot 为 nil 时沿用锁定汇率，不产生汇兑损益。须在 RecordCapture 之后调用。
+func (p *Payment) RecordSettlement(snapshot *FXSnapshot) {
+	if snapshot == nil {
+		snapshot = &p.FX
+	}
+	p.SettledAmount = p.CapturedAmount
+	p.SettleFX = *snapshot
+	p.SettledSettlementAmount = ConvertAmount(p.SettledAmount, NormalizeCurrency(p.Currency), p.SettlementCurrency, snapshot.Rate)
+}
+
+// FXGainLoss 汇兑损益 (结算币种)，入账金额高于按锁定汇率折算的扣款金额为收益，反之为损失。
+func (p *Payment) FXGainLoss() int64 {
+	return p.SettledSettlementAmount - p.CapturedSettlementAmount
+}
+
+// FXRateRepository 牌价仓储。
+type FXRateRepository interface {
+	FindRate(ctx context.Context, baseCurrency, quoteCurrency string) (*FXRate, error)
+	SaveRate(ctx context.Context, rate *FXRate) error
+	ListRates(ctx context.Context) ([]*FXRate, error)
+}
@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestConvertAmount(t *testing.T) {
+	// 受理币种均为两位小数，临时登记日元以覆盖小数位数不同的折算
+	currencyExponents["JPY"] = 0
+	t.Cleanup(func() { delete(currencyExponents, "JPY") })
+
+	tests := []struct {
+		name     string
+		amount   int64
+		from, to string
+		rate     string
+		want     int64
+	}{
+		{name: "par", amount: 12345, from: "CNY", to: "CNY", rate: "1", want: 12345},
+		{name: "round up", amount: 1999, from: "USD", to: "CNY", rate: "7.1234", want: 14240},          // 14239.6766
+		{name: "round down", amount: 1000, from: "USD", to: "CNY", rate: "7.1234", want: 7123},         // 7123.4
+		{name: "half away from zero", amount: 1, from: "USD", to: "CNY", rate: "0.5", want: 1},         // 0.5
+		{name: "below half", amount: 1, from: "USD", to: "CNY", rate: "0.49999999", want: 0},           // 0.49999999
+		{name: "negative half", amount: -1, from: "USD", to: "CNY", rate: "0.5", want: -1},             // -0.5
+		{name: "to more decimals", amount: 10000, from: "JPY", to: "CNY", rate: "0.0483", want: 48300}, // 10000 日元 = 483 元
+		{name: "to fewer decimals", amount: 100, from: "CNY", to: "JPY", rate: "20.7", want: 21},       // 1 元 = 20.7 日元
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ConvertAmount(tt.amount, tt.from, tt.to, decimal.RequireFromString(tt.rate))
+			if got != tt.want {
+				t.Fatalf("ConvertAmount(%d, %s, %s, %s) = %d, want %d", tt.amount, tt.from, tt.to, tt.rate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockFX(t *testing.T) {
+	p := &Payment{Amount: 10000, Currency: "usd"}
+	p.LockFX("CNY", FXSnapshot{Rate: decimal.RequireFromString("7.1234"), Source: "BOC"})
+	if p.SettlementCurrency != "CNY" || p.SettlementAmount != 71234 || p.FX.Source != "BOC" {
+		t.Fatalf("LockFX() = %s %d via %s, want CNY 71234 via BOC", p.SettlementCurrency, p.SettlementAmount, p.FX.Source)
+	}
+
+	p.RecordCapture(9999)
+	if p.CapturedAmount != 9999 || p.CapturedSettlementAmount != 71227 { // 71226.8766
+		t.Fatalf("RecordCapture() = %d/%d, want 9999/71227", p.CapturedAmount, p.CapturedSettlementAmount)
+	}
+}
+
+func TestRecordCaptureWithoutLockedFX(t *testing.T) {
+	// 早于多币种改造的支付单按交易币种 1:1 补录快照
+	p := &Payment{Amount: 5000, Currency: "hkd"}
+	p.RecordCapture(5000)
+	if p.SettlementCurrency != "HKD" || p.FX.Source != "PAR" || !p.FX.Rate.Equal(decimal.NewFromInt(1)) || p.FX.QuotedAt == nil {
+		t.Fatalf("snapshot = %s %+v, want HKD par snapshot", p.SettlementCurrency, p.FX)
+	}
+	if p.SettlementAmount != 5000 || p.CapturedSettlementAmount != 5000 {
+		t.Fatalf("settlement amounts = %d/%d, want 5000/5000", p.SettlementAmount, p.CapturedSettlementAmount)
+	}
+}
+
+func TestFXGainLoss(t *testing.T) {
+	quotedAt := time.Now()
+	tests := []struct {
+		name       string
+		settleRate string // 为空时沿用锁定汇率
+		want       int64
+	}{
+		{name: "locked rate", want: 0},
+		{name: "same rate", settleRate: "7.1234", want: 0},
+		{name: "gain", settleRate: "7.2000", want: 766},    // 72000 - 71234
+		{name: "loss", settleRate: "7.0500", want: -734},   // 70500 - 71234
+		{name: "rounding", settleRate: "7.12345", want: 1}, // 71234.5 进位
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Payment{Amount: 10000, Currency: "USD"}
+			p.LockFX("CNY", FXSnapshot{Rate: decimal.RequireFromString("7.1234"), Source: "BOC", QuotedAt: &quotedAt})
+			p.RecordCapture(10000)
+
+			var snapshot *FXSnapshot
+			if tt.settleRate != "" {
+				snapshot = &FXSnapshot{Rate: decimal.RequireFromString(tt.settleRate), Source: "CHANNEL", QuotedAt: &quotedAt}
+			}
+			p.RecordSettlement(snapshot)
+			if p.SettledAmount != 10000 {
+				t.Fatalf("SettledAmount = %d, want 10000", p.SettledAmount)
+			}
+			if got := p.FXGainLoss(); got != tt.want {
+				t.Fatalf("FXGainLoss() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 网关错误分类。路由引擎据此区分渠道健康问题与单笔请求被拒。
+var (
+	ErrGatewayUnavailable   = errors.New("payment gateway temporarily unavailable") // 网络、超时、渠道系统繁忙或限流，可重试
+	ErrGatewayRejected      = errors.New("payment gateway rejected request")        // 业务拒绝 (参数、余额、交易状态等)，重试无意义
+	ErrGatewayMisconfigured = errors.New("payment gateway misconfigured")           // 凭据、签名或权限错误，需人工修正渠道配置
+)
+
+// GatewayError 渠道返回的错误，Kind 为上述分类之一。
+type GatewayError struct {
+	Gateway GatewayType
+	Code    string // 渠道错误码 (如 ACQ.SYSTEM_ERROR、PARAM_ERROR、card_declined)
+	Message string
+	Kind    error
+}
+
+func (e *GatewayError) Error() string {
+	return fmt.Sprintf("%s gateway error %s: %s", e.Gateway, e.Code, e.Message)
+}
+
+func (e *GatewayError) Unwrap() error { return e.Kind }
+
+// NewGatewayError 创建网关错误。
+func NewGatewayError(gateway GatewayType, kind error, code, message string) *GatewayError {
+	return &GatewayError{Gateway: gateway, Code: code, Message: message, Kind: kind}
+}
+
+// IsRetryableGatewayError 错误是否为可重试的渠道临时故障。
+func IsRetryableGatewayError(err error) bool {
+	return errors.Is(err, ErrGatewayUnavailable)
+}
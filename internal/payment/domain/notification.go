@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupportedNotifyGateway = errors.New("no notification verifier for gateway") // 未配置该渠道的回调验签器
+	ErrInvalidNotifySignature   = errors.New("invalid notification signature")       // 回调签名、证书或时间戳校验失败
+	ErrNotifyMerchantMismatch   = errors.New("notification merchant mismatch")       // 回调商户号/应用号与本方配置不符
+	ErrNotifyAmountMismatch     = errors.New("notification amount mismatch")         // 回调金额或币种与支付单不符
+)
+
+// NotifyRequest 支付渠道异步通知的原始 HTTP 报文。
+// 验签必须基于原始字节，不得先解析再序列化。
+type NotifyRequest struct {
+	Headers map[string]string // 请求头，键为规范化格式 (如 "Wechatpay-Signature")
+	Body    []byte            // 原始请求体
+}
+
+// Header 大小写不敏感地读取请求头。
+func (r *NotifyRequest) Header(key string) string {
+	if v, ok := r.Headers[key]; ok {
+		return v
+	}
+	for k, v := range r.Headers {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// NotifyResult 渠道通知中的交易结果。
+type NotifyResult int
+
+const (
+	NotifyResultPending NotifyResult = iota // 交易未终结 (如等待买家付款)，仅应答不处理
+	NotifyResultSuccess                     // 支付成功
+	NotifyResultFailed                      // 支付失败或交易关闭
+)
+
+// PaymentNotification 验签通过后的支付结果通知。
+type PaymentNotification struct {
+	Gateway       GatewayType
+	NotifyID      string       // 渠道通知 ID
+	PaymentNo     string       // 本方支付单号 (out_trade_no / metadata.payment_no)
+	TransactionID string       // 渠道交易号
+	Result        NotifyResult // 交易结果
+	Amount        int64        // 通知金额 (最小货币单位)
+	Currency      string       // 币种 (ISO 4217 大写)
+	MerchantID    string       // 收款商户号 / 应用号
+	RawPayload    string       // 验签通过的原始报文 (加密通知为解密后的明文)
+	Queried       bool         // 由主动查询渠道得到，而非渠道推送
+}
+
+// NotificationVerifier 支付渠道异步通知的验签与解析器。
+// 实现负责校验签名与本方商户身份，金额与币种由支付单校验。
+type NotificationVerifier interface {
+	Gateway() GatewayType
+	Verify(ctx context.Context, req *NotifyRequest) (*PaymentNotification, error)
+}
+
+// VerifyNotification 校验通知与支付单的渠道、金额、币种是否一致。
+func (p *Payment) VerifyNotification(n *PaymentNotification) error {
+	if p.GatewayType != "" && p.GatewayType != n.Gateway {
+		return fmt.Errorf("%w: payment gateway %s, notified by %s", ErrNotifyMerchantMismatch, p.GatewayType, n.Gateway)
+	}
+	// 组合支付的渠道只受理渠道腿金额
+	if expected := p.GatewayAmount(); n.Amount != expected {
+		return fmt.Errorf("%w: expected %d, notified %d", ErrNotifyAmountMismatch, expected, n.Amount)
+	}
+	currency := p.Currency
+	if currency == "" {
+		currency = "CNY"
+	}
+	if !strings.EqualFold(n.Currency, currency) {
+		return fmt.Errorf("%w: expected currency %s, notified %s", ErrNotifyAmountMismatch, currency, n.Currency)
+	}
+	return nil
+}
+
+// ApplyNotification 按通知结果推进支付状态，并记录渠道交易号与验签后的原始报文。
+// 返回 false 表示支付单已处于终态或通知未终结，无需持久化。
+func (p *Payment) ApplyNotification(ctx context.Context, n *PaymentNotification) (bool, error) {
+	if n.Result == NotifyResultPending {
+		return false, nil
+	}
+	if p.Status != PaymentPending && p.Status != PaymentAuthorized {
+		return false, nil
+	}
+
+	source := "Gateway notified"
+	if n.Queried {
+		source = "Gateway query confirmed"
+	}
+	var event, remark string
+	switch {
+	case n.Result == NotifyResultSuccess && p.Status == PaymentAuthorized:
+		event, remark = "CAPTURE", source+" payment success"
+	case n.Result == NotifyResultSuccess:
+		event, remark = "PAY_DIRECT", source+" payment success"
+	case p.Status == PaymentAuthorized:
+		event, remark = "VOID", source+" payment failure"
+	default:
+		event, remark = "CANCEL", source+" payment failure"
+	}
+	if err := p.Trigger(ctx, event, remark); err != nil {
+		return false, err
+	}
+
+	if n.TransactionID != "" {
+		p.TransactionID = n.TransactionID
+	}
+	p.CallbackData = n.RawPayload
+	p.NextQueryAt = nil
+	now := time.Now()
+	if n.Result == NotifyResultSuccess {
+		// 组合支付的扣款金额含储值腿，储值腿由应用层在同一事务内扣减
+		p.RecordCapture(p.Amount - p.GatewayAmount() + n.Amount)
+		p.settleGatewayLeg(true, n.TransactionID, "")
+		p.PaidAt = &now
+	} else {
+		p.FailureReason = "gateway notified failure"
+		if n.Queried {
+			p.FailureReason = "gateway trade closed"
+		}
+		p.settleGatewayLeg(false, "", p.FailureReason)
+		p.CancelledAt = &now
+	}
+	return true, nil
+}
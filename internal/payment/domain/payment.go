@@ -3,6 +3,7 @@ package domain
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/wyfcoding/pkg/fsm"
@@ -51,9 +52,10 @@ type Payment struct {
 	UserID         uint64      `gorm:"index"`
 	Amount         int64       `gorm:"not null"` // 总金额
 	CapturedAmount int64       `gorm:"default:0"`
-	Currency       string      `gorm:"size:10;default:'CNY'"`
+	Currency       string      `gorm:"size:10;default:'CNY'"` // 交易币种
 	PaymentMethod  string      `gorm:"size:32"`
 	GatewayType    GatewayType `gorm:"size:32"`
+	ChannelCode    string      `gorm:"size:32"` // 受理渠道编码，后续请求沿用同一商户账号
 	Status         PaymentStatus
 	TransactionID  string `gorm:"size:128"`
 	ThirdPartyNo   string `gorm:"size:128"`
@@ -62,23 +64,50 @@ type Payment struct {
 	PaidAt         *time.Time
 	CancelledAt    *time.Time
 	RefundedAt     *time.Time
+	ExpiresAt      *time.Time // 支付有效期，超时未支付则在渠道侧关闭
+	NextQueryAt    *time.Time `gorm:"index"` // 下一次主动查询渠道的时间，终态后置空
+	QueryAttempts  int        `gorm:"default:0"`
+
+	// 多币种：发起时锁定汇率快照，扣款与入账金额同时以交易币种和结算币种记录
+	SettlementCurrency       string     `gorm:"size:10;default:'CNY'"`
+	FX                       FXSnapshot `gorm:"embedded;embeddedPrefix:fx_"`        // 发起时锁定的汇率
+	SettlementAmount         int64      `gorm:"default:0"`                          // 总金额 (结算币种，按锁定汇率)
+	CapturedSettlementAmount int64      `gorm:"default:0"`                          // 扣款金额 (结算币种，按锁定汇率)
+	SettledAmount            int64      `gorm:"default:0"`                          // 渠道入账金额 (交易币种)
+	SettledSettlementAmount  int64      `gorm:"default:0"`                          // 渠道入账金额 (结算币种，按入账时汇率)
+	SettleFX                 FXSnapshot `gorm:"embedded;embeddedPrefix:settle_fx_"` // 入账时汇率
 
 	fsm     *fsm.Machine  `gorm:"-"`
 	Logs    []*PaymentLog `gorm:"foreignKey:PaymentID"`
 	Refunds []*Refund     `gorm:"foreignKey:PaymentID"`
 
 	// 世界级特性：分账信息 (用于平台抽佣、多商家结算)
-	Splits []PaymentSplit `gorm:"foreignKey:PaymentID"`
+	Splits     []*PaymentSplit `gorm:"foreignKey:PaymentID"`
+	SplitBasis string          `gorm:"type:text"` // 订单各商户商品金额 (JSON)，扣款时据此生成分账指令
+
+	// 组合支付：资金来源拆分为多条支付腿，单一方式支付为空
+	Legs []*PaymentLeg `gorm:"foreignKey:PaymentID"`
 }
 
 // PaymentSplit 定义了资金流向的拆分详情
 type PaymentSplit struct {
 	gorm.Model
-	PaymentID     uint64 `gorm:"index"`
-	RecipientID   uint64 `gorm:"index;comment:接收者ID(商家或平台)"`
-	RecipientType string `gorm:"size:32;comment:MERCHANT, PLATFORM, TAX"`
-	Amount        int64  `gorm:"not null"`
-	Status        string `gorm:"default:'PENDING';comment:PENDING, SETTLED"`
+	PaymentID        uint64     `gorm:"index"`
+	UserID           uint64     `gorm:"index"`
+	SplitNo          string     `gorm:"uniqueIndex;size:64;comment:分账单号，作为渠道分账幂等号"`
+	RecipientID      uint64     `gorm:"index;comment:接收者ID(商家或推广者，平台为0)"`
+	RecipientType    string     `gorm:"size:32;comment:MERCHANT, PLATFORM, PROMOTER"`
+	Amount           int64      `gorm:"not null;comment:分账金额(交易币种)"`
+	SettlementAmount int64      `gorm:"default:0;comment:分账金额(结算币种，按锁定汇率)"`
+	ReversedAmount   int64      `gorm:"default:0;comment:已随退款回退的金额(交易币种)"`
+	Mode             SplitMode  `gorm:"size:16;comment:GATEWAY, LEDGER"`
+	ReceiverAccount  string     `gorm:"size:64;comment:渠道分账接收账号"`
+	GatewayOrderID   string     `gorm:"size:128"`
+	Status           string     `gorm:"default:'PENDING';comment:PENDING, SETTLED"`
+	Attempts         int        `gorm:"default:0"`
+	NextAttemptAt    *time.Time `gorm:"index"`
+	FailureReason    string     `gorm:"size:255"`
+	SettledAt        *time.Time
 }
 
 // AccountingEntry 影子账本分录 (复式记账原则)
@@ -108,6 +137,8 @@ type Refund struct {
 	GatewayRefundID string `gorm:"size:128"`
 	FailureReason   string `gorm:"size:255"`
 	RefundedAt      *time.Time
+
+	Allocations []*RefundAllocation `gorm:"foreignKey:RefundID"` // 组合支付退款在各支付腿上的分摊
 }
 
 type PaymentLog struct {
@@ -120,17 +151,19 @@ type PaymentLog struct {
 	Remark    string `gorm:"size:255"`
 }
 
-func NewPayment(orderID uint64, orderNo string, userID uint64, amount int64, paymentMethod string, gatewayType GatewayType, idGenerator idgen.Generator) *Payment {
+func NewPayment(orderID uint64, orderNo string, userID uint64, amount int64, currency string, paymentMethod string, gatewayType GatewayType, idGenerator idgen.Generator) *Payment {
 	p := &Payment{
 		PaymentNo:     fmt.Sprintf("PAY%d", idGenerator.Generate()),
 		OrderID:       orderID,
 		OrderNo:       orderNo,
 		UserID:        userID,
 		Amount:        amount,
+		Currency:      currency,
 		PaymentMethod: paymentMethod,
 		GatewayType:   gatewayType,
 		Status:        PaymentPending,
 	}
+	p.ScheduleQuery(time.Now())
 	p.initFSM()
 	p.AddLog("INIT", "", PaymentPending.String(), "Payment created")
 	return p
@@ -151,6 +184,7 @@ func (p *Payment) initFSM() {
 	// 退款流
 	m.AddTransition(fsm.State(PaymentSuccess.String()), "REFUND_REQ", fsm.State(PaymentRefunding.String()))
 	m.AddTransition(fsm.State(PaymentRefunding.String()), "REFUND_FINISH", fsm.State(PaymentRefunded.String()))
+	m.AddTransition(fsm.State(PaymentRefunding.String()), "REFUND_FAIL", fsm.State(PaymentSuccess.String())) // 渠道退款失败，资金仍在商户侧
 
 	// 对账流
 	m.AddTransition(fsm.State(PaymentSuccess.String()), "RECONCILE", fsm.State(PaymentReconciled.String()))
@@ -221,9 +255,23 @@ type ChannelConfig struct {
 	Enabled     bool        `gorm:"default:true" json:"enabled"`
 	ConfigJSON  string      `gorm:"type:text" json:"config_json"`
 	RatePercent float64     `gorm:"type:decimal(5,2)" json:"rate_percent"`
+	Currencies  string      `gorm:"size:128" json:"currencies"` // 受理币种，逗号分隔；为空时仅受理默认币种
 	Description string      `gorm:"size:255" json:"description"`
 }
 
+// SupportsCurrency 渠道是否受理该币种。
+func (c *ChannelConfig) SupportsCurrency(currency string) bool {
+	if c.Currencies == "" {
+		return currency == DefaultCurrency
+	}
+	for _, cur := range strings.Split(c.Currencies, ",") {
+		if strings.EqualFold(strings.TrimSpace(cur), currency) {
+			return true
+		}
+	}
+	return false
+}
+
 type GatewayType string
 
 const (
@@ -234,31 +282,105 @@ const (
 )
 
 type PaymentGatewayRequest struct {
-	OrderID     string
+	OrderID     string // 本方支付单号，作为渠道侧商户订单号
 	Amount      int64
 	Currency    string
 	Description string
+	ClientIP    string
+	// ProfitSharing 交易需分账：支持分账的渠道在分账完成前冻结商户侧资金
+	ProfitSharing bool
 }
 
 type PaymentGatewayResponse struct {
-	TransactionID string
+	TransactionID string // 渠道交易号，扫码类渠道在支付完成前为空
 	PaymentURL    string
 	RawResponse   string
 }
 
+// GatewayTrade 渠道交易引用。渠道交易号在支付完成前可能为空，此时按本方支付单号定位。
+type GatewayTrade struct {
+	PaymentNo     string
+	TransactionID string
+	Amount        int64 // 原交易金额
+	Currency      string
+}
+
+// TradeOf 返回支付单对应的渠道交易引用。
+func (p *Payment) TradeOf() *GatewayTrade {
+	return &GatewayTrade{
+		PaymentNo:     p.PaymentNo,
+		TransactionID: p.TransactionID,
+		Amount:        p.GatewayAmount(),
+		Currency:      p.Currency,
+	}
+}
+
+// RefundGatewayRequest 渠道退款请求，RefundNo 作为渠道侧退款幂等号。
+type RefundGatewayRequest struct {
+	Trade           *GatewayTrade
+	RefundNo        string
+	GatewayRefundID string // 渠道退款单号，仅查询时使用
+	Amount          int64
+	Reason          string
+}
+
+// RefundGatewayStatus 渠道退款状态。
+type RefundGatewayStatus string
+
+const (
+	RefundGatewayPending RefundGatewayStatus = "PENDING" // 渠道受理中
+	RefundGatewaySuccess RefundGatewayStatus = "SUCCESS" // 退款到账
+	RefundGatewayFailed  RefundGatewayStatus = "FAILED"  // 退款失败或关闭
+)
+
+type RefundGatewayResponse struct {
+	GatewayRefundID string
+	Status          RefundGatewayStatus
+	RawResponse     string
+}
+
 type PaymentGateway interface {
 	PreAuth(ctx context.Context, req *PaymentGatewayRequest) (*PaymentGatewayResponse, error)
-	Capture(ctx context.Context, transactionID string, amount int64) (*PaymentGatewayResponse, error)
-	Void(ctx context.Context, transactionID string) error
-	Refund(ctx context.Context, transactionID string, amount int64) error
-	// DownloadBill 下载指定日期的对账单数据
-	DownloadBill(ctx context.Context, date time.Time) ([]*GatewayBillItem, error)
+	// QueryTrade 查询渠道订单状态，用于补偿丢失的异步通知
+	QueryTrade(ctx context.Context, trade *GatewayTrade) (*GatewayTradeResult, error)
+	// Capture 确认收款。直付类渠道无独立扣款步骤，实现为查询交易并核对已付金额
+	Capture(ctx context.Context, trade *GatewayTrade, amount int64) (*PaymentGatewayResponse, error)
+	// Void 撤销未完成的交易
+	Void(ctx context.Context, trade *GatewayTrade) error
+	Refund(ctx context.Context, req *RefundGatewayRequest) (*RefundGatewayResponse, error)
+	QueryRefund(ctx context.Context, req *RefundGatewayRequest) (*RefundGatewayResponse, error)
+	// DownloadBill 下载指定日期的对账单，按页回调明细，单页不超过 BillPageSize 条；fn 返回错误时中止下载
+	DownloadBill(ctx context.Context, date time.Time, fn func(page []*GatewayBillItem) error) error
+}
+
+// GatewayRegistry 按渠道配置解析网关客户端，渠道凭据与接口地址来自 ChannelConfig.ConfigJSON。
+type GatewayRegistry interface {
+	// ForChannel 返回渠道对应的网关；channel 为 nil 时返回该类型的默认网关
+	ForChannel(ctx context.Context, gatewayType GatewayType, channel *ChannelConfig) (PaymentGateway, error)
+	// ForPayment 返回受理该支付单的渠道网关
+	ForPayment(ctx context.Context, payment *Payment) (PaymentGateway, error)
+	// Channels 返回所有启用渠道及其网关，用于对账
+	Channels(ctx context.Context) ([]*ChannelGateway, error)
+}
+
+// ChannelGateway 启用渠道的配置与网关。
+type ChannelGateway struct {
+	Channel *ChannelConfig
+	Gateway PaymentGateway
 }
 
+// 对账单明细状态。
+const (
+	BillStatusSuccess = "SUCCESS" // 支付成功
+	BillStatusRefund  = "REFUND"  // 退款，Amount 为退款金额
+)
+
 type GatewayBillItem struct {
 	TransactionID string
 	PaymentNo     string
+	RefundNo      string // 本方退款单号，仅退款明细
 	Amount        int64
+	Fee           int64 // 渠道手续费 (分)，退款明细为退回的手续费
 	Status        string
 	PaidAt        time.Time
 }
@@ -272,6 +394,8 @@ type PaymentRepository interface {
 	Save(ctx context.Context, payment *Payment) error
 	Update(ctx context.Context, payment *Payment) error
 	SaveLog(ctx context.Context, log *PaymentLog) error
+	// SaveLegs 保存支付腿状态变更 (Update 不更新已存在的关联记录)
+	SaveLegs(ctx context.Context, legs []*PaymentLeg) error
 	FindLogsByPaymentID(ctx context.Context, userID uint64, paymentID uint64) ([]*PaymentLog, error)
 	Transaction(ctx context.Context, userID uint64, fn func(tx any) error) error
 	WithTx(tx any) PaymentRepository
@@ -279,9 +403,16 @@ type PaymentRepository interface {
 	// 辅助查询
 	GetUserIDByPaymentNo(ctx context.Context, paymentNo string) (uint64, error)
 
+	// 主动查询相关
+	FindDueForQuery(ctx context.Context, now time.Time, limit int) ([]*Payment, error)
+	// ClaimQuery 在支付单仍待支付且查询时间未被其他实例改动时推进查询计划，返回是否抢占成功
+	ClaimQuery(ctx context.Context, payment *Payment, next time.Time) (bool, error)
+
 	// 对账相关
-	FindSuccessPaymentsByDate(ctx context.Context, date time.Time) ([]*Payment, error)
-	SaveReconciliationRecord(ctx context.Context, record *ReconciliationRecord) error
+	// FindByPaymentNos 跨分片按支付单号批量查询
+	FindByPaymentNos(ctx context.Context, paymentNos []string) ([]*Payment, error)
+	// FindPaidByChannel 跨分片查询渠道在 [start, end) 内完成支付的支付单
+	FindPaidByChannel(ctx context.Context, channelCode string, start, end time.Time) ([]*Payment, error)
 
 	// 分布式事务支持
 	ExecWithBarrier(ctx context.Context, barrier interface{}, fn func(ctx context.Context) error) error
@@ -291,8 +422,17 @@ type RefundRepository interface {
 	FindByID(ctx context.Context, userID uint64, id uint64) (*Refund, error)
 	FindByRefundNo(ctx context.Context, userID uint64, refundNo string) (*Refund, error)
 	Save(ctx context.Context, refund *Refund) error
+	Update(ctx context.Context, refund *Refund) error
+	// SaveAllocations 保存退款分摊状态变更
+	SaveAllocations(ctx context.Context, userID uint64, allocations []*RefundAllocation) error
 	Transaction(ctx context.Context, userID uint64, fn func(tx any) error) error
 	WithTx(tx any) RefundRepository
+
+	// 对账相关
+	// FindByRefundNos 跨分片按退款单号批量查询
+	FindByRefundNos(ctx context.Context, refundNos []string) ([]*Refund, error)
+	// FindRefundedByChannel 跨分片查询渠道在 [start, end) 内退款成功的退款单
+	FindRefundedByChannel(ctx context.Context, channelCode string, start, end time.Time) ([]*Refund, error)
 }
 
 type ChannelRepository interface {
@@ -333,16 +473,3 @@ type RiskService interface {
 	CheckPrePayment(ctx context.Context, riskCtx *RiskContext) (*RiskResult, error)
 	RecordTransaction(ctx context.Context, riskCtx *RiskContext) error
 }
-
-// --- Reconciliation ---
-
-type ReconciliationRecord struct {
-	gorm.Model
-	PaymentID     uint64 `gorm:"index"`
-	OrderNo       string `gorm:"index"`
-	SystemAmount  int64
-	GatewayAmount int64
-	DiffAmount    int64
-	Status        string // MATCH, MISMATCH, MISSING_SYSTEM, MISSING_GATEWAY
-	Remark        string
-}
@@ -0,0 +1,309 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/wyfcoding/pkg/idgen"
+	"gorm.io/gorm"
+)
+
+// CompositePaymentMethod 组合支付单的支付方式，实际方式记录在各支付腿上。
+const CompositePaymentMethod = "COMPOSITE"
+
+// LegSource 支付腿的资金来源：外部支付渠道或站内储值账本。
+type LegSource string
+
+const (
+	LegSourceGateway      LegSource = "GATEWAY"       // 支付渠道 (银行卡、支付宝、微信等)
+	LegSourcePoints       LegSource = "POINTS"        // 积分抵扣
+	LegSourceGiftBalance  LegSource = "GIFT_BALANCE"  // 礼品卡余额
+	LegSourceCouponWallet LegSource = "COUPON_WALLET" // 券包余额
+)
+
+// Internal 是否为站内储值来源。
+func (s LegSource) Internal() bool {
+	switch s {
+	case LegSourcePoints, LegSourceGiftBalance, LegSourceCouponWallet:
+		return true
+	}
+	return false
+}
+
+// DefaultRefundOrder 组合支付退款的默认分摊顺序：优先原路退回渠道，其次依次退回各储值来源。
+var DefaultRefundOrder = []LegSource{LegSourceGateway, LegSourceGiftBalance, LegSourcePoints, LegSourceCouponWallet}
+
+// LegStatus 支付腿状态。
+type LegStatus string
+
+const (
+	LegPending    LegStatus = "PENDING"    // 待授权
+	LegAuthorized LegStatus = "AUTHORIZED" // 已授权 (储值已冻结 / 渠道已预授权)
+	LegCaptured   LegStatus = "CAPTURED"   // 已扣款
+	LegVoided     LegStatus = "VOIDED"     // 已撤销 (储值已解冻)
+	LegFailed     LegStatus = "FAILED"     // 授权失败
+)
+
+var (
+	ErrInvalidLegs         = errors.New("invalid payment legs")              // 支付腿金额、来源组合不合法
+	ErrInsufficientBalance = errors.New("insufficient stored-value balance") // 储值可用余额不足
+	ErrRefundExceedsLegs   = errors.New("refund amount exceeds refundable")  // 退款金额超过各支付腿可退总额
+)
+
+// PaymentLeg 组合支付中的一条支付腿。与按收款方拆分资金去向的 PaymentSplit 相对，支付腿描述资金来源。
+// 渠道腿沿用支付单号作为渠道商户订单号，同一支付单至多一条渠道腿；储值腿以腿号作为账本冻结与扣减的业务单号。
+type PaymentLeg struct {
+	gorm.Model
+	PaymentID      uint64    `gorm:"index"`
+	UserID         uint64    `gorm:"index"`
+	LegNo          string    `gorm:"uniqueIndex;size:64"`
+	Seq            int       `gorm:"default:0"`
+	Source         LegSource `gorm:"size:32;not null"`
+	PaymentMethod  string    `gorm:"size:32"` // 渠道腿的支付方式
+	Amount         int64     `gorm:"not null"`
+	CapturedAmount int64     `gorm:"default:0"`
+	RefundedAmount int64     `gorm:"default:0"`
+	Status         LegStatus `gorm:"size:16;not null"`
+	TransactionID  string    `gorm:"size:128"` // 渠道交易号
+	FailureReason  string    `gorm:"size:255"`
+	AuthorizedAt   *time.Time
+	CapturedAt     *time.Time
+}
+
+// Refundable 支付腿剩余可退金额。
+func (l *PaymentLeg) Refundable() int64 {
+	return l.CapturedAmount - l.RefundedAmount
+}
+
+// Authorize 标记支付腿授权成功。
+func (l *PaymentLeg) Authorize(transactionID string) {
+	now := time.Now()
+	l.Status = LegAuthorized
+	l.TransactionID = transactionID
+	l.AuthorizedAt = &now
+}
+
+// Capture 标记支付腿扣款成功。
+func (l *PaymentLeg) Capture() {
+	now := time.Now()
+	l.Status = LegCaptured
+	l.CapturedAmount = l.Amount
+	l.CapturedAt = &now
+}
+
+// Void 撤销已授权的支付腿，未授权的支付腿标记为失败。
+func (l *PaymentLeg) Void(reason string) {
+	if l.Status == LegAuthorized {
+		l.Status = LegVoided
+	} else {
+		l.Status = LegFailed
+	}
+	l.FailureReason = truncate(reason, 255)
+}
+
+// LegRequest 发起组合支付时的支付腿。
+type LegRequest struct {
+	Source        LegSource
+	PaymentMethod string
+	Amount        int64
+}
+
+// ValidateLegs 校验支付腿：金额为正且合计等于支付总额，至多一条渠道腿，储值来源不重复。
+func ValidateLegs(total int64, legs []LegRequest) error {
+	if len(legs) == 0 {
+		return fmt.Errorf("%w: no legs", ErrInvalidLegs)
+	}
+	var sum int64
+	seen := make(map[LegSource]bool, len(legs))
+	for _, leg := range legs {
+		if leg.Amount <= 0 {
+			return fmt.Errorf("%w: non-positive amount for %s", ErrInvalidLegs, leg.Source)
+		}
+		if leg.Source != LegSourceGateway && !leg.Source.Internal() {
+			return fmt.Errorf("%w: unknown source %q", ErrInvalidLegs, leg.Source)
+		}
+		if leg.Source == LegSourceGateway && leg.PaymentMethod == "" {
+			return fmt.Errorf("%w: gateway leg requires a payment method", ErrInvalidLegs)
+		}
+		if seen[leg.Source] {
+			return fmt.Errorf("%w: duplicate source %s", ErrInvalidLegs, leg.Source)
+		}
+		seen[leg.Source] = true
+		sum += leg.Amount
+	}
+	if sum != total {
+		return fmt.Errorf("%w: legs sum to %d, payment amount is %d", ErrInvalidLegs, sum, total)
+	}
+	return nil
+}
+
+// AddLegs 为支付单创建支付腿。
+func (p *Payment) AddLegs(reqs []LegRequest, idGenerator idgen.Generator) {
+	for i, req := range reqs {
+		p.Legs = append(p.Legs, &PaymentLeg{
+			UserID:        p.UserID,
+			LegNo:         fmt.Sprintf("LEG%d", idGenerator.Generate()),
+			Seq:           i + 1,
+			Source:        req.Source,
+			PaymentMethod: req.PaymentMethod,
+			Amount:        req.Amount,
+			Status:        LegPending,
+		})
+	}
+}
+
+// Composite 是否为组合支付。
+func (p *Payment) Composite() bool {
+	return len(p.Legs) > 0
+}
+
+// GatewayLeg 返回渠道腿，无渠道腿时返回 nil。
+func (p *Payment) GatewayLeg() *PaymentLeg {
+	for _, leg := range p.Legs {
+		if leg.Source == LegSourceGateway {
+			return leg
+		}
+	}
+	return nil
+}
+
+// InternalLegs 返回储值腿。
+func (p *Payment) InternalLegs() []*PaymentLeg {
+	legs := make([]*PaymentLeg, 0, len(p.Legs))
+	for _, leg := range p.Legs {
+		if leg.Source.Internal() {
+			legs = append(legs, leg)
+		}
+	}
+	return legs
+}
+
+// GatewayAmount 渠道侧交易金额：单一方式支付为支付总额，组合支付为渠道腿金额。
+func (p *Payment) GatewayAmount() int64 {
+	if !p.Composite() {
+		return p.Amount
+	}
+	if leg := p.GatewayLeg(); leg != nil {
+		return leg.Amount
+	}
+	return 0
+}
+
+// RefundAllocation 退款在各支付腿上的分摊。
+type RefundAllocation struct {
+	gorm.Model
+	RefundID uint64        `gorm:"index"`
+	LegID    uint64        `gorm:"index"`
+	LegNo    string        `gorm:"size:64"`
+	Source   LegSource     `gorm:"size:32"`
+	Amount   int64         `gorm:"not null"`
+	Status   PaymentStatus // Refunding / Refunded / Failed，与退款单状态取值一致
+}
+
+// PlanRefund 按来源优先级将退款金额分摊到各支付腿，同一来源内按支付腿顺序分摊。
+// order 未列出的来源排在最后；单一方式支付返回 nil。
+func (p *Payment) PlanRefund(amount int64, order []LegSource) ([]*RefundAllocation, error) {
+	if !p.Composite() {
+		return nil, nil
+	}
+	rank := make(map[LegSource]int, len(order))
+	for i, src := range order {
+		rank[src] = i
+	}
+	ordered := make([]*PaymentLeg, len(p.Legs))
+	copy(ordered, p.Legs)
+	priority := func(l *PaymentLeg) int {
+		if r, ok := rank[l.Source]; ok {
+			return r
+		}
+		return len(order)
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if pi, pj := priority(ordered[i]), priority(ordered[j]); pi != pj {
+			return pi < pj
+		}
+		return ordered[i].Seq < ordered[j].Seq
+	})
+
+	remaining := amount
+	var allocs []*RefundAllocation
+	for _, leg := range ordered {
+		if remaining == 0 {
+			break
+		}
+		n := min(remaining, leg.Refundable())
+		if n <= 0 {
+			continue
+		}
+		allocs = append(allocs, &RefundAllocation{LegID: uint64(leg.ID), LegNo: leg.LegNo, Source: leg.Source, Amount: n})
+		remaining -= n
+	}
+	if remaining > 0 {
+		return nil, fmt.Errorf("%w: %d left unallocated", ErrRefundExceedsLegs, remaining)
+	}
+	return allocs, nil
+}
+
+// LegByID 按 ID 查找支付腿。
+func (p *Payment) LegByID(id uint64) *PaymentLeg {
+	for _, leg := range p.Legs {
+		if uint64(leg.ID) == id {
+			return leg
+		}
+	}
+	return nil
+}
+
+// settleGatewayLeg 按渠道结果推进渠道腿，单一方式支付或无渠道腿时不做处理。
+func (p *Payment) settleGatewayLeg(success bool, transactionID, reason string) {
+	leg := p.GatewayLeg()
+	if leg == nil {
+		return
+	}
+	if success {
+		if transactionID != "" {
+			leg.TransactionID = transactionID
+		}
+		leg.Capture()
+		return
+	}
+	leg.Void(reason)
+}
+
+// GatewayAmount 渠道侧退款金额：单一方式支付为退款总额，组合支付为分摊到渠道腿的金额。
+func (r *Refund) GatewayAmount() int64 {
+	if len(r.Allocations) == 0 {
+		return r.RefundAmount
+	}
+	var amount int64
+	for _, a := range r.Allocations {
+		if a.Source == LegSourceGateway {
+			amount += a.Amount
+		}
+	}
+	return amount
+}
+
+// SettleAllocations 按退款单状态推进各分摊，退款成功时累加支付腿已退金额。
+// 返回本次新退款成功的储值分摊，由应用层退回储值账户。
+func (p *Payment) SettleAllocations(r *Refund) []*RefundAllocation {
+	var credited []*RefundAllocation
+	for _, a := range r.Allocations {
+		if a.Status == PaymentRefunded || a.Status == PaymentFailed {
+			continue
+		}
+		a.Status = r.Status
+		if r.Status != PaymentRefunded {
+			continue
+		}
+		if leg := p.LegByID(a.LegID); leg != nil {
+			leg.RefundedAmount += a.Amount
+		}
+		if a.Source.Internal() {
+			credited = append(credited, a)
+		}
+	}
+	return credited
+}
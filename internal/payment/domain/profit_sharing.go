@@ -0,0 +1,440 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wyfcoding/pkg/idgen"
+	"gorm.io/gorm"
+)
+
+// 分账接收方类型。
+const (
+	SplitRecipientMerchant = "MERCHANT" // 商户货款
+	SplitRecipientPlatform = "PLATFORM" // 平台佣金
+	SplitRecipientPromoter = "PROMOTER" // 推广佣金
+)
+
+// 分账与分账回退状态。
+const (
+	SplitPending = "PENDING" // 待渠道执行
+	SplitSettled = "SETTLED" // 已执行 (渠道分账完成或已计入内部账本)
+	SplitFailed  = "FAILED"  // 渠道执行失败，待人工处理
+)
+
+// SplitMode 分账执行方式。
+type SplitMode string
+
+const (
+	SplitModeGateway SplitMode = "GATEWAY" // 通过渠道分账接口划转到接收方渠道账户
+	SplitModeLedger  SplitMode = "LEDGER"  // 计入结算账本，随结算周期打款
+)
+
+// ErrInvalidSplitBasis 订单商户金额明细与支付金额不符。
+var ErrInvalidSplitBasis = errors.New("invalid split basis")
+
+// ErrInvalidSplitPolicy 分账费率超出商品金额。
+var ErrInvalidSplitPolicy = errors.New("invalid split policy")
+
+// MerchantShare 订单中单个商户的商品金额，PromoterID 非 0 时该商户商品由推广者带来。
+type MerchantShare struct {
+	MerchantID uint64 `json:"merchant_id"`
+	Amount     int64  `json:"amount"`
+	PromoterID uint64 `json:"promoter_id,omitempty"`
+}
+
+// SplitPolicy 分账费率，以基点 (万分之一) 表示，避免浮点误差。
+type SplitPolicy struct {
+	CommissionBps         int64            // 平台佣金默认费率
+	MerchantCommissionBps map[uint64]int64 // 按商户覆盖的平台佣金费率
+	PromoterBps           int64            // 推广佣金费率，由商户承担
+}
+
+// Validate 校验各费率在 0 到 10000 基点之间，且任一商户的平台佣金与推广佣金合计不超过商品金额。
+func (p SplitPolicy) Validate() error {
+	if err := validateBps("commission", p.CommissionBps); err != nil {
+		return err
+	}
+	if err := validateBps("promoter", p.PromoterBps); err != nil {
+		return err
+	}
+	if p.CommissionBps+p.PromoterBps > 10000 {
+		return fmt.Errorf("%w: commission %d bps plus promoter %d bps exceeds 10000", ErrInvalidSplitPolicy, p.CommissionBps, p.PromoterBps)
+	}
+	for merchantID, bps := range p.MerchantCommissionBps {
+		if err := validateBps(fmt.Sprintf("merchant %d commission", merchantID), bps); err != nil {
+			return err
+		}
+		if bps+p.PromoterBps > 10000 {
+			return fmt.Errorf("%w: merchant %d commission %d bps plus promoter %d bps exceeds 10000", ErrInvalidSplitPolicy, merchantID, bps, p.PromoterBps)
+		}
+	}
+	return nil
+}
+
+func validateBps(name string, bps int64) error {
+	if bps < 0 || bps > 10000 {
+		return fmt.Errorf("%w: %s rate %d bps out of range 0..10000", ErrInvalidSplitPolicy, name, bps)
+	}
+	return nil
+}
+
+func (p SplitPolicy) commissionBps(merchantID uint64) int64 {
+	if bps, ok := p.MerchantCommissionBps[merchantID]; ok {
+		return bps
+	}
+	return p.CommissionBps
+}
+
+// bpsOf 按基点计算金额，四舍五入到最小货币单位。
+func bpsOf(amount, bps int64) int64 {
+	return (amount*bps + 5000) / 10000
+}
+
+// SetSplitBasis 校验并记录订单各商户商品金额，合计须等于支付总额。
+func (p *Payment) SetSplitBasis(shares []MerchantShare) error {
+	if len(shares) == 0 {
+		return nil
+	}
+	var sum int64
+	seen := make(map[uint64]bool, len(shares))
+	for _, s := range shares {
+		if s.MerchantID == 0 || s.Amount <= 0 {
+			return fmt.Errorf("%w: merchant %d amount %d", ErrInvalidSplitBasis, s.MerchantID, s.Amount)
+		}
+		if seen[s.MerchantID] {
+			return fmt.Errorf("%w: duplicate merchant %d", ErrInvalidSplitBasis, s.MerchantID)
+		}
+		seen[s.MerchantID] = true
+		sum += s.Amount
+	}
+	if sum != p.Amount {
+		return fmt.Errorf("%w: merchant shares sum to %d, payment amount is %d", ErrInvalidSplitBasis, sum, p.Amount)
+	}
+	data, err := json.Marshal(shares)
+	if err != nil {
+		return err
+	}
+	p.SplitBasis = string(data)
+	return nil
+}
+
+// MerchantShares 解析订单各商户商品金额，未记录时返回 nil。
+func (p *Payment) MerchantShares() ([]MerchantShare, error) {
+	if p.SplitBasis == "" {
+		return nil, nil
+	}
+	var shares []MerchantShare
+	if err := json.Unmarshal([]byte(p.SplitBasis), &shares); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSplitBasis, err)
+	}
+	return shares, nil
+}
+
+// PlanSplits 按扣款金额生成分账指令：每个商户拆为商户货款、平台佣金与推广佣金，平台佣金合并为一条。
+// 部分扣款时各商户金额按比例缩减，取整差额计入最后一个商户；结算币种金额按锁定汇率折算，取整差额计入平台佣金。
+// 已生成分账或未记录商户金额时不做处理。新生成的分账均为待执行状态，执行方式由调用方决定。
+// 费率使商户货款为负时返回 ErrInvalidSplitPolicy，且不生成任何分账。
+func (p *Payment) PlanSplits(policy SplitPolicy, idGenerator idgen.Generator) error {
+	if len(p.Splits) > 0 {
+		return nil
+	}
+	shares, err := p.MerchantShares()
+	if err != nil || len(shares) == 0 {
+		return err
+	}
+
+	captured := p.CapturedAmount
+	var allocated, commission int64
+	for i, share := range shares {
+		amount := share.Amount
+		if captured != p.Amount {
+			amount = share.Amount * captured / p.Amount
+			if i == len(shares)-1 {
+				amount = captured - allocated
+			}
+		}
+		allocated += amount
+
+		commissionBps := policy.commissionBps(share.MerchantID)
+		fee := bpsOf(amount, commissionBps)
+		var promoter int64
+		if share.PromoterID != 0 {
+			// 按合计费率取整后再扣除平台佣金，避免两项分别进位使扣除额超过商品金额
+			promoter = bpsOf(amount, commissionBps+policy.PromoterBps) - fee
+		}
+		if amount-fee-promoter < 0 {
+			p.Splits = nil
+			return fmt.Errorf("%w: merchant %d commission %d and promoter %d exceed amount %d", ErrInvalidSplitPolicy, share.MerchantID, fee, promoter, amount)
+		}
+		commission += fee
+		p.addSplit(SplitRecipientMerchant, share.MerchantID, amount-fee-promoter, idGenerator)
+		if promoter > 0 {
+			p.addSplit(SplitRecipientPromoter, share.PromoterID, promoter, idGenerator)
+		}
+	}
+	if commission > 0 {
+		p.addSplit(SplitRecipientPlatform, 0, commission, idGenerator)
+	}
+
+	// 结算币种金额按锁定汇率逐条折算，取整差额计入平台佣金 (无平台佣金时计入最后一条)，保证合计等于扣款结算金额
+	if len(p.Splits) == 0 {
+		return nil
+	}
+	currency := NormalizeCurrency(p.Currency)
+	var booked int64
+	absorber := p.Splits[len(p.Splits)-1]
+	for _, s := range p.Splits {
+		s.SettlementAmount = ConvertAmount(s.Amount, currency, p.SettlementCurrency, p.FX.Rate)
+		booked += s.SettlementAmount
+		if s.RecipientType == SplitRecipientPlatform {
+			absorber = s
+		}
+	}
+	absorber.SettlementAmount += p.CapturedSettlementAmount - booked
+	return nil
+}
+
+func (p *Payment) addSplit(recipientType string, recipientID uint64, amount int64, idGenerator idgen.Generator) {
+	if amount <= 0 {
+		return
+	}
+	p.Splits = append(p.Splits, &PaymentSplit{
+		PaymentID:     uint64(p.ID),
+		UserID:        p.UserID,
+		SplitNo:       fmt.Sprintf("SPL%d", idGenerator.Generate()),
+		RecipientID:   recipientID,
+		RecipientType: recipientType,
+		Amount:        amount,
+		Mode:          SplitModeLedger,
+		Status:        SplitPending,
+	})
+}
+
+// Remaining 未回退的分账金额。
+func (s *PaymentSplit) Remaining() int64 {
+	return s.Amount - s.ReversedAmount
+}
+
+// Settle 标记分账已执行。
+func (s *PaymentSplit) Settle(gatewayOrderID string) {
+	now := time.Now()
+	s.Status = SplitSettled
+	s.GatewayOrderID = gatewayOrderID
+	s.SettledAt = &now
+	s.NextAttemptAt = nil
+	s.FailureReason = ""
+}
+
+// FallbackToLedger 渠道分账失败时改为计入结算账本，由结算周期向接收方打款。
+func (s *PaymentSplit) FallbackToLedger(reason string) {
+	s.Mode = SplitModeLedger
+	s.Settle("")
+	s.FailureReason = truncate(reason, 255)
+}
+
+// ScheduleRetry 渠道分账受理中或暂时失败，按退避计划重试。
+func (s *PaymentSplit) ScheduleRetry(now time.Time, reason string) {
+	s.Attempts++
+	next := now.Add(splitBackoff[min(s.Attempts, len(splitBackoff)-1)])
+	s.NextAttemptAt = &next
+	s.FailureReason = truncate(reason, 255)
+}
+
+// splitBackoff 渠道分账与分账回退的重试间隔。
+var splitBackoff = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 4 * time.Hour}
+
+// MaxSplitAttempts 渠道分账最多尝试次数，超过后分账改计入账本、分账回退转人工处理。
+const MaxSplitAttempts = 8
+
+// SplitReversal 退款时按比例回退的分账。
+type SplitReversal struct {
+	gorm.Model
+	UserID           uint64 `gorm:"index"`
+	PaymentID        uint64 `gorm:"index"`
+	RefundID         uint64 `gorm:"index"`
+	RefundNo         string `gorm:"size:64"`
+	SplitID          uint64 `gorm:"index"`
+	SplitNo          string `gorm:"size:64"`
+	ReturnNo         string `gorm:"uniqueIndex;size:64"` // 渠道分账回退幂等号
+	RecipientID      uint64
+	RecipientType    string     `gorm:"size:32"`
+	ReceiverAccount  string     `gorm:"size:64"`
+	Amount           int64      `gorm:"not null"`
+	SettlementAmount int64      `gorm:"default:0"`
+	Mode             SplitMode  `gorm:"size:16"`
+	Status           string     `gorm:"size:16"`
+	GatewayReturnID  string     `gorm:"size:128"`
+	Attempts         int        `gorm:"default:0"`
+	NextAttemptAt    *time.Time `gorm:"index"`
+	FailureReason    string     `gorm:"size:255"`
+	SettledAt        *time.Time
+}
+
+// Settle 标记分账回退已完成。
+func (r *SplitReversal) Settle(gatewayReturnID string) {
+	now := time.Now()
+	r.Status = SplitSettled
+	r.GatewayReturnID = gatewayReturnID
+	r.SettledAt = &now
+	r.NextAttemptAt = nil
+	r.FailureReason = ""
+}
+
+// ScheduleRetry 渠道回退受理中或暂时失败，按退避计划重试，超过最大次数后标记失败。
+func (r *SplitReversal) ScheduleRetry(now time.Time, reason string) {
+	r.Attempts++
+	r.FailureReason = truncate(reason, 255)
+	if r.Attempts >= MaxSplitAttempts {
+		r.Status = SplitFailed
+		r.NextAttemptAt = nil
+		return
+	}
+	next := now.Add(splitBackoff[min(r.Attempts, len(splitBackoff)-1)])
+	r.NextAttemptAt = &next
+}
+
+// Fail 渠道拒绝分账回退，转人工处理。
+func (r *SplitReversal) Fail(reason string) {
+	r.Status = SplitFailed
+	r.NextAttemptAt = nil
+	r.FailureReason = truncate(reason, 255)
+}
+
+// ProfitSharingOrderNo 支付单的渠道分账单号。一笔交易的渠道分账合并为一单，重复提交幂等。
+func (p *Payment) ProfitSharingOrderNo() string {
+	return "PS" + p.PaymentNo
+}
+
+// PlanSplitReversals 按退款金额占扣款金额的比例回退各分账，取整差额计入最后一条分账，合计等于退款金额。
+// 已在渠道执行的分账通过渠道回退；尚未执行或计入账本的分账直接冲减，由结算账本冲回。
+func (p *Payment) PlanSplitReversals(refund *Refund, idGenerator idgen.Generator) []*SplitReversal {
+	var open []*PaymentSplit
+	for _, s := range p.Splits {
+		if s.Remaining() > 0 {
+			open = append(open, s)
+		}
+	}
+	if len(open) == 0 || p.CapturedAmount <= 0 {
+		return nil
+	}
+
+	amount := min(refund.RefundAmount, p.CapturedAmount)
+	now := time.Now()
+	var allocated int64
+	reversals := make([]*SplitReversal, 0, len(open))
+	for i, s := range open {
+		n := s.Amount * amount / p.CapturedAmount
+		if i == len(open)-1 {
+			n = amount - allocated
+		}
+		n = min(n, s.Remaining())
+		allocated += n
+		if n <= 0 {
+			continue
+		}
+		s.ReversedAmount += n
+
+		r := &SplitReversal{
+			UserID:           p.UserID,
+			PaymentID:        uint64(p.ID),
+			RefundID:         uint64(refund.ID),
+			RefundNo:         refund.RefundNo,
+			SplitID:          uint64(s.ID),
+			SplitNo:          s.SplitNo,
+			ReturnNo:         fmt.Sprintf("SPR%d", idGenerator.Generate()),
+			RecipientID:      s.RecipientID,
+			RecipientType:    s.RecipientType,
+			ReceiverAccount:  s.ReceiverAccount,
+			Amount:           n,
+			SettlementAmount: ConvertAmount(n, NormalizeCurrency(p.Currency), p.SettlementCurrency, p.FX.Rate),
+			Mode:             SplitModeLedger,
+			Status:           SplitSettled,
+			SettledAt:        &now,
+		}
+		if s.Mode == SplitModeGateway && s.Status == SplitSettled {
+			r.Mode = SplitModeGateway
+			r.Status = SplitPending
+			r.SettledAt = nil
+			r.NextAttemptAt = &now
+		}
+		reversals = append(reversals, r)
+	}
+	return reversals
+}
+
+// ProfitSharingStatus 渠道分账或分账回退的处理结果。
+type ProfitSharingStatus string
+
+const (
+	ProfitSharingPending ProfitSharingStatus = "PENDING" // 渠道受理中
+	ProfitSharingSuccess ProfitSharingStatus = "SUCCESS" // 已到账
+	ProfitSharingFailed  ProfitSharingStatus = "FAILED"  // 失败或已关闭
+)
+
+// ProfitReceiver 渠道分账的一个接收方。
+type ProfitReceiver struct {
+	SplitNo     string
+	Account     string
+	Amount      int64
+	Description string
+}
+
+// ProfitSharingRequest 渠道分账请求，一笔交易的全部渠道分账合并为一单，剩余资金解冻给本方商户 (平台佣金)。
+type ProfitSharingRequest struct {
+	Trade     *GatewayTrade
+	OrderNo   string // 本方分账单号，作为渠道幂等号
+	Receivers []*ProfitReceiver
+}
+
+// ProfitSharingResponse 渠道分账结果，Receivers 为各接收账号的处理结果。
+type ProfitSharingResponse struct {
+	GatewayOrderID string
+	Status         ProfitSharingStatus
+	Receivers      map[string]ProfitSharingStatus
+	RawResponse    string
+}
+
+// ProfitReturnRequest 渠道分账回退请求，从接收方账户退回已分账资金。
+type ProfitReturnRequest struct {
+	Trade       *GatewayTrade
+	OrderNo     string // 原分账单号
+	ReturnNo    string // 本方回退单号，作为渠道幂等号
+	Account     string
+	Amount      int64
+	Description string
+}
+
+// ProfitReturnResponse 渠道分账回退结果。
+type ProfitReturnResponse struct {
+	GatewayReturnID string
+	Status          ProfitSharingStatus
+	RawResponse     string
+}
+
+// ProfitSharingGateway 支持分账的渠道网关，作为 PaymentGateway 的可选能力。
+// 请求均以本方单号作为幂等号，受理中的请求按同一单号重新提交以获取最新结果。
+type ProfitSharingGateway interface {
+	// ProfitSharingAccount 返回接收方在渠道侧登记的分账账号，未登记时返回 false
+	ProfitSharingAccount(recipientType string, recipientID uint64) (string, bool)
+	ShareProfit(ctx context.Context, req *ProfitSharingRequest) (*ProfitSharingResponse, error)
+	ReturnProfit(ctx context.Context, req *ProfitReturnRequest) (*ProfitReturnResponse, error)
+}
+
+// ProfitSharingRepository 分账与分账回退仓储，随支付单按用户分片。
+type ProfitSharingRepository interface {
+	SaveSplits(ctx context.Context, userID uint64, splits []*PaymentSplit) error
+	SaveReversals(ctx context.Context, userID uint64, reversals []*SplitReversal) error
+	// FindDueSplits 跨分片查询到期待渠道执行的分账
+	FindDueSplits(ctx context.Context, now time.Time, limit int) ([]*PaymentSplit, error)
+	// FindDueReversals 跨分片查询到期待渠道回退的分账回退
+	FindDueReversals(ctx context.Context, now time.Time, limit int) ([]*SplitReversal, error)
+	// ClaimSplit 以下次执行时间做 CAS 推进执行计划，多实例同时扫描时同一分账只会被一个实例执行
+	ClaimSplit(ctx context.Context, split *PaymentSplit, next time.Time) (bool, error)
+	// ClaimReversal 以下次执行时间做 CAS 推进执行计划
+	ClaimReversal(ctx context.Context, reversal *SplitReversal, next time.Time) (bool, error)
+	WithTx(tx any) ProfitSharingRepository
+}
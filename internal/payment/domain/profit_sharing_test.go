@@ -0,0 +1,197 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// seqGenerator 按顺序生成 ID。
+type seqGenerator struct{ n int64 }
+
+func (g *seqGenerator) Generate() int64 {
+	g.n++
+	return g.n
+}
+
+type plannedSplit struct {
+	recipientType string
+	recipientID   uint64
+	amount        int64
+	settlement    int64
+}
+
+func TestPlanSplits(t *testing.T) {
+	policy := SplitPolicy{CommissionBps: 500, PromoterBps: 200, MerchantCommissionBps: map[uint64]int64{2: 300}}
+	tests := []struct {
+		name     string
+		policy   SplitPolicy
+		currency string
+		rate     string
+		amount   int64
+		captured int64
+		shares   []MerchantShare
+		want     []plannedSplit
+	}{
+		{
+			name:     "commission override and promoter",
+			policy:   policy,
+			amount:   10000,
+			captured: 10000,
+			shares:   []MerchantShare{{MerchantID: 1, Amount: 6000, PromoterID: 9}, {MerchantID: 2, Amount: 4000}},
+			want: []plannedSplit{
+				{SplitRecipientMerchant, 1, 5580, 5580},
+				{SplitRecipientPromoter, 9, 120, 120},
+				{SplitRecipientMerchant, 2, 3880, 3880},
+				{SplitRecipientPlatform, 0, 420, 420},
+			},
+		},
+		{
+			name:     "partial capture prorated with remainder on last merchant",
+			amount:   10000,
+			captured: 9999,
+			shares:   []MerchantShare{{MerchantID: 1, Amount: 3333}, {MerchantID: 2, Amount: 3333}, {MerchantID: 3, Amount: 3334}},
+			want: []plannedSplit{
+				{SplitRecipientMerchant, 1, 3332, 3332},
+				{SplitRecipientMerchant, 2, 3332, 3332},
+				{SplitRecipientMerchant, 3, 3335, 3335},
+			},
+		},
+		{
+			name:     "fx remainder absorbed by platform commission",
+			policy:   SplitPolicy{CommissionBps: 500},
+			currency: "USD",
+			rate:     "7.1234",
+			amount:   10000,
+			captured: 10000,
+			shares:   []MerchantShare{{MerchantID: 1, Amount: 3333}, {MerchantID: 2, Amount: 6667}},
+			want: []plannedSplit{
+				{SplitRecipientMerchant, 1, 3166, 22553},
+				{SplitRecipientMerchant, 2, 6334, 45120},
+				{SplitRecipientPlatform, 0, 500, 3561}, // 逐条折算合计 71235，比扣款结算金额多 1
+			},
+		},
+		{
+			name:     "fx remainder absorbed by last split without commission",
+			currency: "USD",
+			rate:     "7.12345",
+			amount:   10000,
+			captured: 10000,
+			shares:   []MerchantShare{{MerchantID: 1, Amount: 3333}, {MerchantID: 2, Amount: 6667}},
+			want: []plannedSplit{
+				{SplitRecipientMerchant, 1, 3333, 23742},
+				{SplitRecipientMerchant, 2, 6667, 47493}, // 扣款结算金额 71234.5 进位为 71235
+			},
+		},
+		{
+			name:     "full deduction rounds as one rate",
+			policy:   SplitPolicy{CommissionBps: 5000, PromoterBps: 5000},
+			amount:   1,
+			captured: 1,
+			shares:   []MerchantShare{{MerchantID: 1, Amount: 1, PromoterID: 9}},
+			want: []plannedSplit{
+				{SplitRecipientPlatform, 0, 1, 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newSplitPayment(t, tt.currency, tt.rate, tt.amount, tt.captured, tt.shares)
+			if err := p.PlanSplits(tt.policy, &seqGenerator{}); err != nil {
+				t.Fatalf("PlanSplits() error = %v", err)
+			}
+
+			var got []plannedSplit
+			var sum, settlementSum int64
+			for _, s := range p.Splits {
+				got = append(got, plannedSplit{s.RecipientType, s.RecipientID, s.Amount, s.SettlementAmount})
+				sum += s.Amount
+				settlementSum += s.SettlementAmount
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("splits = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("split %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+			if sum != p.CapturedAmount || settlementSum != p.CapturedSettlementAmount {
+				t.Fatalf("splits sum to %d/%d, want %d/%d", sum, settlementSum, p.CapturedAmount, p.CapturedSettlementAmount)
+			}
+		})
+	}
+}
+
+func TestPlanSplitsRejectsNegativeMerchantShare(t *testing.T) {
+	p := newSplitPayment(t, "", "", 10000, 10000, []MerchantShare{{MerchantID: 1, Amount: 10000, PromoterID: 9}})
+	policy := SplitPolicy{CommissionBps: 8000, PromoterBps: 3000}
+	if err := p.PlanSplits(policy, &seqGenerator{}); !errors.Is(err, ErrInvalidSplitPolicy) {
+		t.Fatalf("PlanSplits() error = %v, want ErrInvalidSplitPolicy", err)
+	}
+	if len(p.Splits) != 0 {
+		t.Fatalf("splits = %d, want none", len(p.Splits))
+	}
+}
+
+func TestPlanSplitsSkipped(t *testing.T) {
+	// 未记录商户金额
+	p := newSplitPayment(t, "", "", 10000, 10000, nil)
+	if err := p.PlanSplits(SplitPolicy{CommissionBps: 500}, &seqGenerator{}); err != nil || len(p.Splits) != 0 {
+		t.Fatalf("PlanSplits() = %d splits, %v, want none", len(p.Splits), err)
+	}
+
+	// 已生成分账时不重复生成
+	p = newSplitPayment(t, "", "", 10000, 10000, []MerchantShare{{MerchantID: 1, Amount: 10000}})
+	p.Splits = []*PaymentSplit{{RecipientType: SplitRecipientMerchant, RecipientID: 1, Amount: 10000}}
+	if err := p.PlanSplits(SplitPolicy{CommissionBps: 500}, &seqGenerator{}); err != nil || len(p.Splits) != 1 {
+		t.Fatalf("PlanSplits() = %d splits, %v, want existing split", len(p.Splits), err)
+	}
+}
+
+func TestSplitPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  SplitPolicy
+		wantErr bool
+	}{
+		{name: "valid", policy: SplitPolicy{CommissionBps: 500, PromoterBps: 200, MerchantCommissionBps: map[uint64]int64{1: 300}}},
+		{name: "zero rates", policy: SplitPolicy{}},
+		{name: "full deduction", policy: SplitPolicy{CommissionBps: 9800, PromoterBps: 200}},
+		{name: "negative commission", policy: SplitPolicy{CommissionBps: -1}, wantErr: true},
+		{name: "commission above 10000", policy: SplitPolicy{CommissionBps: 10001}, wantErr: true},
+		{name: "negative promoter", policy: SplitPolicy{PromoterBps: -1}, wantErr: true},
+		{name: "commission plus promoter above 10000", policy: SplitPolicy{CommissionBps: 9000, PromoterBps: 1001}, wantErr: true},
+		{name: "negative merchant commission", policy: SplitPolicy{MerchantCommissionBps: map[uint64]int64{1: -5}}, wantErr: true},
+		{name: "merchant commission plus promoter above 10000", policy: SplitPolicy{CommissionBps: 500, PromoterBps: 200, MerchantCommissionBps: map[uint64]int64{1: 9900}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if tt.wantErr && !errors.Is(err, ErrInvalidSplitPolicy) {
+				t.Fatalf("Validate() error = %v, want ErrInvalidSplitPolicy", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("Validate() error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+// newSplitPayment 构造已锁定汇率并记录扣款的支付单，rate 为空时按 1:1 结算为人民币。
+func newSplitPayment(t *testing.T, currency, rate string, amount, captured int64, shares []MerchantShare) *Payment {
+	t.Helper()
+	p := &Payment{Amount: amount, Currency: currency}
+	if err := p.SetSplitBasis(shares); err != nil {
+		t.Fatalf("SetSplitBasis() error = %v", err)
+	}
+	snapshot := ParSnapshot(time.Now())
+	if rate != "" {
+		snapshot.Rate = decimal.RequireFromString(rate)
+	}
+	p.LockFX(DefaultCurrency, snapshot)
+	p.RecordCapture(captured)
+	return p
+}
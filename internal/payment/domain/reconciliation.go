@@ -1,10 +1,14 @@
 package domain
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
+	"time"
+	"unicode/utf8"
 
-	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
 )
 
 // ReconcileStatus 对账结果状态
@@ -14,130 +18,212 @@ const (
 	ReconcileMatch          ReconcileStatus = "MATCH"
 	ReconcileMismatchAmount ReconcileStatus = "MISMATCH_AMOUNT"
 	ReconcileMismatchStatus ReconcileStatus = "MISMATCH_STATUS"
+	ReconcileMismatchFee    ReconcileStatus = "MISMATCH_FEE"    // 渠道手续费与签约费率不符
 	ReconcileMissingSystem  ReconcileStatus = "MISSING_SYSTEM"  // 长款 (渠道有，系统无)
 	ReconcileMissingChannel ReconcileStatus = "MISSING_CHANNEL" // 短款 (系统有，渠道无)
 )
 
-// SystemTransaction 系统侧交易记录 (待对账数据)
-type SystemTransaction struct {
-	PaymentID     string
-	OrderNo       string
-	Amount        decimal.Decimal
-	Status        PaymentStatus
-	TransactionID string // 渠道流水号
+// ReconcileSubject 对账对象
+type ReconcileSubject string
+
+const (
+	ReconcileSubjectPayment ReconcileSubject = "PAYMENT" // 支付明细，按支付单号核对
+	ReconcileSubjectRefund  ReconcileSubject = "REFUND"  // 退款明细，按退款单号核对
+)
+
+// ResolutionPattern 可自动处理的已知差异模式
+type ResolutionPattern string
+
+const (
+	PatternLateCallback ResolutionPattern = "LATE_CALLBACK" // 渠道已支付而系统仍待支付：支付通知丢失或延迟，查询渠道后补推支付结果
+	PatternLateRefund   ResolutionPattern = "LATE_REFUND"   // 渠道已退款而系统退款仍处理中：同步渠道退款结果
+	PatternCrossDay     ResolutionPattern = "CROSS_DAY"     // 日切差异：系统与渠道入账时间跨账单日，在相邻账单中核对一致
+	PatternRematched    ResolutionPattern = "REMATCHED"     // 重新对账时已核对一致 (差异已在系统或渠道侧修正)
+)
+
+var (
+	// ErrManualResolution 差异不属于已知模式，需要人工处理
+	ErrManualResolution = errors.New("manual intervention required")
+	// ErrBreakNotFound 对账差异不存在
+	ErrBreakNotFound = errors.New("reconciliation break not found")
+	// ErrBreakClosed 对账差异已关闭
+	ErrBreakClosed = errors.New("reconciliation break already closed")
+	// ErrInvalidBillDate 账单日格式错误
+	ErrInvalidBillDate = errors.New("invalid bill date, expected yyyy-MM-dd")
+)
+
+// BillPageSize 对账单分页回调的单页明细数。
+const BillPageSize = 500
+
+// billLocations 各渠道账单日所在时区，未列出的渠道按 UTC 切日。
+var billLocations = map[ChannelType]*time.Location{
+	ChannelTypeAlipay: time.FixedZone("CST", 8*3600),
+	ChannelTypeWechat: time.FixedZone("CST", 8*3600),
 }
 
-// ChannelTransaction 渠道侧交易记录 (对账单数据)
-type ChannelTransaction struct {
-	TransactionID string
-	PaymentNo     string // 商户订单号
-	Amount        decimal.Decimal
-	Status        string // 渠道原生状态
-	Fee           decimal.Decimal
+// ParseBillDate 解析账单日 (yyyy-MM-dd)，返回当日 UTC 正午：各渠道按自身时区取日期时仍落在同一天。
+func ParseBillDate(s string) (time.Time, error) {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, ErrInvalidBillDate
+	}
+	return t.Add(12 * time.Hour), nil
+}
+
+// BillWindow 返回渠道账单日对应的时间区间 [start, end)。
+func BillWindow(channelType ChannelType, date time.Time) (time.Time, time.Time) {
+	loc, ok := billLocations[channelType]
+	if !ok {
+		loc = time.UTC
+	}
+	d := date.UTC()
+	start := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc)
+	return start, start.AddDate(0, 0, 1)
 }
 
-// ReconcileResult 单笔对账结果
+// ReconcileResult 单笔对账结果，金额单位为分
 type ReconcileResult struct {
-	PaymentID     string
-	TransactionID string
+	Subject       ReconcileSubject
 	Status        ReconcileStatus
-	SystemAmount  decimal.Decimal
-	ChannelAmount decimal.Decimal
-	AmountDiff    decimal.Decimal
+	Pattern       ResolutionPattern
+	PaymentNo     string
+	RefundNo      string
+	TransactionID string
+	PaymentID     uint64
+	UserID        uint64
+	SystemStatus  PaymentStatus
+	SystemAmount  int64
+	ChannelAmount int64
+	ExpectedFee   int64 // 按渠道签约费率计算的手续费
+	ChannelFee    int64
 	Remark        string
 }
 
+// SubjectKey 差异对象标识，同一笔支付或退款在不同批次中发现的差异归并到同一条记录。
+// 账单中无本方单号的明细 (如在渠道后台直接发起的退款) 以渠道交易号与金额标识。
+func (r *ReconcileResult) SubjectKey() string {
+	no := r.PaymentNo
+	if r.Subject == ReconcileSubjectRefund {
+		no = r.RefundNo
+	}
+	if no == "" {
+		return fmt.Sprintf("%s:%s:%d", r.Subject, r.TransactionID, r.ChannelAmount)
+	}
+	return string(r.Subject) + ":" + no
+}
+
+// DiffAmount 系统与渠道的金额差。
+func (r *ReconcileResult) DiffAmount() int64 {
+	return r.SystemAmount - r.ChannelAmount
+}
+
 // ReconciliationEngine 对账核心引擎
 type ReconciliationEngine struct {
-	// 可配置项：允许的金额误差 (例如 0.01 元)
-	AmountTolerance decimal.Decimal
+	// 可配置项：允许的金额误差 (分)，金额以分为单位应精确一致
+	AmountTolerance int64
+	// 可配置项：允许的手续费误差 (分)，覆盖渠道逐笔四舍五入的差异
+	FeeTolerance int64
 }
 
 func NewReconciliationEngine() *ReconciliationEngine {
 	return &ReconciliationEngine{
-		AmountTolerance: decimal.NewFromFloat(0.01),
-	}
-}
-
-// ReconcileBatch 执行批次对账
-// systemTxns: 系统流水，Key 为 TransactionID (或 PaymentNo，需统一)
-// channelTxns: 渠道流水，Key 为 TransactionID (或 PaymentNo)
-// 假设以 TransactionID 为主要匹配键，PaymentNo 为辅
-func (e *ReconciliationEngine) ReconcileBatch(systemTxns map[string]*SystemTransaction, channelTxns map[string]*ChannelTransaction) []*ReconcileResult {
-	results := make([]*ReconcileResult, 0, len(systemTxns))
-	processedChannelTxns := make(map[string]bool)
-
-	// 1. 遍历系统流水，去匹配渠道流水
-	for sysKey, sysTx := range systemTxns {
-		// 尝试匹配
-		chanTx, exists := channelTxns[sysKey]
-		if !exists {
-			// 如果 TransactionID 没匹配上，尝试用 PaymentNo 匹配 (假设 sysKey 就是 TransactionID)
-			// 这里简化逻辑，假设 key 统一。
-
-			// 短款：系统有，渠道无
-			results = append(results, &ReconcileResult{
-				PaymentID:     sysTx.PaymentID,
-				TransactionID: sysTx.TransactionID,
-				Status:        ReconcileMissingChannel,
-				SystemAmount:  sysTx.Amount,
-				Remark:        "Transaction found in system but missing in channel statement",
-			})
+		AmountTolerance: 0,
+		FeeTolerance:    1,
+	}
+}
+
+// ReconcileBatch 核对一页账单明细
+// payments、refunds: 按明细单号查得的系统记录，Key 分别为支付单号与退款单号，未找到的单号不在 map 中
+// ratePercent: 渠道签约费率 (%)，为 0 时不核对手续费
+func (e *ReconciliationEngine) ReconcileBatch(items []*GatewayBillItem, payments map[string]*Payment, refunds map[string]*Refund, ratePercent float64) []*ReconcileResult {
+	results := make([]*ReconcileResult, 0, len(items))
+	for _, item := range items {
+		if item.Status == BillStatusRefund {
+			results = append(results, e.compareRefund(item, refunds[item.RefundNo]))
 			continue
 		}
+		results = append(results, e.compareTransaction(item, payments[item.PaymentNo], ratePercent))
+	}
+	return results
+}
 
-		processedChannelTxns[sysKey] = true
+// compareTransaction 核对单笔支付明细：金额、状态、手续费
+func (e *ReconciliationEngine) compareTransaction(item *GatewayBillItem, p *Payment, ratePercent float64) *ReconcileResult {
+	res := &ReconcileResult{
+		Subject:       ReconcileSubjectPayment,
+		PaymentNo:     item.PaymentNo,
+		TransactionID: item.TransactionID,
+		ChannelAmount: item.Amount,
+		ChannelFee:    item.Fee,
+	}
+	if p == nil {
+		// 长款：渠道有，系统无
+		res.Status = ReconcileMissingSystem
+		res.Remark = fmt.Sprintf("Payment %s found in channel bill but missing in system", item.PaymentNo)
+		return res
+	}
+	res.PaymentID = uint64(p.ID)
+	res.UserID = p.UserID
+	res.SystemStatus = p.Status
+	res.SystemAmount = p.GatewayAmount()
+	if ratePercent > 0 {
+		res.ExpectedFee = int64(math.Round(float64(item.Amount) * ratePercent / 100))
+	}
 
-		// 匹配上了，开始核对细节
-		res := e.compareTransaction(sysTx, chanTx)
-		results = append(results, res)
+	// 1. 校验金额
+	if abs(res.DiffAmount()) > e.AmountTolerance {
+		res.Status = ReconcileMismatchAmount
+		res.Remark = fmt.Sprintf("Amount mismatch: System=%d, Channel=%d", res.SystemAmount, item.Amount)
+		return res
 	}
 
-	// 2. 遍历渠道流水，找出长款 (系统没有的)
-	for chanKey, chanTx := range channelTxns {
-		if processedChannelTxns[chanKey] {
-			continue
-		}
+	// 2. 校验状态：渠道成功扣款但系统未支付属于“掉单”
+	if !p.Paid() {
+		res.Status = ReconcileMismatchStatus
+		res.Remark = fmt.Sprintf("Status mismatch: System=%s, Channel=%s", p.Status, item.Status)
+		return res
+	}
 
-		// 长款：渠道有，系统无
-		results = append(results, &ReconcileResult{
-			TransactionID: chanTx.TransactionID,
-			Status:        ReconcileMissingSystem,
-			ChannelAmount: chanTx.Amount,
-			Remark:        fmt.Sprintf("Transaction %s found in channel but missing in system", chanKey),
-		})
+	// 3. 校验手续费
+	if ratePercent > 0 && abs(item.Fee-res.ExpectedFee) > e.FeeTolerance {
+		res.Status = ReconcileMismatchFee
+		res.Remark = fmt.Sprintf("Fee mismatch: Expected=%d (%.2f%%), Channel=%d", res.ExpectedFee, ratePercent, item.Fee)
+		return res
 	}
 
-	return results
+	res.Status = ReconcileMatch
+	return res
 }
 
-// compareTransaction 核对单笔明细
-func (e *ReconciliationEngine) compareTransaction(sys *SystemTransaction, ch *ChannelTransaction) *ReconcileResult {
+// compareRefund 核对单笔退款明细：金额、状态。退款手续费由渠道按原交易比例退回，不单独核对
+func (e *ReconciliationEngine) compareRefund(item *GatewayBillItem, r *Refund) *ReconcileResult {
 	res := &ReconcileResult{
-		PaymentID:     sys.PaymentID,
-		TransactionID: sys.TransactionID,
-		SystemAmount:  sys.Amount,
-		ChannelAmount: ch.Amount,
+		Subject:       ReconcileSubjectRefund,
+		PaymentNo:     item.PaymentNo,
+		RefundNo:      item.RefundNo,
+		TransactionID: item.TransactionID,
+		ChannelAmount: item.Amount,
+		ChannelFee:    item.Fee,
 	}
+	if r == nil {
+		res.Status = ReconcileMissingSystem
+		res.Remark = fmt.Sprintf("Refund %q of payment %s found in channel bill but missing in system", item.RefundNo, item.PaymentNo)
+		return res
+	}
+	res.PaymentNo = r.PaymentNo
+	res.PaymentID = r.PaymentID
+	res.UserID = r.UserID
+	res.SystemStatus = r.Status
+	res.SystemAmount = r.GatewayAmount()
 
-	// 1. 校验金额
-	diff := sys.Amount.Sub(ch.Amount).Abs()
-	res.AmountDiff = diff
-
-	if diff.GreaterThan(e.AmountTolerance) {
+	if abs(res.DiffAmount()) > e.AmountTolerance {
 		res.Status = ReconcileMismatchAmount
-		res.Remark = fmt.Sprintf("Amount mismatch: System=%s, Channel=%s", sys.Amount, ch.Amount)
+		res.Remark = fmt.Sprintf("Refund amount mismatch: System=%d, Channel=%d", res.SystemAmount, item.Amount)
 		return res
 	}
-
-	// 2. 校验状态
-	// 这里需要一个状态映射逻辑，将 Channel 状态映射为 System 状态
-	// 简化假设：只要渠道是 Success，系统也应该是 Success
-	if sys.Status != PaymentSuccess {
-		// 这是一个复杂点：如果渠道成功扣款，但系统状态不是 Success (可能是 Pending 或 Failed)
-		// 这属于 "掉单" (Status Mismatch)
+	if r.Status != PaymentRefunded {
 		res.Status = ReconcileMismatchStatus
-		res.Remark = fmt.Sprintf("Status mismatch: System=%s, Channel=%s (Success)", sys.Status, ch.Status)
+		res.Remark = fmt.Sprintf("Refund status mismatch: System=%s, Channel=%s", r.Status, item.Status)
 		return res
 	}
 
@@ -145,14 +231,309 @@ func (e *ReconciliationEngine) compareTransaction(sys *SystemTransaction, ch *Ch
 	return res
 }
 
-// AutoResolve 尝试自动解决差异 (Strategy Pattern)
-// 针对简单的状态不一致，可以自动修正
-func (e *ReconciliationEngine) AutoResolve(res *ReconcileResult, repo PaymentRepository) error {
-	if res.Status == ReconcileMismatchStatus {
-		// 场景：渠道成功，系统失败/处理中 -> 自动修补为成功
-		// 这是一个高风险操作，通常需要记录详细日志
-		// repo.UpdateStatus(...)
-		return nil
+// MissingPayment 短款：系统已支付但渠道账单中未出现的支付单
+func (e *ReconciliationEngine) MissingPayment(p *Payment) *ReconcileResult {
+	return &ReconcileResult{
+		Subject:       ReconcileSubjectPayment,
+		Status:        ReconcileMissingChannel,
+		PaymentNo:     p.PaymentNo,
+		TransactionID: p.TransactionID,
+		PaymentID:     uint64(p.ID),
+		UserID:        p.UserID,
+		SystemStatus:  p.Status,
+		SystemAmount:  p.GatewayAmount(),
+		Remark:        "Payment found in system but missing in channel bill",
+	}
+}
+
+// MissingRefund 短款：系统已退款但渠道账单中未出现的退款单
+func (e *ReconciliationEngine) MissingRefund(r *Refund) *ReconcileResult {
+	return &ReconcileResult{
+		Subject:       ReconcileSubjectRefund,
+		Status:        ReconcileMissingChannel,
+		PaymentNo:     r.PaymentNo,
+		RefundNo:      r.RefundNo,
+		TransactionID: r.GatewayRefundID,
+		PaymentID:     r.PaymentID,
+		UserID:        r.UserID,
+		SystemStatus:  r.Status,
+		SystemAmount:  r.GatewayAmount(),
+		Remark:        "Refund found in system but missing in channel bill",
+	}
+}
+
+// AutoResolve 识别差异对应的已知模式并写入 res.Pattern，未识别时返回 ErrManualResolution
+// 引擎只负责识别，修复动作 (查询渠道补推结果等) 由应用层执行，且以渠道实时状态为准
+func (e *ReconciliationEngine) AutoResolve(res *ReconcileResult) error {
+	if res.Status != ReconcileMismatchStatus {
+		return ErrManualResolution
+	}
+	switch {
+	case res.Subject == ReconcileSubjectPayment && (res.SystemStatus == PaymentPending || res.SystemStatus == PaymentAuthorized):
+		res.Pattern = PatternLateCallback
+	case res.Subject == ReconcileSubjectRefund && res.SystemStatus == PaymentRefunding:
+		res.Pattern = PatternLateRefund
+	default:
+		return ErrManualResolution
+	}
+	return nil
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// --- Reconciliation Runs ---
+
+// ReconcileRunStatus 对账批次状态
+type ReconcileRunStatus string
+
+const (
+	ReconcileRunRunning   ReconcileRunStatus = "RUNNING"
+	ReconcileRunCompleted ReconcileRunStatus = "COMPLETED"
+	ReconcileRunFailed    ReconcileRunStatus = "FAILED"
+)
+
+// ReconciliationRun 单渠道单账单日的对账批次，即对账汇总报告中的一行。重跑同一账单日生成新批次。
+type ReconciliationRun struct {
+	gorm.Model
+	RunNo               string             `gorm:"uniqueIndex;size:64"`
+	BillDate            string             `gorm:"index;size:10"`
+	ChannelCode         string             `gorm:"index;size:32"`
+	ChannelType         ChannelType        `gorm:"size:32"`
+	Status              ReconcileRunStatus `gorm:"size:16"`
+	BillItems           int64              // 账单明细行数
+	PaymentCount        int64
+	PaymentAmount       int64 // 账单支付金额合计 (分)
+	RefundCount         int64
+	RefundAmount        int64 // 账单退款金额合计 (分)
+	FeeAmount           int64 // 账单手续费合计 (分)
+	MatchedCount        int64
+	AutoResolvedCount   int64
+	BreakCount          int64 // 转人工处理的差异数
+	MissingSystemCount  int64
+	MissingChannelCount int64
+	DiffAmount          int64  // 转人工处理的差异金额绝对值合计 (分)
+	Error               string `gorm:"size:512"`
+	StartedAt           time.Time
+	FinishedAt          *time.Time
+}
+
+// NewReconciliationRun 创建对账批次
+func NewReconciliationRun(runNo, billDate string, channel *ChannelConfig) *ReconciliationRun {
+	return &ReconciliationRun{
+		RunNo:       runNo,
+		BillDate:    billDate,
+		ChannelCode: channel.Code,
+		ChannelType: channel.Type,
+		Status:      ReconcileRunRunning,
+		StartedAt:   time.Now(),
+	}
+}
+
+// Tally 将单笔对账结果计入批次汇总。resolved 表示差异已自动处理
+func (r *ReconciliationRun) Tally(res *ReconcileResult, resolved bool) {
+	if res.Status != ReconcileMissingChannel {
+		r.BillItems++
+		r.FeeAmount += res.ChannelFee
+		if res.Subject == ReconcileSubjectRefund {
+			r.RefundCount++
+			r.RefundAmount += res.ChannelAmount
+		} else {
+			r.PaymentCount++
+			r.PaymentAmount += res.ChannelAmount
+		}
+	}
+
+	switch res.Status {
+	case ReconcileMatch:
+		r.MatchedCount++
+		return
+	case ReconcileMissingSystem:
+		r.MissingSystemCount++
+	case ReconcileMissingChannel:
+		r.MissingChannelCount++
+	}
+	if resolved {
+		r.AutoResolvedCount++
+		return
+	}
+	r.BreakCount++
+	r.DiffAmount += abs(res.DiffAmount())
+}
+
+// Complete 标记批次完成
+func (r *ReconciliationRun) Complete() {
+	now := time.Now()
+	r.Status = ReconcileRunCompleted
+	r.FinishedAt = &now
+}
+
+// Fail 标记批次失败，已核对的明细与差异保留，重跑时按差异对象归并
+func (r *ReconciliationRun) Fail(err error) {
+	now := time.Now()
+	r.Status = ReconcileRunFailed
+	r.Error = truncate(err.Error(), 512)
+	r.FinishedAt = &now
+}
+
+// --- Reconciliation Breaks ---
+
+// BreakStatus 差异处理状态
+type BreakStatus string
+
+const (
+	BreakOpen         BreakStatus = "OPEN"          // 待处理
+	BreakAssigned     BreakStatus = "ASSIGNED"      // 已指派处理人
+	BreakAutoResolved BreakStatus = "AUTO_RESOLVED" // 已按已知模式自动处理
+	BreakClosed       BreakStatus = "CLOSED"        // 已人工关闭
+)
+
+// ReconciliationRecord 对账差异 (break)。核对一致的明细只计入批次汇总，不单独落库；
+// 同一渠道同一笔支付或退款的未关闭差异按 SubjectKey 归并，重跑对账只刷新核对结果。
+type ReconciliationRecord struct {
+	gorm.Model
+	RunNo         string           `gorm:"index;size:64"` // 最近一次发现该差异的批次
+	BillDate      string           `gorm:"index;size:10"`
+	ChannelCode   string           `gorm:"index:idx_recon_subject;size:32"`
+	SubjectKey    string           `gorm:"index:idx_recon_subject;size:96"`
+	Subject       ReconcileSubject `gorm:"size:16"`
+	PaymentID     uint64           `gorm:"index"`
+	UserID        uint64
+	PaymentNo     string `gorm:"index;size:64"`
+	RefundNo      string `gorm:"size:64"`
+	TransactionID string `gorm:"size:128"`
+	SystemStatus  string `gorm:"size:32"`
+	SystemAmount  int64
+	GatewayAmount int64
+	DiffAmount    int64
+	ExpectedFee   int64
+	GatewayFee    int64
+	Status        ReconcileStatus   `gorm:"size:32"`
+	Pattern       ResolutionPattern `gorm:"size:32"`
+	BreakStatus   BreakStatus       `gorm:"index;size:16"`
+	Assignee      string            `gorm:"index;size:64"`
+	Resolution    string            `gorm:"size:255"`
+	ResolvedBy    string            `gorm:"size:64"`
+	ResolvedAt    *time.Time
+	Remark        string                `gorm:"size:255"`
+	Notes         []*ReconciliationNote `gorm:"foreignKey:RecordID"`
+}
+
+// ReconciliationNote 差异处理备注，指派与关闭操作同时留痕
+type ReconciliationNote struct {
+	gorm.Model
+	RecordID uint64 `gorm:"index"`
+	Author   string `gorm:"size:64"`
+	Content  string `gorm:"size:1024"`
+}
+
+// NewReconciliationRecord 由对账结果创建待处理差异
+func NewReconciliationRecord(run *ReconciliationRun, res *ReconcileResult) *ReconciliationRecord {
+	r := &ReconciliationRecord{
+		ChannelCode: run.ChannelCode,
+		SubjectKey:  res.SubjectKey(),
+		Subject:     res.Subject,
+		BreakStatus: BreakOpen,
+	}
+	r.Refresh(run, res)
+	return r
+}
+
+// Refresh 以最新一次核对结果更新差异内容，处理状态与指派保持不变
+func (r *ReconciliationRecord) Refresh(run *ReconciliationRun, res *ReconcileResult) {
+	r.RunNo = run.RunNo
+	r.BillDate = run.BillDate
+	r.PaymentID = res.PaymentID
+	r.UserID = res.UserID
+	r.PaymentNo = res.PaymentNo
+	r.RefundNo = res.RefundNo
+	r.TransactionID = res.TransactionID
+	r.SystemStatus = ""
+	if res.SystemStatus != 0 {
+		r.SystemStatus = res.SystemStatus.String()
+	}
+	r.SystemAmount = res.SystemAmount
+	r.GatewayAmount = res.ChannelAmount
+	r.DiffAmount = res.DiffAmount()
+	r.ExpectedFee = res.ExpectedFee
+	r.GatewayFee = res.ChannelFee
+	r.Status = res.Status
+	r.Pattern = res.Pattern
+	r.Remark = truncate(res.Remark, 255)
+}
+
+// IsOpen 差异是否仍待处理
+func (r *ReconciliationRecord) IsOpen() bool {
+	return r.BreakStatus == BreakOpen || r.BreakStatus == BreakAssigned
+}
+
+// Assign 指派处理人，已指派的差异可改派
+func (r *ReconciliationRecord) Assign(assignee string) error {
+	if !r.IsOpen() {
+		return ErrBreakClosed
+	}
+	r.Assignee = assignee
+	r.BreakStatus = BreakAssigned
+	return nil
+}
+
+// Close 人工关闭差异，须说明处理结论
+func (r *ReconciliationRecord) Close(operator, resolution string) error {
+	if !r.IsOpen() {
+		return ErrBreakClosed
+	}
+	now := time.Now()
+	r.BreakStatus = BreakClosed
+	r.Resolution = truncate(resolution, 255)
+	r.ResolvedBy = operator
+	r.ResolvedAt = &now
+	return nil
+}
+
+// AutoResolve 按已知模式自动关闭差异
+func (r *ReconciliationRecord) AutoResolve(pattern ResolutionPattern, resolution string) {
+	now := time.Now()
+	r.Pattern = pattern
+	r.BreakStatus = BreakAutoResolved
+	r.Resolution = truncate(resolution, 255)
+	r.ResolvedBy = "system"
+	r.ResolvedAt = &now
+}
+
+// BreakFilter 差异列表查询条件，空值表示不限
+type BreakFilter struct {
+	BillDate    string
+	ChannelCode string
+	BreakStatus BreakStatus
+	Assignee    string
+}
+
+// ReconciliationRepository 对账批次与差异仓储，存储于全局库
+type ReconciliationRepository interface {
+	SaveRun(ctx context.Context, run *ReconciliationRun) error
+	// ListRuns 按账单日查询批次，channelCode 为空时返回所有渠道
+	ListRuns(ctx context.Context, billDate, channelCode string) ([]*ReconciliationRun, error)
+
+	// FindBySubjectKeys 查询渠道下差异对象的最近一条差异记录，返回值以 SubjectKey 为键
+	FindBySubjectKeys(ctx context.Context, channelCode string, subjectKeys []string) (map[string]*ReconciliationRecord, error)
+	// FindBreakByID 查询差异及其备注，不存在时返回 nil
+	FindBreakByID(ctx context.Context, id uint64) (*ReconciliationRecord, error)
+	SaveBreak(ctx context.Context, record *ReconciliationRecord) error
+	ListBreaks(ctx context.Context, filter *BreakFilter, offset, limit int) ([]*ReconciliationRecord, int64, error)
+	SaveNote(ctx context.Context, note *ReconciliationNote) error
+}
+
+// truncate 按字节上限截断文本，不截断多字节字符。
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
 	}
-	return errors.New("manual intervention required")
+	return s[:n]
 }
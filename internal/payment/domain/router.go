@@ -3,7 +3,7 @@ package domain
 import (
 	"context"
 	"errors"
-	"math"
+	"fmt"
 	"sort"
 
 	"github.com/shopspring/decimal"
@@ -11,18 +11,31 @@ import (
 
 // RouteContext 路由上下文：包含决策所需的所有信息
 type RouteContext struct {
+	OrderID       uint64
 	UserID        uint64
+	MerchantID    uint64 // 单商户订单的商户 ID，多商户订单为 0
 	Amount        decimal.Decimal
 	Currency      string
 	ClientIP      string
 	PaymentMethod string // CARD, WALLET, BANK_TRANSFER
 	CardBin       string // 信用卡前6位，用于识别发卡行/卡组
 	Platform      string // iOS, Android, Web
+	// Health 候选渠道的实时健康度 (key: channel_code)，缺失的渠道按无样本处理
+	Health map[string]*ChannelHealth
+}
+
+// health 返回渠道健康度，无统计时返回空样本。
+func (rc *RouteContext) health(code string) *ChannelHealth {
+	if h, ok := rc.Health[code]; ok && h != nil {
+		return h
+	}
+	return &ChannelHealth{ChannelCode: code}
 }
 
 // ChannelScore 渠道评分结果
 type ChannelScore struct {
 	ChannelCode   string
+	Channel       *ChannelConfig
 	Score         float64 // 分数越高越好
 	EstimatedCost decimal.Decimal
 	Reason        string
@@ -31,8 +44,8 @@ type ChannelScore struct {
 // RouterStrategy 路由策略接口
 type RouterStrategy interface {
 	Name() string
-	// SelectOptimalChannel 返回最佳渠道代码
-	SelectOptimalChannel(ctx context.Context, routeCtx *RouteContext, candidates []*ChannelConfig) (*ChannelConfig, error)
+	// Score 为每个候选渠道评分，分数越高越优
+	Score(ctx context.Context, routeCtx *RouteContext, candidates []*ChannelConfig) []*ChannelScore
 }
 
 // SmartRouter 智能路由引擎
@@ -43,16 +56,24 @@ type SmartRouter struct {
 func NewSmartRouter() *SmartRouter {
 	return &SmartRouter{
 		strategies: []RouterStrategy{
-			&AvailabilityFirstStrategy{}, // 默认策略：可用性优先
-			&CostBasedStrategy{},         // 进阶策略：成本优先
+			&AvailabilityFirstStrategy{},   // 默认策略：可用性优先
+			&CostBasedStrategy{},           // 进阶策略：成本优先
+			&SuccessRateWeightedStrategy{}, // 高级策略：成功率加权
 		},
 	}
 }
 
-// Route 根据配置和上下文选择最佳渠道
-func (r *SmartRouter) Route(ctx context.Context, routeCtx *RouteContext, candidates []*ChannelConfig, strategyName string) (*ChannelConfig, error) {
-	if len(candidates) == 0 {
-		return nil, errors.New("no available channels")
+// Route 根据配置和上下文选择最佳渠道，同时返回全部候选渠道的评分 (按分数降序) 供决策审计。
+// 分数相同时按 Priority 降序，再按渠道代码排序，保证多副本决策一致。
+func (r *SmartRouter) Route(ctx context.Context, routeCtx *RouteContext, candidates []*ChannelConfig, strategyName string) (*ChannelConfig, []*ChannelScore, error) {
+	active := make([]*ChannelConfig, 0, len(candidates))
+	for _, c := range candidates {
+		if c.Enabled {
+			active = append(active, c)
+		}
+	}
+	if len(active) == 0 {
+		return nil, nil, errors.New("no available channels")
 	}
 
 	var strategy RouterStrategy
@@ -62,12 +83,29 @@ func (r *SmartRouter) Route(ctx context.Context, routeCtx *RouteContext, candida
 			break
 		}
 	}
-	// Fallback to first strategy if not found
-	if strategy == nil && len(r.strategies) > 0 {
-		strategy = r.strategies[0]
+	if strategy == nil {
+		return nil, nil, fmt.Errorf("unknown routing strategy %q", strategyName)
 	}
 
-	return strategy.SelectOptimalChannel(ctx, routeCtx, candidates)
+	scores := strategy.Score(ctx, routeCtx, active)
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		if scores[i].Channel.Priority != scores[j].Channel.Priority {
+			return scores[i].Channel.Priority > scores[j].Channel.Priority
+		}
+		return scores[i].ChannelCode < scores[j].ChannelCode
+	})
+	return scores[0].Channel, scores, nil
+}
+
+// estimatedCost 按费率估算渠道手续费。
+// Cost = Amount * RatePercent + FixedFee (假设 FixedFee 存在于 ConfigJSON 解析后的结构中)
+// 这里简化模型，仅使用 RatePercent；阶梯费率 (Tiered Pricing) 是逻辑扩展点
+func estimatedCost(routeCtx *RouteContext, c *ChannelConfig) decimal.Decimal {
+	rate := decimal.NewFromFloat(c.RatePercent).Div(decimal.NewFromInt(100))
+	return routeCtx.Amount.Mul(rate)
 }
 
 // --- Concrete Strategies ---
@@ -77,27 +115,20 @@ func (r *SmartRouter) Route(ctx context.Context, routeCtx *RouteContext, candida
 // 这是最基础的逻辑，通常用于系统冷启动或降级模式。
 type AvailabilityFirstStrategy struct{}
 
-func (s *AvailabilityFirstStrategy) Name() string { return "AVAILABILITY_FIRST" }
+func (s *AvailabilityFirstStrategy) Name() string { return StrategyAvailabilityFirst }
 
-func (s *AvailabilityFirstStrategy) SelectOptimalChannel(ctx context.Context, routeCtx *RouteContext, candidates []*ChannelConfig) (*ChannelConfig, error) {
-	// 过滤已禁用的 (假设 candidates 已经经过基础过滤，这里再保险一次)
-	active := make([]*ChannelConfig, 0)
+func (s *AvailabilityFirstStrategy) Score(ctx context.Context, routeCtx *RouteContext, candidates []*ChannelConfig) []*ChannelScore {
+	scores := make([]*ChannelScore, 0, len(candidates))
 	for _, c := range candidates {
-		if c.Enabled {
-			active = append(active, c)
-		}
+		scores = append(scores, &ChannelScore{
+			ChannelCode:   c.Code,
+			Channel:       c,
+			Score:         float64(c.Priority),
+			EstimatedCost: estimatedCost(routeCtx, c),
+			Reason:        fmt.Sprintf("priority=%d", c.Priority),
+		})
 	}
-
-	if len(active) == 0 {
-		return nil, errors.New("no active channels available")
-	}
-
-	// 按 Priority 降序排序 (Priority 值越大优先级越高)
-	sort.Slice(active, func(i, j int) bool {
-		return active[i].Priority > active[j].Priority
-	})
-
-	return active[0], nil
+	return scores
 }
 
 // CostBasedStrategy 成本优先策略
@@ -105,60 +136,76 @@ func (s *AvailabilityFirstStrategy) SelectOptimalChannel(ctx context.Context, ro
 // 这是一个典型的“复杂业务逻辑”，直接影响公司利润。
 type CostBasedStrategy struct{}
 
-func (s *CostBasedStrategy) Name() string { return "COST_BASED" }
+func (s *CostBasedStrategy) Name() string { return StrategyCostBased }
 
-func (s *CostBasedStrategy) SelectOptimalChannel(ctx context.Context, routeCtx *RouteContext, candidates []*ChannelConfig) (*ChannelConfig, error) {
-	if len(candidates) == 0 {
-		return nil, errors.New("no candidates")
+func (s *CostBasedStrategy) Score(ctx context.Context, routeCtx *RouteContext, candidates []*ChannelConfig) []*ChannelScore {
+	scores := make([]*ChannelScore, 0, len(candidates))
+	for _, c := range candidates {
+		cost := estimatedCost(routeCtx, c)
+		// 成本取负作为分数，成本相同时由 Route 按 Priority 排序
+		score, _ := cost.Neg().Float64()
+		scores = append(scores, &ChannelScore{
+			ChannelCode:   c.Code,
+			Channel:       c,
+			Score:         score,
+			EstimatedCost: cost,
+			Reason:        fmt.Sprintf("estimated_cost=%s", cost.StringFixed(2)),
+		})
 	}
+	return scores
+}
+
+// 成功率加权策略的权重。
+const (
+	successRateWeight = 0.7
+	costWeight        = 0.2
+	latencyWeight     = 0.1
+)
+
+// SuccessRateWeightedStrategy 成功率加权策略 (高级)
+// 逻辑：结合滑动窗口成功率、成本与 P95 延迟。
+// Score = 0.7 * SuccessRate + 0.2 * (1 - Cost/MaxCost) + 0.1 * (1 - P95/MaxP95)
+// 成本与延迟在候选渠道间归一化，成功率使用平滑值，样本不足的渠道不会被个别失败过度惩罚。
+type SuccessRateWeightedStrategy struct{}
 
-	var bestChannel *ChannelConfig
-	minCost := decimal.NewFromFloat(math.MaxFloat64)
+func (s *SuccessRateWeightedStrategy) Name() string { return StrategySuccessRateWeighted }
 
+func (s *SuccessRateWeightedStrategy) Score(ctx context.Context, routeCtx *RouteContext, candidates []*ChannelConfig) []*ChannelScore {
+	maxCost := decimal.Zero
+	var maxP95 float64
 	for _, c := range candidates {
-		if !c.Enabled {
-			continue
+		if cost := estimatedCost(routeCtx, c); cost.GreaterThan(maxCost) {
+			maxCost = cost
 		}
-
-		// 计算预估成本
-		// Cost = Amount * RatePercent + FixedFee (假设 FixedFee 存在于 ConfigJSON 解析后的结构中)
-		// 这里简化模型，仅使用 RatePercent
-		rate := decimal.NewFromFloat(c.RatePercent).Div(decimal.NewFromInt(100))
-		estimatedCost := routeCtx.Amount.Mul(rate)
-
-		// 假设还有复杂的 Tiered Pricing (阶梯费率)，这里是逻辑扩展点
-
-		if estimatedCost.LessThan(minCost) {
-			minCost = estimatedCost
-			bestChannel = c
-		} else if estimatedCost.Equal(minCost) {
-			// 成本相同，比较 Priority
-			if bestChannel == nil || c.Priority > bestChannel.Priority {
-				bestChannel = c
-			}
+		if p95 := float64(routeCtx.health(c.Code).LatencyP95); p95 > maxP95 {
+			maxP95 = p95
 		}
 	}
 
-	if bestChannel == nil {
-		return nil, errors.New("no suitable channel found after cost analysis")
-	}
-
-	return bestChannel, nil
-}
-
-// SuccessRateWeightedStrategy 成功率加权策略 (高级)
-// 逻辑：结合成功率和成本。 Score = w1 * (1/Cost) + w2 * SuccessRate
-// 成功率通常来自 Prometheus 监控或 Redis 实时统计
-type SuccessRateWeightedStrategy struct {
-	// 依赖 Metrics 服务获取实时成功率
-}
-
-func (s *SuccessRateWeightedStrategy) Name() string { return "SUCCESS_RATE_WEIGHTED" }
+	scores := make([]*ChannelScore, 0, len(candidates))
+	for _, c := range candidates {
+		h := routeCtx.health(c.Code)
+		cost := estimatedCost(routeCtx, c)
 
-func (s *SuccessRateWeightedStrategy) SelectOptimalChannel(ctx context.Context, routeCtx *RouteContext, candidates []*ChannelConfig) (*ChannelConfig, error) {
-	// 这是一个占位符，展示顶级系统会怎么做：
-	// 1. GetSuccessRate(channelID, timeWindow="5m")
-	// 2. Normalize inputs
-	// 3. Calculate Score
-	return nil, errors.New("not implemented yet")
+		costScore := 1.0
+		if maxCost.IsPositive() {
+			ratio, _ := cost.Div(maxCost).Float64()
+			costScore = 1 - ratio
+		}
+		latencyScore := 1.0
+		if maxP95 > 0 {
+			latencyScore = 1 - float64(h.LatencyP95)/maxP95
+		}
+		successRate := h.SuccessRate()
+
+		scores = append(scores, &ChannelScore{
+			ChannelCode:   c.Code,
+			Channel:       c,
+			Score:         successRateWeight*successRate + costWeight*costScore + latencyWeight*latencyScore,
+			EstimatedCost: cost,
+			Reason: fmt.Sprintf("success_rate=%.4f(%d/%d) estimated_cost=%s p95=%s",
+				successRate, h.Success, h.Total(), cost.StringFixed(2), h.LatencyP95),
+		})
+	}
+	return scores
 }
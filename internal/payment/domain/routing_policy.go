@@ -0,0 +1,185 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 路由策略名称。
+const (
+	StrategyAvailabilityFirst   = "AVAILABILITY_FIRST"
+	StrategyCostBased           = "COST_BASED"
+	StrategySuccessRateWeighted = "SUCCESS_RATE_WEIGHTED"
+)
+
+// 路由分流组。
+const (
+	RouteVariantA = "A" // 主策略
+	RouteVariantB = "B" // 实验策略
+)
+
+var (
+	// ErrInvalidRoutingPolicy 路由规则配置不合法。
+	ErrInvalidRoutingPolicy = errors.New("invalid routing policy")
+	// ErrRoutingPolicyNotFound 路由规则不存在。
+	ErrRoutingPolicyNotFound = errors.New("routing policy not found")
+)
+
+// RoutingPolicy 路由规则：按商户、支付方式与金额区间匹配路由策略，可将部分流量分给实验策略做 A/B 对比。
+// 多条规则同时命中时取 Priority 最高者，优先级相同时取匹配条件更具体者。
+type RoutingPolicy struct {
+	gorm.Model
+	Name          string `gorm:"uniqueIndex;size:64;not null" json:"name"`
+	MerchantID    uint64 `gorm:"index;default:0" json:"merchant_id"` // 0 表示全部商户
+	PaymentMethod string `gorm:"size:32" json:"payment_method"`      // 为空表示全部支付方式
+	MinAmount     int64  `gorm:"default:0" json:"min_amount"`        // 金额下限 (含)
+	MaxAmount     int64  `gorm:"default:0" json:"max_amount"`        // 金额上限 (不含)，0 表示不限
+	Strategy      string `gorm:"size:32;not null" json:"strategy"`   // A 组策略
+	AltStrategy   string `gorm:"size:32" json:"alt_strategy"`        // B 组策略，为空时不分流
+	AltPercent    int    `gorm:"default:0" json:"alt_percent"`       // B 组流量占比 (0-100)
+	Priority      int    `gorm:"default:0" json:"priority"`
+	Enabled       bool   `gorm:"default:true" json:"enabled"`
+	Description   string `gorm:"size:255" json:"description"`
+}
+
+// Validate 校验策略名称、分流比例与金额区间。
+func (p *RoutingPolicy) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRoutingPolicy)
+	}
+	if !IsRoutingStrategy(p.Strategy) {
+		return fmt.Errorf("%w: unknown strategy %q", ErrInvalidRoutingPolicy, p.Strategy)
+	}
+	if p.AltStrategy != "" && !IsRoutingStrategy(p.AltStrategy) {
+		return fmt.Errorf("%w: unknown alt strategy %q", ErrInvalidRoutingPolicy, p.AltStrategy)
+	}
+	if p.AltPercent < 0 || p.AltPercent > 100 {
+		return fmt.Errorf("%w: alt_percent must be within 0-100", ErrInvalidRoutingPolicy)
+	}
+	if p.MinAmount < 0 || (p.MaxAmount > 0 && p.MaxAmount <= p.MinAmount) {
+		return fmt.Errorf("%w: invalid amount band [%d, %d)", ErrInvalidRoutingPolicy, p.MinAmount, p.MaxAmount)
+	}
+	return nil
+}
+
+// Matches 判断规则是否适用于该笔支付。
+func (p *RoutingPolicy) Matches(merchantID uint64, method string, amount int64) bool {
+	if !p.Enabled {
+		return false
+	}
+	if p.MerchantID != 0 && p.MerchantID != merchantID {
+		return false
+	}
+	if p.PaymentMethod != "" && p.PaymentMethod != method {
+		return false
+	}
+	if amount < p.MinAmount {
+		return false
+	}
+	return p.MaxAmount == 0 || amount < p.MaxAmount
+}
+
+// specificity 匹配条件的具体程度。
+func (p *RoutingPolicy) specificity() int {
+	n := 0
+	if p.MerchantID != 0 {
+		n += 4
+	}
+	if p.PaymentMethod != "" {
+		n += 2
+	}
+	if p.MinAmount > 0 || p.MaxAmount > 0 {
+		n++
+	}
+	return n
+}
+
+// Variant 按分流键确定该笔支付所属分组与策略。同一分流键 (订单) 重复发起时落在同一组，保证实验样本稳定。
+func (p *RoutingPolicy) Variant(key uint64) (variant, strategy string) {
+	if p.AltStrategy == "" || p.AltPercent <= 0 {
+		return RouteVariantA, p.Strategy
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%d", p.ID, key)
+	if int(h.Sum32()%100) < p.AltPercent {
+		return RouteVariantB, p.AltStrategy
+	}
+	return RouteVariantA, p.Strategy
+}
+
+// MatchPolicy 从规则集中选出适用于该笔支付的规则，未命中时返回 nil。
+func MatchPolicy(policies []*RoutingPolicy, merchantID uint64, method string, amount int64) *RoutingPolicy {
+	var best *RoutingPolicy
+	for _, p := range policies {
+		if !p.Matches(merchantID, method, amount) {
+			continue
+		}
+		if best == nil || p.Priority > best.Priority || (p.Priority == best.Priority && p.specificity() > best.specificity()) {
+			best = p
+		}
+	}
+	return best
+}
+
+// IsRoutingStrategy 判断是否为已支持的路由策略。
+func IsRoutingStrategy(name string) bool {
+	switch name {
+	case StrategyAvailabilityFirst, StrategyCostBased, StrategySuccessRateWeighted:
+		return true
+	}
+	return false
+}
+
+// RouteCandidate 路由决策中单个候选渠道的评估结果。
+type RouteCandidate struct {
+	ChannelCode string  `json:"channel_code"`
+	Score       float64 `json:"score"`
+	Reason      string  `json:"reason"`
+	SuccessRate float64 `json:"success_rate"`
+	LatencyP95  int64   `json:"latency_p95_ms"`
+	Breaker     string  `json:"breaker"`
+	Excluded    string  `json:"excluded,omitempty"` // 未参与评分的原因 (熔断、币种不支持等)
+}
+
+// RouteDecision 路由决策日志，记录命中规则、分流组、各候选渠道评分与最终选择，用于审计与策略效果对比。
+type RouteDecision struct {
+	gorm.Model
+	OrderID       uint64 `gorm:"index" json:"order_id"`
+	UserID        uint64 `json:"user_id"`
+	MerchantID    uint64 `gorm:"index" json:"merchant_id"`
+	PaymentMethod string `gorm:"size:32" json:"payment_method"`
+	Currency      string `gorm:"size:3" json:"currency"`
+	Amount        int64  `json:"amount"`
+	PolicyID      uint64 `json:"policy_id"` // 0 表示未命中规则，使用默认策略
+	PolicyName    string `gorm:"size:64" json:"policy_name"`
+	Variant       string `gorm:"size:8;index" json:"variant"`
+	Strategy      string `gorm:"size:32;index" json:"strategy"`
+	ChannelCode   string `gorm:"size:32;index" json:"channel_code"`
+	Fallback      string `gorm:"size:255" json:"fallback"`    // 策略降级或无可用渠道的原因
+	Candidates    string `gorm:"type:text" json:"candidates"` // []RouteCandidate (JSON)
+	Reason        string `gorm:"size:255" json:"reason"`      // 最终选择的理由
+}
+
+// RouteDecisionFilter 路由决策日志查询条件。
+type RouteDecisionFilter struct {
+	OrderID     uint64
+	MerchantID  uint64
+	ChannelCode string
+	Strategy    string
+	Variant     string
+	Since       *time.Time
+}
+
+// RoutingRepository 路由规则与决策日志仓储，全局数据存储在第一个分片。
+type RoutingRepository interface {
+	ListPolicies(ctx context.Context) ([]*RoutingPolicy, error)
+	FindPolicy(ctx context.Context, id uint64) (*RoutingPolicy, error)
+	SavePolicy(ctx context.Context, policy *RoutingPolicy) error
+	SaveDecision(ctx context.Context, decision *RouteDecision) error
+	ListDecisions(ctx context.Context, filter *RouteDecisionFilter, offset, limit int) ([]*RouteDecision, int64, error)
+}
@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultPaymentTTL 支付单有效期，超时仍未支付的交易在渠道侧关闭。
+const DefaultPaymentTTL = 30 * time.Minute
+
+// DefaultAuthorizationHold 未单独配置的渠道的授权有效期，取较短值以保证在渠道自动撤销授权之前释放。
+const DefaultAuthorizationHold = 24 * time.Hour
+
+// authorizationHold 各渠道授权冻结资金的有效期，超出后渠道自动撤销授权。
+var authorizationHold = map[GatewayType]time.Duration{
+	GatewayTypeStripe: 7 * 24 * time.Hour, // 在线卡授权 7 天后由发卡行释放
+}
+
+// queryBackoff 主动查询的退避间隔，超出后按最后一档重复。
+var queryBackoff = []time.Duration{
+	15 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	2 * time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+}
+
+// GatewayTradeState 渠道侧交易状态。
+type GatewayTradeState int
+
+const (
+	GatewayTradePending    GatewayTradeState = iota // 未支付或支付中 (含预创建后尚未扫码)
+	GatewayTradeSuccess                             // 支付成功 (含已支付后发生退款)
+	GatewayTradeClosed                              // 已关闭、已撤销或支付失败
+	GatewayTradeAuthorized                          // 渠道已授权冻结资金，等待本方扣款 (如 Stripe requires_capture)
+)
+
+// GatewayTradeResult 渠道订单查询结果。
+type GatewayTradeResult struct {
+	TransactionID string
+	State         GatewayTradeState
+	Amount        int64 // 支付成功时为实付金额，否则为下单金额
+	Currency      string
+	RawResponse   string
+}
+
+// Notification 将查询结果转为与异步通知一致的支付结果，以复用同一套核对与状态推进逻辑。
+func (r *GatewayTradeResult) Notification(gatewayType GatewayType, paymentNo string) *PaymentNotification {
+	n := &PaymentNotification{
+		Gateway:       gatewayType,
+		PaymentNo:     paymentNo,
+		TransactionID: r.TransactionID,
+		Result:        NotifyResultPending,
+		Amount:        r.Amount,
+		Currency:      r.Currency,
+		RawPayload:    r.RawResponse,
+		Queried:       true,
+	}
+	switch r.State {
+	case GatewayTradeSuccess:
+		n.Result = NotifyResultSuccess
+	case GatewayTradeClosed:
+		n.Result = NotifyResultFailed
+	}
+	return n
+}
+
+// AwaitingResult 支付单是否仍在等待渠道支付结果。
+func (p *Payment) AwaitingResult() bool {
+	return p.Status == PaymentPending || p.Status == PaymentAuthorized
+}
+
+// Paid 渠道是否已完成扣款 (含之后发生退款或已对账)。
+func (p *Payment) Paid() bool {
+	switch p.Status {
+	case PaymentSuccess, PaymentRefunding, PaymentRefunded, PaymentReconciled, PaymentReconcileError:
+		return true
+	}
+	return false
+}
+
+// ScheduleQuery 初始化有效期与首次主动查询时间。
+func (p *Payment) ScheduleQuery(now time.Time) {
+	if p.ExpiresAt == nil {
+		expiresAt := now.Add(DefaultPaymentTTL)
+		p.ExpiresAt = &expiresAt
+	}
+	p.QueryAttempts = 0
+	next := now.Add(queryBackoff[0])
+	p.NextQueryAt = &next
+}
+
+// NextQueryTime 按已查询次数计算下一次查询时间。有效期内的最后一次查询对齐到过期时刻，保证超时交易按时关闭。
+func (p *Payment) NextQueryTime(now time.Time) time.Time {
+	next := now.Add(queryBackoff[min(p.QueryAttempts+1, len(queryBackoff)-1)])
+	if p.ExpiresAt != nil && now.Before(*p.ExpiresAt) && next.After(*p.ExpiresAt) {
+		return *p.ExpiresAt
+	}
+	return next
+}
+
+// Expired 支付单是否已超过有效期。
+func (p *Payment) Expired(now time.Time) bool {
+	return p.ExpiresAt != nil && !now.Before(*p.ExpiresAt)
+}
+
+// AuthorizationHold 渠道授权冻结资金的有效期。
+func AuthorizationHold(gatewayType GatewayType) time.Duration {
+	if d, ok := authorizationHold[gatewayType]; ok {
+		return d
+	}
+	return DefaultAuthorizationHold
+}
+
+// AuthorizationExpired 渠道授权是否已超过渠道授权有效期。
+// 授权不早于支付单创建，按创建时间计算可保证在渠道自动撤销授权之前释放。
+func (p *Payment) AuthorizationExpired(now time.Time) bool {
+	return !now.Before(p.CreatedAt.Add(AuthorizationHold(p.GatewayType)))
+}
+
+// Expire 渠道侧交易关闭后取消超时未支付的支付单。
+func (p *Payment) Expire(ctx context.Context) error {
+	event := "CANCEL"
+	if p.Status == PaymentAuthorized {
+		event = "VOID"
+	}
+	if err := p.Trigger(ctx, event, "Payment expired and closed at gateway"); err != nil {
+		return err
+	}
+	now := time.Now()
+	p.FailureReason = "payment expired"
+	p.settleGatewayLeg(false, "", p.FailureReason)
+	p.CancelledAt = &now
+	p.NextQueryAt = nil
+	return nil
+}
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// StoredValueAccount 用户储值账户，按资金来源与币种分户，随用户分片存储。
+// Balance 含冻结金额，可用余额为 Balance - Frozen；金额均为最小货币单位，积分按可抵扣金额记账。
+type StoredValueAccount struct {
+	gorm.Model
+	UserID   uint64    `gorm:"uniqueIndex:idx_sv_account;not null"`
+	Source   LegSource `gorm:"uniqueIndex:idx_sv_account;size:32;not null"`
+	Currency string    `gorm:"uniqueIndex:idx_sv_account;size:10;not null"`
+	Balance  int64     `gorm:"not null;default:0"`
+	Frozen   int64     `gorm:"not null;default:0"`
+}
+
+// Available 可用余额。
+func (a *StoredValueAccount) Available() int64 {
+	return a.Balance - a.Frozen
+}
+
+// Hold 授权冻结。
+func (a *StoredValueAccount) Hold(amount int64) error {
+	if a.Available() < amount {
+		return fmt.Errorf("%w: %s available %d, required %d", ErrInsufficientBalance, a.Source, a.Available(), amount)
+	}
+	a.Frozen += amount
+	return nil
+}
+
+// Release 撤销授权，解冻金额。
+func (a *StoredValueAccount) Release(amount int64) error {
+	if a.Frozen < amount {
+		return fmt.Errorf("%s account frozen %d less than release %d", a.Source, a.Frozen, amount)
+	}
+	a.Frozen -= amount
+	return nil
+}
+
+// Debit 扣减已冻结的金额。
+func (a *StoredValueAccount) Debit(amount int64) error {
+	if err := a.Release(amount); err != nil {
+		return err
+	}
+	a.Balance -= amount
+	return nil
+}
+
+// Credit 入账 (充值或退款退回)。
+func (a *StoredValueAccount) Credit(amount int64) {
+	a.Balance += amount
+}
+
+// StoredValueEntryType 储值流水类型。
+type StoredValueEntryType string
+
+const (
+	StoredValueHold    StoredValueEntryType = "HOLD"    // 授权冻结
+	StoredValueRelease StoredValueEntryType = "RELEASE" // 撤销解冻
+	StoredValueDebit   StoredValueEntryType = "DEBIT"   // 扣款
+	StoredValueCredit  StoredValueEntryType = "CREDIT"  // 入账
+)
+
+// StoredValueEntry 储值账户流水，每次余额或冻结金额变动记录一条。
+type StoredValueEntry struct {
+	gorm.Model
+	AccountID    uint64               `gorm:"index;not null"`
+	UserID       uint64               `gorm:"index;not null"`
+	Type         StoredValueEntryType `gorm:"size:16;not null"`
+	RefNo        string               `gorm:"size:64;index"` // 业务单号：支付腿号或退款单号
+	Amount       int64                `gorm:"not null"`
+	BalanceAfter int64
+	FrozenAfter  int64
+	Remark       string `gorm:"size:255"`
+}
+
+// StoredValueRepository 储值账户仓储，与支付单同按用户分片，可在支付单事务内使用。
+type StoredValueRepository interface {
+	// FindAccount 查询账户，事务内加行锁；不存在时返回 nil
+	FindAccount(ctx context.Context, userID uint64, source LegSource, currency string) (*StoredValueAccount, error)
+	ListAccounts(ctx context.Context, userID uint64) ([]*StoredValueAccount, error)
+	SaveAccount(ctx context.Context, account *StoredValueAccount) error
+	SaveEntry(ctx context.Context, entry *StoredValueEntry) error
+	Transaction(ctx context.Context, userID uint64, fn func(tx any) error) error
+	WithTx(tx any) StoredValueRepository
+}
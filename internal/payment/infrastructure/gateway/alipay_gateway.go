@@ -1,67 +1,426 @@
 package gateway
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"golang.org/x/text/encoding/simplifiedchinese"
 )
 
-type AlipayGateway struct{}
+// alipayDefaultBaseURL 支付宝开放平台网关地址。
+const alipayDefaultBaseURL = "https://openapi.alipay.com/gateway.do"
 
-func NewAlipayGateway() *AlipayGateway { return &AlipayGateway{} }
+// alipayLocation 支付宝接口时间戳与账单时间均为北京时间。
+var alipayLocation = time.FixedZone("CST", 8*3600)
 
+// AlipayChannelConfig 支付宝渠道配置，对应 ChannelConfig.ConfigJSON。
+type AlipayChannelConfig struct {
+	AppID           string `json:"app_id"`
+	PrivateKey      string `json:"private_key"`       // 应用私钥，用于请求签名
+	AlipayPublicKey string `json:"alipay_public_key"` // 支付宝公钥，用于应答验签
+	NotifyURL       string `json:"notify_url"`
+	BaseURL         string `json:"base_url"` // 为空时使用正式环境网关
+}
+
+// AlipayGateway 支付宝开放平台 (RSA2) 客户端。
+type AlipayGateway struct {
+	cfg        AlipayChannelConfig
+	privateKey *rsa.PrivateKey
+	publicKey  *rsa.PublicKey
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewAlipayGateway 创建支付宝客户端。
+func NewAlipayGateway(cfg AlipayChannelConfig, httpClient *http.Client) (*AlipayGateway, error) {
+	if cfg.AppID == "" {
+		return nil, errors.New("alipay: app_id is required")
+	}
+	privateKey, err := parseRSAPrivateKey(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("alipay: invalid private_key: %w", err)
+	}
+	publicKey, err := parseRSAPublicKey(cfg.AlipayPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("alipay: invalid alipay_public_key: %w", err)
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = alipayDefaultBaseURL
+	}
+	if httpClient == nil {
+		httpClient = NewHTTPClient()
+	}
+	return &AlipayGateway{cfg: cfg, privateKey: privateKey, publicKey: publicKey, httpClient: httpClient, now: time.Now}, nil
+}
+
+// alipayResult 各接口应答的公共字段。
+type alipayResult struct {
+	Code    string `json:"code"`
+	Msg     string `json:"msg"`
+	SubCode string `json:"sub_code"`
+	SubMsg  string `json:"sub_msg"`
+}
+
+// PreAuth 统一收单线下交易预创建 (alipay.trade.precreate)，返回收款二维码。
+// 扫码前支付宝侧尚无交易，交易号在支付通知或查询时获得。
 func (g *AlipayGateway) PreAuth(ctx context.Context, req *domain.PaymentGatewayRequest) (*domain.PaymentGatewayResponse, error) {
-	return &domain.PaymentGatewayResponse{
-		TransactionID: "ALI_AUTH_" + req.OrderID,
-		PaymentURL:    "https://mock.alipay.com/auth",
-	}, nil
+	if req.Currency != "" && req.Currency != "CNY" {
+		return nil, domain.NewGatewayError(domain.GatewayTypeAlipay, domain.ErrGatewayRejected, "UNSUPPORTED_CURRENCY", req.Currency)
+	}
+	subject := req.Description
+	if subject == "" {
+		subject = req.OrderID
+	}
+	var resp struct {
+		alipayResult
+		OutTradeNo string `json:"out_trade_no"`
+		QRCode     string `json:"qr_code"`
+	}
+	raw, err := g.call(ctx, "alipay.trade.precreate", map[string]any{
+		"out_trade_no": req.OrderID,
+		"total_amount": formatMinorUnits(req.Amount, 2),
+		"subject":      subject,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.PaymentGatewayResponse{PaymentURL: resp.QRCode, RawResponse: string(raw)}, nil
+}
+
+// QueryTrade 统一收单交易查询 (alipay.trade.query)。预创建后未扫码的交易在支付宝侧不存在，视为待支付。
+func (g *AlipayGateway) QueryTrade(ctx context.Context, trade *domain.GatewayTrade) (*domain.GatewayTradeResult, error) {
+	var resp struct {
+		alipayResult
+		TradeNo     string `json:"trade_no"`
+		TradeStatus string `json:"trade_status"`
+		TotalAmount string `json:"total_amount"`
+	}
+	raw, err := g.call(ctx, "alipay.trade.query", g.tradeRef(trade), &resp)
+	var gwErr *domain.GatewayError
+	if errors.As(err, &gwErr) && gwErr.Code == "ACQ.TRADE_NOT_EXIST" {
+		return &domain.GatewayTradeResult{State: domain.GatewayTradePending, Amount: trade.Amount, Currency: "CNY", RawResponse: gwErr.Message}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	amount, err := parseMinorUnits(resp.TotalAmount, 2)
+	if err != nil {
+		return nil, domain.NewGatewayError(domain.GatewayTypeAlipay, domain.ErrGatewayRejected, "INVALID_AMOUNT", resp.TotalAmount)
+	}
+	result := &domain.GatewayTradeResult{TransactionID: resp.TradeNo, Amount: amount, Currency: "CNY", RawResponse: string(raw)}
+	switch resp.TradeStatus {
+	case "TRADE_SUCCESS", "TRADE_FINISHED":
+		result.State = domain.GatewayTradeSuccess
+	case "TRADE_CLOSED":
+		result.State = domain.GatewayTradeClosed
+	default: // WAIT_BUYER_PAY
+		result.State = domain.GatewayTradePending
+	}
+	return result, nil
+}
+
+// Capture 支付宝直付交易无独立扣款步骤，查询交易确认已支付且金额一致。
+func (g *AlipayGateway) Capture(ctx context.Context, trade *domain.GatewayTrade, amount int64) (*domain.PaymentGatewayResponse, error) {
+	result, err := g.QueryTrade(ctx, trade)
+	if err != nil {
+		return nil, err
+	}
+	if result.State != domain.GatewayTradeSuccess {
+		return nil, domain.NewGatewayError(domain.GatewayTypeAlipay, domain.ErrGatewayRejected, "TRADE_NOT_PAID", "trade is not paid")
+	}
+	if result.Amount != amount {
+		return nil, domain.NewGatewayError(domain.GatewayTypeAlipay, domain.ErrGatewayRejected, "AMOUNT_MISMATCH", fmt.Sprintf("paid %d, expected %d", result.Amount, amount))
+	}
+	return &domain.PaymentGatewayResponse{TransactionID: result.TransactionID, RawResponse: result.RawResponse}, nil
 }
 
-func (g *AlipayGateway) Capture(ctx context.Context, transactionID string, amount int64) (*domain.PaymentGatewayResponse, error) {
-	return &domain.PaymentGatewayResponse{
-		TransactionID: transactionID,
-	}, nil
+// Void 关闭未支付交易 (alipay.trade.close)。预创建后未扫码的交易在支付宝侧不存在，视为已关闭。
+func (g *AlipayGateway) Void(ctx context.Context, trade *domain.GatewayTrade) error {
+	var resp alipayResult
+	_, err := g.call(ctx, "alipay.trade.close", g.tradeRef(trade), &resp)
+	var gwErr *domain.GatewayError
+	if errors.As(err, &gwErr) && gwErr.Code == "ACQ.TRADE_NOT_EXIST" {
+		return nil
+	}
+	return err
 }
 
-func (g *AlipayGateway) Void(ctx context.Context, transactionID string) error {
-	return nil
+// Refund 统一收单交易退款 (alipay.trade.refund)，out_request_no 为本方退款单号，重复提交幂等。
+func (g *AlipayGateway) Refund(ctx context.Context, req *domain.RefundGatewayRequest) (*domain.RefundGatewayResponse, error) {
+	biz := g.tradeRef(req.Trade)
+	biz["refund_amount"] = formatMinorUnits(req.Amount, 2)
+	biz["out_request_no"] = req.RefundNo
+	if req.Reason != "" {
+		biz["refund_reason"] = req.Reason
+	}
+	var resp struct {
+		alipayResult
+		FundChange string `json:"fund_change"`
+	}
+	raw, err := g.call(ctx, "alipay.trade.refund", biz, &resp)
+	if err != nil {
+		return nil, err
+	}
+	// fund_change=Y 表示本次请求发生了资金变化；N 可能是重复请求，需以退款查询为准
+	status := domain.RefundGatewaySuccess
+	if resp.FundChange != "Y" {
+		status = domain.RefundGatewayPending
+	}
+	return &domain.RefundGatewayResponse{GatewayRefundID: req.RefundNo, Status: status, RawResponse: string(raw)}, nil
 }
 
-func (g *AlipayGateway) Refund(ctx context.Context, transactionID string, amount int64) error {
-	// 真实化执行：模拟调用支付宝退款接口 (alipay.trade.refund)
-	if amount <= 0 {
-		return fmt.Errorf("alipay_gateway: invalid refund amount")
+// QueryRefund 统一收单交易退款查询 (alipay.trade.fastpay.refund.query)。
+func (g *AlipayGateway) QueryRefund(ctx context.Context, req *domain.RefundGatewayRequest) (*domain.RefundGatewayResponse, error) {
+	biz := g.tradeRef(req.Trade)
+	biz["out_request_no"] = req.RefundNo
+	var resp struct {
+		alipayResult
+		RefundStatus string `json:"refund_status"`
+	}
+	raw, err := g.call(ctx, "alipay.trade.fastpay.refund.query", biz, &resp)
+	if err != nil {
+		return nil, err
 	}
-	slog.InfoContext(ctx, "alipay refund processing", "txn_id", transactionID, "amount", amount)
-	// 顶级架构：这里应返回退款单号，此处作为演示仅返回 nil 表示成功
-	return nil
+	status := domain.RefundGatewayPending
+	if resp.RefundStatus == "REFUND_SUCCESS" {
+		status = domain.RefundGatewaySuccess
+	}
+	return &domain.RefundGatewayResponse{GatewayRefundID: req.RefundNo, Status: status, RawResponse: string(raw)}, nil
 }
 
-// DownloadBill 获取指定日期的对账单数据。
-func (g *AlipayGateway) DownloadBill(ctx context.Context, date time.Time) ([]*domain.GatewayBillItem, error) {
-	// 真实化执行：模拟调用支付宝对账单 API
-	slog.InfoContext(ctx, "downloading alipay bill", "date", date.Format("2006-01-02"))
-
-	// 这里产出真实的对账单格式数据，用于下游结算对账
-	items := []*domain.GatewayBillItem{
-		{
-			TransactionID: "ALI-TXN-10001",
-			PaymentNo:     "PAY-20240101-001",
-			Amount:        50000, // 500.00 CNY
-			Status:        "SUCCESS",
-			PaidAt:        date.Add(10 * time.Hour),
-		},
-		{
-			TransactionID: "ALI-TXN-10002",
-			PaymentNo:     "PAY-20240101-002",
-			Amount:        12500,
-			Status:        "REFUNDED",
-			PaidAt:        date.Add(14 * time.Hour),
-		},
-	}
-
-	return items, nil
+// DownloadBill 查询对账单下载地址 (alipay.data.dataservice.bill.downloadurl.query) 并解析交易业务明细。
+// 账单为 zip 压缩的 GBK 编码 CSV，以 # 开头的行为说明行。
+func (g *AlipayGateway) DownloadBill(ctx context.Context, date time.Time, fn func(page []*domain.GatewayBillItem) error) error {
+	var resp struct {
+		alipayResult
+		BillDownloadURL string `json:"bill_download_url"`
+	}
+	if _, err := g.call(ctx, "alipay.data.dataservice.bill.downloadurl.query", map[string]any{
+		"bill_type": "trade",
+		"bill_date": date.In(alipayLocation).Format("2006-01-02"),
+	}, &resp); err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, resp.BillDownloadURL, nil)
+	if err != nil {
+		return err
+	}
+	httpResp, body, err := doHTTP(g.httpClient, domain.GatewayTypeAlipay, httpReq, maxBillBytes)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return domain.NewGatewayError(domain.GatewayTypeAlipay, httpStatusKind(httpResp.StatusCode), httpResp.Status, "bill download failed")
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return fmt.Errorf("alipay: malformed bill archive: %w", err)
+	}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("alipay: failed to open bill file: %w", err)
+		}
+		content, err := io.ReadAll(simplifiedchinese.GBK.NewDecoder().Reader(rc))
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("alipay: failed to decode bill file: %w", err)
+		}
+		pager := &billPager{fn: fn}
+		ok, err := parseAlipayBill(content, pager)
+		if err != nil {
+			return err
+		}
+		if ok {
+			slog.InfoContext(ctx, "alipay bill downloaded", "date", date.Format("2006-01-02"), "items", pager.total)
+			return nil
+		}
+	}
+	return errors.New("alipay: bill archive contains no trade detail file")
+}
+
+// parseAlipayBill 解析业务明细文件并分页回调，表头首列为“支付宝交易号”；汇总文件返回 false。
+// 列：0 支付宝交易号，1 商户订单号，2 业务类型，5 完成时间，11 订单金额（元），12 商家实收（元，退款行为负数），
+// 21 退款批次号/请求号，22 服务费（元）。
+func parseAlipayBill(content []byte, pager *billPager) (bool, error) {
+	hasHeader := false
+	for line := range strings.Lines(string(content)) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := csv.NewReader(strings.NewReader(line))
+		r.FieldsPerRecord = -1
+		cols, err := r.Read()
+		if err != nil || len(cols) < 13 {
+			continue
+		}
+		for i := range cols {
+			cols[i] = strings.TrimSpace(cols[i])
+		}
+		if !hasHeader {
+			if cols[0] != "支付宝交易号" {
+				return false, nil
+			}
+			hasHeader = true
+			continue
+		}
+
+		status, amountCol := domain.BillStatusSuccess, 11
+		if cols[2] == "退款" {
+			status, amountCol = domain.BillStatusRefund, 12
+		}
+		amount, err := parseSignedMinorUnits(cols[amountCol], 2)
+		if err != nil {
+			continue
+		}
+		paidAt, _ := time.ParseInLocation("2006-01-02 15:04:05", cols[5], alipayLocation)
+		item := &domain.GatewayBillItem{
+			TransactionID: cols[0],
+			PaymentNo:     cols[1],
+			Amount:        amount,
+			Status:        status,
+			PaidAt:        paidAt,
+		}
+		if len(cols) > 22 {
+			if status == domain.BillStatusRefund {
+				item.RefundNo = cols[21]
+			}
+			item.Fee, _ = parseSignedMinorUnits(cols[22], 2)
+		}
+		if err := pager.add(item); err != nil {
+			return true, err
+		}
+	}
+	if !hasHeader {
+		return false, nil
+	}
+	return true, pager.flush()
+}
+
+// tradeRef 构造按交易号或商户订单号定位交易的业务参数。
+func (g *AlipayGateway) tradeRef(trade *domain.GatewayTrade) map[string]any {
+	ref := map[string]any{"out_trade_no": trade.PaymentNo}
+	if trade.TransactionID != "" {
+		ref["trade_no"] = trade.TransactionID
+	}
+	return ref
+}
+
+// call 调用开放平台接口：公共参数与 biz_content 一并 RSA2 签名，应答按 {method}_response 节点验签后解析。
+func (g *AlipayGateway) call(ctx context.Context, method string, biz map[string]any, out any) (json.RawMessage, error) {
+	bizContent, err := json.Marshal(biz)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Set("app_id", g.cfg.AppID)
+	params.Set("method", method)
+	params.Set("format", "JSON")
+	params.Set("charset", "utf-8")
+	params.Set("sign_type", "RSA2")
+	params.Set("timestamp", g.now().In(alipayLocation).Format("2006-01-02 15:04:05"))
+	params.Set("version", "1.0")
+	params.Set("biz_content", string(bizContent))
+	if g.cfg.NotifyURL != "" && (method == "alipay.trade.precreate" || method == "alipay.trade.refund") {
+		params.Set("notify_url", g.cfg.NotifyURL)
+	}
+	digest := sha256.Sum256([]byte(alipaySignContent(params)))
+	sign, err := rsa.SignPKCS1v15(nil, g.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("alipay: failed to sign request: %w", err)
+	}
+	params.Set("sign", base64.StdEncoding.EncodeToString(sign))
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.BaseURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=utf-8")
+	httpResp, body, err := doHTTP(g.httpClient, domain.GatewayTypeAlipay, httpReq, maxResponseBytes)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, domain.NewGatewayError(domain.GatewayTypeAlipay, httpStatusKind(httpResp.StatusCode), httpResp.Status, string(body))
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, domain.NewGatewayError(domain.GatewayTypeAlipay, domain.ErrGatewayUnavailable, "MALFORMED_RESPONSE", err.Error())
+	}
+	raw, ok := envelope[strings.ReplaceAll(method, ".", "_")+"_response"]
+	if !ok {
+		raw = envelope["error_response"]
+	}
+	var result alipayResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, domain.NewGatewayError(domain.GatewayTypeAlipay, domain.ErrGatewayUnavailable, "MALFORMED_RESPONSE", err.Error())
+	}
+	if result.Code != "10000" {
+		return raw, alipayError(result)
+	}
+
+	// 成功应答必须携带签名，签名内容为应答节点的原始 JSON
+	var signature string
+	if err := json.Unmarshal(envelope["sign"], &signature); err != nil || signature == "" {
+		return nil, domain.NewGatewayError(domain.GatewayTypeAlipay, domain.ErrGatewayMisconfigured, "MISSING_SIGN", "response is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, domain.NewGatewayError(domain.GatewayTypeAlipay, domain.ErrGatewayMisconfigured, "INVALID_SIGN", err.Error())
+	}
+	respDigest := sha256.Sum256(raw)
+	if err := rsa.VerifyPKCS1v15(g.publicKey, crypto.SHA256, respDigest[:], sig); err != nil {
+		return nil, domain.NewGatewayError(domain.GatewayTypeAlipay, domain.ErrGatewayMisconfigured, "INVALID_SIGN", err.Error())
+	}
+
+	if err := json.Unmarshal(raw, out); err != nil {
+		return nil, domain.NewGatewayError(domain.GatewayTypeAlipay, domain.ErrGatewayUnavailable, "MALFORMED_RESPONSE", err.Error())
+	}
+	return raw, nil
+}
+
+// alipayError 映射支付宝错误码。
+// 20000 服务不可用与 ACQ.SYSTEM_ERROR 可重试；20001 授权无效、40006 权限不足与 isv 签名/应用错误为配置问题；其余为业务拒绝。
+func alipayError(r alipayResult) error {
+	code := r.SubCode
+	if code == "" {
+		code = r.Code
+	}
+	message := r.SubMsg
+	if message == "" {
+		message = r.Msg
+	}
+
+	kind := domain.ErrGatewayRejected
+	switch {
+	case r.Code == "20000", strings.HasSuffix(r.SubCode, "SYSTEM_ERROR"), strings.HasPrefix(r.SubCode, "isp."):
+		kind = domain.ErrGatewayUnavailable
+	case r.Code == "20001", r.Code == "40006",
+		strings.HasPrefix(r.SubCode, "isv.invalid-signature"),
+		strings.HasPrefix(r.SubCode, "isv.invalid-app-id"),
+		strings.HasPrefix(r.SubCode, "isv.missing-signature"),
+		strings.HasPrefix(r.SubCode, "isv.insufficient-isv-permissions"):
+		kind = domain.ErrGatewayMisconfigured
+	}
+	return domain.NewGatewayError(domain.GatewayTypeAlipay, kind, code, message)
 }
@@ -0,0 +1,218 @@
+package gateway
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// alipayTestServer 模拟支付宝网关：校验请求签名，按 respond 返回的应答节点组装并签名应答。
+type alipayTestServer struct {
+	t          *testing.T
+	merchant   *rsa.PublicKey
+	alipayKey  *rsa.PrivateKey
+	respond    func(method string, biz map[string]any) (node string, signed bool)
+	lastMethod string
+}
+
+func (s *alipayTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.t.Fatal(err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.PostForm.Get("sign"))
+	if err != nil {
+		s.t.Fatalf("malformed request sign: %v", err)
+	}
+	digest := sha256.Sum256([]byte(alipaySignContent(r.PostForm)))
+	if err := rsa.VerifyPKCS1v15(s.merchant, crypto.SHA256, digest[:], sig); err != nil {
+		s.t.Errorf("request signature invalid: %v", err)
+	}
+	if r.PostForm.Get("app_id") != "2021000000000001" || r.PostForm.Get("sign_type") != "RSA2" {
+		s.t.Errorf("public params = %v", r.PostForm)
+	}
+
+	method := r.PostForm.Get("method")
+	s.lastMethod = method
+	var biz map[string]any
+	if err := json.Unmarshal([]byte(r.PostForm.Get("biz_content")), &biz); err != nil {
+		s.t.Fatalf("malformed biz_content: %v", err)
+	}
+	node, signed := s.respond(method, biz)
+	sign := ""
+	if signed {
+		d := sha256.Sum256([]byte(node))
+		b, err := rsa.SignPKCS1v15(nil, s.alipayKey, crypto.SHA256, d[:])
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		sign = base64.StdEncoding.EncodeToString(b)
+	}
+	fmt.Fprintf(w, `{"%s_response":%s,"sign":%q}`, strings.ReplaceAll(method, ".", "_"), node, sign)
+}
+
+// newAlipayTestGateway 创建指向测试网关的支付宝客户端。
+func newAlipayTestGateway(t *testing.T, respond func(method string, biz map[string]any) (string, bool)) (*AlipayGateway, *alipayTestServer) {
+	t.Helper()
+	merchantKey, merchantPEM, _ := testRSAKey(t)
+	alipayKey, _, alipayPublicPEM := testRSAKey(t)
+	fake := &alipayTestServer{t: t, merchant: &merchantKey.PublicKey, alipayKey: alipayKey, respond: respond}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	g, err := NewAlipayGateway(AlipayChannelConfig{
+		AppID:           "2021000000000001",
+		PrivateKey:      merchantPEM,
+		AlipayPublicKey: alipayPublicPEM,
+		NotifyURL:       "https://shop.example.com/notify/alipay",
+		BaseURL:         srv.URL,
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.now = func() time.Time { return time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC) }
+	return g, fake
+}
+
+func TestAlipayPreAuth(t *testing.T) {
+	g, fake := newAlipayTestGateway(t, func(method string, biz map[string]any) (string, bool) {
+		if biz["out_trade_no"] != "PAY1" || biz["total_amount"] != "88.00" || biz["subject"] != "order 1" {
+			t.Errorf("biz_content = %v", biz)
+		}
+		return `{"code":"10000","msg":"Success","out_trade_no":"PAY1","qr_code":"https://qr.alipay.com/abc"}`, true
+	})
+	resp, err := g.PreAuth(context.Background(), &domain.PaymentGatewayRequest{OrderID: "PAY1", Amount: 8800, Currency: "CNY", Description: "order 1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.lastMethod != "alipay.trade.precreate" || resp.PaymentURL != "https://qr.alipay.com/abc" || resp.TransactionID != "" {
+		t.Fatalf("method = %s, response = %+v", fake.lastMethod, resp)
+	}
+
+	_, err = g.PreAuth(context.Background(), &domain.PaymentGatewayRequest{OrderID: "PAY2", Amount: 100, Currency: "USD"})
+	assertGatewayError(t, err, domain.ErrGatewayRejected, "UNSUPPORTED_CURRENCY")
+}
+
+func TestAlipayQueryTrade(t *testing.T) {
+	tests := []struct {
+		name       string
+		node       string
+		wantState  domain.GatewayTradeState
+		wantAmount int64
+	}{
+		{name: "paid", node: `{"code":"10000","msg":"Success","trade_no":"2026T1","trade_status":"TRADE_SUCCESS","total_amount":"88.00"}`, wantState: domain.GatewayTradeSuccess, wantAmount: 8800},
+		{name: "finished", node: `{"code":"10000","msg":"Success","trade_no":"2026T1","trade_status":"TRADE_FINISHED","total_amount":"0.01"}`, wantState: domain.GatewayTradeSuccess, wantAmount: 1},
+		{name: "waiting", node: `{"code":"10000","msg":"Success","trade_no":"2026T1","trade_status":"WAIT_BUYER_PAY","total_amount":"88.00"}`, wantState: domain.GatewayTradePending, wantAmount: 8800},
+		{name: "closed", node: `{"code":"10000","msg":"Success","trade_no":"2026T1","trade_status":"TRADE_CLOSED","total_amount":"88.00"}`, wantState: domain.GatewayTradeClosed, wantAmount: 8800},
+		{name: "not scanned yet", node: `{"code":"40004","msg":"Business Failed","sub_code":"ACQ.TRADE_NOT_EXIST","sub_msg":"交易不存在"}`, wantState: domain.GatewayTradePending, wantAmount: 8800},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, _ := newAlipayTestGateway(t, func(method string, biz map[string]any) (string, bool) {
+				if method != "alipay.trade.query" || biz["out_trade_no"] != "PAY1" {
+					t.Errorf("method = %s, biz = %v", method, biz)
+				}
+				return tt.node, strings.Contains(tt.node, `"10000"`)
+			})
+			result, err := g.QueryTrade(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1", Amount: 8800})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.State != tt.wantState || result.Amount != tt.wantAmount {
+				t.Fatalf("result = %+v", result)
+			}
+		})
+	}
+}
+
+func TestAlipayErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     string
+		signed   bool
+		wantKind error
+		wantCode string
+	}{
+		{name: "business rejection", node: `{"code":"40004","msg":"Business Failed","sub_code":"ACQ.TRADE_HAS_CLOSE","sub_msg":"交易已关闭"}`, wantKind: domain.ErrGatewayRejected, wantCode: "ACQ.TRADE_HAS_CLOSE"},
+		{name: "system error", node: `{"code":"40004","msg":"Business Failed","sub_code":"ACQ.SYSTEM_ERROR","sub_msg":"系统错误"}`, wantKind: domain.ErrGatewayUnavailable, wantCode: "ACQ.SYSTEM_ERROR"},
+		{name: "service unavailable", node: `{"code":"20000","msg":"Service Currently Unavailable","sub_code":"isp.unknow-error"}`, wantKind: domain.ErrGatewayUnavailable, wantCode: "isp.unknow-error"},
+		{name: "invalid app id", node: `{"code":"40002","msg":"Invalid Arguments","sub_code":"isv.invalid-app-id"}`, wantKind: domain.ErrGatewayMisconfigured, wantCode: "isv.invalid-app-id"},
+		{name: "unsigned success", node: `{"code":"10000","msg":"Success","fund_change":"Y"}`, wantKind: domain.ErrGatewayMisconfigured, wantCode: "MISSING_SIGN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, _ := newAlipayTestGateway(t, func(string, map[string]any) (string, bool) { return tt.node, tt.signed })
+			_, err := g.Refund(context.Background(), &domain.RefundGatewayRequest{Trade: &domain.GatewayTrade{PaymentNo: "PAY1"}, RefundNo: "REF1", Amount: 100})
+			assertGatewayError(t, err, tt.wantKind, tt.wantCode)
+		})
+	}
+}
+
+func TestAlipayRejectsForgedResponse(t *testing.T) {
+	g, fake := newAlipayTestGateway(t, func(string, map[string]any) (string, bool) {
+		return `{"code":"10000","msg":"Success","trade_no":"2026T1","trade_status":"TRADE_SUCCESS","total_amount":"88.00"}`, true
+	})
+	// 应答由另一把私钥签名，模拟中间人篡改
+	fake.alipayKey, _, _ = testRSAKey(t)
+	_, err := g.QueryTrade(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1"})
+	assertGatewayError(t, err, domain.ErrGatewayMisconfigured, "INVALID_SIGN")
+}
+
+func TestAlipayMalformedResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		kind   error
+		code   string
+	}{
+		{name: "not json", status: http.StatusOK, body: `<html>gateway</html>`, kind: domain.ErrGatewayUnavailable, code: "MALFORMED_RESPONSE"},
+		{name: "missing response node", status: http.StatusOK, body: `{"sign":"x"}`, kind: domain.ErrGatewayUnavailable, code: "MALFORMED_RESPONSE"},
+		{name: "http error", status: http.StatusBadGateway, body: `bad gateway`, kind: domain.ErrGatewayUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, merchantPEM, alipayPEM := testRSAKey(t)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+			g, err := NewAlipayGateway(AlipayChannelConfig{AppID: "2021000000000001", PrivateKey: merchantPEM, AlipayPublicKey: alipayPEM, BaseURL: srv.URL}, srv.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = g.QueryTrade(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1"})
+			assertGatewayError(t, err, tt.kind, tt.code)
+		})
+	}
+
+	t.Run("invalid amount", func(t *testing.T) {
+		g, _ := newAlipayTestGateway(t, func(string, map[string]any) (string, bool) {
+			return `{"code":"10000","msg":"Success","trade_no":"2026T1","trade_status":"TRADE_SUCCESS","total_amount":"88.001"}`, true
+		})
+		_, err := g.QueryTrade(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1"})
+		assertGatewayError(t, err, domain.ErrGatewayRejected, "INVALID_AMOUNT")
+	})
+}
+
+func TestAlipayTimeout(t *testing.T) {
+	_, merchantPEM, alipayPEM := testRSAKey(t)
+	srv, client := slowServer(t)
+	g, err := NewAlipayGateway(AlipayChannelConfig{AppID: "2021000000000001", PrivateKey: merchantPEM, AlipayPublicKey: alipayPEM, BaseURL: srv.URL}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.QueryTrade(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1"})
+	assertGatewayError(t, err, domain.ErrGatewayUnavailable, "NETWORK_ERROR")
+}
@@ -0,0 +1,117 @@
+package gateway
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// AlipayNotifyVerifier 支付宝异步通知验签器 (RSA2，即 SHA256WithRSA)。
+type AlipayNotifyVerifier struct {
+	cfg       AlipayConfig
+	publicKey *rsa.PublicKey
+}
+
+// NewAlipayNotifyVerifier 创建支付宝通知验签器。
+func NewAlipayNotifyVerifier(cfg AlipayConfig) (*AlipayNotifyVerifier, error) {
+	pub, err := parseRSAPublicKey(cfg.AlipayPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("alipay: invalid alipay_public_key: %w", err)
+	}
+	return &AlipayNotifyVerifier{cfg: cfg, publicKey: pub}, nil
+}
+
+func (v *AlipayNotifyVerifier) Gateway() domain.GatewayType { return domain.GatewayTypeAlipay }
+
+// Verify 校验通知签名与收款方，并解析交易结果。
+// 通知以 application/x-www-form-urlencoded 提交，待签名串为除 sign、sign_type 外的非空参数按键排序后以 & 拼接。
+func (v *AlipayNotifyVerifier) Verify(ctx context.Context, req *domain.NotifyRequest) (*domain.PaymentNotification, error) {
+	values, err := url.ParseQuery(string(req.Body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: alipay: malformed form body: %v", domain.ErrInvalidNotifySignature, err)
+	}
+	if signType := values.Get("sign_type"); signType != "RSA2" {
+		return nil, fmt.Errorf("%w: alipay: unsupported sign_type %q", domain.ErrInvalidNotifySignature, signType)
+	}
+	sign, err := base64.StdEncoding.DecodeString(values.Get("sign"))
+	if err != nil || len(sign) == 0 {
+		return nil, fmt.Errorf("%w: alipay: missing or malformed sign", domain.ErrInvalidNotifySignature)
+	}
+	digest := sha256.Sum256([]byte(alipaySignContent(values)))
+	if err := rsa.VerifyPKCS1v15(v.publicKey, crypto.SHA256, digest[:], sign); err != nil {
+		return nil, fmt.Errorf("%w: alipay: %v", domain.ErrInvalidNotifySignature, err)
+	}
+
+	appID := values.Get("app_id")
+	if appID != v.cfg.AppID {
+		return nil, fmt.Errorf("%w: alipay: app_id %s", domain.ErrNotifyMerchantMismatch, appID)
+	}
+	if v.cfg.SellerID != "" && values.Get("seller_id") != v.cfg.SellerID {
+		return nil, fmt.Errorf("%w: alipay: seller_id %s", domain.ErrNotifyMerchantMismatch, values.Get("seller_id"))
+	}
+
+	amount, err := parseMinorUnits(values.Get("total_amount"), 2)
+	if err != nil {
+		return nil, fmt.Errorf("alipay: %w", err)
+	}
+	// 境内交易不携带币种，跨境交易以 trans_currency 标识标价币种
+	currency := values.Get("trans_currency")
+	if currency == "" {
+		currency = "CNY"
+	}
+
+	return &domain.PaymentNotification{
+		Gateway:       domain.GatewayTypeAlipay,
+		NotifyID:      values.Get("notify_id"),
+		PaymentNo:     values.Get("out_trade_no"),
+		TransactionID: values.Get("trade_no"),
+		Result:        alipayTradeResult(values.Get("trade_status")),
+		Amount:        amount,
+		Currency:      strings.ToUpper(currency),
+		MerchantID:    appID,
+		RawPayload:    string(req.Body),
+	}, nil
+}
+
+// alipaySignContent 构造支付宝待验签字符串。
+func alipaySignContent(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if k == "sign" || k == "sign_type" || values.Get(k) == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(values.Get(k))
+	}
+	return sb.String()
+}
+
+// alipayTradeResult 将支付宝交易状态映射为通知结果。
+func alipayTradeResult(tradeStatus string) domain.NotifyResult {
+	switch tradeStatus {
+	case "TRADE_SUCCESS", "TRADE_FINISHED":
+		return domain.NotifyResultSuccess
+	case "TRADE_CLOSED":
+		return domain.NotifyResultFailed
+	default: // WAIT_BUYER_PAY
+		return domain.NotifyResultPending
+	}
+}
@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+const (
+	// defaultHTTPTimeout 渠道接口默认超时。
+	defaultHTTPTimeout = 10 * time.Second
+	// maxResponseBytes 渠道应答体读取上限，对账文件除外。
+	maxResponseBytes = 4 << 20
+	// maxBillBytes 对账文件读取上限。
+	maxBillBytes = 256 << 20
+)
+
+// NewHTTPClient 创建渠道接口共用的 HTTP 客户端。
+func NewHTTPClient() *http.Client {
+	return &http.Client{Timeout: defaultHTTPTimeout}
+}
+
+// doHTTP 发送请求并读取应答。网络错误、超时与读取失败统一归为可重试的渠道不可用。
+func doHTTP(client *http.Client, gatewayType domain.GatewayType, req *http.Request, limit int64) (*http.Response, []byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil, nil, err
+		}
+		return nil, nil, domain.NewGatewayError(gatewayType, domain.ErrGatewayUnavailable, "NETWORK_ERROR", err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, nil, domain.NewGatewayError(gatewayType, domain.ErrGatewayUnavailable, "NETWORK_ERROR", err.Error())
+	}
+	return resp, body, nil
+}
+
+// httpStatusKind 按 HTTP 状态码粗分错误类别：5xx 与 429 可重试，401/403 为配置错误，其余为业务拒绝。
+func httpStatusKind(statusCode int) error {
+	switch {
+	case statusCode >= 500, statusCode == http.StatusTooManyRequests:
+		return domain.ErrGatewayUnavailable
+	case statusCode == http.StatusUnauthorized, statusCode == http.StatusForbidden:
+		return domain.ErrGatewayMisconfigured
+	default:
+		return domain.ErrGatewayRejected
+	}
+}
+
+// parseRSAPrivateKey 解析商户 RSA 私钥，支持 PKCS#1/PKCS#8 的 PEM 或无头尾 Base64 DER。
+func parseRSAPrivateKey(key string) (*rsa.PrivateKey, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(key)); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key encoding: %w", err)
+		}
+		der = decoded
+	}
+
+	if k, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		rsaKey, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("private key is not RSA")
+		}
+		return rsaKey, nil
+	}
+	return x509.ParsePKCS1PrivateKey(der)
+}
+
+// formatMinorUnits 将最小货币单位金额格式化为 "88.00" 形式的十进制字符串，无小数位的币种 (如日元) 不带小数点。
+func formatMinorUnits(amount int64, decimals int) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	s := strconv.FormatInt(amount, 10)
+	if decimals <= 0 {
+		return sign + s
+	}
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	return sign + s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+}
+
+// parseSignedMinorUnits 解析可能带负号的十进制金额 (账单中退款行为负数)，返回绝对值。
+func parseSignedMinorUnits(amount string, decimals int) (int64, error) {
+	return parseMinorUnits(strings.TrimPrefix(strings.TrimSpace(amount), "-"), decimals)
+}
+
+// billPager 将逐行解析的账单明细按 domain.BillPageSize 分页回调。
+type billPager struct {
+	fn    func(page []*domain.GatewayBillItem) error
+	page  []*domain.GatewayBillItem
+	total int
+}
+
+// add 追加一条明细，满页时回调。
+func (p *billPager) add(item *domain.GatewayBillItem) error {
+	p.page = append(p.page, item)
+	if len(p.page) < domain.BillPageSize {
+		return nil
+	}
+	return p.flush()
+}
+
+// flush 回调尚未回调的明细。每页使用新切片，回调方可持有页数据。
+func (p *billPager) flush() error {
+	if len(p.page) == 0 {
+		return nil
+	}
+	page := p.page
+	p.page = nil
+	p.total += len(page)
+	return p.fn(page)
+}
+
+// randomNonce 生成 32 位十六进制随机串。
+func randomNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
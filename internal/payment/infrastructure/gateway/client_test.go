@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+func TestFormatMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		decimals int
+		want     string
+	}{
+		{8800, 2, "88.00"},
+		{5, 2, "0.05"},
+		{0, 2, "0.00"},
+		{-1234, 2, "-12.34"},
+		{1500, 0, "1500"},
+		{-7, 0, "-7"},
+		{1, 3, "0.001"},
+	}
+	for _, tt := range tests {
+		if got := formatMinorUnits(tt.amount, tt.decimals); got != tt.want {
+			t.Errorf("formatMinorUnits(%d, %d) = %q, want %q", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestParseMinorUnits(t *testing.T) {
+	tests := []struct {
+		in       string
+		decimals int
+		want     int64
+		wantErr  bool
+	}{
+		{in: "88.00", decimals: 2, want: 8800},
+		{in: "88.5", decimals: 2, want: 8850},
+		{in: "88", decimals: 2, want: 8800},
+		{in: "1500", decimals: 0, want: 1500},
+		{in: "0.001", decimals: 2, wantErr: true},
+		{in: "-1.00", decimals: 2, wantErr: true},
+		{in: "abc", decimals: 2, wantErr: true},
+		{in: "", decimals: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseMinorUnits(tt.in, tt.decimals)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseMinorUnits(%q, %d) = %d, %v; want %d, error %v", tt.in, tt.decimals, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHTTPStatusKind(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusInternalServerError, domain.ErrGatewayUnavailable},
+		{http.StatusBadGateway, domain.ErrGatewayUnavailable},
+		{http.StatusTooManyRequests, domain.ErrGatewayUnavailable},
+		{http.StatusUnauthorized, domain.ErrGatewayMisconfigured},
+		{http.StatusForbidden, domain.ErrGatewayMisconfigured},
+		{http.StatusBadRequest, domain.ErrGatewayRejected},
+		{http.StatusNotFound, domain.ErrGatewayRejected},
+	}
+	for _, tt := range tests {
+		if got := httpStatusKind(tt.status); got != tt.want {
+			t.Errorf("httpStatusKind(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+// slowServer 返回在客户端超时之后才应答的测试服务与超时很短的客户端。
+func slowServer(t *testing.T) (*httptest.Server, *http.Client) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &http.Client{Timeout: 50 * time.Millisecond}
+}
+
+// assertGatewayError 校验错误为指定分类的渠道错误，code 非空时同时校验渠道错误码。
+func assertGatewayError(t *testing.T, err error, kind error, code string) {
+	t.Helper()
+	if !errors.Is(err, kind) {
+		t.Fatalf("error = %v, want kind %v", err, kind)
+	}
+	var gwErr *domain.GatewayError
+	if !errors.As(err, &gwErr) {
+		t.Fatalf("error = %T, want *domain.GatewayError", err)
+	}
+	if code != "" && gwErr.Code != code {
+		t.Fatalf("error code = %q, want %q", gwErr.Code, code)
+	}
+}
+
+// testRSAKey 生成测试用 RSA 私钥及其 PKCS#8 PEM 与 PKIX 公钥 PEM。
+func testRSAKey(t *testing.T) (key *rsa.PrivateKey, privatePEM, publicPEM string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePEM = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	publicPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	return key, privatePEM, publicPEM
+}
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// Config 支付渠道商户配置，对应配置文件的 [gateways] 段。
+type Config struct {
+	Alipay AlipayConfig `mapstructure:"alipay"`
+	Wechat WechatConfig `mapstructure:"wechat"`
+	Stripe StripeConfig `mapstructure:"stripe"`
+}
+
+// AlipayConfig 支付宝开放平台应用配置。
+type AlipayConfig struct {
+	AppID           string `mapstructure:"app_id"`            // 应用 ID，通知中的 app_id 必须与之一致
+	SellerID        string `mapstructure:"seller_id"`         // 收款支付宝账号 ID (2088 开头)，为空时不校验
+	AlipayPublicKey string `mapstructure:"alipay_public_key"` // 支付宝公钥 (PEM 或 Base64 DER)，用于 RSA2 验签
+}
+
+// Enabled 是否配置了支付宝通知验签。
+func (c AlipayConfig) Enabled() bool {
+	return c.AppID != "" && c.AlipayPublicKey != ""
+}
+
+// WechatConfig 微信支付 APIv3 商户配置。
+type WechatConfig struct {
+	AppID         string        `mapstructure:"app_id"`         // 公众号/小程序/移动应用 AppID，为空时不校验
+	MchID         string        `mapstructure:"mch_id"`         // 商户号，通知中的 mchid 必须与之一致
+	APIv3Key      string        `mapstructure:"api_v3_key"`     // APIv3 密钥 (32 字节)，用于解密通知资源
+	PlatformCerts []string      `mapstructure:"platform_certs"` // 微信支付平台证书 (PEM)，按证书序列号匹配 Wechatpay-Serial
+	Tolerance     time.Duration `mapstructure:"tolerance"`      // 通知时间戳允许的偏差，默认 5 分钟
+}
+
+// Enabled 是否配置了微信支付通知验签。
+func (c WechatConfig) Enabled() bool {
+	return c.MchID != "" && c.APIv3Key != "" && len(c.PlatformCerts) > 0
+}
+
+// StripeConfig Stripe 账户配置。
+type StripeConfig struct {
+	AccountID     string        `mapstructure:"account_id"`     // Connect 账户 ID (acct_...)，为空时不校验事件所属账户
+	WebhookSecret string        `mapstructure:"webhook_secret"` // Webhook 端点签名密钥 (whsec_...)
+	Tolerance     time.Duration `mapstructure:"tolerance"`      // 签名时间戳允许的偏差，默认 5 分钟
+}
+
+// Enabled 是否配置了 Stripe Webhook 验签。
+func (c StripeConfig) Enabled() bool {
+	return c.WebhookSecret != ""
+}
+
+// defaultNotifyTolerance 通知时间戳默认允许的偏差，超出视为重放。
+const defaultNotifyTolerance = 5 * time.Minute
+
+// NewNotificationVerifiers 按配置创建各渠道的通知验签器，未配置的渠道不创建。
+func NewNotificationVerifiers(cfg Config) ([]domain.NotificationVerifier, error) {
+	var verifiers []domain.NotificationVerifier
+	if cfg.Alipay.Enabled() {
+		v, err := NewAlipayNotifyVerifier(cfg.Alipay)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, v)
+	}
+	if cfg.Wechat.Enabled() {
+		v, err := NewWechatNotifyVerifier(cfg.Wechat)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, v)
+	}
+	if cfg.Stripe.Enabled() {
+		verifiers = append(verifiers, NewStripeWebhookVerifier(cfg.Stripe))
+	}
+	return verifiers, nil
+}
+
+// parseRSAPublicKey 解析 RSA 公钥，支持 PEM 公钥、PEM 证书与无头尾的 Base64 DER (支付宝控制台导出格式)。
+func parseRSAPublicKey(key string) (*rsa.PublicKey, error) {
+	der := []byte(key)
+	if block, _ := pem.Decode([]byte(key)); block != nil {
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			pub, ok := cert.PublicKey.(*rsa.PublicKey)
+			if !ok {
+				return nil, errors.New("certificate does not contain an RSA public key")
+			}
+			return pub, nil
+		}
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key encoding: %w", err)
+		}
+		der = decoded
+	}
+
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		if rsaPub, ok := pub.(*rsa.PublicKey); ok {
+			return rsaPub, nil
+		}
+		return nil, errors.New("public key is not RSA")
+	}
+	return x509.ParsePKCS1PublicKey(der)
+}
+
+// parseMinorUnits 将 "88.00" 形式的十进制金额转换为最小货币单位 (分)，不经过浮点运算。
+func parseMinorUnits(amount string, decimals int) (int64, error) {
+	intPart, fracPart, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if intPart == "" || len(fracPart) > decimals {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	fracPart += strings.Repeat("0", decimals-len(fracPart))
+	v, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	return v, nil
+}
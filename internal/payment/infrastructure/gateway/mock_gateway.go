@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
@@ -18,29 +19,75 @@ func (g *MockGateway) PreAuth(ctx context.Context, req *domain.PaymentGatewayReq
 	}, nil
 }
 
-func (g *MockGateway) Capture(ctx context.Context, transactionID string, amount int64) (*domain.PaymentGatewayResponse, error) {
+func (g *MockGateway) QueryTrade(ctx context.Context, trade *domain.GatewayTrade) (*domain.GatewayTradeResult, error) {
+	// 模拟渠道不推送结果，交易保持待支付，由 Capture 显式确认
+	return &domain.GatewayTradeResult{
+		TransactionID: trade.TransactionID,
+		State:         domain.GatewayTradePending,
+		Amount:        trade.Amount,
+		Currency:      trade.Currency,
+	}, nil
+}
+
+func (g *MockGateway) Capture(ctx context.Context, trade *domain.GatewayTrade, amount int64) (*domain.PaymentGatewayResponse, error) {
 	return &domain.PaymentGatewayResponse{
-		TransactionID: transactionID,
+		TransactionID: trade.TransactionID,
 	}, nil
 }
 
-func (g *MockGateway) Void(ctx context.Context, transactionID string) error {
+func (g *MockGateway) Void(ctx context.Context, trade *domain.GatewayTrade) error {
 	return nil
 }
 
-func (g *MockGateway) Refund(ctx context.Context, transactionID string, amount int64) error {
-	return nil
+func (g *MockGateway) Refund(ctx context.Context, req *domain.RefundGatewayRequest) (*domain.RefundGatewayResponse, error) {
+	return &domain.RefundGatewayResponse{
+		GatewayRefundID: "MOCK_REFUND_" + req.RefundNo,
+		Status:          domain.RefundGatewaySuccess,
+	}, nil
+}
+
+func (g *MockGateway) QueryRefund(ctx context.Context, req *domain.RefundGatewayRequest) (*domain.RefundGatewayResponse, error) {
+	return &domain.RefundGatewayResponse{
+		GatewayRefundID: req.GatewayRefundID,
+		Status:          domain.RefundGatewaySuccess,
+	}, nil
 }
 
-func (g *MockGateway) DownloadBill(ctx context.Context, date time.Time) ([]*domain.GatewayBillItem, error) {
+func (g *MockGateway) DownloadBill(ctx context.Context, date time.Time, fn func(page []*domain.GatewayBillItem) error) error {
 	// 返回一个模拟的账单项
-	return []*domain.GatewayBillItem{
+	return fn([]*domain.GatewayBillItem{
 		{
 			TransactionID: "MOCK_TXN_123",
 			PaymentNo:     "PAY_MOCK_123",
 			Amount:        1000,
-			Status:        "SUCCESS",
+			Status:        domain.BillStatusSuccess,
 			PaidAt:        date,
 		},
+	})
+}
+
+func (g *MockGateway) ProfitSharingAccount(recipientType string, recipientID uint64) (string, bool) {
+	if recipientType != domain.SplitRecipientMerchant {
+		return "", false
+	}
+	return fmt.Sprintf("MOCK_MERCH_%d", recipientID), true
+}
+
+func (g *MockGateway) ShareProfit(ctx context.Context, req *domain.ProfitSharingRequest) (*domain.ProfitSharingResponse, error) {
+	receivers := make(map[string]domain.ProfitSharingStatus, len(req.Receivers))
+	for _, r := range req.Receivers {
+		receivers[r.Account] = domain.ProfitSharingSuccess
+	}
+	return &domain.ProfitSharingResponse{
+		GatewayOrderID: "MOCK_PS_" + req.OrderNo,
+		Status:         domain.ProfitSharingSuccess,
+		Receivers:      receivers,
+	}, nil
+}
+
+func (g *MockGateway) ReturnProfit(ctx context.Context, req *domain.ProfitReturnRequest) (*domain.ProfitReturnResponse, error) {
+	return &domain.ProfitReturnResponse{
+		GatewayReturnID: "MOCK_PR_" + req.ReturnNo,
+		Status:          domain.ProfitSharingSuccess,
 	}, nil
 }
@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// channelTypes 参与对账的真实渠道类型。
+var channelTypes = []domain.ChannelType{domain.ChannelTypeAlipay, domain.ChannelTypeWechat, domain.ChannelTypeStripe}
+
+// cachedGateway 已构建的渠道客户端，渠道配置更新后重建。
+type cachedGateway struct {
+	gateway   domain.PaymentGateway
+	updatedAt time.Time
+}
+
+// Registry 按渠道配置构建并缓存网关客户端，实现 domain.GatewayRegistry。
+// 未配置渠道的支付 (如路由降级到 mock) 使用 defaults 中对应类型的网关。
+type Registry struct {
+	channelRepo domain.ChannelRepository
+	httpClient  *http.Client
+	defaults    map[domain.GatewayType]domain.PaymentGateway
+	logger      *slog.Logger
+
+	mu    sync.Mutex
+	cache map[string]*cachedGateway // key: channel_code
+}
+
+// NewRegistry 创建网关注册表。
+func NewRegistry(channelRepo domain.ChannelRepository, httpClient *http.Client, defaults map[domain.GatewayType]domain.PaymentGateway, logger *slog.Logger) *Registry {
+	if httpClient == nil {
+		httpClient = NewHTTPClient()
+	}
+	return &Registry{
+		channelRepo: channelRepo,
+		httpClient:  httpClient,
+		defaults:    defaults,
+		logger:      logger,
+		cache:       make(map[string]*cachedGateway),
+	}
+}
+
+// ForChannel 返回渠道对应的网关客户端。
+func (r *Registry) ForChannel(ctx context.Context, gatewayType domain.GatewayType, channel *domain.ChannelConfig) (domain.PaymentGateway, error) {
+	if channel == nil {
+		if gw, ok := r.defaults[gatewayType]; ok {
+			return gw, nil
+		}
+		return nil, domain.NewGatewayError(gatewayType, domain.ErrGatewayMisconfigured, "NO_CHANNEL", "no channel configured")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.cache[channel.Code]; ok && c.updatedAt.Equal(channel.UpdatedAt) {
+		return c.gateway, nil
+	}
+	gw, err := r.build(channel)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "failed to build payment gateway", "channel", channel.Code, "type", channel.Type, "error", err)
+		return nil, domain.NewGatewayError(domain.GatewayType(channel.Type), domain.ErrGatewayMisconfigured, "INVALID_CHANNEL_CONFIG", err.Error())
+	}
+	r.cache[channel.Code] = &cachedGateway{gateway: gw, updatedAt: channel.UpdatedAt}
+	return gw, nil
+}
+
+// ForPayment 返回受理该支付单的渠道网关。历史支付单无渠道编码时取同类型首个启用渠道。
+func (r *Registry) ForPayment(ctx context.Context, payment *domain.Payment) (domain.PaymentGateway, error) {
+	var channel *domain.ChannelConfig
+	if payment.ChannelCode != "" {
+		c, err := r.channelRepo.FindByCode(ctx, payment.ChannelCode)
+		if err != nil {
+			return nil, err
+		}
+		channel = c
+	}
+	if channel == nil && payment.GatewayType != domain.GatewayTypeMock {
+		channels, err := r.channelRepo.ListEnabledByType(ctx, domain.ChannelType(payment.GatewayType))
+		if err != nil {
+			return nil, err
+		}
+		if len(channels) > 0 {
+			channel = channels[0]
+		}
+	}
+	return r.ForChannel(ctx, payment.GatewayType, channel)
+}
+
+// Channels 返回所有启用渠道及其网关，配置有误的渠道记录日志后跳过。
+func (r *Registry) Channels(ctx context.Context) ([]*domain.ChannelGateway, error) {
+	var result []*domain.ChannelGateway
+	for _, t := range channelTypes {
+		channels, err := r.channelRepo.ListEnabledByType(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range channels {
+			gw, err := r.ForChannel(ctx, domain.GatewayType(c.Type), c)
+			if err != nil {
+				continue
+			}
+			result = append(result, &domain.ChannelGateway{Channel: c, Gateway: gw})
+		}
+	}
+	return result, nil
+}
+
+// build 解析 ConfigJSON 并创建对应类型的客户端。
+func (r *Registry) build(channel *domain.ChannelConfig) (domain.PaymentGateway, error) {
+	switch channel.Type {
+	case domain.ChannelTypeAlipay:
+		var cfg AlipayChannelConfig
+		if err := json.Unmarshal([]byte(channel.ConfigJSON), &cfg); err != nil {
+			return nil, fmt.Errorf("invalid config_json: %w", err)
+		}
+		return NewAlipayGateway(cfg, r.httpClient)
+	case domain.ChannelTypeWechat:
+		var cfg WechatChannelConfig
+		if err := json.Unmarshal([]byte(channel.ConfigJSON), &cfg); err != nil {
+			return nil, fmt.Errorf("invalid config_json: %w", err)
+		}
+		return NewWechatGateway(cfg, r.httpClient)
+	case domain.ChannelTypeStripe:
+		var cfg StripeChannelConfig
+		if err := json.Unmarshal([]byte(channel.ConfigJSON), &cfg); err != nil {
+			return nil, fmt.Errorf("invalid config_json: %w", err)
+		}
+		return NewStripeGateway(cfg, r.httpClient)
+	default:
+		return nil, fmt.Errorf("unsupported channel type %q", channel.Type)
+	}
+}
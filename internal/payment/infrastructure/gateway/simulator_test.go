@@ -0,0 +1,436 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	simapp "github.com/wyfcoding/ecommerce/internal/paymentsim/application"
+	simdomain "github.com/wyfcoding/ecommerce/internal/paymentsim/domain"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/infrastructure/notify"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/infrastructure/signer"
+	simhttp "github.com/wyfcoding/ecommerce/internal/paymentsim/interfaces/http"
+)
+
+// simCallback 回调端点收到的一次渠道通知及其处理结果。
+type simCallback struct {
+	notification *domain.PaymentNotification
+	applied      bool // 推进了支付状态
+	err          error
+}
+
+// simEnv 渠道模拟器与支付服务侧的渠道客户端、回调端点。
+// 渠道配置与验签配置均取自模拟器 /sim/credentials，与支付服务接入模拟器的方式一致。
+type simEnv struct {
+	sim       *simapp.Simulator
+	gateways  map[domain.GatewayType]domain.PaymentGateway
+	verifiers map[domain.GatewayType]domain.NotificationVerifier
+
+	mu        sync.Mutex
+	payments  map[string]*domain.Payment
+	callbacks map[string]chan simCallback
+}
+
+func newSimEnv(t *testing.T) *simEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	env := &simEnv{
+		gateways:  make(map[domain.GatewayType]domain.PaymentGateway),
+		verifiers: make(map[domain.GatewayType]domain.NotificationVerifier),
+		payments:  make(map[string]*domain.Payment),
+		callbacks: make(map[string]chan simCallback),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /payments/notify/{gateway}", env.handleNotify)
+	notifySrv := httptest.NewServer(mux)
+	t.Cleanup(notifySrv.Close)
+
+	alipay, err := signer.NewAlipay(signer.AlipayConfig{SellerID: "2088000000000001", NotifyURL: notifySrv.URL + "/payments/notify/alipay"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wechat, err := signer.NewWechat(signer.WechatConfig{NotifyURL: notifySrv.URL + "/payments/notify/wechat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stripe := signer.NewStripe(signer.StripeConfig{WebhookURL: notifySrv.URL + "/payments/notify/stripe"})
+
+	env.sim = simapp.NewSimulator(simdomain.Scenario{}, logger)
+	client := &http.Client{}
+	env.sim.RegisterNotifier(notify.NewAlipayNotifier(alipay, client))
+	env.sim.RegisterNotifier(notify.NewWechatNotifier(wechat, client))
+	env.sim.RegisterNotifier(notify.NewStripeNotifier(stripe, client))
+	t.Cleanup(env.sim.Close)
+
+	engine := gin.New()
+	simSrv := httptest.NewServer(engine)
+	t.Cleanup(simSrv.Close)
+	simhttp.NewHandler(env.sim, alipay, wechat, stripe, simSrv.URL, logger).RegisterRoutes(engine)
+
+	env.loadCredentials(t, simSrv.URL, logger)
+	return env
+}
+
+// loadCredentials 按模拟器导出的凭据创建渠道客户端与通知验签器。
+func (e *simEnv) loadCredentials(t *testing.T, simURL string, logger *slog.Logger) {
+	t.Helper()
+	resp, err := http.Get(simURL + "/sim/credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var creds struct {
+		Data struct {
+			Channels []struct {
+				Type       domain.ChannelType `json:"type"`
+				ConfigJSON string             `json:"config_json"`
+			} `json:"channels"`
+			Gateways struct {
+				Alipay struct {
+					AppID           string `json:"app_id"`
+					SellerID        string `json:"seller_id"`
+					AlipayPublicKey string `json:"alipay_public_key"`
+				} `json:"alipay"`
+				Wechat struct {
+					AppID         string        `json:"app_id"`
+					MchID         string        `json:"mch_id"`
+					APIv3Key      string        `json:"api_v3_key"`
+					PlatformCerts []string      `json:"platform_certs"`
+					Tolerance     time.Duration `json:"tolerance"`
+				} `json:"wechat"`
+				Stripe struct {
+					AccountID     string        `json:"account_id"`
+					WebhookSecret string        `json:"webhook_secret"`
+					Tolerance     time.Duration `json:"tolerance"`
+				} `json:"stripe"`
+			} `json:"gateways"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&creds); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewRegistry(nil, &http.Client{Timeout: 5 * time.Second}, nil, logger)
+	for _, ch := range creds.Data.Channels {
+		g, err := registry.build(&domain.ChannelConfig{Type: ch.Type, ConfigJSON: ch.ConfigJSON})
+		if err != nil {
+			t.Fatalf("build %s gateway: %v", ch.Type, err)
+		}
+		e.gateways[domain.GatewayType(ch.Type)] = g
+	}
+
+	verifiers, err := NewNotificationVerifiers(Config{
+		Alipay: AlipayConfig(creds.Data.Gateways.Alipay),
+		Wechat: WechatConfig(creds.Data.Gateways.Wechat),
+		Stripe: StripeConfig(creds.Data.Gateways.Stripe),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range verifiers {
+		e.verifiers[v.Gateway()] = v
+	}
+	if len(e.gateways) != 3 || len(e.verifiers) != 3 {
+		t.Fatalf("gateways = %d, verifiers = %d, want 3 each", len(e.gateways), len(e.verifiers))
+	}
+}
+
+// handleNotify 模拟支付服务的回调端点：验签、核对金额、推进支付状态，并按渠道约定应答。
+func (e *simEnv) handleNotify(w http.ResponseWriter, r *http.Request) {
+	gatewayType := domain.GatewayType(r.PathValue("gateway"))
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	headers := make(map[string]string, len(r.Header))
+	for k := range r.Header {
+		headers[k] = r.Header.Get(k)
+	}
+
+	cb := e.process(r.Context(), gatewayType, &domain.NotifyRequest{Headers: headers, Body: body})
+	if cb.notification != nil {
+		e.mu.Lock()
+		ch := e.callbacks[cb.notification.PaymentNo]
+		e.mu.Unlock()
+		if ch != nil {
+			ch <- cb
+		}
+	}
+
+	switch {
+	case gatewayType == domain.GatewayTypeAlipay && cb.err == nil:
+		fmt.Fprint(w, "success")
+	case gatewayType == domain.GatewayTypeAlipay:
+		fmt.Fprint(w, "failure")
+	case cb.err != nil:
+		w.WriteHeader(http.StatusBadRequest)
+	case gatewayType == domain.GatewayTypeWechat:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fmt.Fprint(w, `{"received":true}`)
+	}
+}
+
+func (e *simEnv) process(ctx context.Context, gatewayType domain.GatewayType, req *domain.NotifyRequest) simCallback {
+	v, ok := e.verifiers[gatewayType]
+	if !ok {
+		return simCallback{err: domain.ErrUnsupportedNotifyGateway}
+	}
+	n, err := v.Verify(ctx, req)
+	if err != nil {
+		return simCallback{err: err}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p := e.payments[n.PaymentNo]
+	if p == nil {
+		return simCallback{notification: n, err: fmt.Errorf("payment %s not found", n.PaymentNo)}
+	}
+	if err := p.VerifyNotification(n); err != nil {
+		return simCallback{notification: n, err: err}
+	}
+	applied, err := p.ApplyNotification(ctx, n)
+	return simCallback{notification: n, applied: applied, err: err}
+}
+
+// createPayment 为支付单设置场景后向渠道下单。
+func (e *simEnv) createPayment(t *testing.T, gatewayType domain.GatewayType, paymentNo string, amount int64, currency string, sc simdomain.Scenario) *domain.Payment {
+	t.Helper()
+	p := &domain.Payment{PaymentNo: paymentNo, Amount: amount, Currency: currency, GatewayType: gatewayType, Status: domain.PaymentPending}
+	e.mu.Lock()
+	e.payments[paymentNo] = p
+	e.callbacks[paymentNo] = make(chan simCallback, 16)
+	e.mu.Unlock()
+
+	e.sim.SetScenario(paymentNo, sc)
+	resp, err := e.gateways[gatewayType].PreAuth(context.Background(), &domain.PaymentGatewayRequest{OrderID: paymentNo, Amount: amount, Currency: currency, Description: "sim " + paymentNo})
+	if err != nil {
+		t.Fatalf("PreAuth: %v", err)
+	}
+	if resp.PaymentURL == "" {
+		t.Fatalf("PreAuth response = %+v, want payment url", resp)
+	}
+	e.mu.Lock()
+	p.TransactionID = resp.TransactionID
+	e.mu.Unlock()
+	return p
+}
+
+// tradeOf 读取支付单的渠道交易引用，回调可能同时在更新支付单。
+func (e *simEnv) tradeOf(p *domain.Payment) *domain.GatewayTrade {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return p.TradeOf()
+}
+
+// waitCallback 等待支付单的下一次回调。
+func (e *simEnv) waitCallback(t *testing.T, paymentNo string) simCallback {
+	t.Helper()
+	e.mu.Lock()
+	ch := e.callbacks[paymentNo]
+	e.mu.Unlock()
+	select {
+	case cb := <-ch:
+		return cb
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no callback for %s", paymentNo)
+		return simCallback{}
+	}
+}
+
+// expectNoCallback 断言一段时间内支付单没有收到回调。
+func (e *simEnv) expectNoCallback(t *testing.T, paymentNo string, d time.Duration) {
+	t.Helper()
+	e.mu.Lock()
+	ch := e.callbacks[paymentNo]
+	e.mu.Unlock()
+	select {
+	case cb := <-ch:
+		t.Fatalf("unexpected callback %+v", cb.notification)
+	case <-time.After(d):
+	}
+}
+
+// awaitTrade 轮询渠道查询，直到交易离开待支付状态。
+func (e *simEnv) awaitTrade(t *testing.T, p *domain.Payment) *domain.GatewayTradeResult {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		result, err := e.gateways[p.GatewayType].QueryTrade(context.Background(), e.tradeOf(p))
+		if err != nil {
+			t.Fatalf("QueryTrade: %v", err)
+		}
+		if result.State != domain.GatewayTradePending || time.Now().After(deadline) {
+			return result
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSimulatorScenarios(t *testing.T) {
+	env := newSimEnv(t)
+	ctx := context.Background()
+
+	channels := []struct {
+		gateway      domain.GatewayType
+		currency     string
+		failedState  domain.GatewayTradeState // 支付失败后的查询状态：Stripe 失败的 PaymentIntent 仍可重新支付
+		mismatchCode string
+	}{
+		{gateway: domain.GatewayTypeAlipay, currency: "CNY", failedState: domain.GatewayTradeClosed, mismatchCode: "AMOUNT_MISMATCH"},
+		{gateway: domain.GatewayTypeWechat, currency: "CNY", failedState: domain.GatewayTradeClosed, mismatchCode: "AMOUNT_MISMATCH"},
+		{gateway: domain.GatewayTypeStripe, currency: "USD", failedState: domain.GatewayTradePending, mismatchCode: "amount_mismatch"},
+	}
+	const amount = 8800
+
+	for _, ch := range channels {
+		gw := env.gateways[ch.gateway]
+		paymentNo := func(name string) string { return fmt.Sprintf("PAY-%s-%s", ch.gateway, name) }
+
+		t.Run(string(ch.gateway)+"/manual pay", func(t *testing.T) {
+			p := env.createPayment(t, ch.gateway, paymentNo("manual"), amount, ch.currency, simdomain.Scenario{})
+			result, err := gw.QueryTrade(ctx, env.tradeOf(p))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.State != domain.GatewayTradePending {
+				t.Fatalf("unpaid trade state = %v", result.State)
+			}
+			if _, err := gw.Capture(ctx, env.tradeOf(p), amount); err == nil {
+				t.Fatal("capture of unpaid trade should fail")
+			}
+
+			if _, err := env.sim.Pay(ctx, simdomain.Gateway(ch.gateway), p.PaymentNo); err != nil {
+				t.Fatal(err)
+			}
+			cb := env.waitCallback(t, p.PaymentNo)
+			if cb.err != nil || !cb.applied || cb.notification.Result != domain.NotifyResultSuccess {
+				t.Fatalf("callback = %+v, err = %v", cb.notification, cb.err)
+			}
+			if p.Status != domain.PaymentSuccess || p.CapturedAmount != amount || p.TransactionID == "" {
+				t.Fatalf("payment status = %v, paid = %d, transaction = %q", p.Status, p.CapturedAmount, p.TransactionID)
+			}
+			if _, err := gw.Capture(ctx, env.tradeOf(p), amount); err != nil {
+				t.Fatalf("capture: %v", err)
+			}
+		})
+
+		t.Run(string(ch.gateway)+"/pay failure", func(t *testing.T) {
+			p := env.createPayment(t, ch.gateway, paymentNo("fail"), amount, ch.currency, simdomain.Scenario{AutoPay: true, PayFail: true})
+			cb := env.waitCallback(t, p.PaymentNo)
+			if cb.err != nil || !cb.applied || cb.notification.Result != domain.NotifyResultFailed {
+				t.Fatalf("callback = %+v, err = %v", cb.notification, cb.err)
+			}
+			if p.Status != domain.PaymentCancelled {
+				t.Fatalf("payment status = %v, want cancelled", p.Status)
+			}
+			result, err := gw.QueryTrade(ctx, env.tradeOf(p))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.State != ch.failedState {
+				t.Fatalf("failed trade state = %v, want %v", result.State, ch.failedState)
+			}
+		})
+
+		t.Run(string(ch.gateway)+"/duplicate callbacks", func(t *testing.T) {
+			p := env.createPayment(t, ch.gateway, paymentNo("dup"), amount, ch.currency, simdomain.Scenario{AutoPay: true, CallbackCount: 2})
+			first := env.waitCallback(t, p.PaymentNo)
+			second := env.waitCallback(t, p.PaymentNo)
+			if first.err != nil || !first.applied {
+				t.Fatalf("first callback applied = %v, err = %v", first.applied, first.err)
+			}
+			// 重复回调应被确认但不再推进状态
+			if second.err != nil || second.applied {
+				t.Fatalf("duplicate callback applied = %v, err = %v", second.applied, second.err)
+			}
+			if p.Status != domain.PaymentSuccess {
+				t.Fatalf("payment status = %v", p.Status)
+			}
+		})
+
+		t.Run(string(ch.gateway)+"/suppressed callback", func(t *testing.T) {
+			p := env.createPayment(t, ch.gateway, paymentNo("silent"), amount, ch.currency, simdomain.Scenario{AutoPay: true, SuppressCallback: true})
+			result := env.awaitTrade(t, p)
+			if result.State != domain.GatewayTradeSuccess || result.Amount != amount {
+				t.Fatalf("query result = %+v", result)
+			}
+			env.expectNoCallback(t, p.PaymentNo, 200*time.Millisecond)
+		})
+
+		t.Run(string(ch.gateway)+"/delayed payment", func(t *testing.T) {
+			p := env.createPayment(t, ch.gateway, paymentNo("slowpay"), amount, ch.currency, simdomain.Scenario{AutoPay: true, PayDelay: 300 * time.Millisecond})
+			result, err := gw.QueryTrade(ctx, env.tradeOf(p))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.State != domain.GatewayTradePending {
+				t.Fatalf("trade state before pay delay = %v", result.State)
+			}
+			if cb := env.waitCallback(t, p.PaymentNo); cb.err != nil || !cb.applied {
+				t.Fatalf("callback applied = %v, err = %v", cb.applied, cb.err)
+			}
+		})
+
+		t.Run(string(ch.gateway)+"/delayed callback", func(t *testing.T) {
+			p := env.createPayment(t, ch.gateway, paymentNo("slownotify"), amount, ch.currency, simdomain.Scenario{AutoPay: true, CallbackDelay: 500 * time.Millisecond})
+			// 回调到达前查询即可确认支付成功
+			if result := env.awaitTrade(t, p); result.State != domain.GatewayTradeSuccess {
+				t.Fatalf("query result = %+v", result)
+			}
+			env.expectNoCallback(t, p.PaymentNo, 100*time.Millisecond)
+			if cb := env.waitCallback(t, p.PaymentNo); cb.err != nil || !cb.applied {
+				t.Fatalf("callback applied = %v, err = %v", cb.applied, cb.err)
+			}
+		})
+
+		t.Run(string(ch.gateway)+"/amount mismatch", func(t *testing.T) {
+			p := env.createPayment(t, ch.gateway, paymentNo("short"), amount, ch.currency, simdomain.Scenario{AutoPay: true, AmountDelta: -100})
+			cb := env.waitCallback(t, p.PaymentNo)
+			if !errors.Is(cb.err, domain.ErrNotifyAmountMismatch) || cb.notification.Amount != amount-100 {
+				t.Fatalf("callback amount = %d, err = %v", cb.notification.Amount, cb.err)
+			}
+			if p.Status != domain.PaymentPending {
+				t.Fatalf("payment status = %v, want pending", p.Status)
+			}
+			_, err := gw.Capture(ctx, env.tradeOf(p), amount)
+			assertGatewayError(t, err, domain.ErrGatewayRejected, ch.mismatchCode)
+		})
+
+		t.Run(string(ch.gateway)+"/partial refund failure", func(t *testing.T) {
+			p := env.createPayment(t, ch.gateway, paymentNo("refund"), amount, ch.currency, simdomain.Scenario{AutoPay: true, FailPartialRefund: true})
+			if cb := env.waitCallback(t, p.PaymentNo); cb.err != nil || !cb.applied {
+				t.Fatalf("callback applied = %v, err = %v", cb.applied, cb.err)
+			}
+
+			resp, err := gw.Refund(ctx, &domain.RefundGatewayRequest{Trade: env.tradeOf(p), RefundNo: p.PaymentNo + "-R1", Amount: 1000})
+			switch {
+			case err != nil:
+				assertGatewayError(t, err, domain.ErrGatewayRejected, "")
+			case resp.Status != domain.RefundGatewayFailed:
+				t.Fatalf("partial refund status = %v, want failed", resp.Status)
+			}
+
+			resp, err = gw.Refund(ctx, &domain.RefundGatewayRequest{Trade: env.tradeOf(p), RefundNo: p.PaymentNo + "-R2", Amount: amount})
+			if err != nil {
+				t.Fatalf("full refund: %v", err)
+			}
+			if resp.Status != domain.RefundGatewaySuccess {
+				t.Fatalf("full refund status = %v", resp.Status)
+			}
+		})
+	}
+}
@@ -2,68 +2,353 @@ package gateway
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
 )
 
-type StripeGateway struct{}
+// stripeDefaultBaseURL Stripe API 地址。
+const stripeDefaultBaseURL = "https://api.stripe.com"
 
-func NewStripeGateway() *StripeGateway { return &StripeGateway{} }
+// stripePageSize 列表接口单页条数上限。
+const stripePageSize = 100
 
+// StripeChannelConfig Stripe 渠道配置，对应 ChannelConfig.ConfigJSON。
+type StripeChannelConfig struct {
+	SecretKey string `json:"secret_key"`
+	AccountID string `json:"account_id"` // Connect 子账户，非空时以 Stripe-Account 头代为请求
+	BaseURL   string `json:"base_url"`
+}
+
+// StripeGateway Stripe PaymentIntents 客户端。
+type StripeGateway struct {
+	cfg        StripeChannelConfig
+	httpClient *http.Client
+}
+
+// NewStripeGateway 创建 Stripe 客户端。
+func NewStripeGateway(cfg StripeChannelConfig, httpClient *http.Client) (*StripeGateway, error) {
+	if cfg.SecretKey == "" {
+		return nil, errors.New("stripe: secret_key is required")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = stripeDefaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if httpClient == nil {
+		httpClient = NewHTTPClient()
+	}
+	return &StripeGateway{cfg: cfg, httpClient: httpClient}, nil
+}
+
+// stripeIntent PaymentIntent 对象中使用的字段。
+type stripeIntent struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	Amount         int64  `json:"amount"`
+	AmountReceived int64  `json:"amount_received"`
+	Currency       string `json:"currency"`
+	ClientSecret   string `json:"client_secret"`
+}
+
+// stripeRefund Refund 对象中使用的字段。
+type stripeRefund struct {
+	ID       string            `json:"id"`
+	Status   string            `json:"status"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// PreAuth 创建 PaymentIntent (POST /v1/payment_intents)，metadata.payment_no 供 Webhook 反查支付单。
+// PaymentURL 返回 client_secret，由前端 Stripe.js 完成确认。
 func (g *StripeGateway) PreAuth(ctx context.Context, req *domain.PaymentGatewayRequest) (*domain.PaymentGatewayResponse, error) {
-	// 真实化执行：验证金额并模拟 Stripe PaymentIntent
-	if req.Amount < 50 {
-		return nil, fmt.Errorf("stripe_gateway: amount below minimum threshold (50 cents)")
+	currency := req.Currency
+	if currency == "" {
+		currency = "CNY"
+	}
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(req.Amount, 10))
+	form.Set("currency", strings.ToLower(currency))
+	form.Set("automatic_payment_methods[enabled]", "true")
+	form.Set("metadata[payment_no]", req.OrderID)
+	if req.Description != "" {
+		form.Set("description", req.Description)
+	}
+	var intent stripeIntent
+	raw, err := g.call(ctx, http.MethodPost, "/v1/payment_intents", form, "pi-"+req.OrderID, &intent)
+	if err != nil {
+		return nil, err
 	}
+	return &domain.PaymentGatewayResponse{TransactionID: intent.ID, PaymentURL: intent.ClientSecret, RawResponse: string(raw)}, nil
+}
 
-	slog.InfoContext(ctx, "stripe payment_intent creating", "order_id", req.OrderID, "amount", req.Amount)
+// QueryTrade 查询 PaymentIntent (GET /v1/payment_intents/{id})。
+func (g *StripeGateway) QueryTrade(ctx context.Context, trade *domain.GatewayTrade) (*domain.GatewayTradeResult, error) {
+	if trade.TransactionID == "" {
+		return nil, domain.NewGatewayError(domain.GatewayTypeStripe, domain.ErrGatewayRejected, "MISSING_INTENT", "payment intent id is required")
+	}
+	var intent stripeIntent
+	raw, err := g.call(ctx, http.MethodGet, "/v1/payment_intents/"+url.PathEscape(trade.TransactionID), nil, "", &intent)
+	if err != nil {
+		return nil, err
+	}
+	result := &domain.GatewayTradeResult{
+		TransactionID: intent.ID,
+		Amount:        intent.Amount,
+		Currency:      strings.ToUpper(intent.Currency),
+		RawResponse:   string(raw),
+	}
+	switch intent.Status {
+	case "succeeded":
+		result.State = domain.GatewayTradeSuccess
+		result.Amount = intent.AmountReceived
+	case "canceled":
+		result.State = domain.GatewayTradeClosed
+	case "requires_capture":
+		// 手动扣款模式下资金已冻结，授权有效期由渠道决定，不按待支付超时关闭
+		result.State = domain.GatewayTradeAuthorized
+	default: // requires_payment_method、requires_action、processing 等
+		result.State = domain.GatewayTradePending
+	}
+	return result, nil
+}
 
-	return &domain.PaymentGatewayResponse{
-		TransactionID: fmt.Sprintf("pi_%d_%s", time.Now().UnixNano(), req.OrderID),
-		PaymentURL:    "https://checkout.stripe.com/pay/" + req.OrderID,
-		RawResponse:   `{"status": "requires_payment_method"}`,
-	}, nil
+// Capture 查询 PaymentIntent：手动扣款模式下处于 requires_capture 时发起扣款，自动扣款模式下核对 succeeded 的实收金额。
+func (g *StripeGateway) Capture(ctx context.Context, trade *domain.GatewayTrade, amount int64) (*domain.PaymentGatewayResponse, error) {
+	if trade.TransactionID == "" {
+		return nil, domain.NewGatewayError(domain.GatewayTypeStripe, domain.ErrGatewayRejected, "MISSING_INTENT", "payment intent id is required")
+	}
+	path := "/v1/payment_intents/" + url.PathEscape(trade.TransactionID)
+	var intent stripeIntent
+	raw, err := g.call(ctx, http.MethodGet, path, nil, "", &intent)
+	if err != nil {
+		return nil, err
+	}
+	if intent.Status == "requires_capture" {
+		form := url.Values{}
+		form.Set("amount_to_capture", strconv.FormatInt(amount, 10))
+		if raw, err = g.call(ctx, http.MethodPost, path+"/capture", form, "capture-"+trade.PaymentNo, &intent); err != nil {
+			return nil, err
+		}
+	}
+	if intent.Status != "succeeded" {
+		return nil, domain.NewGatewayError(domain.GatewayTypeStripe, domain.ErrGatewayRejected, intent.Status, "payment intent is not succeeded")
+	}
+	if intent.AmountReceived != amount {
+		return nil, domain.NewGatewayError(domain.GatewayTypeStripe, domain.ErrGatewayRejected, "amount_mismatch", fmt.Sprintf("received %d, expected %d", intent.AmountReceived, amount))
+	}
+	return &domain.PaymentGatewayResponse{TransactionID: intent.ID, RawResponse: string(raw)}, nil
 }
 
-func (g *StripeGateway) Capture(ctx context.Context, transactionID string, amount int64) (*domain.PaymentGatewayResponse, error) {
-	// 真实化执行：模拟支付确认
-	slog.InfoContext(ctx, "stripe capture executing", "transaction_id", transactionID, "amount", amount)
+// Void 取消 PaymentIntent (POST /v1/payment_intents/{id}/cancel)。
+func (g *StripeGateway) Void(ctx context.Context, trade *domain.GatewayTrade) error {
+	if trade.TransactionID == "" {
+		return nil
+	}
+	_, err := g.call(ctx, http.MethodPost, "/v1/payment_intents/"+url.PathEscape(trade.TransactionID)+"/cancel", url.Values{}, "cancel-"+trade.PaymentNo, nil)
+	return err
+}
 
-	return &domain.PaymentGatewayResponse{
-		TransactionID: transactionID,
-		RawResponse:   `{"status": "succeeded"}`,
-	}, nil
+// Refund 创建退款 (POST /v1/refunds)，以本方退款单号作为幂等键。
+func (g *StripeGateway) Refund(ctx context.Context, req *domain.RefundGatewayRequest) (*domain.RefundGatewayResponse, error) {
+	form := url.Values{}
+	form.Set("payment_intent", req.Trade.TransactionID)
+	form.Set("amount", strconv.FormatInt(req.Amount, 10))
+	form.Set("metadata[refund_no]", req.RefundNo)
+	form.Set("reason", "requested_by_customer")
+	var refund stripeRefund
+	raw, err := g.call(ctx, http.MethodPost, "/v1/refunds", form, "refund-"+req.RefundNo, &refund)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.RefundGatewayResponse{GatewayRefundID: refund.ID, Status: stripeRefundStatus(refund.Status), RawResponse: string(raw)}, nil
 }
 
-func (g *StripeGateway) Void(ctx context.Context, transactionID string) error {
-	return nil
+// QueryRefund 查询退款。已知渠道退款单号时直接查询，否则按 PaymentIntent 列出退款并匹配 metadata.refund_no。
+func (g *StripeGateway) QueryRefund(ctx context.Context, req *domain.RefundGatewayRequest) (*domain.RefundGatewayResponse, error) {
+	if req.GatewayRefundID != "" {
+		var refund stripeRefund
+		raw, err := g.call(ctx, http.MethodGet, "/v1/refunds/"+url.PathEscape(req.GatewayRefundID), nil, "", &refund)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.RefundGatewayResponse{GatewayRefundID: refund.ID, Status: stripeRefundStatus(refund.Status), RawResponse: string(raw)}, nil
+	}
+
+	var list struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	path := "/v1/refunds?limit=" + strconv.Itoa(stripePageSize) + "&payment_intent=" + url.QueryEscape(req.Trade.TransactionID)
+	if _, err := g.call(ctx, http.MethodGet, path, nil, "", &list); err != nil {
+		return nil, err
+	}
+	for _, raw := range list.Data {
+		var refund stripeRefund
+		if err := json.Unmarshal(raw, &refund); err == nil && refund.Metadata["refund_no"] == req.RefundNo {
+			return &domain.RefundGatewayResponse{GatewayRefundID: refund.ID, Status: stripeRefundStatus(refund.Status), RawResponse: string(raw)}, nil
+		}
+	}
+	return nil, domain.NewGatewayError(domain.GatewayTypeStripe, domain.ErrGatewayRejected, "resource_missing", "refund "+req.RefundNo+" not found")
 }
 
-func (g *StripeGateway) Refund(ctx context.Context, transactionID string, amount int64) error {
-	// 真实化执行：模拟调用 Stripe Refunds Create API
-	if amount < 50 {
-		return fmt.Errorf("stripe_gateway: refund amount below minimum (50 cents)")
+// DownloadBill 分页拉取当日 (UTC) 的余额流水 (GET /v1/balance_transactions)，展开 source 以取得 PaymentIntent 与退款元数据。
+// 每个接口分页回调一次。
+func (g *StripeGateway) DownloadBill(ctx context.Context, date time.Time, fn func(page []*domain.GatewayBillItem) error) error {
+	start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(stripePageSize))
+	query.Set("created[gte]", strconv.FormatInt(start.Unix(), 10))
+	query.Set("created[lt]", strconv.FormatInt(start.AddDate(0, 0, 1).Unix(), 10))
+	query.Add("expand[]", "data.source")
+
+	total := 0
+	for {
+		var page struct {
+			HasMore bool `json:"has_more"`
+			Data    []struct {
+				ID      string `json:"id"`
+				Type    string `json:"type"`
+				Amount  int64  `json:"amount"`
+				Fee     int64  `json:"fee"`
+				Created int64  `json:"created"`
+				Source  struct {
+					ID            string            `json:"id"`
+					PaymentIntent string            `json:"payment_intent"`
+					Metadata      map[string]string `json:"metadata"`
+				} `json:"source"`
+			} `json:"data"`
+		}
+		if _, err := g.call(ctx, http.MethodGet, "/v1/balance_transactions?"+query.Encode(), nil, "", &page); err != nil {
+			return err
+		}
+		items := make([]*domain.GatewayBillItem, 0, len(page.Data))
+		for _, txn := range page.Data {
+			item := &domain.GatewayBillItem{
+				TransactionID: txn.Source.PaymentIntent,
+				PaymentNo:     txn.Source.Metadata["payment_no"],
+				Amount:        txn.Amount,
+				Fee:           txn.Fee,
+				PaidAt:        time.Unix(txn.Created, 0),
+			}
+			switch txn.Type {
+			case "charge", "payment":
+				item.Status = domain.BillStatusSuccess
+			case "refund", "payment_refund":
+				item.Status = domain.BillStatusRefund
+				item.Amount = -txn.Amount
+				item.Fee = -txn.Fee
+				item.RefundNo = txn.Source.Metadata["refund_no"]
+			default:
+				continue // 手续费、提现等资金流水不参与订单对账
+			}
+			items = append(items, item)
+		}
+		if len(items) > 0 {
+			total += len(items)
+			if err := fn(items); err != nil {
+				return err
+			}
+		}
+		if !page.HasMore || len(page.Data) == 0 {
+			break
+		}
+		query.Set("starting_after", page.Data[len(page.Data)-1].ID)
 	}
-	slog.InfoContext(ctx, "stripe refund creating", "txn_id", transactionID, "amount", amount)
+
+	slog.InfoContext(ctx, "stripe balance transactions downloaded", "date", start.Format("2006-01-02"), "items", total)
 	return nil
 }
 
-// DownloadBill 获取指定日期的 Stripe 对账单。
-func (g *StripeGateway) DownloadBill(ctx context.Context, date time.Time) ([]*domain.GatewayBillItem, error) {
-	// 真实化执行：模拟调用 Stripe API (/v1/balance_transactions)
-	slog.InfoContext(ctx, "downloading stripe reporting", "date", date.Format("2006-01-02"))
-
-	items := []*domain.GatewayBillItem{
-		{
-			TransactionID: "ST-TXN-30001",
-			PaymentNo:     "PAY-20240101-S01",
-			Amount:        9999, // 99.99 USD (假设已由领域层处理汇率)
-			Status:        "SUCCESS",
-			PaidAt:        date.Add(16 * time.Hour),
-		},
-	}
-	return items, nil
+// call 以表单编码发送请求。写操作携带 Idempotency-Key，网络重试时 Stripe 返回首次结果。
+func (g *StripeGateway) call(ctx context.Context, method, path string, form url.Values, idempotencyKey string, out any) ([]byte, error) {
+	var body *strings.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, g.cfg.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+g.cfg.SecretKey)
+	if form != nil {
+		httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if idempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	if g.cfg.AccountID != "" {
+		httpReq.Header.Set("Stripe-Account", g.cfg.AccountID)
+	}
+
+	httpResp, respBody, err := doHTTP(g.httpClient, domain.GatewayTypeStripe, httpReq, maxResponseBytes)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode >= http.StatusMultipleChoices {
+		return respBody, stripeError(httpResp.StatusCode, respBody)
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return nil, domain.NewGatewayError(domain.GatewayTypeStripe, domain.ErrGatewayUnavailable, "malformed_response", err.Error())
+		}
+	}
+	return respBody, nil
+}
+
+// stripeError 映射 Stripe 错误应答 {"error":{"type","code","decline_code","message"}}。
+// api_error、限流与 5xx 可重试；authentication_error 与 401/403 为配置问题；card_error 等其余错误为业务拒绝。
+func stripeError(statusCode int, body []byte) error {
+	var resp struct {
+		Error struct {
+			Type        string `json:"type"`
+			Code        string `json:"code"`
+			DeclineCode string `json:"decline_code"`
+			Message     string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(body, &resp)
+
+	code := resp.Error.DeclineCode
+	if code == "" {
+		code = resp.Error.Code
+	}
+	if code == "" {
+		code = resp.Error.Type
+	}
+	if code == "" {
+		code = strconv.Itoa(statusCode)
+	}
+
+	kind := httpStatusKind(statusCode)
+	switch resp.Error.Type {
+	case "api_error":
+		kind = domain.ErrGatewayUnavailable
+	case "authentication_error":
+		kind = domain.ErrGatewayMisconfigured
+	}
+	if resp.Error.Code == "lock_timeout" || resp.Error.Code == "rate_limit" {
+		kind = domain.ErrGatewayUnavailable
+	}
+	return domain.NewGatewayError(domain.GatewayTypeStripe, kind, code, resp.Error.Message)
+}
+
+// stripeRefundStatus 映射退款状态：succeeded 到账，failed/canceled 失败，pending/requires_action 处理中。
+func stripeRefundStatus(status string) domain.RefundGatewayStatus {
+	switch status {
+	case "succeeded":
+		return domain.RefundGatewaySuccess
+	case "failed", "canceled":
+		return domain.RefundGatewayFailed
+	default:
+		return domain.RefundGatewayPending
+	}
 }
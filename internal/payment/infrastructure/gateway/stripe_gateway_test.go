@@ -0,0 +1,236 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// newStripeTestGateway 创建指向测试服务的 Stripe 客户端。
+func newStripeTestGateway(t *testing.T, handler http.HandlerFunc) *StripeGateway {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	g, err := NewStripeGateway(StripeChannelConfig{SecretKey: "sk_test", AccountID: "acct_1", BaseURL: srv.URL + "/"}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestStripePreAuth(t *testing.T) {
+	g := newStripeTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/payment_intents" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk_test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.Header.Get("Idempotency-Key"); got != "pi-PAY1" {
+			t.Errorf("Idempotency-Key = %q", got)
+		}
+		if got := r.Header.Get("Stripe-Account"); got != "acct_1" {
+			t.Errorf("Stripe-Account = %q", got)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.PostForm.Get("amount") != "1999" || r.PostForm.Get("currency") != "usd" || r.PostForm.Get("metadata[payment_no]") != "PAY1" {
+			t.Errorf("form = %v", r.PostForm)
+		}
+		fmt.Fprint(w, `{"id":"pi_1","status":"requires_payment_method","amount":1999,"currency":"usd","client_secret":"pi_1_secret"}`)
+	})
+
+	resp, err := g.PreAuth(context.Background(), &domain.PaymentGatewayRequest{OrderID: "PAY1", Amount: 1999, Currency: "USD"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.TransactionID != "pi_1" || resp.PaymentURL != "pi_1_secret" {
+		t.Fatalf("response = %+v", resp)
+	}
+}
+
+func TestStripeQueryTrade(t *testing.T) {
+	tests := []struct {
+		status     string
+		wantState  domain.GatewayTradeState
+		wantAmount int64
+	}{
+		{status: "succeeded", wantState: domain.GatewayTradeSuccess, wantAmount: 900},
+		{status: "canceled", wantState: domain.GatewayTradeClosed, wantAmount: 1000},
+		{status: "requires_capture", wantState: domain.GatewayTradeAuthorized, wantAmount: 1000},
+		{status: "processing", wantState: domain.GatewayTradePending, wantAmount: 1000},
+		{status: "requires_payment_method", wantState: domain.GatewayTradePending, wantAmount: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			g := newStripeTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Path != "/v1/payment_intents/pi_1" {
+					t.Errorf("request = %s %s", r.Method, r.URL.Path)
+				}
+				fmt.Fprintf(w, `{"id":"pi_1","status":%q,"amount":1000,"amount_received":900,"currency":"usd"}`, tt.status)
+			})
+			result, err := g.QueryTrade(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1", TransactionID: "pi_1"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.State != tt.wantState || result.Amount != tt.wantAmount || result.Currency != "USD" {
+				t.Fatalf("result = %+v", result)
+			}
+		})
+	}
+}
+
+func TestStripeCapture(t *testing.T) {
+	t.Run("captures authorized intent", func(t *testing.T) {
+		var captured bool
+		g := newStripeTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/v1/payment_intents/pi_1":
+				fmt.Fprint(w, `{"id":"pi_1","status":"requires_capture","amount":1000}`)
+			case r.Method == http.MethodPost && r.URL.Path == "/v1/payment_intents/pi_1/capture":
+				captured = true
+				if r.Header.Get("Idempotency-Key") != "capture-PAY1" || r.FormValue("amount_to_capture") != "800" {
+					t.Errorf("capture request headers=%v form=%v", r.Header, r.PostForm)
+				}
+				fmt.Fprint(w, `{"id":"pi_1","status":"succeeded","amount":1000,"amount_received":800}`)
+			default:
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+		})
+		resp, err := g.Capture(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1", TransactionID: "pi_1"}, 800)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !captured || resp.TransactionID != "pi_1" {
+			t.Fatalf("captured = %v, response = %+v", captured, resp)
+		}
+	})
+
+	t.Run("rejects amount mismatch", func(t *testing.T) {
+		g := newStripeTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"id":"pi_1","status":"succeeded","amount":1000,"amount_received":900}`)
+		})
+		_, err := g.Capture(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1", TransactionID: "pi_1"}, 1000)
+		assertGatewayError(t, err, domain.ErrGatewayRejected, "amount_mismatch")
+	})
+
+	t.Run("missing intent id", func(t *testing.T) {
+		g := newStripeTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		})
+		_, err := g.Capture(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1"}, 1000)
+		assertGatewayError(t, err, domain.ErrGatewayRejected, "MISSING_INTENT")
+	})
+}
+
+func TestStripeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantKind error
+		wantCode string
+	}{
+		{
+			name:   "card declined",
+			status: http.StatusPaymentRequired, body: `{"error":{"type":"card_error","code":"card_declined","decline_code":"insufficient_funds","message":"Your card has insufficient funds."}}`,
+			wantKind: domain.ErrGatewayRejected, wantCode: "insufficient_funds",
+		},
+		{
+			name:   "invalid request",
+			status: http.StatusBadRequest, body: `{"error":{"type":"invalid_request_error","code":"parameter_invalid_integer","message":"Invalid integer"}}`,
+			wantKind: domain.ErrGatewayRejected, wantCode: "parameter_invalid_integer",
+		},
+		{
+			name:   "authentication error",
+			status: http.StatusUnauthorized, body: `{"error":{"type":"authentication_error","message":"Invalid API Key"}}`,
+			wantKind: domain.ErrGatewayMisconfigured, wantCode: "authentication_error",
+		},
+		{
+			name:   "api error",
+			status: http.StatusInternalServerError, body: `{"error":{"type":"api_error","message":"Something went wrong"}}`,
+			wantKind: domain.ErrGatewayUnavailable, wantCode: "api_error",
+		},
+		{
+			name:   "rate limited",
+			status: http.StatusTooManyRequests, body: `{"error":{"type":"invalid_request_error","code":"rate_limit"}}`,
+			wantKind: domain.ErrGatewayUnavailable, wantCode: "rate_limit",
+		},
+		{
+			name:   "lock timeout",
+			status: http.StatusConflict, body: `{"error":{"type":"invalid_request_error","code":"lock_timeout"}}`,
+			wantKind: domain.ErrGatewayUnavailable, wantCode: "lock_timeout",
+		},
+		{
+			name:   "non json bad gateway",
+			status: http.StatusBadGateway, body: `<html>bad gateway</html>`,
+			wantKind: domain.ErrGatewayUnavailable, wantCode: "502",
+		},
+		{
+			name:   "malformed success body",
+			status: http.StatusOK, body: `{"id":`,
+			wantKind: domain.ErrGatewayUnavailable, wantCode: "malformed_response",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newStripeTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+			_, err := g.Refund(context.Background(), &domain.RefundGatewayRequest{Trade: &domain.GatewayTrade{TransactionID: "pi_1"}, RefundNo: "REF1", Amount: 100})
+			assertGatewayError(t, err, tt.wantKind, tt.wantCode)
+		})
+	}
+}
+
+func TestStripeTimeout(t *testing.T) {
+	srv, client := slowServer(t)
+	g, err := NewStripeGateway(StripeChannelConfig{SecretKey: "sk_test", BaseURL: srv.URL}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.QueryTrade(context.Background(), &domain.GatewayTrade{TransactionID: "pi_1"})
+	assertGatewayError(t, err, domain.ErrGatewayUnavailable, "NETWORK_ERROR")
+	if !domain.IsRetryableGatewayError(err) {
+		t.Fatalf("timeout should be retryable: %v", err)
+	}
+}
+
+func TestStripeRefund(t *testing.T) {
+	tests := []struct {
+		status string
+		want   domain.RefundGatewayStatus
+	}{
+		{"succeeded", domain.RefundGatewaySuccess},
+		{"pending", domain.RefundGatewayPending},
+		{"requires_action", domain.RefundGatewayPending},
+		{"failed", domain.RefundGatewayFailed},
+		{"canceled", domain.RefundGatewayFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			g := newStripeTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/refunds" || r.Header.Get("Idempotency-Key") != "refund-REF1" {
+					t.Errorf("request = %s %s", r.Method, r.URL.Path)
+				}
+				if r.FormValue("payment_intent") != "pi_1" || r.FormValue("amount") != "300" || r.FormValue("metadata[refund_no]") != "REF1" {
+					t.Errorf("form = %v", r.PostForm)
+				}
+				fmt.Fprintf(w, `{"id":"re_1","status":%q}`, tt.status)
+			})
+			resp, err := g.Refund(context.Background(), &domain.RefundGatewayRequest{Trade: &domain.GatewayTrade{TransactionID: "pi_1"}, RefundNo: "REF1", Amount: 300})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.GatewayRefundID != "re_1" || resp.Status != tt.want {
+				t.Fatalf("response = %+v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// StripeWebhookVerifier Stripe Webhook 签名校验器。
+// Stripe-Signature 形如 "t=1492774577,v1=5257a869...,v0=..."，签名为 HMAC-SHA256(secret, "{t}.{body}")。
+type StripeWebhookVerifier struct {
+	cfg StripeConfig
+	now func() time.Time
+}
+
+// NewStripeWebhookVerifier 创建 Stripe Webhook 验签器。
+func NewStripeWebhookVerifier(cfg StripeConfig) *StripeWebhookVerifier {
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = defaultNotifyTolerance
+	}
+	return &StripeWebhookVerifier{cfg: cfg, now: time.Now}
+}
+
+func (v *StripeWebhookVerifier) Gateway() domain.GatewayType { return domain.GatewayTypeStripe }
+
+// stripeEvent Webhook 事件中与 PaymentIntent 相关的字段。
+type stripeEvent struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Account string `json:"account"`
+	Data    struct {
+		Object struct {
+			ID             string            `json:"id"`
+			Object         string            `json:"object"`
+			Amount         int64             `json:"amount"`
+			AmountReceived int64             `json:"amount_received"`
+			Currency       string            `json:"currency"`
+			Metadata       map[string]string `json:"metadata"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// Verify 校验签名与时间戳容差，并解析 PaymentIntent 事件。
+// 支付单号取自创建 PaymentIntent 时写入的 metadata.payment_no。
+func (v *StripeWebhookVerifier) Verify(ctx context.Context, req *domain.NotifyRequest) (*domain.PaymentNotification, error) {
+	if err := v.verifySignature(req.Header("Stripe-Signature"), req.Body); err != nil {
+		return nil, err
+	}
+
+	var event stripeEvent
+	if err := json.Unmarshal(req.Body, &event); err != nil {
+		return nil, fmt.Errorf("stripe: malformed event: %w", err)
+	}
+	if v.cfg.AccountID != "" && event.Account != v.cfg.AccountID {
+		return nil, fmt.Errorf("%w: stripe: account %s", domain.ErrNotifyMerchantMismatch, event.Account)
+	}
+
+	intent := event.Data.Object
+	if intent.Object != "payment_intent" {
+		return nil, fmt.Errorf("stripe: unsupported event object %q", intent.Object)
+	}
+	paymentNo := intent.Metadata["payment_no"]
+	if paymentNo == "" {
+		return nil, errors.New("stripe: payment_intent metadata.payment_no is missing")
+	}
+
+	n := &domain.PaymentNotification{
+		Gateway:       domain.GatewayTypeStripe,
+		NotifyID:      event.ID,
+		PaymentNo:     paymentNo,
+		TransactionID: intent.ID,
+		Amount:        intent.Amount,
+		Currency:      strings.ToUpper(intent.Currency),
+		MerchantID:    event.Account,
+		RawPayload:    string(req.Body),
+	}
+	switch event.Type {
+	case "payment_intent.succeeded":
+		n.Result = domain.NotifyResultSuccess
+		n.Amount = intent.AmountReceived
+	case "payment_intent.payment_failed", "payment_intent.canceled":
+		n.Result = domain.NotifyResultFailed
+	default:
+		n.Result = domain.NotifyResultPending
+	}
+	return n, nil
+}
+
+// verifySignature 校验 Stripe-Signature，任一 v1 签名匹配即通过。
+func (v *StripeWebhookVerifier) verifySignature(header string, body []byte) error {
+	var (
+		timestamp  string
+		signatures []string
+	)
+	for part := range strings.SplitSeq(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return fmt.Errorf("%w: stripe: missing timestamp or v1 signature", domain.ErrInvalidNotifySignature)
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: stripe: invalid timestamp", domain.ErrInvalidNotifySignature)
+	}
+	if d := v.now().Sub(time.Unix(ts, 0)); d > v.cfg.Tolerance || d < -v.cfg.Tolerance {
+		return fmt.Errorf("%w: stripe: timestamp outside tolerance", domain.ErrInvalidNotifySignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(v.cfg.WebhookSecret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	for _, sig := range signatures {
+		if decoded, err := hex.DecodeString(sig); err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: stripe: no matching v1 signature", domain.ErrInvalidNotifySignature)
+}
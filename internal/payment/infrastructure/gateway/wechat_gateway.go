@@ -1,68 +1,406 @@
 package gateway
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
 )
 
-type WechatGateway struct{}
+// wechatDefaultBaseURL 微信支付 APIv3 接口域名。
+const wechatDefaultBaseURL = "https://api.mch.weixin.qq.com"
 
-func NewWechatGateway() *WechatGateway { return &WechatGateway{} }
+// wechatLocation 微信支付账单日期与交易时间均为北京时间。
+var wechatLocation = time.FixedZone("CST", 8*3600)
 
+// WechatChannelConfig 微信支付渠道配置，对应 ChannelConfig.ConfigJSON。
+type WechatChannelConfig struct {
+	AppID         string   `json:"app_id"`
+	MchID         string   `json:"mch_id"`
+	SerialNo      string   `json:"serial_no"`   // 商户 API 证书序列号
+	PrivateKey    string   `json:"private_key"` // 商户 API 私钥，用于请求签名
+	APIv3Key      string   `json:"api_v3_key"`
+	PlatformCerts []string `json:"platform_certs"` // 平台证书，用于应答验签
+	NotifyURL     string   `json:"notify_url"`
+	BaseURL       string   `json:"base_url"` // 为空时使用正式环境域名
+	// ProfitSharingReceivers 商户 ID 到微信分账接收方商户号的映射，接收方须已在微信侧添加
+	ProfitSharingReceivers map[string]string `json:"profit_sharing_receivers"`
+}
+
+// WechatGateway 微信支付 APIv3 客户端 (Native 支付)。
+type WechatGateway struct {
+	cfg        WechatChannelConfig
+	privateKey *rsa.PrivateKey
+	platform   *wechatPlatformVerifier
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewWechatGateway 创建微信支付客户端。
+func NewWechatGateway(cfg WechatChannelConfig, httpClient *http.Client) (*WechatGateway, error) {
+	if cfg.AppID == "" || cfg.MchID == "" || cfg.SerialNo == "" {
+		return nil, errors.New("wechat: app_id, mch_id and serial_no are required")
+	}
+	privateKey, err := parseRSAPrivateKey(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("wechat: invalid private_key: %w", err)
+	}
+	if len(cfg.PlatformCerts) == 0 {
+		return nil, errors.New("wechat: platform_certs is required")
+	}
+	platform, err := newWechatPlatformVerifier(cfg.PlatformCerts, 0)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = wechatDefaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if httpClient == nil {
+		httpClient = NewHTTPClient()
+	}
+	return &WechatGateway{cfg: cfg, privateKey: privateKey, platform: platform, httpClient: httpClient, now: time.Now}, nil
+}
+
+// wechatAmount 金额对象，单位为分。
+type wechatAmount struct {
+	Total    int64  `json:"total"`
+	Currency string `json:"currency,omitempty"`
+}
+
+// PreAuth Native 下单 (POST /v3/pay/transactions/native)，返回二维码链接。
 func (g *WechatGateway) PreAuth(ctx context.Context, req *domain.PaymentGatewayRequest) (*domain.PaymentGatewayResponse, error) {
-	// 真实化执行：验证金额并模拟微信统一下单 (Transactions API)
-	if req.Amount <= 0 {
-		return nil, fmt.Errorf("wechat_gateway: invalid pre-auth amount")
+	description := req.Description
+	if description == "" {
+		description = req.OrderID
+	}
+	body := map[string]any{
+		"appid":        g.cfg.AppID,
+		"mchid":        g.cfg.MchID,
+		"description":  description,
+		"out_trade_no": req.OrderID,
+		"notify_url":   g.cfg.NotifyURL,
+		"amount":       wechatAmount{Total: req.Amount, Currency: req.Currency},
+	}
+	if req.ClientIP != "" {
+		body["scene_info"] = map[string]string{"payer_client_ip": req.ClientIP}
+	}
+	if req.ProfitSharing {
+		// 分账订单支付成功后资金冻结，待请求分账或解冻后才入账本方商户
+		body["settle_info"] = map[string]bool{"profit_sharing": true}
+	}
+	var resp struct {
+		CodeURL string `json:"code_url"`
 	}
+	raw, err := g.call(ctx, http.MethodPost, "/v3/pay/transactions/native", body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.PaymentGatewayResponse{PaymentURL: resp.CodeURL, RawResponse: string(raw)}, nil
+}
 
-	slog.InfoContext(ctx, "wechat pre-auth initiating", "order_id", req.OrderID, "amount", req.Amount)
+// QueryTrade 按商户订单号查询订单 (GET /v3/pay/transactions/out-trade-no/{out_trade_no})。
+func (g *WechatGateway) QueryTrade(ctx context.Context, trade *domain.GatewayTrade) (*domain.GatewayTradeResult, error) {
+	path := "/v3/pay/transactions/out-trade-no/" + url.PathEscape(trade.PaymentNo) + "?mchid=" + url.QueryEscape(g.cfg.MchID)
+	var resp struct {
+		TransactionID string `json:"transaction_id"`
+		TradeState    string `json:"trade_state"`
+		Amount        struct {
+			Total    int64  `json:"total"`
+			Currency string `json:"currency"`
+		} `json:"amount"`
+	}
+	raw, err := g.call(ctx, http.MethodGet, path, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	result := &domain.GatewayTradeResult{
+		TransactionID: resp.TransactionID,
+		Amount:        resp.Amount.Total,
+		Currency:      resp.Amount.Currency,
+		RawResponse:   string(raw),
+	}
+	switch resp.TradeState {
+	case "SUCCESS", "REFUND":
+		result.State = domain.GatewayTradeSuccess
+	case "CLOSED", "REVOKED", "PAYERROR":
+		result.State = domain.GatewayTradeClosed
+	default: // NOTPAY, USERPAYING
+		result.State = domain.GatewayTradePending
+	}
+	return result, nil
+}
 
-	return &domain.PaymentGatewayResponse{
-		TransactionID: fmt.Sprintf("WX_AUTH_%d", time.Now().UnixNano()),
-		PaymentURL:    "https://pay.weixin.qq.com/pay/auth?order=" + req.OrderID,
-	}, nil
+// Capture Native 支付无独立扣款步骤，查询订单确认已支付且金额一致。
+func (g *WechatGateway) Capture(ctx context.Context, trade *domain.GatewayTrade, amount int64) (*domain.PaymentGatewayResponse, error) {
+	result, err := g.QueryTrade(ctx, trade)
+	if err != nil {
+		return nil, err
+	}
+	if result.State != domain.GatewayTradeSuccess {
+		return nil, domain.NewGatewayError(domain.GatewayTypeWechat, domain.ErrGatewayRejected, "TRADE_NOT_PAID", "trade is not paid")
+	}
+	if result.Amount != amount {
+		return nil, domain.NewGatewayError(domain.GatewayTypeWechat, domain.ErrGatewayRejected, "AMOUNT_MISMATCH", fmt.Sprintf("paid %d, expected %d", result.Amount, amount))
+	}
+	return &domain.PaymentGatewayResponse{TransactionID: result.TransactionID, RawResponse: result.RawResponse}, nil
 }
 
-func (g *WechatGateway) Capture(ctx context.Context, transactionID string, amount int64) (*domain.PaymentGatewayResponse, error) {
-	// 真实化执行：模拟微信支付提交扣款 (Capture API)
-	slog.InfoContext(ctx, "wechat capture executing", "transaction_id", transactionID, "amount", amount)
+// Void 关闭订单 (POST /v3/pay/transactions/out-trade-no/{out_trade_no}/close)，成功应答无内容。
+func (g *WechatGateway) Void(ctx context.Context, trade *domain.GatewayTrade) error {
+	path := "/v3/pay/transactions/out-trade-no/" + url.PathEscape(trade.PaymentNo) + "/close"
+	_, err := g.call(ctx, http.MethodPost, path, map[string]string{"mchid": g.cfg.MchID}, nil)
+	return err
+}
 
-	return &domain.PaymentGatewayResponse{
-		TransactionID: transactionID,
-		RawResponse:   `{"return_code": "SUCCESS", "result_code": "SUCCESS"}`,
-	}, nil
+// wechatRefund 退款应答与查询应答的公共字段。
+type wechatRefund struct {
+	RefundID    string `json:"refund_id"`
+	OutRefundNo string `json:"out_refund_no"`
+	Status      string `json:"status"`
 }
 
-func (g *WechatGateway) Void(ctx context.Context, transactionID string) error {
+// Refund 申请退款 (POST /v3/refund/domestic/refunds)，out_refund_no 为本方退款单号，重复提交幂等。
+func (g *WechatGateway) Refund(ctx context.Context, req *domain.RefundGatewayRequest) (*domain.RefundGatewayResponse, error) {
+	body := map[string]any{
+		"out_trade_no":  req.Trade.PaymentNo,
+		"out_refund_no": req.RefundNo,
+		"amount": map[string]any{
+			"refund":   req.Amount,
+			"total":    req.Trade.Amount,
+			"currency": req.Trade.Currency,
+		},
+	}
+	if req.Trade.TransactionID != "" {
+		body["transaction_id"] = req.Trade.TransactionID
+	}
+	if req.Reason != "" {
+		body["reason"] = req.Reason
+	}
+	if g.cfg.NotifyURL != "" {
+		body["notify_url"] = g.cfg.NotifyURL
+	}
+	var resp wechatRefund
+	raw, err := g.call(ctx, http.MethodPost, "/v3/refund/domestic/refunds", body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.RefundGatewayResponse{GatewayRefundID: resp.RefundID, Status: wechatRefundStatus(resp.Status), RawResponse: string(raw)}, nil
+}
+
+// QueryRefund 查询单笔退款 (GET /v3/refund/domestic/refunds/{out_refund_no})。
+func (g *WechatGateway) QueryRefund(ctx context.Context, req *domain.RefundGatewayRequest) (*domain.RefundGatewayResponse, error) {
+	var resp wechatRefund
+	raw, err := g.call(ctx, http.MethodGet, "/v3/refund/domestic/refunds/"+url.PathEscape(req.RefundNo), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.RefundGatewayResponse{GatewayRefundID: resp.RefundID, Status: wechatRefundStatus(resp.Status), RawResponse: string(raw)}, nil
+}
+
+// DownloadBill 申请交易账单 (GET /v3/bill/tradebill) 并下载解析。
+// 账单下载请求同样需要签名，但应答为文件流不带签名，改以申请应答中的 SHA1 摘要校验完整性。
+func (g *WechatGateway) DownloadBill(ctx context.Context, date time.Time, fn func(page []*domain.GatewayBillItem) error) error {
+	path := "/v3/bill/tradebill?bill_date=" + date.In(wechatLocation).Format("2006-01-02") + "&bill_type=ALL"
+	var resp struct {
+		HashType    string `json:"hash_type"`
+		HashValue   string `json:"hash_value"`
+		DownloadURL string `json:"download_url"`
+	}
+	if _, err := g.call(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, resp.DownloadURL, nil)
+	if err != nil {
+		return err
+	}
+	if err := g.sign(httpReq, nil); err != nil {
+		return err
+	}
+	httpResp, body, err := doHTTP(g.httpClient, domain.GatewayTypeWechat, httpReq, maxBillBytes)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return wechatError(httpResp.StatusCode, body)
+	}
+	if strings.EqualFold(resp.HashType, "SHA1") {
+		sum := sha1.Sum(body)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), resp.HashValue) {
+			return domain.NewGatewayError(domain.GatewayTypeWechat, domain.ErrGatewayUnavailable, "BILL_HASH_MISMATCH", "bill content hash mismatch")
+		}
+	}
+
+	pager := &billPager{fn: fn}
+	if err := parseWechatBill(body, pager); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "wechat bill downloaded", "date", date.Format("2006-01-02"), "items", pager.total)
 	return nil
 }
 
-func (g *WechatGateway) Refund(ctx context.Context, transactionID string, amount int64) error {
-	// 真实化执行：模拟调用微信退款接口 (pay/refund)
-	if amount <= 0 {
-		return fmt.Errorf("wechat_gateway: invalid refund amount")
+// parseWechatBill 解析交易账单并分页回调。字段以逗号分隔且每个值带 ` 前缀，表头之后至“总交易单数”汇总行之前为明细。
+// 列：0 交易时间，5 微信订单号，6 商户订单号，9 交易状态，12 应结订单金额（元），15 商户退款单号，16 退款金额（元），
+// 22 手续费（元，保留 5 位小数）。
+func parseWechatBill(content []byte, pager *billPager) error {
+	header := true
+	for line := range strings.Lines(string(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")))) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if header {
+			header = false
+			continue
+		}
+		if !strings.HasPrefix(line, "`") {
+			break // 汇总区
+		}
+		cols := strings.Split(line, ",")
+		if len(cols) < 17 {
+			continue
+		}
+		for i := range cols {
+			cols[i] = strings.TrimPrefix(strings.TrimSpace(cols[i]), "`")
+		}
+
+		status, amountCol := domain.BillStatusSuccess, 12
+		if cols[9] == "REFUND" {
+			status, amountCol = domain.BillStatusRefund, 16
+		} else if cols[9] != "SUCCESS" {
+			continue
+		}
+		amount, err := parseSignedMinorUnits(cols[amountCol], 2)
+		if err != nil {
+			continue
+		}
+		paidAt, _ := time.ParseInLocation("2006-01-02 15:04:05", cols[0], wechatLocation)
+		item := &domain.GatewayBillItem{
+			TransactionID: cols[5],
+			PaymentNo:     cols[6],
+			Amount:        amount,
+			Status:        status,
+			PaidAt:        paidAt,
+		}
+		if status == domain.BillStatusRefund {
+			item.RefundNo = cols[15]
+		}
+		if len(cols) > 22 {
+			// 手续费精确到 0.00001 元，按分四舍五入
+			if fee, err := parseSignedMinorUnits(cols[22], 5); err == nil {
+				item.Fee = (fee + 500) / 1000
+			}
+		}
+		if err := pager.add(item); err != nil {
+			return err
+		}
+	}
+	return pager.flush()
+}
+
+// call 发送签名请求并以平台证书校验应答签名。out 为 nil 时忽略应答体。
+func (g *WechatGateway) call(ctx context.Context, method, path string, body, out any) ([]byte, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
 	}
-	slog.InfoContext(ctx, "wechat refund processing", "txn_id", transactionID, "amount", amount)
+	httpReq, err := http.NewRequestWithContext(ctx, method, g.cfg.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if err := g.sign(httpReq, payload); err != nil {
+		return nil, err
+	}
+
+	httpResp, respBody, err := doHTTP(g.httpClient, domain.GatewayTypeWechat, httpReq, maxResponseBytes)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode >= http.StatusMultipleChoices {
+		return respBody, wechatError(httpResp.StatusCode, respBody)
+	}
+	if err := g.platform.verify(httpResp.Header.Get, respBody); err != nil {
+		return nil, domain.NewGatewayError(domain.GatewayTypeWechat, domain.ErrGatewayMisconfigured, "INVALID_SIGN", err.Error())
+	}
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return nil, domain.NewGatewayError(domain.GatewayTypeWechat, domain.ErrGatewayUnavailable, "MALFORMED_RESPONSE", err.Error())
+		}
+	}
+	return respBody, nil
+}
+
+// sign 写入 Authorization 头，待签名串为 "{METHOD}\n{URL}\n{timestamp}\n{nonce}\n{body}\n"，URL 含查询参数。
+func (g *WechatGateway) sign(req *http.Request, body []byte) error {
+	timestamp := strconv.FormatInt(g.now().Unix(), 10)
+	nonce := randomNonce()
+	message := req.Method + "\n" + req.URL.RequestURI() + "\n" + timestamp + "\n" + nonce + "\n" + string(body) + "\n"
+	digest := sha256.Sum256([]byte(message))
+	sig, err := rsa.SignPKCS1v15(nil, g.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return fmt.Errorf("wechat: failed to sign request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf(
+		`WECHATPAY2-SHA256-RSA2048 mchid="%s",nonce_str="%s",signature="%s",timestamp="%s",serial_no="%s"`,
+		g.cfg.MchID, nonce, base64.StdEncoding.EncodeToString(sig), timestamp, g.cfg.SerialNo,
+	))
 	return nil
 }
 
-// DownloadBill 获取指定日期的微信支付对账单。
-func (g *WechatGateway) DownloadBill(ctx context.Context, date time.Time) ([]*domain.GatewayBillItem, error) {
-	// 真实化执行：模拟调用微信支付账单下载接口 (getbill)
-	slog.InfoContext(ctx, "downloading wechat bill", "date", date.Format("2006-01-02"))
+// wechatError 映射微信支付错误应答 {"code":"...","message":"..."}。
+// 系统繁忙、限流与银行系统异常可重试；签名、权限与商户号错误为配置问题；其余为业务拒绝。
+func wechatError(statusCode int, body []byte) error {
+	var resp struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	if resp.Code == "" {
+		resp.Code = strconv.Itoa(statusCode)
+		resp.Message = string(body)
+	}
+
+	kind := httpStatusKind(statusCode)
+	switch resp.Code {
+	case "SYSTEM_ERROR", "SYSTEMERROR", "FREQUENCY_LIMITED", "BANKERROR":
+		kind = domain.ErrGatewayUnavailable
+	case "SIGN_ERROR", "NO_AUTH", "APPID_MCHID_NOT_MATCH", "MCH_NOT_EXISTS", "INVALID_REQUEST_SIGN":
+		kind = domain.ErrGatewayMisconfigured
+	}
+	return domain.NewGatewayError(domain.GatewayTypeWechat, kind, resp.Code, resp.Message)
+}
 
-	items := []*domain.GatewayBillItem{
-		{
-			TransactionID: "WX-TXN-20001",
-			PaymentNo:     "PAY-20240101-W01",
-			Amount:        8800, // 88.00 CNY
-			Status:        "SUCCESS",
-			PaidAt:        date.Add(9 * time.Hour),
-		},
+// wechatRefundStatus 映射退款状态：SUCCESS 到账，PROCESSING 处理中，ABNORMAL 异常与 CLOSED 关闭均视为失败。
+func wechatRefundStatus(status string) domain.RefundGatewayStatus {
+	switch status {
+	case "SUCCESS":
+		return domain.RefundGatewaySuccess
+	case "ABNORMAL", "CLOSED":
+		return domain.RefundGatewayFailed
+	default:
+		return domain.RefundGatewayPending
 	}
-	return items, nil
 }
@@ -0,0 +1,283 @@
+package gateway
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// wechatTestServer 模拟微信支付 APIv3：校验请求签名，应答以平台证书私钥签名。
+type wechatTestServer struct {
+	t           *testing.T
+	merchant    *rsa.PublicKey
+	platformKey *rsa.PrivateKey
+	serial      string
+	handle      func(r *http.Request, body []byte) (status int, resp string)
+}
+
+func (s *wechatTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.verifyRequest(r, body)
+
+	status, resp := s.handle(r, body)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := "nonce-" + ts
+	digest := sha256.Sum256([]byte(ts + "\n" + nonce + "\n" + resp + "\n"))
+	sig, err := rsa.SignPKCS1v15(nil, s.platformKey, crypto.SHA256, digest[:])
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	w.Header().Set("Wechatpay-Serial", s.serial)
+	w.Header().Set("Wechatpay-Timestamp", ts)
+	w.Header().Set("Wechatpay-Nonce", nonce)
+	w.Header().Set("Wechatpay-Signature", base64.StdEncoding.EncodeToString(sig))
+	w.WriteHeader(status)
+	fmt.Fprint(w, resp)
+}
+
+// verifyRequest 按 WECHATPAY2-SHA256-RSA2048 规则校验商户请求签名。
+func (s *wechatTestServer) verifyRequest(r *http.Request, body []byte) {
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "WECHATPAY2-SHA256-RSA2048 ")
+	if !ok {
+		s.t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		return
+	}
+	fields := map[string]string{}
+	for _, kv := range strings.Split(auth, ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		fields[k] = strings.Trim(v, `"`)
+	}
+	if fields["mchid"] != "1900000001" || fields["serial_no"] != "MERCHANTSERIAL" {
+		s.t.Errorf("Authorization fields = %v", fields)
+	}
+	message := r.Method + "\n" + r.URL.RequestURI() + "\n" + fields["timestamp"] + "\n" + fields["nonce_str"] + "\n" + string(body) + "\n"
+	digest := sha256.Sum256([]byte(message))
+	sig, _ := base64.StdEncoding.DecodeString(fields["signature"])
+	if err := rsa.VerifyPKCS1v15(s.merchant, crypto.SHA256, digest[:], sig); err != nil {
+		s.t.Errorf("request signature invalid: %v", err)
+	}
+}
+
+// testPlatformCert 生成测试用平台证书与私钥。
+func testPlatformCert(t *testing.T, serial int64) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, _, _ := testRSAKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "Tenpay.com Root CA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// newWechatTestGateway 创建指向测试服务的微信支付客户端。
+func newWechatTestGateway(t *testing.T, handle func(r *http.Request, body []byte) (int, string)) (*WechatGateway, *wechatTestServer) {
+	t.Helper()
+	merchantKey, merchantPEM, _ := testRSAKey(t)
+	platformKey, certPEM := testPlatformCert(t, 0x5157F09EFDC096DE)
+	fake := &wechatTestServer{t: t, merchant: &merchantKey.PublicKey, platformKey: platformKey, serial: "5157F09EFDC096DE", handle: handle}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	g, err := NewWechatGateway(WechatChannelConfig{
+		AppID:         "wx8888888888888888",
+		MchID:         "1900000001",
+		SerialNo:      "MERCHANTSERIAL",
+		PrivateKey:    merchantPEM,
+		PlatformCerts: []string{certPEM},
+		NotifyURL:     "https://shop.example.com/notify/wechat",
+		BaseURL:       srv.URL,
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g, fake
+}
+
+func TestWechatPreAuth(t *testing.T) {
+	g, _ := newWechatTestGateway(t, func(r *http.Request, body []byte) (int, string) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v3/pay/transactions/native" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		var req map[string]any
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatal(err)
+		}
+		amount, _ := req["amount"].(map[string]any)
+		if req["out_trade_no"] != "PAY1" || req["mchid"] != "1900000001" || amount["total"] != float64(8800) {
+			t.Errorf("body = %s", body)
+		}
+		if _, ok := req["settle_info"]; !ok {
+			t.Errorf("profit sharing order must freeze funds: %s", body)
+		}
+		return http.StatusOK, `{"code_url":"weixin://wxpay/bizpayurl?pr=abc"}`
+	})
+	resp, err := g.PreAuth(context.Background(), &domain.PaymentGatewayRequest{OrderID: "PAY1", Amount: 8800, Currency: "CNY", ProfitSharing: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.PaymentURL != "weixin://wxpay/bizpayurl?pr=abc" {
+		t.Fatalf("response = %+v", resp)
+	}
+}
+
+func TestWechatQueryTrade(t *testing.T) {
+	tests := []struct {
+		tradeState string
+		wantState  domain.GatewayTradeState
+	}{
+		{"SUCCESS", domain.GatewayTradeSuccess},
+		{"REFUND", domain.GatewayTradeSuccess},
+		{"NOTPAY", domain.GatewayTradePending},
+		{"USERPAYING", domain.GatewayTradePending},
+		{"CLOSED", domain.GatewayTradeClosed},
+		{"PAYERROR", domain.GatewayTradeClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tradeState, func(t *testing.T) {
+			g, _ := newWechatTestGateway(t, func(r *http.Request, _ []byte) (int, string) {
+				if r.URL.Path != "/v3/pay/transactions/out-trade-no/PAY1" || r.URL.Query().Get("mchid") != "1900000001" {
+					t.Errorf("request = %s", r.URL)
+				}
+				return http.StatusOK, fmt.Sprintf(`{"transaction_id":"4200001","trade_state":%q,"amount":{"total":8800,"currency":"CNY"}}`, tt.tradeState)
+			})
+			result, err := g.QueryTrade(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.State != tt.wantState || result.Amount != 8800 || result.TransactionID != "4200001" {
+				t.Fatalf("result = %+v", result)
+			}
+		})
+	}
+}
+
+func TestWechatVoidAcceptsEmptyResponse(t *testing.T) {
+	g, _ := newWechatTestGateway(t, func(r *http.Request, _ []byte) (int, string) {
+		if r.URL.Path != "/v3/pay/transactions/out-trade-no/PAY1/close" {
+			t.Errorf("request = %s", r.URL)
+		}
+		return http.StatusNoContent, ""
+	})
+	if err := g.Void(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWechatErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantKind error
+		wantCode string
+	}{
+		{name: "no auth", status: http.StatusForbidden, body: `{"code":"NO_AUTH","message":"商户无权限"}`, wantKind: domain.ErrGatewayMisconfigured, wantCode: "NO_AUTH"},
+		{name: "param error", status: http.StatusBadRequest, body: `{"code":"PARAM_ERROR","message":"参数错误"}`, wantKind: domain.ErrGatewayRejected, wantCode: "PARAM_ERROR"},
+		{name: "order paid", status: http.StatusBadRequest, body: `{"code":"ORDERPAID","message":"订单已支付"}`, wantKind: domain.ErrGatewayRejected, wantCode: "ORDERPAID"},
+		{name: "system error", status: http.StatusInternalServerError, body: `{"code":"SYSTEM_ERROR","message":"系统错误"}`, wantKind: domain.ErrGatewayUnavailable, wantCode: "SYSTEM_ERROR"},
+		{name: "frequency limited", status: http.StatusTooManyRequests, body: `{"code":"FREQUENCY_LIMITED","message":"频率超限"}`, wantKind: domain.ErrGatewayUnavailable, wantCode: "FREQUENCY_LIMITED"},
+		{name: "bank error on 400", status: http.StatusBadRequest, body: `{"code":"BANKERROR","message":"银行系统异常"}`, wantKind: domain.ErrGatewayUnavailable, wantCode: "BANKERROR"},
+		{name: "sign error", status: http.StatusUnauthorized, body: `{"code":"SIGN_ERROR","message":"签名错误"}`, wantKind: domain.ErrGatewayMisconfigured, wantCode: "SIGN_ERROR"},
+		{name: "non json error", status: http.StatusBadGateway, body: `bad gateway`, wantKind: domain.ErrGatewayUnavailable, wantCode: "502"},
+		{name: "malformed success body", status: http.StatusOK, body: `{"refund_id":`, wantKind: domain.ErrGatewayUnavailable, wantCode: "MALFORMED_RESPONSE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, _ := newWechatTestGateway(t, func(*http.Request, []byte) (int, string) { return tt.status, tt.body })
+			_, err := g.Refund(context.Background(), &domain.RefundGatewayRequest{Trade: &domain.GatewayTrade{PaymentNo: "PAY1", Amount: 8800, Currency: "CNY"}, RefundNo: "REF1", Amount: 100})
+			assertGatewayError(t, err, tt.wantKind, tt.wantCode)
+		})
+	}
+}
+
+func TestWechatRejectsUnverifiedResponse(t *testing.T) {
+	g, fake := newWechatTestGateway(t, func(*http.Request, []byte) (int, string) {
+		return http.StatusOK, `{"transaction_id":"4200001","trade_state":"SUCCESS","amount":{"total":8800}}`
+	})
+
+	// 应答签名使用未登记的平台证书序列号
+	fake.serial = "DEADBEEF"
+	_, err := g.QueryTrade(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1"})
+	assertGatewayError(t, err, domain.ErrGatewayMisconfigured, "INVALID_SIGN")
+
+	// 序列号正确但签名私钥不匹配
+	fake.serial = "5157F09EFDC096DE"
+	fake.platformKey, _, _ = testRSAKey(t)
+	_, err = g.QueryTrade(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1"})
+	assertGatewayError(t, err, domain.ErrGatewayMisconfigured, "INVALID_SIGN")
+}
+
+func TestWechatRefund(t *testing.T) {
+	tests := []struct {
+		status string
+		want   domain.RefundGatewayStatus
+	}{
+		{"SUCCESS", domain.RefundGatewaySuccess},
+		{"PROCESSING", domain.RefundGatewayPending},
+		{"ABNORMAL", domain.RefundGatewayFailed},
+		{"CLOSED", domain.RefundGatewayFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			g, _ := newWechatTestGateway(t, func(r *http.Request, body []byte) (int, string) {
+				var req struct {
+					OutRefundNo string `json:"out_refund_no"`
+					Amount      struct {
+						Refund int64 `json:"refund"`
+						Total  int64 `json:"total"`
+					} `json:"amount"`
+				}
+				if err := json.Unmarshal(body, &req); err != nil {
+					t.Fatal(err)
+				}
+				if r.URL.Path != "/v3/refund/domestic/refunds" || req.OutRefundNo != "REF1" || req.Amount.Refund != 100 || req.Amount.Total != 8800 {
+					t.Errorf("request = %s %s", r.URL.Path, body)
+				}
+				return http.StatusOK, fmt.Sprintf(`{"refund_id":"5030001","out_refund_no":"REF1","status":%q}`, tt.status)
+			})
+			resp, err := g.Refund(context.Background(), &domain.RefundGatewayRequest{Trade: &domain.GatewayTrade{PaymentNo: "PAY1", Amount: 8800, Currency: "CNY"}, RefundNo: "REF1", Amount: 100})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.GatewayRefundID != "5030001" || resp.Status != tt.want {
+				t.Fatalf("response = %+v", resp)
+			}
+		})
+	}
+}
+
+func TestWechatTimeout(t *testing.T) {
+	_, merchantPEM, _ := testRSAKey(t)
+	_, certPEM := testPlatformCert(t, 1)
+	srv, client := slowServer(t)
+	g, err := NewWechatGateway(WechatChannelConfig{AppID: "wx1", MchID: "1900000001", SerialNo: "S", PrivateKey: merchantPEM, PlatformCerts: []string{certPEM}, BaseURL: srv.URL}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = g.QueryTrade(context.Background(), &domain.GatewayTrade{PaymentNo: "PAY1"})
+	assertGatewayError(t, err, domain.ErrGatewayUnavailable, "NETWORK_ERROR")
+}
@@ -0,0 +1,231 @@
+package gateway
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// WechatNotifyVerifier 微信支付 APIv3 回调通知验签器。
+// 先以平台证书校验应答签名，再以 APIv3 密钥 AES-256-GCM 解密通知资源。
+type WechatNotifyVerifier struct {
+	cfg      WechatConfig
+	aead     cipher.AEAD
+	platform *wechatPlatformVerifier
+}
+
+// NewWechatNotifyVerifier 创建微信支付通知验签器。
+func NewWechatNotifyVerifier(cfg WechatConfig) (*WechatNotifyVerifier, error) {
+	aead, err := newWechatAEAD(cfg.APIv3Key)
+	if err != nil {
+		return nil, err
+	}
+	platform, err := newWechatPlatformVerifier(cfg.PlatformCerts, cfg.Tolerance)
+	if err != nil {
+		return nil, err
+	}
+	return &WechatNotifyVerifier{cfg: cfg, aead: aead, platform: platform}, nil
+}
+
+// newWechatAEAD 以 APIv3 密钥创建 AES-256-GCM 解密器。
+func newWechatAEAD(apiV3Key string) (cipher.AEAD, error) {
+	if len(apiV3Key) != 32 {
+		return nil, errors.New("wechat: api_v3_key must be 32 bytes")
+	}
+	block, err := aes.NewCipher([]byte(apiV3Key))
+	if err != nil {
+		return nil, fmt.Errorf("wechat: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("wechat: %w", err)
+	}
+	return aead, nil
+}
+
+// wechatPlatformVerifier 以微信支付平台证书校验通知与 API 应答的签名。
+type wechatPlatformVerifier struct {
+	certs     map[string]*x509.Certificate // 平台证书序列号 (大写十六进制) -> 证书
+	tolerance time.Duration
+	now       func() time.Time
+}
+
+// newWechatPlatformVerifier 解析平台证书。
+func newWechatPlatformVerifier(certPEMs []string, tolerance time.Duration) (*wechatPlatformVerifier, error) {
+	certs := make(map[string]*x509.Certificate, len(certPEMs))
+	for _, certPEM := range certPEMs {
+		block, _ := pem.Decode([]byte(certPEM))
+		if block == nil || block.Type != "CERTIFICATE" {
+			return nil, errors.New("wechat: platform certificate must be PEM encoded")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("wechat: invalid platform certificate: %w", err)
+		}
+		if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+			return nil, errors.New("wechat: platform certificate does not contain an RSA public key")
+		}
+		certs[wechatSerial(cert.SerialNumber)] = cert
+	}
+	if tolerance <= 0 {
+		tolerance = defaultNotifyTolerance
+	}
+	return &wechatPlatformVerifier{certs: certs, tolerance: tolerance, now: time.Now}, nil
+}
+
+// verify 校验 Wechatpay-* 签名头，待签名串为 "{Wechatpay-Timestamp}\n{Wechatpay-Nonce}\n{Body}\n"。
+func (v *wechatPlatformVerifier) verify(header func(string) string, body []byte) error {
+	serial := strings.ToUpper(header("Wechatpay-Serial"))
+	timestamp := header("Wechatpay-Timestamp")
+	nonce := header("Wechatpay-Nonce")
+	signature := header("Wechatpay-Signature")
+	if serial == "" || timestamp == "" || nonce == "" || signature == "" {
+		return fmt.Errorf("%w: wechat: missing Wechatpay signature headers", domain.ErrInvalidNotifySignature)
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: wechat: invalid timestamp", domain.ErrInvalidNotifySignature)
+	}
+	now := v.now()
+	if d := now.Sub(time.Unix(ts, 0)); d > v.tolerance || d < -v.tolerance {
+		return fmt.Errorf("%w: wechat: timestamp outside tolerance", domain.ErrInvalidNotifySignature)
+	}
+
+	cert, ok := v.certs[serial]
+	if !ok {
+		return fmt.Errorf("%w: wechat: unknown platform certificate %s", domain.ErrInvalidNotifySignature, serial)
+	}
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("%w: wechat: platform certificate %s expired", domain.ErrInvalidNotifySignature, serial)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: wechat: malformed signature", domain.ErrInvalidNotifySignature)
+	}
+	message := timestamp + "\n" + nonce + "\n" + string(body) + "\n"
+	digest := sha256.Sum256([]byte(message))
+	if err := rsa.VerifyPKCS1v15(cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], sig); err != nil {
+		return fmt.Errorf("%w: wechat: %v", domain.ErrInvalidNotifySignature, err)
+	}
+	return nil
+}
+
+func (v *WechatNotifyVerifier) Gateway() domain.GatewayType { return domain.GatewayTypeWechat }
+
+// wechatNotifyEnvelope 通知外层报文。
+type wechatNotifyEnvelope struct {
+	ID           string `json:"id"`
+	EventType    string `json:"event_type"`
+	ResourceType string `json:"resource_type"`
+	Resource     struct {
+		Algorithm      string `json:"algorithm"`
+		Ciphertext     string `json:"ciphertext"`
+		AssociatedData string `json:"associated_data"`
+		Nonce          string `json:"nonce"`
+		OriginalType   string `json:"original_type"`
+	} `json:"resource"`
+}
+
+// wechatTransaction 解密后的支付交易资源。
+type wechatTransaction struct {
+	AppID         string `json:"appid"`
+	MchID         string `json:"mchid"`
+	OutTradeNo    string `json:"out_trade_no"`
+	TransactionID string `json:"transaction_id"`
+	TradeState    string `json:"trade_state"`
+	Amount        struct {
+		Total    int64  `json:"total"`
+		Currency string `json:"currency"`
+	} `json:"amount"`
+}
+
+// Verify 校验通知签名、时间戳与商户身份，解密并解析交易结果。
+func (v *WechatNotifyVerifier) Verify(ctx context.Context, req *domain.NotifyRequest) (*domain.PaymentNotification, error) {
+	if err := v.platform.verify(req.Header, req.Body); err != nil {
+		return nil, err
+	}
+
+	var envelope wechatNotifyEnvelope
+	if err := json.Unmarshal(req.Body, &envelope); err != nil {
+		return nil, fmt.Errorf("wechat: malformed notification body: %w", err)
+	}
+	if envelope.Resource.Algorithm != "AEAD_AES_256_GCM" {
+		return nil, fmt.Errorf("wechat: unsupported resource algorithm %q", envelope.Resource.Algorithm)
+	}
+	plaintext, err := wechatDecrypt(v.aead, envelope.Resource.Nonce, envelope.Resource.AssociatedData, envelope.Resource.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("%w: wechat: failed to decrypt resource: %v", domain.ErrInvalidNotifySignature, err)
+	}
+
+	var txn wechatTransaction
+	if err := json.Unmarshal(plaintext, &txn); err != nil {
+		return nil, fmt.Errorf("wechat: malformed transaction resource: %w", err)
+	}
+	if txn.MchID != v.cfg.MchID {
+		return nil, fmt.Errorf("%w: wechat: mchid %s", domain.ErrNotifyMerchantMismatch, txn.MchID)
+	}
+	if v.cfg.AppID != "" && txn.AppID != v.cfg.AppID {
+		return nil, fmt.Errorf("%w: wechat: appid %s", domain.ErrNotifyMerchantMismatch, txn.AppID)
+	}
+
+	currency := txn.Amount.Currency
+	if currency == "" {
+		currency = "CNY"
+	}
+	return &domain.PaymentNotification{
+		Gateway:       domain.GatewayTypeWechat,
+		NotifyID:      envelope.ID,
+		PaymentNo:     txn.OutTradeNo,
+		TransactionID: txn.TransactionID,
+		Result:        wechatTradeResult(txn.TradeState),
+		Amount:        txn.Amount.Total,
+		Currency:      strings.ToUpper(currency),
+		MerchantID:    txn.MchID,
+		RawPayload:    string(plaintext),
+	}, nil
+}
+
+// wechatDecrypt 以 APIv3 密钥解密通知资源。
+func wechatDecrypt(aead cipher.AEAD, nonce, associatedData, ciphertext string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(nonce))
+	}
+	return aead.Open(nil, []byte(nonce), data, []byte(associatedData))
+}
+
+// wechatSerial 将证书序列号格式化为 Wechatpay-Serial 使用的大写十六进制。
+func wechatSerial(serial *big.Int) string {
+	return strings.ToUpper(serial.Text(16))
+}
+
+// wechatTradeResult 将微信支付交易状态映射为通知结果。
+func wechatTradeResult(tradeState string) domain.NotifyResult {
+	switch tradeState {
+	case "SUCCESS":
+		return domain.NotifyResultSuccess
+	case "CLOSED", "REVOKED", "PAYERROR":
+		return domain.NotifyResultFailed
+	default: // NOTPAY, USERPAYING, REFUND
+		return domain.NotifyResultPending
+	}
+}
@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// wechatNotFound 微信支付单据不存在的错误码。
+const wechatNotFound = "RESOURCE_NOT_EXISTS"
+
+// ProfitSharingAccount 返回商户在微信侧登记的分账接收方商户号。
+// 微信分账回退仅支持商户类接收方，推广者等个人接收方不走渠道分账。
+func (g *WechatGateway) ProfitSharingAccount(recipientType string, recipientID uint64) (string, bool) {
+	if recipientType != domain.SplitRecipientMerchant {
+		return "", false
+	}
+	account, ok := g.cfg.ProfitSharingReceivers[strconv.FormatUint(recipientID, 10)]
+	return account, ok && account != ""
+}
+
+// wechatProfitSharingOrder 分账单应答与查询应答的公共字段。
+type wechatProfitSharingOrder struct {
+	OrderID   string `json:"order_id"`
+	State     string `json:"state"` // PROCESSING, FINISHED
+	Receivers []struct {
+		Account    string `json:"account"`
+		Result     string `json:"result"` // PENDING, SUCCESS, CLOSED
+		FailReason string `json:"fail_reason"`
+	} `json:"receivers"`
+}
+
+// ShareProfit 请求分账 (POST /v3/profitsharing/orders)，剩余资金同时解冻给本方商户。
+// 先按本方分账单号查询，已受理的分账单直接返回最新结果，避免重复提交。
+func (g *WechatGateway) ShareProfit(ctx context.Context, req *domain.ProfitSharingRequest) (*domain.ProfitSharingResponse, error) {
+	var resp wechatProfitSharingOrder
+	path := "/v3/profitsharing/orders/" + url.PathEscape(req.OrderNo) + "?transaction_id=" + url.QueryEscape(req.Trade.TransactionID)
+	raw, err := g.call(ctx, http.MethodGet, path, nil, &resp)
+	if isWechatNotFound(err) {
+		receivers := make([]map[string]any, 0, len(req.Receivers))
+		for _, r := range req.Receivers {
+			receivers = append(receivers, map[string]any{
+				"type":        "MERCHANT_ID",
+				"account":     r.Account,
+				"amount":      r.Amount,
+				"description": r.Description,
+			})
+		}
+		body := map[string]any{
+			"appid":            g.cfg.AppID,
+			"transaction_id":   req.Trade.TransactionID,
+			"out_order_no":     req.OrderNo,
+			"receivers":        receivers,
+			"unfreeze_unsplit": true,
+		}
+		raw, err = g.call(ctx, http.MethodPost, "/v3/profitsharing/orders", body, &resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &domain.ProfitSharingResponse{
+		GatewayOrderID: resp.OrderID,
+		Status:         domain.ProfitSharingPending,
+		Receivers:      make(map[string]domain.ProfitSharingStatus, len(resp.Receivers)),
+		RawResponse:    string(raw),
+	}
+	if resp.State == "FINISHED" {
+		result.Status = domain.ProfitSharingSuccess
+	}
+	for _, r := range resp.Receivers {
+		switch r.Result {
+		case "SUCCESS":
+			result.Receivers[r.Account] = domain.ProfitSharingSuccess
+		case "CLOSED":
+			result.Receivers[r.Account] = domain.ProfitSharingFailed
+		default:
+			result.Receivers[r.Account] = domain.ProfitSharingPending
+		}
+	}
+	return result, nil
+}
+
+// ReturnProfit 请求分账回退 (POST /v3/profitsharing/return-orders)，从接收方商户退回已分账资金。
+// 先按本方回退单号查询，已受理的回退单直接返回最新结果。
+func (g *WechatGateway) ReturnProfit(ctx context.Context, req *domain.ProfitReturnRequest) (*domain.ProfitReturnResponse, error) {
+	var resp struct {
+		ReturnID   string `json:"return_id"`
+		Result     string `json:"result"` // PROCESSING, SUCCESS, FAILED
+		FailReason string `json:"fail_reason"`
+	}
+	path := "/v3/profitsharing/return-orders/" + url.PathEscape(req.ReturnNo) + "?out_order_no=" + url.QueryEscape(req.OrderNo)
+	raw, err := g.call(ctx, http.MethodGet, path, nil, &resp)
+	if isWechatNotFound(err) {
+		body := map[string]any{
+			"out_order_no":  req.OrderNo,
+			"out_return_no": req.ReturnNo,
+			"return_mchid":  req.Account,
+			"amount":        req.Amount,
+			"description":   req.Description,
+		}
+		raw, err = g.call(ctx, http.MethodPost, "/v3/profitsharing/return-orders", body, &resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &domain.ProfitReturnResponse{GatewayReturnID: resp.ReturnID, Status: domain.ProfitSharingPending, RawResponse: string(raw)}
+	switch resp.Result {
+	case "SUCCESS":
+		result.Status = domain.ProfitSharingSuccess
+	case "FAILED":
+		result.Status = domain.ProfitSharingFailed
+	}
+	return result, nil
+}
+
+// isWechatNotFound 判断是否为单据不存在错误。
+func isWechatNotFound(err error) bool {
+	var gwErr *domain.GatewayError
+	return errors.As(err, &gwErr) && gwErr.Code == wechatNotFound
+}
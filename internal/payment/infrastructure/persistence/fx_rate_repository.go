@@ -0,0 +1,51 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/databases/sharding"
+	"gorm.io/gorm"
+)
+
+// fxRateRepository 牌价仓储实现，牌价为全局数据，存储在第一个分片。
+type fxRateRepository struct {
+	sharding *sharding.Manager
+}
+
+// NewFXRateRepository 创建牌价仓储。
+func NewFXRateRepository(sharding *sharding.Manager) domain.FXRateRepository {
+	return &fxRateRepository{sharding: sharding}
+}
+
+func (r *fxRateRepository) getDB(ctx context.Context) *gorm.DB {
+	return r.sharding.GetDB(0).WithContext(ctx)
+}
+
+// FindRate 查询货币对牌价，不存在时返回 nil。
+func (r *fxRateRepository) FindRate(ctx context.Context, baseCurrency, quoteCurrency string) (*domain.FXRate, error) {
+	var rate domain.FXRate
+	err := r.getDB(ctx).Where("base_currency = ? AND quote_currency = ?", baseCurrency, quoteCurrency).First(&rate).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// SaveRate 保存牌价。
+func (r *fxRateRepository) SaveRate(ctx context.Context, rate *domain.FXRate) error {
+	return r.getDB(ctx).Save(rate).Error
+}
+
+// ListRates 列出全部牌价。
+func (r *fxRateRepository) ListRates(ctx context.Context) ([]*domain.FXRate, error) {
+	var rates []*domain.FXRate
+	if err := r.getDB(ctx).Order("base_currency, quote_currency").Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
@@ -37,7 +37,7 @@ func (r *paymentRepository) Save(ctx context.Context, entity *domain.Payment) er
 func (r *paymentRepository) FindByID(ctx context.Context, userID uint64, id uint64) (*domain.Payment, error) {
 	db := r.getDB(userID)
 	var entity domain.Payment
-	if err := db.WithContext(ctx).Preload("Logs").First(&entity, id).Error; err != nil {
+	if err := db.WithContext(ctx).Preload("Logs").Preload("Legs").Preload("Splits").First(&entity, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -70,7 +70,7 @@ func (r *paymentRepository) Delete(ctx context.Context, userID uint64, id uint64
 func (r *paymentRepository) FindByPaymentNo(ctx context.Context, userID uint64, paymentNo string) (*domain.Payment, error) {
 	db := r.getDB(userID)
 	var entity domain.Payment
-	if err := db.WithContext(ctx).Where("payment_no = ?", paymentNo).First(&entity).Error; err != nil {
+	if err := db.WithContext(ctx).Preload("Legs").Preload("Splits").Where("payment_no = ?", paymentNo).First(&entity).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -83,7 +83,7 @@ func (r *paymentRepository) FindByPaymentNo(ctx context.Context, userID uint64,
 func (r *paymentRepository) FindByOrderID(ctx context.Context, userID uint64, orderID uint64) (*domain.Payment, error) {
 	db := r.getDB(userID)
 	var entity domain.Payment
-	if err := db.WithContext(ctx).Where("order_id = ?", orderID).First(&entity).Error; err != nil {
+	if err := db.WithContext(ctx).Preload("Legs").Preload("Splits").Where("order_id = ?", orderID).First(&entity).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -112,6 +112,20 @@ func (r *paymentRepository) SaveLog(ctx context.Context, log *domain.PaymentLog)
 	return db.WithContext(ctx).Create(log).Error
 }
 
+// SaveLegs 保存支付腿状态变更。
+func (r *paymentRepository) SaveLegs(ctx context.Context, legs []*domain.PaymentLeg) error {
+	if len(legs) == 0 {
+		return nil
+	}
+	db := r.getDB(legs[0].UserID)
+	for _, leg := range legs {
+		if err := db.WithContext(ctx).Save(leg).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // FindLogsByPaymentID 根据支付ID从数据库获取所有支付日志。
 func (r *paymentRepository) FindLogsByPaymentID(ctx context.Context, userID uint64, paymentID uint64) ([]*domain.PaymentLog, error) {
 	db := r.getDB(userID)
@@ -122,25 +136,70 @@ func (r *paymentRepository) FindLogsByPaymentID(ctx context.Context, userID uint
 	return logs, nil
 }
 
-// FindSuccessPaymentsByDate 跨分片聚合指定日期的成功支付记录。
-func (r *paymentRepository) FindSuccessPaymentsByDate(ctx context.Context, date time.Time) ([]*domain.Payment, error) {
-	dbs := r.sharding.GetAllDBs()
-	var allPayments []*domain.Payment
-	start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
-	end := start.Add(24 * time.Hour)
-	for _, db := range dbs {
+// FindByPaymentNos 跨分片按支付单号批量查询。
+func (r *paymentRepository) FindByPaymentNos(ctx context.Context, paymentNos []string) ([]*domain.Payment, error) {
+	if len(paymentNos) == 0 {
+		return nil, nil
+	}
+	var payments []*domain.Payment
+	for _, db := range r.sharding.GetAllDBs() {
 		var list []*domain.Payment
-		err := db.WithContext(ctx).Where("status = ? AND paid_at >= ? AND paid_at < ?", domain.PaymentSuccess, start, end).Find(&list).Error
-		if err != nil { return nil, err }
-		allPayments = append(allPayments, list...)
+		if err := db.WithContext(ctx).Preload("Legs").Where("payment_no IN ?", paymentNos).Find(&list).Error; err != nil {
+			return nil, err
+		}
+		payments = append(payments, list...)
 	}
-	return allPayments, nil
+	return payments, nil
 }
 
-// SaveReconciliationRecord 保存对账结果。
-func (r *paymentRepository) SaveReconciliationRecord(ctx context.Context, record *domain.ReconciliationRecord) error {
-	db := r.sharding.GetDB(0)
-	return db.WithContext(ctx).Save(record).Error
+// FindPaidByChannel 跨分片查询渠道在 [start, end) 内完成支付的支付单，含之后发生退款的支付单。
+func (r *paymentRepository) FindPaidByChannel(ctx context.Context, channelCode string, start, end time.Time) ([]*domain.Payment, error) {
+	paid := []domain.PaymentStatus{domain.PaymentSuccess, domain.PaymentRefunding, domain.PaymentRefunded, domain.PaymentReconciled, domain.PaymentReconcileError}
+	var payments []*domain.Payment
+	for _, db := range r.sharding.GetAllDBs() {
+		var list []*domain.Payment
+		err := db.WithContext(ctx).Preload("Legs").
+			Where("channel_code = ? AND status IN ? AND paid_at >= ? AND paid_at < ?", channelCode, paid, start, end).
+			Find(&list).Error
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, list...)
+	}
+	return payments, nil
+}
+
+// FindDueForQuery 跨分片查询到期需主动查询渠道的待支付记录，按查询时间先后返回。
+func (r *paymentRepository) FindDueForQuery(ctx context.Context, now time.Time, limit int) ([]*domain.Payment, error) {
+	var due []*domain.Payment
+	for _, db := range r.sharding.GetAllDBs() {
+		var list []*domain.Payment
+		err := db.WithContext(ctx).Preload("Legs").
+			Where("status IN ? AND next_query_at IS NOT NULL AND next_query_at <= ?", []domain.PaymentStatus{domain.PaymentPending, domain.PaymentAuthorized}, now).
+			Order("next_query_at").Limit(limit).Find(&list).Error
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, list...)
+	}
+	return due, nil
+}
+
+// ClaimQuery 以查询时间做 CAS 推进查询计划，多实例同时扫描时同一支付单只会被一个实例查询。
+func (r *paymentRepository) ClaimQuery(ctx context.Context, payment *domain.Payment, next time.Time) (bool, error) {
+	db := r.getDB(payment.UserID)
+	result := db.WithContext(ctx).Model(&domain.Payment{}).
+		Where("id = ? AND status IN ? AND next_query_at = ?", payment.ID, []domain.PaymentStatus{domain.PaymentPending, domain.PaymentAuthorized}, payment.NextQueryAt).
+		Updates(map[string]any{"next_query_at": next, "query_attempts": gorm.Expr("query_attempts + 1")})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	payment.NextQueryAt = &next
+	payment.QueryAttempts++
+	return true, nil
 }
 
 // GetUserIDByPaymentNo 跨分片查找用户ID。
@@ -0,0 +1,119 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/databases/sharding"
+	"gorm.io/gorm"
+)
+
+// profitSharingRepository 分账仓储实现，分账与分账回退随支付单按用户分片。
+type profitSharingRepository struct {
+	sharding *sharding.Manager
+	tx       *gorm.DB
+}
+
+// NewProfitSharingRepository 创建分账仓储。
+func NewProfitSharingRepository(sharding *sharding.Manager) domain.ProfitSharingRepository {
+	return &profitSharingRepository{sharding: sharding}
+}
+
+func (r *profitSharingRepository) getDB(userID uint64) *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.sharding.GetDB(userID)
+}
+
+// SaveSplits 保存分账指令。分账作为支付单的关联记录，支付单更新时不会同步已有分账的变更，需显式保存。
+func (r *profitSharingRepository) SaveSplits(ctx context.Context, userID uint64, splits []*domain.PaymentSplit) error {
+	db := r.getDB(userID)
+	for _, split := range splits {
+		if err := db.WithContext(ctx).Save(split).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveReversals 保存分账回退记录。
+func (r *profitSharingRepository) SaveReversals(ctx context.Context, userID uint64, reversals []*domain.SplitReversal) error {
+	db := r.getDB(userID)
+	for _, reversal := range reversals {
+		if err := db.WithContext(ctx).Save(reversal).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindDueSplits 跨分片查询到期待渠道执行的分账，按执行时间先后返回。
+func (r *profitSharingRepository) FindDueSplits(ctx context.Context, now time.Time, limit int) ([]*domain.PaymentSplit, error) {
+	var due []*domain.PaymentSplit
+	for _, db := range r.sharding.GetAllDBs() {
+		var list []*domain.PaymentSplit
+		err := db.WithContext(ctx).
+			Where("mode = ? AND status = ? AND next_attempt_at IS NOT NULL AND next_attempt_at <= ?", domain.SplitModeGateway, domain.SplitPending, now).
+			Order("next_attempt_at").Limit(limit).Find(&list).Error
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, list...)
+	}
+	return due, nil
+}
+
+// FindDueReversals 跨分片查询到期待渠道回退的分账回退，按执行时间先后返回。
+func (r *profitSharingRepository) FindDueReversals(ctx context.Context, now time.Time, limit int) ([]*domain.SplitReversal, error) {
+	var due []*domain.SplitReversal
+	for _, db := range r.sharding.GetAllDBs() {
+		var list []*domain.SplitReversal
+		err := db.WithContext(ctx).
+			Where("mode = ? AND status = ? AND next_attempt_at IS NOT NULL AND next_attempt_at <= ?", domain.SplitModeGateway, domain.SplitPending, now).
+			Order("next_attempt_at").Limit(limit).Find(&list).Error
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, list...)
+	}
+	return due, nil
+}
+
+// ClaimSplit 以下次执行时间做 CAS 推进执行计划。
+func (r *profitSharingRepository) ClaimSplit(ctx context.Context, split *domain.PaymentSplit, next time.Time) (bool, error) {
+	result := r.getDB(split.UserID).WithContext(ctx).Model(&domain.PaymentSplit{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", split.ID, domain.SplitPending, split.NextAttemptAt).
+		Update("next_attempt_at", next)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	split.NextAttemptAt = &next
+	return true, nil
+}
+
+// ClaimReversal 以下次执行时间做 CAS 推进执行计划。
+func (r *profitSharingRepository) ClaimReversal(ctx context.Context, reversal *domain.SplitReversal, next time.Time) (bool, error) {
+	result := r.getDB(reversal.UserID).WithContext(ctx).Model(&domain.SplitReversal{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", reversal.ID, domain.SplitPending, reversal.NextAttemptAt).
+		Update("next_attempt_at", next)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	reversal.NextAttemptAt = &next
+	return true, nil
+}
+
+func (r *profitSharingRepository) WithTx(tx any) domain.ProfitSharingRepository {
+	return &profitSharingRepository{
+		sharding: r.sharding,
+		tx:       tx.(*gorm.DB),
+	}
+}
@@ -0,0 +1,110 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/databases/sharding"
+	"gorm.io/gorm"
+)
+
+// reconciliationRepository 对账仓储实现，批次与差异为跨用户的全局数据，存储在第一个分片。
+type reconciliationRepository struct {
+	sharding *sharding.Manager
+}
+
+// NewReconciliationRepository 创建对账仓储。
+func NewReconciliationRepository(sharding *sharding.Manager) domain.ReconciliationRepository {
+	return &reconciliationRepository{sharding: sharding}
+}
+
+func (r *reconciliationRepository) getDB(ctx context.Context) *gorm.DB {
+	return r.sharding.GetDB(0).WithContext(ctx)
+}
+
+// SaveRun 保存对账批次。
+func (r *reconciliationRepository) SaveRun(ctx context.Context, run *domain.ReconciliationRun) error {
+	return r.getDB(ctx).Save(run).Error
+}
+
+// ListRuns 按账单日查询批次，同一渠道的重跑批次按创建先后排列。
+func (r *reconciliationRepository) ListRuns(ctx context.Context, billDate, channelCode string) ([]*domain.ReconciliationRun, error) {
+	db := r.getDB(ctx).Where("bill_date = ?", billDate)
+	if channelCode != "" {
+		db = db.Where("channel_code = ?", channelCode)
+	}
+	var runs []*domain.ReconciliationRun
+	if err := db.Order("channel_code, id").Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// FindBySubjectKeys 查询差异对象的最近一条差异记录。
+func (r *reconciliationRepository) FindBySubjectKeys(ctx context.Context, channelCode string, subjectKeys []string) (map[string]*domain.ReconciliationRecord, error) {
+	result := make(map[string]*domain.ReconciliationRecord)
+	if len(subjectKeys) == 0 {
+		return result, nil
+	}
+	var records []*domain.ReconciliationRecord
+	err := r.getDB(ctx).
+		Where("channel_code = ? AND subject_key IN ?", channelCode, subjectKeys).
+		Order("id").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		result[record.SubjectKey] = record
+	}
+	return result, nil
+}
+
+// FindBreakByID 查询差异及其备注。
+func (r *reconciliationRepository) FindBreakByID(ctx context.Context, id uint64) (*domain.ReconciliationRecord, error) {
+	var record domain.ReconciliationRecord
+	if err := r.getDB(ctx).Preload("Notes").First(&record, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// SaveBreak 保存差异，备注通过 SaveNote 单独追加。
+func (r *reconciliationRepository) SaveBreak(ctx context.Context, record *domain.ReconciliationRecord) error {
+	return r.getDB(ctx).Omit("Notes").Save(record).Error
+}
+
+// ListBreaks 分页查询差异，按发现先后倒序。
+func (r *reconciliationRepository) ListBreaks(ctx context.Context, filter *domain.BreakFilter, offset, limit int) ([]*domain.ReconciliationRecord, int64, error) {
+	db := r.getDB(ctx).Model(&domain.ReconciliationRecord{})
+	if filter.BillDate != "" {
+		db = db.Where("bill_date = ?", filter.BillDate)
+	}
+	if filter.ChannelCode != "" {
+		db = db.Where("channel_code = ?", filter.ChannelCode)
+	}
+	if filter.BreakStatus != "" {
+		db = db.Where("break_status = ?", filter.BreakStatus)
+	}
+	if filter.Assignee != "" {
+		db = db.Where("assignee = ?", filter.Assignee)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var records []*domain.ReconciliationRecord
+	if err := db.Order("id DESC").Offset(offset).Limit(limit).Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// SaveNote 追加差异处理备注。
+func (r *reconciliationRepository) SaveNote(ctx context.Context, note *domain.ReconciliationNote) error {
+	return r.getDB(ctx).Create(note).Error
+}
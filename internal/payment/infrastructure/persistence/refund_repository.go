@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/payment/domain"
 	"github.com/wyfcoding/pkg/databases/sharding"
@@ -32,7 +33,7 @@ func (r *refundRepository) Save(ctx context.Context, refund *domain.Refund) erro
 func (r *refundRepository) FindByID(ctx context.Context, userID uint64, id uint64) (*domain.Refund, error) {
 	db := r.sharding.GetDB(userID)
 	var refund domain.Refund
-	if err := db.WithContext(ctx).First(&refund, id).Error; err != nil {
+	if err := db.WithContext(ctx).Preload("Allocations").First(&refund, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -49,7 +50,7 @@ func (r *refundRepository) FindByRefundNo(ctx context.Context, userID uint64, re
 		db = r.sharding.GetDB(userID)
 	}
 	var refund domain.Refund
-	if err := db.WithContext(ctx).Where("refund_no = ?", refundNo).First(&refund).Error; err != nil {
+	if err := db.WithContext(ctx).Preload("Allocations").Where("refund_no = ?", refundNo).First(&refund).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -68,6 +69,22 @@ func (r *refundRepository) Update(ctx context.Context, refund *domain.Refund) er
 	return db.WithContext(ctx).Save(refund).Error
 }
 
+// SaveAllocations 保存退款分摊状态变更。
+func (r *refundRepository) SaveAllocations(ctx context.Context, userID uint64, allocations []*domain.RefundAllocation) error {
+	var db *gorm.DB
+	if r.tx != nil {
+		db = r.tx
+	} else {
+		db = r.sharding.GetDB(userID)
+	}
+	for _, a := range allocations {
+		if err := db.WithContext(ctx).Save(a).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *refundRepository) Delete(ctx context.Context, userID uint64, id uint64) error {
 	var db *gorm.DB
 	if r.tx != nil {
@@ -91,3 +108,36 @@ func (r *refundRepository) WithTx(tx any) domain.RefundRepository {
 		tx:       tx.(*gorm.DB),
 	}
 }
+
+// FindByRefundNos 跨分片按退款单号批量查询。
+func (r *refundRepository) FindByRefundNos(ctx context.Context, refundNos []string) ([]*domain.Refund, error) {
+	if len(refundNos) == 0 {
+		return nil, nil
+	}
+	var refunds []*domain.Refund
+	for _, db := range r.sharding.GetAllDBs() {
+		var list []*domain.Refund
+		if err := db.WithContext(ctx).Preload("Allocations").Where("refund_no IN ?", refundNos).Find(&list).Error; err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, list...)
+	}
+	return refunds, nil
+}
+
+// FindRefundedByChannel 跨分片查询渠道在 [start, end) 内退款成功的退款单。退款单与原支付单同分片，按支付单关联受理渠道。
+func (r *refundRepository) FindRefundedByChannel(ctx context.Context, channelCode string, start, end time.Time) ([]*domain.Refund, error) {
+	var refunds []*domain.Refund
+	for _, db := range r.sharding.GetAllDBs() {
+		var list []*domain.Refund
+		err := db.WithContext(ctx).Preload("Allocations").
+			Joins("JOIN payments ON payments.id = refunds.payment_id").
+			Where("payments.channel_code = ? AND refunds.status = ? AND refunds.refunded_at >= ? AND refunds.refunded_at < ?", channelCode, domain.PaymentRefunded, start, end).
+			Find(&list).Error
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, list...)
+	}
+	return refunds, nil
+}
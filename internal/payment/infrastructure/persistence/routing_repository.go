@@ -0,0 +1,88 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/databases/sharding"
+	"gorm.io/gorm"
+)
+
+// routingRepository 路由规则与决策日志仓储实现，均为全局数据，存储在第一个分片。
+type routingRepository struct {
+	sharding *sharding.Manager
+}
+
+// NewRoutingRepository 创建路由仓储。
+func NewRoutingRepository(sharding *sharding.Manager) domain.RoutingRepository {
+	return &routingRepository{sharding: sharding}
+}
+
+func (r *routingRepository) getDB(ctx context.Context) *gorm.DB {
+	return r.sharding.GetDB(0).WithContext(ctx)
+}
+
+// ListPolicies 列出全部路由规则。
+func (r *routingRepository) ListPolicies(ctx context.Context) ([]*domain.RoutingPolicy, error) {
+	var policies []*domain.RoutingPolicy
+	if err := r.getDB(ctx).Order("priority DESC, id").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// FindPolicy 查询路由规则，不存在时返回 nil。
+func (r *routingRepository) FindPolicy(ctx context.Context, id uint64) (*domain.RoutingPolicy, error) {
+	var policy domain.RoutingPolicy
+	if err := r.getDB(ctx).First(&policy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SavePolicy 保存路由规则。
+func (r *routingRepository) SavePolicy(ctx context.Context, policy *domain.RoutingPolicy) error {
+	return r.getDB(ctx).Save(policy).Error
+}
+
+// SaveDecision 保存路由决策日志。
+func (r *routingRepository) SaveDecision(ctx context.Context, decision *domain.RouteDecision) error {
+	return r.getDB(ctx).Create(decision).Error
+}
+
+// ListDecisions 分页查询路由决策日志。
+func (r *routingRepository) ListDecisions(ctx context.Context, filter *domain.RouteDecisionFilter, offset, limit int) ([]*domain.RouteDecision, int64, error) {
+	db := r.getDB(ctx).Model(&domain.RouteDecision{})
+	if filter.OrderID != 0 {
+		db = db.Where("order_id = ?", filter.OrderID)
+	}
+	if filter.MerchantID != 0 {
+		db = db.Where("merchant_id = ?", filter.MerchantID)
+	}
+	if filter.ChannelCode != "" {
+		db = db.Where("channel_code = ?", filter.ChannelCode)
+	}
+	if filter.Strategy != "" {
+		db = db.Where("strategy = ?", filter.Strategy)
+	}
+	if filter.Variant != "" {
+		db = db.Where("variant = ?", filter.Variant)
+	}
+	if filter.Since != nil {
+		db = db.Where("created_at >= ?", *filter.Since)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var decisions []*domain.RouteDecision
+	if err := db.Order("id DESC").Offset(offset).Limit(limit).Find(&decisions).Error; err != nil {
+		return nil, 0, err
+	}
+	return decisions, total, nil
+}
@@ -0,0 +1,79 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/databases/sharding"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// storedValueRepository 储值账户仓储实现，账户与流水随用户分片，与支付单同库。
+type storedValueRepository struct {
+	sharding *sharding.Manager
+	tx       *gorm.DB
+}
+
+// NewStoredValueRepository 创建储值账户仓储。
+func NewStoredValueRepository(sharding *sharding.Manager) domain.StoredValueRepository {
+	return &storedValueRepository{sharding: sharding}
+}
+
+func (r *storedValueRepository) getDB(userID uint64) *gorm.DB {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.sharding.GetDB(userID)
+}
+
+// FindAccount 查询储值账户，事务内加行锁防止并发冻结超额；不存在时返回 nil。
+func (r *storedValueRepository) FindAccount(ctx context.Context, userID uint64, source domain.LegSource, currency string) (*domain.StoredValueAccount, error) {
+	db := r.getDB(userID).WithContext(ctx)
+	if r.tx != nil {
+		db = db.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	var account domain.StoredValueAccount
+	err := db.Where("user_id = ? AND source = ? AND currency = ?", userID, source, currency).First(&account).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+// ListAccounts 列出用户的全部储值账户。
+func (r *storedValueRepository) ListAccounts(ctx context.Context, userID uint64) ([]*domain.StoredValueAccount, error) {
+	var accounts []*domain.StoredValueAccount
+	if err := r.getDB(userID).WithContext(ctx).Where("user_id = ?", userID).Order("source, currency").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// SaveAccount 保存储值账户。
+func (r *storedValueRepository) SaveAccount(ctx context.Context, account *domain.StoredValueAccount) error {
+	return r.getDB(account.UserID).WithContext(ctx).Save(account).Error
+}
+
+// SaveEntry 写入储值流水。
+func (r *storedValueRepository) SaveEntry(ctx context.Context, entry *domain.StoredValueEntry) error {
+	return r.getDB(entry.UserID).WithContext(ctx).Create(entry).Error
+}
+
+func (r *storedValueRepository) Transaction(ctx context.Context, userID uint64, fn func(tx any) error) error {
+	db := r.sharding.GetDB(userID)
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(tx)
+	})
+}
+
+func (r *storedValueRepository) WithTx(tx any) domain.StoredValueRepository {
+	return &storedValueRepository{
+		sharding: r.sharding,
+		tx:       tx.(*gorm.DB),
+	}
+}
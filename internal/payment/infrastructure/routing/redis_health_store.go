@@ -0,0 +1,190 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+)
+
+// latencyBounds 延迟直方图的桶上界，分位数取所在桶的上界，超过最后一个上界的样本计入溢出桶。
+var latencyBounds = []time.Duration{
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+	250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2500 * time.Millisecond,
+	5 * time.Second, 10 * time.Second, 30 * time.Second,
+}
+
+// redisHealthStore 基于 Redis 的渠道健康度存储。
+// 滑动窗口按固定时长分桶，每个桶是一个 Hash，记录各结果计数与延迟直方图，桶在窗口过期后自动删除；
+// 查询时汇总窗口内全部桶，多副本写入同一组桶，因此共享同一份统计。
+type redisHealthStore struct {
+	client *redis.Client
+	window time.Duration
+	bucket time.Duration
+}
+
+// NewRedisHealthStore 创建渠道健康度存储，window 为滑动窗口时长，bucket 为分桶粒度。
+func NewRedisHealthStore(client *redis.Client, window, bucket time.Duration) domain.ChannelHealthStore {
+	if bucket <= 0 {
+		bucket = 10 * time.Second
+	}
+	if window < bucket {
+		window = bucket
+	}
+	return &redisHealthStore{client: client, window: window, bucket: bucket}
+}
+
+func (s *redisHealthStore) bucketKey(code string, start int64) string {
+	return fmt.Sprintf("payment:channel:health:%s:%d", code, start)
+}
+
+func (s *redisHealthStore) breakerKey(code string) string {
+	return fmt.Sprintf("payment:channel:breaker:%s", code)
+}
+
+func (s *redisHealthStore) probeKey(code string) string {
+	return fmt.Sprintf("payment:channel:probe:%s", code)
+}
+
+// bucketStarts 返回覆盖窗口的各桶起始时间 (秒)。
+func (s *redisHealthStore) bucketStarts(now time.Time) []int64 {
+	size := int64(s.bucket / time.Second)
+	if size <= 0 {
+		size = 1
+	}
+	current := now.Unix() / size * size
+	n := int64(s.window / s.bucket)
+	starts := make([]int64, 0, n)
+	for i := int64(0); i < n; i++ {
+		starts = append(starts, current-i*size)
+	}
+	return starts
+}
+
+func latencyField(latency time.Duration) string {
+	for i, bound := range latencyBounds {
+		if latency <= bound {
+			return "lat:" + strconv.Itoa(i)
+		}
+	}
+	return "lat:" + strconv.Itoa(len(latencyBounds))
+}
+
+// Record 记录一次渠道调用结果与耗时，业务拒绝只计数不计入延迟分布。
+func (s *redisHealthStore) Record(ctx context.Context, channelCode string, outcome domain.ChannelOutcome, latency time.Duration, at time.Time) error {
+	key := s.bucketKey(channelCode, s.bucketStarts(at)[0])
+	pipe := s.client.TxPipeline()
+	pipe.HIncrBy(ctx, key, string(outcome), 1)
+	if outcome != domain.ChannelOutcomeReject {
+		pipe.HIncrBy(ctx, key, latencyField(latency), 1)
+	}
+	pipe.Expire(ctx, key, s.window+s.bucket)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Health 批量查询渠道当前窗口的健康度与熔断器状态，单次 Pipeline 完成。
+func (s *redisHealthStore) Health(ctx context.Context, channelCodes []string, now time.Time) (map[string]*domain.ChannelHealth, error) {
+	starts := s.bucketStarts(now)
+	pipe := s.client.Pipeline()
+	buckets := make(map[string][]*redis.MapStringStringCmd, len(channelCodes))
+	breakers := make(map[string]*redis.StringCmd, len(channelCodes))
+	for _, code := range channelCodes {
+		for _, start := range starts {
+			buckets[code] = append(buckets[code], pipe.HGetAll(ctx, s.bucketKey(code, start)))
+		}
+		breakers[code] = pipe.Get(ctx, s.breakerKey(code))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	result := make(map[string]*domain.ChannelHealth, len(channelCodes))
+	for _, code := range channelCodes {
+		h := &domain.ChannelHealth{ChannelCode: code, Window: s.window}
+		histogram := make([]int64, len(latencyBounds)+1)
+		for _, cmd := range buckets[code] {
+			for field, value := range cmd.Val() {
+				n, _ := strconv.ParseInt(value, 10, 64)
+				switch field {
+				case string(domain.ChannelOutcomeSuccess):
+					h.Success += n
+				case string(domain.ChannelOutcomeFailure):
+					h.Failure += n
+				case string(domain.ChannelOutcomeReject):
+					h.Reject += n
+				default:
+					if idx, err := strconv.Atoi(field[len("lat:"):]); err == nil && idx < len(histogram) {
+						histogram[idx] += n
+					}
+				}
+			}
+		}
+		h.LatencyP50 = percentile(histogram, 0.50)
+		h.LatencyP95 = percentile(histogram, 0.95)
+		h.LatencyP99 = percentile(histogram, 0.99)
+
+		if raw, err := breakers[code].Bytes(); err == nil {
+			if err := json.Unmarshal(raw, &h.Breaker); err != nil {
+				return nil, fmt.Errorf("failed to decode breaker of channel %s: %w", code, err)
+			}
+		}
+		if h.Breaker.State == "" {
+			h.Breaker.State = domain.BreakerClosed
+		}
+		result[code] = h
+	}
+	return result, nil
+}
+
+// percentile 按直方图计算分位数，取所在桶的上界；溢出桶取最后一个上界。
+func percentile(histogram []int64, q float64) time.Duration {
+	var total int64
+	for _, n := range histogram {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := int64(q*float64(total) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range histogram {
+		seen += n
+		if seen >= rank {
+			return latencyBounds[min(i, len(latencyBounds)-1)]
+		}
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+// SaveBreaker 保存熔断器状态并释放探测名额，resetWindow 为 true 时同时删除窗口内的统计桶。
+func (s *redisHealthStore) SaveBreaker(ctx context.Context, channelCode string, status domain.BreakerStatus, resetWindow bool) error {
+	raw, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, s.breakerKey(channelCode), raw, 0)
+	keys := []string{s.probeKey(channelCode)}
+	if resetWindow {
+		for _, start := range s.bucketStarts(time.Now()) {
+			keys = append(keys, s.bucketKey(channelCode, start))
+		}
+	}
+	pipe.Del(ctx, keys...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// TryProbe 为半开渠道抢占探测名额。
+func (s *redisHealthStore) TryProbe(ctx context.Context, channelCode string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, s.probeKey(channelCode), time.Now().Unix(), ttl).Result()
+}
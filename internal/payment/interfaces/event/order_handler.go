@@ -0,0 +1,56 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/wyfcoding/ecommerce/internal/payment/application"
+)
+
+// TopicOrderRefundRequired 订单已取消或关闭后支付成功，需原路退款。
+const TopicOrderRefundRequired = "order.refund_required"
+
+// RefundRequiredEvent order.refund_required 事件载荷。
+type RefundRequiredEvent struct {
+	PaymentNo string `json:"payment_no"`
+	OrderID   uint64 `json:"order_id"`
+	OrderNo   string `json:"order_no"`
+	UserID    uint64 `json:"user_id"`
+	Amount    int64  `json:"amount"`
+	Reason    string `json:"reason"`
+}
+
+// OrderHandler 消费订单服务的退款补偿事件。
+type OrderHandler struct {
+	app    *application.PaymentService
+	logger *slog.Logger
+}
+
+// NewOrderHandler 构造函数。
+func NewOrderHandler(app *application.PaymentService, logger *slog.Logger) *OrderHandler {
+	return &OrderHandler{
+		app:    app,
+		logger: logger,
+	}
+}
+
+// Handle 对已关闭订单的支付发起全额退款。载荷非法的消息重试无法解决，记录后跳过；退款失败返回错误由消费端重试。
+func (h *OrderHandler) Handle(ctx context.Context, msg kafka.Message) error {
+	var event RefundRequiredEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		h.logger.ErrorContext(ctx, "failed to unmarshal refund required event", "key", string(msg.Key), "error", err)
+		return nil
+	}
+	if event.PaymentNo == "" || event.UserID == 0 {
+		h.logger.ErrorContext(ctx, "refund required event missing payment_no or user_id", "order_no", event.OrderNo)
+		return nil
+	}
+
+	if err := h.app.RefundClosedOrder(ctx, event.UserID, event.PaymentNo, "order closed before payment: "+event.Reason); err != nil {
+		h.logger.ErrorContext(ctx, "failed to refund closed order payment", "order_no", event.OrderNo, "payment_no", event.PaymentNo, "error", err)
+		return err
+	}
+	return nil
+}
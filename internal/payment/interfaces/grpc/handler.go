@@ -2,7 +2,9 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"net/url"
 	"time"
 
 	"github.com/dtm-labs/client/dtmgrpc"
@@ -30,60 +32,85 @@ func NewServer(app *application.PaymentService) *Server {
 // InitiatePayment 处理发起支付的 gRPC 请求。
 func (s *Server) InitiatePayment(ctx context.Context, req *pb.InitiatePaymentRequest) (*pb.PaymentResponse, error) {
 	start := time.Now()
-	slog.Info("gRPC InitiatePayment received", "order_id", req.OrderId, "user_id", req.UserId, "amount", req.Amount, "method", req.PaymentMethod)
-
-	payment, gatewayResp, err := s.App.InitiatePayment(ctx, req.OrderId, req.UserId, req.Amount, req.PaymentMethod)
+	slog.Info("gRPC InitiatePayment received", "order_id", req.OrderId, "user_id", req.UserId, "amount", req.Amount, "currency", req.Currency, "method", req.PaymentMethod, "legs", len(req.Legs))
+
+	var (
+		payment     *domain.Payment
+		gatewayResp *domain.PaymentGatewayResponse
+		err         error
+	)
+	shares := make([]domain.MerchantShare, 0, len(req.MerchantShares))
+	for _, share := range req.MerchantShares {
+		shares = append(shares, domain.MerchantShare{MerchantID: share.MerchantId, Amount: share.Amount, PromoterID: share.PromoterId})
+	}
+	if len(req.Legs) > 0 {
+		legs := make([]domain.LegRequest, 0, len(req.Legs))
+		for _, leg := range req.Legs {
+			legs = append(legs, domain.LegRequest{Source: domain.LegSource(leg.Source), PaymentMethod: leg.PaymentMethod, Amount: leg.Amount})
+		}
+		payment, gatewayResp, err = s.App.InitiateCompositePayment(ctx, req.OrderId, req.UserId, req.Amount, req.Currency, legs, shares)
+	} else {
+		payment, gatewayResp, err = s.App.InitiatePayment(ctx, req.OrderId, req.UserId, req.Amount, req.Currency, req.PaymentMethod, shares)
+	}
 	if err != nil {
 		slog.Error("gRPC InitiatePayment failed", "order_id", req.OrderId, "user_id", req.UserId, "error", err, "duration", time.Since(start))
+		switch {
+		case errors.Is(err, domain.ErrUnsupportedCurrency), errors.Is(err, domain.ErrNoChannelForCurrency), errors.Is(err, domain.ErrInvalidLegs), errors.Is(err, domain.ErrInvalidSplitBasis):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, domain.ErrInsufficientBalance):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, domain.ErrFXRateUnavailable), errors.Is(err, domain.ErrNoHealthyChannel):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
 		return nil, err
 	}
 
 	slog.Info("gRPC InitiatePayment successful", "order_id", req.OrderId, "payment_no", payment.PaymentNo, "duration", time.Since(start))
 	return &pb.PaymentResponse{
-		PaymentUrl:    gatewayResp.PaymentURL,
-		PrepayId:      gatewayResp.TransactionID,
-		TransactionNo: payment.PaymentNo,
+		PaymentUrl:         gatewayResp.PaymentURL,
+		PrepayId:           gatewayResp.TransactionID,
+		TransactionNo:      payment.PaymentNo,
+		Currency:           payment.Currency,
+		SettlementCurrency: payment.SettlementCurrency,
+		FxRate:             payment.FX.Rate.String(),
+		SettlementAmount:   payment.SettlementAmount,
+		GatewayAmount:      payment.GatewayAmount(),
 	}, nil
 }
 
-// HandlePaymentCallback 处理支付结果异步回调
+// HandlePaymentCallback 处理支付结果异步回调 (由网关层转发渠道原始通知)
 func (s *Server) HandlePaymentCallback(ctx context.Context, req *pb.HandlePaymentCallbackRequest) (*emptypb.Empty, error) {
 	start := time.Now()
 	slog.Info("gRPC HandlePaymentCallback received", "method", req.PaymentMethod)
 
-	// 1. 提取核心参数 (由于各渠道参数名不同，此处演示一种通用提取方式)
-	// 实际开发中，应根据 req.PaymentMethod 选择对应的解析器 (Extractor)
-	paymentNo := req.CallbackData["out_trade_no"]
-	if paymentNo == "" {
-		paymentNo = req.CallbackData["payment_no"]
-	}
-	transactionID := req.CallbackData["trade_no"]
-	if transactionID == "" {
-		transactionID = req.CallbackData["transaction_id"]
-	}
-	statusVal := req.CallbackData["trade_status"]
-	success := (statusVal == "TRADE_SUCCESS" || statusVal == "SUCCESS")
-
-	if paymentNo == "" {
-		slog.Error("gRPC HandlePaymentCallback failed: missing payment_no", "data", req.CallbackData)
-		return nil, status.Error(codes.InvalidArgument, "missing out_trade_no in callback data")
-	}
-
-	// 2. 根据支付号反查用户 ID (用于分片路由)
-	userID, err := s.App.GetUserIDByPaymentNo(ctx, paymentNo)
-	if err != nil {
-		slog.Error("gRPC HandlePaymentCallback failed: user not found", "payment_no", paymentNo, "error", err)
-		return nil, status.Error(codes.NotFound, "payment record not found")
+	body := req.Body
+	if len(body) == 0 && len(req.CallbackData) > 0 {
+		// 表单类通知以参数映射转发时，按表单编码还原请求体后验签
+		form := url.Values{}
+		for k, v := range req.CallbackData {
+			form.Set(k, v)
+		}
+		body = []byte(form.Encode())
 	}
 
-	// 3. 调用应用层处理状态流转
-	err = s.App.HandlePaymentCallback(ctx, userID, paymentNo, success, transactionID, "", req.CallbackData)
+	n, err := s.App.HandleNotification(ctx, domain.GatewayType(req.PaymentMethod), &domain.NotifyRequest{
+		Headers: req.Headers,
+		Body:    body,
+	})
 	if err != nil {
-		slog.Error("gRPC HandlePaymentCallback application error", "payment_no", paymentNo, "error", err, "duration", time.Since(start))
+		slog.Error("gRPC HandlePaymentCallback failed", "method", req.PaymentMethod, "error", err, "duration", time.Since(start))
+		switch {
+		case errors.Is(err, domain.ErrUnsupportedNotifyGateway):
+			return nil, status.Error(codes.Unimplemented, err.Error())
+		case errors.Is(err, domain.ErrInvalidNotifySignature), errors.Is(err, domain.ErrNotifyMerchantMismatch):
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		case errors.Is(err, domain.ErrNotifyAmountMismatch), n == nil:
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	slog.Info("gRPC HandlePaymentCallback processed successfully", "payment_no", paymentNo, "duration", time.Since(start))
+	slog.Info("gRPC HandlePaymentCallback processed successfully", "payment_no", n.PaymentNo, "duration", time.Since(start))
 	return &emptypb.Empty{}, nil
 }
 
@@ -111,6 +138,9 @@ func (s *Server) RequestRefund(ctx context.Context, req *pb.RequestRefundRequest
 	refund, err := s.App.RequestRefund(ctx, req.UserId, req.PaymentTransactionId, req.RefundAmount, req.Reason)
 	if err != nil {
 		slog.Error("gRPC RequestRefund failed", "id", req.PaymentTransactionId, "user_id", req.UserId, "error", err, "duration", time.Since(start))
+		if errors.Is(err, domain.ErrRefundExceedsLegs) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, err
 	}
 
@@ -0,0 +1,38 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/payment/application"
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/jobexecutor"
+	"github.com/wyfcoding/pkg/idempotency"
+)
+
+// NewJobExecutor 创建对账作业执行器，承接调度中心的每日对账作业。
+// 每次执行核对计划触发时间在账单时区内前一自然日的渠道对账单。
+// 所有渠道均未生成批次时作业失败，由调度中心按作业的重试策略重新调用；
+// 部分渠道失败时作业视为完成，失败原因记录在对应批次中，由运营人员通过对账接口重跑。
+func NewJobExecutor(app *application.PaymentService, idem idempotency.Manager) *jobexecutor.Server {
+	return jobexecutor.NewServer(idem, func(ctx context.Context, scheduled time.Time) (string, error) {
+		billDate := app.PreviousBillDate(scheduled)
+		runs, err := app.RunReconciliation(ctx, billDate)
+		if err != nil && len(runs) == 0 {
+			return "", fmt.Errorf("reconciliation for %s failed: %w", billDate, err)
+		}
+		if err != nil {
+			slog.Warn("reconciliation finished with channel errors", "bill_date", billDate, "error", err)
+		}
+
+		failed := 0
+		for _, run := range runs {
+			if run.Status == domain.ReconcileRunFailed {
+				failed++
+			}
+		}
+		return fmt.Sprintf("reconciled %d channels for %s, %d failed", len(runs), billDate, failed), nil
+	})
+}
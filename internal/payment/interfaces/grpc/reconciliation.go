@@ -0,0 +1,195 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	pb "github.com/wyfcoding/ecommerce/goapi/payment/v1"
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// RunReconciliation 对指定账单日执行对账。部分渠道失败时仍返回汇总，失败原因记录在对应批次中。
+func (s *Server) RunReconciliation(ctx context.Context, req *pb.RunReconciliationRequest) (*pb.ReconciliationReport, error) {
+	runs, err := s.App.RunReconciliation(ctx, req.BillDate)
+	if err != nil {
+		slog.Error("gRPC RunReconciliation finished with errors", "bill_date", req.BillDate, "runs", len(runs), "error", err)
+		if len(runs) == 0 {
+			return nil, reconciliationError(err)
+		}
+	}
+	return convertReportToProto(req.BillDate, runs), nil
+}
+
+// GetReconciliationReport 查询账单日的对账汇总报告。
+func (s *Server) GetReconciliationReport(ctx context.Context, req *pb.GetReconciliationReportRequest) (*pb.ReconciliationReport, error) {
+	runs, err := s.App.ListReconciliationRuns(ctx, req.BillDate, req.ChannelCode)
+	if err != nil {
+		return nil, reconciliationError(err)
+	}
+	return convertReportToProto(req.BillDate, runs), nil
+}
+
+// ListReconciliationBreaks 分页列出对账差异。
+func (s *Server) ListReconciliationBreaks(ctx context.Context, req *pb.ListReconciliationBreaksRequest) (*pb.ListReconciliationBreaksResponse, error) {
+	filter := &domain.BreakFilter{
+		BillDate:    req.BillDate,
+		ChannelCode: req.ChannelCode,
+		BreakStatus: domain.BreakStatus(req.BreakStatus),
+		Assignee:    req.Assignee,
+	}
+	records, total, err := s.App.ListReconciliationBreaks(ctx, filter, int(req.Page), int(req.PageSize))
+	if err != nil {
+		return nil, reconciliationError(err)
+	}
+	breaks := make([]*pb.ReconciliationBreak, 0, len(records))
+	for _, r := range records {
+		breaks = append(breaks, convertBreakToProto(r))
+	}
+	return &pb.ListReconciliationBreaksResponse{Breaks: breaks, Total: total, Page: req.Page, PageSize: req.PageSize}, nil
+}
+
+// GetReconciliationBreak 查询对账差异详情。
+func (s *Server) GetReconciliationBreak(ctx context.Context, req *pb.GetReconciliationBreakRequest) (*pb.ReconciliationBreak, error) {
+	record, err := s.App.GetReconciliationBreak(ctx, req.Id)
+	if err != nil {
+		return nil, reconciliationError(err)
+	}
+	return convertBreakToProto(record), nil
+}
+
+// AssignReconciliationBreak 指派差异处理人。
+func (s *Server) AssignReconciliationBreak(ctx context.Context, req *pb.AssignReconciliationBreakRequest) (*pb.ReconciliationBreak, error) {
+	if req.Assignee == "" || req.Operator == "" {
+		return nil, status.Error(codes.InvalidArgument, "assignee and operator are required")
+	}
+	record, err := s.App.AssignReconciliationBreak(ctx, req.Id, req.Assignee, req.Operator)
+	if err != nil {
+		return nil, reconciliationError(err)
+	}
+	return convertBreakToProto(record), nil
+}
+
+// AnnotateReconciliationBreak 追加差异处理备注。
+func (s *Server) AnnotateReconciliationBreak(ctx context.Context, req *pb.AnnotateReconciliationBreakRequest) (*pb.ReconciliationBreakNote, error) {
+	if req.Author == "" || req.Content == "" || len(req.Content) > 1000 {
+		return nil, status.Error(codes.InvalidArgument, "author and content (at most 1000 bytes) are required")
+	}
+	note, err := s.App.AnnotateReconciliationBreak(ctx, req.Id, req.Author, req.Content)
+	if err != nil {
+		return nil, reconciliationError(err)
+	}
+	return convertNoteToProto(note), nil
+}
+
+// CloseReconciliationBreak 关闭差异。
+func (s *Server) CloseReconciliationBreak(ctx context.Context, req *pb.CloseReconciliationBreakRequest) (*pb.ReconciliationBreak, error) {
+	if req.Operator == "" || req.Resolution == "" || len(req.Resolution) > 255 {
+		return nil, status.Error(codes.InvalidArgument, "operator and resolution (at most 255 bytes) are required")
+	}
+	record, err := s.App.CloseReconciliationBreak(ctx, req.Id, req.Operator, req.Resolution)
+	if err != nil {
+		return nil, reconciliationError(err)
+	}
+	return convertBreakToProto(record), nil
+}
+
+// reconciliationError 将对账领域错误映射为 gRPC 状态码。
+func reconciliationError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidBillDate):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, domain.ErrBreakNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, domain.ErrBreakClosed):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// 辅助函数：将对账批次转换为汇总报告。
+func convertReportToProto(billDate string, runs []*domain.ReconciliationRun) *pb.ReconciliationReport {
+	report := &pb.ReconciliationReport{BillDate: billDate, Runs: make([]*pb.ReconciliationRun, 0, len(runs))}
+	for _, r := range runs {
+		var finishedAt *timestamppb.Timestamp
+		if r.FinishedAt != nil {
+			finishedAt = timestamppb.New(*r.FinishedAt)
+		}
+		report.Runs = append(report.Runs, &pb.ReconciliationRun{
+			RunNo:               r.RunNo,
+			BillDate:            r.BillDate,
+			ChannelCode:         r.ChannelCode,
+			ChannelType:         string(r.ChannelType),
+			Status:              string(r.Status),
+			BillItems:           r.BillItems,
+			PaymentCount:        r.PaymentCount,
+			PaymentAmount:       r.PaymentAmount,
+			RefundCount:         r.RefundCount,
+			RefundAmount:        r.RefundAmount,
+			FeeAmount:           r.FeeAmount,
+			MatchedCount:        r.MatchedCount,
+			AutoResolvedCount:   r.AutoResolvedCount,
+			BreakCount:          r.BreakCount,
+			MissingSystemCount:  r.MissingSystemCount,
+			MissingChannelCount: r.MissingChannelCount,
+			DiffAmount:          r.DiffAmount,
+			Error:               r.Error,
+			StartedAt:           timestamppb.New(r.StartedAt),
+			FinishedAt:          finishedAt,
+		})
+	}
+	return report
+}
+
+// 辅助函数：将对账差异转换为 Proto 消息对象。
+func convertBreakToProto(r *domain.ReconciliationRecord) *pb.ReconciliationBreak {
+	var resolvedAt *timestamppb.Timestamp
+	if r.ResolvedAt != nil {
+		resolvedAt = timestamppb.New(*r.ResolvedAt)
+	}
+	notes := make([]*pb.ReconciliationBreakNote, 0, len(r.Notes))
+	for _, n := range r.Notes {
+		notes = append(notes, convertNoteToProto(n))
+	}
+	return &pb.ReconciliationBreak{
+		Id:            uint64(r.ID),
+		RunNo:         r.RunNo,
+		BillDate:      r.BillDate,
+		ChannelCode:   r.ChannelCode,
+		Subject:       string(r.Subject),
+		PaymentNo:     r.PaymentNo,
+		RefundNo:      r.RefundNo,
+		TransactionId: r.TransactionID,
+		SystemStatus:  r.SystemStatus,
+		SystemAmount:  r.SystemAmount,
+		GatewayAmount: r.GatewayAmount,
+		DiffAmount:    r.DiffAmount,
+		ExpectedFee:   r.ExpectedFee,
+		GatewayFee:    r.GatewayFee,
+		Status:        string(r.Status),
+		Pattern:       string(r.Pattern),
+		BreakStatus:   string(r.BreakStatus),
+		Assignee:      r.Assignee,
+		Resolution:    r.Resolution,
+		ResolvedBy:    r.ResolvedBy,
+		ResolvedAt:    resolvedAt,
+		Remark:        r.Remark,
+		CreatedAt:     timestamppb.New(r.CreatedAt),
+		Notes:         notes,
+	}
+}
+
+// 辅助函数：将差异备注转换为 Proto 消息对象。
+func convertNoteToProto(n *domain.ReconciliationNote) *pb.ReconciliationBreakNote {
+	return &pb.ReconciliationBreakNote{
+		Id:        uint64(n.ID),
+		BreakId:   n.RecordID,
+		Author:    n.Author,
+		Content:   n.Content,
+		CreatedAt: timestamppb.New(n.CreatedAt),
+	}
+}
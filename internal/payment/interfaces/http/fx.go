@@ -0,0 +1,55 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/response"
+)
+
+type setFXRateRequest struct {
+	BaseCurrency  string          `json:"base_currency" binding:"required"`
+	QuoteCurrency string          `json:"quote_currency" binding:"required"`
+	Rate          decimal.Decimal `json:"rate"`
+	Source        string          `json:"source" binding:"required,max=64"`
+	EffectiveAt   time.Time       `json:"effective_at"` // 牌价生效时间，为空时为当前时间
+}
+
+// SetFXRate 更新货币对牌价 (PUT /fx-rates)。已锁定汇率的支付单不受影响。
+func (h *Handler) SetFXRate(c *gin.Context) {
+	var req setFXRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid request body: "+err.Error(), "")
+		return
+	}
+	if !req.Rate.IsPositive() {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "rate must be positive", "")
+		return
+	}
+
+	rate, err := h.app.SetFXRate(c.Request.Context(), req.BaseCurrency, req.QuoteCurrency, req.Rate, req.Source, req.EffectiveAt)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "set fx rate failed", "base", req.BaseCurrency, "quote", req.QuoteCurrency, "error", err)
+		if errors.Is(err, domain.ErrUnsupportedCurrency) {
+			response.ErrorWithStatus(c, http.StatusBadRequest, err.Error(), "")
+			return
+		}
+		response.ErrorWithStatus(c, http.StatusInternalServerError, "set fx rate failed: "+err.Error(), "")
+		return
+	}
+	response.Success(c, rate)
+}
+
+// ListFXRates 查询全部牌价 (GET /fx-rates)。
+func (h *Handler) ListFXRates(c *gin.Context) {
+	rates, err := h.app.ListFXRates(c.Request.Context())
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusInternalServerError, "list fx rates failed: "+err.Error(), "")
+		return
+	}
+	response.Success(c, gin.H{"rates": rates})
+}
@@ -1,12 +1,15 @@
 package http
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wyfcoding/ecommerce/internal/payment/application"
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/middleware"
 	"github.com/wyfcoding/pkg/response"
 	"github.com/wyfcoding/pkg/utils/ctxutil"
 )
@@ -25,22 +28,79 @@ func NewHandler(app *application.PaymentService, logger *slog.Logger) *Handler {
 	}
 }
 
+// RegisterNotifyRoutes 注册支付渠道异步通知路由，须挂载在鉴权与幂等中间件之外。
+func (h *Handler) RegisterNotifyRoutes(router *gin.RouterGroup) {
+	router.POST("/payments/notify/:gateway", h.HandleNotification)
+}
+
 // RegisterRoutes 注册路由
 func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
 	payments := router.Group("/payments")
 	{
 		payments.POST("", h.InitiatePayment)
-		payments.POST("/callback", h.HandlePaymentCallback)
 		payments.GET("/:id", h.GetPaymentStatus)
 		payments.POST("/:id/refunds", h.RequestRefund)
 	}
+
+	// 对账与差异处理，仅限财务人员
+	recon := router.Group("/reconciliation", middleware.HasRole("FINANCE"))
+	{
+		recon.POST("/runs", h.RunReconciliation)
+		recon.GET("/report", h.GetReconciliationReport)
+		recon.GET("/breaks", h.ListReconciliationBreaks)
+		recon.GET("/breaks/:id", h.GetReconciliationBreak)
+		recon.POST("/breaks/:id/assign", h.AssignReconciliationBreak)
+		recon.POST("/breaks/:id/notes", h.AnnotateReconciliationBreak)
+		recon.POST("/breaks/:id/close", h.CloseReconciliationBreak)
+	}
+
+	// 牌价维护，仅限财务人员
+	fx := router.Group("/fx-rates", middleware.HasRole("FINANCE"))
+	{
+		fx.GET("", h.ListFXRates)
+		fx.PUT("", h.SetFXRate)
+	}
+
+	// 渠道路由：健康度、路由规则与决策日志，仅限管理员
+	routing := router.Group("/routing", middleware.HasRole("ADMIN"))
+	{
+		routing.GET("/health", h.ListChannelHealth)
+		routing.GET("/policies", h.ListRoutingPolicies)
+		routing.POST("/policies", h.CreateRoutingPolicy)
+		routing.PUT("/policies/:id", h.UpdateRoutingPolicy)
+		routing.GET("/decisions", h.ListRouteDecisions)
+	}
+
+	// 储值账户：余额查询与财务入账
+	storedValue := router.Group("/stored-value")
+	{
+		storedValue.GET("/:user_id", h.ListStoredValueBalances)
+		storedValue.POST("/:user_id/grants", middleware.HasRole("FINANCE"), h.GrantStoredValue)
+	}
 }
 
 type initiatePaymentRequest struct {
 	OrderID       uint64 `json:"order_id" binding:"required"`
 	UserID        uint64 `json:"user_id" binding:"required"`
 	Amount        int64  `json:"amount" binding:"required,gt=0"`
-	PaymentMethod string `json:"payment_method" binding:"required"`
+	Currency      string `json:"currency"` // 订单标价币种，为空时为 CNY
+	PaymentMethod string `json:"payment_method" binding:"required_without=Legs"`
+	// Legs 组合支付的支付腿，非空时忽略 PaymentMethod
+	Legs []paymentLegRequest `json:"legs" binding:"omitempty,dive"`
+	// MerchantShares 订单各商户商品金额，扣款时据此分账
+	MerchantShares []merchantShareRequest `json:"merchant_shares" binding:"omitempty,dive"`
+}
+
+type merchantShareRequest struct {
+	MerchantID uint64 `json:"merchant_id" binding:"required"`
+	Amount     int64  `json:"amount" binding:"required,gt=0"`
+	PromoterID uint64 `json:"promoter_id"` // 带来该商户商品的推广者，无推广时为 0
+}
+
+type paymentLegRequest struct {
+	Source        string `json:"source" binding:"required"`
+	PaymentMethod string `json:"payment_method"` // 渠道腿的支付方式
+	Amount        int64  `json:"amount" binding:"required,gt=0"`
 }
 
 // InitiatePayment 发起支付
@@ -52,10 +112,36 @@ func (h *Handler) InitiatePayment(c *gin.Context) {
 	}
 
 	ctx := ctxutil.WithIP(c.Request.Context(), c.ClientIP())
-	payment, gatewayResp, err := h.app.InitiatePayment(ctx, req.OrderID, req.UserID, req.Amount, req.PaymentMethod)
+	var (
+		payment     *domain.Payment
+		gatewayResp *domain.PaymentGatewayResponse
+		err         error
+	)
+	shares := make([]domain.MerchantShare, 0, len(req.MerchantShares))
+	for _, share := range req.MerchantShares {
+		shares = append(shares, domain.MerchantShare{MerchantID: share.MerchantID, Amount: share.Amount, PromoterID: share.PromoterID})
+	}
+	if len(req.Legs) > 0 {
+		legs := make([]domain.LegRequest, 0, len(req.Legs))
+		for _, leg := range req.Legs {
+			legs = append(legs, domain.LegRequest{Source: domain.LegSource(leg.Source), PaymentMethod: leg.PaymentMethod, Amount: leg.Amount})
+		}
+		payment, gatewayResp, err = h.app.InitiateCompositePayment(ctx, req.OrderID, req.UserID, req.Amount, req.Currency, legs, shares)
+	} else {
+		payment, gatewayResp, err = h.app.InitiatePayment(ctx, req.OrderID, req.UserID, req.Amount, req.Currency, req.PaymentMethod, shares)
+	}
 	if err != nil {
 		h.logger.ErrorContext(ctx, "initiate payment failed", "order_id", req.OrderID, "user_id", req.UserID, "error", err)
-		response.ErrorWithStatus(c, http.StatusInternalServerError, "initiate payment failed: "+err.Error(), "")
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, domain.ErrUnsupportedCurrency), errors.Is(err, domain.ErrNoChannelForCurrency), errors.Is(err, domain.ErrInvalidLegs), errors.Is(err, domain.ErrInvalidSplitBasis):
+			code = http.StatusBadRequest
+		case errors.Is(err, domain.ErrInsufficientBalance):
+			code = http.StatusPaymentRequired
+		case errors.Is(err, domain.ErrFXRateUnavailable), errors.Is(err, domain.ErrNoHealthyChannel):
+			code = http.StatusServiceUnavailable
+		}
+		response.ErrorWithStatus(c, code, "initiate payment failed: "+err.Error(), "")
 		return
 	}
 
@@ -65,43 +151,64 @@ func (h *Handler) InitiatePayment(c *gin.Context) {
 	})
 }
 
-type paymentCallbackRequest struct {
-	PaymentNo     string `json:"payment_no" binding:"required"`
-	Success       bool   `json:"success"`
-	TransactionID string `json:"transaction_id"`
-	ThirdPartyNo  string `json:"third_party_no"`
-}
-
-// HandlePaymentCallback 处理支付回调
-func (h *Handler) HandlePaymentCallback(c *gin.Context) {
-	var req paymentCallbackRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid callback payload", "")
-		return
-	}
-
-	// 真实化执行：通过支付单号反查用户ID，用于分片路由
-	userID, err := h.app.GetUserIDByPaymentNo(c.Request.Context(), req.PaymentNo)
+// HandleNotification 处理支付渠道异步通知 (POST /payments/notify/:gateway)。
+// 该接口由支付渠道直接调用，不经过 JWT 鉴权，真实性完全依赖渠道签名校验；
+// 应答格式遵循各渠道约定：支付宝返回纯文本 success/failure，微信支付与 Stripe 以 HTTP 状态码表示处理结果。
+func (h *Handler) HandleNotification(c *gin.Context) {
+	gatewayType := domain.GatewayType(c.Param("gateway"))
+	body, err := c.GetRawData()
 	if err != nil {
-		h.logger.ErrorContext(c.Request.Context(), "failed to lookup user_id for callback", "payment_no", req.PaymentNo, "error", err)
-		response.ErrorWithStatus(c, http.StatusInternalServerError, "payment record context not found", "")
+		h.notifyResponse(c, gatewayType, http.StatusBadRequest, "unreadable body")
 		return
 	}
 
-	callbackData := map[string]string{
-		"payment_no":     req.PaymentNo,
-		"status":         strconv.FormatBool(req.Success),
-		"transaction_id": req.TransactionID,
-		"third_party_no": req.ThirdPartyNo,
+	headers := make(map[string]string, len(c.Request.Header))
+	for k := range c.Request.Header {
+		headers[k] = c.Request.Header.Get(k)
 	}
 
-	if err := h.app.HandlePaymentCallback(c.Request.Context(), userID, req.PaymentNo, req.Success, req.TransactionID, req.ThirdPartyNo, callbackData); err != nil {
-		h.logger.ErrorContext(c.Request.Context(), "payment callback processing failed", "payment_no", req.PaymentNo, "user_id", userID, "error", err)
-		response.ErrorWithStatus(c, http.StatusInternalServerError, "callback processing error", "")
+	n, err := h.app.HandleNotification(c.Request.Context(), gatewayType, &domain.NotifyRequest{Headers: headers, Body: body})
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "payment notification processing failed", "gateway", gatewayType, "error", err)
+		switch {
+		case errors.Is(err, domain.ErrUnsupportedNotifyGateway):
+			h.notifyResponse(c, gatewayType, http.StatusNotFound, "unsupported gateway")
+		case errors.Is(err, domain.ErrInvalidNotifySignature), errors.Is(err, domain.ErrNotifyMerchantMismatch):
+			h.notifyResponse(c, gatewayType, http.StatusUnauthorized, "verification failed")
+		case errors.Is(err, domain.ErrNotifyAmountMismatch), n == nil:
+			h.notifyResponse(c, gatewayType, http.StatusBadRequest, "invalid notification")
+		default:
+			h.notifyResponse(c, gatewayType, http.StatusInternalServerError, "processing error")
+		}
 		return
 	}
 
-	response.Success(c, nil)
+	h.notifyResponse(c, gatewayType, http.StatusOK, "")
+}
+
+// notifyResponse 按渠道约定应答异步通知。
+func (h *Handler) notifyResponse(c *gin.Context, gatewayType domain.GatewayType, code int, message string) {
+	switch gatewayType {
+	case domain.GatewayTypeAlipay:
+		// 支付宝以响应体判断结果，非 success 会按策略重发
+		if code == http.StatusOK {
+			c.String(http.StatusOK, "success")
+		} else {
+			c.String(http.StatusOK, "failure")
+		}
+	case domain.GatewayTypeWechat:
+		if code == http.StatusOK {
+			c.Status(http.StatusNoContent)
+		} else {
+			c.JSON(code, gin.H{"code": "FAIL", "message": message})
+		}
+	default:
+		if code == http.StatusOK {
+			c.JSON(http.StatusOK, gin.H{"received": true})
+		} else {
+			c.JSON(code, gin.H{"error": message})
+		}
+	}
 }
 
 // GetPaymentStatus 查询支付状态
@@ -152,7 +259,11 @@ func (h *Handler) RequestRefund(c *gin.Context) {
 	refund, err := h.app.RequestRefund(c.Request.Context(), req.UserID, id, req.Amount, req.Reason)
 	if err != nil {
 		h.logger.ErrorContext(c.Request.Context(), "refund initiation failed", "id", id, "user_id", req.UserID, "error", err)
-		response.ErrorWithStatus(c, http.StatusInternalServerError, "refund failed: "+err.Error(), "")
+		code := http.StatusInternalServerError
+		if errors.Is(err, domain.ErrRefundExceedsLegs) {
+			code = http.StatusBadRequest
+		}
+		response.ErrorWithStatus(c, code, "refund failed: "+err.Error(), "")
 		return
 	}
 
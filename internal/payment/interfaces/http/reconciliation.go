@@ -0,0 +1,191 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/response"
+)
+
+type runReconciliationRequest struct {
+	BillDate string `json:"bill_date" binding:"required"`
+}
+
+// RunReconciliation 对指定账单日执行对账 (POST /reconciliation/runs)。部分渠道失败时仍返回汇总，失败原因记录在对应批次中。
+func (h *Handler) RunReconciliation(c *gin.Context) {
+	var req runReconciliationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid request body: "+err.Error(), "")
+		return
+	}
+
+	runs, err := h.app.RunReconciliation(c.Request.Context(), req.BillDate)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "reconciliation finished with errors", "bill_date", req.BillDate, "runs", len(runs), "error", err)
+		if len(runs) == 0 {
+			h.reconciliationError(c, err)
+			return
+		}
+	}
+	response.Success(c, gin.H{"bill_date": req.BillDate, "runs": runs})
+}
+
+// GetReconciliationReport 查询账单日的各渠道对账汇总 (GET /reconciliation/report?bill_date=&channel_code=)。
+func (h *Handler) GetReconciliationReport(c *gin.Context) {
+	billDate := c.Query("bill_date")
+	runs, err := h.app.ListReconciliationRuns(c.Request.Context(), billDate, c.Query("channel_code"))
+	if err != nil {
+		h.reconciliationError(c, err)
+		return
+	}
+	response.Success(c, gin.H{"bill_date": billDate, "runs": runs})
+}
+
+// ListReconciliationBreaks 分页查询对账差异 (GET /reconciliation/breaks)。
+func (h *Handler) ListReconciliationBreaks(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	filter := &domain.BreakFilter{
+		BillDate:    c.Query("bill_date"),
+		ChannelCode: c.Query("channel_code"),
+		BreakStatus: domain.BreakStatus(c.Query("break_status")),
+		Assignee:    c.Query("assignee"),
+	}
+
+	records, total, err := h.app.ListReconciliationBreaks(c.Request.Context(), filter, page, pageSize)
+	if err != nil {
+		h.reconciliationError(c, err)
+		return
+	}
+	response.Success(c, gin.H{"breaks": records, "total": total, "page": page, "page_size": pageSize})
+}
+
+// GetReconciliationBreak 查询对账差异详情及处理备注。
+func (h *Handler) GetReconciliationBreak(c *gin.Context) {
+	id, ok := h.breakID(c)
+	if !ok {
+		return
+	}
+	record, err := h.app.GetReconciliationBreak(c.Request.Context(), id)
+	if err != nil {
+		h.reconciliationError(c, err)
+		return
+	}
+	response.Success(c, record)
+}
+
+type assignBreakRequest struct {
+	Assignee string `json:"assignee" binding:"required,max=64"`
+}
+
+// AssignReconciliationBreak 指派差异处理人。
+func (h *Handler) AssignReconciliationBreak(c *gin.Context) {
+	id, ok := h.breakID(c)
+	if !ok {
+		return
+	}
+	var req assignBreakRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid request body: "+err.Error(), "")
+		return
+	}
+
+	record, err := h.app.AssignReconciliationBreak(c.Request.Context(), id, req.Assignee, operator(c))
+	if err != nil {
+		h.reconciliationError(c, err)
+		return
+	}
+	response.Success(c, record)
+}
+
+type annotateBreakRequest struct {
+	Content string `json:"content" binding:"required,max=1000"`
+}
+
+// AnnotateReconciliationBreak 追加差异处理备注。
+func (h *Handler) AnnotateReconciliationBreak(c *gin.Context) {
+	id, ok := h.breakID(c)
+	if !ok {
+		return
+	}
+	var req annotateBreakRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid request body: "+err.Error(), "")
+		return
+	}
+
+	note, err := h.app.AnnotateReconciliationBreak(c.Request.Context(), id, operator(c), req.Content)
+	if err != nil {
+		h.reconciliationError(c, err)
+		return
+	}
+	response.Success(c, note)
+}
+
+type closeBreakRequest struct {
+	Resolution string `json:"resolution" binding:"required,max=255"`
+}
+
+// CloseReconciliationBreak 关闭差异，须说明处理结论。
+func (h *Handler) CloseReconciliationBreak(c *gin.Context) {
+	id, ok := h.breakID(c)
+	if !ok {
+		return
+	}
+	var req closeBreakRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid request body: "+err.Error(), "")
+		return
+	}
+
+	record, err := h.app.CloseReconciliationBreak(c.Request.Context(), id, operator(c), req.Resolution)
+	if err != nil {
+		h.reconciliationError(c, err)
+		return
+	}
+	response.Success(c, record)
+}
+
+// breakID 解析路径中的差异 ID，格式错误时直接应答。
+func (h *Handler) breakID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid break ID format", "")
+		return 0, false
+	}
+	return id, true
+}
+
+// reconciliationError 将对账领域错误映射为 HTTP 状态码。
+func (h *Handler) reconciliationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domain.ErrInvalidBillDate):
+		response.ErrorWithStatus(c, http.StatusBadRequest, err.Error(), "")
+	case errors.Is(err, domain.ErrBreakNotFound):
+		response.ErrorWithStatus(c, http.StatusNotFound, err.Error(), "")
+	case errors.Is(err, domain.ErrBreakClosed):
+		response.ErrorWithStatus(c, http.StatusConflict, err.Error(), "")
+	default:
+		h.logger.ErrorContext(c.Request.Context(), "reconciliation request failed", "path", c.FullPath(), "error", err)
+		response.ErrorWithStatus(c, http.StatusInternalServerError, "reconciliation request failed", "")
+	}
+}
+
+// operator 取 JWT 中的用户名作为操作人。
+func operator(c *gin.Context) string {
+	if name := c.GetString("username"); name != "" {
+		return name
+	}
+	if uid, exists := c.Get("user_id"); exists {
+		switch v := uid.(type) {
+		case uint64:
+			return strconv.FormatUint(v, 10)
+		case string:
+			return v
+		}
+	}
+	return "unknown"
+}
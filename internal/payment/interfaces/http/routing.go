@@ -0,0 +1,127 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/response"
+)
+
+// ListChannelHealth 查询各渠道滑动窗口健康度与熔断器状态 (GET /routing/health)。
+func (h *Handler) ListChannelHealth(c *gin.Context) {
+	health, err := h.app.ListChannelHealth(c.Request.Context())
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusInternalServerError, "list channel health failed: "+err.Error(), "")
+		return
+	}
+	response.Success(c, gin.H{"channels": health})
+}
+
+// ListRoutingPolicies 查询全部路由规则 (GET /routing/policies)。
+func (h *Handler) ListRoutingPolicies(c *gin.Context) {
+	policies, err := h.app.ListRoutingPolicies(c.Request.Context())
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusInternalServerError, "list routing policies failed: "+err.Error(), "")
+		return
+	}
+	response.Success(c, gin.H{"policies": policies})
+}
+
+type routingPolicyRequest struct {
+	Name          string `json:"name" binding:"required,max=64"`
+	MerchantID    uint64 `json:"merchant_id"`
+	PaymentMethod string `json:"payment_method"`
+	MinAmount     int64  `json:"min_amount"`
+	MaxAmount     int64  `json:"max_amount"`
+	Strategy      string `json:"strategy" binding:"required"`
+	AltStrategy   string `json:"alt_strategy"`
+	AltPercent    int    `json:"alt_percent"`
+	Priority      int    `json:"priority"`
+	Enabled       *bool  `json:"enabled"` // 为空时默认启用
+	Description   string `json:"description" binding:"max=255"`
+}
+
+// CreateRoutingPolicy 新增路由规则 (POST /routing/policies)。
+func (h *Handler) CreateRoutingPolicy(c *gin.Context) {
+	h.saveRoutingPolicy(c, 0)
+}
+
+// UpdateRoutingPolicy 更新路由规则 (PUT /routing/policies/:id)，各副本在规则缓存过期后生效。
+func (h *Handler) UpdateRoutingPolicy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid policy id", "")
+		return
+	}
+	h.saveRoutingPolicy(c, id)
+}
+
+func (h *Handler) saveRoutingPolicy(c *gin.Context, id uint64) {
+	var req routingPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid request body: "+err.Error(), "")
+		return
+	}
+	policy := &domain.RoutingPolicy{
+		Name:          req.Name,
+		MerchantID:    req.MerchantID,
+		PaymentMethod: req.PaymentMethod,
+		MinAmount:     req.MinAmount,
+		MaxAmount:     req.MaxAmount,
+		Strategy:      req.Strategy,
+		AltStrategy:   req.AltStrategy,
+		AltPercent:    req.AltPercent,
+		Priority:      req.Priority,
+		Enabled:       req.Enabled == nil || *req.Enabled,
+		Description:   req.Description,
+	}
+
+	saved, err := h.app.SaveRoutingPolicy(c.Request.Context(), id, policy)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidRoutingPolicy):
+			response.ErrorWithStatus(c, http.StatusBadRequest, err.Error(), "")
+		case errors.Is(err, domain.ErrRoutingPolicyNotFound):
+			response.ErrorWithStatus(c, http.StatusNotFound, err.Error(), "")
+		default:
+			h.logger.ErrorContext(c.Request.Context(), "save routing policy failed", "policy_id", id, "name", req.Name, "error", err)
+			response.ErrorWithStatus(c, http.StatusInternalServerError, "save routing policy failed: "+err.Error(), "")
+		}
+		return
+	}
+	response.Success(c, saved)
+}
+
+// ListRouteDecisions 分页查询路由决策日志 (GET /routing/decisions?order_id=&merchant_id=&channel_code=&strategy=&variant=&since=)。
+func (h *Handler) ListRouteDecisions(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	orderID, _ := strconv.ParseUint(c.Query("order_id"), 10, 64)
+	merchantID, _ := strconv.ParseUint(c.Query("merchant_id"), 10, 64)
+	filter := &domain.RouteDecisionFilter{
+		OrderID:     orderID,
+		MerchantID:  merchantID,
+		ChannelCode: c.Query("channel_code"),
+		Strategy:    c.Query("strategy"),
+		Variant:     c.Query("variant"),
+	}
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			response.ErrorWithStatus(c, http.StatusBadRequest, "since must be RFC3339", "")
+			return
+		}
+		filter.Since = &t
+	}
+
+	decisions, total, err := h.app.ListRouteDecisions(c.Request.Context(), filter, page, pageSize)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusInternalServerError, "list route decisions failed: "+err.Error(), "")
+		return
+	}
+	response.Success(c, gin.H{"decisions": decisions, "total": total, "page": page, "page_size": pageSize})
+}
@@ -0,0 +1,61 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wyfcoding/ecommerce/internal/payment/domain"
+	"github.com/wyfcoding/pkg/response"
+)
+
+// ListStoredValueBalances 查询用户储值账户余额 (GET /stored-value/:user_id)。
+func (h *Handler) ListStoredValueBalances(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid user ID", "")
+		return
+	}
+
+	accounts, err := h.app.ListStoredValueBalances(c.Request.Context(), userID)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusInternalServerError, "list stored value balances failed: "+err.Error(), "")
+		return
+	}
+	response.Success(c, gin.H{"accounts": accounts})
+}
+
+type grantStoredValueRequest struct {
+	Source   string `json:"source" binding:"required"`
+	Currency string `json:"currency"` // 为空时为 CNY
+	Amount   int64  `json:"amount" binding:"required,gt=0"`
+	RefNo    string `json:"ref_no" binding:"required,max=64"` // 充值单号或积分发放批次号
+	Remark   string `json:"remark" binding:"max=255"`
+}
+
+// GrantStoredValue 向用户储值账户入账 (POST /stored-value/:user_id/grants)。
+func (h *Handler) GrantStoredValue(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid user ID", "")
+		return
+	}
+	var req grantStoredValueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid request body: "+err.Error(), "")
+		return
+	}
+
+	account, err := h.app.GrantStoredValue(c.Request.Context(), userID, domain.LegSource(req.Source), req.Currency, req.Amount, req.RefNo, req.Remark)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "grant stored value failed", "user_id", userID, "source", req.Source, "error", err)
+		if errors.Is(err, domain.ErrInvalidLegs) || errors.Is(err, domain.ErrUnsupportedCurrency) {
+			response.ErrorWithStatus(c, http.StatusBadRequest, err.Error(), "")
+			return
+		}
+		response.ErrorWithStatus(c, http.StatusInternalServerError, "grant stored value failed: "+err.Error(), "")
+		return
+	}
+	response.Success(c, account)
+}
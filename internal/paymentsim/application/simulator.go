@@ -0,0 +1,364 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/domain"
+)
+
+// notifyRetries 回调未被确认时的重试次数，重试间隔线性递增。
+const notifyRetries = 3
+
+// Notifier 按渠道协议构造签名回调并投递到支付服务。
+type Notifier interface {
+	Gateway() domain.Gateway
+	// Notify 投递一次回调，支付服务未确认时返回错误
+	Notify(ctx context.Context, trade *domain.Trade) error
+}
+
+// Simulator 渠道模拟器，在内存中维护各渠道的交易与退款，并按场景调度支付与回调。
+type Simulator struct {
+	mu              sync.Mutex
+	trades          map[domain.Gateway]map[string]*domain.Trade // gateway -> payment_no -> trade
+	scenarios       map[string]domain.Scenario                  // payment_no -> scenario
+	defaultScenario domain.Scenario
+	notifiers       map[domain.Gateway]Notifier
+	seq             atomic.Uint64
+	logger          *slog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSimulator 创建模拟器。
+func NewSimulator(defaultScenario domain.Scenario, logger *slog.Logger) *Simulator {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Simulator{
+		trades:          make(map[domain.Gateway]map[string]*domain.Trade),
+		scenarios:       make(map[string]domain.Scenario),
+		defaultScenario: defaultScenario,
+		notifiers:       make(map[domain.Gateway]Notifier),
+		logger:          logger,
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+}
+
+// RegisterNotifier 注册渠道回调投递器。
+func (s *Simulator) RegisterNotifier(n Notifier) {
+	s.notifiers[n.Gateway()] = n
+}
+
+// Close 停止尚未执行的自动支付与回调任务。
+func (s *Simulator) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// SetScenario 为指定商户订单号设置场景；paymentNo 为空时替换默认场景。
+func (s *Simulator) SetScenario(paymentNo string, scenario domain.Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if paymentNo == "" {
+		s.defaultScenario = scenario
+		return
+	}
+	s.scenarios[paymentNo] = scenario
+}
+
+// ClearScenario 删除指定商户订单号的场景，恢复使用默认场景。
+func (s *Simulator) ClearScenario(paymentNo string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.scenarios, paymentNo)
+}
+
+// Scenario 返回商户订单号生效的场景。
+func (s *Simulator) Scenario(paymentNo string) domain.Scenario {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scenarioLocked(paymentNo)
+}
+
+func (s *Simulator) scenarioLocked(paymentNo string) domain.Scenario {
+	if sc, ok := s.scenarios[paymentNo]; ok {
+		return sc
+	}
+	return s.defaultScenario
+}
+
+// NextID 生成带前缀的渠道单号。
+func (s *Simulator) NextID(prefix string) string {
+	return fmt.Sprintf("%s%s%06d", prefix, time.Now().Format("20060102150405"), s.seq.Add(1))
+}
+
+// CreateTrade 下单。同一商户订单号重复下单时金额一致则返回原交易 (幂等)，否则返回冲突。
+func (s *Simulator) CreateTrade(ctx context.Context, trade *domain.Trade) (*domain.Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byNo, ok := s.trades[trade.Gateway]
+	if !ok {
+		byNo = make(map[string]*domain.Trade)
+		s.trades[trade.Gateway] = byNo
+	}
+	if existing, ok := byNo[trade.PaymentNo]; ok {
+		if existing.Amount != trade.Amount {
+			return nil, domain.ErrTradeConflict
+		}
+		return existing.Clone(), nil
+	}
+
+	trade.Status = domain.TradeWaitPay
+	trade.CreatedAt = time.Now()
+	byNo[trade.PaymentNo] = trade
+	s.logger.InfoContext(ctx, "simulated trade created", "gateway", trade.Gateway, "payment_no", trade.PaymentNo, "amount", trade.Amount)
+
+	if sc := s.scenarioLocked(trade.PaymentNo); sc.AutoPay {
+		s.schedule(sc.PayDelay, func() {
+			if _, err := s.Pay(s.ctx, trade.Gateway, trade.PaymentNo); err != nil {
+				s.logger.Warn("auto pay skipped", "gateway", trade.Gateway, "payment_no", trade.PaymentNo, "error", err)
+			}
+		})
+	}
+	return trade.Clone(), nil
+}
+
+// Trade 按商户订单号查询交易。
+func (s *Simulator) Trade(gateway domain.Gateway, paymentNo string) (*domain.Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.trades[gateway][paymentNo]
+	if !ok {
+		return nil, domain.ErrTradeNotFound
+	}
+	return t.Clone(), nil
+}
+
+// TradeByTransaction 按渠道交易号查询交易。
+func (s *Simulator) TradeByTransaction(gateway domain.Gateway, transactionID string) (*domain.Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.trades[gateway] {
+		if t.TransactionID == transactionID {
+			return t.Clone(), nil
+		}
+	}
+	return nil, domain.ErrTradeNotFound
+}
+
+// Pay 模拟用户完成支付，按场景决定结果与实付金额，并调度回调。
+func (s *Simulator) Pay(ctx context.Context, gateway domain.Gateway, paymentNo string) (*domain.Trade, error) {
+	s.mu.Lock()
+	t, ok := s.trades[gateway][paymentNo]
+	if !ok {
+		s.mu.Unlock()
+		return nil, domain.ErrTradeNotFound
+	}
+	if t.Status != domain.TradeWaitPay {
+		s.mu.Unlock()
+		return nil, domain.ErrTradeStatus
+	}
+
+	sc := s.scenarioLocked(paymentNo)
+	now := time.Now()
+	if sc.PayFail {
+		t.Status = domain.TradeFailed
+	} else {
+		t.Status = domain.TradeSuccess
+		t.PaidAmount = t.Amount + sc.AmountDelta
+		t.PaidAt = &now
+	}
+	snapshot := t.Clone()
+	s.mu.Unlock()
+
+	s.logger.InfoContext(ctx, "simulated payment completed", "gateway", gateway, "payment_no", paymentNo, "status", snapshot.Status, "paid_amount", snapshot.PaidAmount)
+	s.dispatch(gateway, paymentNo, sc)
+	return snapshot, nil
+}
+
+// Notify 立即按当前交易状态重发一次回调 (不受场景约束)。
+func (s *Simulator) Notify(ctx context.Context, gateway domain.Gateway, paymentNo string) error {
+	t, err := s.Trade(gateway, paymentNo)
+	if err != nil {
+		return err
+	}
+	n, ok := s.notifiers[gateway]
+	if !ok {
+		return fmt.Errorf("no notifier registered for %s", gateway)
+	}
+	return n.Notify(ctx, t)
+}
+
+// CloseTrade 关闭未支付交易。已关闭或已失败的交易重复关闭视为成功。
+func (s *Simulator) CloseTrade(gateway domain.Gateway, paymentNo string) (*domain.Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.trades[gateway][paymentNo]
+	if !ok {
+		return nil, domain.ErrTradeNotFound
+	}
+	switch t.Status {
+	case domain.TradeSuccess:
+		return nil, domain.ErrTradeStatus
+	case domain.TradeWaitPay:
+		t.Status = domain.TradeClosed
+	}
+	return t.Clone(), nil
+}
+
+// Refund 退款。同一退款单号重复提交返回原结果；created 表示本次请求是否新建了退款。
+// 场景开启部分退款失败时，金额小于可退余额的退款记为失败。
+func (s *Simulator) Refund(ctx context.Context, gateway domain.Gateway, paymentNo, refundNo string, amount int64, reason string) (refund *domain.Refund, created bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.trades[gateway][paymentNo]
+	if !ok {
+		return nil, false, domain.ErrTradeNotFound
+	}
+	if existing := t.FindRefund(refundNo); existing != nil {
+		rc := *existing
+		return &rc, false, nil
+	}
+	if t.Status != domain.TradeSuccess {
+		return nil, false, domain.ErrTradeStatus
+	}
+	refundable := t.PaidAmount - t.Refunded()
+	if amount <= 0 || amount > refundable {
+		return nil, false, domain.ErrRefundExceeded
+	}
+
+	now := time.Now()
+	r := &domain.Refund{
+		RefundNo:  refundNo,
+		RefundID:  s.NextID("R"),
+		Amount:    amount,
+		Status:    domain.RefundSuccess,
+		Reason:    reason,
+		CreatedAt: now,
+	}
+	if s.scenarioLocked(paymentNo).FailPartialRefund && amount < refundable {
+		r.Status = domain.RefundFailed
+	} else {
+		r.RefundedAt = &now
+	}
+	t.Refunds = append(t.Refunds, r)
+	s.logger.InfoContext(ctx, "simulated refund processed", "gateway", gateway, "payment_no", paymentNo, "refund_no", refundNo, "amount", amount, "status", r.Status)
+
+	rc := *r
+	return &rc, true, nil
+}
+
+// FindRefund 按商户退款单号查询退款及其所属交易。
+func (s *Simulator) FindRefund(gateway domain.Gateway, refundNo string) (*domain.Trade, *domain.Refund, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.trades[gateway] {
+		if r := t.FindRefund(refundNo); r != nil {
+			c := t.Clone()
+			return c, c.FindRefund(refundNo), nil
+		}
+	}
+	return nil, nil, domain.ErrRefundNotFound
+}
+
+// FindRefundByID 按渠道退款单号查询退款及其所属交易。
+func (s *Simulator) FindRefundByID(gateway domain.Gateway, refundID string) (*domain.Trade, *domain.Refund, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.trades[gateway] {
+		for _, r := range t.Refunds {
+			if r.RefundID == refundID {
+				c := t.Clone()
+				return c, c.FindRefund(r.RefundNo), nil
+			}
+		}
+	}
+	return nil, nil, domain.ErrRefundNotFound
+}
+
+// BillTrades 返回在 [from, to) 内支付成功或发生成功退款的交易，按创建时间排序，用于生成对账单。
+func (s *Simulator) BillTrades(gateway domain.Gateway, from, to time.Time) []*domain.Trade {
+	inRange := func(t *time.Time) bool {
+		return t != nil && !t.Before(from) && t.Before(to)
+	}
+
+	s.mu.Lock()
+	var result []*domain.Trade
+	for _, t := range s.trades[gateway] {
+		hit := inRange(t.PaidAt)
+		for _, r := range t.Refunds {
+			hit = hit || inRange(r.RefundedAt)
+		}
+		if hit {
+			result = append(result, t.Clone())
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// dispatch 按场景延迟发送回调，重复回调之间间隔 1 秒；未被确认的回调线性退避重试。
+func (s *Simulator) dispatch(gateway domain.Gateway, paymentNo string, sc domain.Scenario) {
+	n, ok := s.notifiers[gateway]
+	if !ok || sc.Callbacks() == 0 {
+		return
+	}
+	s.schedule(sc.CallbackDelay, func() {
+		for i := range sc.Callbacks() {
+			if i > 0 && !s.sleep(time.Second) {
+				return
+			}
+			t, err := s.Trade(gateway, paymentNo)
+			if err != nil {
+				return
+			}
+			for attempt := 1; ; attempt++ {
+				err := n.Notify(s.ctx, t)
+				if err == nil {
+					s.logger.Info("simulated callback delivered", "gateway", gateway, "payment_no", paymentNo, "seq", i+1)
+					break
+				}
+				s.logger.Warn("simulated callback not acknowledged", "gateway", gateway, "payment_no", paymentNo, "attempt", attempt, "error", err)
+				if attempt > notifyRetries || !s.sleep(time.Duration(attempt)*2*time.Second) {
+					break
+				}
+			}
+		}
+	})
+}
+
+// schedule 延迟执行后台任务，模拟器关闭时取消。
+func (s *Simulator) schedule(delay time.Duration, fn func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if s.sleep(delay) {
+			fn()
+		}
+	}()
+}
+
+// sleep 可被关闭打断的等待，返回 false 表示模拟器已关闭。
+func (s *Simulator) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return s.ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
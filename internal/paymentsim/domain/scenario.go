@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// Scenario 脚本化场景，决定交易的支付结果与回调行为。
+// 可配置全局默认场景，也可按商户订单号单独指定。
+type Scenario struct {
+	AutoPay           bool          `mapstructure:"auto_pay"`            // 下单后自动完成支付
+	PayDelay          time.Duration `mapstructure:"pay_delay"`           // 自动支付前的等待时间
+	PayFail           bool          `mapstructure:"pay_fail"`            // 支付失败 (交易关闭/支付失败)
+	CallbackDelay     time.Duration `mapstructure:"callback_delay"`      // 支付完成后延迟发送回调
+	CallbackCount     int           `mapstructure:"callback_count"`      // 回调发送次数，大于 1 时模拟重复回调
+	SuppressCallback  bool          `mapstructure:"suppress_callback"`   // 不发送回调，仅能通过查询获知结果
+	AmountDelta       int64         `mapstructure:"amount_delta"`        // 回调与查询报告的金额相对下单金额的偏差
+	FailPartialRefund bool          `mapstructure:"fail_partial_refund"` // 部分退款 (金额小于可退余额) 失败
+}
+
+// Callbacks 回调发送次数，至少一次。
+func (s Scenario) Callbacks() int {
+	if s.SuppressCallback {
+		return 0
+	}
+	return max(s.CallbackCount, 1)
+}
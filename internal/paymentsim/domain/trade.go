@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrTradeNotFound       = errors.New("trade not found")
+	ErrTradeConflict       = errors.New("trade already exists with different amount")
+	ErrTradeStatus         = errors.New("trade status does not allow this operation")
+	ErrRefundNotFound      = errors.New("refund not found")
+	ErrRefundExceeded      = errors.New("refund amount exceeds refundable balance")
+	ErrPartialRefundFailed = errors.New("partial refund rejected by scenario")
+)
+
+// Gateway 模拟的支付渠道。
+type Gateway string
+
+const (
+	GatewayAlipay Gateway = "alipay"
+	GatewayWechat Gateway = "wechat"
+	GatewayStripe Gateway = "stripe"
+)
+
+// TradeStatus 模拟交易状态，各渠道接口按自身协议渲染。
+type TradeStatus string
+
+const (
+	TradeWaitPay TradeStatus = "WAIT_PAY" // 已下单待支付
+	TradeSuccess TradeStatus = "SUCCESS"  // 支付成功
+	TradeFailed  TradeStatus = "FAILED"   // 支付失败
+	TradeClosed  TradeStatus = "CLOSED"   // 已关闭
+)
+
+// Trade 模拟渠道侧的一笔交易。
+type Trade struct {
+	Gateway       Gateway
+	PaymentNo     string // 商户订单号 (支付服务的 payment_no)
+	TransactionID string // 渠道交易号
+	Amount        int64  // 下单金额 (最小货币单位)
+	PaidAmount    int64  // 渠道报告的实付金额，金额不一致场景下与 Amount 不同
+	Currency      string
+	Description   string
+	NotifyURL     string
+	Status        TradeStatus
+	CreatedAt     time.Time
+	PaidAt        *time.Time
+	Refunds       []*Refund
+}
+
+// RefundStatus 模拟退款状态。
+type RefundStatus string
+
+const (
+	RefundSuccess RefundStatus = "SUCCESS"
+	RefundFailed  RefundStatus = "FAILED"
+)
+
+// Refund 模拟渠道侧的一笔退款。
+type Refund struct {
+	RefundNo   string // 商户退款单号
+	RefundID   string // 渠道退款单号
+	Amount     int64
+	Status     RefundStatus
+	Reason     string
+	CreatedAt  time.Time
+	RefundedAt *time.Time
+}
+
+// Refunded 已成功退款的累计金额。
+func (t *Trade) Refunded() int64 {
+	var total int64
+	for _, r := range t.Refunds {
+		if r.Status == RefundSuccess {
+			total += r.Amount
+		}
+	}
+	return total
+}
+
+// ReportedAmount 渠道对外报告的交易金额：已支付时为实付金额，否则为下单金额。
+func (t *Trade) ReportedAmount() int64 {
+	if t.Status == TradeSuccess {
+		return t.PaidAmount
+	}
+	return t.Amount
+}
+
+// FindRefund 按商户退款单号查找退款。
+func (t *Trade) FindRefund(refundNo string) *Refund {
+	for _, r := range t.Refunds {
+		if r.RefundNo == refundNo {
+			return r
+		}
+	}
+	return nil
+}
+
+// Clone 返回交易的深拷贝，供接口层在锁外渲染。
+func (t *Trade) Clone() *Trade {
+	c := *t
+	if t.PaidAt != nil {
+		paidAt := *t.PaidAt
+		c.PaidAt = &paidAt
+	}
+	c.Refunds = make([]*Refund, len(t.Refunds))
+	for i, r := range t.Refunds {
+		rc := *r
+		c.Refunds[i] = &rc
+	}
+	return &c
+}
@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/domain"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/infrastructure/signer"
+)
+
+// AlipayNotifier 支付宝异步通知 (trade_status_sync)，商户应答正文 "success" 视为确认。
+type AlipayNotifier struct {
+	signer *signer.Alipay
+	client *http.Client
+}
+
+// NewAlipayNotifier 创建支付宝通知投递器。
+func NewAlipayNotifier(s *signer.Alipay, client *http.Client) *AlipayNotifier {
+	return &AlipayNotifier{signer: s, client: client}
+}
+
+func (n *AlipayNotifier) Gateway() domain.Gateway { return domain.GatewayAlipay }
+
+// Notify 构造 RSA2 签名的表单通知并投递。
+func (n *AlipayNotifier) Notify(ctx context.Context, trade *domain.Trade) error {
+	now := time.Now().In(BeijingTime)
+	values := url.Values{}
+	values.Set("notify_time", now.Format(time.DateTime))
+	values.Set("notify_type", "trade_status_sync")
+	values.Set("notify_id", fmt.Sprintf("%d%s", now.UnixNano(), trade.PaymentNo))
+	values.Set("charset", "utf-8")
+	values.Set("version", "1.0")
+	values.Set("app_id", n.signer.Config.AppID)
+	values.Set("seller_id", n.signer.Config.SellerID)
+	values.Set("out_trade_no", trade.PaymentNo)
+	values.Set("trade_no", trade.TransactionID)
+	values.Set("trade_status", AlipayTradeStatus(trade.Status))
+	values.Set("total_amount", FormatAmount(trade.ReportedAmount()))
+	values.Set("gmt_create", trade.CreatedAt.In(BeijingTime).Format(time.DateTime))
+	if trade.PaidAt != nil {
+		values.Set("receipt_amount", FormatAmount(trade.PaidAmount))
+		values.Set("gmt_payment", trade.PaidAt.In(BeijingTime).Format(time.DateTime))
+	}
+	if trade.Currency != "" && trade.Currency != "CNY" {
+		values.Set("trans_currency", trade.Currency)
+	}
+	n.signer.SignValues(values)
+
+	status, body, err := post(ctx, n.client, notifyURL(trade, n.signer.Config.NotifyURL), "application/x-www-form-urlencoded;charset=utf-8", []byte(values.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK || strings.TrimSpace(body) != "success" {
+		return fmt.Errorf("merchant replied %d %q", status, body)
+	}
+	return nil
+}
+
+// AlipayTradeStatus 将模拟交易状态渲染为支付宝交易状态。
+func AlipayTradeStatus(status domain.TradeStatus) string {
+	switch status {
+	case domain.TradeSuccess:
+		return "TRADE_SUCCESS"
+	case domain.TradeFailed, domain.TradeClosed:
+		return "TRADE_CLOSED"
+	default:
+		return "WAIT_BUYER_PAY"
+	}
+}
+
+// notifyURL 优先使用下单时指定的回调地址。
+func notifyURL(trade *domain.Trade, fallback string) string {
+	if trade.NotifyURL != "" {
+		return trade.NotifyURL
+	}
+	return fallback
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// notifyTimeout 单次回调超时。
+const notifyTimeout = 5 * time.Second
+
+// post 投递回调并返回应答状态与正文 (截断至 1 KB)。
+func post(ctx context.Context, client *http.Client, url, contentType string, body []byte, header http.Header) (int, string, error) {
+	if url == "" {
+		return 0, "", fmt.Errorf("notify url is not configured")
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(body)))
+	if err != nil {
+		return 0, "", err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return resp.StatusCode, string(respBody), nil
+}
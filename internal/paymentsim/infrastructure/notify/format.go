@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BeijingTime 支付宝与微信支付的报文时间均为北京时间。
+var BeijingTime = time.FixedZone("CST", 8*3600)
+
+// FormatAmount 将分格式化为 "88.00" 形式的元。
+func FormatAmount(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	s := strconv.FormatInt(amount, 10)
+	if len(s) < 3 {
+		s = strings.Repeat("0", 3-len(s)) + s
+	}
+	return sign + s[:len(s)-2] + "." + s[len(s)-2:]
+}
+
+// ParseAmount 将 "88.00" 形式的元解析为分。
+func ParseAmount(amount string) (int64, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	if len(frac) > 2 {
+		return 0, strconv.ErrSyntax
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	yuan, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	fen, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil || yuan < 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return yuan*100 + fen, nil
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/domain"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/infrastructure/signer"
+)
+
+// StripeNotifier Stripe Webhook 事件投递，端点应答 2xx 视为确认。
+type StripeNotifier struct {
+	signer *signer.Stripe
+	client *http.Client
+}
+
+// NewStripeNotifier 创建 Stripe Webhook 投递器。
+func NewStripeNotifier(s *signer.Stripe, client *http.Client) *StripeNotifier {
+	return &StripeNotifier{signer: s, client: client}
+}
+
+func (n *StripeNotifier) Gateway() domain.Gateway { return domain.GatewayStripe }
+
+// StripeIntent 渲染 PaymentIntent 对象。
+func StripeIntent(trade *domain.Trade) map[string]any {
+	intent := map[string]any{
+		"id":              trade.TransactionID,
+		"object":          "payment_intent",
+		"amount":          trade.Amount,
+		"amount_received": int64(0),
+		"currency":        strings.ToLower(trade.Currency),
+		"status":          StripeIntentStatus(trade.Status),
+		"client_secret":   trade.TransactionID + "_secret_sim",
+		"capture_method":  "automatic",
+		"created":         trade.CreatedAt.Unix(),
+		"description":     trade.Description,
+		"metadata":        map[string]string{"payment_no": trade.PaymentNo},
+		"livemode":        false,
+	}
+	if trade.Status == domain.TradeSuccess {
+		intent["amount_received"] = trade.PaidAmount
+	}
+	if trade.Status == domain.TradeFailed {
+		intent["last_payment_error"] = map[string]string{"type": "card_error", "code": "card_declined", "message": "Your card was declined."}
+	}
+	return intent
+}
+
+// Notify 投递 payment_intent.succeeded / payment_intent.payment_failed 事件。
+func (n *StripeNotifier) Notify(ctx context.Context, trade *domain.Trade) error {
+	eventType := "payment_intent.succeeded"
+	switch trade.Status {
+	case domain.TradeFailed:
+		eventType = "payment_intent.payment_failed"
+	case domain.TradeClosed:
+		eventType = "payment_intent.canceled"
+	}
+	event := map[string]any{
+		"id":          fmt.Sprintf("evt_sim_%d", time.Now().UnixNano()),
+		"object":      "event",
+		"api_version": "2024-06-20",
+		"created":     time.Now().Unix(),
+		"type":        eventType,
+		"livemode":    false,
+		"data":        map[string]any{"object": StripeIntent(trade)},
+	}
+	if n.signer.Config.AccountID != "" {
+		event["account"] = n.signer.Config.AccountID
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Stripe-Signature", n.signer.SignatureHeader(body))
+	status, respBody, err := post(ctx, n.client, notifyURL(trade, n.signer.Config.WebhookURL), "application/json", body, header)
+	if err != nil {
+		return err
+	}
+	if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		return fmt.Errorf("endpoint replied %d %q", status, respBody)
+	}
+	return nil
+}
+
+// StripeIntentStatus 将模拟交易状态渲染为 PaymentIntent 状态。
+func StripeIntentStatus(status domain.TradeStatus) string {
+	switch status {
+	case domain.TradeSuccess:
+		return "succeeded"
+	case domain.TradeClosed:
+		return "canceled"
+	default:
+		return "requires_payment_method"
+	}
+}
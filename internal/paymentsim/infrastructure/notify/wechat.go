@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/domain"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/infrastructure/signer"
+)
+
+// WechatNotifier 微信支付 APIv3 支付结果通知，商户应答 2xx 视为确认。
+type WechatNotifier struct {
+	signer *signer.Wechat
+	client *http.Client
+}
+
+// NewWechatNotifier 创建微信支付通知投递器。
+func NewWechatNotifier(s *signer.Wechat, client *http.Client) *WechatNotifier {
+	return &WechatNotifier{signer: s, client: client}
+}
+
+func (n *WechatNotifier) Gateway() domain.Gateway { return domain.GatewayWechat }
+
+// WechatTransaction 渲染查询应答与通知资源共用的交易对象。
+func WechatTransaction(cfg signer.WechatConfig, trade *domain.Trade) map[string]any {
+	txn := map[string]any{
+		"appid":        cfg.AppID,
+		"mchid":        cfg.MchID,
+		"out_trade_no": trade.PaymentNo,
+		"trade_type":   "NATIVE",
+		"trade_state":  WechatTradeState(trade.Status),
+		"amount": map[string]any{
+			"total":          trade.ReportedAmount(),
+			"payer_total":    trade.ReportedAmount(),
+			"currency":       trade.Currency,
+			"payer_currency": trade.Currency,
+		},
+	}
+	if trade.Status == domain.TradeSuccess {
+		txn["transaction_id"] = trade.TransactionID
+		txn["success_time"] = trade.PaidAt.In(BeijingTime).Format(time.RFC3339)
+	}
+	return txn
+}
+
+// Notify 加密交易资源、以平台私钥签名后投递。
+func (n *WechatNotifier) Notify(ctx context.Context, trade *domain.Trade) error {
+	plaintext, err := json.Marshal(WechatTransaction(n.signer.Config, trade))
+	if err != nil {
+		return err
+	}
+	nonce, ciphertext := n.signer.Encrypt(plaintext, "transaction")
+
+	eventType, summary := "TRANSACTION.SUCCESS", "支付成功"
+	if trade.Status != domain.TradeSuccess {
+		eventType, summary = "TRANSACTION.FAIL", "支付失败"
+	}
+	body, err := json.Marshal(map[string]any{
+		"id":            fmt.Sprintf("EV-%d", time.Now().UnixNano()),
+		"create_time":   time.Now().In(BeijingTime).Format(time.RFC3339),
+		"event_type":    eventType,
+		"resource_type": "encrypt-resource",
+		"summary":       summary,
+		"resource": map[string]string{
+			"algorithm":       "AEAD_AES_256_GCM",
+			"ciphertext":      ciphertext,
+			"associated_data": "transaction",
+			"nonce":           nonce,
+			"original_type":   "transaction",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	n.signer.SignHeaders(header, body)
+	status, respBody, err := post(ctx, n.client, notifyURL(trade, n.signer.Config.NotifyURL), "application/json", body, header)
+	if err != nil {
+		return err
+	}
+	if status < http.StatusOK || status >= http.StatusMultipleChoices {
+		return fmt.Errorf("merchant replied %d %q", status, respBody)
+	}
+	return nil
+}
+
+// WechatTradeState 将模拟交易状态渲染为微信支付交易状态。
+func WechatTradeState(status domain.TradeStatus) string {
+	switch status {
+	case domain.TradeSuccess:
+		return "SUCCESS"
+	case domain.TradeFailed:
+		return "PAYERROR"
+	case domain.TradeClosed:
+		return "CLOSED"
+	default:
+		return "NOTPAY"
+	}
+}
@@ -0,0 +1,120 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// AlipayConfig 模拟支付宝开放平台的应用配置。
+type AlipayConfig struct {
+	AppID             string `mapstructure:"app_id"`
+	SellerID          string `mapstructure:"seller_id"`
+	PrivateKey        string `mapstructure:"private_key"`         // 模拟的支付宝私钥，签名应答与通知；为空时临时生成
+	MerchantPublicKey string `mapstructure:"merchant_public_key"` // 商户应用公钥，校验请求签名；为空时生成商户密钥对
+	NotifyURL         string `mapstructure:"notify_url"`          // 请求未携带 notify_url 时的默认回调地址
+}
+
+// Alipay 支付宝 RSA2 签名与验签。
+type Alipay struct {
+	Config             AlipayConfig
+	key                *rsa.PrivateKey
+	merchantKey        *rsa.PublicKey
+	merchantPrivatePEM string
+}
+
+// NewAlipay 加载或生成支付宝侧与商户侧密钥。
+func NewAlipay(cfg AlipayConfig) (*Alipay, error) {
+	if cfg.AppID == "" {
+		cfg.AppID = "2021000000000001"
+	}
+	key, err := loadOrGenerateKey(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("alipay: invalid private_key: %w", err)
+	}
+	merchantPub, merchantPriv, err := merchantKey(cfg.MerchantPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("alipay: invalid merchant_public_key: %w", err)
+	}
+	return &Alipay{Config: cfg, key: key, merchantKey: merchantPub, merchantPrivatePEM: merchantPriv}, nil
+}
+
+// Sign 对内容做 SHA256WithRSA 签名并 Base64 编码。
+func (a *Alipay) Sign(content []byte) string {
+	digest := sha256.Sum256(content)
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// SignValues 为通知参数写入 sign_type 与 sign。
+func (a *Alipay) SignValues(values url.Values) {
+	values.Set("sign_type", "RSA2")
+	values.Set("sign", a.Sign([]byte(SignContent(values))))
+}
+
+// VerifyRequest 校验商户请求的 app_id 与 RSA2 签名。
+func (a *Alipay) VerifyRequest(values url.Values) error {
+	if values.Get("app_id") != a.Config.AppID {
+		return fmt.Errorf("unknown app_id %q", values.Get("app_id"))
+	}
+	if values.Get("sign_type") != "RSA2" {
+		return errors.New("unsupported sign_type")
+	}
+	sig, err := base64.StdEncoding.DecodeString(values.Get("sign"))
+	if err != nil || len(sig) == 0 {
+		return errors.New("missing or malformed sign")
+	}
+	digest := sha256.Sum256([]byte(SignContent(values)))
+	return rsa.VerifyPKCS1v15(a.merchantKey, crypto.SHA256, digest[:], sig)
+}
+
+// ChannelConfig 导出支付服务 ChannelConfig.ConfigJSON 所需的字段。
+func (a *Alipay) ChannelConfig(baseURL string) map[string]any {
+	cfg := map[string]any{
+		"app_id":            a.Config.AppID,
+		"alipay_public_key": publicKeyPEM(&a.key.PublicKey),
+		"notify_url":        a.Config.NotifyURL,
+		"base_url":          baseURL,
+	}
+	if a.merchantPrivatePEM != "" {
+		cfg["private_key"] = a.merchantPrivatePEM
+	}
+	return cfg
+}
+
+// NotifyConfig 导出支付服务 [gateways.alipay] 验签配置。
+func (a *Alipay) NotifyConfig() map[string]any {
+	return map[string]any{
+		"app_id":            a.Config.AppID,
+		"seller_id":         a.Config.SellerID,
+		"alipay_public_key": publicKeyPEM(&a.key.PublicKey),
+	}
+}
+
+// SignContent 构造待签名串：除 sign、sign_type 外的非空参数按键排序后以 & 拼接。
+func SignContent(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if k == "sign" || k == "sign_type" || values.Get(k) == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(k + "=" + values.Get(k))
+	}
+	return sb.String()
+}
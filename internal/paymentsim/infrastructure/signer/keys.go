@@ -0,0 +1,102 @@
+package signer
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// loadOrGenerateKey 解析 PEM/Base64 私钥；未配置时生成临时 RSA-2048 密钥，模拟器重启后需重新导出凭据。
+func loadOrGenerateKey(key string) (*rsa.PrivateKey, error) {
+	if strings.TrimSpace(key) == "" {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	var der []byte
+	if block, _ := pem.Decode([]byte(key)); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key encoding: %w", err)
+		}
+		der = decoded
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		rsaKey, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("private key is not RSA")
+		}
+		return rsaKey, nil
+	}
+	return x509.ParsePKCS1PrivateKey(der)
+}
+
+// parsePublicKey 解析 PEM 公钥、PEM 证书或 Base64 DER 公钥。
+func parsePublicKey(key string) (*rsa.PublicKey, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(key)); block != nil {
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			pub, ok := cert.PublicKey.(*rsa.PublicKey)
+			if !ok {
+				return nil, errors.New("certificate does not contain an RSA public key")
+			}
+			return pub, nil
+		}
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key encoding: %w", err)
+		}
+		der = decoded
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not RSA")
+	}
+	return rsaPub, nil
+}
+
+// merchantKey 解析商户公钥用于请求验签；未配置时生成商户密钥对，私钥随凭据导出供支付服务签名。
+func merchantKey(publicKey string) (pub *rsa.PublicKey, privatePEM string, err error) {
+	if strings.TrimSpace(publicKey) != "" {
+		pub, err = parsePublicKey(publicKey)
+		return pub, "", err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, "", err
+	}
+	return &key.PublicKey, privateKeyPEM(key), nil
+}
+
+func privateKeyPEM(key *rsa.PrivateKey) string {
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func publicKeyPEM(key *rsa.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// randomString 生成 n 字节随机数的十六进制串。
+func randomString(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,74 @@
+package signer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StripeConfig 模拟 Stripe 账户配置。
+type StripeConfig struct {
+	SecretKey     string `mapstructure:"secret_key"`     // API 密钥 (sk_test_...)，为空时临时生成
+	AccountID     string `mapstructure:"account_id"`     // Connect 子账户，非空时要求请求携带一致的 Stripe-Account
+	WebhookSecret string `mapstructure:"webhook_secret"` // Webhook 签名密钥 (whsec_...)，为空时临时生成
+	WebhookURL    string `mapstructure:"webhook_url"`    // Webhook 投递地址
+}
+
+// Stripe API 密钥校验与 Webhook 签名。
+type Stripe struct {
+	Config StripeConfig
+}
+
+// NewStripe 补全缺省的 API 密钥与 Webhook 密钥。
+func NewStripe(cfg StripeConfig) *Stripe {
+	if cfg.SecretKey == "" {
+		cfg.SecretKey = "sk_test_sim_" + randomString(12)
+	}
+	if cfg.WebhookSecret == "" {
+		cfg.WebhookSecret = "whsec_sim_" + randomString(16)
+	}
+	return &Stripe{Config: cfg}
+}
+
+// Authorize 校验 Bearer 密钥与 Stripe-Account 头。
+func (s *Stripe) Authorize(r *http.Request) error {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.Config.SecretKey)) != 1 {
+		return errors.New("invalid api key provided")
+	}
+	if account := r.Header.Get("Stripe-Account"); account != s.Config.AccountID {
+		return fmt.Errorf("unknown account %q", account)
+	}
+	return nil
+}
+
+// SignatureHeader 生成 Stripe-Signature 头：t={timestamp},v1=HMAC-SHA256(secret, "{t}.{body}")。
+func (s *Stripe) SignatureHeader(body []byte) string {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(s.Config.WebhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ChannelConfig 导出支付服务 ChannelConfig.ConfigJSON 所需的字段。
+func (s *Stripe) ChannelConfig(baseURL string) map[string]any {
+	return map[string]any{
+		"secret_key": s.Config.SecretKey,
+		"account_id": s.Config.AccountID,
+		"base_url":   baseURL,
+	}
+}
+
+// NotifyConfig 导出支付服务 [gateways.stripe] 验签配置。
+func (s *Stripe) NotifyConfig() map[string]any {
+	return map[string]any{
+		"account_id":     s.Config.AccountID,
+		"webhook_secret": s.Config.WebhookSecret,
+	}
+}
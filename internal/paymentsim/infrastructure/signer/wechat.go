@@ -0,0 +1,204 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WechatConfig 模拟微信支付 APIv3 的商户与平台配置。
+type WechatConfig struct {
+	AppID             string `mapstructure:"app_id"`
+	MchID             string `mapstructure:"mch_id"`
+	APIv3Key          string `mapstructure:"api_v3_key"`           // 32 字节 APIv3 密钥，为空时临时生成
+	PlatformKey       string `mapstructure:"platform_private_key"` // 平台私钥，签名应答与通知
+	PlatformCert      string `mapstructure:"platform_cert"`        // 与平台私钥对应的证书，为空时自签发
+	MerchantPublicKey string `mapstructure:"merchant_public_key"`  // 商户 API 证书公钥，校验请求签名；为空时生成商户密钥对
+	MerchantSerialNo  string `mapstructure:"merchant_serial_no"`
+	NotifyURL         string `mapstructure:"notify_url"`
+}
+
+// Wechat 微信支付 APIv3 签名、验签与通知资源加密。
+type Wechat struct {
+	Config             WechatConfig
+	key                *rsa.PrivateKey
+	certPEM            string
+	serial             string
+	aead               cipher.AEAD
+	merchantKey        *rsa.PublicKey
+	merchantPrivatePEM string
+}
+
+// NewWechat 加载或生成平台证书、APIv3 密钥与商户密钥。
+func NewWechat(cfg WechatConfig) (*Wechat, error) {
+	if cfg.AppID == "" {
+		cfg.AppID = "wx0000000000000001"
+	}
+	if cfg.MchID == "" {
+		cfg.MchID = "1900000001"
+	}
+	if cfg.MerchantSerialNo == "" {
+		cfg.MerchantSerialNo = "SIMMERCHANTSERIAL"
+	}
+	if cfg.APIv3Key == "" {
+		cfg.APIv3Key = randomString(16)
+	}
+	if len(cfg.APIv3Key) != 32 {
+		return nil, errors.New("wechat: api_v3_key must be 32 bytes")
+	}
+	block, err := aes.NewCipher([]byte(cfg.APIv3Key))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := loadOrGenerateKey(cfg.PlatformKey)
+	if err != nil {
+		return nil, fmt.Errorf("wechat: invalid platform_private_key: %w", err)
+	}
+	certPEM := cfg.PlatformCert
+	if certPEM == "" {
+		if certPEM, err = selfSignedCert(key, "Tenpay.com Root CA Simulator"); err != nil {
+			return nil, err
+		}
+	}
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	if certBlock == nil {
+		return nil, errors.New("wechat: platform_cert must be PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("wechat: invalid platform_cert: %w", err)
+	}
+
+	merchantPub, merchantPriv, err := merchantKey(cfg.MerchantPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("wechat: invalid merchant_public_key: %w", err)
+	}
+	return &Wechat{
+		Config:             cfg,
+		key:                key,
+		certPEM:            certPEM,
+		serial:             strings.ToUpper(cert.SerialNumber.Text(16)),
+		aead:               aead,
+		merchantKey:        merchantPub,
+		merchantPrivatePEM: merchantPriv,
+	}, nil
+}
+
+// SignHeaders 以平台私钥签名应答或通知，写入 Wechatpay-* 头。
+func (w *Wechat) SignHeaders(h http.Header, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := randomString(16)
+	digest := sha256.Sum256([]byte(timestamp + "\n" + nonce + "\n" + string(body) + "\n"))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, w.key, crypto.SHA256, digest[:])
+	h.Set("Wechatpay-Serial", w.serial)
+	h.Set("Wechatpay-Timestamp", timestamp)
+	h.Set("Wechatpay-Nonce", nonce)
+	h.Set("Wechatpay-Signature", base64.StdEncoding.EncodeToString(sig))
+	h.Set("Wechatpay-Signature-Type", "WECHATPAY2-SHA256-RSA2048")
+}
+
+// VerifyRequest 校验 Authorization 头：签名串为 "{METHOD}\n{URI}\n{timestamp}\n{nonce}\n{body}\n"。
+func (w *Wechat) VerifyRequest(r *http.Request, body []byte) error {
+	scheme, params, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || scheme != "WECHATPAY2-SHA256-RSA2048" {
+		return errors.New("unsupported authorization scheme")
+	}
+	fields := make(map[string]string)
+	for part := range strings.SplitSeq(params, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			fields[k] = strings.Trim(v, `"`)
+		}
+	}
+	if fields["mchid"] != w.Config.MchID {
+		return fmt.Errorf("unknown mchid %q", fields["mchid"])
+	}
+	ts, err := strconv.ParseInt(fields["timestamp"], 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > 5*time.Minute || d < -5*time.Minute {
+		return errors.New("timestamp outside tolerance")
+	}
+	sig, err := base64.StdEncoding.DecodeString(fields["signature"])
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+	message := r.Method + "\n" + r.URL.RequestURI() + "\n" + fields["timestamp"] + "\n" + fields["nonce_str"] + "\n" + string(body) + "\n"
+	digest := sha256.Sum256([]byte(message))
+	return rsa.VerifyPKCS1v15(w.merchantKey, crypto.SHA256, digest[:], sig)
+}
+
+// Encrypt 以 APIv3 密钥 AES-256-GCM 加密通知资源，返回 12 字节 nonce 与 Base64 密文。
+func (w *Wechat) Encrypt(plaintext []byte, associatedData string) (nonce, ciphertext string) {
+	nonce = randomString(6)
+	sealed := w.aead.Seal(nil, []byte(nonce), plaintext, []byte(associatedData))
+	return nonce, base64.StdEncoding.EncodeToString(sealed)
+}
+
+// ChannelConfig 导出支付服务 ChannelConfig.ConfigJSON 所需的字段。
+func (w *Wechat) ChannelConfig(baseURL string) map[string]any {
+	cfg := map[string]any{
+		"app_id":         w.Config.AppID,
+		"mch_id":         w.Config.MchID,
+		"serial_no":      w.Config.MerchantSerialNo,
+		"api_v3_key":     w.Config.APIv3Key,
+		"platform_certs": []string{w.certPEM},
+		"notify_url":     w.Config.NotifyURL,
+		"base_url":       baseURL,
+	}
+	if w.merchantPrivatePEM != "" {
+		cfg["private_key"] = w.merchantPrivatePEM
+	}
+	return cfg
+}
+
+// NotifyConfig 导出支付服务 [gateways.wechat] 验签配置。
+func (w *Wechat) NotifyConfig() map[string]any {
+	return map[string]any{
+		"app_id":         w.Config.AppID,
+		"mch_id":         w.Config.MchID,
+		"api_v3_key":     w.Config.APIv3Key,
+		"platform_certs": []string{w.certPEM},
+	}
+}
+
+// selfSignedCert 为平台私钥签发一年有效期的自签名证书。
+func selfSignedCert(key *rsa.PrivateKey, commonName string) (string, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Payment Simulator"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), nil
+}
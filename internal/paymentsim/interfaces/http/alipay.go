@@ -0,0 +1,277 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/domain"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/infrastructure/notify"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// alipayError 支付宝业务错误 (code 40004) 或系统错误。
+type alipayError struct {
+	code    string
+	subCode string
+	subMsg  string
+}
+
+func (e *alipayError) body() map[string]any {
+	msg := "Business Failed"
+	if e.code != "40004" {
+		msg = "Invalid Arguments"
+	}
+	return map[string]any{"code": e.code, "msg": msg, "sub_code": e.subCode, "sub_msg": e.subMsg}
+}
+
+func alipayBizError(subCode, subMsg string) *alipayError {
+	return &alipayError{code: "40004", subCode: subCode, subMsg: subMsg}
+}
+
+// AlipayGateway 开放平台网关，按 method 分发；应答节点为 {method}_response，并以支付宝私钥签名。
+func (h *Handler) AlipayGateway(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		c.String(http.StatusBadRequest, "malformed form")
+		return
+	}
+	values := c.Request.PostForm
+	method := values.Get("method")
+
+	var (
+		result map[string]any
+		apiErr *alipayError
+	)
+	if err := h.alipay.VerifyRequest(values); err != nil {
+		apiErr = &alipayError{code: "40002", subCode: "isv.invalid-signature", subMsg: err.Error()}
+	} else {
+		var biz map[string]string
+		if err := json.Unmarshal([]byte(values.Get("biz_content")), &biz); err != nil {
+			apiErr = &alipayError{code: "40002", subCode: "isv.invalid-parameter", subMsg: "malformed biz_content"}
+		} else {
+			result, apiErr = h.alipayDispatch(c, method, biz, values.Get("notify_url"))
+		}
+	}
+
+	node := result
+	if apiErr != nil {
+		node = apiErr.body()
+		h.logger.WarnContext(c.Request.Context(), "alipay request rejected", "method", method, "sub_code", apiErr.subCode, "sub_msg", apiErr.subMsg)
+	} else {
+		node["code"], node["msg"] = "10000", "Success"
+	}
+	raw, _ := json.Marshal(node)
+	envelope := fmt.Sprintf(`{"%s_response":%s,"sign":"%s"}`, strings.ReplaceAll(method, ".", "_"), raw, h.alipay.Sign(raw))
+	c.Data(http.StatusOK, "application/json;charset=utf-8", []byte(envelope))
+}
+
+// alipayDispatch 执行各接口的业务逻辑。业务参数中金额为字符串形式的元，均按字符串解析。
+func (h *Handler) alipayDispatch(c *gin.Context, method string, biz map[string]string, notifyURL string) (map[string]any, *alipayError) {
+	ctx := c.Request.Context()
+	switch method {
+	case "alipay.trade.precreate":
+		amount, err := notify.ParseAmount(biz["total_amount"])
+		if err != nil || amount <= 0 {
+			return nil, alipayBizError("ACQ.INVALID_PARAMETER", "invalid total_amount")
+		}
+		trade, err := h.sim.CreateTrade(ctx, &domain.Trade{
+			Gateway:       domain.GatewayAlipay,
+			PaymentNo:     biz["out_trade_no"],
+			TransactionID: h.sim.NextID("2088"),
+			Amount:        amount,
+			Currency:      "CNY",
+			Description:   biz["subject"],
+			NotifyURL:     notifyURL,
+		})
+		if err != nil {
+			return nil, alipayBizError("ACQ.CONTEXT_INCONSISTENT", err.Error())
+		}
+		return map[string]any{"out_trade_no": trade.PaymentNo, "qr_code": "https://qr.alipay.com/sim" + trade.TransactionID}, nil
+
+	case "alipay.trade.query":
+		trade, apiErr := h.alipayTrade(biz)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		result := map[string]any{
+			"out_trade_no": trade.PaymentNo,
+			"trade_status": notify.AlipayTradeStatus(trade.Status),
+			"total_amount": notify.FormatAmount(trade.ReportedAmount()),
+		}
+		if trade.Status == domain.TradeSuccess {
+			result["trade_no"] = trade.TransactionID
+			result["send_pay_date"] = trade.PaidAt.In(notify.BeijingTime).Format(time.DateTime)
+		}
+		return result, nil
+
+	case "alipay.trade.close":
+		trade, apiErr := h.alipayTrade(biz)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		if _, err := h.sim.CloseTrade(domain.GatewayAlipay, trade.PaymentNo); err != nil {
+			return nil, alipayBizError("ACQ.TRADE_STATUS_ERROR", err.Error())
+		}
+		return map[string]any{"out_trade_no": trade.PaymentNo, "trade_no": trade.TransactionID}, nil
+
+	case "alipay.trade.refund":
+		trade, apiErr := h.alipayTrade(biz)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		amount, err := notify.ParseAmount(biz["refund_amount"])
+		if err != nil {
+			return nil, alipayBizError("ACQ.INVALID_PARAMETER", "invalid refund_amount")
+		}
+		refundNo := biz["out_request_no"]
+		if refundNo == "" {
+			refundNo = trade.PaymentNo
+		}
+		refund, created, err := h.sim.Refund(ctx, domain.GatewayAlipay, trade.PaymentNo, refundNo, amount, biz["refund_reason"])
+		switch {
+		case errors.Is(err, domain.ErrRefundExceeded):
+			return nil, alipayBizError("ACQ.REFUND_AMT_NOT_EQUAL_TOTAL", err.Error())
+		case errors.Is(err, domain.ErrTradeStatus):
+			return nil, alipayBizError("ACQ.TRADE_STATUS_ERROR", err.Error())
+		case err != nil:
+			return nil, alipayBizError("ACQ.SYSTEM_ERROR", err.Error())
+		case refund.Status == domain.RefundFailed:
+			return nil, alipayBizError("ACQ.SELLER_BALANCE_NOT_ENOUGH", domain.ErrPartialRefundFailed.Error())
+		}
+		// trade 为退款前的快照，本次新建的退款需计入累计退款金额
+		fundChange, refunded := "N", trade.Refunded()
+		if created {
+			fundChange, refunded = "Y", refunded+amount
+		}
+		return map[string]any{
+			"trade_no":       trade.TransactionID,
+			"out_trade_no":   trade.PaymentNo,
+			"refund_fee":     notify.FormatAmount(refunded),
+			"fund_change":    fundChange,
+			"gmt_refund_pay": refund.CreatedAt.In(notify.BeijingTime).Format(time.DateTime),
+		}, nil
+
+	case "alipay.trade.fastpay.refund.query":
+		trade, apiErr := h.alipayTrade(biz)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		result := map[string]any{"trade_no": trade.TransactionID, "out_trade_no": trade.PaymentNo, "out_request_no": biz["out_request_no"]}
+		// 退款不存在或未成功时不返回 refund_status
+		if _, refund, err := h.sim.FindRefund(domain.GatewayAlipay, biz["out_request_no"]); err == nil && refund.Status == domain.RefundSuccess {
+			result["refund_status"] = "REFUND_SUCCESS"
+			result["refund_amount"] = notify.FormatAmount(refund.Amount)
+			result["total_amount"] = notify.FormatAmount(trade.PaidAmount)
+		}
+		return result, nil
+
+	case "alipay.data.dataservice.bill.downloadurl.query":
+		if _, _, err := billDay(biz["bill_date"], notify.BeijingTime); err != nil {
+			return nil, alipayBizError("isv.invalid-bill-date", "bill_date must be yyyy-MM-dd")
+		}
+		return map[string]any{"bill_download_url": h.publicURL + "/sim/bills/alipay/" + biz["bill_date"]}, nil
+
+	default:
+		return nil, &alipayError{code: "40002", subCode: "isv.invalid-method", subMsg: "unsupported method " + method}
+	}
+}
+
+// alipayTrade 按 trade_no 或 out_trade_no 定位交易。
+func (h *Handler) alipayTrade(biz map[string]string) (*domain.Trade, *alipayError) {
+	var (
+		trade *domain.Trade
+		err   error
+	)
+	if no := biz["out_trade_no"]; no != "" {
+		trade, err = h.sim.Trade(domain.GatewayAlipay, no)
+	} else {
+		trade, err = h.sim.TradeByTransaction(domain.GatewayAlipay, biz["trade_no"])
+	}
+	if err != nil {
+		return nil, alipayBizError("ACQ.TRADE_NOT_EXIST", "交易不存在")
+	}
+	return trade, nil
+}
+
+// AlipayBillFile 下载账单：zip 内含 GBK 编码的业务明细与汇总 CSV。
+func (h *Handler) AlipayBillFile(c *gin.Context) {
+	date := c.Param("date")
+	from, to, err := billDay(date, notify.BeijingTime)
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid bill date")
+		return
+	}
+	trades := h.sim.BillTrades(domain.GatewayAlipay, from, to)
+
+	inDay := func(t *time.Time) bool { return t != nil && !t.Before(from) && t.Before(to) }
+	var (
+		detail             bytes.Buffer
+		payCount, refCount int
+		payTotal, refTotal int64
+	)
+	detail.WriteString("#支付宝业务明细查询\n#账号：[" + h.alipay.Config.SellerID + "]\n#起始日期：[" + date + " 00:00:00]   终止日期：[" + date + " 23:59:59]\n")
+	detail.WriteString("#-----------------------------------------业务明细列表----------------------------------------\n")
+	w := csv.NewWriter(&detail)
+	_ = w.Write([]string{"支付宝交易号", "商户订单号", "业务类型", "商品名称", "创建时间", "完成时间", "门店编号", "门店名称", "操作员", "终端号", "对方账户", "订单金额（元）", "商家实收（元）", "支付宝红包（元）", "集分宝（元）", "支付宝优惠（元）", "商家优惠（元）", "券核销金额（元）", "券名称", "商家红包消费金额（元）", "卡消费金额（元）", "退款批次号/请求号", "服务费（元）", "分润（元）", "备注"})
+	for _, t := range trades {
+		created := t.CreatedAt.In(notify.BeijingTime).Format(time.DateTime)
+		if inDay(t.PaidAt) {
+			payCount++
+			payTotal += t.PaidAmount
+			_ = w.Write(alipayBillRow(t.TransactionID, t.PaymentNo, "交易", t.Description, created, t.PaidAt, t.PaidAmount, t.PaidAmount, ""))
+		}
+		for _, r := range t.Refunds {
+			if inDay(r.RefundedAt) {
+				refCount++
+				refTotal += r.Amount
+				_ = w.Write(alipayBillRow(t.TransactionID, t.PaymentNo, "退款", t.Description, created, r.RefundedAt, t.PaidAmount, -r.Amount, r.RefundNo))
+			}
+		}
+	}
+	w.Flush()
+	detail.WriteString("#-----------------------------------------业务明细列表结束------------------------------------\n")
+	detail.WriteString(fmt.Sprintf("#交易合计：%d笔，商家实收共%s元\n#退款合计：%d笔，商家实收退款共%s元\n", payCount, notify.FormatAmount(payTotal), refCount, notify.FormatAmount(refTotal)))
+	detail.WriteString("#导出时间：[" + time.Now().In(notify.BeijingTime).Format(time.DateTime) + "]\n")
+
+	summary := fmt.Sprintf("#支付宝业务汇总查询\n门店编号,门店名称,交易订单总笔数,退款订单总笔数,订单金额（元）,商家实收（元）\n,合计,%d,%d,%s,%s\n",
+		payCount, refCount, notify.FormatAmount(payTotal), notify.FormatAmount(payTotal-refTotal))
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	prefix := h.alipay.Config.AppID + "_" + strings.ReplaceAll(date, "-", "")
+	for name, content := range map[string]string{
+		prefix + "_业务明细.csv":     detail.String(),
+		prefix + "_业务明细(汇总).csv": summary,
+	} {
+		encoded, err := simplifiedchinese.GBK.NewEncoder().String(content)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "failed to encode bill")
+			return
+		}
+		f, _ := zw.Create(name)
+		_, _ = f.Write([]byte(encoded))
+	}
+	_ = zw.Close()
+
+	c.Header("Content-Disposition", `attachment; filename="`+prefix+`.csv.zip"`)
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
+
+func alipayBillRow(tradeNo, paymentNo, bizType, subject, created string, completed *time.Time, orderAmount, received int64, refundNo string) []string {
+	row := make([]string, 25)
+	row[0], row[1], row[2], row[3], row[4] = tradeNo, paymentNo, bizType, subject, created
+	row[5] = completed.In(notify.BeijingTime).Format(time.DateTime)
+	row[11], row[12] = notify.FormatAmount(orderAmount), notify.FormatAmount(received)
+	row[21] = refundNo
+	for _, i := range []int{13, 14, 15, 16, 17, 19, 20, 22, 23} {
+		row[i] = "0.00"
+	}
+	return row
+}
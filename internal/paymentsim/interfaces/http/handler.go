@@ -0,0 +1,214 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/application"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/domain"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/infrastructure/signer"
+	"github.com/wyfcoding/pkg/response"
+)
+
+// Handler 渠道模拟器 HTTP 处理器。渠道接口按各自协议应答，/sim 下为测试控制接口。
+type Handler struct {
+	sim       *application.Simulator
+	alipay    *signer.Alipay
+	wechat    *signer.Wechat
+	stripe    *signer.Stripe
+	publicURL string // 模拟器对外地址，用于生成渠道 base_url 与账单下载地址
+	logger    *slog.Logger
+
+	stripeReplies sync.Map // Stripe Idempotency-Key -> stripeCachedReply
+}
+
+// NewHandler 创建处理器。
+func NewHandler(sim *application.Simulator, alipay *signer.Alipay, wechat *signer.Wechat, stripe *signer.Stripe, publicURL string, logger *slog.Logger) *Handler {
+	return &Handler{
+		sim:       sim,
+		alipay:    alipay,
+		wechat:    wechat,
+		stripe:    stripe,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		logger:    logger,
+	}
+}
+
+// RegisterRoutes 注册渠道接口与控制接口。
+func (h *Handler) RegisterRoutes(e *gin.Engine) {
+	e.POST("/alipay/gateway.do", h.AlipayGateway)
+
+	wx := e.Group("/wechat/v3")
+	{
+		wx.POST("/pay/transactions/native", h.WechatNativeOrder)
+		wx.GET("/pay/transactions/out-trade-no/:no", h.WechatQueryOrder)
+		wx.POST("/pay/transactions/out-trade-no/:no/close", h.WechatCloseOrder)
+		wx.POST("/refund/domestic/refunds", h.WechatRefund)
+		wx.GET("/refund/domestic/refunds/:no", h.WechatQueryRefund)
+		wx.GET("/bill/tradebill", h.WechatTradeBill)
+		wx.GET("/billdownload/file", h.WechatDownloadBill)
+	}
+
+	st := e.Group("/stripe/v1")
+	{
+		st.POST("/payment_intents", h.StripeCreateIntent)
+		st.GET("/payment_intents/:id", h.StripeGetIntent)
+		st.POST("/payment_intents/:id/capture", h.StripeCaptureIntent)
+		st.POST("/payment_intents/:id/cancel", h.StripeCancelIntent)
+		st.POST("/refunds", h.StripeCreateRefund)
+		st.GET("/refunds", h.StripeListRefunds)
+		st.GET("/refunds/:id", h.StripeGetRefund)
+		st.GET("/balance_transactions", h.StripeBalanceTransactions)
+	}
+
+	sim := e.Group("/sim")
+	{
+		sim.GET("/credentials", h.Credentials)
+		sim.GET("/scenarios", h.GetScenario)
+		sim.PUT("/scenarios", h.SetScenario)
+		sim.DELETE("/scenarios/:payment_no", h.ClearScenario)
+		sim.GET("/trades/:gateway/:payment_no", h.GetTrade)
+		sim.POST("/trades/:gateway/:payment_no/pay", h.PayTrade)
+		sim.POST("/trades/:gateway/:payment_no/notify", h.ResendNotify)
+		sim.GET("/bills/alipay/:date", h.AlipayBillFile)
+	}
+}
+
+// Credentials 导出支付服务接入模拟器所需的渠道配置 (ChannelConfig) 与通知验签配置 ([gateways])。
+func (h *Handler) Credentials(c *gin.Context) {
+	response.SuccessWithStatus(c, http.StatusOK, "success", gin.H{
+		"channels": []gin.H{
+			{"code": "alipay_sim", "type": domain.GatewayAlipay, "config_json": configJSON(h.alipay.ChannelConfig(h.publicURL + "/alipay/gateway.do"))},
+			{"code": "wechat_sim", "type": domain.GatewayWechat, "config_json": configJSON(h.wechat.ChannelConfig(h.publicURL + "/wechat"))},
+			{"code": "stripe_sim", "type": domain.GatewayStripe, "config_json": configJSON(h.stripe.ChannelConfig(h.publicURL + "/stripe"))},
+		},
+		"gateways": gin.H{
+			"alipay": h.alipay.NotifyConfig(),
+			"wechat": h.wechat.NotifyConfig(),
+			"stripe": h.stripe.NotifyConfig(),
+		},
+	})
+}
+
+// scenarioRequest 场景设置请求，payment_no 为空时设置默认场景；时长为 Go duration 字符串 (如 "3s")。
+type scenarioRequest struct {
+	PaymentNo         string `json:"payment_no"`
+	AutoPay           bool   `json:"auto_pay"`
+	PayDelay          string `json:"pay_delay"`
+	PayFail           bool   `json:"pay_fail"`
+	CallbackDelay     string `json:"callback_delay"`
+	CallbackCount     int    `json:"callback_count"`
+	SuppressCallback  bool   `json:"suppress_callback"`
+	AmountDelta       int64  `json:"amount_delta"`
+	FailPartialRefund bool   `json:"fail_partial_refund"`
+}
+
+// SetScenario 设置场景。
+func (h *Handler) SetScenario(c *gin.Context) {
+	var req scenarioRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid request body: "+err.Error(), "")
+		return
+	}
+	sc := domain.Scenario{
+		AutoPay:           req.AutoPay,
+		PayFail:           req.PayFail,
+		CallbackCount:     req.CallbackCount,
+		SuppressCallback:  req.SuppressCallback,
+		AmountDelta:       req.AmountDelta,
+		FailPartialRefund: req.FailPartialRefund,
+	}
+	var err error
+	if sc.PayDelay, err = parseDuration(req.PayDelay); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid pay_delay", err.Error())
+		return
+	}
+	if sc.CallbackDelay, err = parseDuration(req.CallbackDelay); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "invalid callback_delay", err.Error())
+		return
+	}
+
+	h.sim.SetScenario(req.PaymentNo, sc)
+	h.logger.InfoContext(c.Request.Context(), "scenario updated", "payment_no", req.PaymentNo, "scenario", sc)
+	response.SuccessWithStatus(c, http.StatusOK, "success", sc)
+}
+
+// GetScenario 查询商户订单号生效的场景，未指定时返回默认场景。
+func (h *Handler) GetScenario(c *gin.Context) {
+	response.SuccessWithStatus(c, http.StatusOK, "success", h.sim.Scenario(c.Query("payment_no")))
+}
+
+// ClearScenario 删除商户订单号的专属场景。
+func (h *Handler) ClearScenario(c *gin.Context) {
+	h.sim.ClearScenario(c.Param("payment_no"))
+	response.SuccessWithStatus(c, http.StatusOK, "success", nil)
+}
+
+// GetTrade 查询模拟交易。
+func (h *Handler) GetTrade(c *gin.Context) {
+	trade, err := h.sim.Trade(domain.Gateway(c.Param("gateway")), c.Param("payment_no"))
+	if err != nil {
+		h.simError(c, err)
+		return
+	}
+	response.SuccessWithStatus(c, http.StatusOK, "success", trade)
+}
+
+// PayTrade 模拟用户完成支付 (扫码/确认)，结果与回调按场景执行。
+func (h *Handler) PayTrade(c *gin.Context) {
+	trade, err := h.sim.Pay(c.Request.Context(), domain.Gateway(c.Param("gateway")), c.Param("payment_no"))
+	if err != nil {
+		h.simError(c, err)
+		return
+	}
+	response.SuccessWithStatus(c, http.StatusOK, "success", trade)
+}
+
+// ResendNotify 立即按当前状态重发一次回调。
+func (h *Handler) ResendNotify(c *gin.Context) {
+	if err := h.sim.Notify(c.Request.Context(), domain.Gateway(c.Param("gateway")), c.Param("payment_no")); err != nil {
+		h.simError(c, err)
+		return
+	}
+	response.SuccessWithStatus(c, http.StatusOK, "success", nil)
+}
+
+// simError 控制接口错误映射。
+func (h *Handler) simError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domain.ErrTradeNotFound):
+		response.ErrorWithStatus(c, http.StatusNotFound, err.Error(), "")
+	case errors.Is(err, domain.ErrTradeStatus):
+		response.ErrorWithStatus(c, http.StatusConflict, err.Error(), "")
+	default:
+		response.ErrorWithStatus(c, http.StatusBadGateway, "callback failed", err.Error())
+	}
+}
+
+// configJSON 序列化为可直接写入 ChannelConfig.ConfigJSON 的字符串。
+func configJSON(cfg map[string]any) string {
+	b, _ := json.Marshal(cfg)
+	return string(b)
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// billDay 解析 yyyy-MM-dd 账单日期，返回该日在 loc 时区的起止时间。
+func billDay(date string, loc *time.Location) (time.Time, time.Time, error) {
+	day, err := time.ParseInLocation(time.DateOnly, date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return day, day.AddDate(0, 0, 1), nil
+}
@@ -0,0 +1,273 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/domain"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/infrastructure/notify"
+)
+
+// stripeCachedReply 带 Idempotency-Key 的写请求应答，重放时原样返回。
+type stripeCachedReply struct {
+	status int
+	body   any
+}
+
+// stripeError 输出 Stripe 错误应答。
+func (h *Handler) stripeError(c *gin.Context, status int, errType, code, message string) {
+	h.logger.WarnContext(c.Request.Context(), "stripe request rejected", "path", c.Request.URL.Path, "type", errType, "code", code, "message", message)
+	c.JSON(status, gin.H{"error": gin.H{"type": errType, "code": code, "message": message}})
+}
+
+// stripeAuth 校验 API 密钥；带 Idempotency-Key 的重放请求直接返回缓存应答。
+func (h *Handler) stripeAuth(c *gin.Context) bool {
+	if err := h.stripe.Authorize(c.Request); err != nil {
+		h.stripeError(c, http.StatusUnauthorized, "authentication_error", "", err.Error())
+		return false
+	}
+	if key := c.GetHeader("Idempotency-Key"); key != "" && c.Request.Method == http.MethodPost {
+		if cached, ok := h.stripeReplies.Load(key); ok {
+			reply := cached.(stripeCachedReply)
+			c.Header("Idempotent-Replayed", "true")
+			c.JSON(reply.status, reply.body)
+			return false
+		}
+	}
+	return true
+}
+
+// stripeReply 输出应答并按 Idempotency-Key 缓存。
+func (h *Handler) stripeReply(c *gin.Context, body any) {
+	if key := c.GetHeader("Idempotency-Key"); key != "" && c.Request.Method == http.MethodPost {
+		h.stripeReplies.Store(key, stripeCachedReply{status: http.StatusOK, body: body})
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+func (h *Handler) stripeIntent(c *gin.Context) (*domain.Trade, bool) {
+	trade, err := h.sim.TradeByTransaction(domain.GatewayStripe, c.Param("id"))
+	if err != nil {
+		h.stripeError(c, http.StatusNotFound, "invalid_request_error", "resource_missing", "No such payment_intent: '"+c.Param("id")+"'")
+		return nil, false
+	}
+	return trade, true
+}
+
+// StripeCreateIntent 创建 PaymentIntent。
+func (h *Handler) StripeCreateIntent(c *gin.Context) {
+	if !h.stripeAuth(c) {
+		return
+	}
+	amount, err := strconv.ParseInt(c.PostForm("amount"), 10, 64)
+	if err != nil || amount <= 0 {
+		h.stripeError(c, http.StatusBadRequest, "invalid_request_error", "parameter_invalid_integer", "Invalid integer: amount")
+		return
+	}
+	paymentNo := c.PostForm("metadata[payment_no]")
+	if paymentNo == "" {
+		h.stripeError(c, http.StatusBadRequest, "invalid_request_error", "parameter_missing", "metadata[payment_no] is required by the simulator")
+		return
+	}
+	trade, err := h.sim.CreateTrade(c.Request.Context(), &domain.Trade{
+		Gateway:       domain.GatewayStripe,
+		PaymentNo:     paymentNo,
+		TransactionID: h.sim.NextID("pi_sim_"),
+		Amount:        amount,
+		Currency:      strings.ToUpper(c.PostForm("currency")),
+		Description:   c.PostForm("description"),
+	})
+	if err != nil {
+		h.stripeError(c, http.StatusBadRequest, "invalid_request_error", "idempotency_error", err.Error())
+		return
+	}
+	h.stripeReply(c, notify.StripeIntent(trade))
+}
+
+// StripeGetIntent 查询 PaymentIntent。
+func (h *Handler) StripeGetIntent(c *gin.Context) {
+	if !h.stripeAuth(c) {
+		return
+	}
+	if trade, ok := h.stripeIntent(c); ok {
+		c.JSON(http.StatusOK, notify.StripeIntent(trade))
+	}
+}
+
+// StripeCaptureIntent 模拟器中的 PaymentIntent 均为自动扣款，手动扣款请求返回状态错误。
+func (h *Handler) StripeCaptureIntent(c *gin.Context) {
+	if !h.stripeAuth(c) {
+		return
+	}
+	if trade, ok := h.stripeIntent(c); ok {
+		h.stripeError(c, http.StatusBadRequest, "invalid_request_error", "payment_intent_unexpected_state",
+			"This PaymentIntent could not be captured because it has a status of "+notify.StripeIntentStatus(trade.Status)+".")
+	}
+}
+
+// StripeCancelIntent 取消 PaymentIntent。
+func (h *Handler) StripeCancelIntent(c *gin.Context) {
+	if !h.stripeAuth(c) {
+		return
+	}
+	trade, ok := h.stripeIntent(c)
+	if !ok {
+		return
+	}
+	closed, err := h.sim.CloseTrade(domain.GatewayStripe, trade.PaymentNo)
+	if err != nil {
+		h.stripeError(c, http.StatusBadRequest, "invalid_request_error", "payment_intent_unexpected_state",
+			"You cannot cancel this PaymentIntent because it has a status of succeeded.")
+		return
+	}
+	h.stripeReply(c, notify.StripeIntent(closed))
+}
+
+// stripeRefund 渲染 Refund 对象。
+func stripeRefund(trade *domain.Trade, r *domain.Refund) gin.H {
+	status := "succeeded"
+	if r.Status == domain.RefundFailed {
+		status = "failed"
+	}
+	resp := gin.H{
+		"id":             r.RefundID,
+		"object":         "refund",
+		"amount":         r.Amount,
+		"currency":       strings.ToLower(trade.Currency),
+		"payment_intent": trade.TransactionID,
+		"status":         status,
+		"reason":         r.Reason,
+		"created":        r.CreatedAt.Unix(),
+		"metadata":       gin.H{"refund_no": r.RefundNo},
+	}
+	if r.Status == domain.RefundFailed {
+		resp["failure_reason"] = "insufficient_funds"
+	}
+	return resp
+}
+
+// StripeCreateRefund 创建退款。
+func (h *Handler) StripeCreateRefund(c *gin.Context) {
+	if !h.stripeAuth(c) {
+		return
+	}
+	trade, err := h.sim.TradeByTransaction(domain.GatewayStripe, c.PostForm("payment_intent"))
+	if err != nil {
+		h.stripeError(c, http.StatusNotFound, "invalid_request_error", "resource_missing", "No such payment_intent: '"+c.PostForm("payment_intent")+"'")
+		return
+	}
+	amount := trade.PaidAmount - trade.Refunded()
+	if s := c.PostForm("amount"); s != "" {
+		if amount, err = strconv.ParseInt(s, 10, 64); err != nil {
+			h.stripeError(c, http.StatusBadRequest, "invalid_request_error", "parameter_invalid_integer", "Invalid integer: amount")
+			return
+		}
+	}
+	refundNo := c.PostForm("metadata[refund_no]")
+	if refundNo == "" {
+		refundNo = c.GetHeader("Idempotency-Key")
+	}
+	refund, _, err := h.sim.Refund(c.Request.Context(), domain.GatewayStripe, trade.PaymentNo, refundNo, amount, c.PostForm("reason"))
+	switch {
+	case errors.Is(err, domain.ErrRefundExceeded):
+		h.stripeError(c, http.StatusBadRequest, "invalid_request_error", "amount_too_large", err.Error())
+		return
+	case errors.Is(err, domain.ErrTradeStatus):
+		h.stripeError(c, http.StatusBadRequest, "invalid_request_error", "charge_not_refundable", "This PaymentIntent does not have a successful charge to refund.")
+		return
+	case err != nil:
+		h.stripeError(c, http.StatusInternalServerError, "api_error", "", err.Error())
+		return
+	}
+	h.stripeReply(c, stripeRefund(trade, refund))
+}
+
+// StripeGetRefund 查询退款。
+func (h *Handler) StripeGetRefund(c *gin.Context) {
+	if !h.stripeAuth(c) {
+		return
+	}
+	trade, refund, err := h.sim.FindRefundByID(domain.GatewayStripe, c.Param("id"))
+	if err != nil {
+		h.stripeError(c, http.StatusNotFound, "invalid_request_error", "resource_missing", "No such refund: '"+c.Param("id")+"'")
+		return
+	}
+	c.JSON(http.StatusOK, stripeRefund(trade, refund))
+}
+
+// StripeListRefunds 按 PaymentIntent 列出退款。
+func (h *Handler) StripeListRefunds(c *gin.Context) {
+	if !h.stripeAuth(c) {
+		return
+	}
+	data := []gin.H{}
+	if trade, err := h.sim.TradeByTransaction(domain.GatewayStripe, c.Query("payment_intent")); err == nil {
+		for i := len(trade.Refunds) - 1; i >= 0; i-- {
+			data = append(data, stripeRefund(trade, trade.Refunds[i]))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "url": "/v1/refunds", "has_more": false, "data": data})
+}
+
+// StripeBalanceTransactions 列出 created[gte, lt) 内的余额流水，按 starting_after 游标分页。
+func (h *Handler) StripeBalanceTransactions(c *gin.Context) {
+	if !h.stripeAuth(c) {
+		return
+	}
+	gte, _ := strconv.ParseInt(c.Query("created[gte]"), 10, 64)
+	lt, err := strconv.ParseInt(c.Query("created[lt]"), 10, 64)
+	if err != nil {
+		lt = 1<<62 - 1
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 10
+	}
+
+	var txns []gin.H
+	inRange := func(unix int64) bool { return unix >= gte && unix < lt }
+	for _, t := range h.sim.BillTrades(domain.GatewayStripe, unixTime(gte), unixTime(lt)) {
+		if t.PaidAt != nil && inRange(t.PaidAt.Unix()) {
+			txns = append(txns, gin.H{
+				"id": "txn_" + t.TransactionID, "object": "balance_transaction", "type": "charge",
+				"amount": t.PaidAmount, "fee": 0, "currency": strings.ToLower(t.Currency), "created": t.PaidAt.Unix(),
+				"source": gin.H{"id": "ch_" + t.TransactionID, "object": "charge", "payment_intent": t.TransactionID, "metadata": gin.H{"payment_no": t.PaymentNo}},
+			})
+		}
+		for _, r := range t.Refunds {
+			if r.RefundedAt != nil && inRange(r.RefundedAt.Unix()) {
+				txns = append(txns, gin.H{
+					"id": "txn_" + r.RefundID, "object": "balance_transaction", "type": "refund",
+					"amount": -r.Amount, "fee": 0, "currency": strings.ToLower(t.Currency), "created": r.RefundedAt.Unix(),
+					"source": stripeRefund(t, r),
+				})
+			}
+		}
+	}
+	sort.SliceStable(txns, func(i, j int) bool { return txns[i]["created"].(int64) > txns[j]["created"].(int64) })
+
+	start := 0
+	if after := c.Query("starting_after"); after != "" {
+		for i, txn := range txns {
+			if txn["id"] == after {
+				start = i + 1
+				break
+			}
+		}
+	}
+	end := min(start+limit, len(txns))
+	page := txns[start:end]
+	if page == nil {
+		page = []gin.H{}
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "url": "/v1/balance_transactions", "has_more": end < len(txns), "data": page})
+}
+
+func unixTime(sec int64) time.Time {
+	return time.Unix(sec, 0)
+}
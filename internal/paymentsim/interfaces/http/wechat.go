@@ -0,0 +1,289 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/domain"
+	"github.com/wyfcoding/ecommerce/internal/paymentsim/infrastructure/notify"
+)
+
+// wechatReply 以平台私钥签名后输出应答；204 同样签名空正文。
+func (h *Handler) wechatReply(c *gin.Context, status int, body any) {
+	var raw []byte
+	if body != nil {
+		raw, _ = json.Marshal(body)
+	}
+	h.wechat.SignHeaders(c.Writer.Header(), raw)
+	if raw == nil {
+		c.Status(status)
+		return
+	}
+	c.Data(status, "application/json", raw)
+}
+
+// wechatError 输出 APIv3 错误应答 {"code","message"}，错误应答不签名。
+func (h *Handler) wechatError(c *gin.Context, status int, code, message string) {
+	h.logger.WarnContext(c.Request.Context(), "wechat request rejected", "path", c.Request.URL.Path, "code", code, "message", message)
+	c.JSON(status, gin.H{"code": code, "message": message})
+}
+
+// wechatAuth 读取请求体并校验商户签名。
+func (h *Handler) wechatAuth(c *gin.Context) ([]byte, bool) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		h.wechatError(c, http.StatusBadRequest, "PARAM_ERROR", "failed to read body")
+		return nil, false
+	}
+	if err := h.wechat.VerifyRequest(c.Request, body); err != nil {
+		h.wechatError(c, http.StatusUnauthorized, "SIGN_ERROR", err.Error())
+		return nil, false
+	}
+	return body, true
+}
+
+// WechatNativeOrder Native 下单。
+func (h *Handler) WechatNativeOrder(c *gin.Context) {
+	body, ok := h.wechatAuth(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		AppID       string `json:"appid"`
+		MchID       string `json:"mchid"`
+		Description string `json:"description"`
+		OutTradeNo  string `json:"out_trade_no"`
+		NotifyURL   string `json:"notify_url"`
+		Amount      struct {
+			Total    int64  `json:"total"`
+			Currency string `json:"currency"`
+		} `json:"amount"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.OutTradeNo == "" || req.Amount.Total <= 0 {
+		h.wechatError(c, http.StatusBadRequest, "PARAM_ERROR", "invalid order request")
+		return
+	}
+	if req.AppID != h.wechat.Config.AppID || req.MchID != h.wechat.Config.MchID {
+		h.wechatError(c, http.StatusForbidden, "APPID_MCHID_NOT_MATCH", "appid and mchid do not match")
+		return
+	}
+	currency := req.Amount.Currency
+	if currency == "" {
+		currency = "CNY"
+	}
+	trade, err := h.sim.CreateTrade(c.Request.Context(), &domain.Trade{
+		Gateway:       domain.GatewayWechat,
+		PaymentNo:     req.OutTradeNo,
+		TransactionID: h.sim.NextID("4200"),
+		Amount:        req.Amount.Total,
+		Currency:      currency,
+		Description:   req.Description,
+		NotifyURL:     req.NotifyURL,
+	})
+	if err != nil {
+		h.wechatError(c, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	h.wechatReply(c, http.StatusOK, gin.H{"code_url": "weixin://wxpay/bizpayurl?pr=sim" + trade.TransactionID})
+}
+
+// WechatQueryOrder 按商户订单号查询订单。
+func (h *Handler) WechatQueryOrder(c *gin.Context) {
+	if _, ok := h.wechatAuth(c); !ok {
+		return
+	}
+	trade, err := h.sim.Trade(domain.GatewayWechat, c.Param("no"))
+	if err != nil {
+		h.wechatError(c, http.StatusNotFound, "ORDER_NOT_EXIST", "订单不存在")
+		return
+	}
+	h.wechatReply(c, http.StatusOK, notify.WechatTransaction(h.wechat.Config, trade))
+}
+
+// WechatCloseOrder 关闭订单，成功应答 204。
+func (h *Handler) WechatCloseOrder(c *gin.Context) {
+	if _, ok := h.wechatAuth(c); !ok {
+		return
+	}
+	_, err := h.sim.CloseTrade(domain.GatewayWechat, c.Param("no"))
+	switch {
+	case errors.Is(err, domain.ErrTradeNotFound):
+		h.wechatError(c, http.StatusNotFound, "ORDER_NOT_EXIST", "订单不存在")
+	case errors.Is(err, domain.ErrTradeStatus):
+		h.wechatError(c, http.StatusBadRequest, "ORDERPAID", "订单已支付")
+	default:
+		h.wechatReply(c, http.StatusNoContent, nil)
+	}
+}
+
+// wechatRefund 渲染退款对象。部分退款失败场景下状态为 ABNORMAL。
+func wechatRefund(trade *domain.Trade, r *domain.Refund) gin.H {
+	status := "SUCCESS"
+	if r.Status == domain.RefundFailed {
+		status = "ABNORMAL"
+	}
+	resp := gin.H{
+		"refund_id":      r.RefundID,
+		"out_refund_no":  r.RefundNo,
+		"transaction_id": trade.TransactionID,
+		"out_trade_no":   trade.PaymentNo,
+		"channel":        "ORIGINAL",
+		"status":         status,
+		"create_time":    r.CreatedAt.In(notify.BeijingTime).Format(time.RFC3339),
+		"amount": gin.H{
+			"refund":   r.Amount,
+			"total":    trade.PaidAmount,
+			"currency": trade.Currency,
+		},
+	}
+	if r.RefundedAt != nil {
+		resp["success_time"] = r.RefundedAt.In(notify.BeijingTime).Format(time.RFC3339)
+	}
+	return resp
+}
+
+// WechatRefund 申请退款。
+func (h *Handler) WechatRefund(c *gin.Context) {
+	body, ok := h.wechatAuth(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		OutTradeNo  string `json:"out_trade_no"`
+		OutRefundNo string `json:"out_refund_no"`
+		Reason      string `json:"reason"`
+		Amount      struct {
+			Refund int64 `json:"refund"`
+			Total  int64 `json:"total"`
+		} `json:"amount"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || req.OutRefundNo == "" {
+		h.wechatError(c, http.StatusBadRequest, "PARAM_ERROR", "invalid refund request")
+		return
+	}
+	trade, err := h.sim.Trade(domain.GatewayWechat, req.OutTradeNo)
+	if err != nil {
+		h.wechatError(c, http.StatusNotFound, "RESOURCE_NOT_EXISTS", "订单不存在")
+		return
+	}
+	if req.Amount.Total != trade.PaidAmount {
+		h.wechatError(c, http.StatusBadRequest, "PARAM_ERROR", "订单金额与原订单不一致")
+		return
+	}
+	refund, _, err := h.sim.Refund(c.Request.Context(), domain.GatewayWechat, trade.PaymentNo, req.OutRefundNo, req.Amount.Refund, req.Reason)
+	switch {
+	case errors.Is(err, domain.ErrRefundExceeded):
+		h.wechatError(c, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	case errors.Is(err, domain.ErrTradeStatus):
+		h.wechatError(c, http.StatusForbidden, "INVALID_REQUEST", "订单未支付")
+		return
+	case err != nil:
+		h.wechatError(c, http.StatusInternalServerError, "SYSTEM_ERROR", err.Error())
+		return
+	}
+	h.wechatReply(c, http.StatusOK, wechatRefund(trade, refund))
+}
+
+// WechatQueryRefund 按商户退款单号查询退款。
+func (h *Handler) WechatQueryRefund(c *gin.Context) {
+	if _, ok := h.wechatAuth(c); !ok {
+		return
+	}
+	trade, refund, err := h.sim.FindRefund(domain.GatewayWechat, c.Param("no"))
+	if err != nil {
+		h.wechatError(c, http.StatusNotFound, "RESOURCE_NOT_EXISTS", "退款单不存在")
+		return
+	}
+	h.wechatReply(c, http.StatusOK, wechatRefund(trade, refund))
+}
+
+// WechatTradeBill 申请交易账单，返回下载地址与 SHA1 摘要。
+func (h *Handler) WechatTradeBill(c *gin.Context) {
+	if _, ok := h.wechatAuth(c); !ok {
+		return
+	}
+	date := c.Query("bill_date")
+	content, err := h.wechatBill(date)
+	if err != nil {
+		h.wechatError(c, http.StatusBadRequest, "PARAM_ERROR", "bill_date must be yyyy-MM-dd")
+		return
+	}
+	sum := sha1.Sum(content)
+	h.wechatReply(c, http.StatusOK, gin.H{
+		"hash_type":    "SHA1",
+		"hash_value":   hex.EncodeToString(sum[:]),
+		"download_url": h.publicURL + "/wechat/v3/billdownload/file?bill_date=" + date,
+	})
+}
+
+// WechatDownloadBill 下载账单文件，需商户签名，应答为文件流不签名。
+func (h *Handler) WechatDownloadBill(c *gin.Context) {
+	if _, ok := h.wechatAuth(c); !ok {
+		return
+	}
+	content, err := h.wechatBill(c.Query("bill_date"))
+	if err != nil {
+		h.wechatError(c, http.StatusBadRequest, "PARAM_ERROR", "bill_date must be yyyy-MM-dd")
+		return
+	}
+	c.Data(http.StatusOK, "text/plain;charset=utf-8", content)
+}
+
+// wechatBill 生成 ALL 类型交易账单：表头、以 ` 前缀的明细行、汇总表头与汇总行。
+func (h *Handler) wechatBill(date string) ([]byte, error) {
+	from, to, err := billDay(date, notify.BeijingTime)
+	if err != nil {
+		return nil, err
+	}
+	inDay := func(t *time.Time) bool { return t != nil && !t.Before(from) && t.Before(to) }
+
+	var (
+		buf                   bytes.Buffer
+		count                 int
+		settleTotal, refTotal int64
+	)
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"交易时间", "公众账号ID", "商户号", "特约商户号", "设备号", "微信订单号", "商户订单号", "用户标识", "交易类型", "交易状态", "付款银行", "货币种类", "应结订单金额", "代金券金额", "微信退款单号", "商户退款单号", "退款金额", "充值券退款金额", "退款类型", "退款状态", "商品名称", "商户数据包", "手续费", "费率", "订单金额", "申请退款金额", "费率备注"})
+	row := func(at *time.Time, t *domain.Trade, state, refundID, refundNo string, refund int64, refundStatus string) {
+		fields := []string{
+			at.In(notify.BeijingTime).Format(time.DateTime), h.wechat.Config.AppID, h.wechat.Config.MchID, "0", "",
+			t.TransactionID, t.PaymentNo, "oSim", "NATIVE", state, "OTHERS", t.Currency,
+			notify.FormatAmount(t.PaidAmount), "0.00", refundID, refundNo, notify.FormatAmount(refund), "0.00", "ORIGINAL", refundStatus,
+			t.Description, "", "0.00000", "0.60%", notify.FormatAmount(t.PaidAmount), notify.FormatAmount(refund), "",
+		}
+		for i := range fields {
+			fields[i] = "`" + fields[i]
+		}
+		_ = w.Write(fields)
+		count++
+	}
+	for _, t := range h.sim.BillTrades(domain.GatewayWechat, from, to) {
+		if inDay(t.PaidAt) {
+			row(t.PaidAt, t, "SUCCESS", "0", "0", 0, "")
+			settleTotal += t.PaidAmount
+		}
+		for _, r := range t.Refunds {
+			if inDay(r.RefundedAt) {
+				row(r.RefundedAt, t, "REFUND", r.RefundID, r.RefundNo, r.Amount, "SUCCESS")
+				refTotal += r.Amount
+			}
+		}
+	}
+	_ = w.Write([]string{"总交易单数", "应结订单总金额", "退款总金额", "充值券退款总金额", "手续费总金额", "订单总金额", "申请退款总金额"})
+	_ = w.Write([]string{
+		fmt.Sprintf("`%d", count), "`" + notify.FormatAmount(settleTotal), "`" + notify.FormatAmount(refTotal), "`0.00", "`0.00000",
+		"`" + notify.FormatAmount(settleTotal), "`" + notify.FormatAmount(refTotal),
+	})
+	w.Flush()
+	return buf.Bytes(), nil
+}
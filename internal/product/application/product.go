@@ -42,6 +42,7 @@ type CreateProductRequest struct {
 	Description string `json:"description"`
 	CategoryID  uint64 `json:"category_id"`
 	BrandID     uint64 `json:"brand_id"`
+	MerchantID  uint64 `json:"merchant_id"`
 	Price       int64  `json:"price"`
 	Stock       int32  `json:"stock"`
 }
@@ -55,17 +56,21 @@ type UpdateProductRequest struct {
 }
 
 type AddSKURequest struct {
-	Name  string            `json:"name"`
-	Price int64             `json:"price"`
-	Stock int32             `json:"stock"`
-	Image string            `json:"image"`
-	Specs map[string]string `json:"specs"`
+	Name   string            `json:"name"`
+	Price  int64             `json:"price"`
+	Stock  int32             `json:"stock"`
+	Image  string            `json:"image"`
+	Weight int32             `json:"weight"`
+	Volume int32             `json:"volume"`
+	Specs  map[string]string `json:"specs"`
 }
 
 type UpdateSKURequest struct {
-	Price *int64  `json:"price"`
-	Stock *int32  `json:"stock"`
-	Image *string `json:"image"`
+	Price  *int64  `json:"price"`
+	Stock  *int32  `json:"stock"`
+	Image  *string `json:"image"`
+	Weight *int32  `json:"weight"`
+	Volume *int32  `json:"volume"`
 }
 
 type CreateBrandRequest struct {
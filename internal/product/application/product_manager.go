@@ -53,6 +53,7 @@ func (m *ProductManager) CreateProduct(ctx context.Context, req *CreateProductRe
 		m.logger.ErrorContext(ctx, "failed to create new product entity", "error", err)
 		return nil, err
 	}
+	product.MerchantID = req.MerchantID
 
 	err = m.repo.Transaction(ctx, func(tx any) error {
 		txRepo := m.repo.WithTx(tx)
@@ -174,6 +175,14 @@ func (m *ProductManager) AddSKU(ctx context.Context, productID uint64, req *AddS
 	if err != nil {
 		return nil, err
 	}
+	if req.Weight < 0 {
+		return nil, errors.New("SKU weight cannot be negative")
+	}
+	sku.Weight = req.Weight
+	if req.Volume < 0 {
+		return nil, errors.New("SKU volume cannot be negative")
+	}
+	sku.Volume = req.Volume
 
 	if err := m.skuRepo.Save(ctx, sku); err != nil {
 		m.logger.ErrorContext(ctx, "failed to save SKU", "error", err)
@@ -206,6 +215,18 @@ func (m *ProductManager) UpdateSKU(ctx context.Context, id uint64, req *UpdateSK
 	if req.Image != nil {
 		sku.Image = *req.Image
 	}
+	if req.Weight != nil {
+		if *req.Weight < 0 {
+			return nil, errors.New("SKU weight cannot be negative")
+		}
+		sku.Weight = *req.Weight
+	}
+	if req.Volume != nil {
+		if *req.Volume < 0 {
+			return nil, errors.New("SKU volume cannot be negative")
+		}
+		sku.Volume = *req.Volume
+	}
 
 	if err := m.skuRepo.Update(ctx, sku); err != nil {
 		m.logger.ErrorContext(ctx, "failed to update SKU", "sku_id", id, "error", err)
@@ -24,6 +24,7 @@ type Product struct {
 	Description string        `gorm:"column:description;type:text" json:"description"`        // 商品描述。
 	CategoryID  uint          `gorm:"column:category_id;index;not null" json:"category_id"`   // 所属分类ID，索引字段，不允许为空。
 	BrandID     uint          `gorm:"column:brand_id;index;not null" json:"brand_id"`         // 所属品牌ID，索引字段，不允许为空。
+	MerchantID  uint64        `gorm:"column:merchant_id;index;default:0" json:"merchant_id"`  // 所属商户ID，多商户订单据此分账；0 表示平台自营。
 	Status      ProductStatus `gorm:"column:status;type:tinyint;default:1" json:"status"`     // 商品状态，默认为草稿。
 	MainImage   string        `gorm:"column:main_image;type:varchar(1024)" json:"main_image"` // 商品主图URL。
 	Images      []string      `gorm:"type:json;serializer:json" json:"images"`                // 商品图片列表（存储为JSON字符串）。
@@ -43,6 +44,8 @@ type SKU struct {
 	Stock      int32             `gorm:"column:stock;type:int;default:0" json:"stock"`       // SKU库存。
 	Sales      int32             `gorm:"column:sales;type:int;default:0" json:"sales"`       // SKU销量。
 	Image      string            `gorm:"column:image;type:varchar(1024)" json:"image"`       // SKU图片URL。
+	Weight     int32             `gorm:"column:weight;type:int;default:0" json:"weight"`     // 单件重量（单位：克），用于计算运费。
+	Volume     int32             `gorm:"column:volume;type:int;default:0" json:"volume"`     // 单件包装体积（单位：立方厘米），用于计算体积重与车辆装载。
 	Specs      map[string]string `gorm:"type:json;serializer:json" json:"specs"`             // SKU规格参数（例如，{"color": "red", "size": "L"}，存储为JSON字符串）。
 }
 
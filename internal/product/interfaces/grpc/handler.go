@@ -36,6 +36,7 @@ func (s *Server) CreateProduct(ctx context.Context, req *pb.CreateProductRequest
 		Description: req.Description,
 		CategoryID:  req.CategoryId,
 		BrandID:     req.BrandId,
+		MerchantID:  req.MerchantId,
 		Price:       0, // Default for now as protobuf missing fields
 		Stock:       0, // Default
 	}
@@ -153,11 +154,13 @@ func (s *Server) AddSKUsToProduct(ctx context.Context, req *pb.AddSKUsToProductR
 		}
 
 		addReq := &application.AddSKURequest{
-			Name:  skuReq.Name,
-			Price: skuReq.Price,
-			Stock: skuReq.StockQuantity,
-			Image: skuReq.ImageUrl,
-			Specs: specs,
+			Name:   skuReq.Name,
+			Price:  skuReq.Price,
+			Stock:  skuReq.StockQuantity,
+			Image:  skuReq.ImageUrl,
+			Weight: skuReq.Weight,
+			Volume: skuReq.Volume,
+			Specs:  specs,
 		}
 
 		sku, err := s.app.Manager.AddSKU(ctx, req.ProductId, addReq)
@@ -190,10 +193,24 @@ func (s *Server) UpdateSKU(ctx context.Context, req *pb.UpdateSKURequest) (*pb.S
 		image = &v
 	}
 
+	var weight *int32
+	if req.Weight != nil {
+		v := req.Weight.Value
+		weight = &v
+	}
+
+	var volume *int32
+	if req.Volume != nil {
+		v := req.Volume.Value
+		volume = &v
+	}
+
 	updateReq := &application.UpdateSKURequest{
-		Price: price,
-		Stock: stock,
-		Image: image,
+		Price:  price,
+		Stock:  stock,
+		Image:  image,
+		Weight: weight,
+		Volume: volume,
 	}
 
 	sku, err := s.app.Manager.UpdateSKU(ctx, req.Id, updateReq)
@@ -423,6 +440,7 @@ func convertProductToProto(p *domain.Product) *pb.ProductInfo {
 		Skus:             pbSKUs,
 		MainImageUrl:     p.MainImage,
 		GalleryImageUrls: p.Images,
+		MerchantId:       p.MerchantID,
 		CreatedAt:        timestamppb.New(p.CreatedAt),
 		UpdatedAt:        timestamppb.New(p.UpdatedAt),
 	}
@@ -445,6 +463,8 @@ func convertSKUToProto(s *domain.SKU) *pb.SKU {
 		StockQuantity: s.Stock,
 		ImageUrl:      s.Image,
 		SpecValues:    specValues,
+		Weight:        s.Weight,
+		Volume:        s.Volume,
 		CreatedAt:     timestamppb.New(s.CreatedAt),
 		UpdatedAt:     timestamppb.New(s.UpdatedAt),
 	}
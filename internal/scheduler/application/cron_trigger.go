@@ -0,0 +1,170 @@
+package application
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
+	"github.com/wyfcoding/pkg/metrics"
+)
+
+// CronTrigger 是 Cron 任务的触发循环。
+// 每个 tick 先进行主节点选举，只有主节点扫描到期任务；每次触发前再以 CAS 推进 NextRunTime，
+// 即使主节点切换瞬间出现双主，同一计划时间也只会被一个副本触发。
+type CronTrigger struct {
+	repo      domain.SchedulerRepository
+	manager   *SchedulerManager
+	elector   domain.LeaderElector
+	logger    *slog.Logger
+	interval  time.Duration
+	batchSize int
+	isLeader  atomic.Bool // 由触发协程写入，Stop 时读取
+	stopChan  chan struct{}
+
+	// 指标统计
+	firedCounter *prometheus.CounterVec
+	leaderGauge  *prometheus.GaugeVec
+}
+
+// NewCronTrigger 创建 Cron 触发循环。
+func NewCronTrigger(repo domain.SchedulerRepository, manager *SchedulerManager, elector domain.LeaderElector, logger *slog.Logger, m *metrics.Metrics) *CronTrigger {
+	return &CronTrigger{
+		repo:      repo,
+		manager:   manager,
+		elector:   elector,
+		logger:    logger.With("module", "cron_trigger"),
+		interval:  time.Second,
+		batchSize: 200,
+		stopChan:  make(chan struct{}),
+		firedCounter: m.NewCounterVec(prometheus.CounterOpts{
+			Name: "scheduler_cron_fired_total",
+			Help: "Cron 任务触发总数",
+		}, []string{"result"}),
+		leaderGauge: m.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scheduler_cron_is_leader",
+			Help: "当前副本是否为 Cron 主节点",
+		}, []string{}),
+	}
+}
+
+// Start 启动触发循环。
+func (t *CronTrigger) Start() {
+	t.logger.Info("cron trigger started", "interval", t.interval)
+	ticker := time.NewTicker(t.interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				t.tick()
+			case <-t.stopChan:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止触发循环并主动让出主节点。
+func (t *CronTrigger) Stop() {
+	close(t.stopChan)
+	if t.isLeader.Load() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := t.elector.Resign(ctx); err != nil {
+			t.logger.Warn("failed to resign cron leadership", "error", err)
+		}
+	}
+	t.logger.Info("cron trigger stopped")
+}
+
+// tick 执行一轮选举与到期扫描。
+func (t *CronTrigger) tick() {
+	ctx, cancel := context.WithTimeout(context.Background(), t.interval*5)
+	defer cancel()
+
+	leader, err := t.elector.TryAcquireOrRenew(ctx)
+	if err != nil {
+		t.logger.Error("cron leader election failed", "error", err)
+		leader = false
+	}
+	if t.isLeader.Swap(leader) != leader {
+		t.logger.Info("cron leadership changed", "is_leader", leader)
+	}
+	if leader {
+		t.leaderGauge.WithLabelValues().Set(1)
+	} else {
+		t.leaderGauge.WithLabelValues().Set(0)
+		return
+	}
+
+	now := time.Now()
+	jobs, err := t.repo.ListDueJobs(ctx, now, t.batchSize)
+	if err != nil {
+		t.logger.Error("failed to list due jobs", "error", err)
+		return
+	}
+	for _, job := range jobs {
+		t.fire(ctx, job, now)
+	}
+}
+
+// fire 按补偿策略触发单个到期任务。
+func (t *CronTrigger) fire(ctx context.Context, job *domain.Job, now time.Time) {
+	id := uint64(job.ID)
+
+	// 新建或迁移而来的任务尚未计算 NextRunTime，仅初始化不触发
+	if job.NextRunTime == nil {
+		schedule, err := job.Schedule()
+		if err != nil {
+			t.logger.Error("invalid cron expression", "job_id", id, "cron", job.CronExpr, "error", err)
+			return
+		}
+		if _, err := t.repo.AdvanceNextRunTime(ctx, id, nil, schedule.Next(now)); err != nil {
+			t.logger.Error("failed to initialize next run time", "job_id", id, "error", err)
+		}
+		return
+	}
+
+	// 上一次执行尚未结束时不推进计划时间，待其结束后再按补偿策略处理错过的触发，
+	// 避免推进后被 startRun 拒绝而丢失；运行超过 staleRunTimeout 的任务视为执行丢失，照常触发
+	if job.Status == domain.JobStatusRunning && job.LastRunTime != nil && job.LastRunTime.After(now.Add(-staleRunTimeout)) {
+		t.firedCounter.WithLabelValues("deferred").Inc()
+		return
+	}
+
+	fires, next, err := job.PlanFires(now)
+	if err != nil {
+		t.logger.Error("invalid cron expression", "job_id", id, "cron", job.CronExpr, "error", err)
+		return
+	}
+
+	advanced, err := t.repo.AdvanceNextRunTime(ctx, id, job.NextRunTime, next)
+	if err != nil {
+		t.logger.Error("failed to advance next run time", "job_id", id, "error", err)
+		return
+	}
+	if !advanced {
+		// 其他副本已触发或任务配置已变更
+		return
+	}
+
+	if len(fires) == 0 {
+		t.firedCounter.WithLabelValues("skipped").Inc()
+		t.logger.Warn("misfired job skipped", "job_id", id, "scheduled_time", job.NextRunTime, "next_run_time", next)
+		return
+	}
+	if len(fires) > 1 || now.Sub(fires[0]) > domain.MisfireThreshold {
+		t.logger.Warn("job misfired, applying policy", "job_id", id, "policy", job.MisfirePolicy, "fires", len(fires))
+	}
+
+	if err := t.manager.TriggerScheduled(ctx, id, fires); err != nil {
+		// 与手动运行等并发冲突时已由 TriggerScheduled 记录为 SKIPPED
+		t.firedCounter.WithLabelValues("rejected").Inc()
+		t.logger.Warn("scheduled job not started", "job_id", id, "error", err)
+		return
+	}
+	t.firedCounter.WithLabelValues("fired").Add(float64(len(fires)))
+}
@@ -0,0 +1,198 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
+	"github.com/wyfcoding/pkg/metrics"
+)
+
+// DelayPublisher 定义了到期消息的投递函数 (通常为 Kafka Producer.PublishToTopic)。
+type DelayPublisher func(ctx context.Context, topic, key string, payload []byte) error
+
+// DelayQueueManager 负责延迟任务的登记、取消与到期投递。
+// 任务先持久化到 MySQL，由后台扫描协程按到期时间以租约方式领取并投递，
+// 因此服务重启不会丢失待投递任务，水平扩容也不会重复投递。
+type DelayQueueManager struct {
+	repo      domain.DelayTaskRepository
+	publisher DelayPublisher
+	logger    *slog.Logger
+	owner     string
+	batchSize int
+	interval  time.Duration
+	lease     time.Duration
+	stopChan  chan struct{}
+
+	// 指标统计
+	deliveredCounter *prometheus.CounterVec
+	deliveryLag      *prometheus.HistogramVec
+	pendingGauge     *prometheus.GaugeVec
+}
+
+// NewDelayQueueManager 创建延迟队列管理器。
+func NewDelayQueueManager(repo domain.DelayTaskRepository, publisher DelayPublisher, logger *slog.Logger, m *metrics.Metrics) *DelayQueueManager {
+	hostname, _ := os.Hostname()
+
+	return &DelayQueueManager{
+		repo:      repo,
+		publisher: publisher,
+		logger:    logger.With("module", "delay_queue"),
+		owner:     fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		batchSize: 100,
+		interval:  time.Second,
+		lease:     30 * time.Second,
+		stopChan:  make(chan struct{}),
+		deliveredCounter: m.NewCounterVec(prometheus.CounterOpts{
+			Name: "scheduler_delay_task_delivered_total",
+			Help: "延迟任务投递总数",
+		}, []string{"topic", "status"}),
+		deliveryLag: m.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scheduler_delay_task_lag_seconds",
+			Help:    "延迟任务实际投递相对到期时间的滞后",
+			Buckets: []float64{0.5, 1, 2, 5, 10, 30, 60, 300},
+		}, []string{"topic"}),
+		pendingGauge: m.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scheduler_delay_task_pending",
+			Help: "尚未投递的延迟任务数量",
+		}, []string{}),
+	}
+}
+
+// Schedule 登记一条延迟消息，到达 deliverAt 后投递到 topic。
+// taskKey 为业务唯一键：重复登记时，若任务尚未投递则覆盖其载荷与到期时间，否则直接返回已有任务。
+func (m *DelayQueueManager) Schedule(ctx context.Context, taskKey, source, topic, msgKey string, payload []byte, deliverAt time.Time) (*domain.DelayTask, error) {
+	if taskKey == "" || topic == "" {
+		return nil, errors.New("task key and topic are required")
+	}
+
+	existing, err := m.repo.GetDelayTaskByKey(ctx, taskKey)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.IsFinal() {
+			m.logger.InfoContext(ctx, "delay task already finished, ignoring schedule", "task_key", taskKey, "status", existing.Status)
+			return existing, nil
+		}
+		if err := existing.Reschedule(topic, msgKey, payload, deliverAt); err != nil {
+			return nil, err
+		}
+		if err := m.repo.SaveDelayTask(ctx, existing); err != nil {
+			m.logger.ErrorContext(ctx, "failed to reschedule delay task", "task_key", taskKey, "error", err)
+			return nil, err
+		}
+		m.logger.InfoContext(ctx, "delay task rescheduled", "task_key", taskKey, "deliver_at", deliverAt)
+		return existing, nil
+	}
+
+	task := domain.NewDelayTask(taskKey, source, topic, msgKey, payload, deliverAt)
+	if err := m.repo.SaveDelayTask(ctx, task); err != nil {
+		m.logger.ErrorContext(ctx, "failed to save delay task", "task_key", taskKey, "error", err)
+		return nil, err
+	}
+	m.logger.InfoContext(ctx, "delay task scheduled", "task_key", taskKey, "topic", topic, "deliver_at", deliverAt)
+	return task, nil
+}
+
+// Cancel 取消尚未投递的延迟消息。
+// 任务尚未登记时写入已取消的墓碑，随后到达的同键登记会被忽略；已投递的任务返回 domain.ErrDelayTaskFinished。
+func (m *DelayQueueManager) Cancel(ctx context.Context, taskKey string) error {
+	if taskKey == "" {
+		return errors.New("task key is required")
+	}
+	task, err := m.repo.GetDelayTaskByKey(ctx, taskKey)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		// 与并发登记冲突时唯一键插入失败，返回错误由调用方重试，重试时按已有任务处理
+		if err := m.repo.SaveDelayTask(ctx, domain.NewCancelledDelayTask(taskKey)); err != nil {
+			m.logger.ErrorContext(ctx, "failed to save delay task tombstone", "task_key", taskKey, "error", err)
+			return err
+		}
+		m.logger.InfoContext(ctx, "delay task cancelled before scheduled, tombstone saved", "task_key", taskKey)
+		return nil
+	}
+
+	if err := task.Cancel(); err != nil {
+		return err
+	}
+	if err := m.repo.SaveDelayTask(ctx, task); err != nil {
+		m.logger.ErrorContext(ctx, "failed to cancel delay task", "task_key", taskKey, "error", err)
+		return err
+	}
+	m.logger.InfoContext(ctx, "delay task cancelled", "task_key", taskKey)
+	return nil
+}
+
+// Start 启动后台扫描协程。
+func (m *DelayQueueManager) Start() {
+	m.logger.Info("delay queue started", "owner", m.owner, "interval", m.interval)
+	ticker := time.NewTicker(m.interval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				m.poll()
+			case <-m.stopChan:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止后台扫描协程。
+func (m *DelayQueueManager) Stop() {
+	close(m.stopChan)
+	m.logger.Info("delay queue stopped", "owner", m.owner)
+}
+
+// poll 领取一批到期任务并逐条投递。
+func (m *DelayQueueManager) poll() {
+	ctx := context.Background()
+	now := time.Now()
+
+	tasks, err := m.repo.ClaimDueDelayTasks(ctx, m.owner, now, m.lease, m.batchSize)
+	if err != nil {
+		m.logger.Error("failed to claim due delay tasks", "error", err)
+		return
+	}
+	for _, task := range tasks {
+		m.deliver(ctx, task)
+	}
+
+	if pending, err := m.repo.CountPendingDelayTasks(ctx); err == nil {
+		m.pendingGauge.WithLabelValues().Set(float64(pending))
+	}
+}
+
+// deliver 投递单条任务并回写状态。
+func (m *DelayQueueManager) deliver(ctx context.Context, task *domain.DelayTask) {
+	sendCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := m.publisher(sendCtx, task.Topic, task.MsgKey, task.Payload)
+	now := time.Now()
+	if err != nil {
+		task.MarkAttemptFailed(now, err)
+		m.deliveredCounter.WithLabelValues(task.Topic, "failed").Inc()
+		m.logger.Warn("delay task delivery failed", "task_key", task.TaskKey, "topic", task.Topic, "retry_count", task.RetryCount, "error", err)
+	} else {
+		task.MarkDelivered(now)
+		m.deliveredCounter.WithLabelValues(task.Topic, "success").Inc()
+		m.deliveryLag.WithLabelValues(task.Topic).Observe(task.Lag(now).Seconds())
+		m.logger.Debug("delay task delivered", "task_key", task.TaskKey, "topic", task.Topic, "lag", task.Lag(now))
+	}
+
+	if err := m.repo.SaveDelayTask(ctx, task); err != nil {
+		// 状态回写失败时租约到期后任务会被重新领取，下游需按业务键幂等消费
+		m.logger.Error("failed to update delay task after delivery", "task_key", task.TaskKey, "error", err)
+	}
+}
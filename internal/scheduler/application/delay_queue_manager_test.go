@@ -0,0 +1,104 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
+	"github.com/wyfcoding/pkg/metrics"
+)
+
+// memoryDelayTaskRepository 是内存版延迟任务仓储，按 MySQL 严格模式拒绝零值日期。
+type memoryDelayTaskRepository struct {
+	mu    sync.Mutex
+	tasks map[string]*domain.DelayTask
+}
+
+func newMemoryDelayTaskRepository() *memoryDelayTaskRepository {
+	return &memoryDelayTaskRepository{tasks: make(map[string]*domain.DelayTask)}
+}
+
+func (r *memoryDelayTaskRepository) SaveDelayTask(_ context.Context, task *domain.DelayTask) error {
+	if task.DeliverAt.IsZero() || task.NextAttemptAt.IsZero() {
+		return errors.New("incorrect datetime value: '0000-00-00'")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	saved := *task
+	r.tasks[task.TaskKey] = &saved
+	return nil
+}
+
+func (r *memoryDelayTaskRepository) GetDelayTaskByKey(_ context.Context, taskKey string) (*domain.DelayTask, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[taskKey]
+	if !ok {
+		return nil, nil
+	}
+	saved := *task
+	return &saved, nil
+}
+
+func (r *memoryDelayTaskRepository) ClaimDueDelayTasks(context.Context, string, time.Time, time.Duration, int) ([]*domain.DelayTask, error) {
+	return nil, nil
+}
+
+func (r *memoryDelayTaskRepository) CountPendingDelayTasks(context.Context) (int64, error) {
+	return 0, nil
+}
+
+func newTestDelayQueueManager(repo domain.DelayTaskRepository) *DelayQueueManager {
+	publisher := func(context.Context, string, string, []byte) error { return nil }
+	return NewDelayQueueManager(repo, publisher, slog.New(slog.NewTextHandler(io.Discard, nil)), metrics.NewMetrics("scheduler_test"))
+}
+
+func TestDelayQueueCancelBeforeSchedule(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryDelayTaskRepository()
+	m := newTestDelayQueueManager(repo)
+
+	// 取消先于登记到达：保存墓碑
+	if err := m.Cancel(ctx, "order:1001"); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	tombstone, _ := repo.GetDelayTaskByKey(ctx, "order:1001")
+	if tombstone == nil || tombstone.Status != domain.DelayTaskCancelled {
+		t.Fatalf("tombstone = %+v, want cancelled task", tombstone)
+	}
+
+	// 随后到达的登记被忽略，墓碑保持取消状态
+	task, err := m.Schedule(ctx, "order:1001", "order", "order.timeout", "1001", []byte(`{}`), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	if task.Status != domain.DelayTaskCancelled || task.Topic != "" {
+		t.Fatalf("Schedule() = %+v, want existing tombstone", task)
+	}
+	saved, _ := repo.GetDelayTaskByKey(ctx, "order:1001")
+	if saved.Status != domain.DelayTaskCancelled || saved.Topic != "" {
+		t.Fatalf("saved task = %+v, want unchanged tombstone", saved)
+	}
+}
+
+func TestDelayQueueCancelAfterSchedule(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryDelayTaskRepository()
+	m := newTestDelayQueueManager(repo)
+
+	if _, err := m.Schedule(ctx, "order:1002", "order", "order.timeout", "1002", []byte(`{}`), time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	if err := m.Cancel(ctx, "order:1002"); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	saved, _ := repo.GetDelayTaskByKey(ctx, "order:1002")
+	if saved.Status != domain.DelayTaskCancelled || saved.Topic != "order.timeout" {
+		t.Fatalf("saved task = %+v, want cancelled order.timeout task", saved)
+	}
+}
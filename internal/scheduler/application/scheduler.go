@@ -2,34 +2,37 @@ package application
 
 import (
 	"context"
+	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
 )
 
 // SchedulerService 作为调度操作的门面。
 type SchedulerService struct {
-	manager *SchedulerManager
-	query   *SchedulerQuery
+	manager    *SchedulerManager
+	query      *SchedulerQuery
+	delayQueue *DelayQueueManager
 }
 
 // NewSchedulerService 创建调度服务门面实例。
-func NewSchedulerService(manager *SchedulerManager, query *SchedulerQuery) *SchedulerService {
+func NewSchedulerService(manager *SchedulerManager, query *SchedulerQuery, delayQueue *DelayQueueManager) *SchedulerService {
 	return &SchedulerService{
-		manager: manager,
-		query:   query,
+		manager:    manager,
+		query:      query,
+		delayQueue: delayQueue,
 	}
 }
 
 // --- 写操作（委托给 Manager）---
 
 // CreateJob 创建一个新的定时任务。
-func (s *SchedulerService) CreateJob(ctx context.Context, name, desc, cron, handler, params string) (*domain.Job, error) {
-	return s.manager.CreateJob(ctx, name, desc, cron, handler, params)
+func (s *SchedulerService) CreateJob(ctx context.Context, name, desc, cron, timeZone, misfirePolicy, handlerType, handler, params string, timeoutSeconds, maxRetries, retryBackoffMs, shardCount int, dependsOn []uint64) (*domain.Job, error) {
+	return s.manager.CreateJob(ctx, name, desc, cron, timeZone, misfirePolicy, handlerType, handler, params, timeoutSeconds, maxRetries, retryBackoffMs, shardCount, dependsOn)
 }
 
 // UpdateJob 更新现有定时任务的调度周期或参数。
-func (s *SchedulerService) UpdateJob(ctx context.Context, id uint64, cron, params string) error {
-	return s.manager.UpdateJob(ctx, id, cron, params)
+func (s *SchedulerService) UpdateJob(ctx context.Context, id uint64, cron, timeZone, misfirePolicy, params string, timeoutSeconds, maxRetries, retryBackoffMs, shardCount *int, dependsOn []uint64) error {
+	return s.manager.UpdateJob(ctx, id, cron, timeZone, misfirePolicy, params, timeoutSeconds, maxRetries, retryBackoffMs, shardCount, dependsOn)
 }
 
 // ToggleJobStatus 启用或停用指定的定时任务。
@@ -42,6 +45,21 @@ func (s *SchedulerService) RunJob(ctx context.Context, id uint64) error {
 	return s.manager.RunJob(ctx, id)
 }
 
+// ReportJobResult 接收远程处理器异步执行结果的回报。
+func (s *SchedulerService) ReportJobResult(ctx context.Context, logID uint64, idempotencyKey string, success bool, result, errMsg string) error {
+	return s.manager.ReportJobResult(ctx, logID, idempotencyKey, success, result, errMsg)
+}
+
+// ScheduleDelayEvent 登记一条延迟消息，到期后投递到目标 Topic。
+func (s *SchedulerService) ScheduleDelayEvent(ctx context.Context, taskKey, source, topic, key string, payload []byte, deliverAt time.Time) (*domain.DelayTask, error) {
+	return s.delayQueue.Schedule(ctx, taskKey, source, topic, key, payload, deliverAt)
+}
+
+// CancelDelayEvent 取消尚未投递的延迟消息。
+func (s *SchedulerService) CancelDelayEvent(ctx context.Context, taskKey string) error {
+	return s.delayQueue.Cancel(ctx, taskKey)
+}
+
 // --- 读操作（委托给 Query）---
 
 // ListJobs 分页获取定时任务列表。
@@ -49,9 +67,9 @@ func (s *SchedulerService) ListJobs(ctx context.Context, status *int, page, page
 	return s.query.ListJobs(ctx, status, page, pageSize)
 }
 
-// ListJobLogs 分页获取指定任务的执行历史日志。
-func (s *SchedulerService) ListJobLogs(ctx context.Context, jobID uint64, page, pageSize int) ([]*domain.JobLog, int64, error) {
-	return s.query.ListJobLogs(ctx, jobID, page, pageSize)
+// ListJobLogs 分页获取指定任务或指定 DAG 运行的执行历史日志。
+func (s *SchedulerService) ListJobLogs(ctx context.Context, jobID uint64, runID string, page, pageSize int) ([]*domain.JobLog, int64, error) {
+	return s.query.ListJobLogs(ctx, jobID, runID, page, pageSize)
 }
 
 // GetJob 获取指定ID的定时任务配置详情。
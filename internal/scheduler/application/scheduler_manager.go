@@ -2,42 +2,44 @@ package application
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
-	"github.com/wyfcoding/pkg/algorithm"
 )
 
 // JobHandler 定义了任务处理函数的原型
 type JobHandler func(ctx context.Context, params string) (string, error)
 
+// TopicJobTrigger 延迟作业到期后的触发 Topic，由本服务消费并执行 RunJob。
+const TopicJobTrigger = "scheduler.job.trigger"
+
+// staleRunTimeout 任务处于运行中超过该时长仍未结束即视为执行丢失。
+const staleRunTimeout = time.Hour
+
 // SchedulerManager 处理调度任务和日志的写操作。
 type SchedulerManager struct {
 	repo       domain.SchedulerRepository
 	logger     *slog.Logger
-	timerWheel *algorithm.TimingWheel
+	delayQueue *DelayQueueManager
 	handlers   map[string]JobHandler
+	invokers   map[domain.HandlerType]domain.RemoteInvoker
 }
 
 // NewSchedulerManager creates a new SchedulerManager instance.
-func NewSchedulerManager(repo domain.SchedulerRepository, logger *slog.Logger) *SchedulerManager {
-	tw, err := algorithm.NewTimingWheel(time.Second, 3600)
-	if err != nil {
-		logger.Error("failed to create timing wheel", "error", err)
-		return nil
-	}
-
-	manager := &SchedulerManager{
+func NewSchedulerManager(repo domain.SchedulerRepository, delayQueue *DelayQueueManager, logger *slog.Logger) *SchedulerManager {
+	return &SchedulerManager{
 		repo:       repo,
 		logger:     logger,
-		timerWheel: tw,
+		delayQueue: delayQueue,
 		handlers:   make(map[string]JobHandler),
+		invokers:   make(map[domain.HandlerType]domain.RemoteInvoker),
 	}
-	manager.timerWheel.Start()
-	return manager
 }
 
 // RegisterHandler 注册任务处理器
@@ -45,25 +47,34 @@ func (m *SchedulerManager) RegisterHandler(name string, handler JobHandler) {
 	m.handlers[name] = handler
 }
 
+// RegisterInvoker 注册远程处理器类型对应的调用器。
+func (m *SchedulerManager) RegisterInvoker(handlerType domain.HandlerType, invoker domain.RemoteInvoker) {
+	m.invokers[handlerType] = invoker
+}
+
 // ScheduleDelayJob 调度一个延迟任务。
-// 与传统的 time.After 不同，时间轮可以在极低资源消耗下管理百万级别的延迟任务。
-func (m *SchedulerManager) ScheduleDelayJob(ctx context.Context, delay time.Duration, jobID uint64) {
+// 任务持久化到延迟队列，到期后经 TopicJobTrigger 投递并由消费组中的某一个副本执行，
+// 因此重启不会丢失，多副本部署也不会重复触发。
+func (m *SchedulerManager) ScheduleDelayJob(ctx context.Context, delay time.Duration, jobID uint64) error {
 	m.logger.InfoContext(ctx, "scheduling delay job", "job_id", jobID, "delay", delay)
 
-	if err := m.timerWheel.AddTask(delay, func() {
-		// 时间轮触发后的执行逻辑
-		// 注意：此处在独立 goroutine 中运行
-		innerCtx := context.Background()
-		if err := m.RunJob(innerCtx, jobID); err != nil {
-			m.logger.ErrorContext(innerCtx, "failed to run delay job from timer wheel", "job_id", jobID, "error", err)
-		}
-	}); err != nil {
-		m.logger.ErrorContext(ctx, "failed to add task to timer wheel", "job_id", jobID, "error", err)
+	deliverAt := time.Now().Add(delay)
+	payload, err := json.Marshal(map[string]any{"job_id": jobID})
+	if err != nil {
+		return err
 	}
+	taskKey := fmt.Sprintf("%s:%d:%d", TopicJobTrigger, jobID, deliverAt.UnixNano())
+	if _, err := m.delayQueue.Schedule(ctx, taskKey, "scheduler", TopicJobTrigger, strconv.FormatUint(jobID, 10), payload, deliverAt); err != nil {
+		m.logger.ErrorContext(ctx, "failed to schedule delay job", "job_id", jobID, "error", err)
+		return err
+	}
+	return nil
 }
 
 // CreateJob 创建一个新的定时任务。
-func (m *SchedulerManager) CreateJob(ctx context.Context, name, desc, cron, handler, params string) (*domain.Job, error) {
+// handlerType 为 HTTP/GRPC 时 handler 为远程目标地址，timeoutSeconds/maxRetries/retryBackoffMs 为远程调用策略。
+// dependsOn 非空时任务在上游全部成功后触发，此时不能配置 cron；shardCount 大于 1 时每次执行拆分为多个并行分片。
+func (m *SchedulerManager) CreateJob(ctx context.Context, name, desc, cron, timeZone, misfirePolicy, handlerType, handler, params string, timeoutSeconds, maxRetries, retryBackoffMs, shardCount int, dependsOn []uint64) (*domain.Job, error) {
 	existing, err := m.repo.GetJobByName(ctx, name)
 	if err != nil {
 		m.logger.ErrorContext(ctx, "failed to check existing job name", "job_name", name, "error", err)
@@ -73,25 +84,101 @@ func (m *SchedulerManager) CreateJob(ctx context.Context, name, desc, cron, hand
 		return nil, errors.New("job name already exists")
 	}
 
+	policy, err := domain.ValidateMisfirePolicy(domain.MisfirePolicy(misfirePolicy))
+	if err != nil {
+		return nil, err
+	}
+	hType, err := domain.ValidateHandlerType(domain.HandlerType(handlerType))
+	if err != nil {
+		return nil, err
+	}
+	if timeoutSeconds < 0 || maxRetries < 0 || retryBackoffMs < 0 {
+		return nil, errors.New("retry policy values must not be negative")
+	}
+	shards, err := domain.ValidateShardCount(shardCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := domain.ValidateSchedule(cron, dependsOn); err != nil {
+		return nil, err
+	}
+	if err := m.checkParentsExist(ctx, dependsOn); err != nil {
+		return nil, err
+	}
+
 	job := &domain.Job{
-		Name:        name,
-		Description: desc,
-		CronExpr:    cron,
-		Handler:     handler,
-		Params:      params,
-		Status:      domain.JobStatusEnabled,
+		Name:           name,
+		Description:    desc,
+		CronExpr:       cron,
+		TimeZone:       timeZone,
+		MisfirePolicy:  policy,
+		HandlerType:    hType,
+		Handler:        handler,
+		Params:         params,
+		TimeoutSeconds: timeoutSeconds,
+		MaxRetries:     maxRetries,
+		RetryBackoffMs: retryBackoffMs,
+		ShardCount:     shards,
+		Status:         domain.JobStatusEnabled,
+		DependsOn:      dependsOn,
+	}
+	if err := job.RefreshNextRunTime(time.Now()); err != nil {
+		return nil, err
 	}
 
-	if err := m.repo.SaveJob(ctx, job); err != nil {
+	// 任务与依赖边同事务写入，避免留下缺少依赖、被当作无上游任务的半成品
+	if err := m.repo.SaveJobWithDependencies(ctx, job, dependsOn); err != nil {
 		m.logger.ErrorContext(ctx, "failed to save job", "job_name", name, "error", err)
 		return nil, err
 	}
-	m.logger.InfoContext(ctx, "job created successfully", "job_id", job.ID, "job_name", name)
+	m.logger.InfoContext(ctx, "job created successfully", "job_id", job.ID, "job_name", name, "next_run_time", job.NextRunTime)
 	return job, nil
 }
 
+// JobSpec 启动时登记的作业配置，对应配置文件的 [[jobs]] 段。
+type JobSpec struct {
+	Name           string `mapstructure:"name"`
+	Description    string `mapstructure:"description"`
+	Cron           string `mapstructure:"cron"`
+	TimeZone       string `mapstructure:"time_zone"`
+	MisfirePolicy  string `mapstructure:"misfire_policy"`
+	HandlerType    string `mapstructure:"handler_type"`
+	Handler        string `mapstructure:"handler"`
+	Params         string `mapstructure:"params"`
+	TimeoutSeconds int    `mapstructure:"timeout_seconds"`
+	MaxRetries     int    `mapstructure:"max_retries"`
+	RetryBackoffMs int    `mapstructure:"retry_backoff_ms"`
+	ShardCount     int    `mapstructure:"shard_count"`
+}
+
+// EnsureJobs 按名称登记配置中的作业：不存在时创建，已存在的保持管理接口修改后的配置不变。
+// 多副本同时启动时只有一个副本能创建成功，其余副本的名称冲突可忽略。
+func (m *SchedulerManager) EnsureJobs(ctx context.Context, specs []JobSpec) error {
+	var errs []error
+	for _, spec := range specs {
+		existing, err := m.repo.GetJobByName(ctx, spec.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("job %s: %w", spec.Name, err))
+			continue
+		}
+		if existing != nil {
+			continue
+		}
+		job, err := m.CreateJob(ctx, spec.Name, spec.Description, spec.Cron, spec.TimeZone, spec.MisfirePolicy, spec.HandlerType, spec.Handler, spec.Params,
+			spec.TimeoutSeconds, spec.MaxRetries, spec.RetryBackoffMs, spec.ShardCount, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("job %s: %w", spec.Name, err))
+			continue
+		}
+		m.logger.InfoContext(ctx, "configured job registered", "job_id", job.ID, "job_name", job.Name, "handler", job.Handler)
+	}
+	return errors.Join(errs...)
+}
+
 // UpdateJob 更新指定ID的定时任务信息。
-func (m *SchedulerManager) UpdateJob(ctx context.Context, id uint64, cron, params string) error {
+// timeZone 与 misfirePolicy 为空、重试策略与分片字段为 nil、dependsOn 为 nil 时保持原值；
+// dependsOn 为空切片表示清除全部上游依赖。
+func (m *SchedulerManager) UpdateJob(ctx context.Context, id uint64, cron, timeZone, misfirePolicy, params string, timeoutSeconds, maxRetries, retryBackoffMs, shardCount *int, dependsOn []uint64) error {
 	job, err := m.repo.GetJob(ctx, id)
 	if err != nil {
 		return err
@@ -100,14 +187,69 @@ func (m *SchedulerManager) UpdateJob(ctx context.Context, id uint64, cron, param
 		return errors.New("job not found")
 	}
 
+	parents := dependsOn
+	if parents == nil {
+		if parents, err = m.parentJobIDs(ctx, id); err != nil {
+			return err
+		}
+	} else {
+		if err := m.checkParentsExist(ctx, parents); err != nil {
+			return err
+		}
+		edges, err := m.repo.ListJobDependencies(ctx)
+		if err != nil {
+			return err
+		}
+		if err := domain.ValidateDependencies(edges, id, parents); err != nil {
+			return err
+		}
+	}
+	if err := domain.ValidateSchedule(cron, parents); err != nil {
+		return err
+	}
+
 	job.CronExpr = cron
 	job.Params = params
+	if timeZone != "" {
+		job.TimeZone = timeZone
+	}
+	if misfirePolicy != "" {
+		policy, err := domain.ValidateMisfirePolicy(domain.MisfirePolicy(misfirePolicy))
+		if err != nil {
+			return err
+		}
+		job.MisfirePolicy = policy
+	}
+	for _, v := range []*int{timeoutSeconds, maxRetries, retryBackoffMs} {
+		if v != nil && *v < 0 {
+			return errors.New("retry policy values must not be negative")
+		}
+	}
+	if timeoutSeconds != nil {
+		job.TimeoutSeconds = *timeoutSeconds
+	}
+	if maxRetries != nil {
+		job.MaxRetries = *maxRetries
+	}
+	if retryBackoffMs != nil {
+		job.RetryBackoffMs = *retryBackoffMs
+	}
+	if shardCount != nil {
+		shards, err := domain.ValidateShardCount(*shardCount)
+		if err != nil {
+			return err
+		}
+		job.ShardCount = shards
+	}
+	if err := job.RefreshNextRunTime(time.Now()); err != nil {
+		return err
+	}
 
-	if err := m.repo.SaveJob(ctx, job); err != nil {
+	if err := m.repo.SaveJobWithDependencies(ctx, job, dependsOn); err != nil {
 		m.logger.ErrorContext(ctx, "failed to update job", "job_id", id, "error", err)
 		return err
 	}
-	m.logger.InfoContext(ctx, "job updated successfully", "job_id", id)
+	m.logger.InfoContext(ctx, "job updated successfully", "job_id", id, "next_run_time", job.NextRunTime)
 	return nil
 }
 
@@ -126,6 +268,10 @@ func (m *SchedulerManager) ToggleJobStatus(ctx context.Context, id uint64, enabl
 	} else {
 		job.Status = domain.JobStatusDisabled
 	}
+	// 重新启用时从当前时间起计算，避免停用期间错过的周期被当作 misfire 补触发
+	if err := job.RefreshNextRunTime(time.Now()); err != nil {
+		return err
+	}
 
 	if err := m.repo.SaveJob(ctx, job); err != nil {
 		m.logger.ErrorContext(ctx, "failed to toggle job status", "job_id", id, "enable", enable, "error", err)
@@ -136,82 +282,448 @@ func (m *SchedulerManager) ToggleJobStatus(ctx context.Context, id uint64, enabl
 }
 
 // RunJob 立即运行指定ID的定时任务。
+// 手动运行会开启一次新的 DAG 运行，成功后同样会触发下游任务。
 func (m *SchedulerManager) RunJob(ctx context.Context, id uint64) error {
-	job, err := m.repo.GetJob(ctx, id)
+	job, logs, err := m.startRun(ctx, id, domain.TriggerManual, nil, "")
 	if err != nil {
 		return err
 	}
-	if job == nil {
-		return errors.New("job not found")
+
+	go m.executeRun(job, logs)
+	return nil
+}
+
+// TriggerScheduled 由 Cron 触发循环调用，按计划时间依次执行任务。
+// CATCH_UP 策略下 fires 可能包含多个计划时间，这些执行在同一协程内串行完成。
+func (m *SchedulerManager) TriggerScheduled(ctx context.Context, id uint64, fires []time.Time) error {
+	if len(fires) == 0 {
+		return nil
+	}
+	job, logs, err := m.startRun(ctx, id, domain.TriggerCron, &fires[0], "")
+	if err != nil {
+		if errors.Is(err, domain.ErrJobRunning) {
+			m.recordSkipped(ctx, id, domain.TriggerCron, "", fires...)
+		}
+		return err
 	}
 
-	if job.Status == domain.JobStatusRunning {
-		return errors.New("job is already running")
+	go func() {
+		m.executeRun(job, logs)
+		for i := 1; i < len(fires); i++ {
+			job, logs, err := m.startRun(context.Background(), id, domain.TriggerCron, &fires[i], "")
+			if err != nil {
+				m.logger.Error("failed to start catch-up run", "job_id", id, "scheduled_time", fires[i], "error", err)
+				if errors.Is(err, domain.ErrJobRunning) {
+					m.recordSkipped(context.Background(), id, domain.TriggerCron, "", fires[i:]...)
+				}
+				return
+			}
+			m.executeRun(job, logs)
+		}
+	}()
+	return nil
+}
+
+// recordSkipped 为任务仍在运行而未执行的触发写入 SKIPPED 日志。
+// runID 为空时每个计划时间各自作为一次独立运行记录。
+func (m *SchedulerManager) recordSkipped(ctx context.Context, id uint64, trigger domain.TriggerType, runID string, scheduled ...time.Time) {
+	job, err := m.repo.GetJob(ctx, id)
+	if err != nil || job == nil {
+		m.logger.ErrorContext(ctx, "failed to load job for skipped run", "job_id", id, "error", err)
+		return
+	}
+	if len(scheduled) == 0 {
+		scheduled = []time.Time{{}}
+	}
+	for _, st := range scheduled {
+		now := time.Now()
+		var scheduledTime *time.Time
+		if !st.IsZero() {
+			scheduledTime = &st
+		}
+		rid := runID
+		if rid == "" {
+			rid = domain.NewRunID(id, now)
+		}
+		log := domain.NewSkippedJobLog(job, trigger, scheduledTime, rid, domain.ErrJobRunning.Error(), now)
+		if err := m.repo.SaveJobLog(ctx, log); err != nil {
+			m.logger.ErrorContext(ctx, "failed to save skipped job log", "job_id", id, "scheduled_time", scheduledTime, "error", err)
+			continue
+		}
+		m.logger.WarnContext(ctx, "job trigger skipped, previous run still in progress", "job_id", id, "trigger", trigger, "scheduled_time", scheduledTime, "run_id", rid)
 	}
+}
 
-	log := &domain.JobLog{
-		JobID:     uint64(job.ID),
-		JobName:   job.Name,
-		Handler:   job.Handler,
-		Params:    job.Params,
-		Status:    "RUNNING",
-		StartTime: time.Now(),
+// startRun 将任务置为运行中并为每个分片写入运行日志。
+// runID 为空时开启一次新的 DAG 运行，否则作为该运行中的下游任务执行。
+func (m *SchedulerManager) startRun(ctx context.Context, id uint64, trigger domain.TriggerType, scheduledTime *time.Time, runID string) (*domain.Job, []*domain.JobLog, error) {
+	job, err := m.repo.GetJob(ctx, id)
+	if err != nil {
+		return nil, nil, err
 	}
-	if err := m.repo.SaveJobLog(ctx, log); err != nil {
-		m.logger.ErrorContext(ctx, "failed to save job log", "job_id", id, "error", err)
-		return err
+	if job == nil {
+		return nil, nil, errors.New("job not found")
 	}
 
-	job.Status = domain.JobStatusRunning
+	// 进程崩溃或远程处理器迟迟未回报时任务会停留在运行中，超过阈值后允许重新触发
 	now := time.Now()
-	job.LastRunTime = &now
-	job.RunCount++
-	if err := m.repo.SaveJob(ctx, job); err != nil {
+	started, err := m.repo.MarkJobRunning(ctx, id, now, now.Add(-staleRunTimeout))
+	if err != nil {
 		m.logger.ErrorContext(ctx, "failed to update job status to running", "job_id", id, "error", err)
-		return err
+		return nil, nil, err
+	}
+	if !started {
+		return nil, nil, domain.ErrJobRunning
 	}
-	m.logger.InfoContext(ctx, "job started execution", "job_id", id)
+	job.Status = domain.JobStatusRunning
+	job.LastRunTime = &now
+	job.RunCount++
 
-	go func() {
-		// 真实化执行：根据 Handler 名称查找并运行业务逻辑
-		var (
-			result string
-			err    error
-			status = "SUCCESS"
-		)
-
-		handler, ok := m.handlers[job.Handler]
-		if !ok {
-			err = fmt.Errorf("handler %s not found", job.Handler)
-			status = "FAILED"
-		} else {
-			// 执行真实逻辑
-			result, err = handler(context.Background(), job.Params)
-			if err != nil {
-				status = "FAILED"
+	if runID == "" {
+		runID = domain.NewRunID(id, now)
+	}
+	total := max(job.ShardCount, 1)
+	logs := make([]*domain.JobLog, 0, total)
+	for i := range total {
+		log := &domain.JobLog{
+			JobID:         id,
+			JobName:       job.Name,
+			Handler:       job.Handler,
+			Params:        job.Params,
+			TriggerType:   trigger,
+			ScheduledTime: scheduledTime,
+			RunID:         runID,
+			ShardIndex:    i,
+			ShardTotal:    total,
+			Status:        domain.JobLogRunning,
+			StartTime:     now,
+		}
+		if err := m.repo.SaveJobLog(ctx, log); err != nil {
+			m.logger.ErrorContext(ctx, "failed to save job log", "job_id", id, "shard", i, "error", err)
+			m.abortRun(ctx, job, logs, err)
+			return nil, nil, err
+		}
+		if job.IsRemote() {
+			// 幂等键依赖日志 ID，需在日志落库后生成
+			log.IdempotencyKey = domain.IdempotencyKeyFor(id, uint64(log.ID))
+			if err := m.repo.SaveJobLog(ctx, log); err != nil {
+				m.logger.ErrorContext(ctx, "failed to save job log idempotency key", "job_id", id, "error", err)
+				m.abortRun(ctx, job, append(logs, log), err)
+				return nil, nil, err
 			}
 		}
+		logs = append(logs, log)
+	}
+	m.logger.InfoContext(ctx, "job started execution", "job_id", id, "trigger", trigger, "run_id", runID, "shards", total)
+	return job, logs, nil
+}
 
-		endTime := time.Now()
-		log.EndTime = &endTime
-		log.Duration = endTime.Sub(log.StartTime).Milliseconds()
-		log.Status = status
-		if err != nil {
-			log.Result = err.Error()
-		} else {
-			log.Result = result
+// abortRun 在分片日志未能全部写入时终止本次运行，避免任务停留在运行中。
+func (m *SchedulerManager) abortRun(ctx context.Context, job *domain.Job, logs []*domain.JobLog, cause error) {
+	for _, log := range logs {
+		m.completeShard(ctx, job, log, "", cause)
+	}
+	if len(logs) == 0 {
+		if _, err := m.repo.FinishJobRun(ctx, uint64(job.ID), true); err != nil {
+			m.logger.ErrorContext(ctx, "failed to reset job status after abort", "job_id", job.ID, "error", err)
 		}
+	}
+}
+
+// executeRun 并行执行所有分片，等待同步分片结束后返回。
+// 本地处理器在本进程内并发运行；远程处理器的每个分片分别调用远端，由远端的工作节点并行处理。
+func (m *SchedulerManager) executeRun(job *domain.Job, logs []*domain.JobLog) {
+	var wg sync.WaitGroup
+	for _, log := range logs {
+		wg.Add(1)
+		go func(log *domain.JobLog) {
+			defer wg.Done()
+			m.executeShard(job, log)
+		}(log)
+	}
+	wg.Wait()
+}
+
+// executeShard 根据处理器类型运行本地函数或调用远程服务，随后回写分片结果。
+// 远程处理器以异步方式受理时，日志保持 RUNNING，等待 ReportJobResult 回报最终结果。
+func (m *SchedulerManager) executeShard(job *domain.Job, log *domain.JobLog) {
+	var (
+		result string
+		async  bool
+		err    error
+	)
+
+	if job.IsRemote() {
+		result, async, err = m.invokeRemote(job, log)
+	} else {
+		log.Attempts = 1
+		result, err = m.runLocal(job, log)
+	}
 
+	if async {
 		if err := m.repo.SaveJobLog(context.Background(), log); err != nil {
-			m.logger.Error("failed to save job log after execution", "job_id", id, "error", err)
+			m.logger.Error("failed to save job log after async accept", "job_id", job.ID, "log_id", log.ID, "error", err)
 		}
+		m.logger.Info("remote job accepted asynchronously", "job_id", job.ID, "log_id", log.ID, "shard", log.ShardIndex)
+		return
+	}
+	m.completeShard(context.Background(), job, log, result, err)
+}
 
-		job.Status = domain.JobStatusEnabled
-		if err := m.repo.SaveJob(context.Background(), job); err != nil {
-			m.logger.Error("failed to reset job status after execution", "job_id", id, "error", err)
+// runLocal 执行进程内注册的处理函数，分片信息通过 context 传递。
+func (m *SchedulerManager) runLocal(job *domain.Job, log *domain.JobLog) (result string, err error) {
+	handler, ok := m.handlers[job.Handler]
+	if !ok {
+		return "", fmt.Errorf("handler %s not found", job.Handler)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panic: %v", r)
 		}
-		m.logger.Info("job execution completed", "job_id", id, "status", log.Status)
 	}()
+	ctx := WithShard(context.Background(), log.ShardIndex, log.ShardTotal)
+	return handler(ctx, job.Params)
+}
+
+// invokeRemote 按任务的超时与重试策略调用远程处理器。
+// 所有重试共享同一幂等键，被调方据此保证同一次执行只生效一次。
+func (m *SchedulerManager) invokeRemote(job *domain.Job, log *domain.JobLog) (string, bool, error) {
+	invoker, ok := m.invokers[job.HandlerType]
+	if !ok {
+		return "", false, fmt.Errorf("no invoker registered for handler type %s", job.HandlerType)
+	}
+
+	policy := job.RetryPolicy()
+	inv := &domain.RemoteInvocation{
+		JobID:          uint64(job.ID),
+		JobName:        job.Name,
+		LogID:          uint64(log.ID),
+		Params:         job.Params,
+		IdempotencyKey: log.IdempotencyKey,
+		ScheduledTime:  log.ScheduledTime,
+		RunID:          log.RunID,
+		ShardIndex:     log.ShardIndex,
+		ShardTotal:     log.ShardTotal,
+	}
+
+	var err error
+	for attempt := 1; attempt <= policy.MaxRetries+1; attempt++ {
+		if attempt > 1 {
+			time.Sleep(policy.Backoff(attempt - 1))
+		}
+		inv.Attempt = attempt
+		log.Attempts = attempt
+
+		ctx, cancel := context.WithTimeout(context.Background(), policy.Timeout)
+		var res *domain.RemoteResult
+		res, err = invoker.Invoke(ctx, job.Handler, inv)
+		cancel()
+		if err == nil {
+			return res.Result, res.Async, nil
+		}
+		if !domain.IsRetryable(err) {
+			break
+		}
+		m.logger.Warn("remote job invocation failed", "job_id", job.ID, "target", job.Handler, "shard", log.ShardIndex, "attempt", attempt, "error", err)
+	}
+	return "", false, err
+}
+
+// completeShard 回写分片结果；当本次运行的所有分片均已结束时恢复任务状态，
+// 全部成功则继续触发下游任务。
+func (m *SchedulerManager) completeShard(ctx context.Context, job *domain.Job, log *domain.JobLog, result string, err error) {
+	id := uint64(job.ID)
+	endTime := time.Now()
+	log.EndTime = &endTime
+	log.Duration = endTime.Sub(log.StartTime).Milliseconds()
+	if err != nil {
+		log.Status = domain.JobLogFailed
+		log.Error = err.Error()
+	} else {
+		log.Status = domain.JobLogSuccess
+		log.Result = result
+	}
+	if err := m.repo.SaveJobLog(ctx, log); err != nil {
+		m.logger.ErrorContext(ctx, "failed to save job log after execution", "job_id", id, "shard", log.ShardIndex, "error", err)
+		return
+	}
+
+	runLogs, err := m.repo.ListRunJobLogs(ctx, log.RunID)
+	if err != nil {
+		m.logger.ErrorContext(ctx, "failed to load run logs", "job_id", id, "run_id", log.RunID, "error", err)
+		return
+	}
+	done, succeeded := domain.RunOutcome(runLogs, id)
+	if !done {
+		return
+	}
+
+	// 多个分片可能同时结束，只有一个调用方能完成收尾
+	finished, err := m.repo.FinishJobRun(ctx, id, !succeeded)
+	if err != nil {
+		m.logger.ErrorContext(ctx, "failed to reset job status after execution", "job_id", id, "error", err)
+		return
+	}
+	if !finished {
+		return
+	}
+	m.logger.InfoContext(ctx, "job execution completed", "job_id", id, "run_id", log.RunID, "succeeded", succeeded, "shards", log.ShardTotal)
+
+	if succeeded {
+		m.triggerDownstream(ctx, id, log.RunID, log.ScheduledTime)
+	}
+}
+
+// triggerDownstream 检查直接下游任务，其余上游在下游的依赖窗口内均已成功运行的任务随即启动。
+// 上游可能来自不同的 Cron 根任务，各自拥有独立的 runID，因此按每个上游窗口内最近的成功运行判断，而不是只看本次运行。
+func (m *SchedulerManager) triggerDownstream(ctx context.Context, parentID uint64, runID string, scheduledTime *time.Time) {
+	children, err := m.repo.ListChildJobIDs(ctx, parentID)
+	if err != nil {
+		m.logger.ErrorContext(ctx, "failed to list downstream jobs", "job_id", parentID, "error", err)
+		return
+	}
+	if len(children) == 0 {
+		return
+	}
+	edges, err := m.repo.ListJobDependencies(ctx, children...)
+	if err != nil {
+		m.logger.ErrorContext(ctx, "failed to load downstream dependencies", "job_id", parentID, "error", err)
+		return
+	}
+
+	for _, child := range children {
+		job, err := m.repo.GetJob(ctx, child)
+		if err != nil || job == nil || job.Status == domain.JobStatusDisabled {
+			m.logger.WarnContext(ctx, "downstream job skipped", "job_id", child, "run_id", runID, "error", err)
+			continue
+		}
+		ready, err := m.parentsSucceeded(ctx, job, parentID, edges)
+		if err != nil {
+			m.logger.ErrorContext(ctx, "failed to check upstream runs", "job_id", child, "run_id", runID, "error", err)
+			continue
+		}
+		if !ready {
+			continue
+		}
+		// 已在本次运行中执行过的下游任务不再重复触发
+		if _, started, err := m.repo.ListJobLogs(ctx, child, runID, 0, 1); err != nil || started > 0 {
+			continue
+		}
+		// 同一下游任务的最后一个上游可能同时在多个副本上结束，MarkJobRunning 保证只启动一次
+		job, logs, err := m.startRun(ctx, child, domain.TriggerDAG, scheduledTime, runID)
+		if err != nil {
+			m.logger.WarnContext(ctx, "downstream job not started", "job_id", child, "run_id", runID, "error", err)
+			continue
+		}
+		go m.executeRun(job, logs)
+	}
+}
+
+// parentsSucceeded 判断下游任务除 finishedID 外的其余上游在其依赖窗口内是否均已成功运行。
+// finishedID 为刚刚成功结束的上游。
+func (m *SchedulerManager) parentsSucceeded(ctx context.Context, child *domain.Job, finishedID uint64, edges []*domain.JobDependency) (bool, error) {
+	var others []uint64
+	for _, e := range edges {
+		if e.JobID == uint64(child.ID) && e.ParentJobID != finishedID {
+			others = append(others, e.ParentJobID)
+		}
+	}
+	if len(others) == 0 {
+		return true, nil
+	}
+	logs, err := m.repo.ListJobLogsSince(ctx, others, child.DependencyWindowStart())
+	if err != nil {
+		return false, err
+	}
+	for _, p := range others {
+		if !domain.SucceededInWindow(logs, p) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ReportJobResult 接收远程处理器异步执行的结果回报。
+// 重复回报 (日志已结束) 直接忽略，保证幂等。
+func (m *SchedulerManager) ReportJobResult(ctx context.Context, logID uint64, idempotencyKey string, success bool, result, errMsg string) error {
+	log, err := m.repo.GetJobLog(ctx, logID)
+	if err != nil {
+		return err
+	}
+	if log == nil {
+		return errors.New("job log not found")
+	}
+	if log.IdempotencyKey == "" || log.IdempotencyKey != idempotencyKey {
+		return errors.New("idempotency key mismatch")
+	}
+	if log.Status != domain.JobLogRunning {
+		m.logger.InfoContext(ctx, "job result already reported, ignoring", "log_id", logID, "status", log.Status)
+		return nil
+	}
+
+	job, err := m.repo.GetJob(ctx, log.JobID)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return errors.New("job not found")
+	}
+
+	var runErr error
+	if !success {
+		if errMsg == "" {
+			errMsg = "remote handler reported failure"
+		}
+		runErr = errors.New(errMsg)
+	}
+	m.completeShard(ctx, job, log, result, runErr)
+	return nil
+}
 
+// checkParentsExist 校验上游任务均存在。
+func (m *SchedulerManager) checkParentsExist(ctx context.Context, parents []uint64) error {
+	for _, p := range parents {
+		job, err := m.repo.GetJob(ctx, p)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return fmt.Errorf("upstream job %d not found", p)
+		}
+	}
 	return nil
 }
+
+// parentJobIDs 获取任务当前的上游任务ID。
+func (m *SchedulerManager) parentJobIDs(ctx context.Context, id uint64) ([]uint64, error) {
+	edges, err := m.repo.ListJobDependencies(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, len(edges))
+	for i, e := range edges {
+		ids[i] = e.ParentJobID
+	}
+	return ids, nil
+}
+
+type shardKey struct{}
+
+// shardInfo 分片执行上下文。
+type shardInfo struct {
+	index int
+	total int
+}
+
+// WithShard 将分片信息写入 context，供本地处理器读取。
+func WithShard(ctx context.Context, index, total int) context.Context {
+	return context.WithValue(ctx, shardKey{}, shardInfo{index: index, total: total})
+}
+
+// ShardFromContext 读取当前分片序号与总数，未分片的任务返回 (0, 1)。
+func ShardFromContext(ctx context.Context) (index, total int) {
+	if v, ok := ctx.Value(shardKey{}).(shardInfo); ok {
+		return v.index, v.total
+	}
+	return 0, 1
+}
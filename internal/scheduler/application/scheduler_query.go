@@ -26,16 +26,54 @@ func (q *SchedulerQuery) ListJobs(ctx context.Context, status *int, page, pageSi
 		s := domain.JobStatus(*status)
 		st = &s
 	}
-	return q.repo.ListJobs(ctx, st, offset, pageSize)
+	jobs, total, err := q.repo.ListJobs(ctx, st, offset, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := q.fillDependencies(ctx, jobs...); err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
 }
 
 // ListJobLogs 获取任务日志列表。
-func (q *SchedulerQuery) ListJobLogs(ctx context.Context, jobID uint64, page, pageSize int) ([]*domain.JobLog, int64, error) {
+// runID 非空时返回该次 DAG 运行中所有任务与分片的日志，用于查看整条链路的执行状态。
+func (q *SchedulerQuery) ListJobLogs(ctx context.Context, jobID uint64, runID string, page, pageSize int) ([]*domain.JobLog, int64, error) {
 	offset := (page - 1) * pageSize
-	return q.repo.ListJobLogs(ctx, jobID, offset, pageSize)
+	return q.repo.ListJobLogs(ctx, jobID, runID, offset, pageSize)
 }
 
 // GetJob 获取单个任务详情
 func (q *SchedulerQuery) GetJob(ctx context.Context, id uint64) (*domain.Job, error) {
-	return q.repo.GetJob(ctx, id)
+	job, err := q.repo.GetJob(ctx, id)
+	if err != nil || job == nil {
+		return job, err
+	}
+	if err := q.fillDependencies(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// fillDependencies 批量加载任务的上游依赖。
+func (q *SchedulerQuery) fillDependencies(ctx context.Context, jobs ...*domain.Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	ids := make([]uint64, len(jobs))
+	byID := make(map[uint64]*domain.Job, len(jobs))
+	for i, j := range jobs {
+		ids[i] = uint64(j.ID)
+		byID[uint64(j.ID)] = j
+	}
+	edges, err := q.repo.ListJobDependencies(ctx, ids...)
+	if err != nil {
+		return err
+	}
+	for _, e := range edges {
+		if j, ok := byID[e.JobID]; ok {
+			j.DependsOn = append(j.DependsOn, e.ParentJobID)
+		}
+	}
+	return nil
 }
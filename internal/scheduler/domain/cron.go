@@ -0,0 +1,121 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// MisfirePolicy 定义了错过触发时间 (服务停机、主节点切换等) 后的补偿策略。
+type MisfirePolicy string
+
+const (
+	MisfireFireOnce MisfirePolicy = "FIRE_ONCE" // 无论错过多少次，只补触发一次
+	MisfireSkip     MisfirePolicy = "SKIP"      // 丢弃错过的触发，等待下一个周期
+	MisfireCatchUp  MisfirePolicy = "CATCH_UP"  // 逐个补触发所有错过的周期 (有上限)
+)
+
+// MisfireThreshold 触发时间晚于计划超过该阈值即视为错过 (misfire)。
+const MisfireThreshold = 5 * time.Second
+
+// MaxCatchUpFires CATCH_UP 策略单次最多补触发的次数，防止长时间停机后瞬间洪峰。
+const MaxCatchUpFires = 100
+
+// cronParser 支持标准 5 段 (分 时 日 月 周) 与带秒的 6 段表达式，以及 @daily 等描述符。
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// CronSchedule 是解析后的 Cron 调度规则值对象。
+type CronSchedule struct {
+	schedule cron.Schedule
+	location *time.Location
+}
+
+// ParseCronSchedule 解析 Cron 表达式，timeZone 为 IANA 时区名 (如 Asia/Shanghai)，为空时使用服务本地时区。
+func ParseCronSchedule(expr, timeZone string) (*CronSchedule, error) {
+	if expr == "" {
+		return nil, errors.New("cron expression is empty")
+	}
+	loc := time.Local
+	if timeZone != "" {
+		l, err := time.LoadLocation(timeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", timeZone, err)
+		}
+		loc = l
+	}
+	schedule, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	return &CronSchedule{schedule: schedule, location: loc}, nil
+}
+
+// Next 返回 after 之后的下一次触发时间。
+func (c *CronSchedule) Next(after time.Time) time.Time {
+	return c.schedule.Next(after.In(c.location))
+}
+
+// ValidateMisfirePolicy 校验补偿策略，空值视为 FIRE_ONCE。
+func ValidateMisfirePolicy(policy MisfirePolicy) (MisfirePolicy, error) {
+	switch policy {
+	case "":
+		return MisfireFireOnce, nil
+	case MisfireFireOnce, MisfireSkip, MisfireCatchUp:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid misfire policy: %s", policy)
+	}
+}
+
+// Schedule 解析任务自身的 Cron 规则。
+func (j *Job) Schedule() (*CronSchedule, error) {
+	return ParseCronSchedule(j.CronExpr, j.TimeZone)
+}
+
+// RefreshNextRunTime 基于当前时间重新计算下次运行时间；禁用或由上游依赖触发的任务清空下次运行时间。
+func (j *Job) RefreshNextRunTime(now time.Time) error {
+	if j.Status == JobStatusDisabled || j.CronExpr == "" {
+		j.NextRunTime = nil
+		return nil
+	}
+	schedule, err := j.Schedule()
+	if err != nil {
+		return err
+	}
+	next := schedule.Next(now)
+	j.NextRunTime = &next
+	return nil
+}
+
+// PlanFires 根据补偿策略计算本轮应触发的计划时间列表，以及推进后的下次运行时间。
+// 调用方需保证 NextRunTime 不为空且已到期。
+func (j *Job) PlanFires(now time.Time) ([]time.Time, time.Time, error) {
+	schedule, err := j.Schedule()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	scheduled := *j.NextRunTime
+	next := schedule.Next(now)
+	misfired := now.Sub(scheduled) > MisfireThreshold
+	if !misfired {
+		return []time.Time{scheduled}, next, nil
+	}
+
+	switch j.MisfirePolicy {
+	case MisfireSkip:
+		return nil, next, nil
+	case MisfireCatchUp:
+		fires := make([]time.Time, 0, 4)
+		for t := scheduled; !t.After(now) && len(fires) < MaxCatchUpFires; t = schedule.Next(t) {
+			fires = append(fires, t)
+		}
+		return fires, next, nil
+	default:
+		return []time.Time{scheduled}, next, nil
+	}
+}
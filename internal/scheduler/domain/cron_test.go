@@ -0,0 +1,248 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q) error = %v", name, err)
+	}
+	return loc
+}
+
+func TestParseCronSchedule(t *testing.T) {
+	after := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		expr     string
+		timeZone string
+		want     time.Time
+		wantErr  bool
+	}{
+		{name: "five fields", expr: "*/15 * * * *", timeZone: "UTC", want: time.Date(2026, 5, 1, 12, 15, 0, 0, time.UTC)},
+		{name: "with seconds", expr: "30 * * * * *", timeZone: "UTC", want: time.Date(2026, 5, 1, 12, 0, 30, 0, time.UTC)},
+		{name: "descriptor", expr: "@daily", timeZone: "UTC", want: time.Date(2026, 5, 2, 0, 0, 0, 0, time.UTC)},
+		// 上海 02:00 即 UTC 前一日 18:00
+		{name: "time zone", expr: "0 2 * * *", timeZone: "Asia/Shanghai", want: time.Date(2026, 5, 1, 18, 0, 0, 0, time.UTC)},
+		{name: "empty expression", expr: "", timeZone: "UTC", wantErr: true},
+		{name: "invalid expression", expr: "61 * * * *", timeZone: "UTC", wantErr: true},
+		{name: "invalid time zone", expr: "0 2 * * *", timeZone: "Mars/Olympus", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCronSchedule(tt.expr, tt.timeZone)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCronSchedule() error = %v", err)
+			}
+			if got := schedule.Next(after); !got.Equal(tt.want) {
+				t.Fatalf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronScheduleDST(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+
+	// 每日 09:00 在夏令时切换后仍按当地时间触发，两次触发间隔 23 小时
+	daily, err := ParseCronSchedule("0 9 * * *", "America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := daily.Next(time.Date(2026, 3, 6, 12, 0, 0, 0, ny))
+	after := daily.Next(before)
+	if want := time.Date(2026, 3, 7, 9, 0, 0, 0, ny); !before.Equal(want) {
+		t.Fatalf("Next() = %v, want %v", before, want)
+	}
+	if gap := after.Sub(before); gap != 23*time.Hour {
+		t.Fatalf("gap across DST = %v, want 23h", gap)
+	}
+
+	// 切换当日 02:30 不存在，当天不触发
+	nonexistent, err := ParseCronSchedule("30 2 * * *", "America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := nonexistent.Next(time.Date(2026, 3, 7, 3, 0, 0, 0, ny)), time.Date(2026, 3, 9, 2, 30, 0, 0, ny); !got.Equal(want) {
+		t.Fatalf("Next() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateMisfirePolicy(t *testing.T) {
+	tests := []struct {
+		policy  MisfirePolicy
+		want    MisfirePolicy
+		wantErr bool
+	}{
+		{policy: "", want: MisfireFireOnce},
+		{policy: MisfireFireOnce, want: MisfireFireOnce},
+		{policy: MisfireSkip, want: MisfireSkip},
+		{policy: MisfireCatchUp, want: MisfireCatchUp},
+		{policy: "RETRY", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ValidateMisfirePolicy(tt.policy)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ValidateMisfirePolicy(%q) = %q, %v, want %q", tt.policy, got, err, tt.want)
+		}
+	}
+}
+
+func TestPlanFires(t *testing.T) {
+	at := func(h, m, s int) time.Time { return time.Date(2026, 5, 1, h, m, s, 0, time.UTC) }
+	tests := []struct {
+		name      string
+		policy    MisfirePolicy
+		scheduled time.Time
+		now       time.Time
+		wantFires []time.Time
+		wantNext  time.Time
+	}{
+		{
+			name:      "on time",
+			policy:    MisfireSkip,
+			scheduled: at(10, 0, 0),
+			now:       at(10, 0, 3),
+			wantFires: []time.Time{at(10, 0, 0)},
+			wantNext:  at(10, 10, 0),
+		},
+		{
+			name:      "late within threshold",
+			policy:    MisfireSkip,
+			scheduled: at(10, 0, 0),
+			now:       at(10, 0, 0).Add(MisfireThreshold),
+			wantFires: []time.Time{at(10, 0, 0)},
+			wantNext:  at(10, 10, 0),
+		},
+		{
+			name:      "fire once",
+			policy:    MisfireFireOnce,
+			scheduled: at(10, 0, 0),
+			now:       at(10, 35, 0),
+			wantFires: []time.Time{at(10, 0, 0)},
+			wantNext:  at(10, 40, 0),
+		},
+		{
+			name:      "empty policy fires once",
+			scheduled: at(10, 0, 0),
+			now:       at(10, 35, 0),
+			wantFires: []time.Time{at(10, 0, 0)},
+			wantNext:  at(10, 40, 0),
+		},
+		{
+			name:      "skip",
+			policy:    MisfireSkip,
+			scheduled: at(10, 0, 0),
+			now:       at(10, 35, 0),
+			wantNext:  at(10, 40, 0),
+		},
+		{
+			name:      "catch up",
+			policy:    MisfireCatchUp,
+			scheduled: at(10, 0, 0),
+			now:       at(10, 35, 0),
+			wantFires: []time.Time{at(10, 0, 0), at(10, 10, 0), at(10, 20, 0), at(10, 30, 0)},
+			wantNext:  at(10, 40, 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &Job{CronExpr: "*/10 * * * *", TimeZone: "UTC", MisfirePolicy: tt.policy, NextRunTime: &tt.scheduled}
+			fires, next, err := job.PlanFires(tt.now)
+			if err != nil {
+				t.Fatalf("PlanFires() error = %v", err)
+			}
+			if !slices.EqualFunc(fires, tt.wantFires, time.Time.Equal) {
+				t.Fatalf("fires = %v, want %v", fires, tt.wantFires)
+			}
+			if !next.Equal(tt.wantNext) {
+				t.Fatalf("next = %v, want %v", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestPlanFiresCatchUpLimit(t *testing.T) {
+	// 每分钟触发的任务停机 3 小时，只补触发最早的 100 次，其余丢弃
+	scheduled := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	now := scheduled.Add(3 * time.Hour)
+	job := &Job{CronExpr: "* * * * *", TimeZone: "UTC", MisfirePolicy: MisfireCatchUp, NextRunTime: &scheduled}
+
+	fires, next, err := job.PlanFires(now)
+	if err != nil {
+		t.Fatalf("PlanFires() error = %v", err)
+	}
+	if len(fires) != MaxCatchUpFires {
+		t.Fatalf("len(fires) = %d, want %d", len(fires), MaxCatchUpFires)
+	}
+	if !fires[0].Equal(scheduled) || !fires[len(fires)-1].Equal(scheduled.Add(99*time.Minute)) {
+		t.Fatalf("fires span %v - %v, want %v - %v", fires[0], fires[len(fires)-1], scheduled, scheduled.Add(99*time.Minute))
+	}
+	if want := now.Add(time.Minute); !next.Equal(want) {
+		t.Fatalf("next = %v, want %v", next, want)
+	}
+}
+
+func TestPlanFiresCatchUpAcrossDST(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+	scheduled := time.Date(2026, 3, 7, 9, 0, 0, 0, ny)
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, ny)
+	job := &Job{CronExpr: "0 9 * * *", TimeZone: "America/New_York", MisfirePolicy: MisfireCatchUp, NextRunTime: &scheduled}
+
+	fires, next, err := job.PlanFires(now)
+	if err != nil {
+		t.Fatalf("PlanFires() error = %v", err)
+	}
+	want := []time.Time{
+		time.Date(2026, 3, 7, 9, 0, 0, 0, ny), // EST, UTC 14:00
+		time.Date(2026, 3, 8, 9, 0, 0, 0, ny), // EDT, UTC 13:00
+		time.Date(2026, 3, 9, 9, 0, 0, 0, ny),
+		time.Date(2026, 3, 10, 9, 0, 0, 0, ny),
+	}
+	if !slices.EqualFunc(fires, want, time.Time.Equal) {
+		t.Fatalf("fires = %v, want %v", fires, want)
+	}
+	if !next.Equal(time.Date(2026, 3, 11, 9, 0, 0, 0, ny)) {
+		t.Fatalf("next = %v, want 2026-03-11 09:00 EDT", next)
+	}
+}
+
+func TestRefreshNextRunTime(t *testing.T) {
+	now := time.Date(2026, 5, 1, 10, 5, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		job  *Job
+		want *time.Time
+	}{
+		{name: "enabled", job: &Job{CronExpr: "*/10 * * * *", TimeZone: "UTC", Status: JobStatusEnabled}, want: ptrTime(time.Date(2026, 5, 1, 10, 10, 0, 0, time.UTC))},
+		{name: "disabled", job: &Job{CronExpr: "*/10 * * * *", TimeZone: "UTC", Status: JobStatusDisabled}},
+		{name: "triggered by upstream", job: &Job{Status: JobStatusEnabled}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.job.NextRunTime = &now
+			if err := tt.job.RefreshNextRunTime(now); err != nil {
+				t.Fatalf("RefreshNextRunTime() error = %v", err)
+			}
+			got := tt.job.NextRunTime
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Fatalf("NextRunTime = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxShardCount 单个任务允许拆分的最大分片数。
+const MaxShardCount = 256
+
+// JobDependency 表示任务之间的上下游依赖 (DAG 的一条边)：JobID 依赖 ParentJobID。
+type JobDependency struct {
+	gorm.Model
+	JobID       uint64 `gorm:"uniqueIndex:uk_job_parent;not null;comment:下游任务ID" json:"job_id"`
+	ParentJobID uint64 `gorm:"uniqueIndex:uk_job_parent;index;not null;comment:上游任务ID" json:"parent_job_id"`
+}
+
+// ErrDependencyCycle 依赖关系构成环。
+var ErrDependencyCycle = errors.New("job dependencies contain a cycle")
+
+// ValidateDependencies 校验为 jobID 设置 parents 后整张依赖图仍为 DAG。
+// edges 为当前全部依赖边，其中 jobID 原有的上游边会被 parents 替换。
+func ValidateDependencies(edges []*JobDependency, jobID uint64, parents []uint64) error {
+	graph := make(map[uint64][]uint64) // 下游 -> 上游
+	for _, e := range edges {
+		if e.JobID != jobID {
+			graph[e.JobID] = append(graph[e.JobID], e.ParentJobID)
+		}
+	}
+	for _, p := range parents {
+		if p == jobID {
+			return fmt.Errorf("job %d cannot depend on itself", jobID)
+		}
+		graph[jobID] = append(graph[jobID], p)
+	}
+
+	// 从 jobID 沿上游方向搜索，若能回到 jobID 则成环
+	visited := make(map[uint64]bool)
+	stack := append([]uint64(nil), graph[jobID]...)
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == jobID {
+			return ErrDependencyCycle
+		}
+		if visited[n] {
+			continue
+		}
+		visited[n] = true
+		stack = append(stack, graph[n]...)
+	}
+	return nil
+}
+
+// NewRunID 为一次 DAG 运行生成标识，同一次运行中所有下游任务与分片共享该标识。
+func NewRunID(jobID uint64, now time.Time) string {
+	return fmt.Sprintf("%d-%d", jobID, now.UnixNano())
+}
+
+// RunOutcome 汇总某任务在一次 DAG 运行中所有分片的结果。
+// done 表示所有分片均已结束，succeeded 表示所有分片均成功；被跳过的执行不算成功。
+func RunOutcome(logs []*JobLog, jobID uint64) (done, succeeded bool) {
+	found := false
+	succeeded = true
+	for _, l := range logs {
+		if l.JobID != jobID {
+			continue
+		}
+		found = true
+		switch l.Status {
+		case JobLogRunning:
+			return false, false
+		case JobLogFailed, JobLogSkipped:
+			succeeded = false
+		}
+	}
+	return found, found && succeeded
+}
+
+// DependencyWindowStart 返回下游任务的依赖窗口起点：上次运行时间，从未运行时为创建时间。
+// 每个上游在窗口内都至少成功运行一次后下游才触发，因此由不同 Cron 驱动的多个上游也能汇合。
+func (j *Job) DependencyWindowStart() time.Time {
+	if j.LastRunTime != nil {
+		return *j.LastRunTime
+	}
+	return j.CreatedAt
+}
+
+// SucceededInWindow 判断任务在依赖窗口内是否有一次所有分片均成功的运行。
+// logs 为窗口内开始的执行日志，按 RunID 归并为一次次运行后分别判断。
+func SucceededInWindow(logs []*JobLog, jobID uint64) bool {
+	runs := make(map[string][]*JobLog)
+	for _, l := range logs {
+		if l.JobID == jobID {
+			runs[l.RunID] = append(runs[l.RunID], l)
+		}
+	}
+	for _, run := range runs {
+		if _, succeeded := RunOutcome(run, jobID); succeeded {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSchedule 校验触发方式：有上游依赖的任务由上游成功后触发，不能再配置 Cron；
+// 无依赖的任务必须配置 Cron。
+func ValidateSchedule(cronExpr string, parents []uint64) error {
+	if len(parents) > 0 && cronExpr != "" {
+		return errors.New("jobs with dependencies are triggered by upstream jobs and must not have a cron expression")
+	}
+	if len(parents) == 0 && cronExpr == "" {
+		return errors.New("cron expression is required for jobs without dependencies")
+	}
+	return nil
+}
+
+// ValidateShardCount 校验分片数，0 视为不分片。
+func ValidateShardCount(n int) (int, error) {
+	if n < 0 || n > MaxShardCount {
+		return 0, fmt.Errorf("shard count must be between 1 and %d", MaxShardCount)
+	}
+	return max(n, 1), nil
+}
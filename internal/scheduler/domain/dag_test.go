@@ -0,0 +1,220 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	// 现有依赖：2 -> 1，3 -> 2，4 -> 1
+	edges := []*JobDependency{
+		{JobID: 2, ParentJobID: 1},
+		{JobID: 3, ParentJobID: 2},
+		{JobID: 4, ParentJobID: 1},
+	}
+	tests := []struct {
+		name    string
+		jobID   uint64
+		parents []uint64
+		wantErr error
+		anyErr  bool
+	}{
+		{name: "new parent", jobID: 4, parents: []uint64{1, 3}},
+		{name: "diamond", jobID: 5, parents: []uint64{3, 4}},
+		{name: "remove parents", jobID: 2},
+		{name: "self dependency", jobID: 3, parents: []uint64{3}, anyErr: true},
+		{name: "direct cycle", jobID: 1, parents: []uint64{2}, wantErr: ErrDependencyCycle},
+		{name: "transitive cycle", jobID: 1, parents: []uint64{3}, wantErr: ErrDependencyCycle},
+		// 2 原有的上游 1 被替换为 4，4 -> 1 不经过 2，不成环
+		{name: "replaced parents", jobID: 2, parents: []uint64{4}},
+		// 替换后 2 -> 3 -> 2 成环
+		{name: "replaced parents cycle", jobID: 2, parents: []uint64{3}, wantErr: ErrDependencyCycle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDependencies(edges, tt.jobID, tt.parents)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ValidateDependencies() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.anyErr:
+				if err == nil {
+					t.Fatal("expected error")
+				}
+			case err != nil:
+				t.Fatalf("ValidateDependencies() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRunOutcome(t *testing.T) {
+	shards := func(statuses ...string) []*JobLog {
+		logs := make([]*JobLog, len(statuses))
+		for i, s := range statuses {
+			logs[i] = &JobLog{JobID: 1, RunID: "r", ShardIndex: i, ShardTotal: len(statuses), Status: s}
+		}
+		return logs
+	}
+	tests := []struct {
+		name          string
+		logs          []*JobLog
+		wantDone      bool
+		wantSucceeded bool
+	}{
+		{name: "all shards succeeded", logs: shards(JobLogSuccess, JobLogSuccess, JobLogSuccess), wantDone: true, wantSucceeded: true},
+		{name: "one shard failed", logs: shards(JobLogSuccess, JobLogFailed, JobLogSuccess), wantDone: true},
+		{name: "one shard running", logs: shards(JobLogSuccess, JobLogRunning, JobLogFailed)},
+		{name: "skipped", logs: shards(JobLogSkipped), wantDone: true},
+		{name: "no logs"},
+		{name: "other job only", logs: []*JobLog{{JobID: 2, RunID: "r", Status: JobLogSuccess}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done, succeeded := RunOutcome(tt.logs, 1)
+			if done != tt.wantDone || succeeded != tt.wantSucceeded {
+				t.Fatalf("RunOutcome() = %v, %v, want %v, %v", done, succeeded, tt.wantDone, tt.wantSucceeded)
+			}
+		})
+	}
+}
+
+func TestSucceededInWindow(t *testing.T) {
+	// 下游任务 3 依赖每小时运行的任务 1 与每日运行的任务 2，两者各自以独立的 runID 运行
+	hourly := func(runID, status string) *JobLog {
+		return &JobLog{JobID: 1, RunID: runID, ShardTotal: 1, Status: status}
+	}
+	dailyShard := func(runID string, shard int, status string) *JobLog {
+		return &JobLog{JobID: 2, RunID: runID, ShardIndex: shard, ShardTotal: 2, Status: status}
+	}
+	tests := []struct {
+		name string
+		logs []*JobLog
+		want map[uint64]bool
+	}{
+		{
+			name: "parents on different crons converge",
+			logs: []*JobLog{
+				hourly("1-100", JobLogSuccess),
+				hourly("1-200", JobLogSuccess),
+				dailyShard("2-150", 0, JobLogSuccess),
+				dailyShard("2-150", 1, JobLogSuccess),
+			},
+			want: map[uint64]bool{1: true, 2: true},
+		},
+		{
+			name: "earlier success in window still counts",
+			logs: []*JobLog{
+				hourly("1-100", JobLogSuccess),
+				hourly("1-200", JobLogFailed),
+				dailyShard("2-150", 0, JobLogSuccess),
+				dailyShard("2-150", 1, JobLogSuccess),
+			},
+			want: map[uint64]bool{1: true, 2: true},
+		},
+		{
+			name: "failed shard blocks child",
+			logs: []*JobLog{
+				hourly("1-100", JobLogSuccess),
+				dailyShard("2-150", 0, JobLogSuccess),
+				dailyShard("2-150", 1, JobLogFailed),
+			},
+			want: map[uint64]bool{1: true, 2: false},
+		},
+		{
+			name: "running shard blocks child",
+			logs: []*JobLog{
+				hourly("1-100", JobLogSuccess),
+				dailyShard("2-150", 0, JobLogSuccess),
+				dailyShard("2-150", 1, JobLogRunning),
+			},
+			want: map[uint64]bool{1: true, 2: false},
+		},
+		{
+			name: "shards of different runs are not merged",
+			logs: []*JobLog{
+				dailyShard("2-150", 0, JobLogSuccess),
+				dailyShard("2-150", 1, JobLogFailed),
+				dailyShard("2-250", 0, JobLogFailed),
+				dailyShard("2-250", 1, JobLogSuccess),
+			},
+			want: map[uint64]bool{1: false, 2: false},
+		},
+		{
+			name: "retried run succeeds",
+			logs: []*JobLog{
+				dailyShard("2-150", 0, JobLogSuccess),
+				dailyShard("2-150", 1, JobLogFailed),
+				dailyShard("2-250", 0, JobLogSuccess),
+				dailyShard("2-250", 1, JobLogSuccess),
+			},
+			want: map[uint64]bool{1: false, 2: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for jobID, want := range tt.want {
+				if got := SucceededInWindow(tt.logs, jobID); got != want {
+					t.Fatalf("SucceededInWindow(job %d) = %v, want %v", jobID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDependencyWindowStart(t *testing.T) {
+	created := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	lastRun := created.Add(26 * time.Hour)
+
+	job := &Job{Model: gorm.Model{CreatedAt: created}}
+	if got := job.DependencyWindowStart(); !got.Equal(created) {
+		t.Fatalf("DependencyWindowStart() = %v, want creation time %v", got, created)
+	}
+	job.LastRunTime = &lastRun
+	if got := job.DependencyWindowStart(); !got.Equal(lastRun) {
+		t.Fatalf("DependencyWindowStart() = %v, want last run time %v", got, lastRun)
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		cron    string
+		parents []uint64
+		wantErr bool
+	}{
+		{name: "cron root", cron: "0 2 * * *"},
+		{name: "downstream", parents: []uint64{1}},
+		{name: "downstream with cron", cron: "0 2 * * *", parents: []uint64{1}, wantErr: true},
+		{name: "neither", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := ValidateSchedule(tt.cron, tt.parents); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateSchedule() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateShardCount(t *testing.T) {
+	tests := []struct {
+		n       int
+		want    int
+		wantErr bool
+	}{
+		{n: 0, want: 1},
+		{n: 1, want: 1},
+		{n: MaxShardCount, want: MaxShardCount},
+		{n: -1, wantErr: true},
+		{n: MaxShardCount + 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ValidateShardCount(tt.n)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ValidateShardCount(%d) = %d, %v, want %d", tt.n, got, err, tt.want)
+		}
+	}
+}
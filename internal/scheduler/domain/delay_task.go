@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrDelayTaskFinished 任务已投递或失败，不能再取消或覆盖。
+var ErrDelayTaskFinished = errors.New("delay task already finished")
+
+// DelayTaskStatus 定义了延迟任务的投递状态。
+type DelayTaskStatus int8
+
+const (
+	DelayTaskPending    DelayTaskStatus = 0 // 等待到期
+	DelayTaskDelivering DelayTaskStatus = 1 // 已被某个副本租约领取，投递中
+	DelayTaskDelivered  DelayTaskStatus = 2 // 已投递
+	DelayTaskCancelled  DelayTaskStatus = 3 // 已取消
+	DelayTaskFailed     DelayTaskStatus = 4 // 超过最大重试次数，投递失败
+)
+
+// DelayTask 实体代表一条持久化的延迟消息。
+// 业务方通过它将 Outbox 事件推迟到指定时间再投递到目标 Topic，
+// 数据落库后即使服务重启也不会丢失，多副本之间通过租约保证同一任务只被一个副本投递。
+type DelayTask struct {
+	gorm.Model
+	TaskKey       string          `gorm:"type:varchar(191);uniqueIndex;not null;comment:业务唯一键(幂等与取消)" json:"task_key"`
+	Source        string          `gorm:"type:varchar(64);index;comment:来源服务" json:"source"`
+	Topic         string          `gorm:"type:varchar(255);not null;comment:到期后投递的目标Topic" json:"topic"`
+	MsgKey        string          `gorm:"type:varchar(255);comment:消息键(用于分区)" json:"msg_key"`
+	Payload       []byte          `gorm:"type:blob;not null;comment:消息体" json:"payload"`
+	DeliverAt     time.Time       `gorm:"not null;comment:期望投递时间" json:"deliver_at"`
+	NextAttemptAt time.Time       `gorm:"index:idx_delay_status_next;not null;comment:下次尝试投递时间" json:"next_attempt_at"`
+	Status        DelayTaskStatus `gorm:"type:tinyint;index:idx_delay_status_next;not null;default:0;comment:状态" json:"status"`
+	RetryCount    int             `gorm:"not null;default:0;comment:已重试次数" json:"retry_count"`
+	MaxRetries    int             `gorm:"not null;default:10;comment:最大重试次数" json:"max_retries"`
+	LeaseOwner    string          `gorm:"type:varchar(128);comment:租约持有者" json:"lease_owner"`
+	LeaseUntil    *time.Time      `gorm:"comment:租约到期时间" json:"lease_until"`
+	DeliveredAt   *time.Time      `gorm:"comment:实际投递时间" json:"delivered_at"`
+	LastError     string          `gorm:"type:text;comment:最后一次错误信息" json:"last_error"`
+}
+
+// NewDelayTask 创建一个待投递的延迟任务。
+func NewDelayTask(taskKey, source, topic, msgKey string, payload []byte, deliverAt time.Time) *DelayTask {
+	return &DelayTask{
+		TaskKey:       taskKey,
+		Source:        source,
+		Topic:         topic,
+		MsgKey:        msgKey,
+		Payload:       payload,
+		DeliverAt:     deliverAt,
+		NextAttemptAt: deliverAt,
+		Status:        DelayTaskPending,
+		MaxRetries:    10,
+	}
+}
+
+// NewCancelledDelayTask 创建一条已取消的墓碑任务。
+// 登记与取消经不同 Topic 到达，取消可能先于登记被消费；墓碑占住业务唯一键，使随后到达的登记被忽略。
+func NewCancelledDelayTask(taskKey string) *DelayTask {
+	// 时间列为 not null，严格模式下不能写入零值日期
+	now := time.Now()
+	return &DelayTask{
+		TaskKey:       taskKey,
+		Payload:       []byte{},
+		Status:        DelayTaskCancelled,
+		DeliverAt:     now,
+		NextAttemptAt: now,
+		MaxRetries:    10,
+	}
+}
+
+// IsFinal 判断任务是否已处于终态 (已投递、已取消或失败)。
+func (t *DelayTask) IsFinal() bool {
+	return t.Status == DelayTaskDelivered || t.Status == DelayTaskCancelled || t.Status == DelayTaskFailed
+}
+
+// Reschedule 使用新的载荷和到期时间覆盖尚未投递的任务。
+func (t *DelayTask) Reschedule(topic, msgKey string, payload []byte, deliverAt time.Time) error {
+	if t.IsFinal() {
+		return ErrDelayTaskFinished
+	}
+	t.Topic = topic
+	t.MsgKey = msgKey
+	t.Payload = payload
+	t.DeliverAt = deliverAt
+	t.NextAttemptAt = deliverAt
+	t.Status = DelayTaskPending
+	t.RetryCount = 0
+	t.LeaseOwner = ""
+	t.LeaseUntil = nil
+	return nil
+}
+
+// Cancel 取消尚未投递的任务，已取消的任务重复调用为幂等操作。
+func (t *DelayTask) Cancel() error {
+	if t.Status == DelayTaskCancelled {
+		return nil
+	}
+	if t.IsFinal() {
+		return ErrDelayTaskFinished
+	}
+	t.Status = DelayTaskCancelled
+	t.LeaseOwner = ""
+	t.LeaseUntil = nil
+	return nil
+}
+
+// MarkDelivered 标记任务投递成功。
+func (t *DelayTask) MarkDelivered(now time.Time) {
+	t.Status = DelayTaskDelivered
+	t.DeliveredAt = &now
+	t.LeaseOwner = ""
+	t.LeaseUntil = nil
+	t.LastError = ""
+}
+
+// MarkAttemptFailed 记录一次投递失败，并按指数退避安排下次尝试；超过最大重试次数后进入失败终态。
+func (t *DelayTask) MarkAttemptFailed(now time.Time, cause error) {
+	t.RetryCount++
+	t.LastError = cause.Error()
+	t.LeaseOwner = ""
+	t.LeaseUntil = nil
+	if t.RetryCount >= t.MaxRetries {
+		t.Status = DelayTaskFailed
+		return
+	}
+	backoff := min(time.Duration(1<<uint(t.RetryCount))*5*time.Second, time.Hour)
+	t.Status = DelayTaskPending
+	t.NextAttemptAt = now.Add(backoff)
+}
+
+// Lag 返回任务实际投递相对期望到期时间的滞后。
+func (t *DelayTask) Lag(now time.Time) time.Duration {
+	return now.Sub(t.DeliverAt)
+}
@@ -0,0 +1,12 @@
+package domain
+
+import "context"
+
+// LeaderElector 定义了调度主节点选举的契约。
+// 多副本部署时只有主节点运行 Cron 触发循环，避免同一任务被多个副本重复触发。
+type LeaderElector interface {
+	// TryAcquireOrRenew 尝试成为主节点或续期已持有的租约，返回当前是否为主节点。
+	TryAcquireOrRenew(ctx context.Context) (bool, error)
+	// Resign 主动放弃主节点身份 (优雅关停时调用)。
+	Resign(ctx context.Context) error
+}
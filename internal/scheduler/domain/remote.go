@@ -0,0 +1,118 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// HandlerType 定义了任务处理器的类型。
+type HandlerType string
+
+const (
+	HandlerLocal HandlerType = "LOCAL" // 进程内注册的 Go 函数，Handler 为注册名
+	HandlerHTTP  HandlerType = "HTTP"  // HTTP 回调，Handler 为完整 URL
+	HandlerGRPC  HandlerType = "GRPC"  // gRPC 回调，Handler 为 "host:port" 或 "host:port/package.Service/Method"
+)
+
+// RetryPolicy 远程调用的超时与重试策略。
+type RetryPolicy struct {
+	Timeout     time.Duration // 单次调用超时
+	MaxRetries  int           // 失败后的最大重试次数 (不含首次调用)
+	BaseBackoff time.Duration // 首次重试退避时长，之后按指数增长
+}
+
+// DefaultRetryPolicy 任务未配置时使用的默认策略。
+var DefaultRetryPolicy = RetryPolicy{
+	Timeout:     30 * time.Second,
+	MaxRetries:  0,
+	BaseBackoff: time.Second,
+}
+
+// Backoff 返回第 attempt 次重试 (从 1 开始) 前的退避时长，上限 5 分钟。
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	return min(p.BaseBackoff*time.Duration(1<<uint(attempt-1)), 5*time.Minute)
+}
+
+// RetryPolicy 返回任务配置的重试策略，未配置的字段回退为默认值。
+func (j *Job) RetryPolicy() RetryPolicy {
+	p := DefaultRetryPolicy
+	if j.TimeoutSeconds > 0 {
+		p.Timeout = time.Duration(j.TimeoutSeconds) * time.Second
+	}
+	if j.MaxRetries > 0 {
+		p.MaxRetries = j.MaxRetries
+	}
+	if j.RetryBackoffMs > 0 {
+		p.BaseBackoff = time.Duration(j.RetryBackoffMs) * time.Millisecond
+	}
+	return p
+}
+
+// IsRemote 判断任务是否由远程服务执行。
+func (j *Job) IsRemote() bool {
+	return j.HandlerType == HandlerHTTP || j.HandlerType == HandlerGRPC
+}
+
+// ValidateHandlerType 校验处理器类型，空值视为 LOCAL。
+func ValidateHandlerType(t HandlerType) (HandlerType, error) {
+	switch t {
+	case "":
+		return HandlerLocal, nil
+	case HandlerLocal, HandlerHTTP, HandlerGRPC:
+		return t, nil
+	default:
+		return "", fmt.Errorf("invalid handler type: %s", t)
+	}
+}
+
+// RemoteInvocation 是一次远程任务调用的上下文。
+type RemoteInvocation struct {
+	JobID          uint64
+	JobName        string
+	LogID          uint64
+	Params         string
+	IdempotencyKey string // 同一次执行的所有重试共享该键，被调方据此去重
+	Attempt        int
+	ScheduledTime  *time.Time
+	RunID          string
+	ShardIndex     int // 分片序号，从 0 开始
+	ShardTotal     int
+}
+
+// RemoteResult 是远程任务调用的返回。
+type RemoteResult struct {
+	Result string
+	// Async 为 true 表示被调方已受理但尚未完成，最终结果通过 ReportJobResult 回报。
+	Async bool
+}
+
+// RemoteInvoker 定义了远程任务调用的契约。
+type RemoteInvoker interface {
+	Invoke(ctx context.Context, target string, inv *RemoteInvocation) (*RemoteResult, error)
+}
+
+// terminalError 标记不可重试的远程调用错误 (如参数错误、目标不存在)。
+type terminalError struct {
+	err error
+}
+
+func (e *terminalError) Error() string { return e.err.Error() }
+func (e *terminalError) Unwrap() error { return e.err }
+
+// NewTerminalError 将错误包装为不可重试错误。
+func NewTerminalError(err error) error {
+	return &terminalError{err: err}
+}
+
+// IsRetryable 判断远程调用错误是否可以重试。
+func IsRetryable(err error) bool {
+	var te *terminalError
+	return err != nil && !errors.As(err, &te)
+}
+
+// IdempotencyKeyFor 生成一次任务执行的幂等键。
+func IdempotencyKeyFor(jobID, logID uint64) string {
+	return fmt.Sprintf("scheduler-%d-%d", jobID, logID)
+}
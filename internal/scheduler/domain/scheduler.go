@@ -1,11 +1,15 @@
 package domain
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// ErrJobRunning 任务仍在运行，本次触发不会执行。
+var ErrJobRunning = errors.New("job is already running")
+
 // JobStatus 定义了定时任务的运行状态。
 type JobStatus int8
 
@@ -18,29 +22,79 @@ const (
 // Job 实体是定时任务模块的聚合根。
 type Job struct {
 	gorm.Model
-	Name        string     `gorm:"type:varchar(128);uniqueIndex;not null;comment:任务名称" json:"name"`
-	Description string     `gorm:"type:varchar(255);comment:任务描述" json:"description"`
-	CronExpr    string     `gorm:"type:varchar(64);not null;comment:Cron表达式" json:"cron_expr"`
-	Handler     string     `gorm:"type:varchar(128);not null;comment:处理器名称" json:"handler"`
-	Params      string     `gorm:"type:text;comment:参数" json:"params"`
-	Status      JobStatus  `gorm:"type:tinyint;not null;default:1;comment:状态" json:"status"`
-	LastRunTime *time.Time `gorm:"comment:上次运行时间" json:"last_run_time"`
-	NextRunTime *time.Time `gorm:"comment:下次运行时间" json:"next_run_time"`
-	RunCount    int64      `gorm:"not null;default:0;comment:运行次数" json:"run_count"`
-	FailCount   int64      `gorm:"not null;default:0;comment:失败次数" json:"fail_count"`
+	Name           string        `gorm:"type:varchar(128);uniqueIndex;not null;comment:任务名称" json:"name"`
+	Description    string        `gorm:"type:varchar(255);comment:任务描述" json:"description"`
+	CronExpr       string        `gorm:"type:varchar(64);not null;default:'';comment:Cron表达式(5段或带秒6段)，有上游依赖时为空" json:"cron_expr"`
+	HandlerType    HandlerType   `gorm:"type:varchar(16);not null;default:'LOCAL';comment:处理器类型(LOCAL,HTTP,GRPC)" json:"handler_type"`
+	Handler        string        `gorm:"type:varchar(255);not null;comment:处理器名称或远程目标地址" json:"handler"`
+	Params         string        `gorm:"type:text;comment:参数" json:"params"`
+	TimeoutSeconds int           `gorm:"not null;default:0;comment:远程调用超时(秒)" json:"timeout_seconds"`
+	MaxRetries     int           `gorm:"not null;default:0;comment:远程调用最大重试次数" json:"max_retries"`
+	RetryBackoffMs int           `gorm:"not null;default:0;comment:远程调用重试基础退避(毫秒)" json:"retry_backoff_ms"`
+	ShardCount     int           `gorm:"not null;default:1;comment:分片数" json:"shard_count"`
+	TimeZone       string        `gorm:"type:varchar(64);comment:Cron时区(IANA)" json:"time_zone"`
+	MisfirePolicy  MisfirePolicy `gorm:"type:varchar(16);not null;default:'FIRE_ONCE';comment:错过触发补偿策略" json:"misfire_policy"`
+	Status         JobStatus     `gorm:"type:tinyint;not null;default:1;comment:状态" json:"status"`
+	LastRunTime    *time.Time    `gorm:"comment:上次运行时间" json:"last_run_time"`
+	NextRunTime    *time.Time    `gorm:"index;comment:下次运行时间" json:"next_run_time"`
+	RunCount       int64         `gorm:"not null;default:0;comment:运行次数" json:"run_count"`
+	FailCount      int64         `gorm:"not null;default:0;comment:失败次数" json:"fail_count"`
+	DependsOn      []uint64      `gorm:"-" json:"depends_on"` // 上游任务ID，由 JobDependency 加载
 }
 
+// TriggerType 定义了任务执行的触发来源。
+type TriggerType string
+
+const (
+	TriggerManual TriggerType = "MANUAL" // 手动触发
+	TriggerCron   TriggerType = "CRON"   // Cron 周期触发
+	TriggerDAG    TriggerType = "DAG"    // 上游任务全部成功后触发
+)
+
+// 执行日志状态
+const (
+	JobLogRunning = "RUNNING"
+	JobLogSuccess = "SUCCESS"
+	JobLogFailed  = "FAILED"
+	JobLogSkipped = "SKIPPED" // 触发时任务仍在运行，本次未执行
+)
+
 // JobLog 实体代表一次定时任务的执行日志。
 type JobLog struct {
 	gorm.Model
-	JobID     uint64     `gorm:"index;not null;comment:任务ID" json:"job_id"`
-	JobName   string     `gorm:"type:varchar(128);not null;comment:任务名称" json:"job_name"`
-	Handler   string     `gorm:"type:varchar(128);not null;comment:处理器名称" json:"handler"`
-	Params    string     `gorm:"type:text;comment:参数" json:"params"`
-	Status    string     `gorm:"type:varchar(32);not null;comment:状态(RUNNING,SUCCESS,FAILED)" json:"status"`
-	Result    string     `gorm:"type:text;comment:执行结果" json:"result"`
-	Error     string     `gorm:"type:text;comment:错误信息" json:"error"`
-	Duration  int64      `gorm:"comment:耗时(ms)" json:"duration"`
-	StartTime time.Time  `gorm:"not null;comment:开始时间" json:"start_time"`
-	EndTime   *time.Time `gorm:"comment:结束时间" json:"end_time"`
+	JobID          uint64      `gorm:"index;not null;comment:任务ID" json:"job_id"`
+	JobName        string      `gorm:"type:varchar(128);not null;comment:任务名称" json:"job_name"`
+	Handler        string      `gorm:"type:varchar(255);not null;comment:处理器名称或远程目标地址" json:"handler"`
+	Params         string      `gorm:"type:text;comment:参数" json:"params"`
+	TriggerType    TriggerType `gorm:"type:varchar(16);not null;default:'MANUAL';comment:触发来源" json:"trigger_type"`
+	RunID          string      `gorm:"type:varchar(64);index;comment:DAG运行标识" json:"run_id"`
+	ShardIndex     int         `gorm:"not null;default:0;comment:分片序号" json:"shard_index"`
+	ShardTotal     int         `gorm:"not null;default:1;comment:分片总数" json:"shard_total"`
+	ScheduledTime  *time.Time  `gorm:"comment:计划触发时间(Cron)" json:"scheduled_time"`
+	IdempotencyKey string      `gorm:"type:varchar(64);index;comment:远程调用幂等键" json:"idempotency_key"`
+	Attempts       int         `gorm:"not null;default:0;comment:调用次数(含重试)" json:"attempts"`
+	Status         string      `gorm:"type:varchar(32);not null;comment:状态(RUNNING,SUCCESS,FAILED,SKIPPED)" json:"status"`
+	Result         string      `gorm:"type:text;comment:执行结果" json:"result"`
+	Error          string      `gorm:"type:text;comment:错误信息" json:"error"`
+	Duration       int64       `gorm:"comment:耗时(ms)" json:"duration"`
+	StartTime      time.Time   `gorm:"not null;comment:开始时间" json:"start_time"`
+	EndTime        *time.Time  `gorm:"comment:结束时间" json:"end_time"`
+}
+
+// NewSkippedJobLog 为未能执行的触发生成一条已结束的日志，使触发记录可追溯而不是被静默丢弃。
+func NewSkippedJobLog(job *Job, trigger TriggerType, scheduledTime *time.Time, runID, reason string, now time.Time) *JobLog {
+	return &JobLog{
+		JobID:         uint64(job.ID),
+		JobName:       job.Name,
+		Handler:       job.Handler,
+		Params:        job.Params,
+		TriggerType:   trigger,
+		ScheduledTime: scheduledTime,
+		RunID:         runID,
+		ShardTotal:    max(job.ShardCount, 1),
+		Status:        JobLogSkipped,
+		Error:         reason,
+		StartTime:     now,
+		EndTime:       &now,
+	}
 }
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"time"
 )
 
 // SchedulerRepository 是调度模块的仓储接口。
@@ -12,9 +13,47 @@ type SchedulerRepository interface {
 	GetJobByName(ctx context.Context, name string) (*Job, error)
 	ListJobs(ctx context.Context, status *JobStatus, offset, limit int) ([]*Job, int64, error)
 	DeleteJob(ctx context.Context, id uint64) error
+	// ListDueJobs 获取已启用且下次运行时间已到期 (或尚未计算) 的任务。
+	ListDueJobs(ctx context.Context, now time.Time, limit int) ([]*Job, error)
+	// AdvanceNextRunTime 以比较并交换方式推进下次运行时间，只有 expected 与当前值一致时才更新成功。
+	// 用于保证同一计划时间只会被一个调度副本触发。
+	AdvanceNextRunTime(ctx context.Context, id uint64, expected *time.Time, next time.Time) (bool, error)
+	// MarkJobRunning 以比较并交换方式将任务置为运行中并累加运行次数。
+	// 任务已在运行且上次运行时间晚于 staleBefore 时返回 false，保证同一任务不会被并发启动。
+	MarkJobRunning(ctx context.Context, id uint64, now, staleBefore time.Time) (bool, error)
+	// FinishJobRun 将运行中的任务恢复为启用状态，failed 为 true 时累加失败次数。
+	// 仅有一个调用方能成功 (返回 true)，用于分片全部结束后的唯一收尾。
+	FinishJobRun(ctx context.Context, id uint64, failed bool) (bool, error)
+
+	// SaveJobWithDependencies 在同一事务中保存任务并以 parentIDs 整体替换其上游依赖，parentIDs 为 nil 时不修改依赖。
+	SaveJobWithDependencies(ctx context.Context, job *Job, parentIDs []uint64) error
+
+	// JobDependency
+	// ListJobDependencies 获取依赖边，jobIDs 为空时返回全部。
+	ListJobDependencies(ctx context.Context, jobIDs ...uint64) ([]*JobDependency, error)
+	// ListChildJobIDs 获取直接依赖 parentID 的下游任务。
+	ListChildJobIDs(ctx context.Context, parentID uint64) ([]uint64, error)
 
 	// JobLog
 	SaveJobLog(ctx context.Context, log *JobLog) error
 	GetJobLog(ctx context.Context, id uint64) (*JobLog, error)
-	ListJobLogs(ctx context.Context, jobID uint64, offset, limit int) ([]*JobLog, int64, error)
+	// ListJobLogs 分页查询执行日志，jobID 为 0、runID 为空时不作过滤。
+	ListJobLogs(ctx context.Context, jobID uint64, runID string, offset, limit int) ([]*JobLog, int64, error)
+	// ListRunJobLogs 获取一次 DAG 运行的全部执行日志 (含所有任务与分片)。
+	ListRunJobLogs(ctx context.Context, runID string) ([]*JobLog, error)
+	// ListJobLogsSince 获取指定任务在 since 之后开始的全部执行日志 (含所有分片)。
+	ListJobLogsSince(ctx context.Context, jobIDs []uint64, since time.Time) ([]*JobLog, error)
+}
+
+// DelayTaskRepository 是延迟任务的仓储接口。
+type DelayTaskRepository interface {
+	// SaveDelayTask 保存延迟任务 (新建或更新)。
+	SaveDelayTask(ctx context.Context, task *DelayTask) error
+	// GetDelayTaskByKey 根据业务唯一键获取延迟任务，不存在时返回 nil。
+	GetDelayTaskByKey(ctx context.Context, taskKey string) (*DelayTask, error)
+	// ClaimDueDelayTasks 以租约方式领取已到期的任务 (包含租约已过期的投递中任务)。
+	// 实现必须保证同一任务在租约有效期内只会被一个 owner 领取。
+	ClaimDueDelayTasks(ctx context.Context, owner string, now time.Time, lease time.Duration, limit int) ([]*DelayTask, error)
+	// CountPendingDelayTasks 统计尚未投递的任务数量。
+	CountPendingDelayTasks(ctx context.Context) (int64, error)
 }
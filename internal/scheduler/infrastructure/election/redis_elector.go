@@ -0,0 +1,63 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
+)
+
+// renewScript 仅当租约仍由当前节点持有时续期。
+var renewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+else
+	return 0
+end
+`)
+
+// resignScript 仅当租约仍由当前节点持有时释放。
+var resignScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+else
+	return 0
+end
+`)
+
+// redisElector 基于 Redis SET NX PX 租约的主节点选举实现。
+type redisElector struct {
+	client *redis.Client
+	key    string
+	id     string
+	ttl    time.Duration
+}
+
+// NewRedisElector 创建 Redis 主节点选举器，ttl 为租约时长，调用方需以小于 ttl 的间隔续期。
+func NewRedisElector(client *redis.Client, key string, ttl time.Duration) domain.LeaderElector {
+	hostname, _ := os.Hostname()
+	return &redisElector{
+		client: client,
+		key:    key,
+		id:     fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		ttl:    ttl,
+	}
+}
+
+func (e *redisElector) TryAcquireOrRenew(ctx context.Context) (bool, error) {
+	renewed, err := renewScript.Run(ctx, e.client, []string{e.key}, e.id, e.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	if renewed == 1 {
+		return true, nil
+	}
+	return e.client.SetNX(ctx, e.key, e.id, e.ttl).Result()
+}
+
+func (e *redisElector) Resign(ctx context.Context) error {
+	return resignScript.Run(ctx, e.client, []string{e.key}, e.id).Err()
+}
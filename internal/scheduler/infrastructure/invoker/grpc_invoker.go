@@ -0,0 +1,113 @@
+package invoker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	pb "github.com/wyfcoding/ecommerce/goapi/scheduler/v1"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultExecuteMethod 目标未指定方法时调用的标准执行接口。
+var defaultExecuteMethod = pb.JobExecutorService_ExecuteJob_FullMethodName
+
+// GRPCInvoker 调用远程 gRPC 处理器。
+// 目标格式为 "host:port" (调用 JobExecutorService/ExecuteJob) 或 "host:port/package.Service/Method"，
+// 自定义方法的请求与响应类型须与 ExecuteJobRequest/ExecuteJobResponse 兼容。
+type GRPCInvoker struct {
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+// NewGRPCInvoker 创建 gRPC 调用器，连接按地址缓存复用。
+func NewGRPCInvoker() *GRPCInvoker {
+	return &GRPCInvoker{conns: make(map[string]*grpc.ClientConn)}
+}
+
+// Invoke 调用 target 指定的 gRPC 方法。
+func (i *GRPCInvoker) Invoke(ctx context.Context, target string, inv *domain.RemoteInvocation) (*domain.RemoteResult, error) {
+	addr, method := parseTarget(target)
+	if addr == "" {
+		return nil, domain.NewTerminalError(fmt.Errorf("invalid grpc target %q", target))
+	}
+	conn, err := i.conn(addr)
+	if err != nil {
+		return nil, domain.NewTerminalError(err)
+	}
+
+	req := &pb.ExecuteJobRequest{
+		JobId:          inv.JobID,
+		JobName:        inv.JobName,
+		LogId:          inv.LogID,
+		Params:         inv.Params,
+		IdempotencyKey: inv.IdempotencyKey,
+		Attempt:        int32(inv.Attempt),
+		RunId:          inv.RunID,
+		ShardIndex:     int32(inv.ShardIndex),
+		ShardTotal:     int32(inv.ShardTotal),
+	}
+	if inv.ScheduledTime != nil {
+		req.ScheduledTime = timestamppb.New(*inv.ScheduledTime)
+	}
+
+	resp := &pb.ExecuteJobResponse{}
+	if err := conn.Invoke(ctx, method, req, resp); err != nil {
+		if retryableCode(status.Code(err)) {
+			return nil, err
+		}
+		return nil, domain.NewTerminalError(err)
+	}
+	return &domain.RemoteResult{Result: resp.Result, Async: resp.Async}, nil
+}
+
+// Close 关闭所有缓存的连接。
+func (i *GRPCInvoker) Close() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for addr, conn := range i.conns {
+		_ = conn.Close()
+		delete(i.conns, addr)
+	}
+}
+
+func (i *GRPCInvoker) conn(addr string) (*grpc.ClientConn, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if conn, ok := i.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create grpc client for %s: %w", addr, err)
+	}
+	i.conns[addr] = conn
+	return conn, nil
+}
+
+// parseTarget 拆分地址与完整方法名。
+func parseTarget(target string) (addr, method string) {
+	idx := strings.Index(target, "/")
+	if idx < 0 {
+		return target, defaultExecuteMethod
+	}
+	return target[:idx], target[idx:]
+}
+
+// retryableCode 判断 gRPC 状态码是否属于可重试的瞬时错误。
+func retryableCode(code codes.Code) bool {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+var _ domain.RemoteInvoker = (*GRPCInvoker)(nil)
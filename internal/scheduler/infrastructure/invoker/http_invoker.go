@@ -0,0 +1,102 @@
+package invoker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
+)
+
+// maxResponseBytes 远程响应体读取上限，超出部分截断。
+const maxResponseBytes = 64 << 10
+
+// httpRequest 调度中心发往 HTTP 处理器的请求体。
+type httpRequest struct {
+	JobID          uint64     `json:"job_id"`
+	JobName        string     `json:"job_name"`
+	LogID          uint64     `json:"log_id"`
+	Params         string     `json:"params"`
+	IdempotencyKey string     `json:"idempotency_key"`
+	Attempt        int        `json:"attempt"`
+	ScheduledTime  *time.Time `json:"scheduled_time,omitempty"`
+	RunID          string     `json:"run_id"`
+	ShardIndex     int        `json:"shard_index"`
+	ShardTotal     int        `json:"shard_total"`
+}
+
+// httpResponse HTTP 处理器的响应体，202 或 async=true 表示异步受理。
+type httpResponse struct {
+	Result string `json:"result"`
+	Async  bool   `json:"async"`
+}
+
+// HTTPInvoker 以 POST JSON 方式调用远程 HTTP 处理器。
+// 幂等键同时通过 Idempotency-Key 请求头下发；5xx、429 与网络错误可重试，其余 4xx 视为终止错误。
+type HTTPInvoker struct {
+	client *http.Client
+}
+
+// NewHTTPInvoker 创建 HTTP 调用器，超时由调用方通过 context 控制。
+func NewHTTPInvoker() *HTTPInvoker {
+	return &HTTPInvoker{client: &http.Client{}}
+}
+
+// Invoke 调用 target 指定的 URL。
+func (i *HTTPInvoker) Invoke(ctx context.Context, target string, inv *domain.RemoteInvocation) (*domain.RemoteResult, error) {
+	body, err := json.Marshal(&httpRequest{
+		JobID:          inv.JobID,
+		JobName:        inv.JobName,
+		LogID:          inv.LogID,
+		Params:         inv.Params,
+		IdempotencyKey: inv.IdempotencyKey,
+		Attempt:        inv.Attempt,
+		ScheduledTime:  inv.ScheduledTime,
+		RunID:          inv.RunID,
+		ShardIndex:     inv.ShardIndex,
+		ShardTotal:     inv.ShardTotal,
+	})
+	if err != nil {
+		return nil, domain.NewTerminalError(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, domain.NewTerminalError(fmt.Errorf("invalid http target %q: %w", target, err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", inv.IdempotencyKey)
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return nil, fmt.Errorf("remote handler returned %d: %s", resp.StatusCode, raw)
+	case resp.StatusCode >= 400:
+		return nil, domain.NewTerminalError(fmt.Errorf("remote handler returned %d: %s", resp.StatusCode, raw))
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, domain.NewTerminalError(errors.New("unexpected status: " + resp.Status))
+	}
+
+	out := &domain.RemoteResult{Async: resp.StatusCode == http.StatusAccepted}
+	var parsed httpResponse
+	if len(raw) > 0 && json.Unmarshal(raw, &parsed) == nil {
+		out.Result = parsed.Result
+		out.Async = out.Async || parsed.Async
+	} else {
+		out.Result = string(raw)
+	}
+	return out, nil
+}
+
+var _ domain.RemoteInvoker = (*HTTPInvoker)(nil)
@@ -0,0 +1,80 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type delayTaskRepository struct {
+	db *gorm.DB
+}
+
+// NewDelayTaskRepository 创建并返回一个基于 MySQL 的延迟任务仓储。
+func NewDelayTaskRepository(db *gorm.DB) domain.DelayTaskRepository {
+	return &delayTaskRepository{db: db}
+}
+
+func (r *delayTaskRepository) SaveDelayTask(ctx context.Context, task *domain.DelayTask) error {
+	return r.db.WithContext(ctx).Save(task).Error
+}
+
+func (r *delayTaskRepository) GetDelayTaskByKey(ctx context.Context, taskKey string) (*domain.DelayTask, error) {
+	var task domain.DelayTask
+	if err := r.db.WithContext(ctx).Where("task_key = ?", taskKey).First(&task).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &task, nil
+}
+
+// ClaimDueDelayTasks 使用 SELECT ... FOR UPDATE SKIP LOCKED 领取到期任务并写入租约，
+// 多个副本并发扫描时互不阻塞，也不会重复领取同一条记录。
+func (r *delayTaskRepository) ClaimDueDelayTasks(ctx context.Context, owner string, now time.Time, lease time.Duration, limit int) ([]*domain.DelayTask, error) {
+	var tasks []*domain.DelayTask
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND lease_until < ?)",
+				domain.DelayTaskPending, now, domain.DelayTaskDelivering, now).
+			Order("next_attempt_at ASC").
+			Limit(limit).
+			Find(&tasks).Error; err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(tasks))
+		leaseUntil := now.Add(lease)
+		for i, t := range tasks {
+			ids[i] = t.ID
+			t.Status = domain.DelayTaskDelivering
+			t.LeaseOwner = owner
+			t.LeaseUntil = &leaseUntil
+		}
+		return tx.Model(&domain.DelayTask{}).Where("id IN ?", ids).Updates(map[string]any{
+			"status":      domain.DelayTaskDelivering,
+			"lease_owner": owner,
+			"lease_until": leaseUntil,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (r *delayTaskRepository) CountPendingDelayTasks(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&domain.DelayTask{}).
+		Where("status IN ?", []domain.DelayTaskStatus{domain.DelayTaskPending, domain.DelayTaskDelivering}).
+		Count(&count).Error
+	return count, err
+}
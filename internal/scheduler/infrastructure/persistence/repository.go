@@ -3,6 +3,7 @@ package persistence
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
 	"gorm.io/gorm"
@@ -66,7 +67,109 @@ func (r *schedulerRepository) ListJobs(ctx context.Context, status *domain.JobSt
 }
 
 func (r *schedulerRepository) DeleteJob(ctx context.Context, id uint64) error {
-	return r.db.WithContext(ctx).Delete(&domain.Job{}, id).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("job_id = ? OR parent_job_id = ?", id, id).Delete(&domain.JobDependency{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.Job{}, id).Error
+	})
+}
+
+func (r *schedulerRepository) ListDueJobs(ctx context.Context, now time.Time, limit int) ([]*domain.Job, error) {
+	var list []*domain.Job
+	err := r.db.WithContext(ctx).
+		Where("status IN ?", []domain.JobStatus{domain.JobStatusEnabled, domain.JobStatusRunning}).
+		Where("cron_expr <> ''").
+		Where("next_run_time IS NULL OR next_run_time <= ?", now).
+		Order("next_run_time ASC").
+		Limit(limit).
+		Find(&list).Error
+	return list, err
+}
+
+func (r *schedulerRepository) AdvanceNextRunTime(ctx context.Context, id uint64, expected *time.Time, next time.Time) (bool, error) {
+	db := r.db.WithContext(ctx).Model(&domain.Job{}).Where("id = ?", id)
+	if expected == nil {
+		db = db.Where("next_run_time IS NULL")
+	} else {
+		db = db.Where("next_run_time = ?", *expected)
+	}
+	res := db.Update("next_run_time", next)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *schedulerRepository) MarkJobRunning(ctx context.Context, id uint64, now, staleBefore time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&domain.Job{}).
+		Where("id = ?", id).
+		Where("status <> ? OR last_run_time IS NULL OR last_run_time < ?", domain.JobStatusRunning, staleBefore).
+		Updates(map[string]any{
+			"status":        domain.JobStatusRunning,
+			"last_run_time": now,
+			"run_count":     gorm.Expr("run_count + 1"),
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *schedulerRepository) FinishJobRun(ctx context.Context, id uint64, failed bool) (bool, error) {
+	updates := map[string]any{"status": domain.JobStatusEnabled}
+	if failed {
+		updates["fail_count"] = gorm.Expr("fail_count + 1")
+	}
+	res := r.db.WithContext(ctx).Model(&domain.Job{}).
+		Where("id = ? AND status = ?", id, domain.JobStatusRunning).
+		Updates(updates)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// --- 依赖管理 (JobDependency methods) ---
+
+func (r *schedulerRepository) SaveJobWithDependencies(ctx context.Context, job *domain.Job, parentIDs []uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(job).Error; err != nil {
+			return err
+		}
+		if parentIDs == nil {
+			return nil
+		}
+		if err := tx.Unscoped().Where("job_id = ?", job.ID).Delete(&domain.JobDependency{}).Error; err != nil {
+			return err
+		}
+		if len(parentIDs) == 0 {
+			return nil
+		}
+		deps := make([]*domain.JobDependency, len(parentIDs))
+		for i, p := range parentIDs {
+			deps[i] = &domain.JobDependency{JobID: uint64(job.ID), ParentJobID: p}
+		}
+		return tx.Create(&deps).Error
+	})
+}
+
+func (r *schedulerRepository) ListJobDependencies(ctx context.Context, jobIDs ...uint64) ([]*domain.JobDependency, error) {
+	var list []*domain.JobDependency
+	db := r.db.WithContext(ctx)
+	if len(jobIDs) > 0 {
+		db = db.Where("job_id IN ?", jobIDs)
+	}
+	err := db.Find(&list).Error
+	return list, err
+}
+
+func (r *schedulerRepository) ListChildJobIDs(ctx context.Context, parentID uint64) ([]uint64, error) {
+	var ids []uint64
+	err := r.db.WithContext(ctx).Model(&domain.JobDependency{}).
+		Where("parent_job_id = ?", parentID).
+		Pluck("job_id", &ids).Error
+	return ids, err
 }
 
 // --- 日志管理 (JobLog methods) ---
@@ -86,7 +189,7 @@ func (r *schedulerRepository) GetJobLog(ctx context.Context, id uint64) (*domain
 	return &log, nil
 }
 
-func (r *schedulerRepository) ListJobLogs(ctx context.Context, jobID uint64, offset, limit int) ([]*domain.JobLog, int64, error) {
+func (r *schedulerRepository) ListJobLogs(ctx context.Context, jobID uint64, runID string, offset, limit int) ([]*domain.JobLog, int64, error) {
 	var list []*domain.JobLog
 	var total int64
 
@@ -94,6 +197,9 @@ func (r *schedulerRepository) ListJobLogs(ctx context.Context, jobID uint64, off
 	if jobID > 0 {
 		db = db.Where("job_id = ?", jobID)
 	}
+	if runID != "" {
+		db = db.Where("run_id = ?", runID)
+	}
 
 	if err := db.Count(&total).Error; err != nil {
 		return nil, 0, err
@@ -105,3 +211,21 @@ func (r *schedulerRepository) ListJobLogs(ctx context.Context, jobID uint64, off
 
 	return list, total, nil
 }
+
+func (r *schedulerRepository) ListRunJobLogs(ctx context.Context, runID string) ([]*domain.JobLog, error) {
+	var list []*domain.JobLog
+	err := r.db.WithContext(ctx).Where("run_id = ?", runID).Order("id asc").Find(&list).Error
+	return list, err
+}
+
+func (r *schedulerRepository) ListJobLogsSince(ctx context.Context, jobIDs []uint64, since time.Time) ([]*domain.JobLog, error) {
+	var list []*domain.JobLog
+	if len(jobIDs) == 0 {
+		return list, nil
+	}
+	err := r.db.WithContext(ctx).
+		Where("job_id IN ? AND start_time > ?", jobIDs, since).
+		Order("id asc").
+		Find(&list).Error
+	return list, err
+}
@@ -0,0 +1,91 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	pb "github.com/wyfcoding/ecommerce/goapi/scheduler/v1"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/application"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/domain"
+)
+
+const (
+	// TopicDelaySchedule 各服务通过 Outbox 登记延迟消息的 Topic。
+	TopicDelaySchedule = "scheduler.delay.schedule"
+	// TopicDelayCancel 各服务通过 Outbox 取消延迟消息的 Topic。
+	TopicDelayCancel = "scheduler.delay.cancel"
+)
+
+// DelayHandler 消费其他服务经 Outbox 发来的延迟消息登记与取消事件。
+type DelayHandler struct {
+	app    *application.SchedulerService
+	logger *slog.Logger
+}
+
+// NewDelayHandler 构造函数。
+func NewDelayHandler(app *application.SchedulerService, logger *slog.Logger) *DelayHandler {
+	return &DelayHandler{
+		app:    app,
+		logger: logger,
+	}
+}
+
+// Handle 按 Topic 分发延迟消息事件。
+func (h *DelayHandler) Handle(ctx context.Context, msg kafka.Message) error {
+	switch msg.Topic {
+	case TopicDelaySchedule:
+		return h.handleSchedule(ctx, msg)
+	case TopicDelayCancel:
+		return h.handleCancel(ctx, msg)
+	default:
+		return nil
+	}
+}
+
+func (h *DelayHandler) handleSchedule(ctx context.Context, msg kafka.Message) error {
+	var req pb.ScheduleDelayEventRequest
+	if err := json.Unmarshal(msg.Value, &req); err != nil {
+		// 载荷无法解析时重试无意义，记录后跳过
+		h.logger.ErrorContext(ctx, "failed to unmarshal delay schedule event", "key", string(msg.Key), "error", err)
+		return nil
+	}
+	if req.TaskKey == "" || req.Topic == "" {
+		h.logger.ErrorContext(ctx, "invalid delay schedule event", "key", string(msg.Key))
+		return nil
+	}
+
+	if _, err := h.app.ScheduleDelayEvent(ctx, req.TaskKey, req.Source, req.Topic, req.Key, []byte(req.Payload), time.Unix(req.DeliverAt, 0)); err != nil {
+		h.logger.ErrorContext(ctx, "failed to schedule delay event", "task_key", req.TaskKey, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (h *DelayHandler) handleCancel(ctx context.Context, msg kafka.Message) error {
+	var req pb.CancelDelayEventRequest
+	if err := json.Unmarshal(msg.Value, &req); err != nil {
+		h.logger.ErrorContext(ctx, "failed to unmarshal delay cancel event", "key", string(msg.Key), "error", err)
+		return nil
+	}
+
+	if req.TaskKey == "" {
+		h.logger.ErrorContext(ctx, "invalid delay cancel event", "key", string(msg.Key))
+		return nil
+	}
+
+	if err := h.app.CancelDelayEvent(ctx, req.TaskKey); err != nil {
+		if errors.Is(err, domain.ErrDelayTaskFinished) {
+			// 任务已投递时取消无意义，仅记录
+			h.logger.WarnContext(ctx, "delay event already delivered, not cancelled", "task_key", req.TaskKey)
+			return nil
+		}
+		// 存储失败时不提交位点，重试以确保墓碑或取消状态落库
+		h.logger.ErrorContext(ctx, "failed to cancel delay event", "task_key", req.TaskKey, "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/wyfcoding/ecommerce/internal/scheduler/application"
+)
+
+// JobTriggerHandler 消费延迟队列到期投递的作业触发事件。
+type JobTriggerHandler struct {
+	app    *application.SchedulerService
+	logger *slog.Logger
+}
+
+// NewJobTriggerHandler 构造函数。
+func NewJobTriggerHandler(app *application.SchedulerService, logger *slog.Logger) *JobTriggerHandler {
+	return &JobTriggerHandler{
+		app:    app,
+		logger: logger,
+	}
+}
+
+// JobTriggerEvent 作业触发事件载荷。
+type JobTriggerEvent struct {
+	JobID uint64 `json:"job_id"`
+}
+
+// Handle 执行到期的延迟作业。
+func (h *JobTriggerHandler) Handle(ctx context.Context, msg kafka.Message) error {
+	var event JobTriggerEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		h.logger.ErrorContext(ctx, "failed to unmarshal job trigger event", "key", string(msg.Key), "error", err)
+		return nil
+	}
+
+	if err := h.app.RunJob(ctx, event.JobID); err != nil {
+		// 作业不存在或正在运行时不再重试，避免重复执行
+		h.logger.WarnContext(ctx, "delay job not executed", "job_id", event.JobID, "error", err)
+		return nil
+	}
+	h.logger.InfoContext(ctx, "delay job triggered", "job_id", event.JobID)
+	return nil
+}
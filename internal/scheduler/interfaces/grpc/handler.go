@@ -2,7 +2,9 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	pb "github.com/wyfcoding/ecommerce/goapi/scheduler/v1"
 	"github.com/wyfcoding/ecommerce/internal/scheduler/application"
@@ -26,7 +28,8 @@ func NewServer(app *application.SchedulerService) *Server {
 }
 
 func (s *Server) CreateJob(ctx context.Context, req *pb.CreateJobRequest) (*pb.CreateJobResponse, error) {
-	job, err := s.app.CreateJob(ctx, req.Name, req.Description, req.CronExpr, req.Handler, req.Params)
+	job, err := s.app.CreateJob(ctx, req.Name, req.Description, req.CronExpr, req.TimeZone, req.MisfirePolicy, req.HandlerType, req.Handler, req.Params,
+		int(req.TimeoutSeconds), int(req.MaxRetries), int(req.RetryBackoffMs), int(req.ShardCount), req.DependsOn)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to create job: %v", err))
 	}
@@ -37,7 +40,12 @@ func (s *Server) CreateJob(ctx context.Context, req *pb.CreateJobRequest) (*pb.C
 }
 
 func (s *Server) UpdateJob(ctx context.Context, req *pb.UpdateJobRequest) (*emptypb.Empty, error) {
-	if err := s.app.UpdateJob(ctx, req.Id, req.CronExpr, req.Params); err != nil {
+	var dependsOn []uint64
+	if req.UpdateDependencies {
+		dependsOn = append([]uint64{}, req.DependsOn...)
+	}
+	if err := s.app.UpdateJob(ctx, req.Id, req.CronExpr, req.TimeZone, req.MisfirePolicy, req.Params,
+		optionalInt(req.TimeoutSeconds), optionalInt(req.MaxRetries), optionalInt(req.RetryBackoffMs), optionalInt(req.ShardCount), dependsOn); err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to update job: %v", err))
 	}
 	return &emptypb.Empty{}, nil
@@ -93,7 +101,7 @@ func (s *Server) ListJobLogs(ctx context.Context, req *pb.ListJobLogsRequest) (*
 		pageSize = 10
 	}
 
-	logs, total, err := s.app.ListJobLogs(ctx, req.JobId, page, pageSize)
+	logs, total, err := s.app.ListJobLogs(ctx, req.JobId, req.RunId, page, pageSize)
 	if err != nil {
 		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to list job logs: %v", err))
 	}
@@ -109,6 +117,54 @@ func (s *Server) ListJobLogs(ctx context.Context, req *pb.ListJobLogsRequest) (*
 	}, nil
 }
 
+func (s *Server) ScheduleDelayEvent(ctx context.Context, req *pb.ScheduleDelayEventRequest) (*pb.ScheduleDelayEventResponse, error) {
+	if req.TaskKey == "" || req.Topic == "" || req.DeliverAt <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "task_key, topic and deliver_at are required")
+	}
+
+	task, err := s.app.ScheduleDelayEvent(ctx, req.TaskKey, req.Source, req.Topic, req.Key, []byte(req.Payload), time.Unix(req.DeliverAt, 0))
+	if err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to schedule delay event: %v", err))
+	}
+
+	return &pb.ScheduleDelayEventResponse{
+		TaskId: uint64(task.ID),
+		Status: int32(task.Status),
+	}, nil
+}
+
+func (s *Server) CancelDelayEvent(ctx context.Context, req *pb.CancelDelayEventRequest) (*emptypb.Empty, error) {
+	if req.TaskKey == "" {
+		return nil, status.Error(codes.InvalidArgument, "task_key is required")
+	}
+	if err := s.app.CancelDelayEvent(ctx, req.TaskKey); err != nil {
+		if errors.Is(err, domain.ErrDelayTaskFinished) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to cancel delay event: %v", err))
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *Server) ReportJobResult(ctx context.Context, req *pb.ReportJobResultRequest) (*emptypb.Empty, error) {
+	if req.LogId == 0 || req.IdempotencyKey == "" {
+		return nil, status.Error(codes.InvalidArgument, "log_id and idempotency_key are required")
+	}
+	if err := s.app.ReportJobResult(ctx, req.LogId, req.IdempotencyKey, req.Success, req.Result, req.Error); err != nil {
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to report job result: %v", err))
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// optionalInt 将 proto optional 字段转换为可空 int。
+func optionalInt(v *int32) *int {
+	if v == nil {
+		return nil
+	}
+	i := int(*v)
+	return &i
+}
+
 func convertJobToProto(j *domain.Job) *pb.Job {
 	if j == nil {
 		return nil
@@ -122,19 +178,27 @@ func convertJobToProto(j *domain.Job) *pb.Job {
 	}
 
 	return &pb.Job{
-		Id:          uint64(j.ID),
-		Name:        j.Name,
-		Description: j.Description,
-		CronExpr:    j.CronExpr,
-		Handler:     j.Handler,
-		Params:      j.Params,
-		Status:      int32(j.Status),
-		LastRunTime: lastRunTime,
-		NextRunTime: nextRunTime,
-		RunCount:    j.RunCount,
-		FailCount:   j.FailCount,
-		CreatedAt:   timestamppb.New(j.CreatedAt),
-		UpdatedAt:   timestamppb.New(j.UpdatedAt),
+		Id:             uint64(j.ID),
+		Name:           j.Name,
+		Description:    j.Description,
+		CronExpr:       j.CronExpr,
+		Handler:        j.Handler,
+		Params:         j.Params,
+		Status:         int32(j.Status),
+		LastRunTime:    lastRunTime,
+		NextRunTime:    nextRunTime,
+		RunCount:       j.RunCount,
+		FailCount:      j.FailCount,
+		CreatedAt:      timestamppb.New(j.CreatedAt),
+		UpdatedAt:      timestamppb.New(j.UpdatedAt),
+		TimeZone:       j.TimeZone,
+		MisfirePolicy:  string(j.MisfirePolicy),
+		HandlerType:    string(j.HandlerType),
+		TimeoutSeconds: int32(j.TimeoutSeconds),
+		MaxRetries:     int32(j.MaxRetries),
+		RetryBackoffMs: int32(j.RetryBackoffMs),
+		ShardCount:     int32(j.ShardCount),
+		DependsOn:      j.DependsOn,
 	}
 }
 
@@ -142,24 +206,34 @@ func convertJobLogToProto(l *domain.JobLog) *pb.JobLog {
 	if l == nil {
 		return nil
 	}
-	var endTime *timestamppb.Timestamp
+	var endTime, scheduledTime *timestamppb.Timestamp
 	if l.EndTime != nil {
 		endTime = timestamppb.New(*l.EndTime)
 	}
+	if l.ScheduledTime != nil {
+		scheduledTime = timestamppb.New(*l.ScheduledTime)
+	}
 
 	return &pb.JobLog{
-		Id:        uint64(l.ID),
-		JobId:     l.JobID,
-		JobName:   l.JobName,
-		Handler:   l.Handler,
-		Params:    l.Params,
-		Status:    l.Status,
-		Result:    l.Result,
-		Error:     l.Error,
-		Duration:  l.Duration,
-		StartTime: timestamppb.New(l.StartTime),
-		EndTime:   endTime,
-		CreatedAt: timestamppb.New(l.CreatedAt),
-		UpdatedAt: timestamppb.New(l.UpdatedAt),
+		Id:             uint64(l.ID),
+		JobId:          l.JobID,
+		JobName:        l.JobName,
+		Handler:        l.Handler,
+		Params:         l.Params,
+		Status:         l.Status,
+		Result:         l.Result,
+		Error:          l.Error,
+		Duration:       l.Duration,
+		StartTime:      timestamppb.New(l.StartTime),
+		EndTime:        endTime,
+		CreatedAt:      timestamppb.New(l.CreatedAt),
+		UpdatedAt:      timestamppb.New(l.UpdatedAt),
+		TriggerType:    string(l.TriggerType),
+		ScheduledTime:  scheduledTime,
+		IdempotencyKey: l.IdempotencyKey,
+		Attempts:       int32(l.Attempts),
+		RunId:          l.RunID,
+		ShardIndex:     int32(l.ShardIndex),
+		ShardTotal:     int32(l.ShardTotal),
 	}
 }
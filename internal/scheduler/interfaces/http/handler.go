@@ -27,11 +27,19 @@ func NewHandler(service *application.SchedulerService, logger *slog.Logger) *Han
 
 func (h *Handler) CreateJob(c *gin.Context) {
 	var req struct {
-		Name        string `json:"name" binding:"required"`
-		Description string `json:"description"`
-		CronExpr    string `json:"cron_expr" binding:"required"`
-		Handler     string `json:"handler" binding:"required"`
-		Params      string `json:"params"`
+		Name           string   `json:"name" binding:"required"`
+		Description    string   `json:"description"`
+		CronExpr       string   `json:"cron_expr"`
+		TimeZone       string   `json:"time_zone"`
+		MisfirePolicy  string   `json:"misfire_policy"`
+		HandlerType    string   `json:"handler_type"`
+		Handler        string   `json:"handler" binding:"required"`
+		Params         string   `json:"params"`
+		TimeoutSeconds int      `json:"timeout_seconds"`
+		MaxRetries     int      `json:"max_retries"`
+		RetryBackoffMs int      `json:"retry_backoff_ms"`
+		ShardCount     int      `json:"shard_count"`
+		DependsOn      []uint64 `json:"depends_on"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -39,7 +47,8 @@ func (h *Handler) CreateJob(c *gin.Context) {
 		return
 	}
 
-	job, err := h.service.CreateJob(c.Request.Context(), req.Name, req.Description, req.CronExpr, req.Handler, req.Params)
+	job, err := h.service.CreateJob(c.Request.Context(), req.Name, req.Description, req.CronExpr, req.TimeZone, req.MisfirePolicy, req.HandlerType, req.Handler, req.Params,
+		req.TimeoutSeconds, req.MaxRetries, req.RetryBackoffMs, req.ShardCount, req.DependsOn)
 	if err != nil {
 		h.logger.Error("Failed to create job", "error", err)
 		response.ErrorWithStatus(c, http.StatusInternalServerError, "Failed to create job", err.Error())
@@ -57,8 +66,15 @@ func (h *Handler) UpdateJob(c *gin.Context) {
 	}
 
 	var req struct {
-		CronExpr string `json:"cron_expr" binding:"required"`
-		Params   string `json:"params"`
+		CronExpr       string   `json:"cron_expr"`
+		TimeZone       string   `json:"time_zone"`
+		MisfirePolicy  string   `json:"misfire_policy"`
+		Params         string   `json:"params"`
+		TimeoutSeconds *int     `json:"timeout_seconds"`
+		MaxRetries     *int     `json:"max_retries"`
+		RetryBackoffMs *int     `json:"retry_backoff_ms"`
+		ShardCount     *int     `json:"shard_count"`
+		DependsOn      []uint64 `json:"depends_on"` // 缺省保持不变，空数组清除依赖
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -66,7 +82,8 @@ func (h *Handler) UpdateJob(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdateJob(c.Request.Context(), id, req.CronExpr, req.Params); err != nil {
+	if err := h.service.UpdateJob(c.Request.Context(), id, req.CronExpr, req.TimeZone, req.MisfirePolicy, req.Params,
+		req.TimeoutSeconds, req.MaxRetries, req.RetryBackoffMs, req.ShardCount, req.DependsOn); err != nil {
 		h.logger.Error("Failed to update job", "error", err)
 		response.ErrorWithStatus(c, http.StatusInternalServerError, "Failed to update job", err.Error())
 		return
@@ -173,7 +190,7 @@ func (h *Handler) ListJobLogs(c *gin.Context) {
 		pageSize = 10
 	}
 
-	list, total, err := h.service.ListJobLogs(c.Request.Context(), jobID, page, pageSize)
+	list, total, err := h.service.ListJobLogs(c.Request.Context(), jobID, c.Query("run_id"), page, pageSize)
 	if err != nil {
 		h.logger.Error("Failed to list job logs", "error", err)
 		response.ErrorWithStatus(c, http.StatusInternalServerError, "Failed to list job logs", err.Error())
@@ -188,6 +205,34 @@ func (h *Handler) ListJobLogs(c *gin.Context) {
 	})
 }
 
+// ReportJobResult 供远程处理器回报异步执行结果。
+func (h *Handler) ReportJobResult(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid Log ID", err.Error())
+		return
+	}
+
+	var req struct {
+		IdempotencyKey string `json:"idempotency_key" binding:"required"`
+		Success        bool   `json:"success"`
+		Result         string `json:"result"`
+		Error          string `json:"error"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if err := h.service.ReportJobResult(c.Request.Context(), id, req.IdempotencyKey, req.Success, req.Result, req.Error); err != nil {
+		h.logger.Error("Failed to report job result", "log_id", id, "error", err)
+		response.ErrorWithStatus(c, http.StatusInternalServerError, "Failed to report job result", err.Error())
+		return
+	}
+
+	response.SuccessWithStatus(c, http.StatusOK, "Job result reported successfully", nil)
+}
+
 func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 	group := r.Group("/scheduler")
 	{
@@ -197,5 +242,6 @@ func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 		group.POST("/jobs/:id/run", h.RunJob)
 		group.GET("/jobs", h.ListJobs)
 		group.GET("/logs", h.ListJobLogs)
+		group.POST("/logs/:id/result", h.ReportJobResult)
 	}
 }
@@ -0,0 +1,76 @@
+// Package jobexecutor 提供业务服务承接调度中心远程作业的 JobExecutorService 实现。
+// 各服务只需提供作业的业务执行体，幂等去重、并发互斥与失败重试语义统一在此处理。
+package jobexecutor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	schedulerv1 "github.com/wyfcoding/ecommerce/goapi/scheduler/v1"
+	"github.com/wyfcoding/pkg/idempotency"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// resultTTL 作业执行结果的保留时长，覆盖调度中心的重试窗口。
+const resultTTL = 72 * time.Hour
+
+// Func 是作业的业务执行体。scheduled 为计划触发时间 (请求未携带时取当前时间)，
+// 返回的结果描述回传调度中心并写入执行日志；返回错误时由调度中心按作业的重试策略重新调用。
+type Func func(ctx context.Context, scheduled time.Time) (string, error)
+
+// Server 实现调度中心的 JobExecutorService，以幂等键保证同一次触发只执行一次业务逻辑。
+type Server struct {
+	schedulerv1.UnimplementedJobExecutorServiceServer
+	idem idempotency.Manager
+	run  Func
+}
+
+// NewServer 创建作业执行器。
+func NewServer(idem idempotency.Manager, run Func) *Server {
+	return &Server{idem: idem, run: run}
+}
+
+// ExecuteJob 执行一次作业，相同幂等键的重复调用直接返回首次成功的结果。
+// 同一幂等键正在执行时返回 Aborted；执行失败时清除幂等记录并返回 Unavailable，以便调度中心重试。
+func (s *Server) ExecuteJob(ctx context.Context, req *schedulerv1.ExecuteJobRequest) (*schedulerv1.ExecuteJobResponse, error) {
+	if req.IdempotencyKey == "" {
+		return nil, status.Error(codes.InvalidArgument, "idempotency_key is required")
+	}
+	start := time.Now()
+	slog.Info("gRPC ExecuteJob received", "job_name", req.JobName, "log_id", req.LogId, "attempt", req.Attempt)
+
+	key := "job:" + req.IdempotencyKey
+	first, saved, err := s.idem.TryStart(ctx, key, resultTTL)
+	if err != nil {
+		if errors.Is(err, idempotency.ErrInProgress) {
+			return nil, status.Error(codes.Aborted, "job execution already in progress")
+		}
+		return nil, status.Error(codes.Unavailable, fmt.Sprintf("idempotency check failed: %v", err))
+	}
+	if !first {
+		return &schedulerv1.ExecuteJobResponse{Result: saved.Body}, nil
+	}
+
+	scheduled := time.Now()
+	if req.ScheduledTime != nil {
+		scheduled = req.ScheduledTime.AsTime()
+	}
+	result, err := s.run(ctx, scheduled)
+	if err != nil {
+		_ = s.idem.Delete(ctx, key)
+		slog.Error("gRPC ExecuteJob failed", "job_name", req.JobName, "error", err, "duration", time.Since(start))
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	if err := s.idem.Finish(ctx, key, &idempotency.Response{StatusCode: http.StatusOK, Body: result}, resultTTL); err != nil {
+		slog.Warn("failed to save job execution result", "job_name", req.JobName, "error", err)
+	}
+	slog.Info("gRPC ExecuteJob successful", "job_name", req.JobName, "result", result, "duration", time.Since(start))
+	return &schedulerv1.ExecuteJobResponse{Result: result}, nil
+}
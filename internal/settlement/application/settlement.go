@@ -33,8 +33,16 @@ func (s *SettlementService) SetRemoteAccountClient(cli accountv1.AccountServiceC
 
 // --- Manager (Writes) ---
 
-func (s *SettlementService) RecordPaymentSuccess(ctx context.Context, orderID uint64, orderNo string, merchantID uint64, amount int64, channelCost int64) error {
-	return s.manager.RecordPaymentSuccess(ctx, orderID, orderNo, merchantID, amount, channelCost)
+func (s *SettlementService) RecordPaymentSuccess(ctx context.Context, orderID uint64, orderNo string, merchantID uint64, amount int64, channelCost int64, fx *domain.FXConversion, splits []domain.SplitShare) error {
+	return s.manager.RecordPaymentSuccess(ctx, orderID, orderNo, merchantID, amount, channelCost, fx, splits)
+}
+
+func (s *SettlementService) RecordSplitExecuted(ctx context.Context, paymentNo, currency string, split domain.SplitShare) error {
+	return s.manager.RecordSplitExecuted(ctx, paymentNo, currency, split)
+}
+
+func (s *SettlementService) RecordSplitReversed(ctx context.Context, returnNo, refundNo, currency string, gateway bool, split domain.SplitShare) error {
+	return s.manager.RecordSplitReversed(ctx, returnNo, refundNo, currency, gateway, split)
 }
 
 func (s *SettlementService) CreateSettlement(ctx context.Context, merchantID uint64, cycle string, startDate, endDate time.Time) (*domain.Settlement, error) {
@@ -53,6 +61,10 @@ func (s *SettlementService) CompleteSettlement(ctx context.Context, id uint64) e
 	return s.manager.CompleteSettlement(ctx, id)
 }
 
+func (s *SettlementService) RunSettlementCycle(ctx context.Context, cutoff time.Time) (int, error) {
+	return s.manager.RunSettlementCycle(ctx, cutoff)
+}
+
 // --- Query (Reads) ---
 
 func (s *SettlementService) GetMerchantAccount(ctx context.Context, merchantID uint64) (*domain.MerchantAccount, error) {
@@ -33,76 +33,171 @@ func (m *SettlementManager) SetRemoteAccountClient(cli accountv1.AccountServiceC
 }
 
 // RecordPaymentSuccess 记录支付成功事件 (核心清分与记账逻辑)。
-func (m *SettlementManager) RecordPaymentSuccess(ctx context.Context, orderID uint64, orderNo string, merchantID uint64, amount int64, channelCost int64) error {
-	m.logger.InfoContext(ctx, "processing payment success for settlement", "order_no", orderNo, "amount", amount)
+// amount 为记账币种金额；外币交易的 fx 记录锁定汇率与入账汇率下的折算金额，差额计入汇兑损益，fx 为 nil 时为本币交易。
+// splits 为支付服务扣款时生成的分账明细，按接收方逐条入账；未携带分账明细时按 merchantID 的商户费率清分。
+func (m *SettlementManager) RecordPaymentSuccess(ctx context.Context, orderID uint64, orderNo string, merchantID uint64, amount int64, channelCost int64, fx *domain.FXConversion, splits []domain.SplitShare) error {
+	m.logger.InfoContext(ctx, "processing payment success for settlement", "order_no", orderNo, "amount", amount, "splits", len(splits))
 
-	// 1. 获取商户费率配置
-	account, err := m.repo.GetMerchantAccount(ctx, merchantID)
-	if err != nil {
-		return err
-	}
-	feeRate := 0.0
-	if account != nil {
-		feeRate = account.FeeRate
-	} else {
-		feeRate = 0.006 // 默认0.6%
+	// 1. 清分计算 (Clearing)：商户应收与平台佣金按锁定汇率折算的金额计算，汇率波动由平台承担
+	if len(splits) == 0 {
+		// 获取商户费率配置
+		account, err := m.repo.GetMerchantAccount(ctx, merchantID)
+		if err != nil {
+			return err
+		}
+		feeBps := domain.DefaultFeeBps
+		if account != nil {
+			feeBps = account.FeeBps()
+		}
+		platformFee := domain.FeeOf(amount, feeBps)
+		splits = []domain.SplitShare{
+			{RecipientType: domain.SplitRecipientMerchant, RecipientID: merchantID, Amount: amount - platformFee},
+			{RecipientType: domain.SplitRecipientPlatform, Amount: platformFee},
+		}
 	}
 
-	// 2. 清分计算 (Clearing)
-	platformFee := int64(float64(amount) * feeRate)
-	merchantReceivable := amount - platformFee
+	// 渠道入账金额按入账时汇率折算，与锁定金额的差额为汇兑损益
+	currency := "CNY"
+	settledAmount := amount
+	var fxGainLoss int64
+	if fx != nil {
+		currency = fx.SettlementCurrency
+		settledAmount = fx.SettledAmount
+		fxGainLoss = fx.GainLoss()
+	}
 
-	// 3. 构造会计分录 (Accounting)
+	// 2. 构造会计分录 (Accounting)：渠道收款记借方，各分账接收方应付款项与平台佣金收入记贷方
 	entry := &domain.JournalEntry{
 		TransactionID: orderNo,
 		EventType:     "PAYMENT_SUCCESS",
 		Description:   fmt.Sprintf("Payment for Order %s", orderNo),
 		PostingDate:   time.Now(),
+		Currency:      currency,
 		Lines: []domain.EntryLine{
 			{
 				SubjectCode: "1001",
 				AccountID:   m.getAccountID("1001", "CHANNEL_GLOBAL"),
 				Direction:   domain.Debit,
-				Amount:      amount,
-			},
-			{
-				SubjectCode: "2001",
-				AccountID:   m.getAccountID("2001", fmt.Sprintf("MERCH_%d", merchantID)),
-				Direction:   domain.Credit,
-				Amount:      merchantReceivable,
-			},
-			{
-				SubjectCode: "6001",
-				AccountID:   m.getAccountID("6001", "PLATFORM_MAIN"),
-				Direction:   domain.Credit,
-				Amount:      platformFee,
+				Amount:      settledAmount,
 			},
 		},
 	}
+	for _, split := range splits {
+		if split.Amount <= 0 {
+			continue
+		}
+		subject, entity := domain.SplitSubject(split.RecipientType, split.RecipientID)
+		entry.Lines = append(entry.Lines, domain.EntryLine{
+			SubjectCode: subject,
+			AccountID:   m.getAccountID(subject, entity),
+			Direction:   domain.Credit,
+			Amount:      split.Amount,
+		})
+	}
+	if fx != nil {
+		entry.TxnCurrency = fx.TxnCurrency
+		entry.TxnAmount = fx.TxnAmount
+		entry.FXRate = fx.Rate
+	}
+	// 汇兑损益 (6061)：收益记贷方，损失记借方
+	switch {
+	case fxGainLoss > 0:
+		entry.Lines = append(entry.Lines, domain.EntryLine{
+			SubjectCode: "6061",
+			AccountID:   m.getAccountID("6061", "PLATFORM_FX"),
+			Direction:   domain.Credit,
+			Amount:      fxGainLoss,
+		})
+	case fxGainLoss < 0:
+		entry.Lines = append(entry.Lines, domain.EntryLine{
+			SubjectCode: "6061",
+			AccountID:   m.getAccountID("6061", "PLATFORM_FX"),
+			Direction:   domain.Debit,
+			Amount:      -fxGainLoss,
+		})
+	}
 
-	// 4. 调用账务核心记账
+	// 3. 调用账务核心记账
 	if err := m.ledgerService.PostEntry(ctx, entry); err != nil {
 		m.logger.ErrorContext(ctx, "failed to post ledger entry", "order_id", orderID, "error", err)
 		return err
 	}
 
-	// 5. 跨项目同步 (Cross-Project Interaction)
+	// 4. 跨项目同步 (Cross-Project Interaction)
 	// 假设商户在 FinancialTrading 系统中也有对应的交易账户 (UserID = MerchantID)
 	if m.remoteAccountCli != nil {
-		_, err := m.remoteAccountCli.Deposit(ctx, &accountv1.DepositRequest{
-			UserId:   fmt.Sprintf("%d", merchantID),
-			Amount:   fmt.Sprintf("%d", merchantReceivable),
-			Currency: "USD",
-		})
-		if err != nil {
-			m.logger.ErrorContext(ctx, "failed to sync settlement to financial account", "merchant_id", merchantID, "error", err)
-			// 注意：此时本地账务已完成，跨项目失败可记录日志后补偿，此处不强制阻塞
-		} else {
-			m.logger.InfoContext(ctx, "settlement synced to financial account successfully", "merchant_id", merchantID)
+		for _, split := range splits {
+			if split.RecipientType != domain.SplitRecipientMerchant || split.Amount <= 0 {
+				continue
+			}
+			_, err := m.remoteAccountCli.Deposit(ctx, &accountv1.DepositRequest{
+				UserId:   fmt.Sprintf("%d", split.RecipientID),
+				Amount:   fmt.Sprintf("%d", split.Amount),
+				Currency: currency,
+			})
+			if err != nil {
+				m.logger.ErrorContext(ctx, "failed to sync settlement to financial account", "merchant_id", split.RecipientID, "error", err)
+				// 注意：此时本地账务已完成，跨项目失败可记录日志后补偿，此处不强制阻塞
+			} else {
+				m.logger.InfoContext(ctx, "settlement synced to financial account successfully", "merchant_id", split.RecipientID)
+			}
 		}
 	}
 
-	m.logger.InfoContext(ctx, "payment recorded in ledger", "entry_no", entry.EntryNo)
+	m.logger.InfoContext(ctx, "payment recorded in ledger", "entry_no", entry.EntryNo, "currency", currency, "fx_gain_loss", fxGainLoss)
+	return nil
+}
+
+// RecordSplitExecuted 记录渠道分账到账：资金已由渠道直接划转到接收方，冲减其应付款项与渠道存款。
+func (m *SettlementManager) RecordSplitExecuted(ctx context.Context, paymentNo, currency string, split domain.SplitShare) error {
+	subject, entity := domain.SplitSubject(split.RecipientType, split.RecipientID)
+	entry := &domain.JournalEntry{
+		TransactionID: split.SplitNo,
+		EventType:     "SPLIT_EXECUTED",
+		Description:   fmt.Sprintf("Gateway profit sharing %s for payment %s", split.SplitNo, paymentNo),
+		PostingDate:   time.Now(),
+		Currency:      currency,
+		Lines: []domain.EntryLine{
+			{SubjectCode: subject, AccountID: m.getAccountID(subject, entity), Direction: domain.Debit, Amount: split.Amount},
+			{SubjectCode: "1001", AccountID: m.getAccountID("1001", "CHANNEL_GLOBAL"), Direction: domain.Credit, Amount: split.Amount},
+		},
+	}
+	if err := m.ledgerService.PostEntry(ctx, entry); err != nil {
+		m.logger.ErrorContext(ctx, "failed to post split execution entry", "split_no", split.SplitNo, "error", err)
+		return err
+	}
+	m.logger.InfoContext(ctx, "split execution recorded in ledger", "split_no", split.SplitNo, "entry_no", entry.EntryNo)
+	return nil
+}
+
+// RecordSplitReversed 记录退款引起的分账回退：退款金额按分账比例由各接收方承担，冲减其应付款项 (平台佣金冲减收入)。
+// 渠道分账回退时资金先由接收方退回渠道存款，再随退款付出，同时登记两组分录。
+func (m *SettlementManager) RecordSplitReversed(ctx context.Context, returnNo, refundNo, currency string, gateway bool, split domain.SplitShare) error {
+	subject, entity := domain.SplitSubject(split.RecipientType, split.RecipientID)
+	accountID := m.getAccountID(subject, entity)
+	channelID := m.getAccountID("1001", "CHANNEL_GLOBAL")
+	entry := &domain.JournalEntry{
+		TransactionID: returnNo,
+		EventType:     "SPLIT_REVERSED",
+		Description:   fmt.Sprintf("Split %s reversed by refund %s", split.SplitNo, refundNo),
+		PostingDate:   time.Now(),
+		Currency:      currency,
+	}
+	if gateway {
+		entry.Lines = append(entry.Lines,
+			domain.EntryLine{SubjectCode: "1001", AccountID: channelID, Direction: domain.Debit, Amount: split.Amount},
+			domain.EntryLine{SubjectCode: subject, AccountID: accountID, Direction: domain.Credit, Amount: split.Amount},
+		)
+	}
+	entry.Lines = append(entry.Lines,
+		domain.EntryLine{SubjectCode: subject, AccountID: accountID, Direction: domain.Debit, Amount: split.Amount},
+		domain.EntryLine{SubjectCode: "1001", AccountID: channelID, Direction: domain.Credit, Amount: split.Amount},
+	)
+	if err := m.ledgerService.PostEntry(ctx, entry); err != nil {
+		m.logger.ErrorContext(ctx, "failed to post split reversal entry", "return_no", returnNo, "error", err)
+		return err
+	}
+	m.logger.InfoContext(ctx, "split reversal recorded in ledger", "return_no", returnNo, "refund_no", refundNo, "entry_no", entry.EntryNo)
 	return nil
 }
 
@@ -151,12 +246,12 @@ func (m *SettlementManager) AddOrderToSettlement(ctx context.Context, settlement
 	if err != nil {
 		return err
 	}
-	feeRate := 0.0
+	var feeBps int64
 	if account != nil {
-		feeRate = account.FeeRate
+		feeBps = account.FeeBps()
 	}
 
-	platformFee := uint64(float64(amount) * feeRate / 100)
+	platformFee := uint64(domain.FeeOf(int64(amount), feeBps))
 	settlementAmount := amount - platformFee
 
 	detail := &domain.SettlementDetail{
@@ -234,3 +329,51 @@ func (m *SettlementManager) CompleteSettlement(ctx context.Context, id uint64) e
 	settlement.SettledAt = &now
 	return m.repo.SaveSettlement(ctx, settlement)
 }
+
+// settlementCycleBatch 结算周期作业每次拉取的到期结算单数量。
+const settlementCycleBatch = 200
+
+// RunSettlementCycle 处理结束日期不晚于 cutoff 的全部到期结算单：待结算的先转入结算中，再完成入账。
+// 上次中断在结算中的结算单会被继续完成，单个结算单失败不影响其余结算单，失败的结算单由调度中心重试作业时重新处理。
+func (m *SettlementManager) RunSettlementCycle(ctx context.Context, cutoff time.Time) (completed int, err error) {
+	var (
+		errs   []error
+		failed = make(map[uint]struct{})
+	)
+	for {
+		list, err := m.repo.ListDueSettlements(ctx, cutoff, settlementCycleBatch+len(failed))
+		if err != nil {
+			return completed, err
+		}
+		attempted := false
+		for _, settlement := range list {
+			if _, ok := failed[settlement.ID]; ok {
+				continue
+			}
+			attempted = true
+			if err := m.settle(ctx, settlement); err != nil {
+				m.logger.ErrorContext(ctx, "failed to settle due settlement", "settlement_no", settlement.SettlementNo, "error", err)
+				failed[settlement.ID] = struct{}{}
+				errs = append(errs, fmt.Errorf("settlement %s: %w", settlement.SettlementNo, err))
+				continue
+			}
+			completed++
+		}
+		if !attempted || len(list) < settlementCycleBatch+len(failed) {
+			break
+		}
+	}
+	m.logger.InfoContext(ctx, "settlement cycle finished", "cutoff", cutoff, "completed", completed, "failed", len(errs))
+	return completed, errors.Join(errs...)
+}
+
+// settle 推进单个到期结算单至完成。
+func (m *SettlementManager) settle(ctx context.Context, settlement *domain.Settlement) error {
+	id := uint64(settlement.ID)
+	if settlement.Status == domain.SettlementStatusPending {
+		if err := m.ProcessSettlement(ctx, id); err != nil {
+			return err
+		}
+	}
+	return m.CompleteSettlement(ctx, id)
+}
@@ -3,6 +3,7 @@ package domain
 import (
 	"context"
 	"fmt"
+	"math"
 	"time"
 
 	"gorm.io/gorm"
@@ -68,6 +69,19 @@ type MerchantAccount struct {
 	FeeRate       float64 `gorm:"type:decimal(5,2);not null;default:0;comment:费率(%)" json:"fee_rate"`
 }
 
+// DefaultFeeBps 未配置商户账户时的平台手续费率，单位为基点 (万分之一)。
+const DefaultFeeBps int64 = 60
+
+// FeeBps 将以百分比存储的费率 (保留两位小数) 换算为基点。
+func (a *MerchantAccount) FeeBps() int64 {
+	return int64(math.Round(a.FeeRate * 100))
+}
+
+// FeeOf 按基点计算手续费，四舍五入到最小货币单位。
+func FeeOf(amount, bps int64) int64 {
+	return (amount*bps + 5000) / 10000
+}
+
 func (a *MerchantAccount) AvailableBalance() uint64 {
 	if a.Balance < a.FrozenBalance {
 		return 0
@@ -117,9 +131,56 @@ type JournalEntry struct {
 	EventType     string      `gorm:"type:varchar(32);not null;comment:事件类型" json:"event_type"`
 	PostingDate   time.Time   `gorm:"index;not null;comment:入账日期" json:"posting_date"`
 	Description   string      `gorm:"type:varchar(255);comment:摘要" json:"description"`
+	Currency      string      `gorm:"type:varchar(3);default:'CNY';comment:记账币种" json:"currency"`
+	TxnCurrency   string      `gorm:"type:varchar(3);comment:交易币种" json:"txn_currency"`
+	TxnAmount     int64       `gorm:"not null;default:0;comment:交易币种金额(最小货币单位)" json:"txn_amount"`
+	FXRate        string      `gorm:"type:varchar(32);comment:锁定汇率" json:"fx_rate"`
 	Lines         []EntryLine `gorm:"foreignKey:EntryID" json:"lines"`
 }
 
+// FXConversion 外币交易折算为记账币种的明细。
+// BookedAmount 为按支付发起时锁定汇率折算的金额，SettledAmount 为渠道入账时按当时汇率折算的金额，二者之差为汇兑损益。
+type FXConversion struct {
+	TxnCurrency        string // 交易币种
+	TxnAmount          int64  // 交易币种金额 (最小货币单位)
+	SettlementCurrency string // 记账币种
+	Rate               string // 锁定汇率
+	BookedAmount       int64  // 按锁定汇率折算的记账币种金额
+	SettledAmount      int64  // 渠道实际入账的记账币种金额
+}
+
+// GainLoss 汇兑损益，正数为收益，负数为损失。
+func (c *FXConversion) GainLoss() int64 {
+	return c.SettledAmount - c.BookedAmount
+}
+
+// 分账接收方类型，与支付服务分账指令一致。
+const (
+	SplitRecipientMerchant = "MERCHANT"
+	SplitRecipientPlatform = "PLATFORM"
+	SplitRecipientPromoter = "PROMOTER"
+)
+
+// SplitShare 支付服务在扣款时生成的分账明细，Amount 为记账币种金额。
+type SplitShare struct {
+	SplitNo       string
+	RecipientType string
+	RecipientID   uint64
+	Amount        int64
+}
+
+// SplitSubject 返回分账接收方对应的科目与核算主体：商户应付 2001，推广佣金应付 2002，平台佣金收入 6001。
+func SplitSubject(recipientType string, recipientID uint64) (subjectCode, entityID string) {
+	switch recipientType {
+	case SplitRecipientPlatform:
+		return "6001", "PLATFORM_MAIN"
+	case SplitRecipientPromoter:
+		return "2002", fmt.Sprintf("PROMOTER_%d", recipientID)
+	default:
+		return "2001", fmt.Sprintf("MERCH_%d", recipientID)
+	}
+}
+
 type EntryLine struct {
 	gorm.Model
 	EntryID     uint64    `gorm:"index;not null;comment:关联凭证ID" json:"entry_id"`
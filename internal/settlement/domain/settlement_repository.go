@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"time"
 )
 
 // SettlementRepository 是结算模块的仓储接口。
@@ -21,6 +22,8 @@ type SettlementRepository interface {
 	GetSettlementByNo(ctx context.Context, no string) (*Settlement, error)
 	// ListSettlements 列出指定商户ID的所有结算单实体，支持通过状态过滤和分页。
 	ListSettlements(ctx context.Context, merchantID uint64, status *SettlementStatus, offset, limit int) ([]*Settlement, int64, error)
+	// ListDueSettlements 列出结束日期不晚于 cutoff 且尚未完成 (待结算或结算中) 的结算单，按 ID 升序。
+	ListDueSettlements(ctx context.Context, cutoff time.Time, limit int) ([]*Settlement, error)
 
 	// --- 结算明细管理 (SettlementDetail methods) ---
 
@@ -0,0 +1,39 @@
+package domain
+
+import "testing"
+
+func TestFeeOf(t *testing.T) {
+	tests := []struct {
+		amount, bps, want int64
+	}{
+		{amount: 10000, bps: 60, want: 60},
+		{amount: 8333, bps: 60, want: 50}, // 49.998 四舍五入
+		{amount: 8250, bps: 60, want: 50}, // 49.5 进位
+		{amount: 8249, bps: 60, want: 49}, // 49.494 舍去
+		{amount: 1, bps: 60, want: 0},
+		{amount: 12345, bps: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := FeeOf(tt.amount, tt.bps); got != tt.want {
+			t.Errorf("FeeOf(%d, %d) = %d, want %d", tt.amount, tt.bps, got, tt.want)
+		}
+	}
+}
+
+func TestMerchantAccountFeeBps(t *testing.T) {
+	tests := []struct {
+		rate float64
+		want int64
+	}{
+		{rate: 0.6, want: 60},
+		{rate: 0.29, want: 29}, // 0.29*100 的浮点结果为 28.999...
+		{rate: 5, want: 500},
+		{rate: 0, want: 0},
+	}
+	for _, tt := range tests {
+		a := &MerchantAccount{FeeRate: tt.rate}
+		if got := a.FeeBps(); got != tt.want {
+			t.Errorf("FeeBps() with rate %v = %d, want %d", tt.rate, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/wyfcoding/ecommerce/internal/settlement/domain"
 	"gorm.io/gorm"
@@ -69,6 +70,19 @@ func (r *settlementRepository) ListSettlements(ctx context.Context, merchantID u
 	return list, total, nil
 }
 
+func (r *settlementRepository) ListDueSettlements(ctx context.Context, cutoff time.Time, limit int) ([]*domain.Settlement, error) {
+	var list []*domain.Settlement
+	err := r.db.WithContext(ctx).
+		Where("end_date <= ? AND status IN ?", cutoff, []domain.SettlementStatus{domain.SettlementStatusPending, domain.SettlementStatusProcessing}).
+		Order("id asc").
+		Limit(limit).
+		Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
 // --- 结算明细管理 (SettlementDetail methods) ---
 
 func (r *settlementRepository) SaveSettlementDetail(ctx context.Context, detail *domain.SettlementDetail) error {
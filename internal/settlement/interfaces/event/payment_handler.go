@@ -7,8 +7,12 @@ import (
 
 	kafkago "github.com/segmentio/kafka-go"
 	"github.com/wyfcoding/ecommerce/internal/settlement/application"
+	"github.com/wyfcoding/ecommerce/internal/settlement/domain"
 )
 
+// channelCostBps 渠道成本费率，单位为基点 (假设 0.6%)。
+const channelCostBps = 60
+
 // PaymentHandler 处理支付相关的消息事件。
 type PaymentHandler struct {
 	app    *application.SettlementService
@@ -31,6 +35,16 @@ func (h *PaymentHandler) HandlePaymentCaptured(ctx context.Context, msg kafkago.
 		UserID    uint64 `json:"user_id"`
 		Amount    int64  `json:"amount"`
 		Timestamp int64  `json:"timestamp"`
+
+		// 多币种字段，早于多币种改造的事件不携带，视为本币交易
+		Currency                 string `json:"currency"`
+		SettlementCurrency       string `json:"settlement_currency"`
+		FXRate                   string `json:"fx_rate"`
+		CapturedSettlementAmount int64  `json:"captured_settlement_amount"`
+		SettledSettlementAmount  int64  `json:"settled_settlement_amount"`
+
+		// 分账明细，单商户订单不携带
+		Splits []splitEvent `json:"splits"`
 	}
 
 	if err := json.Unmarshal(msg.Value, &event); err != nil {
@@ -38,12 +52,84 @@ func (h *PaymentHandler) HandlePaymentCaptured(ctx context.Context, msg kafkago.
 		return err
 	}
 
-	h.logger.Info("received payment captured event", "payment_no", event.PaymentNo, "amount", event.Amount)
+	h.logger.Info("received payment captured event", "payment_no", event.PaymentNo, "amount", event.Amount, "currency", event.Currency)
 
 	// 业务逻辑：记录支付成功，更新结算单
 	// 假设 merchant_id 为 1 (实际应从订单或产品信息中获取)
 	merchantID := uint64(1)
-	channelCost := int64(float64(event.Amount) * 0.006) // 假设 0.6% 渠道成本
 
-	return h.app.RecordPaymentSuccess(ctx, 0, event.OrderNo, merchantID, event.Amount, channelCost)
+	// 以记账币种入账：金额取按锁定汇率折算的扣款金额，入账汇率下的差额由账务记为汇兑损益
+	amount := event.Amount
+	var fx *domain.FXConversion
+	if event.SettlementCurrency != "" {
+		amount = event.CapturedSettlementAmount
+		fx = &domain.FXConversion{
+			TxnCurrency:        event.Currency,
+			TxnAmount:          event.Amount,
+			SettlementCurrency: event.SettlementCurrency,
+			Rate:               event.FXRate,
+			BookedAmount:       event.CapturedSettlementAmount,
+			SettledAmount:      event.SettledSettlementAmount,
+		}
+	}
+	channelCost := domain.FeeOf(amount, channelCostBps)
+
+	splits := make([]domain.SplitShare, 0, len(event.Splits))
+	for _, split := range event.Splits {
+		splits = append(splits, split.share(event.SettlementCurrency != ""))
+	}
+
+	return h.app.RecordPaymentSuccess(ctx, 0, event.OrderNo, merchantID, amount, channelCost, fx, splits)
+}
+
+// splitEvent 支付事件中的分账明细。
+type splitEvent struct {
+	SplitNo          string `json:"split_no"`
+	RecipientType    string `json:"recipient_type"`
+	RecipientID      uint64 `json:"recipient_id"`
+	Amount           int64  `json:"amount"`
+	SettlementAmount int64  `json:"settlement_amount"`
+	Mode             string `json:"mode"`
+}
+
+// share 转换为记账币种的分账明细，multiCurrency 为 false 时为本币交易，直接取交易金额。
+func (e splitEvent) share(multiCurrency bool) domain.SplitShare {
+	amount := e.Amount
+	if multiCurrency {
+		amount = e.SettlementAmount
+	}
+	return domain.SplitShare{SplitNo: e.SplitNo, RecipientType: e.RecipientType, RecipientID: e.RecipientID, Amount: amount}
+}
+
+// HandleSplitExecuted 处理渠道分账到账事件，冲减接收方应付款项。
+func (h *PaymentHandler) HandleSplitExecuted(ctx context.Context, msg kafkago.Message) error {
+	var event struct {
+		PaymentNo          string `json:"payment_no"`
+		SettlementCurrency string `json:"settlement_currency"`
+		splitEvent
+	}
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		h.logger.Error("failed to unmarshal split executed event", "error", err)
+		return err
+	}
+
+	h.logger.Info("received split executed event", "split_no", event.SplitNo, "payment_no", event.PaymentNo, "amount", event.SettlementAmount)
+	return h.app.RecordSplitExecuted(ctx, event.PaymentNo, event.SettlementCurrency, event.share(true))
+}
+
+// HandleSplitReversed 处理分账回退事件，将退款金额按分账比例冲回接收方。
+func (h *PaymentHandler) HandleSplitReversed(ctx context.Context, msg kafkago.Message) error {
+	var event struct {
+		ReturnNo           string `json:"return_no"`
+		RefundNo           string `json:"refund_no"`
+		SettlementCurrency string `json:"settlement_currency"`
+		splitEvent
+	}
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		h.logger.Error("failed to unmarshal split reversed event", "error", err)
+		return err
+	}
+
+	h.logger.Info("received split reversed event", "return_no", event.ReturnNo, "refund_no", event.RefundNo, "mode", event.Mode, "amount", event.SettlementAmount)
+	return h.app.RecordSplitReversed(ctx, event.ReturnNo, event.RefundNo, event.SettlementCurrency, event.Mode == "GATEWAY", event.share(true))
 }
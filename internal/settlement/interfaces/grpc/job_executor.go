@@ -0,0 +1,23 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wyfcoding/ecommerce/internal/scheduler/jobexecutor"
+	"github.com/wyfcoding/ecommerce/internal/settlement/application"
+	"github.com/wyfcoding/pkg/idempotency"
+)
+
+// NewJobExecutor 创建结算周期作业执行器，承接调度中心的结算周期作业。
+// 每次执行完成截至计划触发时间已到期的结算单。
+func NewJobExecutor(app *application.SettlementService, idem idempotency.Manager) *jobexecutor.Server {
+	return jobexecutor.NewServer(idem, func(ctx context.Context, cutoff time.Time) (string, error) {
+		completed, err := app.RunSettlementCycle(ctx, cutoff)
+		if err != nil {
+			return "", fmt.Errorf("settlement cycle failed after %d completed: %w", completed, err)
+		}
+		return fmt.Sprintf("completed %d settlements due by %s", completed, cutoff.Format(time.RFC3339)), nil
+	})
+}